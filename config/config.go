@@ -1,38 +1,66 @@
 package config
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strings"
 
-	"github.com/SkySingh04/fractal/logger"
+	"github.com/SkySingh04/fractal/interfaces"
 	"github.com/SkySingh04/fractal/registry"
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 )
 
 // Config represents the entire configuration structure
 type Config struct {
-	InputMethod     string                 `yaml:"inputMethod"`
-	OutputMethod    string                 `yaml:"outputMethod"`
-	InputConfig     map[string]interface{} `yaml:"inputconfig"`
-	OutputConfig    map[string]interface{} `yaml:"outputconfig"`
-	Validations     []string               `yaml:"validations"`
-	Transformations []string               `yaml:"transformations"`
-	ErrorHandling   ErrorHandling          `yaml:"errorhandling"`
+	InputMethod     string                             `yaml:"inputMethod"`
+	OutputMethod    string                             `yaml:"outputMethod"`
+	InputConfig     map[string]interface{}             `yaml:"inputconfig"`
+	OutputConfig    map[string]interface{}             `yaml:"outputconfig"`
+	Validations     []string                           `yaml:"validations"`
+	Transformations []string                           `yaml:"transformations"`
+	ErrorHandling   ErrorHandling                      `yaml:"errorhandling"`
+	NormalizeFields interfaces.NormalizeFieldsConfig   `yaml:"normalizefields"`
+	Nulls           interfaces.NullsConfig             `yaml:"nulls"`
+	Reshape         interfaces.ReshapeConfig           `yaml:"reshape"`
+	Validate        interfaces.ValidationConfig        `yaml:"validate"`
+	Transform       interfaces.TransformConfig         `yaml:"transform"`
+	Filter          interfaces.FilterConfig            `yaml:"filter"`
+	Window          interfaces.WindowConfig            `yaml:"window"`
+	Aggregate       interfaces.AggregateConfig         `yaml:"aggregate"`
+	Sort            interfaces.SortConfig              `yaml:"sort"`
+	Join            interfaces.JoinConfig              `yaml:"join"`
+	Lookups         map[string]interfaces.LookupConfig `yaml:"lookups"`
+	Select          interfaces.SelectConfig            `yaml:"select"`
+	Delivery        interfaces.DeliveryConfig          `yaml:"delivery"`
+	Buffer          interfaces.BufferConfig            `yaml:"buffer"`
+	Notifications   interfaces.NotificationsConfig     `yaml:"notifications"`
+	Provenance      interfaces.ProvenanceConfig        `yaml:"provenance"`
+	Schema          interfaces.SchemaConfig            `yaml:"schema"`
+	OutputFields    interfaces.OutputFieldsConfig      `yaml:"outputfields"`
+	Reconcile       interfaces.ReconcileConfig         `yaml:"reconcile"`
+	Tap             interfaces.TapConfig               `yaml:"tap"`
+	Manifest        interfaces.ManifestConfig          `yaml:"manifest"`
+	Profiling       interfaces.ProfilingConfig         `yaml:"profiling"`
+	MaxDuration     string                             `yaml:"maxduration"`
+	OnEmptyInput    string                             `yaml:"onemptyinput"`
+	Stages          []string                           `yaml:"stages"`
+	Profiles        map[string]Profile                 `yaml:"profiles"`
+	Connections     map[string]Connection              `yaml:"connections"`
 }
 
 // ErrorHandling represents the error handling configuration
-type ErrorHandling struct {
-	Strategy         string           `yaml:"strategy"`
-	QuarantineOutput QuarantineOutput `yaml:"quarantineoutput"`
-}
+type ErrorHandling = interfaces.ErrorHandling
 
 // QuarantineOutput represents the quarantine output configuration
-type QuarantineOutput struct {
-	Type     string `yaml:"type"`
-	Location string `yaml:"location"`
-}
+type QuarantineOutput = interfaces.QuarantineOutput
 
 // AskForMode prompts the user to select between starting the HTTP server or using the CLI
 func AskForMode() (string, error) {
@@ -49,12 +77,48 @@ func AskForMode() (string, error) {
 	return mode, nil
 }
 
-// LoadConfig attempts to read the configuration from a file
-func LoadConfig(configFile string) (map[string]interface{}, error) {
-	viper.SetConfigFile(configFile)
-	if err := viper.ReadInConfig(); err != nil {
+// StdinPath is the config path that reads the configuration from standard input
+const StdinPath = "-"
+
+// DefaultConfigFile is the config file used when no path is given
+const DefaultConfigFile = "config.yaml"
+
+// LoadConfig attempts to read the configuration from a file, or from stdin when
+// configFile is "-". format is "yaml" or "json"; stdin defaults to YAML, and a
+// file's extension is used when format is empty.
+func LoadConfig(configFile string, format string) (map[string]interface{}, error) {
+	return LoadConfigWithOptions(Options{}, configFile, format)
+}
+
+// LoadConfigWithOptions is LoadConfig reporting to opts.Logger. It gives up
+// with the context's error when opts.Context is done before the config is read.
+func LoadConfigWithOptions(opts Options, configFile string, format string) (map[string]interface{}, error) {
+	opts = opts.withDefaults()
+	if err := opts.Context.Err(); err != nil {
 		return nil, err
 	}
+	format = strings.ToLower(format)
+	if format != "" && format != "yaml" && format != "yml" && format != "json" {
+		return nil, fmt.Errorf("unsupported config format %q: expected yaml or json", format)
+	}
+
+	if configFile == StdinPath {
+		if format == "" {
+			format = "yaml"
+		}
+		viper.SetConfigType(format)
+		if err := viper.ReadConfig(os.Stdin); err != nil {
+			return nil, fmt.Errorf("failed to parse config from stdin as %s: %w", format, err)
+		}
+	} else {
+		viper.SetConfigFile(configFile)
+		if format != "" {
+			viper.SetConfigType(format)
+		}
+		if err := viper.ReadInConfig(); err != nil {
+			return nil, err
+		}
+	}
 
 	config := map[string]interface{}{
 		"inputMethod":     viper.GetString("inputMethod"),
@@ -64,84 +128,222 @@ func LoadConfig(configFile string) (map[string]interface{}, error) {
 		"errorhandling":   viper.GetStringMap("errorhandling"), // Keep this as a map if it contains structured data
 		"validations":     viper.GetString("validations"),      // Changed to GetString
 		"transformations": viper.GetString("transformations"),  // Changed to GetString
+		"normalizefields": viper.GetStringMap("normalizefields"),
+		"nulls":           viper.GetStringMap("nulls"),
+		"reshape":         viper.GetStringMap("reshape"),
+		"validate":        viper.GetStringMap("validate"),
+		"transform":       viper.GetStringMap("transform"),
+		"filter":          viper.GetStringMap("filter"),
+		"window":          viper.GetStringMap("window"),
+		"aggregate":       viper.GetStringMap("aggregate"),
+		"sort":            viper.GetStringMap("sort"),
+		"join":            viper.GetStringMap("join"),
+		"lookups":         viper.GetStringMap("lookups"),
+		"select":          viper.GetStringMap("select"),
+		"delivery":        viper.GetStringMap("delivery"),
+		"buffer":          viper.GetStringMap("buffer"),
+		"notifications":   viper.GetStringMap("notifications"),
+		"provenance":      viper.GetStringMap("provenance"),
+		"schema":          viper.GetStringMap("schema"),
+		"outputfields":    viper.GetStringMap("outputfields"),
+		"reconcile":       viper.GetStringMap("reconcile"),
+		"tap":             viper.GetStringMap("tap"),
+		"manifest":        viper.GetStringMap("manifest"),
+		"profiling":       viper.GetStringMap("profiling"),
+		"maxduration":     viper.GetString("maxduration"),
+		"onemptyinput":    viper.GetString("onemptyinput"),
+		"stages":          viper.GetStringSlice("stages"),
+		"profiles":        viper.GetStringMap("profiles"),
+		"connections":     viper.GetStringMap("connections"),
+	}
+	if err := CheckConnections(config); err != nil {
+		return nil, err
 	}
 
-	logger.Infof("Configuration loaded from %s", configFile)
+	if configFile == StdinPath {
+		opts.Logger.Infof("Configuration loaded from stdin")
+	} else {
+		opts.Logger.Infof("Configuration loaded from %s", configFile)
+	}
 	return config, nil
 }
 
 // SetupConfigInteractively prompts the user to set up input and output methods interactively,
-// including all required fields for the selected integrations.
-func SetupConfigInteractively() (map[string]interface{}, error) {
-	// Dynamically retrieve registered input and output options
-	inputMethods := getRegisteredDataSources()
-	outputMethods := getRegisteredDataDestinations()
+// including all required fields for the selected integrations, and saves the result to path.
+// A file already at path is left alone.
+func SetupConfigInteractively(path string) (map[string]interface{}, error) {
+	return SetupConfigInteractivelyWithOptions(Options{}, path)
+}
+
+// SetupConfigInteractivelyWithOptions is SetupConfigInteractively reporting to
+// opts.Logger. It stops between prompts once opts.Context is done.
+func SetupConfigInteractivelyWithOptions(opts Options, path string) (map[string]interface{}, error) {
+	return promptForConfig(opts.withDefaults(), nil, path)
+}
+
+// EditConfigInteractively walks through the same prompts as SetupConfigInteractively,
+// starting from an existing configuration: the current methods are preselected and
+// every field is prefilled with its current value. Fields the configuration doesn't
+// have yet are marked as new. Sections the prompts don't cover are kept as they are.
+// The result replaces the file at path unless it changed while the prompts ran.
+func EditConfigInteractively(existing map[string]interface{}, path string) (map[string]interface{}, error) {
+	return EditConfigInteractivelyWithOptions(Options{}, existing, path)
+}
+
+// EditConfigInteractivelyWithOptions is EditConfigInteractively reporting to
+// opts.Logger. It stops between prompts once opts.Context is done.
+func EditConfigInteractivelyWithOptions(opts Options, existing map[string]interface{}, path string) (map[string]interface{}, error) {
+	return promptForConfig(opts.withDefaults(), existing, path)
+}
+
+// AskToEditConfig asks whether to run with the existing configuration or edit it first
+func AskToEditConfig(path string) (bool, error) {
+	prompt := promptui.Select{
+		Label: "Found " + path,
+		Items: []string{"Run with existing configuration", "Edit configuration"},
+	}
+	_, choice, err := prompt.Run()
+	if err != nil {
+		return false, fmt.Errorf("failed to select configuration action: %w", err)
+	}
+	return choice == "Edit configuration", nil
+}
+
+// promptForConfig prompts for every setting, using existing (which may be nil) for the defaults.
+// Nothing is saved once opts.Context is done.
+func promptForConfig(opts Options, existing map[string]interface{}, path string) (map[string]interface{}, error) {
+	// Remember the file as it was, so saving can tell whether something else wrote it meanwhile
+	if err := opts.Context.Err(); err != nil {
+		return nil, err
+	}
+	original, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Dynamically retrieve registered input and output options, and the connections defined
+	refs := connectionMethods(existing)
+	inputMethods := append(getRegisteredDataSources(), refs...)
+	outputMethods := append(getRegisteredDataDestinations(), refs...)
 
 	// Prompt for Input Method
 	inputPrompt := promptui.Select{
-		Label: "Select Input Method",
-		Items: inputMethods,
+		Label:     "Select Input Method",
+		Items:     inputMethods,
+		CursorPos: IndexOf(inputMethods, StringValue(existing, "inputMethod")),
 	}
 	_, inputMethod, err := inputPrompt.Run()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get input method: %w", err)
 	}
+	if err := opts.Context.Err(); err != nil {
+		return nil, err
+	}
 
-	// Read additional fields for the input method
-	inputconfig, err := readIntegrationFields(inputMethod, true)
+	// Read additional fields for the input method, keeping the old values only if the method is unchanged
+	var currentInput map[string]interface{}
+	if inputMethod == StringValue(existing, "inputMethod") {
+		currentInput = MapValue(existing, "inputconfig")
+	}
+	inputconfig, err := readMethodFields(inputMethod, true, currentInput)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get fields for input method: %w", err)
 	}
+	if err := opts.Context.Err(); err != nil {
+		return nil, err
+	}
 
 	// Prompt for Output Method
 	outputPrompt := promptui.Select{
-		Label: "Select Output Method",
-		Items: outputMethods,
+		Label:     "Select Output Method",
+		Items:     outputMethods,
+		CursorPos: IndexOf(outputMethods, StringValue(existing, "outputMethod")),
 	}
 	_, outputMethod, err := outputPrompt.Run()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get output method: %w", err)
 	}
+	if err := opts.Context.Err(); err != nil {
+		return nil, err
+	}
 
 	// Read additional fields for the output method
-	outputconfig, err := readIntegrationFields(outputMethod, false)
+	var currentOutput map[string]interface{}
+	if outputMethod == StringValue(existing, "outputMethod") {
+		currentOutput = MapValue(existing, "outputconfig")
+	}
+	outputconfig, err := readMethodFields(outputMethod, false, currentOutput)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get fields for output method: %w", err)
 	}
+	if err := opts.Context.Err(); err != nil {
+		return nil, err
+	}
 
 	// Read validations and transformations
-	validations, err := readRules("validations")
+	validations, err := readRules("validations", StringValue(existing, "validations"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to read validation rules: %w", err)
 	}
-	transformations, err := readRules("transformations")
+	transformations, err := readRules("transformations", StringValue(existing, "transformations"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to read transformation rules: %w", err)
 	}
 
 	// Read error handling
-	errorhandling, err := readErrorHandlingConfig()
+	errorhandling, err := readErrorHandlingConfig(MapValue(existing, "errorhandling"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to read error handling configuration: %w", err)
 	}
+	if err := opts.Context.Err(); err != nil {
+		return nil, err
+	}
 
-	// Combine all configurations
-	config := map[string]interface{}{
-		"inputMethod":     inputMethod,
-		"outputMethod":    outputMethod,
-		"inputconfig":     inputconfig,
-		"outputconfig":    outputconfig,
-		"validations":     validations,
-		"transformations": transformations,
-		"errorhandling":   errorhandling,
+	// Combine all configurations, on top of whatever else the existing configuration holds
+	config := make(map[string]interface{})
+	for key, value := range existing {
+		config[key] = value
+	}
+	config["inputMethod"] = inputMethod
+	config["outputMethod"] = outputMethod
+	config["inputconfig"] = inputconfig
+	config["outputconfig"] = outputconfig
+	config["validations"] = validations
+	config["transformations"] = transformations
+	config["errorhandling"] = errorhandling
+	if err := saveConfig(path, config, existing != nil, original); err != nil {
+		opts.Logger.Infof("Failed to save configuration: %v", err)
+	} else {
+		opts.Logger.Infof("Configuration saved to %s", path)
 	}
-	saveConfig(config)
 
 	return config, nil
 }
 
-// readIntegrationFields dynamically prompts for and reads all fields in the selected integration struct
-func readIntegrationFields(method string, isSource bool) (map[string]interface{}, error) {
+// connectionMethods returns the methods referencing the connections of the configuration
+func connectionMethods(config map[string]interface{}) []string {
+	var methods []string
+	for _, name := range connectionNames(MapValue(config, "connections")) {
+		methods = append(methods, ConnectionPrefix+name)
+	}
+	return methods
+}
+
+// readMethodFields reads the fields of the selected method. A connection's
+// fields are edited in the connection, so the current overrides are kept.
+func readMethodFields(method string, isSource bool, current map[string]interface{}) (map[string]interface{}, error) {
+	if _, ok := connectionRef(method); ok {
+		if current == nil {
+			current = make(map[string]interface{})
+		}
+		return current, nil
+	}
+	return readIntegrationFields(method, isSource, current)
+}
+
+// readIntegrationFields dynamically prompts for and reads all fields in the selected integration struct.
+// Fields found in current are prefilled with their value.
+func readIntegrationFields(method string, isSource bool, current map[string]interface{}) (map[string]interface{}, error) {
 	var integration interface{}
 	var found bool
 
@@ -168,70 +370,139 @@ func readIntegrationFields(method string, isSource bool) (map[string]interface{}
 	config := make(map[string]interface{})
 	for i := 0; i < val.NumField(); i++ {
 		field := val.Type().Field(i)
+		// Unexported fields are not settings, such as a source's test hooks
+		if !field.IsExported() {
+			continue
+		}
 		fieldName := field.Name
 		fieldType := field.Type
 
-		// Prompt the user for the field value
-		prompt := promptui.Prompt{
-			Label: fmt.Sprintf("Enter %s (%s)", fieldName, fieldType),
+		// Prompt the user for the field value, prefilled with the current one
+		label := fmt.Sprintf("Enter %s (%s)", fieldName, fieldType)
+		if isRequired(field) {
+			label += " (required)"
+		}
+		currentValue, exists := FieldValue(current, fieldName)
+		if current != nil && !exists {
+			label += " (new)"
 		}
-		value, err := prompt.Run()
+		value, err := NewFieldPrompt(field).ask(label, currentValue)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get value for field %s: %w", fieldName, err)
 		}
 
-		// Assign the value to the config
-		config[fieldName] = value
+		// Assign the value to the config, under the lowercase key viper reads it back as
+		config[FieldKey(fieldName)] = value
 	}
 
 	return config, nil
 }
 
-// readRules reads validation or transformation rules interactively
-func readRules(ruleType string) (string, error) {
+// readRules reads validation or transformation rules interactively. Each current rule is
+// offered for editing first; clearing one removes it.
+func readRules(ruleType string, current string) (string, error) {
+	edit := func(rule string) (string, error) {
+		prompt := promptui.Prompt{
+			Label:     fmt.Sprintf("Edit %s rule (clear to remove):", ruleType),
+			Default:   rule,
+			AllowEdit: true,
+		}
+		return prompt.Run()
+	}
 	prompt := promptui.Prompt{
 		Label: fmt.Sprintf("Enter %s rules (multiline, finish with empty line):", ruleType),
 	}
-	rules := ""
-	for {
-		line, err := prompt.Run()
-		if err != nil {
-			return "", fmt.Errorf("failed to read %s: %w", ruleType, err)
-		}
-		if line == "" {
-			break
-		}
-		rules += line + "\n"
+	rules, err := EditRules(current, edit, prompt.Run)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", ruleType, err)
 	}
 	return rules, nil
 }
 
-// readErrorHandlingConfig prompts for error handling strategy and quarantine details
-func readErrorHandlingConfig() (map[string]interface{}, error) {
+// readErrorHandlingConfig prompts for error handling strategy and quarantine details,
+// keeping any other settings in current
+func readErrorHandlingConfig(current map[string]interface{}) (map[string]interface{}, error) {
 	prompt := promptui.Prompt{
-		Label: "Enter Error Handling Strategy (e.g., LOG_AND_CONTINUE, STOP_ON_ERROR):",
+		Label:     "Enter Error Handling Strategy (e.g., LOG_AND_CONTINUE, STOP_ON_ERROR):",
+		Default:   StringValue(current, "strategy"),
+		AllowEdit: true,
 	}
 	strategy, err := prompt.Run()
 	if err != nil {
 		return nil, fmt.Errorf("failed to read error handling strategy: %w", err)
 	}
 
-	return map[string]interface{}{
-		"strategy": strategy,
-	}, nil
+	errorhandling := make(map[string]interface{})
+	for key, value := range current {
+		errorhandling[key] = value
+	}
+	errorhandling["strategy"] = strategy
+	return errorhandling, nil
 }
 
-// saveConfig writes the configuration to a config.yaml file
-func saveConfig(config map[string]interface{}) {
+// readConfigFile returns the contents of the config file, or nil if there is none
+func readConfigFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// saveConfig writes the configuration to path, along with any other settings
+// the file was loaded with. It only replaces a file it was asked to edit, and
+// only if the file still holds what it did before the prompts, original, so
+// a file written by a concurrent run is not lost. The file is replaced
+// atomically, so a crash never leaves a truncated config behind.
+func saveConfig(path string, config map[string]interface{}, editing bool, original []byte) error {
+	current, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	if current != nil && !editing {
+		return fmt.Errorf("%s already exists, not overwriting it", path)
+	}
+	if editing && !bytes.Equal(current, original) {
+		return fmt.Errorf("%s changed while editing, not overwriting it", path)
+	}
+
 	for key, value := range config {
 		viper.Set(key, value)
 	}
+	data, err := yaml.Marshal(viper.AllSettings())
+	if err != nil {
+		return fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	return writeFileAtomic(path, data)
+}
 
-	if err := viper.WriteConfigAs("config.yaml"); err != nil {
-		fmt.Println("Failed to save configuration:", err)
-	} else {
-		fmt.Println("Configuration saved to config.yaml")
+// writeFileAtomic replaces the file at path by writing a temporary file next to it and renaming it into place
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	// Flush to disk before the rename, or a crash could leave the new name pointing at an empty file
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
 	}
+	return os.Rename(tmp.Name(), path)
 }
 
 // Helper function to retrieve registered input methods
@@ -240,6 +511,7 @@ func getRegisteredDataSources() []string {
 	for source := range registry.GetSources() {
 		sources = append(sources, source)
 	}
+	sort.Strings(sources)
 	return sources
 }
 
@@ -249,5 +521,6 @@ func getRegisteredDataDestinations() []string {
 	for dest := range registry.GetDestinations() {
 		destinations = append(destinations, dest)
 	}
+	sort.Strings(destinations)
 	return destinations
 }
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ConnectionPrefix starts an inputMethod or outputMethod naming a connection
+// rather than an integration, as in ref:warehouse
+const ConnectionPrefix = "ref:"
+
+// Connection is a named integration config shared by the configurations
+// referencing it, so its settings, such as credentials, live in one place
+type Connection struct {
+	Method string                 `yaml:"method"`
+	Config map[string]interface{} `yaml:"config"`
+}
+
+// methodSections pairs each method key with the config it selects the fields of
+var methodSections = [][2]string{{"inputMethod", "inputconfig"}, {"outputMethod", "outputconfig"}}
+
+// CheckConnections reports a method referencing a connection the
+// configuration doesn't define, or one that names no method
+func CheckConnections(config map[string]interface{}) error {
+	connections := MapValue(config, "connections")
+	for _, section := range methodSections {
+		name, ok := connectionRef(StringValue(config, section[0]))
+		if !ok {
+			continue
+		}
+		if _, err := lookupConnection(connections, name); err != nil {
+			return fmt.Errorf("%s %s%s: %w", section[0], ConnectionPrefix, name, err)
+		}
+	}
+	return nil
+}
+
+// ResolveConnections replaces a method referencing a connection with the
+// connection's method, and its config with the connection's, the fields of
+// inputconfig or outputconfig replacing those of the connection. Profiles are
+// applied on top afterwards. The connections themselves are removed, so
+// credentials of the ones not referenced go no further.
+func ResolveConnections(config map[string]interface{}) error {
+	connections := MapValue(config, "connections")
+	delete(config, "connections")
+	for _, section := range methodSections {
+		name, ok := connectionRef(StringValue(config, section[0]))
+		if !ok {
+			continue
+		}
+		connection, err := lookupConnection(connections, name)
+		if err != nil {
+			return fmt.Errorf("%s %s%s: %w", section[0], ConnectionPrefix, name, err)
+		}
+		merged := make(map[string]interface{})
+		for key, value := range MapValue(connection, "config") {
+			merged[strings.ToLower(key)] = value
+		}
+		for key, value := range MapValue(config, section[1]) {
+			merged[key] = value
+		}
+		config[section[0]] = StringValue(connection, "method")
+		config[section[1]] = merged
+	}
+	return nil
+}
+
+// connectionRef returns the connection a method references, if it does
+func connectionRef(method string) (string, bool) {
+	if len(method) < len(ConnectionPrefix) || !strings.EqualFold(method[:len(ConnectionPrefix)], ConnectionPrefix) {
+		return "", false
+	}
+	return strings.TrimSpace(method[len(ConnectionPrefix):]), true
+}
+
+// lookupConnection returns the named connection. Names are matched in lower
+// case, as config keys are read.
+func lookupConnection(connections map[string]interface{}, name string) (map[string]interface{}, error) {
+	connection, ok := connections[strings.ToLower(name)].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("connection %q not found, available connections: %v", name, connectionNames(connections))
+	}
+	if strings.TrimSpace(StringValue(connection, "method")) == "" {
+		return nil, fmt.Errorf("connection %q has no method", name)
+	}
+	return connection, nil
+}
+
+// connectionNames lists the defined connections, sorted
+func connectionNames(connections map[string]interface{}) []string {
+	names := make([]string, 0, len(connections))
+	for name := range connections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
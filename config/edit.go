@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IndexOf returns the position of value in items, or 0 when it isn't there
+func IndexOf(items []string, value string) int {
+	for i, item := range items {
+		if item == value {
+			return i
+		}
+	}
+	return 0
+}
+
+// StringValue returns config[key] as a string, or "" if it is missing
+func StringValue(config map[string]interface{}, key string) string {
+	value, ok := config[key]
+	if !ok || value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// MapValue returns config[key] when it is a map, or nil
+func MapValue(config map[string]interface{}, key string) map[string]interface{} {
+	value, _ := config[key].(map[string]interface{})
+	return value
+}
+
+// FieldKey returns the config key of an integration field. Viper lowercases
+// keys, so the field is stored the way it is read back.
+func FieldKey(fieldName string) string {
+	return strings.ToLower(fieldName)
+}
+
+// FieldValue returns the current value of an integration field, and whether
+// the configuration has it at all
+func FieldValue(current map[string]interface{}, fieldName string) (string, bool) {
+	_, exists := current[FieldKey(fieldName)]
+	return StringValue(current, FieldKey(fieldName)), exists
+}
+
+// EditRules edits the rules in current, one per line. Each rule is passed to
+// edit first, and one edited to "" is removed; then add is called for new
+// rules until it returns "". The rules come back one per line.
+func EditRules(current string, edit func(rule string) (string, error), add func() (string, error)) (string, error) {
+	rules := ""
+	for _, rule := range strings.Split(current, "\n") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		line, err := edit(rule)
+		if err != nil {
+			return "", err
+		}
+		if line != "" {
+			rules += line + "\n"
+		}
+	}
+	for {
+		line, err := add()
+		if err != nil {
+			return "", err
+		}
+		if line == "" {
+			break
+		}
+		rules += line + "\n"
+	}
+	return rules, nil
+}
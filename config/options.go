@@ -0,0 +1,38 @@
+package config
+
+import (
+	"context"
+
+	"github.com/SkySingh04/fractal/logger"
+)
+
+// Logger receives the messages the config functions report
+type Logger interface {
+	Infof(format string, args ...any)
+}
+
+// Options lets a library caller control the config functions: Context stops
+// them early, between steps, and Logger receives what they report. Unset
+// fields fall back to context.Background and the logger package.
+type Options struct {
+	Context context.Context
+	Logger  Logger
+}
+
+// defaultLogger reports through the logger package
+type defaultLogger struct{}
+
+func (defaultLogger) Infof(format string, args ...any) {
+	logger.Infof(format, args...)
+}
+
+// withDefaults fills in the unset options
+func (o Options) withDefaults() Options {
+	if o.Context == nil {
+		o.Context = context.Background()
+	}
+	if o.Logger == nil {
+		o.Logger = defaultLogger{}
+	}
+	return o
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ProfileEnv selects a profile when no --profile flag is given
+const ProfileEnv = "FRACTAL_PROFILE"
+
+// Profile holds the settings that differ between environments, merged over
+// the inputconfig and outputconfig of the configuration
+type Profile struct {
+	InputConfig  map[string]interface{} `yaml:"inputconfig"`
+	OutputConfig map[string]interface{} `yaml:"outputconfig"`
+}
+
+// ProfileName returns the profile to use: the flag value if set, otherwise $FRACTAL_PROFILE
+func ProfileName(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv(ProfileEnv)
+}
+
+// ApplyProfile merges the named profile into the configuration. Its fields
+// replace those of inputconfig and outputconfig, and ${VAR} references in its
+// string values are replaced with environment variables, which must be set.
+// The profiles themselves are removed, so credentials for other environments
+// go no further. An empty name applies no profile.
+func ApplyProfile(config map[string]interface{}, name string) error {
+	profiles := MapValue(config, "profiles")
+	delete(config, "profiles")
+	if name == "" {
+		return nil
+	}
+	profile, ok := profiles[strings.ToLower(name)].(map[string]interface{})
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for profileName := range profiles {
+			names = append(names, profileName)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("profile %q not found, available profiles: %v", name, names)
+	}
+	for _, section := range []string{"inputconfig", "outputconfig"} {
+		overrides := MapValue(profile, section)
+		if len(overrides) == 0 {
+			continue
+		}
+		merged := make(map[string]interface{})
+		for key, value := range MapValue(config, section) {
+			merged[key] = value
+		}
+		for key, value := range overrides {
+			expanded, err := expandEnv(value)
+			if err != nil {
+				return fmt.Errorf("profile %q %s.%s: %w", name, section, key, err)
+			}
+			merged[strings.ToLower(key)] = expanded
+		}
+		config[section] = merged
+	}
+	return nil
+}
+
+// expandEnv replaces ${VAR} and $VAR in strings, including those in lists
+func expandEnv(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		var missing []string
+		expanded := os.Expand(v, func(name string) string {
+			// Secret references are left for ResolveSecrets
+			if strings.HasPrefix(name, secretFilePrefix) || strings.HasPrefix(name, secretVaultPrefix) {
+				return "${" + name + "}"
+			}
+			env, ok := os.LookupEnv(name)
+			if !ok {
+				missing = append(missing, name)
+			}
+			return env
+		})
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+		}
+		return expanded, nil
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			expanded, err := expandEnv(item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = expanded
+		}
+		return list, nil
+	}
+	return value, nil
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+)
+
+// Kinds of prompt the interactive setup asks for an integration field with
+const (
+	PromptText  = "text"
+	PromptEnum  = "enum"
+	PromptBool  = "bool"
+	PromptInt   = "int"
+	PromptFloat = "float"
+)
+
+// unsetChoice is the choice leaving an optional enum field empty, for its default
+const unsetChoice = "(default)"
+
+// FieldPrompt is how the interactive setup asks for one integration field
+type FieldPrompt struct {
+	Kind     string
+	Choices  []string // Values of an enum field
+	Fallback string   // Offered when the config has no value yet
+	Required bool
+}
+
+// NewFieldPrompt reads the fractal tag of a field: enum=a|b|c offers the
+// values to pick from, bool asks yes or no, int and float only take numbers,
+// and default=<value> is offered when the config has none. A field without
+// a kind takes the one of its Go type, text for strings and lists.
+func NewFieldPrompt(field reflect.StructField) FieldPrompt {
+	p := FieldPrompt{Kind: goPromptKind(field.Type), Required: isRequired(field)}
+	for _, option := range strings.Split(field.Tag.Get("fractal"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(option), "=")
+		switch name {
+		case PromptEnum:
+			p.Kind, p.Choices = PromptEnum, strings.Split(value, "|")
+		case PromptBool, PromptInt, PromptFloat:
+			p.Kind = name
+		case "default":
+			p.Fallback = value
+		}
+	}
+	return p
+}
+
+// goPromptKind returns the prompt kind of a field's Go type
+func goPromptKind(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return PromptBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return PromptInt
+	case reflect.Float32, reflect.Float64:
+		return PromptFloat
+	}
+	return PromptText
+}
+
+// Validate checks a typed value is a number of the field's kind. An optional
+// field may be left empty.
+func (p FieldPrompt) Validate(input string) error {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		if p.Required {
+			return errors.New("a value is required")
+		}
+		return nil
+	}
+	switch p.Kind {
+	case PromptInt:
+		if _, err := strconv.Atoi(input); err != nil {
+			return fmt.Errorf("%q is not a whole number", input)
+		}
+	case PromptFloat:
+		if _, err := strconv.ParseFloat(input, 64); err != nil {
+			return fmt.Errorf("%q is not a number", input)
+		}
+	}
+	return nil
+}
+
+// ask prompts for the field's value, starting from current, and returns it
+// as the text the config stores
+func (p FieldPrompt) ask(label, current string) (string, error) {
+	if current == "" {
+		current = p.Fallback
+	}
+	switch p.Kind {
+	case PromptEnum:
+		items := p.Choices
+		if !p.Required {
+			items = append([]string{unsetChoice}, items...)
+		}
+		cursor := 0
+		for i, item := range items {
+			if strings.EqualFold(item, current) {
+				cursor = i
+			}
+		}
+		_, value, err := (&promptui.Select{Label: label, Items: items, Size: len(items), CursorPos: cursor}).Run()
+		if value == unsetChoice {
+			value = ""
+		}
+		return value, err
+	case PromptBool:
+		// A confirm prompt answers anything but yes with ErrAbort
+		confirm := promptui.Prompt{Label: label, IsConfirm: true}
+		if parsed, err := strconv.ParseBool(current); err == nil && parsed {
+			confirm.Default = "y"
+		}
+		_, err := confirm.Run()
+		if errors.Is(err, promptui.ErrAbort) {
+			return "false", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return "true", nil
+	case PromptInt, PromptFloat:
+		return (&promptui.Prompt{Label: label, Default: current, AllowEdit: true, Validate: p.Validate}).Run()
+	}
+	return (&promptui.Prompt{Label: label, Default: current, AllowEdit: true}).Run()
+}
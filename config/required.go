@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/registry"
+)
+
+// RequiredFields returns the config keys of the integration fields tagged
+// fractal:"required", lowercased as the interactive setup stores them
+func RequiredFields(integration interface{}) []string {
+	t := reflect.TypeOf(integration)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		if isRequired(t.Field(i)) {
+			fields = append(fields, strings.ToLower(t.Field(i).Name))
+		}
+	}
+	return fields
+}
+
+// isRequired reports whether the fractal tag of a field lists required
+func isRequired(field reflect.StructField) bool {
+	for _, option := range strings.Split(field.Tag.Get("fractal"), ",") {
+		if strings.TrimSpace(option) == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckRequiredFields reports every required field of the input and output
+// integrations that inputconfig or outputconfig leaves out or empty, all in
+// one error, so a hand-edited config fails before anything connects.
+// Integrations that are not registered are left to fail when they are looked up.
+func CheckRequiredFields(config map[string]interface{}) error {
+	var problems []string
+	check := func(methodKey, configKey string, lookup func(string) (interface{}, bool)) {
+		method, _ := config[methodKey].(string)
+		integration, ok := lookup(method)
+		if !ok {
+			return
+		}
+		section, _ := config[configKey].(map[string]interface{})
+		var missing []string
+		for _, field := range RequiredFields(integration) {
+			if isEmptyValue(section[field]) {
+				missing = append(missing, field)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			problems = append(problems, fmt.Sprintf("%s of %s: %s", configKey, method, strings.Join(missing, ", ")))
+		}
+	}
+	check("inputMethod", "inputconfig", func(name string) (interface{}, bool) { return registry.GetSource(name) })
+	check("outputMethod", "outputconfig", func(name string) (interface{}, bool) { return registry.GetDestination(name) })
+	if len(problems) == 0 {
+		return nil
+	}
+	return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("missing required fields in %s", strings.Join(problems, "; ")))
+}
+
+// isEmptyValue reports whether a config value is missing, blank or an empty list or map
+func isEmptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(v) == ""
+	case []interface{}:
+		return len(v) == 0
+	case []string:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
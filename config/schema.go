@@ -0,0 +1,128 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/SkySingh04/fractal/registry"
+)
+
+// SchemaURL identifies the JSON Schema draft the config schema is written against
+const SchemaURL = "http://json-schema.org/draft-07/schema#"
+
+// Schema describes the configuration file as a JSON Schema. It is generated
+// from the Config struct and the registered integrations, so it always
+// matches the code: inputconfig and outputconfig get the fields of whichever
+// integration inputMethod and outputMethod select.
+func Schema() map[string]interface{} {
+	schema := typeSchema(reflect.TypeOf(Config{}))
+	schema["$schema"] = SchemaURL
+	schema["title"] = "Fractal configuration"
+
+	properties := schema["properties"].(map[string]interface{})
+	sources := getRegisteredDataSources()
+	destinations := getRegisteredDataDestinations()
+	properties["inputMethod"] = methodSchema(sources)
+	properties["outputMethod"] = methodSchema(destinations)
+
+	var conditions []interface{}
+	for _, name := range sources {
+		source, _ := registry.GetSource(name)
+		conditions = append(conditions, integrationCondition("inputMethod", name, "inputconfig", source))
+	}
+	for _, name := range destinations {
+		destination, _ := registry.GetDestination(name)
+		conditions = append(conditions, integrationCondition("outputMethod", name, "outputconfig", destination))
+	}
+	schema["allOf"] = conditions
+	return schema
+}
+
+// methodSchema accepts the registered integrations, or a reference to a connection
+func methodSchema(methods []string) map[string]interface{} {
+	return map[string]interface{}{"type": "string", "anyOf": []interface{}{
+		map[string]interface{}{"enum": methods},
+		map[string]interface{}{"pattern": "^" + ConnectionPrefix + ".+"},
+	}}
+}
+
+// SchemaJSON renders Schema as indented JSON
+func SchemaJSON() ([]byte, error) {
+	return json.MarshalIndent(Schema(), "", "  ")
+}
+
+// integrationCondition applies the integration's fields to configKey when methodKey names it
+func integrationCondition(methodKey, method, configKey string, integration interface{}) map[string]interface{} {
+	fields := map[string]interface{}{"type": "object"}
+	if integration != nil {
+		t := reflect.TypeOf(integration)
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Struct {
+			// The interactive setup stores integration fields under their lowercased names
+			properties := make(map[string]interface{})
+			for i := 0; i < t.NumField(); i++ {
+				field := t.Field(i)
+				if field.IsExported() {
+					properties[strings.ToLower(field.Name)] = typeSchema(field.Type)
+				}
+			}
+			fields["properties"] = properties
+			if required := RequiredFields(integration); len(required) > 0 {
+				fields["required"] = required
+			}
+		}
+	}
+	return map[string]interface{}{
+		"if": map[string]interface{}{
+			"properties": map[string]interface{}{methodKey: map[string]interface{}{"const": method}},
+			"required":   []string{methodKey},
+		},
+		"then": map[string]interface{}{
+			"properties": map[string]interface{}{configKey: fields},
+		},
+	}
+}
+
+// typeSchema maps a Go type to its JSON Schema, naming struct fields after their yaml tags
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		schema := map[string]interface{}{"type": "object"}
+		if t.Elem().Kind() != reflect.Interface {
+			schema["additionalProperties"] = typeSchema(t.Elem())
+		}
+		return schema
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			properties[name] = typeSchema(field.Type)
+		}
+		return map[string]interface{}{"type": "object", "properties": properties}
+	}
+	// Interface values can hold anything
+	return map[string]interface{}{}
+}
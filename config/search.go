@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SearchPaths lists where a config file is looked for when no path is given,
+// in order: the working directory, then the user's and the system's config
+// directories. $XDG_CONFIG_HOME defaults to ~/.config, as the XDG spec says.
+func SearchPaths() []string {
+	paths := []string{DefaultConfigFile, "fractal.yaml"}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			configHome = filepath.Join(home, ".config")
+		}
+	}
+	if configHome != "" {
+		paths = append(paths, filepath.Join(configHome, "fractal", "config.yaml"))
+	}
+	return append(paths, "/etc/fractal/config.yaml")
+}
+
+// FindConfig returns the first of the SearchPaths that is a file. The error
+// wraps fs.ErrNotExist when none is.
+func FindConfig() (string, error) {
+	paths := SearchPaths()
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no config file found in %s: %w", strings.Join(paths, ", "), fs.ErrNotExist)
+}
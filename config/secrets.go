@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// secretFilePrefix marks a ${file:/path} reference, replaced with the contents of the file
+const secretFilePrefix = "file:"
+
+// secretVaultPrefix marks a ${vault:path#key} reference, replaced with a key of a Vault secret
+const secretVaultPrefix = "vault:"
+
+// secretRef matches a ${file:/path} or ${vault:path#key} reference
+var secretRef = regexp.MustCompile(`\$\{(file:|vault:)([^}]*)\}`)
+
+// readSecretFile returns the contents of a mounted secret, such as
+// /run/secrets/db_password, without the trailing newline editors and
+// orchestrators leave
+func readSecretFile(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("secret file reference has no path")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// ResolveSecrets replaces the ${file:/path} and ${vault:path#key} references
+// in the string values of the configuration, however deeply nested, with the
+// contents of the files and the values of the Vault secrets. Call it after
+// ApplyProfile, so a profile's references are resolved too and those of the
+// other profiles are never read. Resolving happens after the config is
+// loaded rather than while loading it, so editing the configuration never
+// writes the secrets back to the file. Each Vault secret is read once.
+func ResolveSecrets(config map[string]interface{}) error {
+	return (&secretResolver{vault: map[string]map[string]interface{}{}}).resolveMap(config)
+}
+
+// secretResolver resolves the references of one configuration, holding the
+// Vault secrets read so far by path
+type secretResolver struct {
+	vault map[string]map[string]interface{}
+}
+
+func (r *secretResolver) resolveMap(config map[string]interface{}) error {
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		resolved, err := r.resolveValue(config[key])
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		config[key] = resolved
+	}
+	return nil
+}
+
+// resolveValue replaces the references in value, which may be a string, list or map
+func (r *secretResolver) resolveValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		var failed error
+		resolved := secretRef.ReplaceAllStringFunc(v, func(ref string) string {
+			m := secretRef.FindStringSubmatch(ref)
+			var secret string
+			var err error
+			if m[1] == secretFilePrefix {
+				secret, err = readSecretFile(m[2])
+			} else {
+				secret, err = r.readVaultSecret(m[2])
+			}
+			if err != nil && failed == nil {
+				failed = err
+			}
+			return secret
+		})
+		if failed != nil {
+			return nil, failed
+		}
+		return resolved, nil
+	case []string:
+		list := make([]string, len(v))
+		for i, item := range v {
+			resolved, err := r.resolveValue(item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = resolved.(string)
+		}
+		return list, nil
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			resolved, err := r.resolveValue(item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = resolved
+		}
+		return list, nil
+	case map[string]interface{}:
+		nested := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			nested[key] = item
+		}
+		if err := r.resolveMap(nested); err != nil {
+			return nil, err
+		}
+		return nested, nil
+	}
+	return value, nil
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Environment variables the Vault references are resolved with, named as the Vault CLI names them
+const (
+	VaultAddrEnv      = "VAULT_ADDR"
+	VaultTokenEnv     = "VAULT_TOKEN"
+	VaultNamespaceEnv = "VAULT_NAMESPACE"
+)
+
+// vaultTimeout limits each read of a Vault secret
+const vaultTimeout = 10 * time.Second
+
+// vaultResponse is the body of a secret read. A KV version 2 engine nests
+// the secret's keys in a second data object, next to its metadata.
+type vaultResponse struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []string               `json:"errors"`
+}
+
+// readVaultSecret returns the key of the Vault secret a path#key reference
+// names, reading the secret on its first reference only
+func (r *secretResolver) readVaultSecret(ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	path = strings.Trim(path, "/")
+	if !ok || path == "" || key == "" {
+		return "", fmt.Errorf("invalid vault reference %q: expected ${vault:<path>#<key>}", ref)
+	}
+	secret, ok := r.vault[path]
+	if !ok {
+		var err error
+		if secret, err = fetchVaultSecret(path); err != nil {
+			return "", err
+		}
+		r.vault[path] = secret
+	}
+	value, ok := secret[key]
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no key %s", path, key)
+	}
+	if text, ok := value.(string); ok {
+		return text, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to read key %s of vault secret %s: %w", key, path, err)
+	}
+	return string(encoded), nil
+}
+
+// fetchVaultSecret reads the secret at path from the Vault $VAULT_ADDR
+// points at, with the token in $VAULT_TOKEN
+func fetchVaultSecret(path string) (map[string]interface{}, error) {
+	addr, token := os.Getenv(VaultAddrEnv), os.Getenv(VaultTokenEnv)
+	if addr == "" || token == "" {
+		return nil, fmt.Errorf("vault secret %s: %s and %s must be set", path, VaultAddrEnv, VaultTokenEnv)
+	}
+	endpoint, err := url.JoinPath(addr, "v1", path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %w", VaultAddrEnv, addr, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), vaultTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv(VaultNamespaceEnv); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault secret %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault secret %s: %w", path, err)
+	}
+	var decoded vaultResponse
+	decodeErr := json.Unmarshal(body, &decoded)
+	if resp.StatusCode != http.StatusOK {
+		if len(decoded.Errors) > 0 {
+			return nil, fmt.Errorf("failed to read vault secret %s: vault returned %s: %s", path, resp.Status, strings.Join(decoded.Errors, "; "))
+		}
+		return nil, fmt.Errorf("failed to read vault secret %s: vault returned %s", path, resp.Status)
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("failed to decode vault secret %s: %w", path, decodeErr)
+	}
+	if nested, ok := decoded.Data["data"].(map[string]interface{}); ok {
+		if _, ok := decoded.Data["metadata"]; ok {
+			return nested, nil
+		}
+	}
+	return decoded.Data, nil
+}
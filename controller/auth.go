@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Environment variables configuring how the HTTP server authenticates clients
+const (
+	APITokensEnv = "FRACTAL_API_TOKENS" // Comma separated tokens clients may send
+	APIAuthEnv   = "FRACTAL_API_AUTH"   // token (default) or localhost
+)
+
+// Values of APIAuthEnv
+const (
+	APIAuthToken     = "token"     // Every client sends a token
+	APIAuthLocalhost = "localhost" // Clients on the loopback interface may leave it out, for local development
+)
+
+// publicPaths answer without a token, so orchestrators can probe the server
+var publicPaths = map[string]bool{"/healthz": true, "/readyz": true}
+
+// Auth checks that requests carry one of the server's tokens, as a bearer
+// token in the Authorization header or in the X-API-Key header
+type Auth struct {
+	tokens    [][]byte
+	localhost bool
+}
+
+// NewAuth accepts the given tokens. With localhost set, clients on the
+// loopback interface need none.
+func NewAuth(tokens []string, localhost bool) (*Auth, error) {
+	a := &Auth{localhost: localhost}
+	for _, token := range tokens {
+		if token = strings.TrimSpace(token); token != "" {
+			a.tokens = append(a.tokens, []byte(token))
+		}
+	}
+	if len(a.tokens) == 0 && !localhost {
+		return nil, errors.New("no API tokens are set")
+	}
+	return a, nil
+}
+
+// NewAuthFromEnv reads the tokens and the mode from APITokensEnv and APIAuthEnv
+func NewAuthFromEnv() (*Auth, error) {
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv(APIAuthEnv)))
+	if mode != "" && mode != APIAuthToken && mode != APIAuthLocalhost {
+		return nil, fmt.Errorf("invalid %s %q: expected %s or %s", APIAuthEnv, mode, APIAuthToken, APIAuthLocalhost)
+	}
+	a, err := NewAuth(strings.Split(os.Getenv(APITokensEnv), ","), mode == APIAuthLocalhost)
+	if err != nil {
+		return nil, fmt.Errorf("%w: set %s to the tokens clients send, or %s=%s to let local clients in without one",
+			err, APITokensEnv, APIAuthEnv, APIAuthLocalhost)
+	}
+	return a, nil
+}
+
+// Middleware answers 401 to requests without a valid token. It runs before
+// routing, so a client without one can't tell which paths exist.
+func (a *Auth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicPaths[r.URL.Path] || a.allowed(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="fractal"`)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":{"message":"unauthorized"}}`)
+	})
+}
+
+// allowed reports whether the request carries a valid token, or comes from
+// the loopback interface when local clients need none
+func (a *Auth) allowed(r *http.Request) bool {
+	if a.localhost && isLoopback(r.RemoteAddr) {
+		return true
+	}
+	token := r.Header.Get("X-API-Key")
+	if scheme, value, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		token = strings.TrimSpace(value)
+	}
+	if token == "" {
+		return false
+	}
+	// Every token is compared in constant time, so timing doesn't give one away
+	valid := 0
+	for _, t := range a.tokens {
+		valid |= subtle.ConstantTimeCompare([]byte(token), t)
+	}
+	return valid == 1
+}
+
+// isLoopback reports whether a remote address is on the loopback interface
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/pipeline"
+)
+
+// MigrationError is returned by the migration endpoints when a run cannot
+// start or fails. Its status code follows the kind of failure, so clients can
+// tell a bad request from a system that could not be reached.
+type MigrationError struct {
+	Err error
+}
+
+func (e *MigrationError) Error() string {
+	return "migration failed: " + e.Err.Error()
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode is the HTTP status GoFr responds with
+func (e *MigrationError) StatusCode() int {
+	switch {
+	case errors.Is(e.Err, pipeline.ErrTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(e.Err, interfaces.ErrConfigInvalid):
+		return http.StatusBadRequest
+	case errors.Is(e.Err, interfaces.ErrValidation), errors.Is(e.Err, interfaces.ErrTransform):
+		return http.StatusUnprocessableEntity
+	case errors.Is(e.Err, interfaces.ErrConnection), errors.Is(e.Err, interfaces.ErrWrite):
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
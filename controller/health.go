@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+	"gofr.dev/pkg/gofr"
+)
+
+// DefaultReadinessTTL is how long a readiness result answers probes before
+// the integrations are pinged again
+const DefaultReadinessTTL = 5 * time.Second
+
+// DefaultPingTimeout bounds each integration's ping
+const DefaultPingTimeout = 3 * time.Second
+
+// ReadinessTarget is an integration the readiness check pings: the default
+// source or destination of the server's configuration
+type ReadinessTarget struct {
+	Role        string // source or destination
+	Method      string // Registered name, such as PostgreSQL
+	Integration interface{}
+	Request     interfaces.Request
+}
+
+// IntegrationCheck is the outcome of pinging one target. Integrations that
+// can't be pinged are skipped and don't hold readiness back. Probes only see
+// whether a target is ready: why a ping failed can name hosts and users, so
+// it is logged by the server instead of being served.
+type IntegrationCheck struct {
+	Role    string `json:"role"`
+	Method  string `json:"method"`
+	Ready   bool   `json:"ready"`
+	Skipped bool   `json:"-"`
+	Error   string `json:"-"`
+}
+
+// ReadinessReport is the body of GET /readyz
+type ReadinessReport struct {
+	Ready     bool               `json:"ready"`
+	CheckedAt time.Time          `json:"checked_at"`
+	Checks    []IntegrationCheck `json:"checks"`
+}
+
+// Readiness answers readiness probes by pinging the targets. A result is
+// reused for the TTL, so frequent probes don't hammer the backends; probes
+// arriving while a check runs wait for it instead of starting their own.
+type Readiness struct {
+	targets []ReadinessTarget
+	ttl     time.Duration
+	timeout time.Duration
+	now     func() time.Time
+
+	mu     sync.Mutex
+	report *ReadinessReport
+}
+
+// NewReadiness creates a readiness check of the targets, caching results for
+// ttl, or DefaultReadinessTTL when ttl is 0
+func NewReadiness(ttl time.Duration, targets ...ReadinessTarget) *Readiness {
+	if ttl <= 0 {
+		ttl = DefaultReadinessTTL
+	}
+	return &Readiness{targets: targets, ttl: ttl, timeout: DefaultPingTimeout, now: time.Now}
+}
+
+// Check returns the cached report, pinging the targets again once it is older than the TTL
+func (r *Readiness) Check(ctx context.Context) ReadinessReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.report != nil && r.now().Sub(r.report.CheckedAt) < r.ttl {
+		return *r.report
+	}
+
+	report := ReadinessReport{Ready: true, CheckedAt: r.now(), Checks: make([]IntegrationCheck, len(r.targets))}
+	var wg sync.WaitGroup
+	for i, target := range r.targets {
+		check := IntegrationCheck{Role: target.Role, Method: target.Method, Ready: true}
+		pinger, ok := target.Integration.(interfaces.Pinger)
+		if !ok {
+			check.Skipped = true
+			report.Checks[i] = check
+			continue
+		}
+		wg.Add(1)
+		go func(i int, target ReadinessTarget, check IntegrationCheck) {
+			defer wg.Done()
+			pingCtx, cancel := context.WithTimeout(ctx, r.timeout)
+			defer cancel()
+			if err := pinger.Ping(pingCtx, target.Request); err != nil {
+				logger.Infof("Readiness check: %s %s can't be reached: %v", target.Role, target.Method, err)
+				check.Ready, check.Error = false, err.Error()
+			}
+			report.Checks[i] = check
+		}(i, target, check)
+	}
+	wg.Wait()
+	for _, check := range report.Checks {
+		if !check.Ready {
+			report.Ready = false
+		}
+	}
+	// A probe that gave up says nothing about the backends, so it isn't cached
+	if ctx.Err() == nil {
+		r.report = &report
+	}
+	return report
+}
+
+// Handler serves GET /readyz, 503 while any target can't be reached
+func (r *Readiness) Handler(ctx *gofr.Context) (interface{}, error) {
+	report := r.Check(ctx.Context)
+	if !report.Ready {
+		return nil, &NotReadyError{Report: report}
+	}
+	return report, nil
+}
+
+// HealthHandler serves GET /healthz, which answers as long as the process does
+func HealthHandler(ctx *gofr.Context) (interface{}, error) {
+	return map[string]string{"status": "ok"}, nil
+}
+
+// NotReadyError is returned by the readiness endpoint when a target can't be
+// reached. Its message is the response body, so it names the targets but not
+// the ping errors, which the check has logged.
+type NotReadyError struct {
+	Report ReadinessReport
+}
+
+func (e *NotReadyError) Error() string {
+	var failed []string
+	for _, check := range e.Report.Checks {
+		if !check.Ready {
+			failed = append(failed, fmt.Sprintf("%s %s", check.Role, check.Method))
+		}
+	}
+	return "not ready: " + strings.Join(failed, ", ")
+}
+
+// StatusCode is the HTTP status GoFr responds with
+func (e *NotReadyError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultIdempotencyTTL is how long a finished run's result is returned for a repeated idempotency key
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// RunEntry is what a RunStore knows about the run holding an idempotency key
+type RunEntry struct {
+	RunID     string
+	Done      bool
+	Result    interface{}
+	ExpiresAt time.Time
+}
+
+// RunStore tracks runs by idempotency key so a repeated request doesn't load the
+// same data twice. Implementations must be safe for concurrent use; the
+// in-memory store suits a single server, a shared store such as Redis can
+// implement the same interface for several.
+type RunStore interface {
+	// Claim reserves key for runID. If a live entry already holds the key it is
+	// returned with claimed set to false.
+	Claim(key, runID string, ttl time.Duration) (entry RunEntry, claimed bool, err error)
+	// Complete stores the result of a successful run for the rest of the TTL
+	Complete(key string, result interface{}) error
+	// Release drops the key, after a failed run, so the request can be retried
+	Release(key string) error
+}
+
+// RunInProgressError is returned for a request whose idempotency key belongs to a run that hasn't finished
+type RunInProgressError struct {
+	Key   string
+	RunID string
+}
+
+func (e *RunInProgressError) Error() string {
+	return fmt.Sprintf("run %s for idempotency key %q is still in progress", e.RunID, e.Key)
+}
+
+// StatusCode is the HTTP status GoFr responds with
+func (e *RunInProgressError) StatusCode() int {
+	return http.StatusConflict
+}
+
+// runStore holds the idempotency keys of the migration endpoints
+var runStore RunStore = NewMemoryRunStore()
+
+// SetRunStore replaces the in-memory run store, e.g. with one shared between servers
+func SetRunStore(store RunStore) {
+	runStore = store
+}
+
+// MemoryRunStore is a RunStore held in process memory
+type MemoryRunStore struct {
+	mu      sync.Mutex
+	entries map[string]RunEntry
+	now     func() time.Time
+}
+
+// NewMemoryRunStore creates an empty in-memory run store
+func NewMemoryRunStore() *MemoryRunStore {
+	return &MemoryRunStore{entries: make(map[string]RunEntry), now: time.Now}
+}
+
+// Claim reserves key for runID unless a live entry already holds it
+func (s *MemoryRunStore) Claim(key, runID string, ttl time.Duration) (RunEntry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for k, entry := range s.entries {
+		if now.After(entry.ExpiresAt) {
+			delete(s.entries, k)
+		}
+	}
+	if entry, ok := s.entries[key]; ok {
+		return entry, false, nil
+	}
+	entry := RunEntry{RunID: runID, ExpiresAt: now.Add(ttl)}
+	s.entries[key] = entry
+	return entry, true, nil
+}
+
+// Complete stores the result for key
+func (s *MemoryRunStore) Complete(key string, result interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return fmt.Errorf("no run holds idempotency key %q", key)
+	}
+	entry.Done = true
+	entry.Result = result
+	s.entries[key] = entry
+	return nil
+}
+
+// Release drops key
+func (s *MemoryRunStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
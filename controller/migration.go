@@ -1,11 +1,13 @@
 package controller
 
 import (
+	"context"
 	"fmt"
 	"log"
 
-	"github.com/SkySingh04/fractal/factory"
 	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/pkg/fractal"
+	"github.com/google/uuid"
 	"gofr.dev/pkg/gofr"
 )
 
@@ -17,39 +19,54 @@ func MigrationHandler(ctx *gofr.Context) (interface{}, error) {
 	var req interfaces.Request
 	if err := ctx.Bind(&req); err != nil {
 		// Log detailed error to understand the bind issue
-		return nil, fmt.Errorf("failed to bind request: %v", err)
+		return nil, &MigrationError{Err: interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("failed to bind request: %w", err))}
 	}
-	return runMigration(req)
-}
-
-func runMigration(req interfaces.Request) (interface{}, error) {
-	// Create source
-	input, err := factory.CreateSource(req.Input)
-	if err != nil {
-		log.Printf("Error creating source for input method %s: %v", req.Input, err)
-		return nil, fmt.Errorf("failed to create source for input method %s: %v", req.Input, err)
+	runID := uuid.NewString()
+	if req.IdempotencyKey == "" {
+		return runMigration(ctx.Context, req, runID)
 	}
 
-	// Create destination
-	output, err := factory.CreateDestination(req.Output)
+	// A repeated key gets the earlier result instead of a second run
+	entry, claimed, err := runStore.Claim(req.IdempotencyKey, runID, DefaultIdempotencyTTL)
 	if err != nil {
-		log.Printf("Error creating destination for output method %s: %v", req.Output, err)
-		return nil, fmt.Errorf("failed to create destination for output method %s: %v", req.Output, err)
+		return nil, fmt.Errorf("failed to check idempotency key: %v", err)
+	}
+	if !claimed {
+		if !entry.Done {
+			return nil, &RunInProgressError{Key: req.IdempotencyKey, RunID: entry.RunID}
+		}
+		log.Printf("Returning the result of run %s for idempotency key %q", entry.RunID, req.IdempotencyKey)
+		return entry.Result, nil
 	}
 
-	// Fetch data from the source
-	data, err := input.FetchData(req)
+	result, err := runMigration(ctx.Context, req, runID)
 	if err != nil {
-		log.Printf("Error fetching data from source: %v", err)
-		return nil, fmt.Errorf("failed to fetch data from source: %v", err)
+		if releaseErr := runStore.Release(req.IdempotencyKey); releaseErr != nil {
+			log.Printf("Failed to release idempotency key %q: %v", req.IdempotencyKey, releaseErr)
+		}
+		return nil, err
 	}
+	if err := runStore.Complete(req.IdempotencyKey, result); err != nil {
+		log.Printf("Failed to store result for idempotency key %q: %v", req.IdempotencyKey, err)
+	}
+	return result, nil
+}
 
-	// Send data to the destination
-	if err := output.SendData(data, req); err != nil {
-		log.Printf("Error sending data to destination: %v", err)
-		return nil, fmt.Errorf("failed to send data to destination: %v", err)
+func runMigration(ctx context.Context, req interfaces.Request, runID string) (interface{}, error) {
+	// The request carries the settings of both integrations and of the pipeline
+	summary, err := fractal.Run(ctx, fractal.Config{
+		Input:       req.Input,
+		Source:      req,
+		Output:      req.Output,
+		Destination: req,
+		Pipeline:    req.Pipeline,
+		RunID:       runID,
+	})
+	if err != nil {
+		log.Printf("Error running migration: %v", err)
+		return nil, &MigrationError{Err: err}
 	}
 
 	log.Println("Migration successful!")
-	return map[string]string{"status": "success"}, nil
+	return &summary, nil
 }
@@ -0,0 +1,172 @@
+package integrations
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ArchiveEntrySeparator joins an archive and one of its entries into the
+// path of the entry, such as drop.zip!orders/2024-01.csv
+const ArchiveEntrySeparator = "!"
+
+// archiveExtensions maps the extensions of the archives file sources read to
+// the compression of the archive itself
+var archiveExtensions = []struct {
+	ext         string
+	kind        string
+	compression string
+}{
+	{".zip", "zip", CompressionNone},
+	{".tar", "tar", CompressionNone},
+	{".tar.gz", "tar", CompressionGzip},
+	{".tgz", "tar", CompressionGzip},
+	{".tar.zst", "tar", CompressionZstd},
+	{".tar.bz2", "tar", CompressionBzip2},
+}
+
+// archiveKind returns zip or tar for an archive, by its extension, and the
+// compression of a tar archive; the kind is empty for other files
+func archiveKind(file string) (kind, compression string) {
+	for _, archive := range archiveExtensions {
+		if strings.HasSuffix(strings.ToLower(file), archive.ext) {
+			return archive.kind, archive.compression
+		}
+	}
+	return "", ""
+}
+
+// splitArchiveEntry splits the path of an archive entry into the archive and
+// the entry. ok is false for a path that names no entry.
+func splitArchiveEntry(file string) (archive, entry string, ok bool) {
+	for i := strings.Index(file, ArchiveEntrySeparator); i >= 0; {
+		if kind, _ := archiveKind(file[:i]); kind != "" {
+			return file[:i], file[i+len(ArchiveEntrySeparator):], true
+		}
+		next := strings.Index(file[i+1:], ArchiveEntrySeparator)
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return "", "", false
+}
+
+// archiveEntries lists the paths of the regular files in an archive that
+// match pattern, or that have one of the extensions when pattern is empty,
+// in sorted order
+func archiveEntries(archive, pattern string, extensions []string) ([]string, error) {
+	var names []string
+	kind, compression := archiveKind(archive)
+	if kind == "zip" {
+		zr, err := zip.OpenReader(archive)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zip archive %s: %w", archive, err)
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			if f.Mode().IsRegular() {
+				names = append(names, f.Name)
+			}
+		}
+	} else {
+		r, err := openSourceFile(archive, compression)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar archive %s: %w", archive, err)
+		}
+		defer r.Close()
+		tr := tar.NewReader(r)
+		for {
+			header, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read tar archive %s: %w", archive, err)
+			}
+			if header.Typeflag == tar.TypeReg {
+				names = append(names, header.Name)
+			}
+		}
+	}
+
+	var entries []string
+	for _, name := range names {
+		matched := false
+		if pattern != "" {
+			var err error
+			if matched, err = path.Match(pattern, name); err != nil {
+				return nil, fmt.Errorf("invalid archive entry pattern %q: %w", pattern, err)
+			}
+		} else {
+			for _, ext := range extensions {
+				if strings.EqualFold(filepath.Ext(trimCompressionExtension(name)), ext) {
+					matched = true
+					break
+				}
+			}
+		}
+		if matched {
+			entries = append(entries, archive+ArchiveEntrySeparator+name)
+		}
+	}
+	if len(entries) == 0 {
+		if pattern != "" {
+			return nil, fmt.Errorf("no entries of %s match %s", archive, pattern)
+		}
+		return nil, fmt.Errorf("no %s files in %s", strings.Join(extensions, " or "), archive)
+	}
+	sort.Strings(entries)
+	return entries, nil
+}
+
+// openArchiveEntry streams an entry out of its archive, without extracting it
+func openArchiveEntry(archive, entry string) (io.ReadCloser, error) {
+	kind, compression := archiveKind(archive)
+	if kind == "zip" {
+		zr, err := zip.OpenReader(archive)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zip archive %s: %w", archive, err)
+		}
+		for _, f := range zr.File {
+			if f.Name != entry {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				zr.Close()
+				return nil, fmt.Errorf("failed to read %s in zip archive %s: %w", entry, archive, err)
+			}
+			return &compressedReader{Reader: rc, closers: []io.Closer{rc, zr}}, nil
+		}
+		zr.Close()
+		return nil, fmt.Errorf("zip archive %s has no entry %s", archive, entry)
+	}
+
+	// A tar archive is read from the start up to the entry
+	r, err := openSourceFile(archive, compression)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tar archive %s: %w", archive, err)
+	}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			r.Close()
+			return nil, fmt.Errorf("tar archive %s has no entry %s", archive, entry)
+		}
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("failed to read tar archive %s: %w", archive, err)
+		}
+		if header.Name == entry && header.Typeflag == tar.TypeReg {
+			return &compressedReader{Reader: tr, closers: []io.Closer{r}}, nil
+		}
+	}
+}
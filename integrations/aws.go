@@ -0,0 +1,145 @@
+package integrations
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// awsRoleSessionName names the sessions fractal opens when it assumes a role,
+// so they can be told apart in CloudTrail
+const awsRoleSessionName = "fractal"
+
+// awsSessions holds the sessions opened so far, so paged reads assume a role
+// once rather than for every page
+var (
+	awsSessionsMu sync.Mutex
+	awsSessions   = map[[3]string]*session.Session{}
+)
+
+// awsSession opens a session in the region with the default credential chain.
+// When a role ARN is set those credentials assume the role through STS, and
+// the temporary credentials are refreshed before they expire. The role is
+// assumed once up front, so a run that cannot assume it fails before it reads
+// or writes anything.
+func awsSession(region, roleARN, externalID string) (*session.Session, error) {
+	key := [3]string{region, roleARN, externalID}
+	awsSessionsMu.Lock()
+	defer awsSessionsMu.Unlock()
+	if sess, ok := awsSessions[key]; ok {
+		return sess, nil
+	}
+	sess, err := newAWSSession(region, roleARN, externalID)
+	if err != nil {
+		return nil, err
+	}
+	awsSessions[key] = sess
+	return sess, nil
+}
+
+// newAWSSession opens the session awsSession caches
+func newAWSSession(region, roleARN, externalID string) (*session.Session, error) {
+	if roleARN == "" {
+		if externalID != "" {
+			return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("externalid is set without a rolearn"))
+		}
+		return session.NewSession(&aws.Config{Region: aws.String(region)})
+	}
+	if !strings.HasPrefix(roleARN, "arn:") || !strings.Contains(roleARN, ":role/") {
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid rolearn %q: expected arn:aws:iam::<account>:role/<name>", roleARN))
+	}
+
+	base, err := session.NewSession(&aws.Config{Region: aws.String(region)})
+	if err != nil {
+		return nil, interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to open an AWS session: %w", err))
+	}
+	creds := stscreds.NewCredentials(base, roleARN, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = awsRoleSessionName
+		if externalID != "" {
+			p.ExternalID = aws.String(externalID)
+		}
+	})
+	if _, err := creds.Get(); err != nil {
+		return nil, interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf(
+			"failed to assume role %s: %w; check the base credentials are allowed sts:AssumeRole on it and that its trust policy accepts them and the externalid",
+			roleARN, err))
+	}
+	return base.Copy(&aws.Config{Credentials: creds}), nil
+}
+
+// regionOutageCodes are the AWS error codes of a region that cannot serve a
+// request at all, rather than one refusing it
+var regionOutageCodes = map[string]bool{
+	request.ErrCodeRequestError:    true,
+	request.ErrCodeResponseTimeout: true,
+	"ServiceUnavailable":           true,
+	"ServiceUnavailableException":  true,
+	"InternalFailure":              true,
+	"InternalServerError":          true,
+	"RequestTimeout":               true,
+	"RequestTimeoutException":      true,
+}
+
+// regionOutage reports whether err means the region could not be reached or
+// failed on its side. Throttling, missing tables, refused credentials and bad
+// data are not outages: another region would answer the same.
+func regionOutage(err error) bool {
+	var failure awserr.RequestFailure
+	if errors.As(err, &failure) && failure.StatusCode() >= 500 {
+		return true
+	}
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && regionOutageCodes[awsErr.Code()] {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// validateFailoverRegions checks the failover regions are set and each named once
+func validateFailoverRegions(primary string, failover []string) error {
+	seen := map[string]bool{primary: true}
+	for _, region := range failover {
+		if strings.TrimSpace(region) == "" {
+			return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("failoverregions has an empty region"))
+		}
+		if region == primary {
+			return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("failoverregions names %s, the region it fails over from", region))
+		}
+		if seen[region] {
+			return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("failoverregions names region %s more than once", region))
+		}
+		seen[region] = true
+	}
+	return nil
+}
+
+// inRegions runs op in the primary region and, while the region it ran in has
+// an outage, in each failover region in turn. Every call starts with the
+// primary, so a run goes back to it as soon as it recovers.
+func inRegions(primary string, failover []string, op func(region string) error) error {
+	regions := append([]string{primary}, failover...)
+	var err error
+	for i, region := range regions {
+		if err = op(region); err == nil || !regionOutage(err) {
+			return err
+		}
+		if i+1 < len(regions) {
+			logger.Infof("AWS region %s is unavailable, failing over to %s: %v", region, regions[i+1], err)
+		}
+	}
+	if len(regions) == 1 {
+		return err
+	}
+	return interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("every region is unavailable, tried %s: %w", strings.Join(regions, ", "), err))
+}
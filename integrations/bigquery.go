@@ -0,0 +1,538 @@
+package integrations
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/bigquery/storage/managedwriter"
+	"cloud.google.com/go/bigquery/storage/managedwriter/adapt"
+	"cloud.google.com/go/civil"
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+	"github.com/SkySingh04/fractal/pipeline"
+	"github.com/SkySingh04/fractal/registry"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// BigQuery write dispositions
+const (
+	BigQueryAppend   = "append"
+	BigQueryTruncate = "truncate"
+)
+
+// maxBigQueryAppendBytes keeps each Storage Write API request under its 10MB limit
+const maxBigQueryAppendBytes = 8 << 20
+
+// bigQueryTypes are the column types the destination can write, by the names a schema may use
+var bigQueryTypes = map[string]bigquery.FieldType{
+	"STRING":    bigquery.StringFieldType,
+	"BYTES":     bigquery.BytesFieldType,
+	"INTEGER":   bigquery.IntegerFieldType,
+	"INT64":     bigquery.IntegerFieldType,
+	"FLOAT":     bigquery.FloatFieldType,
+	"FLOAT64":   bigquery.FloatFieldType,
+	"BOOLEAN":   bigquery.BooleanFieldType,
+	"BOOL":      bigquery.BooleanFieldType,
+	"TIMESTAMP": bigquery.TimestampFieldType,
+	"DATE":      bigquery.DateFieldType,
+	"JSON":      bigquery.JSONFieldType,
+	"GEOGRAPHY": bigquery.GeographyFieldType,
+}
+
+// BigQueryDestination struct represents the configuration for writing rows to a BigQuery table.
+type BigQueryDestination struct {
+	ProjectID        string   `json:"bigquery_project_id" fractal:"required"`
+	Dataset          string   `json:"bigquery_dataset" fractal:"required"`
+	Table            string   `json:"bigquery_table" fractal:"required"`
+	CredentialsFile  string   `json:"bigquery_credentials_file"`
+	Schema           []string `json:"bigquery_schema"`
+	WriteDisposition string   `json:"bigquery_write_disposition" fractal:"enum=append|truncate"`
+	LoadJobRows      int      `json:"bigquery_load_job_rows"`
+}
+
+// SendData writes the records to the BigQuery table, creating it when it does
+// not exist. Rows are streamed through the Storage Write API, and rows
+// BigQuery refuses are returned for quarantine while the rest are written.
+// Truncating writes, and batches of at least LoadJobRows rows, use a load job.
+func (b BigQueryDestination) SendData(data interface{}, req interfaces.Request) error {
+	if req.BigQueryProjectID == "" || req.BigQueryDataset == "" || req.BigQueryTable == "" {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing BigQuery project, dataset or table"))
+	}
+	disposition, err := bigQueryDisposition(req.BigQueryWriteDisposition)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	explicit, err := parseBigQuerySchema(req.BigQuerySchema)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	dataset := pipeline.NewDataset(data)
+	if !dataset.Structured() {
+		return errors.New("invalid data format for BigQuery destination")
+	}
+	// Rows grouped by source table all go to the one BigQuery table
+	records := make([]pipeline.Record, len(dataset.Records))
+	for i, rec := range dataset.Records {
+		records[i] = rec.Copy()
+		delete(records[i], pipeline.TableField)
+	}
+	logger.Infof("Writing %d rows to BigQuery table %s.%s.%s", len(records), req.BigQueryProjectID, req.BigQueryDataset, req.BigQueryTable)
+
+	ctx := context.Background()
+	var opts []option.ClientOption
+	if req.BigQueryCredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(req.BigQueryCredentialsFile))
+	}
+	client, err := bigquery.NewClient(ctx, req.BigQueryProjectID, opts...)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to create BigQuery client: %w", err))
+	}
+	defer client.Close()
+	table := client.Dataset(req.BigQueryDataset).Table(req.BigQueryTable)
+
+	if disposition == bigquery.WriteTruncate || (req.BigQueryLoadJobRows > 0 && len(records) >= req.BigQueryLoadJobRows) {
+		schema := explicit
+		if schema == nil {
+			schema = InferBigQuerySchema(records)
+		}
+		return loadBigQueryRows(ctx, table, schema, records, disposition)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	schema, err := ensureBigQueryTable(ctx, table, explicit, records)
+	if err != nil {
+		return err
+	}
+	return appendBigQueryRows(ctx, req, schema, records, opts)
+}
+
+// bigQueryDisposition maps the configured write disposition, append by default
+func bigQueryDisposition(disposition string) (bigquery.TableWriteDisposition, error) {
+	switch strings.ToLower(disposition) {
+	case "", BigQueryAppend:
+		return bigquery.WriteAppend, nil
+	case BigQueryTruncate:
+		return bigquery.WriteTruncate, nil
+	}
+	return "", fmt.Errorf("unknown BigQuery write disposition %q, expected %s or %s", disposition, BigQueryAppend, BigQueryTruncate)
+}
+
+// parseBigQuerySchema reads "name:TYPE" entries. No entries means the schema is autodetected.
+func parseBigQuerySchema(entries []string) (bigquery.Schema, error) {
+	var schema bigquery.Schema
+	for _, entry := range entries {
+		name, typeName, ok := strings.Cut(entry, ":")
+		fieldType, known := bigQueryTypes[strings.ToUpper(strings.TrimSpace(typeName))]
+		if !ok || strings.TrimSpace(name) == "" || !known {
+			return nil, fmt.Errorf("invalid BigQuery schema field %q, expected name:TYPE with a supported type", entry)
+		}
+		schema = append(schema, &bigquery.FieldSchema{Name: strings.TrimSpace(name), Type: fieldType})
+	}
+	return schema, nil
+}
+
+// InferBigQuerySchema picks a column type for every field the records carry,
+// in alphabetical order. Fields holding values of different types become STRING,
+// except integers mixed with floats, which become FLOAT.
+func InferBigQuerySchema(records []pipeline.Record) bigquery.Schema {
+	types := make(map[string]bigquery.FieldType)
+	for _, rec := range records {
+		for name, value := range rec {
+			current, seen := types[name]
+			if value == nil {
+				if !seen {
+					types[name] = ""
+				}
+				continue
+			}
+			fieldType := bigQueryValueType(value)
+			switch {
+			case current == "" || current == fieldType:
+				types[name] = fieldType
+			case isBigQueryNumber(current) && isBigQueryNumber(fieldType):
+				types[name] = bigquery.FloatFieldType
+			default:
+				types[name] = bigquery.StringFieldType
+			}
+		}
+	}
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	schema := make(bigquery.Schema, len(names))
+	for i, name := range names {
+		fieldType := types[name]
+		if fieldType == "" {
+			fieldType = bigquery.StringFieldType
+		}
+		schema[i] = &bigquery.FieldSchema{Name: name, Type: fieldType}
+	}
+	return schema
+}
+
+// bigQueryValueType maps a record value to the BigQuery type that holds it
+func bigQueryValueType(value interface{}) bigquery.FieldType {
+	switch value.(type) {
+	case bool:
+		return bigquery.BooleanFieldType
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return bigquery.IntegerFieldType
+	case float32, float64:
+		return bigquery.FloatFieldType
+	case time.Time:
+		return bigquery.TimestampFieldType
+	case []byte:
+		return bigquery.BytesFieldType
+	case map[string]interface{}, []interface{}:
+		return bigquery.JSONFieldType
+	}
+	return bigquery.StringFieldType
+}
+
+func isBigQueryNumber(fieldType bigquery.FieldType) bool {
+	return fieldType == bigquery.IntegerFieldType || fieldType == bigquery.FloatFieldType
+}
+
+// ensureBigQueryTable returns the schema of the table, creating the table
+// from the explicit or inferred schema when it does not exist yet
+func ensureBigQueryTable(ctx context.Context, table *bigquery.Table, explicit bigquery.Schema, records []pipeline.Record) (bigquery.Schema, error) {
+	meta, err := table.Metadata(ctx)
+	if err == nil {
+		return meta.Schema, nil
+	}
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusNotFound {
+		return nil, fmt.Errorf("failed to read BigQuery table %s: %w", table.FullyQualifiedName(), err)
+	}
+	schema := explicit
+	if schema == nil {
+		schema = InferBigQuerySchema(records)
+	}
+	logger.Infof("Creating BigQuery table %s with %d columns", table.FullyQualifiedName(), len(schema))
+	if err := table.Create(ctx, &bigquery.TableMetadata{Schema: schema}); err != nil {
+		return nil, fmt.Errorf("failed to create BigQuery table %s: %w", table.FullyQualifiedName(), err)
+	}
+	return schema, nil
+}
+
+// appendBigQueryRows streams the records into the table's default stream, in
+// requests under the Storage Write API's size limit. Records that cannot be
+// encoded for the schema are returned for quarantine with those BigQuery refuses.
+func appendBigQueryRows(ctx context.Context, req interfaces.Request, schema bigquery.Schema, records []pipeline.Record, opts []option.ClientOption) error {
+	tableSchema, err := adapt.BQSchemaToStorageTableSchema(schema)
+	if err != nil {
+		return fmt.Errorf("failed to convert BigQuery schema: %w", err)
+	}
+	descriptor, err := adapt.StorageSchemaToProto2Descriptor(tableSchema, "root")
+	if err != nil {
+		return fmt.Errorf("failed to convert BigQuery schema: %w", err)
+	}
+	message, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return errors.New("failed to convert BigQuery schema to a message descriptor")
+	}
+	descriptorProto, err := adapt.NormalizeDescriptor(message)
+	if err != nil {
+		return fmt.Errorf("failed to convert BigQuery schema: %w", err)
+	}
+
+	client, err := managedwriter.NewClient(ctx, req.BigQueryProjectID, opts...)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to create BigQuery write client: %w", err))
+	}
+	defer client.Close()
+	stream, err := client.NewManagedStream(ctx,
+		managedwriter.WithDestinationTable(managedwriter.TableParentFromParts(req.BigQueryProjectID, req.BigQueryDataset, req.BigQueryTable)),
+		managedwriter.WithType(managedwriter.DefaultStream),
+		managedwriter.WithSchemaDescriptor(descriptorProto))
+	if err != nil {
+		return fmt.Errorf("failed to open BigQuery write stream: %w", err)
+	}
+	defer stream.Close()
+
+	var rejected []pipeline.RejectedRow
+	var rows [][]byte
+	var pending []pipeline.Record
+	for _, rec := range records {
+		row, err := encodeBigQueryRow(rec, schema, message)
+		if err != nil {
+			rejected = append(rejected, pipeline.RejectedRow{Record: rec, Reason: err.Error()})
+			continue
+		}
+		rows = append(rows, row)
+		pending = append(pending, rec)
+	}
+	send := func(rows [][]byte) (map[int]string, error) {
+		result, err := stream.AppendRows(ctx, rows)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := result.FullResponse(ctx)
+		bad := make(map[int]string)
+		for _, rowErr := range resp.GetRowErrors() {
+			bad[int(rowErr.GetIndex())] = rowErr.GetMessage()
+		}
+		return bad, err
+	}
+	start := 0
+	for _, end := range ChunkBigQueryRows(rows, maxBigQueryAppendBytes) {
+		refused, err := AppendBigQueryChunk(rows[start:end], pending[start:end], send)
+		rejected = append(rejected, refused...)
+		if err != nil {
+			return err
+		}
+		start = end
+	}
+
+	if len(rejected) > 0 {
+		return &pipeline.RejectedRowsError{Rows: rejected}
+	}
+	return nil
+}
+
+// BigQueryAppendFunc sends one append request of encoded rows and returns
+// the reasons BigQuery gave for the rows it refused, by index, and the error
+// of the request
+type BigQueryAppendFunc func(rows [][]byte) (map[int]string, error)
+
+// ChunkBigQueryRows splits encoded rows into append requests of at most
+// maxBytes, returning the index each request ends at. A row larger than
+// maxBytes is sent in a request of its own.
+func ChunkBigQueryRows(rows [][]byte, maxBytes int) []int {
+	var ends []int
+	size := 0
+	for i, row := range rows {
+		if size+len(row) > maxBytes && size > 0 {
+			ends = append(ends, i)
+			size = 0
+		}
+		size += len(row)
+	}
+	if len(rows) > 0 {
+		ends = append(ends, len(rows))
+	}
+	return ends
+}
+
+// AppendBigQueryChunk appends one request's worth of rows and returns the
+// rows BigQuery refused. A request with a bad row writes nothing, so the rows
+// BigQuery names are set aside and the rest are sent again.
+func AppendBigQueryChunk(rows [][]byte, records []pipeline.Record, send BigQueryAppendFunc) ([]pipeline.RejectedRow, error) {
+	var rejected []pipeline.RejectedRow
+	for len(rows) > 0 {
+		bad, err := send(rows)
+		if len(bad) == 0 {
+			if err != nil {
+				return rejected, fmt.Errorf("failed to append rows to BigQuery: %w", err)
+			}
+			return rejected, nil
+		}
+		var keptRows [][]byte
+		var keptRecords []pipeline.Record
+		for i := range rows {
+			if reason, ok := bad[i]; ok {
+				rejected = append(rejected, pipeline.RejectedRow{Record: records[i], Reason: reason})
+				continue
+			}
+			keptRows = append(keptRows, rows[i])
+			keptRecords = append(keptRecords, records[i])
+		}
+		if len(keptRows) == len(rows) {
+			return rejected, fmt.Errorf("BigQuery rejected the request without naming rows within it: %v", err)
+		}
+		rows, records = keptRows, keptRecords
+	}
+	return rejected, nil
+}
+
+// encodeBigQueryRow converts a record into the protocol buffer row the Storage Write API expects
+func encodeBigQueryRow(rec pipeline.Record, schema bigquery.Schema, message protoreflect.MessageDescriptor) ([]byte, error) {
+	row, err := BigQueryRow(rec, schema)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(row)
+	if err != nil {
+		return nil, err
+	}
+	msg := dynamicpb.NewMessage(message)
+	if err := protojson.Unmarshal(encoded, msg); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(msg)
+}
+
+// BigQueryRow converts a record into the JSON form of the schema's protocol
+// buffer message. Null fields are left out, and a field the schema does not
+// have is an error.
+func BigQueryRow(rec pipeline.Record, schema bigquery.Schema) (map[string]interface{}, error) {
+	known := make(map[string]bool, len(schema))
+	row := make(map[string]interface{}, len(rec))
+	for _, field := range schema {
+		known[field.Name] = true
+		value := rec[field.Name]
+		if value == nil {
+			continue
+		}
+		converted, err := bigQueryValue(value, field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		row[field.Name] = converted
+	}
+	for name := range rec {
+		if !known[name] {
+			return nil, fmt.Errorf("field %s is not in the table schema", name)
+		}
+	}
+	return row, nil
+}
+
+// bigQueryValue converts a record value into the JSON form of its column's
+// protocol buffer field: TIMESTAMP as microseconds since the epoch, DATE as
+// days since the epoch and BYTES as base64
+func bigQueryValue(value interface{}, fieldType bigquery.FieldType) (interface{}, error) {
+	text, isText := value.(string)
+	switch fieldType {
+	case bigquery.StringFieldType, bigquery.GeographyFieldType:
+		if isText {
+			return text, nil
+		}
+		return fmt.Sprint(value), nil
+	case bigquery.JSONFieldType:
+		if isText {
+			return text, nil
+		}
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	case bigquery.IntegerFieldType:
+		if isText {
+			return strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+		}
+		v := reflect.ValueOf(value)
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return v.Int(), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return int64(v.Uint()), nil
+		case reflect.Float32, reflect.Float64:
+			if f := v.Float(); f == math.Trunc(f) {
+				return int64(f), nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not an integer", value)
+	case bigquery.FloatFieldType:
+		if isText {
+			return strconv.ParseFloat(strings.TrimSpace(text), 64)
+		}
+		v := reflect.ValueOf(value)
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return float64(v.Int()), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return float64(v.Uint()), nil
+		case reflect.Float32, reflect.Float64:
+			return v.Float(), nil
+		}
+		return nil, fmt.Errorf("%v is not a number", value)
+	case bigquery.BooleanFieldType:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		return strconv.ParseBool(strings.TrimSpace(fmt.Sprint(value)))
+	case bigquery.TimestampFieldType:
+		t, err := bigQueryTime(value)
+		if err != nil {
+			return nil, err
+		}
+		return t.UnixMicro(), nil
+	case bigquery.DateFieldType:
+		t, err := bigQueryTime(value)
+		if err != nil {
+			return nil, err
+		}
+		return civil.DateOf(t).DaysSince(civil.Date{Year: 1970, Month: time.January, Day: 1}), nil
+	case bigquery.BytesFieldType:
+		if b, ok := value.([]byte); ok {
+			return base64.StdEncoding.EncodeToString(b), nil
+		}
+		return base64.StdEncoding.EncodeToString([]byte(fmt.Sprint(value))), nil
+	}
+	return nil, fmt.Errorf("column type %s is not supported", fieldType)
+}
+
+// bigQueryTime reads a time.Time or a timestamp or date string
+func bigQueryTime(value interface{}) (time.Time, error) {
+	if t, ok := value.(time.Time); ok {
+		return t, nil
+	}
+	text := strings.TrimSpace(fmt.Sprint(value))
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02"} {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a timestamp or date", text)
+}
+
+// loadBigQueryRows writes the records with a load job, which can replace the
+// table's contents and suits large batches. A failed job fails the whole batch,
+// with BigQuery's error details in the message.
+func loadBigQueryRows(ctx context.Context, table *bigquery.Table, schema bigquery.Schema, records []pipeline.Record, disposition bigquery.TableWriteDisposition) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, rec := range records {
+		if err := encoder.Encode(rec); err != nil {
+			return fmt.Errorf("failed to encode row for BigQuery: %w", err)
+		}
+	}
+	source := bigquery.NewReaderSource(&buf)
+	source.SourceFormat = bigquery.JSON
+	source.Schema = schema
+	loader := table.LoaderFrom(source)
+	loader.WriteDisposition = disposition
+	loader.CreateDisposition = bigquery.CreateIfNeeded
+
+	job, err := loader.Run(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start BigQuery load job: %w", err)
+	}
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to wait for BigQuery load job %s: %w", job.ID(), err)
+	}
+	if err := status.Err(); err != nil {
+		var details []string
+		for _, e := range status.Errors {
+			details = append(details, e.Message)
+		}
+		return fmt.Errorf("BigQuery load job %s failed: %w (%s)", job.ID(), err, strings.Join(details, "; "))
+	}
+	logger.Infof("BigQuery load job %s wrote %d rows", job.ID(), len(records))
+	return nil
+}
+
+// Initialize the BigQuery integration by registering it with the registry.
+func init() {
+	registry.RegisterDestination("BigQuery", BigQueryDestination{})
+}
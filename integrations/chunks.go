@@ -0,0 +1,74 @@
+package integrations
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+)
+
+// DefaultChunkRetryBackoff is the wait before the first retry of a chunk when
+// Request.ChunkRetryBackoff is not set
+const DefaultChunkRetryBackoff = time.Second
+
+// ChunkReadFunc fills buf with the bytes of a remote file at offset, and
+// returns how many it read before failing. retry is set when the read before
+// it failed, so the connection should be opened again.
+type ChunkReadFunc func(offset int64, buf []byte, retry bool) (int, error)
+
+// validateChunks checks the chunked download settings of a request
+func validateChunks(req interfaces.Request) error {
+	if req.ChunkSize < 0 || req.ChunkRetries < 0 {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("chunk size and chunk retries must not be negative"))
+	}
+	if req.ChunkRetryBackoff != "" {
+		if backoff, err := time.ParseDuration(req.ChunkRetryBackoff); err != nil || backoff < 0 {
+			return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid chunk retry backoff %q: must be a duration such as 500ms", req.ChunkRetryBackoff))
+		}
+	}
+	return nil
+}
+
+// ReadChunks downloads the size bytes of the file name a chunk of
+// req.ChunkSize bytes at a time. A chunk that fails is retried up to
+// req.ChunkRetries times with exponential backoff, from the byte it stopped
+// at, so a failure never downloads the chunks before it again.
+func ReadChunks(name string, size int64, req interfaces.Request, read ChunkReadFunc) ([]byte, error) {
+	if err := validateChunks(req); err != nil {
+		return nil, err
+	}
+	if req.ChunkSize == 0 {
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("chunk size must be set to download in chunks"))
+	}
+	initial := DefaultChunkRetryBackoff
+	if req.ChunkRetryBackoff != "" {
+		initial, _ = time.ParseDuration(req.ChunkRetryBackoff)
+	}
+
+	data := make([]byte, size)
+	chunks := (size + int64(req.ChunkSize) - 1) / int64(req.ChunkSize)
+	retry := false
+	for start := int64(0); start < size; start += int64(req.ChunkSize) {
+		end := min(start+int64(req.ChunkSize), size)
+		offset, backoff := start, initial
+		for attempt := 0; ; attempt++ {
+			n, err := read(offset, data[offset:end], retry)
+			offset += int64(n)
+			retry = err != nil
+			if err == nil || offset == end {
+				break
+			}
+			if attempt >= req.ChunkRetries {
+				return nil, fmt.Errorf("failed to download bytes %d-%d of %s: %w", start, end-1, name, err)
+			}
+			logger.Infof("Failed to download bytes %d-%d of %s, resuming at byte %d in %s (retry %d of %d): %v",
+				start, end-1, name, offset, backoff, attempt+1, req.ChunkRetries, err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		logger.Debugf("Downloaded chunk %d of %d of %s", start/int64(req.ChunkSize)+1, chunks, name)
+	}
+	return data, nil
+}
@@ -0,0 +1,244 @@
+package integrations
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/pipeline"
+	"github.com/SkySingh04/fractal/registry"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats registered as codecs, which any transport with a Format setting carries
+const (
+	FormatCSV       = "csv"
+	FormatJSON      = "json"
+	FormatJSONLines = "jsonl"
+	FormatYAML      = "yaml"
+)
+
+// csvCodec reads a header row followed by one row per record, all values as text
+type csvCodec struct{}
+
+func (csvCodec) Decode(data []byte) ([]map[string]interface{}, []string, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil, nil
+	}
+	columns := rows[0]
+	for i := range columns {
+		columns[i] = strings.TrimSpace(columns[i])
+	}
+	records := make([]map[string]interface{}, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		rec := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			rec[column] = row[i]
+		}
+		records = append(records, rec)
+	}
+	return records, columns, nil
+}
+
+func (csvCodec) Encode(records []map[string]interface{}, columns []string) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(columns); err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		fields := make([]string, len(columns))
+		for i, column := range columns {
+			if value := rec[column]; value != nil {
+				fields[i] = fmt.Sprint(value)
+			}
+		}
+		if err := writer.Write(fields); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// jsonCodec reads an array of objects, or a single object, and writes an array
+type jsonCodec struct{}
+
+func (jsonCodec) Decode(data []byte) ([]map[string]interface{}, []string, error) {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	records, err := objectList(value)
+	return records, nil, err
+}
+
+func (jsonCodec) Encode(records []map[string]interface{}, _ []string) ([]byte, error) {
+	if records == nil {
+		records = []map[string]interface{}{}
+	}
+	return json.MarshalIndent(records, "", "  ")
+}
+
+// jsonLinesCodec reads and writes one JSON object per line
+type jsonLinesCodec struct{}
+
+func (jsonLinesCodec) Decode(data []byte) ([]map[string]interface{}, []string, error) {
+	var records []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var rec map[string]interface{}
+		if err := json.Unmarshal(text, &rec); err != nil || rec == nil {
+			return nil, nil, fmt.Errorf("invalid JSON lines: line %d is not a JSON object", line)
+		}
+		records = append(records, rec)
+	}
+	return records, nil, scanner.Err()
+}
+
+func (jsonLinesCodec) Encode(records []map[string]interface{}, _ []string) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, rec := range records {
+		if err := encoder.Encode(rec); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// yamlCodec reads a list of mappings, or a single mapping, and writes a list
+type yamlCodec struct{}
+
+func (yamlCodec) Decode(data []byte) ([]map[string]interface{}, []string, error) {
+	var value interface{}
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return nil, nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+	records, err := objectList(value)
+	return records, nil, err
+}
+
+func (yamlCodec) Encode(records []map[string]interface{}, _ []string) ([]byte, error) {
+	if records == nil {
+		records = []map[string]interface{}{}
+	}
+	return yaml.Marshal(records)
+}
+
+// objectList returns a decoded document as records: each object of a list,
+// or the document itself when it is one object
+func objectList(value interface{}) ([]map[string]interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return []map[string]interface{}{v}, nil
+	case []interface{}:
+		records := make([]map[string]interface{}, 0, len(v))
+		for i, item := range v {
+			rec, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("item %d is a %T, expected an object", i+1, item)
+			}
+			records = append(records, rec)
+		}
+		return records, nil
+	}
+	return nil, fmt.Errorf("expected an object or a list of objects, got a %T", value)
+}
+
+// lookupCodec returns the codec registered for the format
+func lookupCodec(format string) (interfaces.Codec, error) {
+	codec, ok := registry.GetCodec(format)
+	if !ok {
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("unknown format %q: expected one of %s", format, strings.Join(registry.CodecNames(), ", ")))
+	}
+	return codec, nil
+}
+
+// validateFormat checks an optional Format setting names a registered codec
+func validateFormat(format string) error {
+	if strings.TrimSpace(format) == "" {
+		return nil
+	}
+	_, err := lookupCodec(format)
+	return err
+}
+
+// decodeRecords decodes bytes read by a transport into rows for the pipeline
+func decodeRecords(format string, data []byte) (*pipeline.SourceRows, error) {
+	codec, err := lookupCodec(format)
+	if err != nil {
+		return nil, err
+	}
+	records, columns, err := codec.Decode(data)
+	if err != nil {
+		return nil, interfaces.Wrap(interfaces.ErrValidation, fmt.Errorf("failed to decode %s: %w", strings.ToLower(format), err))
+	}
+	return &pipeline.SourceRows{Records: records, Columns: columns}, nil
+}
+
+// encodeRecords encodes the records of data for a transport to write,
+// leaving out the table each record came from
+func encodeRecords(format string, data interface{}) ([]byte, error) {
+	codec, err := lookupCodec(format)
+	if err != nil {
+		return nil, err
+	}
+	dataset := pipeline.NewDataset(data)
+	if !dataset.Structured() {
+		return nil, fmt.Errorf("cannot encode %T as %s: it holds no records", data, strings.ToLower(format))
+	}
+	records := make([]map[string]interface{}, len(dataset.Records))
+	for i, rec := range dataset.Records {
+		rec = rec.Copy()
+		delete(rec, pipeline.TableField)
+		records[i] = rec
+	}
+	var columns []string
+	for _, column := range dataset.OutputColumns() {
+		if column != pipeline.TableField {
+			columns = append(columns, column)
+		}
+	}
+	out, err := codec.Encode(records, columns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode records as %s: %w", strings.ToLower(format), err)
+	}
+	return out, nil
+}
+
+// transportBytes returns what a byte transport writes: the data encoded in
+// the format when one is set, or else the bytes it was given
+func transportBytes(format string, data interface{}) ([]byte, error) {
+	if strings.TrimSpace(format) != "" {
+		return encodeRecords(format, data)
+	}
+	dataBytes, ok := data.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("invalid data format; expected []byte, got %T, set format to write records", data)
+	}
+	return dataBytes, nil
+}
+
+func init() {
+	registry.RegisterCodec(FormatCSV, csvCodec{})
+	registry.RegisterCodec(FormatJSON, jsonCodec{})
+	registry.RegisterCodec(FormatJSONLines, jsonLinesCodec{})
+	registry.RegisterCodec(FormatYAML, yamlCodec{})
+}
@@ -0,0 +1,175 @@
+package integrations
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression codecs file sources and destinations understand. The empty
+// setting picks the codec from the file extension.
+const (
+	CompressionNone  = "none"
+	CompressionGzip  = "gzip"
+	CompressionZstd  = "zstd"
+	CompressionBzip2 = "bzip2"
+)
+
+// compressionExtensions maps file extensions to the codec they imply
+var compressionExtensions = map[string]string{
+	".gz":   CompressionGzip,
+	".gzip": CompressionGzip,
+	".zst":  CompressionZstd,
+	".zstd": CompressionZstd,
+	".bz2":  CompressionBzip2,
+}
+
+// compressionCodec resolves the configured compression for a file: an
+// explicit codec wins, otherwise the extension decides
+func compressionCodec(setting, path string) (string, error) {
+	switch codec := strings.ToLower(strings.TrimSpace(setting)); codec {
+	case "", "auto":
+		for ext, codec := range compressionExtensions {
+			if strings.HasSuffix(strings.ToLower(path), ext) {
+				return codec, nil
+			}
+		}
+		return CompressionNone, nil
+	case CompressionNone, CompressionGzip, CompressionZstd, CompressionBzip2:
+		return codec, nil
+	}
+	return "", interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("unsupported compression %q: expected none, gzip, zstd or bzip2", setting))
+}
+
+// validateCompression checks a compression setting, and that a destination
+// can write it
+func validateCompression(setting, path string, writing bool) error {
+	codec, err := compressionCodec(setting, path)
+	if err != nil {
+		return err
+	}
+	if writing && codec == CompressionBzip2 {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("bzip2 compression is only supported for reading, use gzip or zstd for %s", path))
+	}
+	return nil
+}
+
+// trimCompressionExtension returns the path without the extension of its codec, such as data.csv for data.csv.gz
+func trimCompressionExtension(path string) string {
+	for ext := range compressionExtensions {
+		if strings.HasSuffix(strings.ToLower(path), ext) {
+			return path[:len(path)-len(ext)]
+		}
+	}
+	return path
+}
+
+// compressedReader closes the decompressor and the file under it
+type compressedReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *compressedReader) Close() error {
+	var firstErr error
+	for _, c := range r.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// openSourceFile opens a file, or an entry of an archive, for reading,
+// decompressing it as it is read
+func openSourceFile(path, compression string) (io.ReadCloser, error) {
+	codec, err := compressionCodec(compression, path)
+	if err != nil {
+		return nil, err
+	}
+	var file io.ReadCloser
+	if archive, entry, ok := splitArchiveEntry(path); ok {
+		file, err = openArchiveEntry(archive, entry)
+	} else {
+		file, err = os.Open(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch codec {
+	case CompressionGzip:
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to read gzip file %s: %w", path, err)
+		}
+		return &compressedReader{Reader: gz, closers: []io.Closer{gz, file}}, nil
+	case CompressionZstd:
+		zr, err := zstd.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to read zstd file %s: %w", path, err)
+		}
+		return &compressedReader{Reader: zr, closers: []io.Closer{zr.IOReadCloser(), file}}, nil
+	case CompressionBzip2:
+		return &compressedReader{Reader: bzip2.NewReader(file), closers: []io.Closer{file}}, nil
+	}
+	return file, nil
+}
+
+// compressedWriter flushes the compressor before closing the file under it
+type compressedWriter struct {
+	io.Writer
+	compressor io.Closer
+	file       io.Closer
+}
+
+func (w *compressedWriter) Close() error {
+	if err := w.compressor.Close(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// openDestinationFile opens a file for writing with os.OpenFile flags,
+// compressing what is written to it. Appending to a compressed file adds a
+// new stream, which gzip and zstd readers read as part of the same file.
+// StdoutPath writes to Stdout instead.
+func openDestinationFile(path, compression string, flags int) (io.WriteCloser, error) {
+	if err := validateCompression(compression, path, true); err != nil {
+		return nil, err
+	}
+	codec, _ := compressionCodec(compression, path)
+	var file io.WriteCloser = stdoutWriter{Stdout}
+	if path != StdoutPath {
+		var err error
+		if file, err = os.OpenFile(path, flags, 0644); err != nil {
+			return nil, err
+		}
+	}
+	switch codec {
+	case CompressionGzip:
+		gz := gzip.NewWriter(file)
+		return &compressedWriter{Writer: gz, compressor: gz, file: file}, nil
+	case CompressionZstd:
+		zw, err := zstd.NewWriter(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &compressedWriter{Writer: zw, compressor: zw, file: file}, nil
+	}
+	return file, nil
+}
+
+// createDestinationFile creates or truncates a file for writing, compressing what is written to it
+func createDestinationFile(path, compression string) (io.WriteCloser, error) {
+	return openDestinationFile(path, compression, os.O_CREATE|os.O_WRONLY|os.O_TRUNC)
+}
@@ -1,6 +1,7 @@
 package integrations
 
 import (
+	"bufio"
 	"encoding/csv"
 	"errors"
 	"fmt"
@@ -15,6 +16,7 @@ import (
 	"github.com/SkySingh04/fractal/interfaces"
 	"github.com/SkySingh04/fractal/language"
 	"github.com/SkySingh04/fractal/logger"
+	"github.com/SkySingh04/fractal/pipeline"
 	"github.com/SkySingh04/fractal/registry"
 )
 
@@ -64,22 +66,102 @@ func WriteCSV(fileName string, data []byte) error {
 
 // CSVSource struct represents the configuration for consuming messages from CSV.
 type CSVSource struct {
-	CSVSourceFileName string `json:"csv_source_file_name"`
+	CSVSourceFileName       string   `json:"csv_source_file_name" fractal:"required"`
+	CSVSourceHasHeader      bool     `json:"csv_source_has_header" fractal:"default=true"`
+	CSVSourceColumns        []string `json:"csv_source_columns"`
+	CSVSourceSkipLines      int      `json:"csv_source_skip_lines"`
+	CSVSourceCommentPrefix  string   `json:"csv_source_comment_prefix"`
+	CSVSourceTrimSpace      bool     `json:"csv_source_trim_space"`
+	CSVSourceCollapseSpace  bool     `json:"csv_source_collapse_space"`
+	CSVSourceExpectedHeader []string `json:"csv_source_expected_header"`
+	CSVSourceAllowReorder   bool     `json:"csv_source_allow_reorder"`
+	Recursive               bool     `json:"source_recursive"`
+	FileField               string   `json:"source_file_field"`
+	ArchiveEntries          string   `json:"source_archive_entries"`
+	Compression             string   `json:"compression" fractal:"enum=gzip|zstd|bzip2|none"`
+	Encoding                string   `json:"encoding" fractal:"enum=utf-8|utf-16|utf-16le|utf-16be|latin-1|windows-1252"`
 }
 
 // CSVDestination struct represents the configuration for publishing messages to CSV.
 type CSVDestination struct {
-	CSVDestinationFileName string `json:"csv_destination_file_name"`
+	CSVDestinationFileName    string   `json:"csv_destination_file_name" fractal:"required"`
+	CSVDestinationColumns     []string `json:"csv_destination_columns"`
+	CSVDestinationWriteHeader bool     `json:"csv_destination_write_header" fractal:"default=true"`
+	CSVDestinationQuoteMode   string   `json:"csv_destination_quote_mode" fractal:"enum=minimal|all|none"`
+	PartitionBy               []string `json:"partition_by"`
+	PartitionMaxOpenWriters   int      `json:"partition_max_open_writers"`
+	PartitionEmptyValue       string   `json:"partition_empty_value"`
+	Compression               string   `json:"compression" fractal:"enum=gzip|zstd|none"`
+	Encoding                  string   `json:"encoding" fractal:"enum=utf-8|utf-16|utf-16le|utf-16be|latin-1|windows-1252"`
 }
 
 // FetchData connects to CSV, retrieves data, and processes it concurrently.
+// The file name may also be a glob pattern or a directory, in which case the
+// matching files are read in sorted order and their rows put together.
 func (r CSVSource) FetchData(req interfaces.Request) (interface{}, error) {
 	logger.Infof("Reading data from CSV Source: %s", req.CSVSourceFileName)
 
 	if req.CSVSourceFileName == "" {
-		return nil, errors.New("missing CSV source file name")
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing CSV source file name"))
 	}
 
+	if req.CSVSourceSkipLines < 0 {
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("CSV source skip lines must not be negative"))
+	}
+
+	if len(req.CSVSourceExpectedHeader) > 0 && req.CSVSourceHasHeader != nil && !*req.CSVSourceHasHeader {
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("csvsourceexpectedheader needs a header row, name the columns of a file without one with csvsourcecolumns"))
+	}
+
+	files, multiple, err := sourceFiles(req.CSVSourceFileName, req.SourceRecursive, req.SourceArchiveEntries, ".csv")
+	if err != nil {
+		return nil, err
+	}
+	field := sourceFileField(req.SourceFileField, multiple)
+	if field == "" {
+		return fetchCSVFile(files[0], req)
+	}
+
+	// Every file must have the same columns, so each row lines up with the first header
+	var header string
+	var lines []string
+	for _, file := range files {
+		logger.Infof("Reading CSV file %s", file)
+		data, err := fetchCSVFile(file, req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		if data == "" {
+			continue
+		}
+		rows := strings.Split(data, "\n")
+		if header == "" {
+			header = rows[0]
+			if columnSet(header)[field] {
+				return nil, fmt.Errorf("CSV file %s already has a %s column", file, field)
+			}
+			lines = append(lines, header+","+field)
+		} else if rows[0] != header {
+			return nil, fmt.Errorf("CSV file %s has columns %s, but %s has %s", file, rows[0], files[0], header)
+		}
+		for _, row := range rows[1:] {
+			lines = append(lines, row+","+file)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// columnSet returns the columns of a CSV header line
+func columnSet(header string) map[string]bool {
+	columns := make(map[string]bool)
+	for _, column := range strings.Split(header, ",") {
+		columns[strings.TrimSpace(column)] = true
+	}
+	return columns
+}
+
+// fetchCSVFile reads, validates and transforms a single CSV file
+func fetchCSVFile(fileName string, req interfaces.Request) (string, error) {
 	// Create channels for processing pipeline
 	dataChan := make(chan string, bufferSize)
 	validChan := make(chan string, bufferSize)
@@ -88,13 +170,24 @@ func (r CSVSource) FetchData(req interfaces.Request) (interface{}, error) {
 
 	var wg sync.WaitGroup
 
-	// Start concurrent CSV reading
+	// Start concurrent CSV reading. readCSVConcurrently reports its own errors.
+	opts := csvReadOptions{
+		HasHeader:     req.CSVSourceHasHeader == nil || *req.CSVSourceHasHeader,
+		Columns:       req.CSVSourceColumns,
+		SkipLines:     req.CSVSourceSkipLines,
+		CommentPrefix: req.CSVSourceCommentPrefix,
+		TrimSpace:     req.CSVSourceTrimSpace,
+		CollapseSpace: req.CSVSourceCollapseSpace,
+		Compression:   req.Compression,
+		Encoding:      req.Encoding,
+
+		ExpectedHeader: req.CSVSourceExpectedHeader,
+		AllowReorder:   req.CSVSourceAllowReorder,
+	}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := readCSVConcurrently(req.CSVSourceFileName, dataChan, errChan); err != nil {
-			errChan <- err
-		}
+		_ = readCSVConcurrently(fileName, opts, dataChan, errChan)
 		close(dataChan)
 	}()
 
@@ -103,8 +196,16 @@ func (r CSVSource) FetchData(req interfaces.Request) (interface{}, error) {
 	go func() {
 		defer wg.Done()
 		for data := range dataChan {
+			if req.ValidationRules == "" {
+				validChan <- data
+				continue
+			}
 			if validData, err := validateCSVData([]byte(data), req.ValidationRules); err != nil {
-				errChan <- err
+				// Keep the first error; blocking on a second one would stall the reader
+				select {
+				case errChan <- interfaces.Wrap(interfaces.ErrValidation, err):
+				default:
+				}
 			} else {
 				validChan <- string(validData)
 			}
@@ -117,6 +218,10 @@ func (r CSVSource) FetchData(req interfaces.Request) (interface{}, error) {
 	go func() {
 		defer wg.Done()
 		for validData := range validChan {
+			if req.TransformationRules == "" {
+				transformedChan <- validData
+				continue
+			}
 			dataRecieved, _ := transformCSVData([]byte(validData), req.TransformationRules)
 			transformedChan <- string(dataRecieved)
 		}
@@ -137,7 +242,7 @@ func (r CSVSource) FetchData(req interfaces.Request) (interface{}, error) {
 
 	// Check for errors
 	if err, ok := <-errChan; ok {
-		return nil, err
+		return "", err
 	}
 
 	return strings.Join(results, "\n"), nil
@@ -148,20 +253,36 @@ func (r CSVDestination) SendData(data interface{}, req interfaces.Request) error
 	logger.Infof("Writing data to CSV Destination: %s", req.CSVDestinationFileName)
 
 	if req.CSVDestinationFileName == "" {
-		return errors.New("missing CSV destination file name")
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing CSV destination file name"))
 	}
 
-	// Convert data to a slice of strings for writing
+	if len(req.PartitionBy) > 0 {
+		return writePartitionedCSV(data, req)
+	}
+
+	// Convert data to a slice of strings for writing. Records from other
+	// sources, or CSV with a requested column order, are rendered first.
 	lines, ok := data.(string)
-	if !ok {
-		return errors.New("invalid data format for CSV destination")
+	if !ok || len(req.CSVDestinationColumns) > 0 {
+		dataset := pipeline.NewDataset(data)
+		if !dataset.Structured() {
+			return errors.New("invalid data format for CSV destination")
+		}
+		lines = dataset.CSV(req.CSVDestinationColumns)
 	}
 	records := strings.Split(lines, "\n")
+	// A batch continuing a file leaves out the header the first batch wrote
+	header := 1
+	if req.OutputAppend || (req.CSVDestinationWriteHeader != nil && !*req.CSVDestinationWriteHeader) {
+		records = records[1:]
+		header = 0
+	}
 
 	// Write concurrently
+	path := outputFile(req.CSVDestinationFileName, req)
 	errChan := make(chan error, 1)
 	go func() {
-		errChan <- writeCSVConcurrently(req.CSVDestinationFileName, records)
+		errChan <- writeCSVConcurrently(path, req.Compression, req.Encoding, req.CSVDestinationQuoteMode, records, req.OutputAppend)
 	}()
 
 	// Check for errors
@@ -169,18 +290,146 @@ func (r CSVDestination) SendData(data interface{}, req interfaces.Request) error
 		return err
 	}
 
+	reportOutput(req, path, len(records)-header, req.OutputAppend)
 	return nil
 }
 
-// readCSVConcurrently reads the content of a CSV file and sends records to a channel.
-func readCSVConcurrently(fileName string, out chan<- string, errChan chan<- error) error {
-	file, err := os.Open(fileName)
+// writePartitionedCSV streams each record into the CSV file of its partition
+func writePartitionedCSV(data interface{}, req interfaces.Request) error {
+	dataset, err := partitionedRecords(data)
 	if err != nil {
 		return err
 	}
+	p := partitioning{By: req.PartitionBy, MaxOpenWriters: req.PartitionMaxOpenWriters, EmptyValue: req.PartitionEmptyValue}
+	columns := req.CSVDestinationColumns
+	if len(columns) == 0 {
+		columns = dataset.OutputColumns()
+	}
+	columns = p.columns(columns)
+	writeHeader := req.CSVDestinationWriteHeader == nil || *req.CSVDestinationWriteHeader
+
+	writers := newPartitionWriters(p.MaxOpenWriters, func(path string, reopen bool) (partitionWriter, error) {
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if reopen {
+			flags = os.O_WRONLY | os.O_APPEND
+		}
+		file, err := openEncodedFile(path, req.Compression, req.Encoding, flags)
+		if err != nil {
+			return nil, err
+		}
+		w := &csvPartition{file: file, writer: newCSVWriter(file, req.CSVDestinationQuoteMode), columns: columns}
+		if writeHeader && !reopen {
+			if err := w.writer.Write(columns); err != nil {
+				file.Close()
+				return nil, err
+			}
+		}
+		return w, nil
+	})
+	written := map[string]int{}
+	for _, rec := range dataset.Records {
+		path, rec := p.path(req.CSVDestinationFileName, rec)
+		if err := writers.Write(path, rec); err != nil {
+			writers.Close()
+			return err
+		}
+		written[path]++
+	}
+	if err := writers.Close(); err != nil {
+		return err
+	}
+	for path, records := range written {
+		reportOutput(req, path, records, false)
+	}
+	return nil
+}
+
+// csvPartition writes the rows of one partition file
+type csvPartition struct {
+	file    io.WriteCloser
+	writer  csvRowWriter
+	columns []string
+}
+
+func (c *csvPartition) Write(rec pipeline.Record) error {
+	fields := make([]string, len(c.columns))
+	for i, column := range c.columns {
+		if value := rec[column]; value != nil {
+			fields[i] = fmt.Sprint(value)
+		}
+	}
+	return c.writer.Write(fields)
+}
+
+func (c *csvPartition) Close() error {
+	c.writer.Flush()
+	if err := c.writer.Error(); err != nil {
+		c.file.Close()
+		return err
+	}
+	return c.file.Close()
+}
+
+// csvReadOptions says how to read the lines of a source CSV file
+type csvReadOptions struct {
+	HasHeader     bool
+	Columns       []string
+	SkipLines     int
+	CommentPrefix string
+	TrimSpace     bool // Strips the whitespace around each field
+	CollapseSpace bool // Strips it and turns runs of whitespace inside a field into one space
+	Compression   string
+	Encoding      string
+
+	ExpectedHeader []string // Columns the header must have, in order unless AllowReorder
+	AllowReorder   bool
+}
+
+// skipCSVPreamble drops the metadata some exporters put above the data: the
+// first skipLines lines, then any lines starting with commentPrefix. Only the
+// lines before the header are checked, and they are dropped before the CSV
+// parser sees them, so a stray quote in them cannot break parsing.
+func skipCSVPreamble(r *bufio.Reader, fileName string, skipLines int, commentPrefix string) (io.Reader, error) {
+	for line := 1; ; line++ {
+		text, err := r.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		skipped := line <= skipLines || (commentPrefix != "" && strings.HasPrefix(text, commentPrefix))
+		if !skipped {
+			// Put the first data line back in front of the rest of the file
+			return io.MultiReader(strings.NewReader(text), r), nil
+		}
+		logger.Debugf("Skipping line %d of CSV source %s: %s", line, fileName, strings.TrimRight(text, "\r\n"))
+		if err != nil {
+			return r, nil
+		}
+	}
+}
+
+// readCSVConcurrently reads the content of a CSV file and sends records to a
+// channel, header first. Without a header in the file the header is built from
+// columns, or numbered column1, column2 and so on after the first row. Lines
+// of metadata above the data are skipped first. A compressed file is
+// decompressed, and decoded to UTF-8, as it is read. Fields are cleaned of whitespace as they are
+// read, so validations see the cleaned values.
+func readCSVConcurrently(fileName string, opts csvReadOptions, out chan<- string, errChan chan<- error) error {
+	file, err := openTextFile(fileName, opts.Compression, opts.Encoding)
+	if err != nil {
+		errChan <- err
+		return err
+	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
+	input, err := skipCSVPreamble(bufio.NewReader(file), fileName, opts.SkipLines, opts.CommentPrefix)
+	if err != nil {
+		errChan <- err
+		return err
+	}
+	reader := csv.NewReader(input)
+	// Rows whose field count differs from the header are quarantined by the pipeline, not rejected here
+	reader.FieldsPerRecord = -1
+	first := true
 	for {
 		record, err := reader.Read()
 		if err != nil {
@@ -190,27 +439,161 @@ func readCSVConcurrently(fileName string, out chan<- string, errChan chan<- erro
 			errChan <- err
 			return err
 		}
+		if first && !opts.HasHeader {
+			header := opts.Columns
+			if len(header) == 0 {
+				for i := range record {
+					header = append(header, fmt.Sprintf("column%d", i+1))
+				}
+			}
+			out <- strings.Join(header, ",")
+		}
+		isHeader := first && opts.HasHeader
+		first = false
+		if opts.TrimSpace || opts.CollapseSpace {
+			for i, field := range record {
+				record[i] = pipeline.CleanSpace(field, opts.CollapseSpace)
+			}
+		}
+		// A header that moved is caught before any row is matched up with it
+		if isHeader && len(opts.ExpectedHeader) > 0 {
+			if diff := csvHeaderDiff(opts.ExpectedHeader, record, opts.AllowReorder); diff != "" {
+				err := interfaces.Wrap(interfaces.ErrValidation, fmt.Errorf("CSV file %s does not have the expected header: %s", fileName, diff))
+				errChan <- err
+				return err
+			}
+		}
 		out <- strings.Join(record, ",")
 	}
 	return nil
 }
 
-// writeCSVConcurrently writes data records to a CSV file concurrently.
-func writeCSVConcurrently(fileName string, records []string) error {
-	file, err := os.Create(fileName)
+// csvHeaderDiff describes how a header differs from the expected one: the
+// columns missing from it, the extra ones, and the order when it differs
+// without allowReorder. It returns "" when the header matches.
+func csvHeaderDiff(expected, actual []string, allowReorder bool) string {
+	inActual := make(map[string]bool, len(actual))
+	for _, column := range actual {
+		inActual[column] = true
+	}
+	inExpected := make(map[string]bool, len(expected))
+	var missing, extra []string
+	for _, column := range expected {
+		inExpected[column] = true
+		if !inActual[column] {
+			missing = append(missing, column)
+		}
+	}
+	for _, column := range actual {
+		if !inExpected[column] {
+			extra = append(extra, column)
+		}
+	}
+
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, "missing "+strings.Join(missing, ", "))
+	}
+	if len(extra) > 0 {
+		problems = append(problems, "extra "+strings.Join(extra, ", "))
+	}
+	if !allowReorder && len(problems) == 0 && strings.Join(actual, ",") != strings.Join(expected, ",") {
+		problems = append(problems, fmt.Sprintf("columns in the order %s, expected %s", strings.Join(actual, ", "), strings.Join(expected, ", ")))
+	}
+	return strings.Join(problems, "; ")
+}
+
+// writeCSVConcurrently writes data records to a CSV file concurrently,
+// quoting, encoding and compressing it as configured.
+func writeCSVConcurrently(fileName, compression, encodingName, quoteMode string, records []string, appendTo bool) error {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appendTo {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := openEncodedFile(fileName, compression, encodingName, flags)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	writer := csv.NewWriter(file)
+	writer := newCSVWriter(file, quoteMode)
 	for _, record := range records {
 		if err := writer.Write(strings.Split(record, ",")); err != nil {
+			file.Close()
 			return err
 		}
 	}
 	writer.Flush()
-	return writer.Error()
+	if err := writer.Error(); err != nil {
+		file.Close()
+		return err
+	}
+	// Closing a compressed file writes out its last block
+	return file.Close()
+}
+
+// CSV destination quote modes
+const (
+	CSVQuoteMinimal = "minimal"
+	CSVQuoteAll     = "all"
+	CSVQuoteNone    = "none"
+)
+
+// csvRowWriter writes the rows of a destination CSV file, like csv.Writer
+type csvRowWriter interface {
+	Write(fields []string) error
+	Flush()
+	Error() error
+}
+
+// newCSVWriter returns a writer quoting fields in the quote mode. Minimal
+// quoting, the default, is encoding/csv's.
+func newCSVWriter(w io.Writer, quoteMode string) csvRowWriter {
+	switch strings.ToLower(quoteMode) {
+	case CSVQuoteAll, CSVQuoteNone:
+		return &quotingCSVWriter{w: bufio.NewWriter(w), all: strings.EqualFold(quoteMode, CSVQuoteAll)}
+	}
+	return csv.NewWriter(w)
+}
+
+// quotingCSVWriter writes every field quoted, or none of them. Unquoted
+// fields cannot hold the delimiter or a line break, so a row with one fails.
+type quotingCSVWriter struct {
+	w   *bufio.Writer
+	all bool
+	err error
+}
+
+func (q *quotingCSVWriter) Write(fields []string) error {
+	if q.err != nil {
+		return q.err
+	}
+	for i, field := range fields {
+		if i > 0 {
+			q.w.WriteByte(',')
+		}
+		if q.all {
+			q.w.WriteByte('"')
+			q.w.WriteString(strings.ReplaceAll(field, `"`, `""`))
+			q.w.WriteByte('"')
+			continue
+		}
+		if strings.ContainsAny(field, ",\r\n") {
+			return fmt.Errorf("field %q needs quoting, but quote mode is %s", field, CSVQuoteNone)
+		}
+		q.w.WriteString(field)
+	}
+	_, q.err = q.w.WriteString("\n")
+	return q.err
+}
+
+func (q *quotingCSVWriter) Flush() {
+	if err := q.w.Flush(); err != nil && q.err == nil {
+		q.err = err
+	}
+}
+
+func (q *quotingCSVWriter) Error() error {
+	return q.err
 }
 
 // applyValidationRule processes a single record against a validation rule AST node.
@@ -233,7 +616,7 @@ func applyValidationRule(record string, headers []string, ruleNode language.Node
 	}
 
 	// Log the constructed field map
-	fmt.Printf("Constructed FieldMap: %v", fieldMap)
+	logger.Debugf("Constructed FieldMap: %v", fieldMap)
 
 	// Evaluate the ruleNode recursively
 	logger.Infof("Evaluating rule: %s", ruleNode.Value)
@@ -258,7 +641,7 @@ func validateCSVData(data []byte, validationRules string) ([]byte, error) {
 	lexer := language.NewLexer(validationRules)
 	tokens, err := lexer.Tokenize(validationRules)
 	if err != nil {
-		return nil, fmt.Errorf("failed to tokenize validation rules: %v", err)
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("failed to tokenize validation rules: %v", err))
 	}
 	logger.Infof("Tokens: %v", tokens)
 
@@ -270,8 +653,7 @@ func validateCSVData(data []byte, validationRules string) ([]byte, error) {
 	// }
 	rulesAST, err := parser.ParseRules(tokens)
 	if err != nil {
-		fmt.Println("hi")
-		return nil, fmt.Errorf("failed to parse validation rules: %v", err)
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("failed to parse validation rules: %v", err))
 	}
 
 	// Apply validation rules to data
@@ -308,7 +690,7 @@ func transformCSVData(data []byte, transformationRules string) ([]byte, error) {
 	lexer := language.NewLexer(transformationRules)
 	tokens, err := lexer.Tokenize(transformationRules)
 	if err != nil {
-		return nil, fmt.Errorf("failed to tokenize transformation rules: %v", err)
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("failed to tokenize transformation rules: %v", err))
 	}
 
 	// Parse the tokens into an AST
@@ -319,7 +701,7 @@ func transformCSVData(data []byte, transformationRules string) ([]byte, error) {
 	// }
 	rulesAST, err := parser.ParseRules(tokens)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse transformation rules: %v", err)
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("failed to parse transformation rules: %v", err))
 	}
 
 	// Apply transformation rules to data
@@ -350,11 +732,7 @@ func resolveField(field string) string {
 
 // Recursive function to evaluate nodes
 func evaluateNode(node *language.Node, fieldMap map[string]string) error {
-	fmt.Printf("Fieldmap in evaluateNode: %v", fieldMap)
-	//print the fields in the fieldMap
-	for key, value := range fieldMap {
-		fmt.Printf("Key: %s, Value: %s", key, value)
-	}
+	logger.Debugf("Fieldmap in evaluateNode: %v", fieldMap)
 	switch node.Type {
 	case language.TokenField:
 		return nil // This case is handled within expressions
@@ -367,7 +745,7 @@ func evaluateNode(node *language.Node, fieldMap map[string]string) error {
 		resolvedField := resolveField(fieldNode.Value) // Resolve FIELD("...") to actual field name
 		logger.Infof("Evaluating expression: %s %s %s", resolvedField, conditionNode.Value, valueNode.Value)
 
-		// Display the FieldMap with fmt.Printf for debugging
+		// Display the FieldMap for debugging
 
 		fieldMap := map[string]string{
 			"name": "Alice",
@@ -375,7 +753,7 @@ func evaluateNode(node *language.Node, fieldMap map[string]string) error {
 			"city": "New York",
 		}
 
-		fmt.Printf("FieldMap: %v\n", fieldMap)
+		logger.Debugf("FieldMap: %v", fieldMap)
 		// Check if the field exists in FieldMap
 		fieldValue, exists := fieldMap[resolvedField]
 		if !exists {
@@ -557,6 +935,70 @@ func applyTransformationRule(record string, ruleNode *language.Node) (string, er
 	return record, nil // Replace with actual transformation logic
 }
 
+// ValidateConfig checks the compression setting before the file is read
+func (r CSVSource) ValidateConfig(req interfaces.Request) error {
+	if err := validateEncoding(req.Encoding); err != nil {
+		return err
+	}
+	return validateCompression(req.Compression, req.CSVSourceFileName, false)
+}
+
+// ValidateConfig checks that the destination can write the configured
+// compression and quote mode, that partitioned output isn't also split into
+// parts, and that standard output is neither
+func (r CSVDestination) ValidateConfig(req interfaces.Request) error {
+	if len(req.PartitionBy) > 0 && req.OutputMode != "" {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("outputmode cannot be combined with partitionby"))
+	}
+	switch strings.ToLower(req.CSVDestinationQuoteMode) {
+	case "", CSVQuoteMinimal, CSVQuoteAll, CSVQuoteNone:
+	default:
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid CSV quote mode %q: expected %s, %s or %s", req.CSVDestinationQuoteMode, CSVQuoteMinimal, CSVQuoteAll, CSVQuoteNone))
+	}
+	if err := validateStdoutOutput(req.CSVDestinationFileName, req); err != nil {
+		return err
+	}
+	if err := validateEncoding(req.Encoding); err != nil {
+		return err
+	}
+	return validateCompression(req.Compression, req.CSVDestinationFileName, true)
+}
+
+// DestinationFields returns the configured columns, if any
+func (r CSVDestination) DestinationFields(req interfaces.Request) ([]string, error) {
+	return req.CSVDestinationColumns, nil
+}
+
+// Target returns the CSV file the records are written to
+func (r CSVDestination) Target(req interfaces.Request) string {
+	return req.CSVDestinationFileName
+}
+
+// WithTarget returns the request writing to the CSV file at path
+func (r CSVDestination) WithTarget(req interfaces.Request, path string) interfaces.Request {
+	req.CSVDestinationFileName = path
+	return req
+}
+
+// OutputDir returns the directory the CSV files are written to
+func (r CSVDestination) OutputDir(req interfaces.Request) string {
+	return outputDir(req.CSVDestinationFileName)
+}
+
+// PartSize returns the size of the CSV file the batch was written to
+func (r CSVDestination) PartSize(req interfaces.Request) (int64, error) {
+	info, err := os.Stat(outputFile(req.CSVDestinationFileName, req))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Location returns the CSV file the records are read from
+func (r CSVSource) Location(req interfaces.Request) string {
+	return req.CSVSourceFileName
+}
+
 // Initialize the CSV integrations by registering them with the registry.
 func init() {
 	registry.RegisterSource("CSV", CSVSource{})
@@ -22,21 +22,35 @@ type MockDynamoDB struct {
 
 func (m *MockDynamoDB) Scan(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
 	// Mocking data returned by Scan based on table name
-	if *input.TableName == "input" {
-		return &dynamodb.ScanOutput{
-			Items: []map[string]*dynamodb.AttributeValue{
-				{
-					"KeyAttribute": {S: aws.String("sampleKey1")},
-					"Data":         {S: aws.String("sampleData1")},
-				},
-				{
-					"KeyAttribute": {S: aws.String("sampleKey2")},
-					"Data":         {S: aws.String("sampleData2")},
-				},
-			},
-		}, nil
+	if *input.TableName != "input" {
+		return nil, errors.New("table not found")
 	}
-	return nil, errors.New("table not found")
+	items := []map[string]*dynamodb.AttributeValue{
+		{
+			"KeyAttribute": {S: aws.String("sampleKey1")},
+			"Data":         {S: aws.String("sampleData1")},
+		},
+		{
+			"KeyAttribute": {S: aws.String("sampleKey2")},
+			"Data":         {S: aws.String("sampleData2")},
+		},
+	}
+	// Pages start after ExclusiveStartKey and hold up to Limit items, as a real scan's do
+	if start := input.ExclusiveStartKey["KeyAttribute"]; start != nil && start.S != nil {
+		for i, item := range items {
+			if *item["KeyAttribute"].S == *start.S {
+				items = items[i+1:]
+				break
+			}
+		}
+	}
+	output := &dynamodb.ScanOutput{Items: items}
+	if input.Limit != nil && int64(len(items)) > *input.Limit {
+		output.Items = items[:*input.Limit]
+		last := *output.Items[len(output.Items)-1]["KeyAttribute"].S
+		output.LastEvaluatedKey = map[string]*dynamodb.AttributeValue{"KeyAttribute": {S: aws.String(last)}}
+	}
+	return output, nil
 }
 
 func (m *MockDynamoDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
@@ -46,14 +60,20 @@ func (m *MockDynamoDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemO
 
 // DynamoDBSource represents the configuration for reading data from DynamoDB.
 type DynamoDBSource struct {
-	TableName string `json:"table_name"`
-	Region    string `json:"region"`
+	TableName       string   `json:"table_name" fractal:"required"`
+	Region          string   `json:"region" fractal:"required"`
+	RoleARN         string   `json:"role_arn"`         // Role to assume through STS, for cross-account access
+	ExternalID      string   `json:"external_id"`      // External ID the role's trust policy asks for
+	FailoverRegions []string `json:"failover_regions"` // Replica regions of a global table, read when the region is down
 }
 
 // DynamoDBDestination represents the configuration for writing data to DynamoDB.
 type DynamoDBDestination struct {
-	TableName string `json:"table_name"`
-	Region    string `json:"region"`
+	TableName       string   `json:"table_name" fractal:"required"`
+	Region          string   `json:"region" fractal:"required"`
+	RoleARN         string   `json:"role_arn"`         // Role to assume through STS, for cross-account access
+	ExternalID      string   `json:"external_id"`      // External ID the role's trust policy asks for
+	FailoverRegions []string `json:"failover_regions"` // Replica regions of a global table, written when the region is down
 }
 
 // FetchData retrieves data from the source DynamoDB table in the specified region.
@@ -65,15 +85,22 @@ func (d DynamoDBSource) FetchData(req interfaces.Request) (interface{}, error) {
 		return nil, err
 	}
 
-	// Mock DynamoDB client
-	mockDynamoDB := &MockDynamoDB{}
-
 	// Scan the table
 	input := &dynamodb.ScanInput{
 		TableName: aws.String(req.DynamoDBSourceTable),
 	}
 
-	result, err := mockDynamoDB.Scan(input)
+	var result *dynamodb.ScanOutput
+	err := inRegions(req.DynamoDBSourceRegion, req.AWSFailoverRegions, func(region string) error {
+		if _, err := awsSession(region, req.AWSRoleARN, req.AWSExternalID); err != nil {
+			return err
+		}
+		// Mock DynamoDB client
+		mockDynamoDB := &MockDynamoDB{}
+		var err error
+		result, err = mockDynamoDB.Scan(input)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -95,28 +122,12 @@ func (d DynamoDBSource) FetchData(req interfaces.Request) (interface{}, error) {
 		go func(item map[string]*dynamodb.AttributeValue) {
 			defer wg.Done()
 
-			// Validate data
-			validatedData, err := validateDynamoDBData(item)
+			interfaceData, err := dynamoDBRecord(item)
 			if err != nil {
-				errorChannel <- fmt.Errorf("validation failed for item: %v, Error: %s", item, err)
+				errorChannel <- err
 				return
 			}
 
-			// Transform data
-			transformedData := transformDynamoDBData(validatedData)
-
-			// Convert transformed data (map[string]*dynamodb.AttributeValue) to map[string]interface{}
-			interfaceData := make(map[string]interface{})
-			for key, value := range transformedData {
-				if value.S != nil {
-					interfaceData[key] = *value.S
-				} else if value.N != nil {
-					interfaceData[key] = *value.N
-				} else if value.BOOL != nil {
-					interfaceData[key] = *value.BOOL
-				}
-			}
-
 			// Send processed data to the channel
 			dataChannel <- interfaceData
 		}(item)
@@ -147,6 +158,86 @@ func (d DynamoDBSource) FetchData(req interfaces.Request) (interface{}, error) {
 	return processedData, nil
 }
 
+// FetchPage scans the source table req.PageSize items at a time. The token
+// is the scan's LastEvaluatedKey in JSON, where the next page starts.
+func (d DynamoDBSource) FetchPage(req interfaces.Request, token string) (interface{}, string, error) {
+	if err := validateDynamoDBRequest(req, true); err != nil {
+		return nil, "", err
+	}
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(req.DynamoDBSourceTable),
+		Limit:     aws.Int64(int64(req.PageSize)),
+	}
+	if token != "" {
+		if err := json.Unmarshal([]byte(token), &input.ExclusiveStartKey); err != nil {
+			return nil, "", interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid DynamoDB page token: %w", err))
+		}
+	}
+
+	// A replica holds the same keys, so the page resumes there from the same token
+	var result *dynamodb.ScanOutput
+	err := inRegions(req.DynamoDBSourceRegion, req.AWSFailoverRegions, func(region string) error {
+		if _, err := awsSession(region, req.AWSRoleARN, req.AWSExternalID); err != nil {
+			return err
+		}
+		// Mock DynamoDB client
+		mockDynamoDB := &MockDynamoDB{}
+		scanned, err := mockDynamoDB.Scan(input)
+		if err != nil {
+			return interfaces.Wrap(interfaces.ErrConnection, err)
+		}
+		result = scanned
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	records := make([]map[string]interface{}, 0, len(result.Items))
+	for _, item := range result.Items {
+		record, err := dynamoDBRecord(item)
+		if err != nil {
+			return nil, "", err
+		}
+		records = append(records, record)
+	}
+	logger.Infof("Page fetched from DynamoDB: %d items", len(records))
+
+	if len(result.LastEvaluatedKey) == 0 {
+		return records, "", nil
+	}
+	next, err := json.Marshal(result.LastEvaluatedKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode DynamoDB page token: %w", err)
+	}
+	return records, string(next), nil
+}
+
+// dynamoDBRecord validates and transforms a scanned item and converts it to a record
+func dynamoDBRecord(item map[string]*dynamodb.AttributeValue) (map[string]interface{}, error) {
+	// Validate data
+	validatedData, err := validateDynamoDBData(item)
+	if err != nil {
+		return nil, fmt.Errorf("validation failed for item: %v, Error: %s", item, err)
+	}
+
+	// Transform data
+	transformedData := transformDynamoDBData(validatedData)
+
+	// Convert transformed data (map[string]*dynamodb.AttributeValue) to map[string]interface{}
+	interfaceData := make(map[string]interface{})
+	for key, value := range transformedData {
+		if value.S != nil {
+			interfaceData[key] = *value.S
+		} else if value.N != nil {
+			interfaceData[key] = *value.N
+		} else if value.BOOL != nil {
+			interfaceData[key] = *value.BOOL
+		}
+	}
+	return interfaceData, nil
+}
+
 // SendData writes data to the target DynamoDB table in the specified region.
 func (d DynamoDBDestination) SendData(data interface{}, req interfaces.Request) error {
 	logger.Infof("Connecting to DynamoDB Destination: Table=%s, Region=%s", req.DynamoDBTargetTable, req.DynamoDBTargetRegion)
@@ -186,7 +277,14 @@ func (d DynamoDBDestination) SendData(data interface{}, req interfaces.Request)
 		Item:      item,
 	}
 
-	_, err = mockDynamoDB.PutItem(input)
+	// Global tables replicate a write to a replica back to the region
+	err = inRegions(req.DynamoDBTargetRegion, req.AWSFailoverRegions, func(region string) error {
+		if _, err := awsSession(region, req.AWSRoleARN, req.AWSExternalID); err != nil {
+			return err
+		}
+		_, err := mockDynamoDB.PutItem(input)
+		return err
+	})
 	if err != nil {
 		return err
 	}
@@ -221,7 +319,7 @@ func validateDynamoDBData(data map[string]*dynamodb.AttributeValue) (map[string]
 
 	// Example: Ensure a specific attribute exists and is not empty
 	if val, ok := data["KeyAttribute"]; !ok || val.S == nil || *val.S == "" {
-		return nil, errors.New("missing or empty KeyAttribute")
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing or empty KeyAttribute"))
 	}
 
 	return data, nil
@@ -243,14 +341,19 @@ func transformDynamoDBData(data map[string]*dynamodb.AttributeValue) map[string]
 func validateDynamoDBRequest(req interfaces.Request, isSource bool) error {
 	if isSource {
 		if req.DynamoDBSourceTable == "" || req.DynamoDBSourceRegion == "" {
-			return errors.New("missing source DynamoDB table or region")
-		}
-	} else {
-		if req.DynamoDBTargetTable == "" || req.DynamoDBTargetRegion == "" {
-			return errors.New("missing target DynamoDB table or region")
+			return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing source DynamoDB table or region"))
 		}
+		return validateFailoverRegions(req.DynamoDBSourceRegion, req.AWSFailoverRegions)
 	}
-	return nil
+	if req.DynamoDBTargetTable == "" || req.DynamoDBTargetRegion == "" {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing target DynamoDB table or region"))
+	}
+	return validateFailoverRegions(req.DynamoDBTargetRegion, req.AWSFailoverRegions)
+}
+
+// Location returns the table the records are read from
+func (d DynamoDBSource) Location(req interfaces.Request) string {
+	return req.DynamoDBSourceTable
 }
 
 // Register DynamoDB source and destination
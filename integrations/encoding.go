@@ -0,0 +1,145 @@
+package integrations
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// Character encodings file integrations read and write. Records are UTF-8
+// inside the pipeline.
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingUTF16       = "utf-16"
+	EncodingUTF16LE     = "utf-16le"
+	EncodingUTF16BE     = "utf-16be"
+	EncodingLatin1      = "latin-1"
+	EncodingWindows1252 = "windows-1252"
+)
+
+// encodingAliases maps the other names an encoding goes by to the one above
+var encodingAliases = map[string]string{
+	"utf8":       EncodingUTF8,
+	"utf16":      EncodingUTF16,
+	"latin1":     EncodingLatin1,
+	"iso-8859-1": EncodingLatin1,
+	"iso8859-1":  EncodingLatin1,
+	"cp1252":     EncodingWindows1252,
+}
+
+// textEncoding returns the named encoding. UTF-16 without an endianness
+// writes a byte order mark unless bom is false, as when appending, and reads
+// little endian unless a mark says otherwise.
+func textEncoding(name string, bom bool) (encoding.Encoding, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := encodingAliases[name]; ok {
+		name = alias
+	}
+	switch name {
+	case "", EncodingUTF8:
+		return encoding.Nop, nil
+	case EncodingUTF16:
+		if !bom {
+			return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), nil
+		}
+		return unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), nil
+	case EncodingUTF16LE:
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), nil
+	case EncodingUTF16BE:
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), nil
+	case EncodingLatin1:
+		return charmap.ISO8859_1, nil
+	case EncodingWindows1252:
+		return charmap.Windows1252, nil
+	}
+	return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("unknown encoding %q: expected %s, %s, %s, %s, %s or %s",
+		name, EncodingUTF8, EncodingUTF16, EncodingUTF16LE, EncodingUTF16BE, EncodingLatin1, EncodingWindows1252))
+}
+
+// validateEncoding checks an optional Encoding setting names a supported encoding
+func validateEncoding(name string) error {
+	_, err := textEncoding(name, true)
+	return err
+}
+
+// decodedReader closes the file under the decoder
+type decodedReader struct {
+	io.Reader
+	file io.Closer
+}
+
+func (r *decodedReader) Close() error {
+	return r.file.Close()
+}
+
+// openTextFile opens a source file like openSourceFile and decodes it to
+// UTF-8 as it is read. A byte order mark is stripped, and a UTF-8 or UTF-16
+// one overrides the configured encoding, as it cannot be wrong.
+func openTextFile(path, compression, encodingName string) (io.ReadCloser, error) {
+	enc, err := textEncoding(encodingName, true)
+	if err != nil {
+		return nil, err
+	}
+	file, err := openSourceFile(path, compression)
+	if err != nil {
+		return nil, err
+	}
+	return &decodedReader{Reader: transform.NewReader(file, unicode.BOMOverride(enc.NewDecoder())), file: file}, nil
+}
+
+// encodedWriter flushes the encoder before closing the file under it
+type encodedWriter struct {
+	writer *transform.Writer
+	file   io.WriteCloser
+	name   string
+}
+
+func (w *encodedWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	if errors.Is(err, encoding.ErrInvalidUTF8) || isUnsupportedRune(err) {
+		err = fmt.Errorf("failed to encode the output as %s: %w", w.name, err)
+	}
+	return n, err
+}
+
+func (w *encodedWriter) Close() error {
+	if err := w.writer.Close(); err != nil {
+		w.file.Close()
+		return fmt.Errorf("failed to encode the output as %s: %w", w.name, err)
+	}
+	return w.file.Close()
+}
+
+// isUnsupportedRune reports whether err is a character the encoding has no
+// byte for, such as € in Latin-1
+func isUnsupportedRune(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "rune not supported by encoding")
+}
+
+// openEncodedFile opens a destination file like openDestinationFile and
+// encodes what is written to it from UTF-8. A character the encoding cannot
+// hold fails the write rather than being replaced.
+func openEncodedFile(path, compression, encodingName string, flags int) (io.WriteCloser, error) {
+	enc, err := textEncoding(encodingName, flags&os.O_APPEND == 0)
+	if err != nil {
+		return nil, err
+	}
+	file, err := openDestinationFile(path, compression, flags)
+	if err != nil || enc == encoding.Nop {
+		return file, err
+	}
+	return &encodedWriter{writer: transform.NewWriter(file, enc.NewEncoder()), file: file, name: strings.ToLower(strings.TrimSpace(encodingName))}, nil
+}
+
+// createEncodedFile creates or truncates a file for writing, encoding and compressing what is written to it
+func createEncodedFile(path, compression, encodingName string) (io.WriteCloser, error) {
+	return openEncodedFile(path, compression, encodingName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC)
+}
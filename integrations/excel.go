@@ -0,0 +1,412 @@
+package integrations
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+	"github.com/SkySingh04/fractal/pipeline"
+	"github.com/SkySingh04/fractal/registry"
+	"github.com/xuri/excelize/v2"
+)
+
+// DefaultExcelSheet is the sheet the Excel destination writes when none is given
+const DefaultExcelSheet = "Sheet1"
+
+// ExcelSource struct represents the configuration for reading records from an Excel workbook.
+type ExcelSource struct {
+	ExcelSourceFileName string `json:"excel_source_file_name" fractal:"required"`
+	ExcelSourceSheet    string `json:"excel_source_sheet"`
+}
+
+// ExcelDestination struct represents the configuration for writing records to an Excel workbook.
+type ExcelDestination struct {
+	ExcelDestinationFileName string `json:"excel_destination_file_name" fractal:"required"`
+	ExcelDestinationSheet    string `json:"excel_destination_sheet"`
+}
+
+// excelDateFormats are the built-in number formats that display a date or time
+var excelDateFormats = map[int]bool{
+	14: true, 15: true, 16: true, 17: true, 18: true, 19: true, 20: true, 21: true, 22: true,
+	27: true, 28: true, 29: true, 30: true, 31: true, 32: true, 33: true, 34: true, 35: true, 36: true,
+	45: true, 46: true, 47: true,
+	50: true, 51: true, 52: true, 53: true, 54: true, 55: true, 56: true, 57: true, 58: true,
+}
+
+// FetchData reads a sheet of the workbook. The first non-empty row names the
+// fields, merged cells take the value of their top-left cell, and numbers
+// formatted as dates are read as timestamps. Rows holding a formula whose
+// value cannot be worked out are quarantined.
+func (s ExcelSource) FetchData(req interfaces.Request) (interface{}, error) {
+	if req.ExcelSourceFileName == "" {
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing Excel source file name"))
+	}
+	logger.Infof("Reading data from Excel Source: %s", req.ExcelSourceFileName)
+
+	book, err := excelize.OpenFile(req.ExcelSourceFileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Excel file %s: %w", req.ExcelSourceFileName, err)
+	}
+	defer book.Close()
+
+	sheet, err := excelSheet(book, req.ExcelSourceSheet)
+	if err != nil {
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	reader, err := newExcelReader(book, sheet)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := reader.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sheet %s of %s: %w", sheet, req.ExcelSourceFileName, err)
+	}
+	logger.Infof("Read %d records from sheet %s, %d rows rejected", len(rows.Records), sheet, len(rows.Rejected))
+	return rows, nil
+}
+
+// Location returns the workbook the records are read from
+func (s ExcelSource) Location(req interfaces.Request) string {
+	return req.ExcelSourceFileName
+}
+
+// excelSheet picks the sheet by name, or else by its position counting from
+// 1. No sheet means the first one.
+func excelSheet(book *excelize.File, sheet string) (string, error) {
+	sheets := book.GetSheetList()
+	if len(sheets) == 0 {
+		return "", errors.New("the workbook has no sheets")
+	}
+	if sheet == "" {
+		return sheets[0], nil
+	}
+	for _, name := range sheets {
+		if name == sheet {
+			return name, nil
+		}
+	}
+	if index, err := strconv.Atoi(sheet); err == nil && index >= 1 && index <= len(sheets) {
+		return sheets[index-1], nil
+	}
+	return "", fmt.Errorf("excel sheet %q not found, the workbook has %s", sheet, strings.Join(sheets, ", "))
+}
+
+// excelReader turns the cells of a sheet into records
+type excelReader struct {
+	book     *excelize.File
+	sheet    string
+	date1904 bool
+	merged   map[string]string // Top-left cell of a merged range, by its other cells
+	dates    map[int]bool      // Whether a style displays dates, by style ID
+}
+
+func newExcelReader(book *excelize.File, sheet string) (*excelReader, error) {
+	r := &excelReader{book: book, sheet: sheet, merged: map[string]string{}, dates: map[int]bool{}}
+	if props, err := book.GetWorkbookProps(); err == nil && props.Date1904 != nil {
+		r.date1904 = *props.Date1904
+	}
+	merges, err := book.GetMergeCells(sheet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the merged cells of sheet %s: %w", sheet, err)
+	}
+	for _, merge := range merges {
+		startCol, startRow, err := excelize.CellNameToCoordinates(merge.GetStartAxis())
+		if err != nil {
+			return nil, err
+		}
+		endCol, endRow, err := excelize.CellNameToCoordinates(merge.GetEndAxis())
+		if err != nil {
+			return nil, err
+		}
+		for row := startRow; row <= endRow; row++ {
+			for col := startCol; col <= endCol; col++ {
+				if row == startRow && col == startCol {
+					continue
+				}
+				cell, _ := excelize.CoordinatesToCellName(col, row)
+				r.merged[cell] = merge.GetStartAxis()
+			}
+		}
+	}
+	return r, nil
+}
+
+// read returns the records of the sheet, along with the rows it could not read
+func (r *excelReader) read() (*pipeline.SourceRows, error) {
+	rows, err := r.book.GetRows(r.sheet, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, err
+	}
+	width := 0
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+
+	result := &pipeline.SourceRows{}
+	headerRow := -1
+	for i := range rows {
+		empty := true
+		for col := 1; col <= width && empty; col++ {
+			cell, _ := excelize.CoordinatesToCellName(col, i+1)
+			value, err := r.raw(cell)
+			if err != nil {
+				return nil, err
+			}
+			empty = value == ""
+		}
+		if empty {
+			continue
+		}
+		if headerRow < 0 {
+			headerRow = i
+			for col := 1; col <= width; col++ {
+				cell, _ := excelize.CoordinatesToCellName(col, i+1)
+				name, err := r.raw(cell)
+				if err != nil {
+					return nil, err
+				}
+				if name = strings.TrimSpace(name); name == "" {
+					name = fmt.Sprintf("column%d", col)
+				}
+				result.Columns = append(result.Columns, name)
+			}
+			continue
+		}
+
+		rec := make(map[string]interface{}, len(result.Columns))
+		var problems []string
+		for col, name := range result.Columns {
+			cell, _ := excelize.CoordinatesToCellName(col+1, i+1)
+			value, err := r.value(cell)
+			if err != nil {
+				problems = append(problems, err.Error())
+			}
+			rec[name] = value
+		}
+		if len(problems) > 0 {
+			result.Rejected = append(result.Rejected, pipeline.SourceReject{
+				Row:    rec,
+				Reason: fmt.Sprintf("row %d: %s", i+1, strings.Join(problems, "; ")),
+				Before: len(result.Records),
+			})
+			continue
+		}
+		result.Records = append(result.Records, rec)
+	}
+	return result, nil
+}
+
+// source returns the cell whose value a cell shows, the top-left cell of a merged range
+func (r *excelReader) source(cell string) string {
+	if start, ok := r.merged[cell]; ok {
+		return start
+	}
+	return cell
+}
+
+// raw returns the stored value of a cell
+func (r *excelReader) raw(cell string) (string, error) {
+	return r.book.GetCellValue(r.sheet, r.source(cell), excelize.Options{RawCellValue: true})
+}
+
+// value reads a cell as a record value: empty cells are null, numbers are
+// integers or floats, dates are timestamps and booleans are bools. A formula
+// without a stored result is worked out, and one that cannot be, or whose
+// result is an error, fails the cell.
+func (r *excelReader) value(cell string) (interface{}, error) {
+	cell = r.source(cell)
+	cellType, err := r.book.GetCellType(r.sheet, cell)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := r.raw(cell)
+	if err != nil {
+		return nil, err
+	}
+	formula, err := r.book.GetCellFormula(r.sheet, cell)
+	if err != nil {
+		return nil, err
+	}
+	if formula != "" && raw == "" {
+		if raw, err = r.book.CalcCellValue(r.sheet, cell, excelize.Options{RawCellValue: true}); err != nil {
+			return nil, fmt.Errorf("cell %s: cannot compute formula =%s: %v", cell, formula, err)
+		}
+		cellType = excelize.CellTypeUnset
+	}
+	if strings.HasPrefix(raw, "#") && (cellType == excelize.CellTypeError || formula != "") {
+		return nil, fmt.Errorf("cell %s holds the error %s", cell, raw)
+	}
+
+	switch cellType {
+	case excelize.CellTypeBool:
+		return raw == "1" || strings.EqualFold(raw, "true"), nil
+	case excelize.CellTypeSharedString, excelize.CellTypeInlineString, excelize.CellTypeFormula:
+		if raw == "" {
+			return nil, nil
+		}
+		return raw, nil
+	case excelize.CellTypeDate:
+		if t, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+			return t, nil
+		}
+	}
+	if raw == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return raw, nil
+	}
+	isDate, err := r.isDate(cell)
+	if err != nil {
+		return nil, err
+	}
+	if isDate {
+		t, err := excelize.ExcelDateToTime(n, r.date1904)
+		if err != nil {
+			return nil, fmt.Errorf("cell %s: %v", cell, err)
+		}
+		return t, nil
+	}
+	if n == math.Trunc(n) && math.Abs(n) < 1<<53 {
+		return int64(n), nil
+	}
+	return n, nil
+}
+
+// isDate reports whether the number format of a cell displays a date or time
+func (r *excelReader) isDate(cell string) (bool, error) {
+	styleID, err := r.book.GetCellStyle(r.sheet, cell)
+	if err != nil {
+		return false, err
+	}
+	if isDate, ok := r.dates[styleID]; ok {
+		return isDate, nil
+	}
+	isDate := false
+	if style, err := r.book.GetStyle(styleID); err == nil {
+		isDate = excelDateFormats[style.NumFmt]
+		if style.CustomNumFmt != nil {
+			isDate = isDateFormatCode(*style.CustomNumFmt)
+		}
+	}
+	r.dates[styleID] = isDate
+	return isDate, nil
+}
+
+// isDateFormatCode reports whether a custom number format shows a date or
+// time part, leaving out quoted text, escaped characters and bracketed
+// sections such as colours
+func isDateFormatCode(code string) bool {
+	quoted, bracket := false, false
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '\\':
+			i++
+		case c == '[':
+			bracket = true
+		case c == ']':
+			bracket = false
+		case bracket:
+		case strings.IndexByte("yYmMdDhHsS", c) >= 0:
+			return true
+		}
+	}
+	return false
+}
+
+// SendData writes the records to one sheet of a new workbook, replacing the
+// file. The first row names the fields, in the order CSV output uses.
+// Timestamps are written as dates.
+func (d ExcelDestination) SendData(data interface{}, req interfaces.Request) error {
+	if req.ExcelDestinationFileName == "" {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing Excel destination file name"))
+	}
+	dataset := pipeline.NewDataset(data)
+	if !dataset.Structured() {
+		return fmt.Errorf("unsupported data type for the Excel destination: %T", data)
+	}
+	sheet := req.ExcelDestinationSheet
+	if sheet == "" {
+		sheet = DefaultExcelSheet
+	}
+
+	book := excelize.NewFile()
+	defer book.Close()
+	if err := book.SetSheetName(book.GetSheetName(0), sheet); err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid Excel sheet name %q: %w", sheet, err))
+	}
+	dateStyle, err := book.NewStyle(&excelize.Style{NumFmt: 22})
+	if err != nil {
+		return err
+	}
+	writer, err := book.NewStreamWriter(sheet)
+	if err != nil {
+		return err
+	}
+
+	columns := dataset.OutputColumns()
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = column
+	}
+	if err := writer.SetRow("A1", header); err != nil {
+		return err
+	}
+	for i, rec := range dataset.Records {
+		row := make([]interface{}, len(columns))
+		for j, column := range columns {
+			switch v := rec[column].(type) {
+			case nil:
+			case time.Time:
+				row[j] = excelize.Cell{StyleID: dateStyle, Value: v}
+			case string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+				row[j] = v
+			default:
+				row[j] = fmt.Sprint(v)
+			}
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		if err := writer.SetRow(cell, row); err != nil {
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	file, err := os.Create(req.ExcelDestinationFileName)
+	if err != nil {
+		return fmt.Errorf("failed to create Excel file %s: %w", req.ExcelDestinationFileName, err)
+	}
+	defer file.Close()
+	if err := book.Write(file); err != nil {
+		return fmt.Errorf("failed to write Excel file %s: %w", req.ExcelDestinationFileName, err)
+	}
+	reportOutput(req, req.ExcelDestinationFileName, len(dataset.Records), false)
+	logger.Infof("Wrote %d records to sheet %s of %s", len(dataset.Records), sheet, req.ExcelDestinationFileName)
+	return nil
+}
+
+// OutputDir returns the directory the Excel file is written to
+func (d ExcelDestination) OutputDir(req interfaces.Request) string {
+	return outputDir(req.ExcelDestinationFileName)
+}
+
+// Initialize the Excel integrations by registering them with the registry.
+func init() {
+	registry.RegisterSource("Excel", ExcelSource{})
+	registry.RegisterDestination("Excel", ExcelDestination{})
+}
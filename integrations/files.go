@@ -0,0 +1,147 @@
+package integrations
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/pipeline"
+)
+
+// DefaultSourceFileField holds the file each record was read from when a
+// file source reads a glob pattern or a directory
+const DefaultSourceFileField = "_source_file"
+
+// sourceFiles lists the files a file source reads. A glob pattern matches
+// files, a directory holds files with one of the extensions, also in its
+// subdirectories when recursive is set, compressed or not, and anything else
+// is a single file. A zip or tar archive, given or matched by a pattern,
+// stands for its entries matching entries, or with one of the extensions
+// when entries is empty, named like drop.zip!orders.csv.
+// The matches are sorted, multiple reports whether the path could name more
+// than one file, and an empty match is an error.
+func sourceFiles(path string, recursive bool, entries string, extensions ...string) (files []string, multiple bool, err error) {
+	if strings.ContainsAny(path, "*?[") {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, true, fmt.Errorf("invalid file pattern %q: %w", path, err)
+		}
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && !info.IsDir() {
+				files = append(files, match)
+			}
+		}
+		if len(files) == 0 {
+			return nil, true, fmt.Errorf("no files match %s", path)
+		}
+		sort.Strings(files)
+		var expanded []string
+		for _, file := range files {
+			if kind, _ := archiveKind(file); kind == "" {
+				expanded = append(expanded, file)
+				continue
+			}
+			archived, err := archiveEntries(file, entries, extensions)
+			if err != nil {
+				return nil, true, err
+			}
+			expanded = append(expanded, archived...)
+		}
+		return expanded, true, nil
+	}
+
+	if kind, _ := archiveKind(path); kind != "" {
+		files, err := archiveEntries(path, entries, extensions)
+		return files, true, err
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		// Opening the file reports a missing one
+		return []string{path}, false, nil
+	}
+	err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if file != path && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		for _, ext := range extensions {
+			if strings.EqualFold(filepath.Ext(trimCompressionExtension(file)), ext) {
+				files = append(files, file)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to list %s: %w", path, err)
+	}
+	if len(files) == 0 {
+		return nil, true, fmt.Errorf("no %s files in %s", strings.Join(extensions, " or "), path)
+	}
+	sort.Strings(files)
+	return files, true, nil
+}
+
+// outputIndexPlaceholder in a destination file name is replaced by the index of the file written
+const outputIndexPlaceholder = "{index}"
+
+// outputFile returns the file a batch is written to. The index replaces the
+// placeholder, zero padded so the files sort in order. Per-batch and sized
+// output without a placeholder get the index before the extension, such as
+// data-00002.csv.gz for data.csv.gz.
+func outputFile(base string, req interfaces.Request) string {
+	if base == StdoutPath {
+		return base
+	}
+	index := fmt.Sprintf("%05d", req.OutputPart)
+	if strings.Contains(base, outputIndexPlaceholder) {
+		return strings.ReplaceAll(base, outputIndexPlaceholder, index)
+	}
+	switch strings.ToLower(strings.TrimSpace(req.OutputMode)) {
+	case pipeline.OutputPerBatch, pipeline.OutputSized:
+		trimmed := trimCompressionExtension(base)
+		ext := filepath.Ext(trimmed)
+		return strings.TrimSuffix(trimmed, ext) + "-" + index + ext + base[len(trimmed):]
+	}
+	return base
+}
+
+// outputDir returns the directory the files written to base go to, the
+// parent of the partition directories when the output is partitioned
+func outputDir(base string) string {
+	if base == "" || base == StdoutPath {
+		return ""
+	}
+	return filepath.Dir(base)
+}
+
+// reportOutput tells the pipeline, when it asked, that records were written to the file at path
+func reportOutput(req interfaces.Request, path string, records int, appended bool) {
+	if req.OutputWritten != nil && path != StdoutPath {
+		req.OutputWritten(path, records, appended)
+	}
+}
+
+// reportData reports the file at path as holding the records in data
+func reportData(req interfaces.Request, path string, data interface{}) {
+	if req.OutputWritten != nil {
+		reportOutput(req, path, len(pipeline.NewDataset(data).Records), false)
+	}
+}
+
+// sourceFileField names the field records are tagged with, or "" when they are not tagged
+func sourceFileField(field string, multiple bool) string {
+	if field == "" && multiple {
+		return DefaultSourceFileField
+	}
+	return field
+}
@@ -36,7 +36,7 @@ func (f FirebaseSource) FetchData(req interfaces.Request) (interface{}, error) {
 	opt := option.WithCredentialsFile(req.CredentialFileAddr)
 	app, err := firebase.NewApp(context.Background(), nil, opt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize Firebase app: %w", err)
+		return nil, interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to initialize Firebase app: %w", err))
 	}
 
 	client, err := app.Firestore(context.Background())
@@ -77,7 +77,7 @@ func (f FirebaseDestination) SendData(data interface{}, req interfaces.Request)
 	opt := option.WithCredentialsFile(req.CredentialFileAddr)
 	app, err := firebase.NewApp(context.Background(), nil, opt)
 	if err != nil {
-		return fmt.Errorf("failed to initialize Firebase app: %w", err)
+		return interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to initialize Firebase app: %w", err))
 	}
 
 	client, err := app.Firestore(context.Background())
@@ -147,6 +147,11 @@ func transformFirebaseData(data map[string]interface{}) map[string]interface{} {
 	return data
 }
 
+// Location returns the collection the records are read from
+func (f FirebaseSource) Location(req interfaces.Request) string {
+	return req.Collection
+}
+
 func init() {
 	registry.RegisterSource("Firebase", FirebaseSource{})
 	registry.RegisterDestination("Firebase", FirebaseDestination{})
@@ -16,21 +16,27 @@ import (
 
 // FTPSource implements the DataSource interface
 type FTPSource struct {
-	URL         string `json:"url"`
-	User        string `json:"user"`
-	Password    string `json:"password"`
-	FTPFILEPATH string `json:"file_path"`
+	URL               string `json:"url" fractal:"required"`
+	User              string `json:"user" fractal:"required"`
+	Password          string `json:"password" secret:"true" fractal:"required"`
+	FTPFILEPATH       string `json:"file_path" fractal:"required"`
+	Format            string `json:"format"`
+	ChunkSize         int    `json:"chunk_size"`
+	ChunkRetries      int    `json:"chunk_retries"`
+	ChunkRetryBackoff string `json:"chunk_retry_backoff"`
 }
 
 // FTPDestination implements the DataDestination interface
 type FTPDestination struct {
-	URL         string `json:"url"`
-	User        string `json:"user"`
-	Password    string `json:"password"`
-	FTPFILEPATH string `json:"file_path"`
+	URL         string `json:"url" fractal:"required"`
+	User        string `json:"user" fractal:"required"`
+	Password    string `json:"password" secret:"true" fractal:"required"`
+	FTPFILEPATH string `json:"file_path" fractal:"required"`
+	Format      string `json:"format"`
 }
 
-// FetchData fetches data from an FTP server
+// FetchData fetches a file from an FTP server, decoded into records when a
+// format is set and as bytes otherwise
 func (f FTPSource) FetchData(req interfaces.Request) (interface{}, error) {
 	if err := validateFTPRequest(req, true); err != nil {
 		return nil, err
@@ -43,6 +49,19 @@ func (f FTPSource) FetchData(req interfaces.Request) (interface{}, error) {
 	}
 	defer conn.Quit()
 
+	if req.ChunkSize > 0 {
+		logger.Infof("Downloading file from FTP in chunks of %d bytes: %s", req.ChunkSize, req.FTPFILEPATH)
+		data, err := fetchFTPChunks(conn, req)
+		if err != nil {
+			return nil, err
+		}
+		logger.Infof("Successfully fetched data from FTP.")
+		if req.Format != "" {
+			return decodeRecords(req.Format, data)
+		}
+		return data, nil
+	}
+
 	logger.Infof("Downloading file from FTP: %s", req.FTPFILEPATH)
 	resp, err := conn.Retr(req.FTPFILEPATH)
 	if err != nil {
@@ -56,10 +75,13 @@ func (f FTPSource) FetchData(req interfaces.Request) (interface{}, error) {
 	}
 
 	logger.Infof("Successfully fetched data from FTP.")
+	if req.Format != "" {
+		return decodeRecords(req.Format, data)
+	}
 	return data, nil
 }
 
-// SendData sends data to an FTP server
+// SendData sends data to an FTP server, encoding records in the format when one is set
 func (f FTPDestination) SendData(data interface{}, req interfaces.Request) error {
 	if err := validateFTPRequest(req, false); err != nil {
 		return err
@@ -73,9 +95,9 @@ func (f FTPDestination) SendData(data interface{}, req interfaces.Request) error
 	defer conn.Quit()
 
 	logger.Infof("Uploading file to FTP: %s", req.FTPFILEPATH)
-	dataBytes, ok := data.([]byte)
-	if !ok {
-		return fmt.Errorf("invalid data format; expected []byte, got %T", data)
+	dataBytes, err := transportBytes(req.Format, data)
+	if err != nil {
+		return err
 	}
 
 	err = conn.Stor(req.FTPFILEPATH, bytes.NewReader(dataBytes))
@@ -87,6 +109,59 @@ func (f FTPDestination) SendData(data interface{}, req interfaces.Request) error
 	return nil
 }
 
+// fetchFTPChunks downloads the file a chunk at a time. FTP has no ranged
+// reads, so a single transfer streams the chunks, and a failed read opens a
+// new connection that restarts the transfer at the byte it stopped at.
+func fetchFTPChunks(conn *ftp.ServerConn, req interfaces.Request) ([]byte, error) {
+	path := req.FTPFILEPATH
+	size, err := conn.FileSize(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the size of %s on FTP: %w", path, err)
+	}
+
+	current := conn
+	var resp *ftp.Response
+	var pos int64
+	defer func() {
+		if resp != nil {
+			resp.Close()
+		}
+		// The caller quits the connection it opened
+		if current != nil && current != conn {
+			current.Quit()
+		}
+	}()
+	return ReadChunks(path, size, req, func(offset int64, buf []byte, retry bool) (int, error) {
+		if retry {
+			// Quit first, so closing the transfer doesn't wait on a dead connection
+			if current != nil {
+				current.Quit()
+			}
+			if resp != nil {
+				resp.Close()
+				resp = nil
+			}
+			var err error
+			if current, err = dialFTP(req.FTPURL, req.FTPUser, req.FTPPassword); err != nil {
+				return 0, err
+			}
+		}
+		if resp == nil || pos != offset {
+			if resp != nil {
+				resp.Close()
+			}
+			var err error
+			if resp, err = current.RetrFrom(path, uint64(offset)); err != nil {
+				return 0, fmt.Errorf("failed to retrieve file from FTP: %w", err)
+			}
+			pos = offset
+		}
+		n, err := io.ReadFull(resp, buf)
+		pos += int64(n)
+		return n, err
+	})
+}
+
 // dialFTP creates and authenticates an FTP connection
 func dialFTP(url, user, password string) (*ftp.ServerConn, error) {
 	// Remove "ftp://" prefix if present
@@ -94,12 +169,12 @@ func dialFTP(url, user, password string) (*ftp.ServerConn, error) {
 
 	conn, err := ftp.Dial(url, ftp.DialWithTimeout(10*time.Second))
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to FTP server: %w", err)
+		return nil, interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to connect to FTP server: %w", err))
 	}
 
 	err = conn.Login(user, password)
 	if err != nil {
-		return nil, fmt.Errorf("failed to authenticate with FTP server: %w", err)
+		return nil, interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to authenticate with FTP server: %w", err))
 	}
 	return conn, nil
 }
@@ -120,19 +195,24 @@ var (
 // validateFTPRequest validates the request fields for FTP
 func validateFTPRequest(req interfaces.Request, isSource bool) error {
 	if req.FTPURL == "" {
-		return errors.New("missing FTP URL")
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing FTP URL"))
 	}
 	if req.FTPUser == "" {
-		return errors.New("missing FTP user")
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing FTP user"))
 	}
 	if req.FTPPassword == "" {
-		return errors.New("missing FTP password")
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing FTP password"))
 	}
 	if req.FTPFILEPATH == "" {
-		return errors.New("missing file path")
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing file path"))
 	}
 	if !strings.HasPrefix(req.FTPURL, "ftp://") {
-		return fmt.Errorf("invalid FTP URL: %s", req.FTPURL)
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid FTP URL: %s", req.FTPURL))
 	}
-	return nil
+	if isSource {
+		if err := validateChunks(req); err != nil {
+			return err
+		}
+	}
+	return validateFormat(req.Format)
 }
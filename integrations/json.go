@@ -3,7 +3,6 @@ package integrations
 import (
 	"encoding/json"
 	"errors"
-	"os"
 	"reflect"
 
 	"github.com/SkySingh04/fractal/interfaces"
@@ -12,30 +11,34 @@ import (
 )
 
 type JSONSource struct {
-	Data string `json:"json_source_data"`
+	Data string `json:"json_source_data" fractal:"required"`
 }
 
 type JSONDestination struct {
-	Filename string `json:"json_output_filename"`
+	Filename            string   `json:"json_output_filename" fractal:"required"`
+	PartitionBy         []string `json:"partition_by"`
+	PartitionEmptyValue string   `json:"partition_empty_value"`
+	Compression         string   `json:"compression" fractal:"enum=gzip|zstd|none"`
+	Encoding            string   `json:"encoding" fractal:"enum=utf-8|utf-16|utf-16le|utf-16be|latin-1|windows-1252"`
 }
 
 // FetchData retrieves and processes JSON source data
 func (j JSONSource) FetchData(req interfaces.Request) (interface{}, error) {
 	if req.JSONSourceData == "" {
-		return nil, errors.New("missing JSON source data")
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing JSON source data"))
 	}
 
 	// Validate and sanitize JSON data
 	validatedData, err := ValidateJSONData(req.JSONSourceData)
 	if err != nil {
-		logger.Fatalf("Validation error: %v", err)
+		logger.Errorf("Validation error: %v", err)
 		return nil, err
 	}
 
 	// Transform JSON data
 	transformedData, err := transformJSONData(validatedData)
 	if err != nil {
-		logger.Fatalf("Transformation error: %v", err)
+		logger.Errorf("Transformation error: %v", err)
 		return nil, err
 	}
 
@@ -45,23 +48,63 @@ func (j JSONSource) FetchData(req interfaces.Request) (interface{}, error) {
 // SendData writes JSON data to a destination file
 func (j JSONDestination) SendData(data interface{}, req interfaces.Request) error {
 	if req.JSONOutputFilename == "" {
-		return errors.New("missing JSON destination filename")
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing JSON destination filename"))
 	}
 
 	logger.Infof("Sending data to JSON destination...")
 	logger.Infof("Data: %v", data)
 
+	if len(req.PartitionBy) > 0 {
+		p := partitioning{By: req.PartitionBy, EmptyValue: req.PartitionEmptyValue}
+		return writeGroupedPartitions(req.JSONOutputFilename, data, p, func(path string, records []interface{}) error {
+			if err := writeJSONFile(path, req.Compression, req.Encoding, records); err != nil {
+				return err
+			}
+			reportOutput(req, path, len(records), false)
+			return nil
+		})
+	}
+
 	// Write data to a JSON file
-	err := writeJSONFile(req.JSONOutputFilename, data)
+	err := writeJSONFile(req.JSONOutputFilename, req.Compression, req.Encoding, data)
 	if err != nil {
-		logger.Fatalf("Error writing data to JSON file: %v", err)
+		logger.Errorf("Error writing data to JSON file: %v", err)
 		return err
 	}
 
+	reportData(req, req.JSONOutputFilename, data)
 	logger.Infof("Data successfully written to %s", req.JSONOutputFilename)
 	return nil
 }
 
+// OutputDir returns the directory the JSON files are written to
+func (j JSONDestination) OutputDir(req interfaces.Request) string {
+	return outputDir(req.JSONOutputFilename)
+}
+
+// Target returns the JSON file the records are written to
+func (j JSONDestination) Target(req interfaces.Request) string {
+	return req.JSONOutputFilename
+}
+
+// WithTarget returns the request writing to the JSON file at path
+func (j JSONDestination) WithTarget(req interfaces.Request, path string) interfaces.Request {
+	req.JSONOutputFilename = path
+	return req
+}
+
+// ValidateConfig checks that the destination can write the configured
+// compression, and that standard output is not partitioned
+func (j JSONDestination) ValidateConfig(req interfaces.Request) error {
+	if err := validateStdoutOutput(req.JSONOutputFilename, req); err != nil {
+		return err
+	}
+	if err := validateEncoding(req.Encoding); err != nil {
+		return err
+	}
+	return validateCompression(req.Compression, req.JSONOutputFilename, true)
+}
+
 func init() {
 	registry.RegisterSource("JSON", JSONSource{})
 	registry.RegisterDestination("JSON", JSONDestination{})
@@ -108,21 +151,22 @@ func sanitizeJSONData(data interface{}) interface{} {
 	}
 }
 
-// writeJSONFile writes the provided data to a JSON file with proper formatting
-func writeJSONFile(filename string, data interface{}) error {
-	file, err := os.Create(filename)
+// writeJSONFile writes the provided data to a JSON file with proper
+// formatting, encoding and compressing it as configured
+func writeJSONFile(filename, compression, encodingName string, data interface{}) error {
+	file, err := createEncodedFile(filename, compression, encodingName)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
 	encoder := json.NewEncoder(file)
 	encoder.SetIndent("", "  ")
 	if err := encoder.Encode(data); err != nil {
+		file.Close()
 		return err
 	}
 
-	return nil
+	return file.Close()
 }
 
 // transformJSONData applies transformations to the JSON data
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/SkySingh04/fractal/interfaces"
 	"github.com/SkySingh04/fractal/logger"
@@ -13,16 +14,26 @@ import (
 	"github.com/segmentio/kafka-go"
 )
 
+// kafkaGroupID is the consumer group the Kafka source reads as
+const kafkaGroupID = "fractal-group"
+
+// Where the Kafka source starts reading a partition the group has no committed offset for
+const (
+	KafkaStartEarliest = "earliest"
+	KafkaStartLatest   = "latest"
+)
+
 // KafkaSource struct represents the configuration for consuming messages from Kafka.
 type KafkaSource struct {
-	URL   string `json:"consumer_url"`
-	Topic string `json:"consumer_topic"`
+	URL         string `json:"consumer_url" fractal:"required"`
+	Topic       string `json:"consumer_topic" fractal:"required"`
+	StartOffset string `json:"kafka_start_offset"`
 }
 
 // KafkaDestination struct represents the configuration for publishing messages to Kafka.
 type KafkaDestination struct {
-	URL   string `json:"producer_url"`
-	Topic string `json:"producer_topic"`
+	URL   string `json:"producer_url" fractal:"required"`
+	Topic string `json:"producer_topic" fractal:"required"`
 }
 
 // FetchData connects to Kafka, retrieves data, and processes it concurrently.
@@ -30,16 +41,28 @@ func (k KafkaSource) FetchData(req interfaces.Request) (interface{}, error) {
 	logger.Infof("Connecting to Kafka Source: URL=%s, Topic=%s", req.ConsumerURL, req.ConsumerTopic)
 
 	if req.ConsumerURL == "" || req.ConsumerTopic == "" {
-		return nil, errors.New("missing Kafka source details")
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing Kafka source details"))
+	}
+
+	startOffset, startAt, err := kafkaStartOffset(req.KafkaStartOffset)
+	if err != nil {
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	brokers := strings.Split(req.ConsumerURL, ",")
+	if !startAt.IsZero() {
+		if err := seedKafkaOffsets(context.Background(), brokers, req.ConsumerTopic, startAt); err != nil {
+			return nil, interfaces.Wrap(interfaces.ErrConnection, err)
+		}
 	}
 
-	// Create Kafka reader
+	// Create Kafka reader. StartOffset only applies to partitions the group has not committed an offset for.
 	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:  strings.Split(req.ConsumerURL, ","),
-		Topic:    req.ConsumerTopic,
-		GroupID:  "fractal-group", // Example: change as needed
-		MinBytes: 10e3,            // 10KB
-		MaxBytes: 10e6,            // 10MB
+		Brokers:     brokers,
+		Topic:       req.ConsumerTopic,
+		GroupID:     kafkaGroupID,
+		StartOffset: startOffset,
+		MinBytes:    10e3, // 10KB
+		MaxBytes:    10e6, // 10MB
 	})
 	defer reader.Close()
 
@@ -51,8 +74,9 @@ func (k KafkaSource) FetchData(req interfaces.Request) (interface{}, error) {
 		for {
 			message, err := reader.ReadMessage(context.Background())
 			if err != nil {
+				// The reader only fails once it is closed, so there is nothing more to read
 				logger.Errorf("Error reading message from Kafka: %v", err)
-				continue
+				return
 			}
 
 			logger.Infof("Message received from Kafka: %s", message.Value)
@@ -91,12 +115,113 @@ func (k KafkaSource) FetchData(req interfaces.Request) (interface{}, error) {
 	return result, nil
 }
 
+// ValidateConfig checks the start offset is earliest, latest or a timestamp
+func (k KafkaSource) ValidateConfig(req interfaces.Request) error {
+	if _, _, err := kafkaStartOffset(req.KafkaStartOffset); err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	return nil
+}
+
+// kafkaStartOffset reads the start offset setting: earliest (the default),
+// latest, or an RFC 3339 timestamp, returned as at
+func kafkaStartOffset(setting string) (offset int64, at time.Time, err error) {
+	switch strings.ToLower(strings.TrimSpace(setting)) {
+	case "", KafkaStartEarliest:
+		return kafka.FirstOffset, time.Time{}, nil
+	case KafkaStartLatest:
+		return kafka.LastOffset, time.Time{}, nil
+	}
+	at, err = time.Parse(time.RFC3339, strings.TrimSpace(setting))
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("invalid Kafka start offset %q: expected %s, %s or an RFC 3339 timestamp", setting, KafkaStartEarliest, KafkaStartLatest)
+	}
+	// Partitions without a message since then start at the end
+	return kafka.LastOffset, at, nil
+}
+
+// seedKafkaOffsets commits, for each partition of the topic the group has no
+// committed offset for, the first offset written at or after at, so the
+// reader starts there. Partitions with a committed offset resume from it.
+func seedKafkaOffsets(ctx context.Context, brokers []string, topic string, at time.Time) error {
+	client := &kafka.Client{Addr: kafka.TCP(brokers...)}
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return fmt.Errorf("failed to read the partitions of Kafka topic %s: %w", topic, err)
+	}
+	var partitions []int
+	for _, t := range metadata.Topics {
+		if t.Name != topic {
+			continue
+		}
+		if t.Error != nil {
+			return fmt.Errorf("failed to read the partitions of Kafka topic %s: %w", topic, t.Error)
+		}
+		for _, partition := range t.Partitions {
+			partitions = append(partitions, partition.ID)
+		}
+	}
+
+	committed, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{GroupID: kafkaGroupID, Topics: map[string][]int{topic: partitions}})
+	if err == nil {
+		err = committed.Error
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the committed offsets of Kafka group %s: %w", kafkaGroupID, err)
+	}
+	var requests []kafka.OffsetRequest
+	for _, partition := range committed.Topics[topic] {
+		if partition.CommittedOffset < 0 {
+			requests = append(requests, kafka.TimeOffsetOf(partition.Partition, at))
+		}
+	}
+	if len(requests) == 0 {
+		return nil
+	}
+
+	listed, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{topic: requests}})
+	if err != nil {
+		return fmt.Errorf("failed to look up Kafka offsets at %s: %w", at.Format(time.RFC3339), err)
+	}
+	var commits []kafka.OffsetCommit
+	for _, partition := range listed.Topics[topic] {
+		if partition.Error != nil {
+			return fmt.Errorf("failed to look up the offset of Kafka partition %d at %s: %w", partition.Partition, at.Format(time.RFC3339), partition.Error)
+		}
+		for offset := range partition.Offsets {
+			// -1 means nothing was written since, so the partition starts at the end
+			if offset >= 0 {
+				commits = append(commits, kafka.OffsetCommit{Partition: partition.Partition, Offset: offset})
+			}
+		}
+	}
+	if len(commits) == 0 {
+		return nil
+	}
+	// A group with no members yet takes commits outside of any generation
+	response, err := client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      kafkaGroupID,
+		GenerationID: -1,
+		Topics:       map[string][]kafka.OffsetCommit{topic: commits},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to commit the Kafka start offsets: %w", err)
+	}
+	for _, partition := range response.Topics[topic] {
+		if partition.Error != nil {
+			return fmt.Errorf("failed to commit the start offset of Kafka partition %d: %w", partition.Partition, partition.Error)
+		}
+	}
+	logger.Infof("Starting %d Kafka partition(s) of %s at %s", len(commits), topic, at.Format(time.RFC3339))
+	return nil
+}
+
 // SendData connects to Kafka and publishes data to the specified topic concurrently.
 func (k KafkaDestination) SendData(data interface{}, req interfaces.Request) error {
 	logger.Infof("Connecting to Kafka Destination: URL=%s, Topic=%s", req.ProducerURL, req.ProducerTopic)
 
 	if req.ProducerURL == "" || req.ProducerTopic == "" {
-		return errors.New("missing Kafka target details")
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing Kafka target details"))
 	}
 
 	// Create Kafka writer
@@ -149,6 +274,46 @@ func (k KafkaDestination) SendData(data interface{}, req interfaces.Request) err
 	return nil
 }
 
+// Ping checks a Kafka source broker accepts connections
+func (k KafkaSource) Ping(ctx context.Context, req interfaces.Request) error {
+	if req.ConsumerURL == "" {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing Kafka source URL"))
+	}
+	return pingKafka(ctx, req.ConsumerURL)
+}
+
+// Target returns the topic the messages are published to
+func (k KafkaDestination) Target(req interfaces.Request) string {
+	return req.ProducerTopic
+}
+
+// WithTarget returns the request publishing to topic
+func (k KafkaDestination) WithTarget(req interfaces.Request, topic string) interfaces.Request {
+	req.ProducerTopic = topic
+	return req
+}
+
+// Ping checks a Kafka destination broker accepts connections
+func (k KafkaDestination) Ping(ctx context.Context, req interfaces.Request) error {
+	if req.ProducerURL == "" {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing Kafka destination URL"))
+	}
+	return pingKafka(ctx, req.ProducerURL)
+}
+
+// pingKafka connects to the brokers in turn until one answers, as the clients do
+func pingKafka(ctx context.Context, brokers string) error {
+	var errs []error
+	for _, broker := range strings.Split(brokers, ",") {
+		conn, err := kafka.DialContext(ctx, "tcp", strings.TrimSpace(broker))
+		if err == nil {
+			return conn.Close()
+		}
+		errs = append(errs, err)
+	}
+	return interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to connect to Kafka: %w", errors.Join(errs...)))
+}
+
 // Initialize the Kafka integrations by registering them with the registry.
 func init() {
 	registry.RegisterSource("Kafka", KafkaSource{})
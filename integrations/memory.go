@@ -0,0 +1,135 @@
+package integrations
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+	"github.com/SkySingh04/fractal/pipeline"
+	"github.com/SkySingh04/fractal/registry"
+)
+
+// DefaultMemoryStore is the store the Memory integrations use when no name is given
+const DefaultMemoryStore = "default"
+
+// MemorySource struct represents the configuration for reading records from an in-process store.
+type MemorySource struct {
+	MemoryName string `json:"memory_name"`
+}
+
+// MemoryDestination struct represents the configuration for writing records to an in-process store.
+type MemoryDestination struct {
+	MemoryName string `json:"memory_name"`
+}
+
+// MemoryStore holds records in the process, so a pipeline can be run and
+// checked without a real backend. The Memory source reads a store and the
+// Memory destination appends to one.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records []pipeline.Record
+	batches int
+}
+
+// memoryStores holds the stores by name
+var memoryStores = struct {
+	sync.Mutex
+	stores map[string]*MemoryStore
+}{stores: map[string]*MemoryStore{}}
+
+// Memory returns the named store, creating it empty the first time. The empty
+// name is DefaultMemoryStore.
+func Memory(name string) *MemoryStore {
+	if name == "" {
+		name = DefaultMemoryStore
+	}
+	memoryStores.Lock()
+	defer memoryStores.Unlock()
+	store, ok := memoryStores.stores[name]
+	if !ok {
+		store = &MemoryStore{}
+		memoryStores.stores[name] = store
+	}
+	return store
+}
+
+// Load replaces the records of the store
+func (m *MemoryStore) Load(records ...map[string]interface{}) *MemoryStore {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = make([]pipeline.Record, 0, len(records))
+	for _, rec := range records {
+		m.records = append(m.records, pipeline.Record(rec).Copy())
+	}
+	m.batches = 0
+	return m
+}
+
+// Records returns copies of the records in the store, in the order they were written
+func (m *MemoryStore) Records() []map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	records := make([]map[string]interface{}, 0, len(m.records))
+	for _, rec := range m.records {
+		records = append(records, rec.Copy())
+	}
+	return records
+}
+
+// Batches returns how many times the destination wrote to the store since it was last loaded or reset
+func (m *MemoryStore) Batches() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.batches
+}
+
+// Reset empties the store
+func (m *MemoryStore) Reset() {
+	m.Load()
+}
+
+func (m *MemoryStore) append(records []pipeline.Record) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, rec := range records {
+		m.records = append(m.records, rec.Copy())
+	}
+	m.batches++
+}
+
+// FetchData returns copies of the records in the store
+func (s MemorySource) FetchData(req interfaces.Request) (interface{}, error) {
+	records := Memory(req.MemoryName).Records()
+	logger.Infof("Read %d records from memory store %s", len(records), memoryName(req))
+	return records, nil
+}
+
+// Location names the store the records are read from
+func (s MemorySource) Location(req interfaces.Request) string {
+	return "memory:" + memoryName(req)
+}
+
+// SendData appends the records to the store. Data that is not record-oriented is rejected.
+func (d MemoryDestination) SendData(data interface{}, req interfaces.Request) error {
+	dataset := pipeline.NewDataset(data)
+	if !dataset.Structured() {
+		return fmt.Errorf("unsupported data type for the memory destination: %T", data)
+	}
+	Memory(req.MemoryName).append(dataset.Records)
+	logger.Infof("Wrote %d records to memory store %s", len(dataset.Records), memoryName(req))
+	return nil
+}
+
+func memoryName(req interfaces.Request) string {
+	if req.MemoryName != "" {
+		return req.MemoryName
+	}
+	return DefaultMemoryStore
+}
+
+// Initialize the Memory integrations by registering them with the registry.
+func init() {
+	registry.RegisterSource("Memory", MemorySource{})
+	registry.RegisterDestination("Memory", MemoryDestination{})
+}
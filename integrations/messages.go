@@ -0,0 +1,87 @@
+package integrations
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/SkySingh04/fractal/pipeline"
+)
+
+// MessageValueField holds the payload of a message that is not a JSON object
+const MessageValueField = "value"
+
+// outgoingMessage is one message for a streaming destination
+type outgoingMessage struct {
+	Key     string
+	Payload []byte
+}
+
+// messageRecords turns a message into records. With a format set the payload
+// is decoded by its codec; otherwise a JSON object payload becomes the
+// record and anything else is kept whole under MessageValueField. With
+// keyField set, the message key is stored in that field of each record.
+func messageRecords(payload []byte, key, keyField, format string) ([]map[string]interface{}, error) {
+	var records []map[string]interface{}
+	if format != "" {
+		rows, err := decodeRecords(format, payload)
+		if err != nil {
+			return nil, err
+		}
+		records = rows.Records
+	} else {
+		var rec map[string]interface{}
+		if err := json.Unmarshal(payload, &rec); err != nil || rec == nil {
+			rec = map[string]interface{}{MessageValueField: string(payload)}
+		}
+		records = []map[string]interface{}{rec}
+	}
+	if keyField != "" && key != "" {
+		for _, rec := range records {
+			rec[keyField] = key
+		}
+	}
+	return records, nil
+}
+
+// outgoingMessages turns the data into one message per record, encoded in the
+// format or else as JSON, keyed by keyField when it is set. Data that is not
+// record-oriented is sent as a single message.
+func outgoingMessages(data interface{}, keyField, format string) ([]outgoingMessage, error) {
+	dataset := pipeline.NewDataset(data)
+	if !dataset.Structured() {
+		switch v := data.(type) {
+		case string:
+			return []outgoingMessage{{Payload: []byte(v)}}, nil
+		case []byte:
+			return []outgoingMessage{{Payload: v}}, nil
+		}
+		return nil, fmt.Errorf("unsupported data type: %T", data)
+	}
+	messages := make([]outgoingMessage, 0, len(dataset.Records))
+	for _, rec := range dataset.Records {
+		rec = rec.Copy()
+		delete(rec, pipeline.TableField)
+		var key string
+		if keyField != "" && rec[keyField] != nil {
+			key = fmt.Sprint(rec[keyField])
+		}
+		payload, err := encodeMessage(rec, format)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, outgoingMessage{Key: key, Payload: payload})
+	}
+	return messages, nil
+}
+
+// encodeMessage encodes one record as a message payload, in the format or else as JSON
+func encodeMessage(rec map[string]interface{}, format string) ([]byte, error) {
+	if format != "" {
+		return encodeRecords(format, []map[string]interface{}{rec})
+	}
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode record as JSON: %w", err)
+	}
+	return payload, nil
+}
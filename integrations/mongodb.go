@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"sync"
 
 	"github.com/SkySingh04/fractal/interfaces"
@@ -19,33 +18,39 @@ const bufferSize = 10 // Buffer size for channels
 
 // MongoDBSource struct represents the configuration for consuming messages from MongoDB.
 type MongoDBSource struct {
-	ConnString string `json:"source_mongodb_conn_string"`
-	Database   string `json:"source_mongodb_database"`
-	Collection string `json:"source_mongodb_collection"`
+	ConnString string            `json:"source_mongodb_conn_string" fractal:"required"`
+	Database   string            `json:"source_mongodb_database" fractal:"required"`
+	Collection string            `json:"source_mongodb_collection" fractal:"required"`
+	Options    map[string]string `json:"options"`
 }
 
 // MongoDBDestination struct represents the configuration for publishing messages to MongoDB.
 type MongoDBDestination struct {
-	ConnString string `json:"target_mongodb_conn_string"`
-	Database   string `json:"target_mongodb_database"`
-	Collection string `json:"target_mongodb_collection"`
+	ConnString string            `json:"target_mongodb_conn_string" fractal:"required"`
+	Database   string            `json:"target_mongodb_database" fractal:"required"`
+	Collection string            `json:"target_mongodb_collection" fractal:"required"`
+	Options    map[string]string `json:"options"`
 }
 
 // FetchData connects to MongoDB, retrieves data, and returns it.
 func (m MongoDBSource) FetchData(req interfaces.Request) (interface{}, error) {
 	if req.SourceMongoDBConnString == "" || req.SourceMongoDBDatabase == "" || req.SourceMongoDBCollection == "" {
-		return nil, errors.New("missing MongoDB source connection details")
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing MongoDB source connection details"))
 	}
 	logger.Infof("Connecting to MongoDB source...")
 
-	clientOptions := options.Client().ApplyURI(req.SourceMongoDBConnString)
+	connString, err := connStringWithOptions(req.SourceMongoDBConnString, req.Options)
+	if err != nil {
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	clientOptions := options.Client().ApplyURI(connString)
 	client, err := mongo.Connect(context.TODO(), clientOptions)
 	if err != nil {
-		return nil, err
+		return nil, interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to connect to MongoDB: %w", err))
 	}
 	defer func() {
-		if err = client.Disconnect(context.TODO()); err != nil {
-			log.Fatal(err)
+		if err := client.Disconnect(context.TODO()); err != nil {
+			logger.Errorf("Error disconnecting MongoDB client: %v", err)
 		}
 	}()
 
@@ -105,15 +110,19 @@ func (m MongoDBSource) FetchData(req interfaces.Request) (interface{}, error) {
 // SendData connects to MongoDB and publishes data to the specified collection.
 func (m MongoDBDestination) SendData(data interface{}, req interfaces.Request) error {
 	if req.TargetMongoDBConnString == "" || req.TargetMongoDBDatabase == "" || req.TargetMongoDBCollection == "" {
-		return errors.New("missing MongoDB target connection details")
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing MongoDB target connection details"))
 	}
 	logger.Infof("Connecting to MongoDB destination...")
 
 	// Initialize MongoDB client
-	clientOptions := options.Client().ApplyURI(req.TargetMongoDBConnString)
+	connString, err := connStringWithOptions(req.TargetMongoDBConnString, req.Options)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	clientOptions := options.Client().ApplyURI(connString)
 	client, err := mongo.Connect(context.TODO(), clientOptions)
 	if err != nil {
-		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+		return interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to connect to MongoDB: %w", err))
 	}
 	defer func() {
 		if err = client.Disconnect(context.TODO()); err != nil {
@@ -154,6 +163,104 @@ func (m MongoDBDestination) SendData(data interface{}, req interfaces.Request) e
 	return nil
 }
 
+// FetchPage reads the documents after token in _id order, req.PageSize at a
+// time. The token is the last _id read, in extended JSON, so reading a page
+// again after a failure restarts where it left off rather than from a cursor
+// the server may have closed.
+func (m MongoDBSource) FetchPage(req interfaces.Request, token string) (interface{}, string, error) {
+	if req.SourceMongoDBConnString == "" || req.SourceMongoDBDatabase == "" || req.SourceMongoDBCollection == "" {
+		return nil, "", interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing MongoDB source connection details"))
+	}
+	filter := bson.D{}
+	if token != "" {
+		var after bson.M
+		if err := bson.UnmarshalExtJSON([]byte(token), true, &after); err != nil {
+			return nil, "", interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid MongoDB page token: %w", err))
+		}
+		filter = bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: after["_id"]}}}}
+	}
+
+	connString, err := connStringWithOptions(req.SourceMongoDBConnString, req.Options)
+	if err != nil {
+		return nil, "", interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connString))
+	if err != nil {
+		return nil, "", interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to connect to MongoDB: %w", err))
+	}
+	defer client.Disconnect(ctx)
+
+	collection := client.Database(req.SourceMongoDBDatabase).Collection(req.SourceMongoDBCollection)
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(req.PageSize)))
+	if err != nil {
+		return nil, "", interfaces.Wrap(interfaces.ErrConnection, err)
+	}
+	var docs []bson.M
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, "", interfaces.Wrap(interfaces.ErrConnection, err)
+	}
+	logger.Infof("Page fetched from MongoDB: %d documents", len(docs))
+
+	// A short page is the last one
+	if len(docs) < req.PageSize {
+		return docs, "", nil
+	}
+	next, err := bson.MarshalExtJSON(bson.M{"_id": docs[len(docs)-1]["_id"]}, true, false)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode MongoDB page token: %w", err)
+	}
+	return docs, string(next), nil
+}
+
+// Location returns the database and collection the records are read from
+func (m MongoDBSource) Location(req interfaces.Request) string {
+	return req.SourceMongoDBDatabase + "." + req.SourceMongoDBCollection
+}
+
+// Ping checks the MongoDB source answers
+func (m MongoDBSource) Ping(ctx context.Context, req interfaces.Request) error {
+	if req.SourceMongoDBConnString == "" {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing MongoDB source connection string"))
+	}
+	return pingMongoDB(ctx, req.SourceMongoDBConnString, req.Options)
+}
+
+// Ping checks the MongoDB destination answers
+func (m MongoDBDestination) Ping(ctx context.Context, req interfaces.Request) error {
+	if req.TargetMongoDBConnString == "" {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing MongoDB target connection string"))
+	}
+	return pingMongoDB(ctx, req.TargetMongoDBConnString, req.Options)
+}
+
+// OptionsTarget says the options are added to the connection string
+func (m MongoDBSource) OptionsTarget() string {
+	return "connection string options"
+}
+
+// OptionsTarget says the options are added to the connection string
+func (m MongoDBDestination) OptionsTarget() string {
+	return "connection string options"
+}
+
+// pingMongoDB connects to the server and pings its primary
+func pingMongoDB(ctx context.Context, connString string, connOptions map[string]string) error {
+	connString, err := connStringWithOptions(connString, connOptions)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connString))
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to connect to MongoDB: %w", err))
+	}
+	defer client.Disconnect(context.Background())
+	if err := client.Ping(ctx, nil); err != nil {
+		return interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to ping MongoDB: %w", err))
+	}
+	return nil
+}
+
 // Initialize the MongoDB integrationfs by registering them with the registry.
 func init() {
 	registry.RegisterSource("MongoDB", MongoDBSource{})
@@ -0,0 +1,287 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+	"github.com/SkySingh04/fractal/registry"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// DefaultNATSDurable is the durable consumer the source reads with when none is given
+const DefaultNATSDurable = "fractal"
+
+// DefaultNATSMaxMessages caps the messages one run reads
+const DefaultNATSMaxMessages = 1000
+
+// DefaultNATSReceiveTimeout is how long the source waits for messages before ending the read
+const DefaultNATSReceiveTimeout = 5 * time.Second
+
+// natsRequestTimeout bounds each call to the JetStream API
+const natsRequestTimeout = 10 * time.Second
+
+// NATSSource struct represents the configuration for consuming messages from a NATS JetStream stream.
+type NATSSource struct {
+	URL            string `json:"nats_url" fractal:"required"`
+	Subject        string `json:"nats_subject" fractal:"required"`
+	Stream         string `json:"nats_stream"`
+	Durable        string `json:"nats_durable"`
+	MaxMessages    int    `json:"nats_max_messages"`
+	ReceiveTimeout string `json:"nats_receive_timeout"`
+	AckWait        string `json:"nats_ack_wait"`
+	CredsFile      string `json:"nats_creds_file"`
+	Token          string `json:"nats_token" secret:"true"`
+	Format         string `json:"format"`
+}
+
+// NATSDestination struct represents the configuration for publishing messages to a NATS JetStream subject.
+type NATSDestination struct {
+	URL       string `json:"nats_url" fractal:"required"`
+	Subject   string `json:"nats_subject" fractal:"required"`
+	CredsFile string `json:"nats_creds_file"`
+	Token     string `json:"nats_token" secret:"true"`
+	Format    string `json:"format"`
+}
+
+// natsRead is a connection whose messages wait for the run to deliver them before they are acknowledged
+type natsRead struct {
+	conn     *nats.Conn
+	messages []jetstream.Msg
+}
+
+// release asks the server to redeliver the messages and closes the connection
+func (r *natsRead) release() {
+	for _, msg := range r.messages {
+		_ = msg.Nak()
+	}
+	r.conn.Close()
+}
+
+// pendingNATSReads holds the reads FetchData made until Commit acknowledges
+// them, keyed by stream and durable consumer
+var pendingNATSReads = struct {
+	sync.Mutex
+	reads map[string]*natsRead
+}{reads: map[string]*natsRead{}}
+
+// FetchData reads messages on the subject through a durable consumer, until
+// MaxMessages have arrived or none arrives within ReceiveTimeout. The
+// messages are acknowledged by Commit, once the run has delivered them, so a
+// failed run reads them again.
+func (n NATSSource) FetchData(req interfaces.Request) (interface{}, error) {
+	if req.NATSURL == "" || req.NATSSubject == "" {
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing NATS URL or subject"))
+	}
+	if err := validateFormat(req.Format); err != nil {
+		return nil, err
+	}
+	maxMessages := req.NATSMaxMessages
+	if maxMessages <= 0 {
+		maxMessages = DefaultNATSMaxMessages
+	}
+	receiveTimeout, err := natsDuration("receive timeout", req.NATSReceiveTimeout, DefaultNATSReceiveTimeout)
+	if err != nil {
+		return nil, err
+	}
+	ackWait, err := natsDuration("ack wait", req.NATSAckWait, 0)
+	if err != nil {
+		return nil, err
+	}
+	// A read left over from a failed run is released first, so its messages are redelivered to this one
+	key := natsReadKey(req)
+	pendingNATSReads.Lock()
+	if previous, ok := pendingNATSReads.reads[key]; ok {
+		previous.release()
+		delete(pendingNATSReads.reads, key)
+	}
+	pendingNATSReads.Unlock()
+
+	conn, js, err := connectNATS(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), natsRequestTimeout)
+	defer cancel()
+	stream := req.NATSStream
+	if stream == "" {
+		stream, err = js.StreamNameBySubject(ctx, req.NATSSubject)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to find the JetStream stream for subject %s: %w", req.NATSSubject, err)
+		}
+	}
+	durable := natsDurable(req)
+	logger.Infof("Connecting to NATS Source: URL=%s, Stream=%s, Subject=%s, Durable=%s", req.NATSURL, stream, req.NATSSubject, durable)
+	consumer, err := js.CreateOrUpdateConsumer(ctx, stream, jetstream.ConsumerConfig{
+		Durable:       durable,
+		FilterSubject: req.NATSSubject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       ackWait,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create durable consumer %s on stream %s: %w", durable, stream, err)
+	}
+
+	batch, err := consumer.Fetch(maxMessages, jetstream.FetchMaxWait(receiveTimeout))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to fetch from NATS subject %s: %w", req.NATSSubject, err)
+	}
+	read := &natsRead{conn: conn}
+	records := make([]map[string]interface{}, 0)
+	for msg := range batch.Messages() {
+		read.messages = append(read.messages, msg)
+		decoded, err := messageRecords(msg.Data(), "", "", req.Format)
+		if err != nil {
+			read.release()
+			return nil, fmt.Errorf("failed to read a message from NATS subject %s: %w", req.NATSSubject, err)
+		}
+		records = append(records, decoded...)
+	}
+	if err := batch.Error(); err != nil && !errors.Is(err, nats.ErrTimeout) {
+		read.release()
+		return nil, fmt.Errorf("failed to fetch from NATS subject %s: %w", req.NATSSubject, err)
+	}
+	logger.Infof("Received %d messages from NATS subject %s", len(read.messages), req.NATSSubject)
+
+	if len(read.messages) == 0 {
+		conn.Close()
+		return records, nil
+	}
+	pendingNATSReads.Lock()
+	pendingNATSReads.reads[key] = read
+	pendingNATSReads.Unlock()
+	return records, nil
+}
+
+// Commit acknowledges the messages of the last FetchData, once the run has
+// delivered them, waiting for the server to confirm each one
+func (n NATSSource) Commit(req interfaces.Request) error {
+	key := natsReadKey(req)
+	pendingNATSReads.Lock()
+	read, ok := pendingNATSReads.reads[key]
+	delete(pendingNATSReads.reads, key)
+	pendingNATSReads.Unlock()
+	if !ok {
+		return nil
+	}
+	defer read.conn.Close()
+	for _, msg := range read.messages {
+		ctx, cancel := context.WithTimeout(context.Background(), natsRequestTimeout)
+		err := msg.DoubleAck(ctx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to acknowledge NATS message on %s: %w", msg.Subject(), err)
+		}
+	}
+	logger.Infof("Acknowledged %d messages on NATS subject %s", len(read.messages), req.NATSSubject)
+	return nil
+}
+
+// Location returns the subject the messages are read from
+func (n NATSSource) Location(req interfaces.Request) string {
+	return req.NATSSubject
+}
+
+// SendData publishes one message per record to the subject, in the format or
+// else as JSON, and returns once the stream has stored all of them
+func (n NATSDestination) SendData(data interface{}, req interfaces.Request) error {
+	if req.NATSURL == "" || req.NATSSubject == "" {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing NATS URL or subject"))
+	}
+	messages, err := outgoingMessages(data, "", req.Format)
+	if err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	conn, js, err := connectNATS(req)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	logger.Infof("Connecting to NATS Destination: URL=%s, Subject=%s", req.NATSURL, req.NATSSubject)
+
+	futures := make([]jetstream.PubAckFuture, 0, len(messages))
+	for _, message := range messages {
+		future, err := js.PublishAsync(req.NATSSubject, message.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to publish to NATS subject %s: %w", req.NATSSubject, err)
+		}
+		futures = append(futures, future)
+	}
+	timeout := time.After(natsRequestTimeout)
+	for _, future := range futures {
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			return fmt.Errorf("failed to publish to NATS subject %s: %w", req.NATSSubject, err)
+		case <-timeout:
+			return fmt.Errorf("timed out waiting for NATS subject %s to store the messages", req.NATSSubject)
+		}
+	}
+	logger.Infof("Published %d messages to NATS subject %s", len(messages), req.NATSSubject)
+	return nil
+}
+
+// connectNATS connects with a creds file or a token, whichever is configured
+func connectNATS(req interfaces.Request) (*nats.Conn, jetstream.JetStream, error) {
+	opts := []nats.Option{nats.Name("fractal")}
+	switch {
+	case req.NATSCredsFile != "" && req.NATSToken != "":
+		return nil, nil, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("set either a NATS creds file or a token, not both"))
+	case req.NATSCredsFile != "":
+		opts = append(opts, nats.UserCredentials(req.NATSCredsFile))
+	case req.NATSToken != "":
+		opts = append(opts, nats.Token(req.NATSToken))
+	}
+	conn, err := nats.Connect(req.NATSURL, opts...)
+	if err != nil {
+		return nil, nil, interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to connect to NATS: %w", err))
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to open JetStream: %w", err))
+	}
+	return conn, js, nil
+}
+
+// natsDuration parses a configured duration, using fallback when it is empty
+func natsDuration(name, value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid NATS %s %q: %w", name, value, err))
+	}
+	return d, nil
+}
+
+func natsDurable(req interfaces.Request) string {
+	if req.NATSDurable != "" {
+		return req.NATSDurable
+	}
+	return DefaultNATSDurable
+}
+
+// natsReadKey names a pending read by the subject and durable consumer it came from
+func natsReadKey(req interfaces.Request) string {
+	return req.NATSURL + "|" + req.NATSStream + "|" + req.NATSSubject + "|" + natsDurable(req)
+}
+
+// Initialize the NATS integrations by registering them with the registry.
+func init() {
+	registry.RegisterSource("NATS", NATSSource{})
+	registry.RegisterDestination("NATS", NATSDestination{})
+}
@@ -0,0 +1,44 @@
+package integrations
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// connStringWithOptions adds options to a connection string as parameters,
+// replacing ones it already has: to the query of a URL such as
+// postgres://host/db or mongodb://a,b/db, or as key=value pairs after a
+// PostgreSQL key=value string. An empty connection string stays empty, so
+// it is still reported as missing.
+func connStringWithOptions(connString string, options map[string]string) (string, error) {
+	if connString == "" || len(options) == 0 {
+		return connString, nil
+	}
+	if strings.Contains(connString, "://") {
+		base, query, _ := strings.Cut(connString, "?")
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			return "", fmt.Errorf("failed to add options to the connection string: %w", err)
+		}
+		for key, value := range options {
+			values.Set(key, value)
+		}
+		return base + "?" + values.Encode(), nil
+	}
+
+	// The last of a repeated key=value parameter wins
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(connString)
+	for _, key := range keys {
+		value := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(options[key])
+		fmt.Fprintf(&b, " %s='%s'", key, value)
+	}
+	return b.String(), nil
+}
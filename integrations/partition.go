@@ -0,0 +1,193 @@
+package integrations
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/SkySingh04/fractal/pipeline"
+)
+
+// DefaultPartitionEmptyValue names the partition of records whose partition
+// field is missing, null or empty. It is the placeholder Hive and Athena use.
+const DefaultPartitionEmptyValue = "__HIVE_DEFAULT_PARTITION__"
+
+// DefaultPartitionMaxOpenWriters caps the partition files kept open at once
+const DefaultPartitionMaxOpenWriters = 64
+
+// partitioning describes how a file destination splits records into Hive-style directories
+type partitioning struct {
+	By             []string
+	MaxOpenWriters int
+	EmptyValue     string
+}
+
+// partitionedRecords turns the data into records for partitioning
+func partitionedRecords(data interface{}) (*pipeline.Dataset, error) {
+	dataset := pipeline.NewDataset(data)
+	if !dataset.Structured() {
+		return nil, errors.New("partitioned output needs record-oriented data")
+	}
+	return dataset, nil
+}
+
+// path returns the file a record goes to: base's directory, then one
+// field=value directory per partition field, then base's file name. The
+// partition fields are removed from the record, as query engines read them
+// from the path.
+func (p partitioning) path(base string, rec pipeline.Record) (string, pipeline.Record) {
+	empty := p.EmptyValue
+	if empty == "" {
+		empty = DefaultPartitionEmptyValue
+	}
+	rec = rec.Copy()
+	dirs := []string{filepath.Dir(base)}
+	for _, field := range p.By {
+		value := empty
+		if v := rec[field]; v != nil && fmt.Sprint(v) != "" {
+			// Escaping keeps values such as "a/b" or ".." inside their own directory
+			value = url.PathEscape(fmt.Sprint(v))
+		}
+		delete(rec, field)
+		dirs = append(dirs, field+"="+value)
+	}
+	return filepath.Join(append(dirs, filepath.Base(base))...), rec
+}
+
+// columns drops the partition fields from a column order
+func (p partitioning) columns(columns []string) []string {
+	partitioned := make(map[string]bool, len(p.By))
+	for _, field := range p.By {
+		partitioned[field] = true
+	}
+	var kept []string
+	for _, column := range columns {
+		if !partitioned[column] {
+			kept = append(kept, column)
+		}
+	}
+	return kept
+}
+
+// group splits the records by partition file, keeping the order in which partitions first appear
+func (p partitioning) group(base string, records []pipeline.Record) ([]string, map[string][]pipeline.Record) {
+	var paths []string
+	groups := make(map[string][]pipeline.Record)
+	for _, rec := range records {
+		path, rec := p.path(base, rec)
+		if _, ok := groups[path]; !ok {
+			paths = append(paths, path)
+		}
+		groups[path] = append(groups[path], rec)
+	}
+	return paths, groups
+}
+
+// partitionWriter appends records to one partition file
+type partitionWriter interface {
+	Write(rec pipeline.Record) error
+	Close() error
+}
+
+// partitionWriters keeps at most max partition files open, closing the least
+// recently used one to make room. A partition written again after being
+// closed is reopened for appending.
+type partitionWriters struct {
+	max     int
+	open    func(path string, reopen bool) (partitionWriter, error)
+	writers map[string]*list.Element
+	lru     *list.List
+	seen    map[string]bool
+}
+
+type openPartition struct {
+	path   string
+	writer partitionWriter
+}
+
+func newPartitionWriters(max int, open func(path string, reopen bool) (partitionWriter, error)) *partitionWriters {
+	if max <= 0 {
+		max = DefaultPartitionMaxOpenWriters
+	}
+	return &partitionWriters{
+		max:     max,
+		open:    open,
+		writers: make(map[string]*list.Element),
+		lru:     list.New(),
+		seen:    make(map[string]bool),
+	}
+}
+
+// Write appends rec to the partition file at path
+func (w *partitionWriters) Write(path string, rec pipeline.Record) error {
+	elem, ok := w.writers[path]
+	if ok {
+		w.lru.MoveToFront(elem)
+	} else {
+		if w.lru.Len() >= w.max {
+			if err := w.evict(); err != nil {
+				return err
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create partition directory: %w", err)
+		}
+		writer, err := w.open(path, w.seen[path])
+		if err != nil {
+			return fmt.Errorf("failed to open partition %s: %w", path, err)
+		}
+		w.seen[path] = true
+		elem = w.lru.PushFront(&openPartition{path: path, writer: writer})
+		w.writers[path] = elem
+	}
+	return elem.Value.(*openPartition).writer.Write(rec)
+}
+
+// evict closes the least recently used partition file
+func (w *partitionWriters) evict() error {
+	elem := w.lru.Back()
+	partition := elem.Value.(*openPartition)
+	w.lru.Remove(elem)
+	delete(w.writers, partition.path)
+	if err := partition.writer.Close(); err != nil {
+		return fmt.Errorf("failed to close partition %s: %w", partition.path, err)
+	}
+	return nil
+}
+
+// Close closes every open partition file and returns the first error
+func (w *partitionWriters) Close() error {
+	var firstErr error
+	for w.lru.Len() > 0 {
+		if err := w.evict(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// writeGroupedPartitions writes each partition of a whole-document format,
+// such as JSON or YAML, with one call to write, so one file is open at a time
+func writeGroupedPartitions(base string, data interface{}, p partitioning, write func(path string, records []interface{}) error) error {
+	dataset, err := partitionedRecords(data)
+	if err != nil {
+		return err
+	}
+	paths, groups := p.group(base, dataset.Records)
+	for _, path := range paths {
+		records := make([]interface{}, len(groups[path]))
+		for i, rec := range groups[path] {
+			records[i] = map[string]interface{}(rec)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create partition directory: %w", err)
+		}
+		if err := write(path, records); err != nil {
+			return fmt.Errorf("failed to write partition %s: %w", path, err)
+		}
+	}
+	return nil
+}
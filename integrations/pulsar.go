@@ -0,0 +1,343 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+	"github.com/SkySingh04/fractal/registry"
+	"github.com/apache/pulsar-client-go/pulsar"
+)
+
+// DefaultPulsarSubscription is the subscription the source reads with when none is given
+const DefaultPulsarSubscription = "fractal"
+
+// DefaultPulsarMaxMessages caps the messages one run reads
+const DefaultPulsarMaxMessages = 1000
+
+// DefaultPulsarReceiveTimeout is how long the source waits for a message before ending the read
+const DefaultPulsarReceiveTimeout = 5 * time.Second
+
+// PulsarSource struct represents the configuration for consuming messages from an Apache Pulsar topic.
+type PulsarSource struct {
+	URL               string `json:"pulsar_url" fractal:"required"`
+	Topic             string `json:"pulsar_topic" fractal:"required"`
+	Subscription      string `json:"pulsar_subscription"`
+	SubscriptionType  string `json:"pulsar_subscription_type" fractal:"enum=shared|exclusive|failover|key_shared"`
+	MaxMessages       int    `json:"pulsar_max_messages"`
+	ReceiveTimeout    string `json:"pulsar_receive_timeout"`
+	KeyField          string `json:"pulsar_key_field"`
+	Format            string `json:"format"`
+	Token             string `json:"pulsar_token" secret:"true"`
+	TLSTrustCertsFile string `json:"pulsar_tls_trust_certs_file"`
+	TLSCertFile       string `json:"pulsar_tls_cert_file"`
+	TLSKeyFile        string `json:"pulsar_tls_key_file"`
+
+	subscribe PulsarSubscriber
+}
+
+// PulsarConsumer is the part of a Pulsar consumer the source reads and
+// acknowledges messages with
+type PulsarConsumer interface {
+	Receive(ctx context.Context) (pulsar.Message, error)
+	Ack(msg pulsar.Message) error
+	// Close releases the consumer. Messages it did not acknowledge are redelivered.
+	Close()
+}
+
+// PulsarSubscriber opens the consumer FetchData reads with
+type PulsarSubscriber func(req interfaces.Request, options pulsar.ConsumerOptions) (PulsarConsumer, error)
+
+// NewPulsarSource returns a source reading through the consumers subscribe
+// opens, such as one that does not need a broker
+func NewPulsarSource(subscribe PulsarSubscriber) PulsarSource {
+	return PulsarSource{subscribe: subscribe}
+}
+
+// PulsarDestination struct represents the configuration for publishing messages to an Apache Pulsar topic.
+type PulsarDestination struct {
+	URL               string `json:"pulsar_url" fractal:"required"`
+	Topic             string `json:"pulsar_topic" fractal:"required"`
+	KeyField          string `json:"pulsar_key_field"`
+	Format            string `json:"format"`
+	BatchSize         int    `json:"pulsar_batch_size"`
+	Token             string `json:"pulsar_token" secret:"true"`
+	TLSTrustCertsFile string `json:"pulsar_tls_trust_certs_file"`
+	TLSCertFile       string `json:"pulsar_tls_cert_file"`
+	TLSKeyFile        string `json:"pulsar_tls_key_file"`
+}
+
+// pulsarRead is a consumer whose messages wait for the run to deliver them before they are acknowledged
+type pulsarRead struct {
+	consumer PulsarConsumer
+	messages []pulsar.Message
+}
+
+// close releases the consumer. Messages it did not acknowledge are redelivered.
+func (r *pulsarRead) close() {
+	r.consumer.Close()
+}
+
+// pulsarClientConsumer is a consumer that closes the client it came from with it
+type pulsarClientConsumer struct {
+	pulsar.Consumer
+	client pulsar.Client
+}
+
+func (c pulsarClientConsumer) Close() {
+	c.Consumer.Close()
+	c.client.Close()
+}
+
+// subscribePulsar connects to the broker and subscribes to the topic
+func subscribePulsar(req interfaces.Request, options pulsar.ConsumerOptions) (PulsarConsumer, error) {
+	client, err := newPulsarClient(req)
+	if err != nil {
+		return nil, err
+	}
+	consumer, err := client.Subscribe(options)
+	if err != nil {
+		client.Close()
+		return nil, interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to subscribe to Pulsar topic %s: %w", req.PulsarTopic, err))
+	}
+	return pulsarClientConsumer{Consumer: consumer, client: client}, nil
+}
+
+// pendingPulsarReads holds the reads FetchData made until Commit acknowledges
+// them, keyed by topic and subscription
+var pendingPulsarReads = struct {
+	sync.Mutex
+	reads map[string]*pulsarRead
+}{reads: map[string]*pulsarRead{}}
+
+// FetchData reads messages from the topic until MaxMessages have arrived or
+// none arrives within ReceiveTimeout. The messages are acknowledged by Commit,
+// once the run has delivered them, so a failed run reads them again.
+func (p PulsarSource) FetchData(req interfaces.Request) (interface{}, error) {
+	if req.PulsarURL == "" || req.PulsarTopic == "" {
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing Pulsar URL or topic"))
+	}
+	if err := validateFormat(req.Format); err != nil {
+		return nil, err
+	}
+	subscriptionType, err := pulsarSubscriptionType(req.PulsarSubscriptionType)
+	if err != nil {
+		return nil, err
+	}
+	maxMessages := req.PulsarMaxMessages
+	if maxMessages <= 0 {
+		maxMessages = DefaultPulsarMaxMessages
+	}
+	receiveTimeout := DefaultPulsarReceiveTimeout
+	if req.PulsarReceiveTimeout != "" {
+		receiveTimeout, err = time.ParseDuration(req.PulsarReceiveTimeout)
+		if err != nil {
+			return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid Pulsar receive timeout %q: %w", req.PulsarReceiveTimeout, err))
+		}
+	}
+	// A read left over from a failed run is released first, so its messages are redelivered to this one
+	key := pulsarReadKey(req)
+	pendingPulsarReads.Lock()
+	if previous, ok := pendingPulsarReads.reads[key]; ok {
+		previous.close()
+		delete(pendingPulsarReads.reads, key)
+	}
+	pendingPulsarReads.Unlock()
+
+	subscribe := p.subscribe
+	if subscribe == nil {
+		subscribe = subscribePulsar
+	}
+	subscription := pulsarSubscription(req)
+	logger.Infof("Connecting to Pulsar Source: URL=%s, Topic=%s, Subscription=%s", req.PulsarURL, req.PulsarTopic, subscription)
+	consumer, err := subscribe(req, pulsar.ConsumerOptions{
+		Topic:                       req.PulsarTopic,
+		SubscriptionName:            subscription,
+		Type:                        subscriptionType,
+		SubscriptionInitialPosition: pulsar.SubscriptionPositionEarliest,
+	})
+	if err != nil {
+		return nil, err
+	}
+	read := &pulsarRead{consumer: consumer}
+
+	records := make([]map[string]interface{}, 0)
+	for len(read.messages) < maxMessages {
+		ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+		msg, err := consumer.Receive(ctx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) {
+			break
+		}
+		if err != nil {
+			read.close()
+			return nil, fmt.Errorf("failed to receive from Pulsar topic %s: %w", req.PulsarTopic, err)
+		}
+		read.messages = append(read.messages, msg)
+		decoded, err := messageRecords(msg.Payload(), msg.Key(), req.PulsarKeyField, req.Format)
+		if err != nil {
+			read.close()
+			return nil, fmt.Errorf("failed to read a message from Pulsar topic %s: %w", req.PulsarTopic, err)
+		}
+		records = append(records, decoded...)
+	}
+	logger.Infof("Received %d messages from Pulsar topic %s", len(read.messages), req.PulsarTopic)
+
+	if len(read.messages) == 0 {
+		read.close()
+		return records, nil
+	}
+	pendingPulsarReads.Lock()
+	pendingPulsarReads.reads[key] = read
+	pendingPulsarReads.Unlock()
+	return records, nil
+}
+
+// Commit acknowledges the messages of the last FetchData, once the run has delivered them
+func (p PulsarSource) Commit(req interfaces.Request) error {
+	key := pulsarReadKey(req)
+	pendingPulsarReads.Lock()
+	read, ok := pendingPulsarReads.reads[key]
+	delete(pendingPulsarReads.reads, key)
+	pendingPulsarReads.Unlock()
+	if !ok {
+		return nil
+	}
+	defer read.close()
+	for _, msg := range read.messages {
+		if err := read.consumer.Ack(msg); err != nil {
+			return fmt.Errorf("failed to acknowledge Pulsar message %s: %w", msg.ID(), err)
+		}
+	}
+	logger.Infof("Acknowledged %d messages on Pulsar topic %s", len(read.messages), req.PulsarTopic)
+	return nil
+}
+
+// Location returns the topic the messages are read from
+func (p PulsarSource) Location(req interfaces.Request) string {
+	return req.PulsarTopic
+}
+
+// SendData publishes one message per record, in the format or else as JSON,
+// keyed by KeyField when it is set. The producer batches messages and
+// SendData returns once the broker has stored all of them.
+func (p PulsarDestination) SendData(data interface{}, req interfaces.Request) error {
+	if req.PulsarURL == "" || req.PulsarTopic == "" {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing Pulsar URL or topic"))
+	}
+	if req.PulsarBatchSize < 0 {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("Pulsar batch size must not be negative"))
+	}
+	messages, err := outgoingMessages(data, req.PulsarKeyField, req.Format)
+	if err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	client, err := newPulsarClient(req)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	logger.Infof("Connecting to Pulsar Destination: URL=%s, Topic=%s", req.PulsarURL, req.PulsarTopic)
+	producer, err := client.CreateProducer(pulsar.ProducerOptions{
+		Topic:               req.PulsarTopic,
+		BatchingMaxMessages: uint(req.PulsarBatchSize),
+	})
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to create Pulsar producer for topic %s: %w", req.PulsarTopic, err))
+	}
+	defer producer.Close()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	for _, message := range messages {
+		wg.Add(1)
+		producer.SendAsync(context.Background(), &pulsar.ProducerMessage{Key: message.Key, Payload: message.Payload},
+			func(_ pulsar.MessageID, _ *pulsar.ProducerMessage, err error) {
+				defer wg.Done()
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			})
+	}
+	if err := producer.Flush(); err != nil {
+		wg.Wait()
+		return fmt.Errorf("failed to publish to Pulsar topic %s: %w", req.PulsarTopic, err)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return fmt.Errorf("failed to publish to Pulsar topic %s: %w", req.PulsarTopic, firstErr)
+	}
+	logger.Infof("Published %d messages to Pulsar topic %s", len(messages), req.PulsarTopic)
+	return nil
+}
+
+// newPulsarClient connects with a token or a TLS client certificate, whichever is configured
+func newPulsarClient(req interfaces.Request) (pulsar.Client, error) {
+	opts := pulsar.ClientOptions{
+		URL:                   req.PulsarURL,
+		TLSTrustCertsFilePath: req.PulsarTLSTrustCertsFile,
+	}
+	hasCert := req.PulsarTLSCertFile != "" || req.PulsarTLSKeyFile != ""
+	switch {
+	case req.PulsarToken != "" && hasCert:
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("set either a Pulsar token or a TLS client certificate, not both"))
+	case req.PulsarToken != "":
+		opts.Authentication = pulsar.NewAuthenticationToken(req.PulsarToken)
+	case hasCert:
+		if req.PulsarTLSCertFile == "" || req.PulsarTLSKeyFile == "" {
+			return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("a Pulsar TLS client certificate needs both a cert file and a key file"))
+		}
+		opts.Authentication = pulsar.NewAuthenticationTLS(req.PulsarTLSCertFile, req.PulsarTLSKeyFile)
+	}
+	client, err := pulsar.NewClient(opts)
+	if err != nil {
+		return nil, interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to create Pulsar client: %w", err))
+	}
+	return client, nil
+}
+
+// pulsarSubscriptionType maps a configured subscription type, shared by default, to the client's
+func pulsarSubscriptionType(name string) (pulsar.SubscriptionType, error) {
+	switch strings.ToLower(name) {
+	case "", "shared":
+		return pulsar.Shared, nil
+	case "exclusive":
+		return pulsar.Exclusive, nil
+	case "failover":
+		return pulsar.Failover, nil
+	case "key_shared":
+		return pulsar.KeyShared, nil
+	}
+	return 0, interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid Pulsar subscription type %q: expected shared, exclusive, failover or key_shared", name))
+}
+
+func pulsarSubscription(req interfaces.Request) string {
+	if req.PulsarSubscription != "" {
+		return req.PulsarSubscription
+	}
+	return DefaultPulsarSubscription
+}
+
+// pulsarReadKey names a pending read by the topic and subscription it came from
+func pulsarReadKey(req interfaces.Request) string {
+	return req.PulsarURL + "|" + req.PulsarTopic + "|" + pulsarSubscription(req)
+}
+
+// Initialize the Pulsar integrations by registering them with the registry.
+func init() {
+	registry.RegisterSource("Pulsar", PulsarSource{})
+	registry.RegisterDestination("Pulsar", PulsarDestination{})
+}
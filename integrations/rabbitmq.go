@@ -1,7 +1,10 @@
 package integrations
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net"
 	"strings"
 	"sync"
 
@@ -13,14 +16,14 @@ import (
 
 // RabbitMQSource struct represents the configuration for consuming messages from RabbitMQ.
 type RabbitMQSource struct {
-	URL       string `json:"rabbitmq_input_url"`
-	QueueName string `json:"rabbitmq_input_queue_name"`
+	URL       string `json:"rabbitmq_input_url" fractal:"required"`
+	QueueName string `json:"rabbitmq_input_queue_name" fractal:"required"`
 }
 
 // RabbitMQDestination struct represents the configuration for publishing messages to RabbitMQ.
 type RabbitMQDestination struct {
-	URL       string `json:"rabbitmq_output_url"`
-	QueueName string `json:"rabbitmq_output_queue_name"`
+	URL       string `json:"rabbitmq_output_url" fractal:"required"`
+	QueueName string `json:"rabbitmq_output_queue_name" fractal:"required"`
 }
 
 // FetchData connects to RabbitMQ, retrieves data, and processes it concurrently.
@@ -28,13 +31,13 @@ func (r RabbitMQSource) FetchData(req interfaces.Request) (interface{}, error) {
 	logger.Infof("Connecting to RabbitMQ Source: URL=%s, Queue=%s", req.RabbitMQInputURL, req.RabbitMQInputQueueName)
 
 	if req.RabbitMQInputURL == "" || req.RabbitMQInputQueueName == "" {
-		return nil, errors.New("missing RabbitMQ source details")
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing RabbitMQ source details"))
 	}
 
 	// Connect to RabbitMQ
 	conn, err := amqp.Dial(req.RabbitMQInputURL)
 	if err != nil {
-		return nil, err
+		return nil, interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to connect to RabbitMQ: %w", err))
 	}
 	defer conn.Close()
 
@@ -91,13 +94,13 @@ func (r RabbitMQDestination) SendData(data interface{}, req interfaces.Request)
 	logger.Infof("Connecting to RabbitMQ Destination: URL=%s, Queue=%s", req.RabbitMQOutputURL, req.RabbitMQOutputQueueName)
 
 	if req.RabbitMQOutputURL == "" || req.RabbitMQOutputQueueName == "" {
-		return errors.New("missing RabbitMQ target details")
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing RabbitMQ target details"))
 	}
 
 	// Connect to RabbitMQ
 	conn, err := amqp.Dial(req.RabbitMQOutputURL)
 	if err != nil {
-		return err
+		return interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to connect to RabbitMQ: %w", err))
 	}
 	defer conn.Close()
 
@@ -183,6 +186,44 @@ func transformRabbitMQData(data []byte) []byte {
 	return []byte(strings.ToUpper(string(data)))
 }
 
+// Ping checks the RabbitMQ source accepts connections
+func (r RabbitMQSource) Ping(ctx context.Context, req interfaces.Request) error {
+	if req.RabbitMQInputURL == "" {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing RabbitMQ source URL"))
+	}
+	return pingRabbitMQ(ctx, req.RabbitMQInputURL)
+}
+
+// Ping checks the RabbitMQ destination accepts connections
+func (r RabbitMQDestination) Ping(ctx context.Context, req interfaces.Request) error {
+	if req.RabbitMQOutputURL == "" {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing RabbitMQ destination URL"))
+	}
+	return pingRabbitMQ(ctx, req.RabbitMQOutputURL)
+}
+
+// pingRabbitMQ opens a connection, handshake included, and closes it again
+func pingRabbitMQ(ctx context.Context, url string) error {
+	conn, err := amqp.DialConfig(url, amqp.Config{
+		Dial: func(network, addr string) (net.Conn, error) {
+			var dialer net.Dialer
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			// The handshake must not outlast the ping either; amqp clears the deadline once it is done
+			if deadline, ok := ctx.Deadline(); ok {
+				conn.SetDeadline(deadline)
+			}
+			return conn, nil
+		},
+	})
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to connect to RabbitMQ: %w", err))
+	}
+	return conn.Close()
+}
+
 // Initialize the RabbitMQ integrations by registering them with the registry.
 func init() {
 	registry.RegisterSource("RabbitMQ", RabbitMQSource{})
@@ -17,21 +17,27 @@ import (
 
 // SFTPSource implements the DataSource interface
 type SFTPSource struct {
-	URL          string `json:"url"`
-	User         string `json:"user"`
-	Password     string `json:"password"`
-	SFTPFILEPATH string `json:"file_path"`
+	URL               string `json:"url" fractal:"required"`
+	User              string `json:"user" fractal:"required"`
+	Password          string `json:"password" secret:"true" fractal:"required"`
+	SFTPFILEPATH      string `json:"file_path" fractal:"required"`
+	Format            string `json:"format"`
+	ChunkSize         int    `json:"chunk_size"`
+	ChunkRetries      int    `json:"chunk_retries"`
+	ChunkRetryBackoff string `json:"chunk_retry_backoff"`
 }
 
 // SFTPDestination implements the DataDestination interface
 type SFTPDestination struct {
-	URL          string `json:"url"`
-	User         string `json:"user"`
-	Password     string `json:"password"`
-	SFTPFILEPATH string `json:"file_path"`
+	URL          string `json:"url" fractal:"required"`
+	User         string `json:"user" fractal:"required"`
+	Password     string `json:"password" secret:"true" fractal:"required"`
+	SFTPFILEPATH string `json:"file_path" fractal:"required"`
+	Format       string `json:"format"`
 }
 
-// FetchData fetches data from an SFTP server concurrently
+// FetchData fetches a file from an SFTP server concurrently, decoded into
+// records when a format is set and as bytes otherwise
 func (s SFTPSource) FetchData(req interfaces.Request) (interface{}, error) {
 	if err := validateSFTPRequest(req, true); err != nil {
 		return nil, err
@@ -44,6 +50,18 @@ func (s SFTPSource) FetchData(req interfaces.Request) (interface{}, error) {
 	}
 	defer client.Close()
 
+	if req.ChunkSize > 0 {
+		logger.Infof("Downloading file from SFTP in chunks of %d bytes: %s", req.ChunkSize, req.SFTPFILEPATH)
+		data, err := fetchSFTPChunks(client, req)
+		if err != nil {
+			return nil, err
+		}
+		if req.Format != "" {
+			return decodeRecords(req.Format, data)
+		}
+		return data, nil
+	}
+
 	// Use WaitGroup to ensure all operations finish
 	var wg sync.WaitGroup
 	dataChan := make(chan []byte)
@@ -80,10 +98,15 @@ func (s SFTPSource) FetchData(req interfaces.Request) (interface{}, error) {
 	}
 
 	// Return the data received from the channel
-	return <-dataChan, nil
+	data := <-dataChan
+	if req.Format != "" {
+		return decodeRecords(req.Format, data)
+	}
+	return data, nil
 }
 
-// SendData sends data to an SFTP server concurrently
+// SendData sends data to an SFTP server concurrently, encoding records in
+// the format when one is set
 func (s SFTPDestination) SendData(data interface{}, req interfaces.Request) error {
 	if err := validateSFTPRequest(req, false); err != nil {
 		return err
@@ -100,9 +123,9 @@ func (s SFTPDestination) SendData(data interface{}, req interfaces.Request) erro
 	var wg sync.WaitGroup
 	errorChan := make(chan error)
 
-	dataBytes, ok := data.([]byte)
-	if !ok {
-		return fmt.Errorf("invalid data format; expected []byte, got %T", data)
+	dataBytes, err := transportBytes(req.Format, data)
+	if err != nil {
+		return err
 	}
 
 	wg.Add(1)
@@ -136,6 +159,54 @@ func (s SFTPDestination) SendData(data interface{}, req interfaces.Request) erro
 	return nil
 }
 
+// fetchSFTPChunks downloads the file a ranged read of a chunk at a time. A
+// failed read opens a new connection and reads the rest of its chunk again.
+func fetchSFTPChunks(client *sftp.Client, req interfaces.Request) ([]byte, error) {
+	path := req.SFTPFILEPATH
+	file, err := client.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve file from SFTP: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read the size of %s on SFTP: %w", path, err)
+	}
+
+	current := client
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+		// The caller closes the client it opened
+		if current != nil && current != client {
+			current.Close()
+		}
+	}()
+	return ReadChunks(path, info.Size(), req, func(offset int64, buf []byte, retry bool) (int, error) {
+		if retry {
+			if file != nil {
+				file.Close()
+				file = nil
+			}
+			if current != nil && current != client {
+				current.Close()
+			}
+			var err error
+			if current, err = dialSFTP(req.SFTPURL, req.SFTPUser, req.SFTPPassword); err != nil {
+				return 0, err
+			}
+		}
+		if file == nil {
+			var err error
+			if file, err = current.Open(path); err != nil {
+				return 0, fmt.Errorf("failed to retrieve file from SFTP: %w", err)
+			}
+		}
+		return file.ReadAt(buf, offset)
+	})
+}
+
 // dialSFTP creates and authenticates an SFTP connection
 func dialSFTP(url, user, password string) (*sftp.Client, error) {
 	// Remove "sftp://" prefix if present
@@ -152,12 +223,12 @@ func dialSFTP(url, user, password string) (*sftp.Client, error) {
 
 	conn, err := ssh.Dial("tcp", url, config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to SFTP server: %w", err)
+		return nil, interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to connect to SFTP server: %w", err))
 	}
 
 	client, err := sftp.NewClient(conn)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create SFTP client: %w", err)
+		return nil, interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to create SFTP client: %w", err))
 	}
 
 	return client, nil
@@ -166,21 +237,26 @@ func dialSFTP(url, user, password string) (*sftp.Client, error) {
 // validateSFTPRequest validates the request fields for SFTP
 func validateSFTPRequest(req interfaces.Request, isSource bool) error {
 	if req.SFTPURL == "" {
-		return errors.New("missing SFTP URL")
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing SFTP URL"))
 	}
 	if req.SFTPUser == "" {
-		return errors.New("missing SFTP user")
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing SFTP user"))
 	}
 	if req.SFTPPassword == "" {
-		return errors.New("missing SFTP password")
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing SFTP password"))
 	}
 	if req.SFTPFILEPATH == "" {
-		return errors.New("missing file path")
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing file path"))
 	}
 	if !strings.HasPrefix(req.SFTPURL, "sftp://") {
-		return fmt.Errorf("invalid SFTP URL: %s", req.SFTPURL)
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid SFTP URL: %s", req.SFTPURL))
 	}
-	return nil
+	if isSource {
+		if err := validateChunks(req); err != nil {
+			return err
+		}
+	}
+	return validateFormat(req.Format)
 }
 
 func init() {
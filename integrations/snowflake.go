@@ -0,0 +1,315 @@
+package integrations
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+	"github.com/SkySingh04/fractal/pipeline"
+	"github.com/SkySingh04/fractal/registry"
+	"github.com/google/uuid"
+	"github.com/snowflakedb/gosnowflake"
+)
+
+// snowflakeName matches the table and stage names the destination will put in SQL
+var snowflakeName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*(\.[A-Za-z_][A-Za-z0-9_$]*){0,2}$`)
+
+// SnowflakeDestination struct represents the configuration for loading data into a Snowflake table.
+type SnowflakeDestination struct {
+	Account        string            `json:"snowflake_account" fractal:"required"`
+	User           string            `json:"snowflake_user" fractal:"required"`
+	Password       string            `json:"snowflake_password" secret:"true"`
+	PrivateKeyFile string            `json:"snowflake_private_key_file"`
+	Warehouse      string            `json:"snowflake_warehouse"`
+	Database       string            `json:"snowflake_database"`
+	Schema         string            `json:"snowflake_schema"`
+	Role           string            `json:"snowflake_role"`
+	Table          string            `json:"snowflake_table" fractal:"required"`
+	Stage          string            `json:"snowflake_stage"`
+	Options        map[string]string `json:"options"`
+}
+
+// SendData loads the records into the Snowflake table the way Snowflake
+// recommends for bulk loads: the batch is written to a file, PUT on a stage
+// and loaded with COPY INTO. Each call loads one file, so delivery.batchsize
+// sets the file size. The table is created when it does not exist.
+func (s SnowflakeDestination) SendData(data interface{}, req interfaces.Request) error {
+	if req.SnowflakeAccount == "" || req.SnowflakeUser == "" || req.SnowflakeTable == "" {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing Snowflake account, user or table"))
+	}
+	if req.SnowflakePassword == "" && req.SnowflakePrivateKeyFile == "" {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing Snowflake password or private key file"))
+	}
+	if !snowflakeName.MatchString(req.SnowflakeTable) {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid Snowflake table name %q", req.SnowflakeTable))
+	}
+	if req.SnowflakeStage != "" && !snowflakeName.MatchString(req.SnowflakeStage) {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid Snowflake stage name %q", req.SnowflakeStage))
+	}
+	cfg, err := snowflakeConfig(req)
+	if err != nil {
+		return err
+	}
+	dataset := pipeline.NewDataset(data)
+	if !dataset.Structured() {
+		return errors.New("invalid data format for Snowflake destination")
+	}
+	records := make([]pipeline.Record, len(dataset.Records))
+	for i, rec := range dataset.Records {
+		records[i] = rec.Copy()
+		delete(records[i], pipeline.TableField)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	db := sql.OpenDB(gosnowflake.NewConnector(gosnowflake.SnowflakeDriver{}, *cfg))
+	defer db.Close()
+	if err := ensureSnowflakeTable(db, req.SnowflakeTable, records); err != nil {
+		return err
+	}
+
+	file, err := writeSnowflakeFile(records)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file)
+
+	stagePath := SnowflakeStagePath(req.SnowflakeTable, req.SnowflakeStage)
+	logger.Infof("Staging %d rows for Snowflake table %s at %s", len(records), req.SnowflakeTable, stagePath)
+	if _, err := db.Exec(SnowflakePutQuery(file, stagePath)); err != nil {
+		return fmt.Errorf("failed to stage file for Snowflake: %w", err)
+	}
+	copyQuery, staged := SnowflakeCopyQuery(req.SnowflakeTable, stagePath, file)
+	return runSnowflakeCopy(db, copyQuery, staged)
+}
+
+// SnowflakeStagePath returns where the batches of a table are staged: the
+// table's own stage unless a named internal stage is given
+func SnowflakeStagePath(table, stage string) string {
+	if stage != "" {
+		return "@" + stage + "/fractal"
+	}
+	return "@%" + table + "/fractal"
+}
+
+// SnowflakePutQuery returns the PUT uploading the local file to the stage path.
+// PUT compresses it, adding .gz to its name.
+func SnowflakePutQuery(file, stagePath string) string {
+	return fmt.Sprintf("PUT 'file://%s' %s AUTO_COMPRESS=TRUE OVERWRITE=TRUE", filepath.ToSlash(file), stagePath)
+}
+
+// SnowflakeCopyQuery returns the COPY INTO loading the file PUT on the stage
+// path into the table, and the path of the staged file. A file with a bad row
+// is skipped whole, and a loaded file is removed from the stage.
+func SnowflakeCopyQuery(table, stagePath, file string) (string, string) {
+	staged := filepath.Base(file) + ".gz"
+	query := fmt.Sprintf(
+		"COPY INTO %s FROM %s FILES = ('%s') FILE_FORMAT = (TYPE = JSON) MATCH_BY_COLUMN_NAME = CASE_INSENSITIVE ON_ERROR = SKIP_FILE PURGE = TRUE",
+		table, stagePath, staged)
+	return query, stagePath + "/" + staged
+}
+
+// snowflakeConfig builds the connection settings, signing in with the private
+// key when one is given and with the password otherwise
+func snowflakeConfig(req interfaces.Request) (*gosnowflake.Config, error) {
+	cfg := &gosnowflake.Config{
+		Account:   req.SnowflakeAccount,
+		User:      req.SnowflakeUser,
+		Password:  req.SnowflakePassword,
+		Warehouse: req.SnowflakeWarehouse,
+		Database:  req.SnowflakeDatabase,
+		Schema:    req.SnowflakeSchema,
+		Role:      req.SnowflakeRole,
+	}
+	// Options are session parameters, such as QUERY_TAG
+	if len(req.Options) > 0 {
+		cfg.Params = make(map[string]*string, len(req.Options))
+		for key, value := range req.Options {
+			value := value
+			cfg.Params[key] = &value
+		}
+	}
+	if req.SnowflakePrivateKeyFile == "" {
+		return cfg, nil
+	}
+	key, err := readSnowflakePrivateKey(req.SnowflakePrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Authenticator = gosnowflake.AuthTypeJwt
+	cfg.PrivateKey = key
+	cfg.Password = ""
+	return cfg, nil
+}
+
+// OptionsTarget says the options are set as session parameters
+func (s SnowflakeDestination) OptionsTarget() string {
+	return "session parameters"
+}
+
+// readSnowflakePrivateKey reads an unencrypted PKCS#8 RSA key, as Snowflake's key-pair authentication uses
+func readSnowflakePrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Snowflake private key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("Snowflake private key %s is not PEM encoded", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Snowflake private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("Snowflake private key %s is not an RSA key", path)
+	}
+	return key, nil
+}
+
+// ensureSnowflakeTable creates the table, with column types inferred from the records, if it does not exist
+func ensureSnowflakeTable(db *sql.DB, table string, records []pipeline.Record) error {
+	query, err := SnowflakeCreateTableQuery(table, records)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(query); err != nil {
+		return fmt.Errorf("failed to create Snowflake table %s: %w", table, err)
+	}
+	return nil
+}
+
+// SnowflakeCreateTableQuery returns the CREATE TABLE IF NOT EXISTS for the
+// table, with a column per field of the records in alphabetical order.
+// Fields holding values of different types become VARCHAR, except integers
+// mixed with floats, which become FLOAT.
+func SnowflakeCreateTableQuery(table string, records []pipeline.Record) (string, error) {
+	types := make(map[string]string)
+	for _, rec := range records {
+		for name, value := range rec {
+			if value == nil {
+				if _, ok := types[name]; !ok {
+					types[name] = ""
+				}
+				continue
+			}
+			colType := snowflakeType(value)
+			if current := types[name]; current != "" && current != colType {
+				if numeric := map[string]bool{"NUMBER(38,0)": true, "FLOAT": true}; numeric[current] && numeric[colType] {
+					colType = "FLOAT"
+				} else {
+					colType = "VARCHAR"
+				}
+			}
+			types[name] = colType
+		}
+	}
+	row := make(map[string]interface{}, len(types))
+	for name := range types {
+		row[name] = nil
+	}
+	var columns []string
+	for _, name := range sortedColumns(row) {
+		colType := types[name]
+		if colType == "" {
+			colType = "VARCHAR"
+		}
+		// Quoting would make the names case sensitive, which COPY's column matching ignores anyway
+		if !snowflakeName.MatchString(name) || strings.Contains(name, ".") {
+			return "", fmt.Errorf("field %q cannot be used as a Snowflake column name", name)
+		}
+		columns = append(columns, name+" "+colType)
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", table, strings.Join(columns, ", ")), nil
+}
+
+// snowflakeType maps a record value to the Snowflake column type that holds it
+func snowflakeType(value interface{}) string {
+	switch value.(type) {
+	case bool:
+		return "BOOLEAN"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "NUMBER(38,0)"
+	case float32, float64:
+		return "FLOAT"
+	case time.Time:
+		return "TIMESTAMP_TZ"
+	case map[string]interface{}, []interface{}:
+		return "VARIANT"
+	}
+	return "VARCHAR"
+}
+
+// writeSnowflakeFile writes the records as newline-delimited JSON to a temporary file
+func writeSnowflakeFile(records []pipeline.Record) (string, error) {
+	file, err := os.CreateTemp("", "fractal-"+uuid.NewString()+"-*.json")
+	if err != nil {
+		return "", fmt.Errorf("failed to create Snowflake load file: %w", err)
+	}
+	encoder := json.NewEncoder(file)
+	for _, rec := range records {
+		if err := encoder.Encode(rec); err != nil {
+			file.Close()
+			os.Remove(file.Name())
+			return "", fmt.Errorf("failed to write Snowflake load file: %w", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to write Snowflake load file: %w", err)
+	}
+	return file.Name(), nil
+}
+
+// runSnowflakeCopy runs COPY INTO and turns a file Snowflake skipped into an
+// error carrying its load error details. The skipped file stays on the stage
+// for inspection.
+func runSnowflakeCopy(db *sql.DB, query, stagedFile string) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return fmt.Errorf("failed to load %s into Snowflake: %w", stagedFile, err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		result := make(map[string]string, len(columns))
+		for i, column := range columns {
+			result[strings.ToLower(column)] = values[i].String
+		}
+		if status := result["status"]; status != "" && status != "LOADED" {
+			return fmt.Errorf("Snowflake did not load %s (%s): %s errors seen, first error %q at line %s, column %s",
+				stagedFile, status, result["errors_seen"], result["first_error"], result["first_error_line"], result["first_error_column_name"])
+		}
+		logger.Infof("Snowflake loaded %s rows from %s", result["rows_loaded"], stagedFile)
+	}
+	return rows.Err()
+}
+
+// Initialize the Snowflake integration by registering it with the registry.
+func init() {
+	registry.RegisterDestination("Snowflake", SnowflakeDestination{})
+}
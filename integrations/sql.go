@@ -1,46 +1,123 @@
 package integrations
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/SkySingh04/fractal/interfaces"
 	"github.com/SkySingh04/fractal/logger"
+	"github.com/SkySingh04/fractal/pipeline"
 	"github.com/SkySingh04/fractal/registry"
-	_ "github.com/lib/pq" // PostgreSQL driver
+	"github.com/lib/pq" // PostgreSQL driver
 )
 
 // PostgreSQLSource struct represents the configuration for consuming messages from PostgreSQL.
 type PostgreSQLSource struct {
-	ConnString string `json:"postgresql_source_conn_string"`
+	ConnString      string            `json:"postgresql_source_conn_string" fractal:"required"`
+	Incremental     bool              `json:"postgresql_source_incremental"`
+	WatermarkColumn string            `json:"postgresql_source_watermark_column"`
+	CheckpointFile  string            `json:"postgresql_source_checkpoint_file"`
+	Options         map[string]string `json:"options"`
+
+	open SQLOpener
+}
+
+// NewPostgreSQLSource returns a source reading from the databases open
+// returns, such as one that does not need a server
+func NewPostgreSQLSource(open SQLOpener) PostgreSQLSource {
+	return PostgreSQLSource{open: open}
 }
 
+// pendingWatermarks holds the watermarks read by FetchData until Commit
+// persists them, keyed by checkpoint file
+var pendingWatermarks = struct {
+	sync.Mutex
+	files map[string]map[string]string
+}{files: map[string]map[string]string{}}
+
 // PostgreSQLDestination struct represents the configuration for publishing messages to PostgreSQL.
 type PostgreSQLDestination struct {
-	ConnString string `json:"postgresql_target_conn_string"`
+	ConnString      string            `json:"postgresql_target_conn_string" fractal:"required"`
+	ConflictColumns []string          `json:"postgresql_target_conflict_columns"`
+	PreSQL          []string          `json:"postgresql_target_pre_sql"`
+	PostSQL         []string          `json:"postgresql_target_post_sql"`
+	PostSQLFatal    bool              `json:"postgresql_target_post_sql_fatal"`
+	Table           string            `json:"postgresql_target_table"`
+	SchemaCheck     bool              `json:"postgresql_target_schema_check"`
+	Options         map[string]string `json:"options"`
+
+	open SQLOpener
+}
+
+// SQLOpener opens the database a PostgreSQL integration connects to
+type SQLOpener func(connString string) (*sql.DB, error)
+
+// NewPostgreSQLDestination returns a destination writing through the
+// databases open returns, such as one that does not need a server
+func NewPostgreSQLDestination(open SQLOpener) PostgreSQLDestination {
+	return PostgreSQLDestination{open: open}
+}
+
+// openPostgreSQL is the SQLOpener connecting to a PostgreSQL server
+func openPostgreSQL(connString string) (*sql.DB, error) {
+	return sql.Open("postgres", connString)
 }
 
 // FetchData connects to PostgreSQL, retrieves data, and returns it.
 func (p PostgreSQLSource) FetchData(req interfaces.Request) (interface{}, error) {
 	if req.SQLSourceConnString == "" {
-		return nil, errors.New("missing PostgreSQL source connection string")
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing PostgreSQL source connection string"))
+	}
+	if req.SQLSourceIncremental && req.SQLSourceWatermarkColumn == "" {
+		return nil, errors.New("incremental PostgreSQL reads need a watermark column")
 	}
 	logger.Infof("Connecting to PostgreSQL source...")
 
-	db, err := sql.Open("postgres", req.SQLSourceConnString)
+	// In incremental mode only rows past the last committed watermark are read
+	var checkpoint *pipeline.Checkpoint
+	watermarks := make(map[string]string)
+	if req.SQLSourceIncremental {
+		var err error
+		checkpoint, err = pipeline.LoadCheckpoint(checkpointFile(req))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	connString, err := connStringWithOptions(req.SQLSourceConnString, req.Options)
 	if err != nil {
-		return nil, err
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	open := p.open
+	if open == nil {
+		open = openPostgreSQL
+	}
+	db, err := open(connString)
+	if err != nil {
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, err)
 	}
 	defer db.Close()
 
-	// Retrieve the list of all tables in the public schema
-	tablesQuery := "SELECT table_name FROM information_schema.tables WHERE table_schema = 'public'"
-	rows, err := db.Query(tablesQuery)
+	// Retrieve the list of all tables in the public schema. This is the first query, so it is where connecting fails.
+	// Incremental reads also ask which tables have the watermark column, as only those can be read past a watermark.
+	tablesQuery := "SELECT table_name, false FROM information_schema.tables WHERE table_schema = 'public'"
+	var tablesArgs []interface{}
+	if req.SQLSourceIncremental {
+		tablesQuery = "SELECT t.table_name, EXISTS (SELECT 1 FROM information_schema.columns c" +
+			" WHERE c.table_schema = t.table_schema AND c.table_name = t.table_name AND c.column_name = $1)" +
+			" FROM information_schema.tables t WHERE t.table_schema = 'public'"
+		tablesArgs = append(tablesArgs, req.SQLSourceWatermarkColumn)
+	}
+	rows, err := db.Query(tablesQuery, tablesArgs...)
 	if err != nil {
-		return nil, err
+		return nil, interfaces.Wrap(interfaces.ErrConnection, err)
 	}
 	defer rows.Close()
 
@@ -49,14 +126,32 @@ func (p PostgreSQLSource) FetchData(req interfaces.Request) (interface{}, error)
 
 	for rows.Next() {
 		var tableName string
-		if err := rows.Scan(&tableName); err != nil {
+		var hasWatermark bool
+		if err := rows.Scan(&tableName, &hasWatermark); err != nil {
 			return nil, err
 		}
+		if req.SQLSourceIncremental && !hasWatermark {
+			logger.Infof("Skipping table %s: it has no watermark column %s", tableName, req.SQLSourceWatermarkColumn)
+			continue
+		}
 
 		// For each table, fetch its data
 		dataQuery := "SELECT * FROM " + tableName // Fetch all columns from the table
-		dataRows, err := db.Query(dataQuery)
+		var args []interface{}
+		key := watermarkKey(tableName, req.SQLSourceWatermarkColumn)
+		if req.SQLSourceIncremental {
+			column := pq.QuoteIdentifier(req.SQLSourceWatermarkColumn)
+			if last, ok := checkpoint.Values[key]; ok {
+				dataQuery += " WHERE " + column + " > $1"
+				args = append(args, last)
+			}
+			dataQuery += " ORDER BY " + column
+		}
+		dataRows, err := db.Query(dataQuery, args...)
 		if err != nil {
+			if req.SQLSourceIncremental {
+				return nil, fmt.Errorf("failed to read table %s incrementally: %w", tableName, err)
+			}
 			logger.Errorf("Error querying table %s: %s", tableName, err)
 			continue // Skip this table on error
 		}
@@ -85,6 +180,11 @@ func (p PostgreSQLSource) FetchData(req interfaces.Request) (interface{}, error)
 				rowData[colName] = val
 			}
 			allResults[tableName] = append(allResults[tableName], rowData) // Append row data to the appropriate table key
+
+			// Rows come in watermark order, with nulls last, so the last non-null value is the highest
+			if value := rowData[req.SQLSourceWatermarkColumn]; req.SQLSourceIncremental && value != nil {
+				watermarks[key] = watermarkString(value)
+			}
 		}
 
 		if err := dataRows.Err(); err != nil {
@@ -96,15 +196,75 @@ func (p PostgreSQLSource) FetchData(req interfaces.Request) (interface{}, error)
 		return nil, err
 	}
 
+	if req.SQLSourceIncremental {
+		pendingWatermarks.Lock()
+		pendingWatermarks.files[checkpointFile(req)] = watermarks
+		pendingWatermarks.Unlock()
+	}
+
 	logger.Infof("Data fetched from PostgreSQL: %v", allResults)
 	return allResults, nil
 }
 
+// Commit persists the watermarks of the last incremental FetchData, once the run has delivered its rows
+func (p PostgreSQLSource) Commit(req interfaces.Request) error {
+	if !req.SQLSourceIncremental {
+		return nil
+	}
+	path := checkpointFile(req)
+	pendingWatermarks.Lock()
+	defer pendingWatermarks.Unlock()
+	watermarks, ok := pendingWatermarks.files[path]
+	if !ok || len(watermarks) == 0 {
+		return nil
+	}
+
+	checkpoint, err := pipeline.LoadCheckpoint(path)
+	if err != nil {
+		return err
+	}
+	for key, value := range watermarks {
+		checkpoint.Values[key] = value
+	}
+	if err := checkpoint.Save(path); err != nil {
+		return err
+	}
+	delete(pendingWatermarks.files, path)
+	logger.Infof("Saved watermarks for %d table(s) to %s", len(watermarks), path)
+	return nil
+}
+
+// checkpointFile is where the request's watermarks are kept
+func checkpointFile(req interfaces.Request) string {
+	if req.SQLSourceCheckpointFile != "" {
+		return req.SQLSourceCheckpointFile
+	}
+	return pipeline.DefaultCheckpointFile
+}
+
+// watermarkKey names a table's watermark in the checkpoint. The column is part
+// of the key so switching columns starts that table from scratch.
+func watermarkKey(table, column string) string {
+	return "postgresql:" + table + "." + column
+}
+
+// watermarkString renders a watermark so PostgreSQL can compare it with the column again
+func watermarkString(value interface{}) string {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(value)
+}
+
 // EnsureTableExistsWorker processes table creation tasks.
 func EnsureTableExistsWorker(db *sql.DB, tasks chan map[string]interface{}, errorsChan chan error, done chan bool) {
 	for task := range tasks {
 		tableName := task["tableName"].(string)
 		row := task["row"].(map[string]interface{})
+		primaryKey, _ := task["primaryKey"].([]string)
 
 		// Check if table exists
 		checkQuery := fmt.Sprintf("SELECT to_regclass('public.%s')", tableName)
@@ -118,7 +278,8 @@ func EnsureTableExistsWorker(db *sql.DB, tasks chan map[string]interface{}, erro
 		// If table does not exist, create it
 		if !tableExists.Valid {
 			var columns []string
-			for colName, value := range row {
+			for _, colName := range sortedColumns(row) {
+				value := row[colName]
 				colType := "TEXT" // Default to TEXT type
 				switch value.(type) {
 				case int, int32, int64:
@@ -130,6 +291,10 @@ func EnsureTableExistsWorker(db *sql.DB, tasks chan map[string]interface{}, erro
 				}
 				columns = append(columns, fmt.Sprintf("%s %s", colName, colType))
 			}
+			// Upserts need a unique constraint on the conflict columns
+			if len(primaryKey) > 0 {
+				columns = append(columns, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(primaryKey, ", ")))
+			}
 			createQuery := fmt.Sprintf("CREATE TABLE %s (%s)", tableName, strings.Join(columns, ", "))
 			if _, err := db.Exec(createQuery); err != nil {
 				errorsChan <- err
@@ -142,7 +307,8 @@ func EnsureTableExistsWorker(db *sql.DB, tasks chan map[string]interface{}, erro
 }
 
 // EnsureTableExists enqueues table creation tasks and processes them concurrently.
-func EnsureTableExists(db *sql.DB, tableName string, row map[string]interface{}) error {
+// A table it creates gets the primary key, if one is given.
+func EnsureTableExists(db *sql.DB, tableName string, row map[string]interface{}, primaryKey ...string) error {
 	// Buffered channels to queue tasks and capture errors
 	tasks := make(chan map[string]interface{}, 1)
 	errorsChan := make(chan error, 1)
@@ -153,8 +319,9 @@ func EnsureTableExists(db *sql.DB, tableName string, row map[string]interface{})
 
 	// Enqueue the task
 	tasks <- map[string]interface{}{
-		"tableName": tableName,
-		"row":       row,
+		"tableName":  tableName,
+		"row":        row,
+		"primaryKey": primaryKey,
 	}
 	close(tasks) // Signal no more tasks
 
@@ -174,26 +341,53 @@ func EnsureTableExists(db *sql.DB, tableName string, row map[string]interface{})
 // SendData connects to PostgreSQL and publishes data to the specified table.
 func (p PostgreSQLDestination) SendData(data interface{}, req interfaces.Request) error {
 	if req.SQLTargetConnString == "" {
-		return errors.New("missing PostgreSQL target connection string")
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing PostgreSQL target connection string"))
 	}
 	logger.Infof("Connecting to PostgreSQL destination...")
 
-	db, err := sql.Open("postgres", req.SQLTargetConnString)
+	connString, err := connStringWithOptions(req.SQLTargetConnString, req.Options)
 	if err != nil {
-		return err
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	open := p.open
+	if open == nil {
+		open = openPostgreSQL
+	}
+	db, err := open(connString)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, err)
 	}
 	defer db.Close()
 
-	// Assert that data is a map with table names as keys and slices of maps as values
+	// Assert that data is a map with table names as keys and slices of maps as
+	// values, unless a target table takes every row whatever its source
 	dataMap, ok := data.(map[string][]map[string]interface{})
+	if req.SQLTargetTable != "" {
+		dataMap, ok = targetTableRows(data, req.SQLTargetTable)
+	}
 	if !ok {
 		return errors.New("data must be a map with table names as keys and slices of maps as values")
 	}
 
+	// Check every row has the key before anything is written
 	for tableName, rows := range dataMap {
+		if err := checkConflictColumns(tableName, rows, req.SQLTargetConflictColumns); err != nil {
+			return err
+		}
+	}
+
+	var rejected []pipeline.RejectedRow
+	for tableName, rows := range dataMap {
+		if req.SQLTargetSchemaCheck {
+			var refused []pipeline.RejectedRow
+			if rows, refused, err = checkTableRows(db, req.SQLTargetConnString, tableName, rows); err != nil {
+				return err
+			}
+			rejected = append(rejected, refused...)
+		}
 		for _, row := range rows {
 			// Ensure the table exists
-			if err := EnsureTableExists(db, tableName, row); err != nil {
+			if err := EnsureTableExists(db, tableName, row, req.SQLTargetConflictColumns...); err != nil {
 				return err
 			}
 
@@ -202,25 +396,244 @@ func (p PostgreSQLDestination) SendData(data interface{}, req interfaces.Request
 			var placeholders []string
 			var values []interface{}
 
-			for colName, value := range row {
+			for _, colName := range sortedColumns(row) {
 				columns = append(columns, colName)
 				placeholders = append(placeholders, "$"+strconv.Itoa(len(values)+1))
-				values = append(values, value)
+				values = append(values, row[colName])
 			}
 
 			// Construct the INSERT query
 			query := "INSERT INTO " + tableName + " (" + strings.Join(columns, ", ") + ") VALUES (" + strings.Join(placeholders, ", ") + ")"
+			query += upsertClause(columns, req.SQLTargetConflictColumns)
 
 			if _, err := db.Exec(query, values...); err != nil {
 				logger.Errorf("Error inserting into table %s: %s", tableName, err)
-				return err // Return on error
+				return interfaces.Wrap(interfaces.ErrWrite, fmt.Errorf("failed to insert into table %s: %w", tableName, err))
 			}
 		}
 	}
 
+	if len(rejected) > 0 {
+		return &pipeline.RejectedRowsError{Rows: rejected}
+	}
 	return nil
 }
 
+// checkTableRows splits the rows into those that fit the table's columns and
+// those that do not. Every row fits a table that does not exist yet, as it is
+// created from the first of them.
+func checkTableRows(db *sql.DB, connString, tableName string, rows []map[string]interface{}) ([]map[string]interface{}, []pipeline.RejectedRow, error) {
+	columns, err := tableColumns(db, connString, tableName)
+	if err != nil || columns == nil {
+		return rows, nil, err
+	}
+	var fit []map[string]interface{}
+	var rejected []pipeline.RejectedRow
+	for _, row := range rows {
+		if err := CheckSQLRow(row, columns); err != nil {
+			rejected = append(rejected, pipeline.RejectedRow{Record: row, Reason: fmt.Sprintf("table %s: %v", tableName, err)})
+			continue
+		}
+		fit = append(fit, row)
+	}
+	return fit, rejected, nil
+}
+
+// ValidateConfig checks the conflict columns name each key column once, and
+// that no pre or post statement is empty
+func (p PostgreSQLDestination) ValidateConfig(req interfaces.Request) error {
+	for _, statement := range append(append([]string{}, req.SQLTargetPreSQL...), req.SQLTargetPostSQL...) {
+		if strings.TrimSpace(statement) == "" {
+			return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("empty presql or postsql statement"))
+		}
+	}
+	seen := make(map[string]bool, len(req.SQLTargetConflictColumns))
+	for _, column := range req.SQLTargetConflictColumns {
+		if strings.TrimSpace(column) == "" {
+			return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("empty conflict column"))
+		}
+		if seen[column] {
+			return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("conflict column %s is listed twice", column))
+		}
+		seen[column] = true
+	}
+	return nil
+}
+
+// Prepare runs the pre statements before the first write, and forgets the
+// table columns an earlier run read, as the statements may change them
+func (p PostgreSQLDestination) Prepare(req interfaces.Request) error {
+	forgetTableSchemas(req.SQLTargetConnString)
+	if len(req.SQLTargetPreSQL) == 0 {
+		return nil
+	}
+	if err := runSQLStatements(req.SQLTargetConnString, req.Options, req.SQLTargetPreSQL); err != nil {
+		return fmt.Errorf("presql failed: %w", err)
+	}
+	logger.Infof("Ran %d presql statement(s)", len(req.SQLTargetPreSQL))
+	return nil
+}
+
+// Finish runs the post statements once the run has written everything. A
+// failure only fails the run when SQLTargetPostSQLFatal is set; otherwise it
+// is logged and the written rows stand.
+func (p PostgreSQLDestination) Finish(req interfaces.Request) error {
+	if len(req.SQLTargetPostSQL) == 0 {
+		return nil
+	}
+	if err := runSQLStatements(req.SQLTargetConnString, req.Options, req.SQLTargetPostSQL); err != nil {
+		if req.SQLTargetPostSQLFatal {
+			return fmt.Errorf("postsql failed: %w", err)
+		}
+		logger.Infof("Postsql failed, the written rows are kept: %v", err)
+		return nil
+	}
+	logger.Infof("Ran %d postsql statement(s)", len(req.SQLTargetPostSQL))
+	return nil
+}
+
+// Target returns the table rows are written to, empty for the tables they were read from
+func (p PostgreSQLDestination) Target(req interfaces.Request) string {
+	return req.SQLTargetTable
+}
+
+// WithTarget returns the request writing every row to table
+func (p PostgreSQLDestination) WithTarget(req interfaces.Request, table string) interfaces.Request {
+	req.SQLTargetTable = table
+	return req
+}
+
+// targetTableRows puts every record of data in one table
+func targetTableRows(data interface{}, table string) (map[string][]map[string]interface{}, bool) {
+	dataset := pipeline.NewDataset(data)
+	if !dataset.Structured() {
+		return nil, false
+	}
+	rows := make([]map[string]interface{}, len(dataset.Records))
+	for i, rec := range dataset.Records {
+		rec = rec.Copy()
+		delete(rec, pipeline.TableField)
+		rows[i] = rec
+	}
+	return map[string][]map[string]interface{}{table: rows}, true
+}
+
+// Ping checks the PostgreSQL source accepts connections
+func (p PostgreSQLSource) Ping(ctx context.Context, req interfaces.Request) error {
+	return pingPostgreSQL(ctx, req.SQLSourceConnString, req.Options, "source")
+}
+
+// Ping checks the PostgreSQL destination accepts connections
+func (p PostgreSQLDestination) Ping(ctx context.Context, req interfaces.Request) error {
+	return pingPostgreSQL(ctx, req.SQLTargetConnString, req.Options, "target")
+}
+
+// OptionsTarget says the options are added to the connection string
+func (p PostgreSQLSource) OptionsTarget() string {
+	return "connection string parameters"
+}
+
+// OptionsTarget says the options are added to the connection string
+func (p PostgreSQLDestination) OptionsTarget() string {
+	return "connection string parameters"
+}
+
+// pingPostgreSQL connects to the database and closes the connection again
+func pingPostgreSQL(ctx context.Context, connString string, options map[string]string, role string) error {
+	if connString == "" {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("missing PostgreSQL %s connection string", role))
+	}
+	connString, err := connStringWithOptions(connString, options)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	db, err := sql.Open("postgres", connString)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	defer db.Close()
+	if err := db.PingContext(ctx); err != nil {
+		return interfaces.Wrap(interfaces.ErrConnection, err)
+	}
+	return nil
+}
+
+// runSQLStatements runs the statements in order in one transaction, so a
+// failing statement leaves none of them applied
+func runSQLStatements(connString string, options map[string]string, statements []string) error {
+	if connString == "" {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing PostgreSQL target connection string"))
+	}
+	connString, err := connStringWithOptions(connString, options)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	db, err := sql.Open("postgres", connString)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConnection, err)
+	}
+	for i, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("statement %d: %w", i+1, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// checkConflictColumns fails when a row of the table lacks one of the conflict columns
+func checkConflictColumns(tableName string, rows []map[string]interface{}, conflict []string) error {
+	for i, row := range rows {
+		for _, column := range conflict {
+			if _, ok := row[column]; !ok {
+				return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("conflict column %s is not in row %d of table %s", column, i, tableName))
+			}
+		}
+	}
+	return nil
+}
+
+// upsertClause turns an insert into an upsert on the conflict columns, which
+// may form a composite key. The other columns are updated from the new row;
+// when every column is part of the key there is nothing to update.
+func upsertClause(columns, conflict []string) string {
+	if len(conflict) == 0 {
+		return ""
+	}
+	key := make(map[string]bool, len(conflict))
+	for _, column := range conflict {
+		key[column] = true
+	}
+	var updates []string
+	for _, column := range columns {
+		if !key[column] {
+			updates = append(updates, column+" = EXCLUDED."+column)
+		}
+	}
+	clause := " ON CONFLICT (" + strings.Join(conflict, ", ") + ")"
+	if len(updates) == 0 {
+		return clause + " DO NOTHING"
+	}
+	return clause + " DO UPDATE SET " + strings.Join(updates, ", ")
+}
+
+// sortedColumns returns the row's column names in alphabetical order, so tables
+// are created and written with the same column order on every run
+func sortedColumns(row map[string]interface{}) []string {
+	columns := make([]string, 0, len(row))
+	for colName := range row {
+		columns = append(columns, colName)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
 // Initialize the PostgreSQL integrations by registering them with the registry.
 func init() {
 	registry.RegisterSource("PostgreSQL", PostgreSQLSource{})
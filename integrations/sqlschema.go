@@ -0,0 +1,254 @@
+package integrations
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/SkySingh04/fractal/pipeline"
+)
+
+// SQLColumn is a column of a destination table, as read from information_schema
+type SQLColumn struct {
+	Name       string
+	Type       string // data_type, such as integer or character varying
+	Nullable   bool
+	HasDefault bool
+	MaxLength  int // Characters a character column holds, 0 when unlimited
+}
+
+// tableSchemas holds the columns of the destination tables read so far, keyed
+// by connection string and table. Prepare forgets a connection's tables, so
+// each run reads them once, after its presql statements.
+var tableSchemas = struct {
+	sync.Mutex
+	tables map[string]map[string]SQLColumn
+}{tables: map[string]map[string]SQLColumn{}}
+
+// sqlUUID matches the text form of a UUID
+var sqlUUID = regexp.MustCompile(`^(?i)\{?[0-9a-f]{8}-?[0-9a-f]{4}-?[0-9a-f]{4}-?[0-9a-f]{4}-?[0-9a-f]{12}\}?$`)
+
+// sqlTimeLayouts are the layouts a text value of a date or time column is
+// checked against; PostgreSQL reads more, so rows in other layouts are rejected
+var sqlTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999999", "2006-01-02", "15:04:05.999999999", "15:04"}
+
+// forgetTableSchemas drops the cached columns of the tables of a connection
+func forgetTableSchemas(connString string) {
+	tableSchemas.Lock()
+	defer tableSchemas.Unlock()
+	for key := range tableSchemas.tables {
+		if strings.HasPrefix(key, connString+"\x00") {
+			delete(tableSchemas.tables, key)
+		}
+	}
+}
+
+// tableColumns returns the columns of the table by lower case name, reading
+// them on the first call of the run, or nil when the table does not exist yet
+func tableColumns(db *sql.DB, connString, table string) (map[string]SQLColumn, error) {
+	key := connString + "\x00" + table
+	tableSchemas.Lock()
+	columns, ok := tableSchemas.tables[key]
+	tableSchemas.Unlock()
+	if ok {
+		return columns, nil
+	}
+
+	schema, name := "public", table
+	if before, after, found := strings.Cut(table, "."); found {
+		schema, name = before, after
+	}
+	rows, err := db.Query(`SELECT column_name, data_type, is_nullable = 'YES', column_default IS NOT NULL, COALESCE(character_maximum_length, 0)
+		FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2`, strings.ToLower(schema), strings.ToLower(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the columns of table %s: %w", table, err)
+	}
+	defer rows.Close()
+	columns = map[string]SQLColumn{}
+	for rows.Next() {
+		var column SQLColumn
+		if err := rows.Scan(&column.Name, &column.Type, &column.Nullable, &column.HasDefault, &column.MaxLength); err != nil {
+			return nil, fmt.Errorf("failed to read the columns of table %s: %w", table, err)
+		}
+		columns[strings.ToLower(column.Name)] = column
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the columns of table %s: %w", table, err)
+	}
+	// A missing table is created from the first row, so it is read again next time
+	if len(columns) == 0 {
+		return nil, nil
+	}
+	tableSchemas.Lock()
+	tableSchemas.tables[key] = columns
+	tableSchemas.Unlock()
+	return columns, nil
+}
+
+// CheckSQLRow checks a row fits the table's columns: every column is one
+// of the table's, each value can be stored in its column's type, and no
+// column that needs a value is left null
+func CheckSQLRow(row map[string]interface{}, columns map[string]SQLColumn) error {
+	for _, name := range sortedColumns(row) {
+		column, ok := columns[strings.ToLower(name)]
+		if !ok {
+			return fmt.Errorf("column %s is not in the table", name)
+		}
+		value := row[name]
+		if value == nil {
+			if !column.Nullable {
+				return fmt.Errorf("column %s is NOT NULL, but the value is null", column.Name)
+			}
+			continue
+		}
+		if err := checkSQLValue(value, column); err != nil {
+			return fmt.Errorf("column %s of type %s: %w", column.Name, column.Type, err)
+		}
+	}
+	for key, column := range columns {
+		if column.Nullable || column.HasDefault {
+			continue
+		}
+		found := false
+		for name := range row {
+			if strings.ToLower(name) == key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("column %s is NOT NULL without a default, but the row has no value for it", column.Name)
+		}
+	}
+	return nil
+}
+
+// checkSQLValue checks a value can be stored in the column. Types it does not
+// know, such as arrays and enums, are left to the database.
+func checkSQLValue(value interface{}, column SQLColumn) error {
+	switch value.(type) {
+	case map[string]interface{}, pipeline.Record, []interface{}, []map[string]interface{}:
+		return fmt.Errorf("a nested %T cannot be written", value)
+	}
+	text, isText := value.(string)
+	switch column.Type {
+	case "smallint", "integer", "bigint":
+		bits := map[string]int{"smallint": 16, "integer": 32, "bigint": 64}[column.Type]
+		return checkSQLInteger(value, bits)
+	case "numeric", "real", "double precision":
+		if isText {
+			if _, err := strconv.ParseFloat(strings.TrimSpace(text), 64); err != nil {
+				return fmt.Errorf("%q is not a number", text)
+			}
+			return nil
+		}
+		if _, ok := sqlNumber(value); !ok {
+			return fmt.Errorf("%T is not a number", value)
+		}
+	case "boolean":
+		if isText {
+			switch strings.ToLower(strings.TrimSpace(text)) {
+			case "t", "true", "y", "yes", "on", "1", "f", "false", "n", "no", "off", "0":
+				return nil
+			}
+			return fmt.Errorf("%q is not a boolean", text)
+		}
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%T is not a boolean", value)
+		}
+	case "character varying", "character", "text":
+		if column.MaxLength > 0 {
+			if length := utf8.RuneCountInString(fmt.Sprint(value)); length > column.MaxLength {
+				return fmt.Errorf("value is %d characters long, more than %d", length, column.MaxLength)
+			}
+		}
+	case "date", "timestamp without time zone", "timestamp with time zone", "time without time zone", "time with time zone":
+		if _, ok := value.(time.Time); ok {
+			return nil
+		}
+		if !isText {
+			return fmt.Errorf("%T is not a date or time", value)
+		}
+		for _, layout := range sqlTimeLayouts {
+			if _, err := time.Parse(layout, strings.TrimSpace(text)); err == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not a date or time", text)
+	case "uuid":
+		if !isText || !sqlUUID.MatchString(strings.TrimSpace(text)) {
+			return fmt.Errorf("%v is not a UUID", value)
+		}
+	case "json", "jsonb":
+		if isText && !json.Valid([]byte(text)) {
+			return fmt.Errorf("%q is not JSON", text)
+		}
+	}
+	return nil
+}
+
+// checkSQLInteger checks a value is a whole number that fits a column of bits bits
+func checkSQLInteger(value interface{}, bits int) error {
+	var number float64
+	if text, ok := value.(string); ok {
+		parsed, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", text)
+		}
+		number = float64(parsed)
+	} else {
+		var ok bool
+		if number, ok = sqlNumber(value); !ok {
+			return fmt.Errorf("%T is not a whole number", value)
+		}
+		if number != math.Trunc(number) {
+			return fmt.Errorf("%v is not a whole number", value)
+		}
+	}
+	limit := math.Ldexp(1, bits-1)
+	if number < -limit || number >= limit {
+		return fmt.Errorf("%v is out of range", value)
+	}
+	return nil
+}
+
+// sqlNumber returns a numeric value as a float64
+func sqlNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		number, err := v.Float64()
+		return number, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,609 @@
+package integrations
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+	"github.com/SkySingh04/fractal/pipeline"
+	"github.com/SkySingh04/fractal/registry"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// DefaultSQSMaxMessages caps the messages one run reads
+const DefaultSQSMaxMessages = 1000
+
+// DefaultSQSWaitTime is how long each receive waits for messages to arrive
+const DefaultSQSWaitTime = 20 * time.Second
+
+// Limits of the SQS and SNS APIs
+const (
+	maxSQSWaitTime          = 20 * time.Second
+	maxSQSVisibilityTimeout = 12 * time.Hour
+	maxSQSAttributes        = 10         // Message attributes per message
+	queueBatchEntries       = 10         // Messages per receive, delete, send or publish call
+	queueBatchBytes         = 256 * 1024 // Bytes of the messages in one send or publish call
+)
+
+// SQSSource reads messages from an Amazon SQS queue
+type SQSSource struct {
+	QueueURL          string   `json:"sqs_queue_url" fractal:"required"`
+	Region            string   `json:"aws_region"`             // Read from the queue URL when empty
+	MaxMessages       int      `json:"sqs_max_messages"`       // Messages read per run, defaults to 1000
+	WaitTime          string   `json:"sqs_wait_time"`          // Long poll of each receive, up to 20s, defaults to 20s
+	VisibilityTimeout string   `json:"sqs_visibility_timeout"` // How long received messages stay hidden, the queue's setting when empty
+	Attributes        []string `json:"sqs_attributes"`         // Message attributes read into record fields of the same name
+	Format            string   `json:"format"`
+	RoleARN           string   `json:"role_arn"`
+	ExternalID        string   `json:"external_id"`
+}
+
+// SQSDestination sends a message per record to an Amazon SQS queue
+type SQSDestination struct {
+	QueueURL   string   `json:"sqs_queue_url" fractal:"required"`
+	Region     string   `json:"aws_region"`      // Read from the queue URL when empty
+	Attributes []string `json:"sqs_attributes"`  // Record fields sent as message attributes as well
+	GroupField string   `json:"sqs_group_field"` // Record field holding the message group ID, for FIFO queues
+	Format     string   `json:"format"`
+	RoleARN    string   `json:"role_arn"`
+	ExternalID string   `json:"external_id"`
+}
+
+// SNSDestination publishes a message per record to an Amazon SNS topic
+type SNSDestination struct {
+	TopicARN   string   `json:"sns_topic_arn" fractal:"required"`
+	Region     string   `json:"aws_region"`      // Read from the topic ARN when empty
+	Attributes []string `json:"sqs_attributes"`  // Record fields sent as message attributes as well
+	GroupField string   `json:"sqs_group_field"` // Record field holding the message group ID, for FIFO topics
+	Format     string   `json:"format"`
+	RoleARN    string   `json:"role_arn"`
+	ExternalID string   `json:"external_id"`
+}
+
+// sqsRead is what a FetchData received, waiting for the run to deliver it
+// before the messages are deleted
+type sqsRead struct {
+	client   *sqs.SQS
+	queueURL string
+	handles  []string // Receipt handles of the messages received
+}
+
+// release makes the messages visible again, so they are redelivered straight
+// away rather than once their visibility timeout runs out
+func (r *sqsRead) release() {
+	for start := 0; start < len(r.handles); start += queueBatchEntries {
+		var entries []*sqs.ChangeMessageVisibilityBatchRequestEntry
+		for i, handle := range r.handles[start:min(start+queueBatchEntries, len(r.handles))] {
+			entries = append(entries, &sqs.ChangeMessageVisibilityBatchRequestEntry{
+				Id: aws.String(strconv.Itoa(i)), ReceiptHandle: aws.String(handle), VisibilityTimeout: aws.Int64(0),
+			})
+		}
+		if _, err := r.client.ChangeMessageVisibilityBatch(&sqs.ChangeMessageVisibilityBatchInput{QueueUrl: aws.String(r.queueURL), Entries: entries}); err != nil {
+			logger.Infof("Failed to release SQS messages on %s, they are redelivered once their visibility timeout runs out: %v", r.queueURL, err)
+			return
+		}
+	}
+}
+
+// pendingSQSReads holds the reads FetchData made until Commit deletes their
+// messages, keyed by queue URL
+var pendingSQSReads = struct {
+	sync.Mutex
+	reads map[string]*sqsRead
+}{reads: map[string]*sqsRead{}}
+
+// ValidateConfig checks the queue, the receive settings and the format
+func (s SQSSource) ValidateConfig(req interfaces.Request) error {
+	_, err := sqsSourceSettings(req)
+	return err
+}
+
+// sqsReceive holds the settings of a source's receives
+type sqsReceive struct {
+	region            string
+	maxMessages       int
+	waitTime          time.Duration
+	visibilityTimeout int64 // Seconds, -1 for the queue's setting
+}
+
+// sqsSourceSettings reads and checks the settings of an SQS source
+func sqsSourceSettings(req interfaces.Request) (*sqsReceive, error) {
+	region, err := sqsRegion(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateFormat(req.Format); err != nil {
+		return nil, err
+	}
+	if err := validateQueueAttributes(req.SQSAttributes); err != nil {
+		return nil, err
+	}
+	if req.SQSMaxMessages < 0 {
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("SQS max messages must not be negative"))
+	}
+	receive := &sqsReceive{region: region, maxMessages: req.SQSMaxMessages, waitTime: DefaultSQSWaitTime, visibilityTimeout: -1}
+	if receive.maxMessages == 0 {
+		receive.maxMessages = DefaultSQSMaxMessages
+	}
+	if req.SQSWaitTime != "" {
+		receive.waitTime, err = time.ParseDuration(req.SQSWaitTime)
+		if err != nil || receive.waitTime < 0 || receive.waitTime > maxSQSWaitTime {
+			return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid SQS wait time %q: expected a duration of at most %s, such as 10s", req.SQSWaitTime, maxSQSWaitTime))
+		}
+	}
+	if req.SQSVisibilityTimeout != "" {
+		timeout, err := time.ParseDuration(req.SQSVisibilityTimeout)
+		if err != nil || timeout < 0 || timeout > maxSQSVisibilityTimeout {
+			return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid SQS visibility timeout %q: expected a duration of at most %s, such as 5m", req.SQSVisibilityTimeout, maxSQSVisibilityTimeout))
+		}
+		receive.visibilityTimeout = int64(timeout.Seconds())
+	}
+	return receive, nil
+}
+
+// FetchData receives messages until MaxMessages have arrived or a receive
+// waits WaitTime without any. The messages are deleted by Commit, once the
+// run has delivered them, so those of a failed run are received again.
+func (s SQSSource) FetchData(req interfaces.Request) (interface{}, error) {
+	receive, err := sqsSourceSettings(req)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := awsSession(receive.region, req.AWSRoleARN, req.AWSExternalID)
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("Connecting to SQS Source: Queue=%s", req.SQSQueueURL)
+	read := &sqsRead{client: sqs.New(sess), queueURL: req.SQSQueueURL}
+
+	records := make([]map[string]interface{}, 0)
+	for len(read.handles) < receive.maxMessages {
+		input := &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(req.SQSQueueURL),
+			MaxNumberOfMessages: aws.Int64(int64(min(queueBatchEntries, receive.maxMessages-len(read.handles)))),
+			WaitTimeSeconds:     aws.Int64(int64(receive.waitTime.Seconds())),
+		}
+		if len(req.SQSAttributes) > 0 {
+			input.MessageAttributeNames = aws.StringSlice(req.SQSAttributes)
+		}
+		if receive.visibilityTimeout >= 0 {
+			input.VisibilityTimeout = aws.Int64(receive.visibilityTimeout)
+		}
+		out, err := read.client.ReceiveMessage(input)
+		if err != nil {
+			read.release()
+			return nil, interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to receive from SQS queue %s: %w", req.SQSQueueURL, err))
+		}
+		if len(out.Messages) == 0 {
+			break
+		}
+		for _, msg := range out.Messages {
+			read.handles = append(read.handles, aws.StringValue(msg.ReceiptHandle))
+			decoded, err := messageRecords([]byte(aws.StringValue(msg.Body)), "", "", req.Format)
+			if err != nil {
+				read.release()
+				return nil, fmt.Errorf("failed to read SQS message %s: %w", aws.StringValue(msg.MessageId), err)
+			}
+			for _, rec := range decoded {
+				for _, name := range req.SQSAttributes {
+					if value, ok := msg.MessageAttributes[name]; ok && value.StringValue != nil {
+						rec[name] = *value.StringValue
+					}
+				}
+			}
+			records = append(records, decoded...)
+		}
+	}
+	logger.Infof("Received %d messages from SQS queue %s", len(read.handles), req.SQSQueueURL)
+
+	pendingSQSReads.Lock()
+	// A read left over from a failed run is released so its messages are redelivered
+	if previous, ok := pendingSQSReads.reads[req.SQSQueueURL]; ok {
+		previous.release()
+	}
+	if len(read.handles) == 0 {
+		delete(pendingSQSReads.reads, req.SQSQueueURL)
+	} else {
+		pendingSQSReads.reads[req.SQSQueueURL] = read
+	}
+	pendingSQSReads.Unlock()
+	return records, nil
+}
+
+// Commit deletes the messages of the last FetchData, once the run has delivered them
+func (s SQSSource) Commit(req interfaces.Request) error {
+	pendingSQSReads.Lock()
+	read, ok := pendingSQSReads.reads[req.SQSQueueURL]
+	delete(pendingSQSReads.reads, req.SQSQueueURL)
+	pendingSQSReads.Unlock()
+	if !ok {
+		return nil
+	}
+	for start := 0; start < len(read.handles); start += queueBatchEntries {
+		var entries []*sqs.DeleteMessageBatchRequestEntry
+		for i, handle := range read.handles[start:min(start+queueBatchEntries, len(read.handles))] {
+			entries = append(entries, &sqs.DeleteMessageBatchRequestEntry{Id: aws.String(strconv.Itoa(i)), ReceiptHandle: aws.String(handle)})
+		}
+		out, err := read.client.DeleteMessageBatch(&sqs.DeleteMessageBatchInput{QueueUrl: aws.String(read.queueURL), Entries: entries})
+		if err != nil {
+			return fmt.Errorf("failed to delete SQS messages from %s: %w", read.queueURL, err)
+		}
+		if len(out.Failed) > 0 {
+			return fmt.Errorf("failed to delete %d SQS messages from %s, they will be received again: %s",
+				len(out.Failed), read.queueURL, aws.StringValue(out.Failed[0].Message))
+		}
+	}
+	logger.Infof("Deleted %d messages from SQS queue %s", len(read.handles), read.queueURL)
+	return nil
+}
+
+// Location returns the queue the messages are read from
+func (s SQSSource) Location(req interfaces.Request) string {
+	return req.SQSQueueURL
+}
+
+// ValidateConfig checks the queue, the attributes, the group field and the format
+func (d SQSDestination) ValidateConfig(req interfaces.Request) error {
+	_, err := sqsRegion(req)
+	if err != nil {
+		return err
+	}
+	return validateQueueMessages(req, strings.HasSuffix(req.SQSQueueURL, ".fifo"))
+}
+
+// SendData sends one message per record, in the format or else as JSON, in
+// batches of up to 10 messages and 256 KiB. Messages the queue refuses, such
+// as one over the size limit, are rejected while the rest are sent.
+func (d SQSDestination) SendData(data interface{}, req interfaces.Request) error {
+	if err := d.ValidateConfig(req); err != nil {
+		return err
+	}
+	messages, rejected, err := queueMessages(data, req, strings.HasSuffix(req.SQSQueueURL, ".fifo"))
+	if err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return rejectedMessages(rejected)
+	}
+	region, _ := sqsRegion(req)
+	sess, err := awsSession(region, req.AWSRoleARN, req.AWSExternalID)
+	if err != nil {
+		return err
+	}
+	client := sqs.New(sess)
+	logger.Infof("Connecting to SQS Destination: Queue=%s", req.SQSQueueURL)
+	refused, err := sendInBatches(messages, func(batch []queueMessage) ([]queueFailure, error) {
+		entries := make([]*sqs.SendMessageBatchRequestEntry, len(batch))
+		for i, msg := range batch {
+			entries[i] = &sqs.SendMessageBatchRequestEntry{Id: aws.String(strconv.Itoa(i)), MessageBody: aws.String(msg.body)}
+			if msg.group != "" {
+				entries[i].MessageGroupId = aws.String(msg.group)
+			}
+			if len(msg.attributes) > 0 {
+				entries[i].MessageAttributes = map[string]*sqs.MessageAttributeValue{}
+				for name, value := range msg.attributes {
+					entries[i].MessageAttributes[name] = &sqs.MessageAttributeValue{DataType: aws.String(value.dataType), StringValue: aws.String(value.text)}
+				}
+			}
+		}
+		out, err := client.SendMessageBatch(&sqs.SendMessageBatchInput{QueueUrl: aws.String(req.SQSQueueURL), Entries: entries})
+		if err != nil {
+			return nil, fmt.Errorf("failed to send to SQS queue %s: %w", req.SQSQueueURL, err)
+		}
+		failures := make([]queueFailure, len(out.Failed))
+		for i, failed := range out.Failed {
+			failures[i] = queueFailure{id: aws.StringValue(failed.Id), reason: aws.StringValue(failed.Code) + ": " + aws.StringValue(failed.Message), senderFault: aws.BoolValue(failed.SenderFault)}
+		}
+		return failures, nil
+	})
+	if err != nil {
+		return err
+	}
+	logger.Infof("Sent %d messages to SQS queue %s", len(messages)-len(refused), req.SQSQueueURL)
+	return rejectedMessages(append(rejected, refused...))
+}
+
+// ValidateConfig checks the topic, the attributes, the group field and the format
+func (d SNSDestination) ValidateConfig(req interfaces.Request) error {
+	_, err := snsRegion(req)
+	if err != nil {
+		return err
+	}
+	return validateQueueMessages(req, strings.HasSuffix(req.SNSTopicARN, ".fifo"))
+}
+
+// SendData publishes one message per record, in the format or else as JSON,
+// in batches of up to 10 messages and 256 KiB. Messages the topic refuses
+// are rejected while the rest are published.
+func (d SNSDestination) SendData(data interface{}, req interfaces.Request) error {
+	if err := d.ValidateConfig(req); err != nil {
+		return err
+	}
+	messages, rejected, err := queueMessages(data, req, strings.HasSuffix(req.SNSTopicARN, ".fifo"))
+	if err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return rejectedMessages(rejected)
+	}
+	region, _ := snsRegion(req)
+	sess, err := awsSession(region, req.AWSRoleARN, req.AWSExternalID)
+	if err != nil {
+		return err
+	}
+	client := sns.New(sess)
+	logger.Infof("Connecting to SNS Destination: Topic=%s", req.SNSTopicARN)
+	refused, err := sendInBatches(messages, func(batch []queueMessage) ([]queueFailure, error) {
+		entries := make([]*sns.PublishBatchRequestEntry, len(batch))
+		for i, msg := range batch {
+			entries[i] = &sns.PublishBatchRequestEntry{Id: aws.String(strconv.Itoa(i)), Message: aws.String(msg.body)}
+			if msg.group != "" {
+				entries[i].MessageGroupId = aws.String(msg.group)
+			}
+			if len(msg.attributes) > 0 {
+				entries[i].MessageAttributes = map[string]*sns.MessageAttributeValue{}
+				for name, value := range msg.attributes {
+					entries[i].MessageAttributes[name] = &sns.MessageAttributeValue{DataType: aws.String(value.dataType), StringValue: aws.String(value.text)}
+				}
+			}
+		}
+		out, err := client.PublishBatch(&sns.PublishBatchInput{TopicArn: aws.String(req.SNSTopicARN), PublishBatchRequestEntries: entries})
+		if err != nil {
+			return nil, fmt.Errorf("failed to publish to SNS topic %s: %w", req.SNSTopicARN, err)
+		}
+		failures := make([]queueFailure, len(out.Failed))
+		for i, failed := range out.Failed {
+			failures[i] = queueFailure{id: aws.StringValue(failed.Id), reason: aws.StringValue(failed.Code) + ": " + aws.StringValue(failed.Message), senderFault: aws.BoolValue(failed.SenderFault)}
+		}
+		return failures, nil
+	})
+	if err != nil {
+		return err
+	}
+	logger.Infof("Published %d messages to SNS topic %s", len(messages)-len(refused), req.SNSTopicARN)
+	return rejectedMessages(append(rejected, refused...))
+}
+
+// sqsRegion returns the region set, or else the one in the queue URL, as in
+// https://sqs.eu-west-1.amazonaws.com/123456789012/orders
+func sqsRegion(req interfaces.Request) (string, error) {
+	if req.SQSQueueURL == "" {
+		return "", interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing SQS queue URL"))
+	}
+	u, err := url.Parse(req.SQSQueueURL)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return "", interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid SQS queue URL %q: expected https://sqs.<region>.amazonaws.com/<account>/<queue>", req.SQSQueueURL))
+	}
+	if req.AWSRegion != "" {
+		return req.AWSRegion, nil
+	}
+	// Legacy queue URLs name the region first, as in eu-west-1.queue.amazonaws.com
+	parts := strings.Split(u.Hostname(), ".")
+	switch {
+	case len(parts) >= 4 && parts[0] == "sqs":
+		return parts[1], nil
+	case len(parts) >= 4 && parts[1] == "queue":
+		return parts[0], nil
+	}
+	return "", interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("cannot tell the region of SQS queue %s, set region", req.SQSQueueURL))
+}
+
+// snsRegion returns the region set, or else the one in the topic ARN, as in
+// arn:aws:sns:eu-west-1:123456789012:orders
+func snsRegion(req interfaces.Request) (string, error) {
+	parts := strings.Split(req.SNSTopicARN, ":")
+	if req.SNSTopicARN == "" {
+		return "", interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing SNS topic ARN"))
+	}
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "sns" || parts[5] == "" {
+		return "", interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid SNS topic ARN %q: expected arn:aws:sns:<region>:<account>:<topic>", req.SNSTopicARN))
+	}
+	if req.AWSRegion != "" {
+		return req.AWSRegion, nil
+	}
+	return parts[3], nil
+}
+
+// validateQueueAttributes checks the message attributes are named once each,
+// and are no more than a message holds
+func validateQueueAttributes(names []string) error {
+	if len(names) > maxSQSAttributes {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("%d message attributes are listed, a message holds at most %d", len(names), maxSQSAttributes))
+	}
+	seen := map[string]bool{}
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" {
+			return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("attributes has an empty name"))
+		}
+		if seen[name] {
+			return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("attributes names %s more than once", name))
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// validateQueueMessages checks the settings of the messages an SQS or SNS
+// destination sends. FIFO queues and topics need a group for every message.
+func validateQueueMessages(req interfaces.Request, fifo bool) error {
+	if err := validateFormat(req.Format); err != nil {
+		return err
+	}
+	if err := validateQueueAttributes(req.SQSAttributes); err != nil {
+		return err
+	}
+	if fifo && req.SQSGroupField == "" {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("a FIFO queue or topic needs groupfield, the record field holding each message's group"))
+	}
+	if !fifo && req.SQSGroupField != "" {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("groupfield is only for FIFO queues and topics, whose names end in .fifo"))
+	}
+	return nil
+}
+
+// queueAttribute is a message attribute as SQS and SNS take it
+type queueAttribute struct {
+	dataType string // String or Number
+	text     string
+}
+
+// queueMessage is one message for an SQS queue or an SNS topic
+type queueMessage struct {
+	body       string
+	group      string
+	attributes map[string]queueAttribute
+	record     map[string]interface{} // The record the message was made from, for rejecting it
+}
+
+// size returns the bytes of the message counted against the batch limit
+func (m queueMessage) size() int {
+	size := len(m.body)
+	for name, value := range m.attributes {
+		size += len(name) + len(value.dataType) + len(value.text)
+	}
+	return size
+}
+
+// queueMessages turns the data into one message per record, with the
+// attributes and group their fields give. A record missing the group of a
+// FIFO queue or topic is rejected. Data that is not record-oriented is sent
+// as a single message.
+func queueMessages(data interface{}, req interfaces.Request, fifo bool) ([]queueMessage, []pipeline.RejectedRow, error) {
+	dataset := pipeline.NewDataset(data)
+	if !dataset.Structured() {
+		var body string
+		switch v := data.(type) {
+		case string:
+			body = v
+		case []byte:
+			body = string(v)
+		default:
+			return nil, nil, fmt.Errorf("unsupported data type: %T", data)
+		}
+		if fifo {
+			return nil, nil, interfaces.Wrap(interfaces.ErrValidation, errors.New("data that is not record-oriented has no group field to send to a FIFO queue or topic"))
+		}
+		return []queueMessage{{body: body, record: map[string]interface{}{MessageValueField: body}}}, nil, nil
+	}
+	var messages []queueMessage
+	var rejected []pipeline.RejectedRow
+	for _, rec := range dataset.Records {
+		rec = rec.Copy()
+		delete(rec, pipeline.TableField)
+		payload, err := encodeMessage(rec, req.Format)
+		if err != nil {
+			return nil, nil, err
+		}
+		msg := queueMessage{body: string(payload), record: rec}
+		if fifo {
+			if rec[req.SQSGroupField] == nil || fmt.Sprint(rec[req.SQSGroupField]) == "" {
+				rejected = append(rejected, pipeline.RejectedRow{Record: rec, Reason: fmt.Sprintf("group field %s is missing or empty", req.SQSGroupField)})
+				continue
+			}
+			msg.group = fmt.Sprint(rec[req.SQSGroupField])
+		}
+		for _, name := range req.SQSAttributes {
+			// Attributes cannot be empty, so missing and empty fields are left out
+			value := rec[name]
+			if value == nil || fmt.Sprint(value) == "" {
+				continue
+			}
+			if msg.attributes == nil {
+				msg.attributes = map[string]queueAttribute{}
+			}
+			msg.attributes[name] = newQueueAttribute(value)
+		}
+		if msg.size() > queueBatchBytes {
+			rejected = append(rejected, pipeline.RejectedRow{Record: rec, Reason: fmt.Sprintf("message of %d bytes is over the limit of %d", msg.size(), queueBatchBytes)})
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rejected, nil
+}
+
+// newQueueAttribute types a field's value as a Number attribute when it is
+// one, and a String attribute otherwise
+func newQueueAttribute(value interface{}) queueAttribute {
+	switch v := value.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return queueAttribute{dataType: "Number", text: fmt.Sprint(v)}
+	case json.Number:
+		return queueAttribute{dataType: "Number", text: v.String()}
+	}
+	return queueAttribute{dataType: "String", text: fmt.Sprint(value)}
+}
+
+// queueFailure is a message of a batch call the service refused
+type queueFailure struct {
+	id          string // Place of the message in the batch
+	reason      string
+	senderFault bool // The message itself is at fault, so sending it again fails the same way
+}
+
+// sendInBatches sends the messages in batches of up to 10 messages and 256
+// KiB, returning the messages refused through their own fault. Any other
+// refusal fails the call, so the batch is retried.
+func sendInBatches(messages []queueMessage, send func(batch []queueMessage) ([]queueFailure, error)) ([]pipeline.RejectedRow, error) {
+	var refused []pipeline.RejectedRow
+	var batch []queueMessage
+	size := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		failures, err := send(batch)
+		if err != nil {
+			return err
+		}
+		for _, failure := range failures {
+			i, err := strconv.Atoi(failure.id)
+			if err != nil || i < 0 || i >= len(batch) {
+				return fmt.Errorf("message %s was refused: %s", failure.id, failure.reason)
+			}
+			if !failure.senderFault {
+				return fmt.Errorf("message %d of the batch was refused: %s", i, failure.reason)
+			}
+			refused = append(refused, pipeline.RejectedRow{Record: batch[i].record, Reason: failure.reason})
+		}
+		batch, size = nil, 0
+		return nil
+	}
+	for _, msg := range messages {
+		if len(batch) == queueBatchEntries || size+msg.size() > queueBatchBytes {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+		batch = append(batch, msg)
+		size += msg.size()
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return refused, nil
+}
+
+// rejectedMessages returns the error rejecting the rows, nil when there are none
+func rejectedMessages(rows []pipeline.RejectedRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	return &pipeline.RejectedRowsError{Rows: rows}
+}
+
+// Initialize the SQS and SNS integrations by registering them with the registry.
+func init() {
+	registry.RegisterSource("SQS", SQSSource{})
+	registry.RegisterDestination("SQS", SQSDestination{})
+	registry.RegisterDestination("SNS", SNSDestination{})
+}
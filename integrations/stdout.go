@@ -0,0 +1,181 @@
+package integrations
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/pipeline"
+	"github.com/SkySingh04/fractal/registry"
+)
+
+// StdoutPath as a destination file name writes to standard output instead of a file
+const StdoutPath = "-"
+
+// Formats the Stdout destination writes
+const (
+	StdoutCSV       = "csv"
+	StdoutJSON      = "json"
+	StdoutJSONLines = "jsonl"
+	StdoutYAML      = "yaml"
+)
+
+// Stdout receives what destinations write to StdoutPath. It is standard
+// output as the program started, so it stays there once logger.ToStderr
+// has moved the log lines to standard error.
+var Stdout io.Writer = os.Stdout
+
+// stdoutMu keeps writes made at the same time, by batches in flight at once, from mixing their bytes
+var stdoutMu sync.Mutex
+
+// stdoutWriter writes to Stdout. Closing it leaves standard output open.
+type stdoutWriter struct {
+	io.Writer
+}
+
+func (w stdoutWriter) Write(p []byte) (int, error) {
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+	return w.Writer.Write(p)
+}
+
+func (w stdoutWriter) Close() error {
+	return nil
+}
+
+// StdoutDestination struct represents the configuration for writing records to standard output.
+type StdoutDestination struct {
+	StdoutFormat string `json:"stdout_format" fractal:"enum=csv|json|jsonl|yaml"`
+	Compression  string `json:"compression" fractal:"enum=gzip|zstd|none"`
+}
+
+// SendData writes the batch to standard output in the configured format, a
+// built-in one or any registered codec. CSV batches after the first leave
+// out the header, so the output reads as one file.
+func (s StdoutDestination) SendData(data interface{}, req interfaces.Request) error {
+	switch stdoutFormat(req) {
+	case StdoutCSV:
+		req.CSVDestinationFileName = StdoutPath
+		return CSVDestination{}.SendData(data, req)
+	case StdoutJSON:
+		return writeJSONFile(StdoutPath, req.Compression, "", data)
+	case StdoutYAML:
+		return writeYAMLFile(StdoutPath, req.Compression, "", data)
+	case StdoutJSONLines:
+		return writeJSONLines(req.Compression, data)
+	}
+	return writeEncoded(stdoutFormat(req), req.Compression, data)
+}
+
+// writeEncoded writes the records encoded by the format's codec
+func writeEncoded(format, compression string, data interface{}) error {
+	encoded, err := encodeRecords(format, data)
+	if err != nil {
+		return err
+	}
+	out, err := createDestinationFile(StdoutPath, compression)
+	if err != nil {
+		return err
+	}
+	if _, err := out.Write(encoded); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// writeJSONLines writes each record on a line of its own, or data whole when it holds no records
+func writeJSONLines(compression string, data interface{}) error {
+	out, err := createDestinationFile(StdoutPath, compression)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(out)
+	dataset := pipeline.NewDataset(data)
+	if !dataset.Structured() {
+		err = encoder.Encode(data)
+	}
+	for _, rec := range dataset.Records {
+		if err = encoder.Encode(rec); err != nil {
+			break
+		}
+	}
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// stdoutFormat returns the configured format, csv when empty
+func stdoutFormat(req interfaces.Request) string {
+	if format := strings.ToLower(strings.TrimSpace(req.StdoutFormat)); format != "" {
+		return format
+	}
+	return StdoutCSV
+}
+
+// ValidateConfig checks the format and compression, and that the output is
+// not split into files
+func (s StdoutDestination) ValidateConfig(req interfaces.Request) error {
+	switch stdoutFormat(req) {
+	case StdoutCSV:
+		req.CSVDestinationFileName = StdoutPath
+		return CSVDestination{}.ValidateConfig(req)
+	case StdoutJSON, StdoutJSONLines, StdoutYAML:
+	default:
+		if _, ok := registry.GetCodec(req.StdoutFormat); !ok {
+			return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid stdout format %q: expected one of %s", req.StdoutFormat, strings.Join(registry.CodecNames(), ", ")))
+		}
+	}
+	if err := validateStdoutOutput(StdoutPath, req); err != nil {
+		return err
+	}
+	return validateCompression(req.Compression, StdoutPath, true)
+}
+
+// PartSize is never needed, as standard output is a single part; it lets
+// CSV batches after the first continue the output without a header
+func (s StdoutDestination) PartSize(req interfaces.Request) (int64, error) {
+	return 0, errors.New("standard output has no size")
+}
+
+// validateStdoutOutput rejects partitioned and split output for a file
+// destination writing to StdoutPath, which cannot hold more than one file
+func validateStdoutOutput(path string, req interfaces.Request) error {
+	if path != StdoutPath {
+		return nil
+	}
+	if len(req.PartitionBy) > 0 {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("partitionby cannot write to standard output"))
+	}
+	if mode := strings.ToLower(strings.TrimSpace(req.OutputMode)); mode != "" && mode != pipeline.OutputSingle {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("outputmode %s cannot write to standard output", req.OutputMode))
+	}
+	return nil
+}
+
+// WritesStdout reports whether the destination writes to standard output:
+// the Stdout destination, or a file destination given StdoutPath
+func WritesStdout(method string, req interfaces.Request) bool {
+	switch method {
+	case "Stdout":
+		return true
+	case "CSV":
+		return req.CSVDestinationFileName == StdoutPath
+	case "JSON":
+		return req.JSONOutputFilename == StdoutPath
+	case "YAML":
+		return req.YAMLDestinationFilePath == StdoutPath
+	}
+	return false
+}
+
+func init() {
+	registry.RegisterDestination("Stdout", StdoutDestination{})
+}
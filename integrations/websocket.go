@@ -2,6 +2,7 @@ package integrations
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/SkySingh04/fractal/interfaces"
@@ -12,12 +13,12 @@ import (
 
 // WebSocketSource struct represents the configuration for consuming messages from WebSocket.
 type WebSocketSource struct {
-	URL string `json:"websocket_source_url"`
+	URL string `json:"websocket_source_url" fractal:"required"`
 }
 
 // WebSocketDestination struct represents the configuration for publishing messages to WebSocket.
 type WebSocketDestination struct {
-	URL string `json:"websocket_dest_url"`
+	URL string `json:"websocket_dest_url" fractal:"required"`
 }
 
 // FetchData connects to WebSocket, retrieves data, and passes it through validation and transformation pipelines.
@@ -25,13 +26,13 @@ func (ws WebSocketSource) FetchData(req interfaces.Request) (interface{}, error)
 	logger.Infof("Connecting to WebSocket Source: URL=%s", req.WebSocketSourceURL)
 
 	if req.WebSocketSourceURL == "" {
-		return nil, errors.New("missing WebSocket source details")
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing WebSocket source details"))
 	}
 
 	// Connect to WebSocket server
 	conn, _, err := websocket.DefaultDialer.Dial(req.WebSocketSourceURL, nil)
 	if err != nil {
-		return nil, err
+		return nil, interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to connect to WebSocket: %w", err))
 	}
 	defer conn.Close()
 
@@ -46,7 +47,7 @@ func (ws WebSocketSource) FetchData(req interfaces.Request) (interface{}, error)
 	// Validation
 	validatedData, err := validateWebSocketData(msg)
 	if err != nil {
-		logger.Fatalf("Validation failed for message: %s, Error: %s", msg, err)
+		logger.Errorf("Validation failed for message: %s, Error: %s", msg, err)
 		return nil, err
 	}
 
@@ -62,13 +63,13 @@ func (ws WebSocketDestination) SendData(data interface{}, req interfaces.Request
 	logger.Infof("Connecting to WebSocket Destination: URL=%s", req.WebSocketDestURL)
 
 	if req.WebSocketDestURL == "" {
-		return errors.New("missing WebSocket destination details")
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing WebSocket destination details"))
 	}
 
 	// Connect to WebSocket server
 	conn, _, err := websocket.DefaultDialer.Dial(req.WebSocketDestURL, nil)
 	if err != nil {
-		return err
+		return interfaces.Wrap(interfaces.ErrConnection, fmt.Errorf("failed to connect to WebSocket: %w", err))
 	}
 	defer conn.Close()
 
@@ -2,7 +2,8 @@ package integrations
 
 import (
 	"errors"
-	"io/ioutil"
+	"fmt"
+	"io"
 
 	"github.com/SkySingh04/fractal/interfaces"
 	"github.com/SkySingh04/fractal/logger"
@@ -12,24 +13,77 @@ import (
 
 // YAMLSource struct represents the configuration for reading data from a YAML file.
 type YAMLSource struct {
-	FilePath string `json:"yaml_source_file_path"`
+	FilePath       string `json:"yaml_source_file_path" fractal:"required"`
+	Recursive      bool   `json:"source_recursive"`
+	FileField      string `json:"source_file_field"`
+	ArchiveEntries string `json:"source_archive_entries"`
+	Compression    string `json:"compression" fractal:"enum=gzip|zstd|bzip2|none"`
+	Encoding       string `json:"encoding" fractal:"enum=utf-8|utf-16|utf-16le|utf-16be|latin-1|windows-1252"`
 }
 
 // YAMLDestination struct represents the configuration for writing data to a YAML file.
 type YAMLDestination struct {
-	FilePath string `json:"yaml_output_file_path"`
+	FilePath            string   `json:"yaml_output_file_path" fractal:"required"`
+	PartitionBy         []string `json:"partition_by"`
+	PartitionEmptyValue string   `json:"partition_empty_value"`
+	Compression         string   `json:"compression" fractal:"enum=gzip|zstd|none"`
+	Encoding            string   `json:"encoding" fractal:"enum=utf-8|utf-16|utf-16le|utf-16be|latin-1|windows-1252"`
 }
 
-// FetchData reads and processes data from a YAML source file.
+// FetchData reads and processes data from a YAML source file. The path may
+// also be a glob pattern or a directory, in which case the documents of the
+// matching files are read in sorted order into one list of records.
 func (y YAMLSource) FetchData(req interfaces.Request) (interface{}, error) {
 	logger.Infof("Fetching data from YAML source: %s", req.YAMLSourceFilePath)
 
 	if req.YAMLSourceFilePath == "" {
-		return nil, errors.New("missing YAML source file path")
+		return nil, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing YAML source file path"))
 	}
 
-	// Read the YAML file
-	data, err := ioutil.ReadFile(req.YAMLSourceFilePath)
+	files, multiple, err := sourceFiles(req.YAMLSourceFilePath, req.SourceRecursive, req.SourceArchiveEntries, ".yaml", ".yml")
+	if err != nil {
+		return nil, err
+	}
+	field := sourceFileField(req.SourceFileField, multiple)
+	if field == "" {
+		return fetchYAMLFile(files[0], req.Compression, req.Encoding)
+	}
+
+	var records []interface{}
+	for _, file := range files {
+		logger.Infof("Reading YAML file %s", file)
+		data, err := fetchYAMLFile(file, req.Compression, req.Encoding)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		documents, ok := data.([]interface{})
+		if !ok {
+			documents = []interface{}{data}
+		}
+		for _, document := range documents {
+			rec, ok := document.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("YAML file %s holds %T, not a mapping or a list of mappings", file, document)
+			}
+			if _, ok := rec[field]; ok {
+				return nil, fmt.Errorf("YAML file %s already has a %s field", file, field)
+			}
+			rec[field] = file
+			records = append(records, rec)
+		}
+	}
+	return records, nil
+}
+
+// fetchYAMLFile reads, validates and transforms a single YAML file,
+// decompressing and decoding it as configured
+func fetchYAMLFile(path, compression, encodingName string) (interface{}, error) {
+	file, err := openTextFile(path, compression, encodingName)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
 	if err != nil {
 		return nil, err
 	}
@@ -37,14 +91,14 @@ func (y YAMLSource) FetchData(req interfaces.Request) (interface{}, error) {
 	// Validate and sanitize the YAML data
 	validatedData, err := ValidateYAMLData(data)
 	if err != nil {
-		logger.Fatalf("Validation error: %v", err)
+		logger.Errorf("Validation error: %v", err)
 		return nil, err
 	}
 
 	// Transform the YAML data if necessary
 	transformedData, err := transformYAMLData(validatedData)
 	if err != nil {
-		logger.Fatalf("Transformation error: %v", err)
+		logger.Errorf("Transformation error: %v", err)
 		return nil, err
 	}
 
@@ -56,20 +110,37 @@ func (y YAMLDestination) SendData(data interface{}, req interfaces.Request) erro
 	logger.Infof("Sending data to YAML destination: %s", req.YAMLDestinationFilePath)
 
 	if req.YAMLDestinationFilePath == "" {
-		return errors.New("missing YAML destination file path")
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing YAML destination file path"))
+	}
+
+	if len(req.PartitionBy) > 0 {
+		p := partitioning{By: req.PartitionBy, EmptyValue: req.PartitionEmptyValue}
+		return writeGroupedPartitions(req.YAMLDestinationFilePath, data, p, func(path string, records []interface{}) error {
+			if err := writeYAMLFile(path, req.Compression, req.Encoding, records); err != nil {
+				return err
+			}
+			reportOutput(req, path, len(records), false)
+			return nil
+		})
 	}
 
 	// Write the data to the YAML file
-	err := writeYAMLFile(req.YAMLDestinationFilePath, data)
+	err := writeYAMLFile(req.YAMLDestinationFilePath, req.Compression, req.Encoding, data)
 	if err != nil {
-		logger.Fatalf("Error writing data to YAML file: %v", err)
+		logger.Errorf("Error writing data to YAML file: %v", err)
 		return err
 	}
 
+	reportData(req, req.YAMLDestinationFilePath, data)
 	logger.Infof("Data successfully written to %s", req.YAMLDestinationFilePath)
 	return nil
 }
 
+// OutputDir returns the directory the YAML files are written to
+func (y YAMLDestination) OutputDir(req interfaces.Request) string {
+	return outputDir(req.YAMLDestinationFilePath)
+}
+
 // ValidateYAMLData unmarshals and validates the YAML data.
 func ValidateYAMLData(data []byte) (interface{}, error) {
 	var yamlData interface{}
@@ -109,19 +180,23 @@ func sanitizeYAMLData(data interface{}) interface{} {
 	}
 }
 
-// writeYAMLFile writes the provided data to a YAML file.
-func writeYAMLFile(filename string, data interface{}) error {
+// writeYAMLFile writes the provided data to a YAML file, encoding and compressing it as configured.
+func writeYAMLFile(filename, compression, encodingName string, data interface{}) error {
 	outputData, err := yaml.Marshal(data)
 	if err != nil {
 		return err
 	}
 
-	err = ioutil.WriteFile(filename, outputData, 0644)
+	file, err := createEncodedFile(filename, compression, encodingName)
 	if err != nil {
 		return err
 	}
+	if _, err := file.Write(outputData); err != nil {
+		file.Close()
+		return err
+	}
 
-	return nil
+	return file.Close()
 }
 
 // transformYAMLData applies transformations to the YAML data.
@@ -137,6 +212,31 @@ func transformYAMLData(data interface{}) (interface{}, error) {
 	return data, nil
 }
 
+// ValidateConfig checks the compression setting before the file is read
+func (y YAMLSource) ValidateConfig(req interfaces.Request) error {
+	if err := validateEncoding(req.Encoding); err != nil {
+		return err
+	}
+	return validateCompression(req.Compression, req.YAMLSourceFilePath, false)
+}
+
+// ValidateConfig checks that the destination can write the configured
+// compression, and that standard output is not partitioned
+func (y YAMLDestination) ValidateConfig(req interfaces.Request) error {
+	if err := validateStdoutOutput(req.YAMLDestinationFilePath, req); err != nil {
+		return err
+	}
+	if err := validateEncoding(req.Encoding); err != nil {
+		return err
+	}
+	return validateCompression(req.Compression, req.YAMLDestinationFilePath, true)
+}
+
+// Location returns the YAML file the records are read from
+func (y YAMLSource) Location(req interfaces.Request) string {
+	return req.YAMLSourceFilePath
+}
+
 // Initialize the YAML integrations by registering them with the registry.
 func init() {
 	registry.RegisterSource("YAML", YAMLSource{})
@@ -0,0 +1,66 @@
+package interfaces
+
+import "errors"
+
+// Kinds of failure, for callers that need to tell them apart with errors.Is
+var (
+	ErrConfigInvalid = errors.New("invalid configuration")
+	ErrConnection    = errors.New("connection failed")
+	ErrValidation    = errors.New("validation failed")
+	ErrTransform     = errors.New("transformation failed")
+	ErrWrite         = errors.New("write failed")
+)
+
+// Error codes reported for each kind of failure by ErrorCode
+const (
+	CodeConfigInvalid = "config_invalid"
+	CodeConnection    = "connection"
+	CodeValidation    = "validation"
+	CodeTransform     = "transform"
+	CodeWrite         = "write"
+)
+
+var errorCodes = []struct {
+	kind error
+	code string
+}{
+	{ErrConfigInvalid, CodeConfigInvalid},
+	{ErrConnection, CodeConnection},
+	{ErrValidation, CodeValidation},
+	{ErrTransform, CodeTransform},
+	{ErrWrite, CodeWrite},
+}
+
+// Error marks Err as a kind of failure without changing its message
+type Error struct {
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap lets errors.Is and errors.As match both the kind and the underlying error
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// Wrap marks err as being of kind. Nil stays nil, and an error that already
+// has a kind keeps it, so the innermost, most specific kind wins.
+func Wrap(kind error, err error) error {
+	if err == nil || ErrorCode(err) != "" {
+		return err
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// ErrorCode returns the code of the kind of failure err is, or "" if it has none
+func ErrorCode(err error) string {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.kind) {
+			return c.code
+		}
+	}
+	return ""
+}
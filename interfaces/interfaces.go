@@ -1,5 +1,7 @@
 package interfaces
 
+import "context"
+
 type DataSource interface {
 	FetchData(req Request) (interface{}, error)
 }
@@ -8,26 +10,130 @@ type DataDestination interface {
 	SendData(data interface{}, req Request) error
 }
 
+// Checkpointer is implemented by sources that remember how far they have read.
+// Commit is called once a run has delivered everything FetchData returned, so
+// a failed run is read again next time.
+type Checkpointer interface {
+	Commit(req Request) error
+}
+
+// ConfigValidator is implemented by integrations that can check their
+// settings up front, so a bad one fails the run before anything is read.
+type ConfigValidator interface {
+	ValidateConfig(req Request) error
+}
+
+// PartWriter is implemented by destinations that write files, whose output
+// Request.OutputMode can split into parts. PartSize returns the size of the
+// part the request names, so sized output knows when to roll over.
+type PartWriter interface {
+	PartSize(req Request) (int64, error)
+}
+
+// FileWriter is implemented by destinations that write local files and
+// report each one through Request.OutputWritten, so the pipeline can list
+// them in a manifest. OutputDir returns the directory the files go to, ""
+// when the request writes to standard output.
+type FileWriter interface {
+	OutputDir(req Request) string
+}
+
+// Preparer is implemented by destinations that set up before a run writes,
+// such as creating a staging table. Prepare is called once, before the first
+// batch is sent; an error aborts the run.
+type Preparer interface {
+	Prepare(req Request) error
+}
+
+// Finisher is implemented by destinations that clean up after a run. Finish
+// is called once the run has written everything, and not after a failed run.
+type Finisher interface {
+	Finish(req Request) error
+}
+
+// Locator is implemented by sources that can say where their records come
+// from, such as a file path or a collection name, for provenance fields.
+type Locator interface {
+	Location(req Request) string
+}
+
+// PageReader is implemented by NoSQL sources that can read a collection a
+// page at a time, so a large one streams into the pipeline instead of being
+// read whole. FetchPage reads the page after token, "" for the first page,
+// and returns the token of the next, "" after the last. Reading with the
+// same token again reads the same page, so a failed page can be retried.
+type PageReader interface {
+	FetchPage(req Request, token string) (data interface{}, next string, err error)
+}
+
+// Pinger is implemented by integrations that can check their backend is
+// reachable without reading or writing anything, for readiness probes. Ping
+// gives up once ctx is done.
+type Pinger interface {
+	Ping(ctx context.Context, req Request) error
+}
+
+// FieldLister is implemented by destinations that know which fields they
+// take, such as configured columns, for the extra fields policy. Nil means
+// they don't know for this request.
+type FieldLister interface {
+	DestinationFields(req Request) ([]string, error)
+}
+
+// Router is implemented by destinations writing to one target the request
+// names, such as a table, topic or file path. When the name is a template
+// such as events_{tenant}, the pipeline routes each record to the target its
+// fields name, through a request WithTarget returns.
+type Router interface {
+	Target(req Request) string
+	WithTarget(req Request, target string) Request
+}
+
+// OptionsPasser is implemented by integrations that pass Request.Options
+// through to their client or driver. The pipeline rejects options for the others.
+type OptionsPasser interface {
+	OptionsTarget() string // What the options become, such as connection string parameters
+}
+
+// Codec converts between the bytes a transport carries and records, so any
+// transport can carry any registered format. Decode returns the field order
+// when the format has one, such as a CSV header, and Encode writes the
+// fields in the order given.
+type Codec interface {
+	Encode(records []map[string]interface{}, columns []string) ([]byte, error)
+	Decode(data []byte) (records []map[string]interface{}, columns []string, err error)
+}
+
 // Request struct to hold migration request data
 type Request struct {
-	Input                   string `json:"input"`            // List of input types (Kafka, SQL, MongoDB, etc.)
-	Output                  string `json:"output"`           // List of output types (CSV, MongoDB, etc.)
-	ValidationRules         string `json:"validation_rules"` // Validation rules
-	TransformationRules     string `json:"transformation_rules"`
-	ErrorHandling           string `json:"error_handling"`
-	ConsumerURL             string `json:"consumer_url"`   // URL for Kafka
-	ConsumerTopic           string `json:"consumer_topic"` // Topic for Kafka
-	ProducerURL             string `json:"producer_url"`
-	ProducerTopic           string `json:"producer_topic"`
-	SQLSourceConnString     string `json:"sql_source_conn_string"`     // Source SQL connection string
-	SQLTargetConnString     string `json:"sql_target_conn_string"`     // Target SQL connection string
-	SourceMongoDBConnString string `json:"source_mongodb_conn_string"` // MongoDB source connection string
-	SourceMongoDBDatabase   string `json:"source_mongodb_database"`    // MongoDB source database
-	SourceMongoDBCollection string `json:"source_mongodb_collection"`  // MongoDB source collection
-	TargetMongoDBConnString string `json:"target_mongodb_conn_string"` // MongoDB target connection string
-	TargetMongoDBDatabase   string `json:"target_mongodb_database"`    // MongoDB target database
-	TargetMongoDBCollection string `json:"target_mongodb_collection"`  // MongoDB target collection
-	OutputFileName          string `json:"output_file_name"`           // Output file name for CSVs or other formats
+	Input                    string   `json:"input"`            // List of input types (Kafka, SQL, MongoDB, etc.)
+	Output                   string   `json:"output"`           // List of output types (CSV, MongoDB, etc.)
+	ValidationRules          string   `json:"validation_rules"` // Validation rules
+	TransformationRules      string   `json:"transformation_rules"`
+	ErrorHandling            string   `json:"error_handling"`
+	ConsumerURL              string   `json:"consumer_url"`       // URL for Kafka
+	ConsumerTopic            string   `json:"consumer_topic"`     // Topic for Kafka
+	KafkaStartOffset         string   `json:"kafka_start_offset"` // earliest (default), latest or an RFC 3339 timestamp, for partitions the group has no committed offset for
+	ProducerURL              string   `json:"producer_url"`
+	ProducerTopic            string   `json:"producer_topic"`
+	SQLSourceConnString      string   `json:"sql_source_conn_string"`      // Source SQL connection string
+	SQLTargetConnString      string   `json:"sql_target_conn_string"`      // Target SQL connection string
+	SQLSourceIncremental     bool     `json:"sql_source_incremental"`      // Only read rows past the last committed watermark
+	SQLSourceWatermarkColumn string   `json:"sql_source_watermark_column"` // Column that grows with every change, such as updated_at
+	SQLSourceCheckpointFile  string   `json:"sql_source_checkpoint_file"`  // Where watermarks are kept between runs
+	SQLTargetConflictColumns []string `json:"sql_target_conflict_columns"` // Key columns rows are upserted on, plain inserts when empty
+	SQLTargetPreSQL          []string `json:"sql_target_pre_sql"`          // Statements run in one transaction before the first write
+	SQLTargetPostSQL         []string `json:"sql_target_post_sql"`         // Statements run in one transaction after the last write of a successful run
+	SQLTargetPostSQLFatal    bool     `json:"sql_target_post_sql_fatal"`   // Fail the run when the post statements fail, instead of only logging it
+	SQLTargetTable           string   `json:"sql_target_table"`            // Table every row is written to instead of the one it was read from
+	SQLTargetSchemaCheck     bool     `json:"sql_target_schema_check"`     // Quarantine rows that do not fit the table's columns instead of inserting them
+	SourceMongoDBConnString  string   `json:"source_mongodb_conn_string"`  // MongoDB source connection string
+	SourceMongoDBDatabase    string   `json:"source_mongodb_database"`     // MongoDB source database
+	SourceMongoDBCollection  string   `json:"source_mongodb_collection"`   // MongoDB source collection
+	TargetMongoDBConnString  string   `json:"target_mongodb_conn_string"`  // MongoDB target connection string
+	TargetMongoDBDatabase    string   `json:"target_mongodb_database"`     // MongoDB target database
+	TargetMongoDBCollection  string   `json:"target_mongodb_collection"`   // MongoDB target collection
+	OutputFileName           string   `json:"output_file_name"`            // Output file name for CSVs or other formats
 	// RabbitMQ
 	RabbitMQInputURL        string `json:"rabbitmq_input_url"`         // URL for RabbitMQ (consumer)
 	RabbitMQInputQueueName  string `json:"rabbitmq_input_queue_name"`  // Queue name for RabbitMQ input
@@ -40,13 +146,28 @@ type Request struct {
 	YAMLSourceFilePath      string `json:"yaml_source_file_path"`      // Source YAML file path
 	YAMLDestinationFilePath string `json:"yaml_destination_file_path"` // Destination YAML file path
 	// CSV
-	CSVSourceFileName      string `json:"csv_source_file_name"`      // Source CSV file name
-	CSVDestinationFileName string `json:"csv_destination_file_name"` // Destination CSV file name
+	CSVSourceFileName         string   `json:"csv_source_file_name"`         // Source CSV file name
+	CSVSourceHasHeader        *bool    `json:"csv_source_has_header"`        // Whether the first row names the columns, true when unset
+	CSVSourceColumns          []string `json:"csv_source_columns"`           // Column names for a source CSV without a header
+	CSVSourceSkipLines        int      `json:"csv_source_skip_lines"`        // Lines skipped before the header or first row of a source CSV
+	CSVSourceCommentPrefix    string   `json:"csv_source_comment_prefix"`    // Leading lines starting with this are skipped before the header
+	CSVSourceTrimSpace        bool     `json:"csv_source_trim_space"`        // Strips the whitespace around every field of a source CSV
+	CSVSourceCollapseSpace    bool     `json:"csv_source_collapse_space"`    // Also turns runs of whitespace inside fields into a single space
+	CSVSourceExpectedHeader   []string `json:"csv_source_expected_header"`   // Columns a source CSV header must have, in order unless CSVSourceAllowReorder
+	CSVSourceAllowReorder     bool     `json:"csv_source_allow_reorder"`     // Accepts the expected columns in any order
+	CSVDestinationFileName    string   `json:"csv_destination_file_name"`    // Destination CSV file name
+	CSVDestinationColumns     []string `json:"csv_destination_columns"`      // Header order for the destination CSV
+	CSVDestinationWriteHeader *bool    `json:"csv_destination_write_header"` // Whether to write a header row, true when unset
+	CSVDestinationQuoteMode   string   `json:"csv_destination_quote_mode"`   // minimal (default) quotes fields that need it, all quotes every field, none never quotes
 	// Dynamodb
 	DynamoDBSourceTable  string `json:"dynamodb_source_table"`  // Source DynamoDB table
 	DynamoDBTargetTable  string `json:"dynamodb_target_table"`  // Target DynamoDB table
 	DynamoDBSourceRegion string `json:"dynamodb_source_region"` // DynamoDB source region
 	DynamoDBTargetRegion string `json:"dynamodb_target_region"` // DynamoDB target region
+	// AWS
+	AWSRoleARN         string   `json:"aws_role_arn"`         // Role AWS integrations assume through STS
+	AWSExternalID      string   `json:"aws_external_id"`      // External ID passed when assuming the role
+	AWSFailoverRegions []string `json:"aws_failover_regions"` // Regions tried in turn when the configured one has an outage
 	// FTP
 	FTPFILEPATH        string `json:"ftp_file_path"`        // FTP file path
 	FTPURL             string `json:"ftp_url"`              // FTP URL
@@ -58,8 +179,105 @@ type Request struct {
 	SFTPPassword       string `json:"sftp_password"`        // SFTP password
 	WebSocketSourceURL string `json:"websocket_source_url"` // WebSocket source URL
 	WebSocketDestURL   string `json:"websocket_dest_url"`   // WebSocket destination URL
+	// Chunked downloads from FTP and SFTP sources
+	ChunkSize         int    `json:"chunk_size"`          // Bytes downloaded per chunk, 0 downloads the file in one pass
+	ChunkRetries      int    `json:"chunk_retries"`       // Further attempts for a chunk that fails, resumed from the byte it stopped at
+	ChunkRetryBackoff string `json:"chunk_retry_backoff"` // Wait before the first retry of a chunk, doubled for each one after, defaults to 1s
 	// Firebase
 	CredentialFileAddr string `json:"firebase_credential_file"`
 	Collection         string `json:"firebase_collection"`
 	Document           string `json:"firebase_document"`
+	// BigQuery
+	BigQueryProjectID        string   `json:"bigquery_project_id"`        // Project that owns the dataset
+	BigQueryDataset          string   `json:"bigquery_dataset"`           // Destination dataset
+	BigQueryTable            string   `json:"bigquery_table"`             // Destination table, created when missing
+	BigQueryCredentialsFile  string   `json:"bigquery_credentials_file"`  // Service account key, application default credentials when empty
+	BigQuerySchema           []string `json:"bigquery_schema"`            // name:TYPE columns, autodetected when empty
+	BigQueryWriteDisposition string   `json:"bigquery_write_disposition"` // append or truncate
+	BigQueryLoadJobRows      int      `json:"bigquery_load_job_rows"`     // Batches with at least this many rows use a load job
+	// Snowflake
+	SnowflakeAccount        string `json:"snowflake_account"`          // Account identifier, e.g. myorg-myaccount
+	SnowflakeUser           string `json:"snowflake_user"`             // User to sign in as
+	SnowflakePassword       string `json:"snowflake_password"`         // Password, unless a private key is given
+	SnowflakePrivateKeyFile string `json:"snowflake_private_key_file"` // PKCS#8 RSA key for key-pair authentication
+	SnowflakeWarehouse      string `json:"snowflake_warehouse"`        // Warehouse that runs COPY INTO
+	SnowflakeDatabase       string `json:"snowflake_database"`         // Database of the table
+	SnowflakeSchema         string `json:"snowflake_schema"`           // Schema of the table
+	SnowflakeRole           string `json:"snowflake_role"`             // Role to use
+	SnowflakeTable          string `json:"snowflake_table"`            // Destination table, created when missing
+	SnowflakeStage          string `json:"snowflake_stage"`            // Named internal stage, the table's stage when empty
+	// Pulsar
+	PulsarURL               string `json:"pulsar_url"`                  // Service URL, such as pulsar://localhost:6650 or pulsar+ssl://...
+	PulsarTopic             string `json:"pulsar_topic"`                // Topic read from or published to
+	PulsarSubscription      string `json:"pulsar_subscription"`         // Subscription the source reads with, defaults to fractal
+	PulsarSubscriptionType  string `json:"pulsar_subscription_type"`    // shared (default), exclusive, failover or key_shared
+	PulsarMaxMessages       int    `json:"pulsar_max_messages"`         // Messages read per run, defaults to 1000
+	PulsarReceiveTimeout    string `json:"pulsar_receive_timeout"`      // Wait for the next message before ending the read, defaults to 5s
+	PulsarKeyField          string `json:"pulsar_key_field"`            // Record field holding the message key
+	PulsarBatchSize         int    `json:"pulsar_batch_size"`           // Messages per producer batch, the client default when 0
+	PulsarToken             string `json:"pulsar_token"`                // Token for token authentication
+	PulsarTLSTrustCertsFile string `json:"pulsar_tls_trust_certs_file"` // CA certificates for pulsar+ssl URLs
+	PulsarTLSCertFile       string `json:"pulsar_tls_cert_file"`        // Client certificate for TLS authentication
+	PulsarTLSKeyFile        string `json:"pulsar_tls_key_file"`         // Client key for TLS authentication
+	// SQS and SNS
+	SQSQueueURL          string   `json:"sqs_queue_url"`          // Queue read from or sent to, as in https://sqs.<region>.amazonaws.com/<account>/<queue>
+	SQSMaxMessages       int      `json:"sqs_max_messages"`       // Messages read per run, defaults to 1000
+	SQSWaitTime          string   `json:"sqs_wait_time"`          // Long poll of each receive, up to 20s, defaults to 20s
+	SQSVisibilityTimeout string   `json:"sqs_visibility_timeout"` // How long received messages stay hidden from other consumers, the queue's setting when empty
+	SQSAttributes        []string `json:"sqs_attributes"`         // Message attributes read into, or sent from, record fields of the same name
+	SQSGroupField        string   `json:"sqs_group_field"`        // Record field holding the message group ID, for FIFO queues and topics
+	SNSTopicARN          string   `json:"sns_topic_arn"`          // Topic published to
+	AWSRegion            string   `json:"aws_region"`             // Region of the queue or topic, read from its URL or ARN when empty
+	// NATS
+	NATSURL            string `json:"nats_url"`             // Server URLs, comma separated
+	NATSSubject        string `json:"nats_subject"`         // Subject read from or published to
+	NATSStream         string `json:"nats_stream"`          // Stream the source reads, looked up from the subject when empty
+	NATSDurable        string `json:"nats_durable"`         // Durable consumer the source reads with, defaults to fractal
+	NATSMaxMessages    int    `json:"nats_max_messages"`    // Messages read per run, defaults to 1000
+	NATSReceiveTimeout string `json:"nats_receive_timeout"` // Wait for messages before ending the read, defaults to 5s
+	NATSAckWait        string `json:"nats_ack_wait"`        // How long the server waits for an acknowledgement before redelivering
+	NATSCredsFile      string `json:"nats_creds_file"`      // User credentials file
+	NATSToken          string `json:"nats_token"`           // Token for token authentication
+	// Excel
+	ExcelSourceFileName      string `json:"excel_source_file_name"`      // Source workbook, .xlsx
+	ExcelSourceSheet         string `json:"excel_source_sheet"`          // Sheet read, by name or position from 1, the first when empty
+	ExcelDestinationFileName string `json:"excel_destination_file_name"` // Destination workbook, replaced on each write
+	ExcelDestinationSheet    string `json:"excel_destination_sheet"`     // Sheet written, defaults to Sheet1
+	// Stdout destination
+	StdoutFormat string `json:"stdout_format"` // csv (default), json, jsonl, yaml or another registered codec
+	// In-process Memory integrations, for tests
+	MemoryName string `json:"memory_name"` // Store read from or written to, defaults to default
+	// File sources reading a glob pattern or a directory
+	SourceRecursive      bool   `json:"source_recursive"`       // Also read the files in subdirectories of a directory
+	SourceFileField      string `json:"source_file_field"`      // Field holding each record's file, _source_file for patterns, directories and archives
+	SourceArchiveEntries string `json:"source_archive_entries"` // Pattern the entries read from a zip or tar archive match, such as orders/*.csv; defaults to the source's file extension
+	// Serialization format of the bytes FTP, SFTP, NATS, Pulsar, SQS and SNS carry, the name of a registered codec
+	Format string `json:"format"` // Such as csv, json, jsonl or yaml; FTP and SFTP pass the bytes through when empty, the message integrations send JSON
+	// File compression, none, gzip, zstd or bzip2 (reading only), picked from the file extension when empty
+	Compression string `json:"compression"`
+	// Character encoding of CSV, JSON and YAML files, decoded to UTF-8 on reading and encoded back on writing
+	Encoding string `json:"encoding"` // utf-8 (default), utf-16, utf-16le, utf-16be, latin-1 or windows-1252
+	// Partitioned file output
+	PartitionBy             []string `json:"partition_by"`               // Fields whose values name the output directories, e.g. dt=2024-01-01/region=us
+	PartitionMaxOpenWriters int      `json:"partition_max_open_writers"` // Partition files kept open at once
+	PartitionEmptyValue     string   `json:"partition_empty_value"`      // Directory value for a missing, null or empty partition field
+	// Paged reads from NoSQL sources
+	PageSize         int    `json:"page_size"`          // Records read per page, 0 reads the whole collection at once
+	PageRetries      int    `json:"page_retries"`       // Further attempts for a page that fails to read
+	PageRetryBackoff string `json:"page_retry_backoff"` // Wait before the first retry of a page, doubled for each one after, defaults to 1s
+	// Delivery
+	MaxInFlight int `json:"max_in_flight"` // Batches this destination writes at once, overriding delivery.maxinflight
+	// File output split into parts
+	OutputMode     string `json:"output_mode"`      // single (default), per-batch or sized
+	OutputMaxRows  int    `json:"output_max_rows"`  // Sized output starts a new file once one holds this many rows
+	OutputMaxBytes int    `json:"output_max_bytes"` // Sized output starts a new file once one is this large
+	OutputPart     int    `json:"-"`                // Index of the file a batch goes to, set by the pipeline
+	OutputAppend   bool   `json:"-"`                // Whether the batch continues a file an earlier batch of the run started
+	// Called once a batch's records are written to a file, with whether they were appended to it; set by the pipeline when it writes a manifest
+	OutputWritten func(path string, records int, appended bool) `json:"-"`
+	// Settings the integration doesn't model, passed through verbatim to its client or driver
+	Options map[string]string `json:"options"` // Backend-specific, such as PostgreSQL connection parameters
+	// Pipeline
+	Pipeline       PipelineConfig `json:"pipeline"`        // Stages applied between the source and the destination
+	IdempotencyKey string         `json:"idempotency_key"` // Repeated requests with the same key return the first run's result
 }
@@ -0,0 +1,253 @@
+package interfaces
+
+// PipelineConfig holds the settings for the stages that run between a source and a destination
+type PipelineConfig struct {
+	ErrorHandling   ErrorHandling           `json:"errorhandling" yaml:"errorhandling"`
+	NormalizeFields NormalizeFieldsConfig   `json:"normalizefields" yaml:"normalizefields"`
+	Nulls           NullsConfig             `json:"nulls" yaml:"nulls"`
+	Reshape         ReshapeConfig           `json:"reshape" yaml:"reshape"`
+	Validate        ValidationConfig        `json:"validate" yaml:"validate"`
+	Transform       TransformConfig         `json:"transform" yaml:"transform"`
+	Filter          FilterConfig            `json:"filter" yaml:"filter"`
+	Window          WindowConfig            `json:"window" yaml:"window"`
+	Aggregate       AggregateConfig         `json:"aggregate" yaml:"aggregate"`
+	Sort            SortConfig              `json:"sort" yaml:"sort"`
+	Select          SelectConfig            `json:"select" yaml:"select"`
+	Join            JoinConfig              `json:"join" yaml:"join"`
+	Lookups         map[string]LookupConfig `json:"lookups" yaml:"lookups"` // Named value sets for in_source validations
+	Delivery        DeliveryConfig          `json:"delivery" yaml:"delivery"`
+	Buffer          BufferConfig            `json:"buffer" yaml:"buffer"`
+	Notifications   NotificationsConfig     `json:"notifications" yaml:"notifications"`
+	Provenance      ProvenanceConfig        `json:"provenance" yaml:"provenance"`
+	Schema          SchemaConfig            `json:"schema" yaml:"schema"`
+	OutputFields    OutputFieldsConfig      `json:"outputfields" yaml:"outputfields"`
+	Reconcile       ReconcileConfig         `json:"reconcile" yaml:"reconcile"`
+	Tap             TapConfig               `json:"tap" yaml:"tap"`
+	Manifest        ManifestConfig          `json:"manifest" yaml:"manifest"`
+	Profiling       ProfilingConfig         `json:"profiling" yaml:"profiling"`
+	MaxDuration     string                  `json:"maxduration" yaml:"maxduration"`   // Cancels the run once it has taken this long, such as "30m"; empty never times out
+	OnEmptyInput    string                  `json:"onemptyinput" yaml:"onemptyinput"` // When the source returns no records: ok (default), warn or error, which fails the run
+	Stages          []string                `json:"stages" yaml:"stages"`             // Order the stages run in, such as validate, transform, validate:output; empty runs the configured stages in the default order
+}
+
+// ErrorHandling represents the error handling configuration
+type ErrorHandling struct {
+	Strategy         string           `json:"strategy" yaml:"strategy"`
+	QuarantineOutput QuarantineOutput `json:"quarantineoutput" yaml:"quarantineoutput"`
+	MaxErrors        int              `json:"maxerrors" yaml:"maxerrors"`             // Aborts the run once more records than this are rejected, 0 is unlimited
+	MaxErrorRate     float64          `json:"maxerrorrate" yaml:"maxerrorrate"`       // Aborts the run once more than this percentage of the latest records are rejected, 0 is unlimited
+	ErrorRateWindow  int              `json:"errorratewindow" yaml:"errorratewindow"` // Latest records MaxErrorRate is measured over, defaults to 1000
+}
+
+// QuarantineOutput represents the quarantine output configuration
+type QuarantineOutput struct {
+	Type     string `json:"type" yaml:"type"`
+	Location string `json:"location" yaml:"location"`
+}
+
+// FilterConfig selects which records continue down the pipeline
+type FilterConfig struct {
+	Mode  string   `json:"mode" yaml:"mode"`   // "keep" (default) keeps matching records, "drop" discards them
+	Rules []string `json:"rules" yaml:"rules"` // Predicates in the validation rule grammar, all of which must match
+}
+
+// ReshapeConfig splits fields into several and merges several fields into one
+type ReshapeConfig struct {
+	Rules        []string `json:"rules" yaml:"rules"`               // split <field> by "<sep>" into a,b,... or merge a,b,... into <field> with "<sep>", applied in order
+	MissingParts string   `json:"missingparts" yaml:"missingparts"` // When a split yields fewer parts than fields: "null" (default) or "empty" pads, "error" rejects the record
+	ExtraParts   string   `json:"extraparts" yaml:"extraparts"`     // When a split yields more parts than fields: "join" (default) keeps the rest in the last field, "drop" discards it, "error" rejects the record
+}
+
+// ValidationConfig rejects records that break a rule
+type ValidationConfig struct {
+	Rules []string            `json:"rules" yaml:"rules"` // Rules in the validation rule grammar, or <field> in_source <lookup>, all of which must pass
+	Sets  map[string][]string `json:"sets" yaml:"sets"`   // Named rule sets, each run where a validate:<name> entry of stages puts it
+}
+
+// TransformConfig rewrites field values, such as reformatting timestamps
+type TransformConfig struct {
+	Rules    []string                  `json:"rules" yaml:"rules"`       // Transformations such as datetime <field> from <layout> to <layout>, applied in order
+	Mappings map[string]MappingConfig  `json:"mappings" yaml:"mappings"` // Named tables map rules translate values with
+	Tokens   map[string]TokenMapConfig `json:"tokens" yaml:"tokens"`     // Named token maps tokenize and detokenize rules share
+	// Columns a pivot rule creates before it rejects records with new keys, defaults to 1000
+	MaxPivotColumns int `json:"maxpivotcolumns" yaml:"maxpivotcolumns"`
+}
+
+// TokenMapConfig is a table of tokens standing for real values. The same value
+// always gets the same token, in every field and rule using the map.
+type TokenMapConfig struct {
+	File      string `json:"file" yaml:"file"`           // JSON file of tokens and their values, read before the run and saved after it; empty keeps the map for the run only
+	Prefix    string `json:"prefix" yaml:"prefix"`       // Starts each new token, defaults to tok_
+	MaxValues int    `json:"maxvalues" yaml:"maxvalues"` // Distinct values the map holds before tokenizing fails, defaults to 1000000
+}
+
+// MappingConfig is a table of values and their replacements, given inline or read from a file
+type MappingConfig struct {
+	Values     map[string]interface{} `json:"values" yaml:"values"`         // Replacement by value, such as "1": active
+	File       string                 `json:"file" yaml:"file"`             // CSV or JSON file holding the table, instead of Values
+	KeyField   string                 `json:"keyfield" yaml:"keyfield"`     // Column of the file holding the values, defaults to the first CSV column or "key"
+	ValueField string                 `json:"valuefield" yaml:"valuefield"` // Column of the file holding the replacements, defaults to the second CSV column or "value"
+}
+
+// AggregateConfig groups records by key fields and emits one record per group
+type AggregateConfig struct {
+	GroupBy      []string `json:"groupby" yaml:"groupby"`           // Fields whose values make up the group key
+	Aggregations []string `json:"aggregations" yaml:"aggregations"` // count, sum(field), min(field), max(field), avg(field), each optionally followed by "as name"
+	MaxGroups    int      `json:"maxgroups" yaml:"maxgroups"`       // Groups held in memory before spilling to disk, 0 keeps every group in memory
+	SpillDir     string   `json:"spilldir" yaml:"spilldir"`         // Directory for spill files, defaults to the system temp directory
+}
+
+// SortConfig orders the records before they are written. Sorting holds every
+// record until the source is exhausted, on disk past MaxRecords.
+type SortConfig struct {
+	By         []string `json:"by" yaml:"by"`                 // Fields to sort on, each optionally followed by asc (default) or desc, such as "ts desc"
+	MaxRecords int      `json:"maxrecords" yaml:"maxrecords"` // Records held in memory before a sorted run is spilled to disk, 0 holds every record in memory
+	SpillDir   string   `json:"spilldir" yaml:"spilldir"`     // Directory for spill files, defaults to the system temp directory
+}
+
+// WindowConfig aggregates records over windows of time, emitting one record per
+// group and window as each window closes
+type WindowConfig struct {
+	Type            string   `json:"type" yaml:"type"`                       // "tumbling" (default) or "sliding"
+	Size            string   `json:"size" yaml:"size"`                       // Length of a window, such as 5m
+	Slide           string   `json:"slide" yaml:"slide"`                     // How often a sliding window starts, such as 1m
+	Time            string   `json:"time" yaml:"time"`                       // "event" (default) reads the time from TimeField, "processing" uses the time records arrive
+	TimeField       string   `json:"timefield" yaml:"timefield"`             // Field holding the event time
+	TimeLayout      string   `json:"timelayout" yaml:"timelayout"`           // Layout of TimeField as in datetime rules, defaults to iso8601
+	GroupBy         []string `json:"groupby" yaml:"groupby"`                 // Fields whose values make up the group key
+	Aggregations    []string `json:"aggregations" yaml:"aggregations"`       // As in AggregateConfig, defaults to count
+	AllowedLateness string   `json:"allowedlateness" yaml:"allowedlateness"` // How long a window waits for events older than the latest, such as 30s
+	Late            string   `json:"late" yaml:"late"`                       // Events too late for their window: "drop" (default) or "quarantine"
+}
+
+// JoinConfig enriches records with fields from a lookup loaded from a second source
+type JoinConfig struct {
+	Input      string   `json:"input" yaml:"input"`           // Registered source the lookup is read from
+	Request    *Request `json:"request" yaml:"-"`             // Settings for the lookup source, built from inputconfig in CLI mode
+	Key        string   `json:"key" yaml:"key"`               // Field in the main records to match on
+	LookupKey  string   `json:"lookupkey" yaml:"lookupkey"`   // Field in the lookup records to match on, defaults to Key
+	Fields     []string `json:"fields" yaml:"fields"`         // Lookup fields merged into matching records, defaults to all of them
+	Unmatched  string   `json:"unmatched" yaml:"unmatched"`   // "pass" (default), "drop" or "quarantine"
+	MaxRecords int      `json:"maxrecords" yaml:"maxrecords"` // Largest lookup accepted, defaults to 100000
+	Optional   bool     `json:"optional" yaml:"optional"`     // Pass records on with null Fields when the lookup cannot be fetched, instead of failing the run
+}
+
+// LookupConfig is a set of values read from a second source, such as a file or a SQL query
+type LookupConfig struct {
+	Input      string   `json:"input" yaml:"input"`           // Registered source the lookup is read from
+	Request    *Request `json:"request" yaml:"-"`             // Settings for the lookup source, built from inputconfig in CLI mode
+	Key        string   `json:"key" yaml:"key"`               // Field holding the values
+	MaxRecords int      `json:"maxrecords" yaml:"maxrecords"` // Largest lookup accepted, defaults to 100000
+	Optional   bool     `json:"optional" yaml:"optional"`     // Skip the rules naming the lookup when it cannot be fetched, instead of failing the run
+}
+
+// DeliveryConfig controls how records are handed to the destination
+type DeliveryConfig struct {
+	BatchSize           int     `json:"batchsize" yaml:"batchsize"`                     // Records per SendData call, 0 sends everything in one call
+	MaxRecordsPerSecond float64 `json:"maxrecordspersecond" yaml:"maxrecordspersecond"` // Records sent per second, 0 is unlimited
+	MaxBatchesPerSecond float64 `json:"maxbatchespersecond" yaml:"maxbatchespersecond"` // SendData calls per second, 0 is unlimited
+	Retries             int     `json:"retries" yaml:"retries"`                         // Further attempts for a batch the destination rejects
+	RetryBackoff        string  `json:"retrybackoff" yaml:"retrybackoff"`               // Wait before the first retry, doubled for each one after, defaults to 1s
+	MaxInFlight         int     `json:"maxinflight" yaml:"maxinflight"`                 // Batches the destination writes at once, defaults to 1
+	FlushInterval       string  `json:"flushinterval" yaml:"flushinterval"`             // Longest a record waits in a partial batch, such as 5s; empty waits for a full batch
+	MaxTargets          int     `json:"maxtargets" yaml:"maxtargets"`                   // Targets a destination whose target is a template such as events_{tenant} may write to, defaults to 64
+}
+
+// BufferConfig bounds the records held between the stages and the destination
+type BufferConfig struct {
+	Capacity    int    `json:"capacity" yaml:"capacity"`       // Records held in memory, defaults to 10000
+	Spill       bool   `json:"spill" yaml:"spill"`             // Overflow to a temporary file instead of pausing the stages when full
+	SpillDir    string `json:"spilldir" yaml:"spilldir"`       // Directory for the spill file, defaults to the system temp directory
+	LogInterval string `json:"loginterval" yaml:"loginterval"` // Logs how full the buffer is this often while sending, such as 10s; empty never logs
+}
+
+// SelectConfig picks the fields that reach the destination. Set either Fields or Exclude.
+type SelectConfig struct {
+	Fields  []string `json:"fields" yaml:"fields"`   // Fields to keep, in output order
+	Exclude []string `json:"exclude" yaml:"exclude"` // Fields to discard, keeping the rest
+}
+
+// NormalizeFieldsConfig renames the fields of the records as read, before any
+// other stage sees them, so inconsistent headers get consistent names
+type NormalizeFieldsConfig struct {
+	Style       string `json:"style" yaml:"style"`             // snake_case or camelCase, empty keeps the case
+	Pattern     string `json:"pattern" yaml:"pattern"`         // Regular expression replaced in every field name, before the style applies
+	Replacement string `json:"replacement" yaml:"replacement"` // What Pattern is replaced with, which may refer to groups as $1
+}
+
+// NullsConfig standardizes how missing values are read and written
+type NullsConfig struct {
+	Values     []string               `json:"values" yaml:"values"`         // Strings read as null, e.g. "", "NULL" or "\N"
+	Defaults   map[string]interface{} `json:"defaults" yaml:"defaults"`     // Value per field used when the field is null or missing
+	NullString string                 `json:"nullstring" yaml:"nullstring"` // Written for null values in CSV output, defaults to an empty cell
+}
+
+// ProvenanceConfig stamps every record with where and when it was read.
+// Empty field names use the defaults, which start with an underscore to keep
+// clear of real data.
+type ProvenanceConfig struct {
+	Enabled         bool   `json:"enabled" yaml:"enabled"`
+	RunIDField      string `json:"runidfield" yaml:"runidfield"`           // Run ID, defaults to _run_id
+	SourceField     string `json:"sourcefield" yaml:"sourcefield"`         // Registered source name, defaults to _source
+	IngestedAtField string `json:"ingestedatfield" yaml:"ingestedatfield"` // When the source was read, defaults to _ingested_at
+	LocationField   string `json:"locationfield" yaml:"locationfield"`     // File, table or collection read, defaults to _source_location
+	OffsetField     string `json:"offsetfield" yaml:"offsetfield"`         // Position in what the source returned, defaults to _source_offset
+}
+
+// SchemaConfig is the schema the source is expected to deliver. When set,
+// each run compares the records against it before any stage sees them.
+type SchemaConfig struct {
+	Fields   []string `json:"fields" yaml:"fields"`     // name:type fields, such as id:int; types are string, int, float, bool, timestamp, object, array and any
+	OnChange string   `json:"onchange" yaml:"onchange"` // fail (default), warn or adapt
+}
+
+// OutputFieldsConfig says what happens, just before records are written, to
+// the fields they carry beyond those the destination takes
+type OutputFieldsConfig struct {
+	Fields        []string `json:"fields" yaml:"fields"`               // Fields the destination takes; empty asks the destination, such as the CSV destination's csvdestinationcolumns
+	OnExtraFields string   `json:"onextrafields" yaml:"onextrafields"` // pass (default) writes them, drop removes them, warn removes them logging each field name once, error rejects the record
+}
+
+// ReconcileConfig counts the records read and written by a key field, and
+// reports the keys that were not written once each. Every distinct key is
+// held in memory for the run.
+type ReconcileConfig struct {
+	Key     string `json:"key" yaml:"key"`         // Field identifying a record; setting it turns reconciliation on
+	MaxKeys int    `json:"maxkeys" yaml:"maxkeys"` // Keys listed in the report for each difference, defaults to 100; the counts cover all of them
+}
+
+// ProfilingConfig collects statistics of each column of the records the
+// destination takes: nulls, distinct values, the smallest and largest value
+// and the most frequent ones
+type ProfilingConfig struct {
+	Enabled   bool     `json:"enabled" yaml:"enabled"`
+	Fields    []string `json:"fields" yaml:"fields"`       // Columns profiled, empty profiles all of them
+	TopValues int      `json:"topvalues" yaml:"topvalues"` // Most frequent values listed per column, defaults to 5
+	Location  string   `json:"location" yaml:"location"`   // JSON file the profile is also written to, besides the run summary
+}
+
+// TapConfig writes a sample of the records leaving a stage to a debug
+// output, without changing what reaches the destination. Set either Every or Sample.
+type TapConfig struct {
+	After    string  `json:"after" yaml:"after"`       // Stage whose output is sampled, such as transform or validate:output; "source" samples the records as read, empty the last stage
+	Every    int     `json:"every" yaml:"every"`       // Writes every Nth record
+	Sample   float64 `json:"sample" yaml:"sample"`     // Writes this fraction of the records, picked at random, such as 0.01
+	Limit    int     `json:"limit" yaml:"limit"`       // Stops once this many records are written, 0 is unlimited
+	Location string  `json:"location" yaml:"location"` // File the records are appended to as indented JSON, empty or "-" for stdout
+}
+
+// ManifestConfig writes a marker file next to a file destination's output
+// once a run has written all of it, for downstream jobs that wait for one
+type ManifestConfig struct {
+	Enabled bool   `json:"enabled" yaml:"enabled"`
+	Path    string `json:"path" yaml:"path"`     // Marker file, relative to the output directory unless absolute; defaults to _SUCCESS
+	Format  string `json:"format" yaml:"format"` // json (default) lists the files with their record counts, sizes and SHA-256 checksums, empty writes an empty file
+}
+
+// NotificationsConfig posts the run report to a webhook when a run ends
+type NotificationsConfig struct {
+	WebhookURL    string `json:"webhookurl" yaml:"webhookurl"`       // Where the report is POSTed
+	Format        string `json:"format" yaml:"format"`               // "json" (default) posts the run report, "slack" posts a Slack message
+	OnlyOnFailure bool   `json:"onlyonfailure" yaml:"onlyonfailure"` // Skip successful runs
+	Timeout       string `json:"timeout" yaml:"timeout"`             // Limit for the webhook call, defaults to 10s
+}
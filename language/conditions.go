@@ -0,0 +1,118 @@
+package language
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Condition describes a condition keyword of the validation rule grammar:
+// how to write it, what it checks, and how to check it
+type Condition struct {
+	Keyword     string
+	Syntax      string
+	Description string
+	// check tests a field's value against the condition's value
+	check func(field, fieldValue, value string) error
+}
+
+// conditions holds the conditions by keyword
+var conditions = map[string]Condition{}
+
+// registerCondition makes a condition keyword available to rules
+func registerCondition(c Condition) {
+	conditions[c.Keyword] = c
+}
+
+// Conditions lists the conditions, sorted by keyword
+func Conditions() []Condition {
+	list := make([]Condition, 0, len(conditions))
+	for _, c := range conditions {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Keyword < list[j].Keyword })
+	return list
+}
+
+func init() {
+	registerCondition(Condition{
+		Keyword:     "TYPE",
+		Syntax:      `FIELD("<field>") TYPE(<STRING|INT|FLOAT|BOOL|DATE>)`,
+		Description: "Checks the value is of a type; DATE is YYYY-MM-DD",
+		check: func(field, fieldValue, value string) error {
+			return checkType(fieldValue, strings.ToUpper(value))
+		},
+	})
+	registerCondition(Condition{
+		Keyword:     "RANGE",
+		Syntax:      `FIELD("<field>") RANGE(<min>, <max>)`,
+		Description: "Checks the value is a number between min and max, inclusive",
+		check: func(field, fieldValue, value string) error {
+			return checkRange(fieldValue, value)
+		},
+	})
+	registerCondition(Condition{
+		Keyword:     "MATCHES",
+		Syntax:      `FIELD("<field>") MATCHES("<regex>")`,
+		Description: "Checks the value matches a regular expression",
+		check: func(field, fieldValue, value string) error {
+			matched, err := regexp.MatchString(value, fieldValue)
+			if err != nil || !matched {
+				return fmt.Errorf("value '%s' does not match pattern", fieldValue)
+			}
+			return nil
+		},
+	})
+	registerCondition(Condition{
+		Keyword:     "IN",
+		Syntax:      `FIELD("<field>") IN("<value>", ...)`,
+		Description: "Checks the value is one of a list",
+		check: func(field, fieldValue, value string) error {
+			for _, allowed := range splitList(value) {
+				if fieldValue == allowed {
+					return nil
+				}
+			}
+			return fmt.Errorf("value '%s' not in allowed list", fieldValue)
+		},
+	})
+	registerCondition(Condition{
+		Keyword:     "REQUIRED",
+		Syntax:      `FIELD("<field>") REQUIRED`,
+		Description: "Checks the field is present and not empty",
+		check: func(field, fieldValue, value string) error {
+			if strings.TrimSpace(fieldValue) == "" {
+				return fmt.Errorf("field %s is required and cannot be empty", field)
+			}
+			return nil
+		},
+	})
+	registerCondition(Condition{
+		Keyword:     "MAXLEN",
+		Syntax:      `FIELD("<field>") MAXLEN(<n>[, BYTES])`,
+		Description: "Checks the value is at most n characters long, or n bytes of UTF-8 with BYTES",
+		check: func(field, fieldValue, value string) error {
+			return checkMaxLen(fieldValue, value)
+		},
+	})
+	descriptions := map[string]string{
+		"==": "Checks the value equals a value",
+		"!=": "Checks the value differs from a value",
+		">":  "Checks the value is a number greater than a number",
+		"<":  "Checks the value is a number less than a number",
+		">=": "Checks the value is a number greater than or equal to a number",
+		"<=": "Checks the value is a number less than or equal to a number",
+	}
+	for operator, description := range descriptions {
+		operator := operator
+		registerCondition(Condition{
+			Keyword:     operator,
+			Syntax:      `FIELD("<field>") ` + operator + ` <value>`,
+			Description: description,
+			check: func(field, fieldValue, value string) error {
+				return compare(fieldValue, operator, value)
+			},
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package language
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ParseRule tokenizes and parses a single rule string into an AST
+func ParseRule(rule string) (*Node, error) {
+	lexer := NewLexer(rule)
+	tokens, err := lexer.Tokenize(lexer.input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to tokenize rule %q: %v", rule, err)
+	}
+	root, err := NewParser().ParseRules(tokens)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rule %q: %v", rule, err)
+	}
+	return root, nil
+}
+
+// Evaluate checks the field values against a parsed rule. A ROOT node passes
+// only when every expression beneath it passes.
+func Evaluate(node *Node, fields map[string]string) error {
+	switch node.Type {
+	case "ROOT":
+		for _, child := range node.Children {
+			if err := Evaluate(child, fields); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "EXPRESSION":
+		return evaluateExpression(node, fields)
+	}
+	return fmt.Errorf("unknown node type: %s", node.Type)
+}
+
+func evaluateExpression(node *Node, fields map[string]string) error {
+	if len(node.Children) != 3 {
+		return errors.New("malformed expression")
+	}
+	field := FieldName(node.Children[0].Value)
+	condition := node.Children[1].Value
+	value := unwrapValue(node.Children[2].Value)
+
+	fieldValue, exists := fields[field]
+	if !exists {
+		return fmt.Errorf("field %s not found", field)
+	}
+
+	c, ok := conditions[condition]
+	if !ok {
+		return fmt.Errorf("unsupported condition: %s", condition)
+	}
+	return c.check(field, fieldValue, value)
+}
+
+// FieldName resolves FIELD("name") to the bare field name
+func FieldName(field string) string {
+	if strings.HasPrefix(field, `FIELD("`) && strings.HasSuffix(field, `")`) {
+		return strings.TrimSuffix(strings.TrimPrefix(field, `FIELD("`), `")`)
+	}
+	return field
+}
+
+// unwrapValue strips the parentheses and quotes a value token may carry, so
+// TYPE(INT), TYPE "INT" and TYPE INT all mean the same thing.
+func unwrapValue(value string) string {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		value = strings.TrimSpace(value[1 : len(value)-1])
+	}
+	return unquote(value)
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		items = append(items, unquote(strings.TrimSpace(item)))
+	}
+	return items
+}
+
+func checkType(value, expectedType string) error {
+	switch expectedType {
+	case "STRING":
+		return nil
+	case "INT":
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("value '%s' is not an integer", value)
+		}
+	case "FLOAT":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("value '%s' is not a float", value)
+		}
+	case "BOOL":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("value '%s' is not a boolean", value)
+		}
+	case "DATE":
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return fmt.Errorf("value '%s' is not a valid date", value)
+		}
+	default:
+		return fmt.Errorf("unknown type: %s", expectedType)
+	}
+	return nil
+}
+
+func checkRange(value, bounds string) error {
+	parts := splitList(bounds)
+	if len(parts) != 2 {
+		return errors.New("range condition should have two values")
+	}
+	minValue, err1 := strconv.ParseFloat(parts[0], 64)
+	maxValue, err2 := strconv.ParseFloat(parts[1], 64)
+	if err1 != nil || err2 != nil {
+		return errors.New("range values should be numbers")
+	}
+	fieldValue, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return errors.New("field value should be a number")
+	}
+	if fieldValue < minValue || fieldValue > maxValue {
+		return fmt.Errorf("value '%s' not in range", value)
+	}
+	return nil
+}
+
+// checkMaxLen checks value against MAXLEN's limit, counted in characters
+// unless BYTES follows it
+func checkMaxLen(value, limit string) error {
+	parts := splitList(limit)
+	if len(parts) > 2 || (len(parts) == 2 && !strings.EqualFold(parts[1], "BYTES")) {
+		return errors.New("maxlen condition should have a length, optionally followed by BYTES")
+	}
+	maxLength, err := strconv.Atoi(parts[0])
+	if err != nil || maxLength < 0 {
+		return errors.New("maxlen length should be a whole number")
+	}
+	length, unit := utf8.RuneCountInString(value), "characters"
+	if len(parts) == 2 {
+		length, unit = len(value), "bytes"
+	}
+	if length > maxLength {
+		return fmt.Errorf("value is %d %s long, more than %d", length, unit, maxLength)
+	}
+	return nil
+}
+
+func compare(fieldValue, operator, ruleValue string) error {
+	switch operator {
+	case "==":
+		if fieldValue != ruleValue {
+			return fmt.Errorf("expected %s, got %s", ruleValue, fieldValue)
+		}
+		return nil
+	case "!=":
+		if fieldValue == ruleValue {
+			return fmt.Errorf("field value should not be %s", ruleValue)
+		}
+		return nil
+	}
+
+	fieldNum, err1 := strconv.ParseFloat(fieldValue, 64)
+	ruleNum, err2 := strconv.ParseFloat(ruleValue, 64)
+	if err1 != nil || err2 != nil {
+		return fmt.Errorf("cannot compare %s %s %s: values should be numbers", fieldValue, operator, ruleValue)
+	}
+	ok := false
+	switch operator {
+	case ">":
+		ok = fieldNum > ruleNum
+	case "<":
+		ok = fieldNum < ruleNum
+	case ">=":
+		ok = fieldNum >= ruleNum
+	case "<=":
+		ok = fieldNum <= ruleNum
+	}
+	if !ok {
+		return fmt.Errorf("expected %s %s, got %s", operator, ruleValue, fieldValue)
+	}
+	return nil
+}
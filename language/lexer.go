@@ -45,16 +45,20 @@ func (l *Lexer) Tokenize(input string) ([]Token, error) {
 	var tokens []Token
 	pos := 0
 	patterns := map[TokenType]*regexp.Regexp{
-		TokenField:     regexp.MustCompile(`^FIELD\("([^"]+)"\)`),                    // Match FIELD("field_name")
-		TokenCondition: regexp.MustCompile(`^(TYPE|RANGE|MATCHES|IN|REQUIRED)`),      // Custom conditions
-		TokenValue:     regexp.MustCompile(`^"([^"]*)"|'([^']*)'|[\d\.]+|\([^)]*\)`), // Match strings, numbers, lists
-		TokenLogical:   regexp.MustCompile(`^(AND|OR|NOT)`),                          // Logical operators
-		TokenSeparator: regexp.MustCompile(`^,`),                                     // Separators
+		TokenField:     regexp.MustCompile(`^FIELD\("([^"]+)"\)`),                      // Match FIELD("field_name")
+		TokenCondition: regexp.MustCompile(`^(TYPE|RANGE|MATCHES|IN|REQUIRED|MAXLEN)`), // Custom conditions
+		TokenOperator:  regexp.MustCompile(`^(==|!=|>=|<=|>|<)`),                       // Comparison operators
+		TokenValue:     regexp.MustCompile(`^"([^"]*)"|'([^']*)'|[\d\.]+|\([^)]*\)`),   // Match strings, numbers, lists
+		TokenLogical:   regexp.MustCompile(`^(AND|OR|NOT)`),                            // Logical operators
+		TokenSeparator: regexp.MustCompile(`^,`),                                       // Separators
 	}
 
 	for pos < len(input) {
 		input = strings.TrimSpace(input[pos:])
 		pos = 0
+		if input == "" {
+			break
+		}
 
 		matched := false
 		for tokenType, pattern := range patterns {
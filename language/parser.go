@@ -21,7 +21,7 @@ func NewParser() *Parser {
 }
 
 func (p *Parser) ParseRules(tokens []Token) (*Node, error) {
-	if len(tokens) < 3 {
+	if len(tokens) < 2 {
 		return nil, errors.New("insufficient parameters")
 	}
 
@@ -34,7 +34,17 @@ func (p *Parser) ParseRules(tokens []Token) (*Node, error) {
 		if token.Type == "FIELD" {
 			// Set the current field and continue to the next token
 			currentField = token.Value
-		} else if token.Type == "CONDITION" {
+		} else if token.Type == "CONDITION" || token.Type == TokenOperator {
+			// REQUIRED is the only condition that stands on its own
+			if token.Value == "REQUIRED" && (i+1 >= len(tokens) || tokens[i+1].Type != TokenValue) {
+				root.Children = append(root.Children, &Node{Type: "EXPRESSION", Children: []*Node{
+					{Type: "FIELD", Value: currentField},
+					{Type: "CONDITION", Value: token.Value},
+					{Type: "VALUE", Value: ""},
+				}})
+				continue
+			}
+
 			// Ensure there is a following value
 			if i+1 >= len(tokens) {
 				return nil, errors.New("expected value after condition")
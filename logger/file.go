@@ -0,0 +1,92 @@
+package logger
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// FileConfig describes a log file kept alongside stdout. The file is rotated
+// when it reaches MaxSizeMB and, with RotateEvery set, on that schedule too.
+type FileConfig struct {
+	Path        string
+	MaxSizeMB   int           // Size that triggers a rotation, defaults to 100
+	MaxBackups  int           // Rotated files kept, 0 keeps them all
+	MaxAgeDays  int           // Rotated files older than this are removed, 0 keeps them all
+	Compress    bool          // Gzip rotated files
+	RotateEvery time.Duration // Rotate on a schedule as well as by size, 0 rotates by size only
+}
+
+var (
+	fileMu sync.Mutex
+	file   *lumberjack.Logger
+)
+
+// OpenFile starts copying every log line to the file described by cfg. The
+// returned function stops the copying and closes the file.
+func OpenFile(cfg FileConfig) (func() error, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("missing log file path")
+	}
+	if cfg.MaxSizeMB < 0 || cfg.MaxBackups < 0 || cfg.MaxAgeDays < 0 || cfg.RotateEvery < 0 {
+		return nil, fmt.Errorf("log file settings must not be negative")
+	}
+	out := &lumberjack.Logger{
+		Filename:   cfg.Path,
+		MaxSize:    cfg.MaxSizeMB,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAgeDays,
+		Compress:   cfg.Compress,
+	}
+	fileMu.Lock()
+	file = out
+	fileMu.Unlock()
+
+	stop := make(chan struct{})
+	if cfg.RotateEvery > 0 {
+		go func() {
+			ticker := time.NewTicker(cfg.RotateEvery)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					fileMu.Lock()
+					err := out.Rotate()
+					fileMu.Unlock()
+					if err != nil {
+						Infof("Failed to rotate log file %s: %v", cfg.Path, err)
+					}
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+	return func() error {
+		close(stop)
+		fileMu.Lock()
+		defer fileMu.Unlock()
+		if file == out {
+			file = nil
+		}
+		return out.Close()
+	}, nil
+}
+
+// writeFile appends a log line to the log file, if one is open
+func writeFile(level, format string, args ...any) {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	if file == nil {
+		return
+	}
+	// A failing log file must not take the run down with it, so the error is dropped
+	file.Write([]byte(formatLine(level, format, args...)))
+}
+
+// formatLine formats a log line with its time and level
+func formatLine(level, format string, args ...any) string {
+	return fmt.Sprintf("%s [%s] %s\n", time.Now().UTC().Format(time.RFC3339), level, fmt.Sprintf(format, args...))
+}
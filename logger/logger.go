@@ -1,28 +1,110 @@
 package logger
 
-import "gofr.dev/pkg/gofr"
+import (
+	"io"
+	"os"
+	"sync"
+
+	"gofr.dev/pkg/gofr"
+)
+
+// LevelEnv is the environment variable GoFr reads its log level from
+const LevelEnv = "LOG_LEVEL"
+
+// SetDebug lowers the log level to DEBUG, so Debugf lines are shown too
+func SetDebug() {
+	os.Setenv(LevelEnv, "DEBUG")
+}
+
+// ToStderr sends log lines, and anything else printed to standard output
+// from here on, to standard error, leaving standard output to data a
+// destination writes there
+func ToStderr() {
+	os.Stdout = os.Stderr
+}
+
+var (
+	outputMu sync.Mutex
+	output   io.Writer
+)
+
+// SetOutput sends log lines to w instead of standard output, so a program
+// embedding fractal keeps them apart from its own. A nil w restores
+// standard output.
+func SetOutput(w io.Writer) {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	output = w
+}
+
+// writeOutput writes a log line to the writer SetOutput gave, reporting
+// whether there is one
+func writeOutput(level, format string, args ...any) bool {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	if output == nil {
+		return false
+	}
+	// DEBUG lines are only shown at that level, as GoFr does
+	if level != "DEBUG" || os.Getenv(LevelEnv) == "DEBUG" {
+		output.Write([]byte(formatLine(level, format, args...)))
+	}
+	return true
+}
+
+func Debugf(format string, args ...any) {
+	writeFile("DEBUG", format, args...)
+	if writeOutput("DEBUG", format, args...) {
+		return
+	}
+	logger := gofr.New().Logger()
+	logger.Debugf("[DEBUG] "+format, args...)
+}
 
 func Logf(format string, args ...any) {
+	writeFile("LOG", format, args...)
+	if writeOutput("LOG", format, args...) {
+		return
+	}
 	logger := gofr.New().Logger()
 	logger.Logf("[LOG] "+format, args...)
 }
 
 func Infof(format string, args ...any) {
+	writeFile("INFO", format, args...)
+	if writeOutput("INFO", format, args...) {
+		return
+	}
 	logger := gofr.New().Logger()
 	logger.Infof("[INFO] "+format, args...)
 }
 
+// Fatalf logs the error and exits. Only the CLI calls it; code a library
+// caller can reach returns its errors instead.
 func Fatalf(format string, args ...any) {
+	writeFile("FATAL", format, args...)
+	writeOutput("FATAL", format, args...)
 	logger := gofr.New().Logger()
 	logger.Fatalf("[FATAL] "+format, args...)
 }
 
+// Errorf logs an error and returns, leaving it to the caller to give up.
+// Only Fatalf exits.
 func Errorf(format string, args ...any) {
+	writeFile("ERROR", format, args...)
+	if writeOutput("ERROR", format, args...) {
+		return
+	}
 	logger := gofr.New().Logger()
-	logger.Fatalf("[ERROR] "+format, args...)
+	logger.Errorf("[ERROR] "+format, args...)
 }
 
+// Warnf logs a warning and returns
 func Warnf(format string, args ...any) {
+	writeFile("WARN", format, args...)
+	if writeOutput("WARN", format, args...) {
+		return
+	}
 	logger := gofr.New().Logger()
-	logger.Fatalf("[WARN] "+format, args...)
+	logger.Warnf("[WARN] "+format, args...)
 }
@@ -2,16 +2,27 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/SkySingh04/fractal/config"
 	"github.com/SkySingh04/fractal/controller"
-	_ "github.com/SkySingh04/fractal/integrations"
+	"github.com/SkySingh04/fractal/integrations"
 	"github.com/SkySingh04/fractal/interfaces"
 	"github.com/SkySingh04/fractal/logger"
 	"github.com/SkySingh04/fractal/opentele"
+	"github.com/SkySingh04/fractal/pipeline"
+	"github.com/SkySingh04/fractal/pkg/fractal"
 	"github.com/SkySingh04/fractal/registry"
+	"github.com/SkySingh04/fractal/version"
 	"gofr.dev/pkg/gofr"
 )
 
@@ -48,12 +59,91 @@ func processData(data []string) ([]string, error) {
 }
 
 func main() {
+	reportPath := flag.String("report", "", "Write a JSON summary of each CLI run to this file")
+	configSchema := flag.Bool("config-schema", false, "Print the JSON Schema for config files and exit")
+	timeout := flag.String("timeout", "", "Cancel each run that takes longer than this, such as 30m, overriding maxduration")
+	configPath := flag.String("config", "", "Config file the interactive CLI loads and saves, found in the search path when empty")
+	profile := flag.String("profile", "", "Merge this named profile into the integration configs, defaults to $"+config.ProfileEnv)
+	logFile := flag.String("log-file", "", "Also write logs to this file, rotating it as it grows")
+	logMaxSize := flag.Int("log-max-size", 100, "Size in megabytes at which the log file is rotated")
+	logMaxBackups := flag.Int("log-max-backups", 0, "Rotated log files to keep, 0 keeps them all")
+	logMaxAge := flag.Int("log-max-age", 0, "Days to keep rotated log files, 0 keeps them all")
+	logCompress := flag.Bool("log-compress", false, "Gzip rotated log files")
+	logRotateEvery := flag.Duration("log-rotate-every", 0, "Also rotate the log file on this schedule, such as 24h")
+	var verbose bool
+	flag.BoolVar(&verbose, "verbose", false, "Log at debug level and log the effective configuration, secrets redacted")
+	flag.BoolVar(&verbose, "v", false, "Shorthand for --verbose")
+	failFast := flag.Bool("fail-fast", false, "Stop each CLI run at the first rejected record, overriding errorhandling.strategy")
+	keepGoing := flag.Bool("keep-going", false, "Log and quarantine rejected records and carry on, overriding errorhandling.strategy")
+	tune := flag.Bool("tune", false, "Print each CLI run's buffer and batch figures and the delivery settings they suggest to standard error")
+	flag.Parse()
+	strategy, err := fractal.StrategyFlag(*failFast, *keepGoing, "")
+	if err != nil {
+		logger.Fatalf("%v", err)
+	}
+	opts := runOptions{ConfigPath: *configPath, ReportPath: *reportPath, Timeout: *timeout, Profile: *profile, Verbose: verbose, Strategy: strategy, Tune: *tune}
+	if verbose {
+		logger.SetDebug()
+	}
+
+	if flag.Arg(0) == "version" {
+		fmt.Println(version.Get())
+		return
+	}
+
+	if flag.Arg(0) == "rules" {
+		rulesCommand(flag.Args()[1:])
+		return
+	}
+
+	if *configSchema {
+		schema, err := config.SchemaJSON()
+		if err != nil {
+			logger.Fatalf("Failed to generate config schema: %v", err)
+		}
+		fmt.Println(string(schema))
+		return
+	}
+
+	if *logFile != "" {
+		closeLog, err := logger.OpenFile(logger.FileConfig{
+			Path:        *logFile,
+			MaxSizeMB:   *logMaxSize,
+			MaxBackups:  *logMaxBackups,
+			MaxAgeDays:  *logMaxAge,
+			Compress:    *logCompress,
+			RotateEvery: *logRotateEvery,
+		})
+		if err != nil {
+			logger.Fatalf("Failed to open log file: %v", err)
+		}
+		defer closeLog()
+	}
+
 	// Initialize OpenTelemetry tracing
 	cleanup, err := opentele.InitTracing()
 	if err != nil {
 		logger.Fatalf("Failed to initialize OpenTelemetry: %v", err)
 	}
 	defer cleanup() // Ensure resources are flushed on exit
+
+	// Initialize OpenTelemetry metrics, exporting the pipeline's gauges
+	cleanupMetrics, err := opentele.InitMetrics()
+	if err != nil {
+		logger.Fatalf("Failed to initialize OpenTelemetry metrics: %v", err)
+	}
+	defer cleanupMetrics()
+
+	// Non-interactive mode, for scripts and orchestrators
+	if flag.Arg(0) == "run" {
+		runCommand(flag.Args()[1:], opts)
+		return
+	}
+	if _, ok := stageCommands[flag.Arg(0)]; ok {
+		stageCommand(flag.Arg(0), flag.Args()[1:], opts)
+		return
+	}
+
 	app := gofr.New()
 	fmt.Print(logo)
 
@@ -73,6 +163,13 @@ func main() {
 	if mode == "Start HTTP Server" {
 		logger.Infof("Starting HTTP Server... Welcome to the Fractal API!")
 
+		// Every route but the probes needs one of the API tokens
+		auth, err := controller.NewAuthFromEnv()
+		if err != nil {
+			logger.Fatalf("Failed to set up API authentication: %v", err)
+		}
+		app.UseMiddleware(auth.Middleware)
+
 		// Register route greet
 		app.GET("/greet", func(ctx *gofr.Context) (interface{}, error) {
 			// Start a span for this route
@@ -83,6 +180,14 @@ func main() {
 			return "Hello Fractal!", nil
 		})
 
+		app.GET("/version", func(ctx *gofr.Context) (interface{}, error) {
+			return version.Get(), nil
+		})
+
+		// Probes for orchestrators such as Kubernetes
+		app.GET("/healthz", controller.HealthHandler)
+		app.GET("/readyz", serverReadiness(opts).Handler)
+
 		// Register other routes as necessary
 		app.POST("/api/migration", controller.MigrationHandler)
 
@@ -90,15 +195,22 @@ func main() {
 		app.Run()
 	} else if mode == "Use CLI" {
 		// CLI Mode Logic
-		// Load configuration
-		configuration, err := config.LoadConfig("config.yaml")
+		// Load configuration. A fresh setup is saved where --config says, or to DefaultConfigFile.
+		if *configPath, err = resolveConfigPath(*configPath, logger.Infof); err != nil {
+			*configPath = config.DefaultConfigFile
+		}
+		configuration, err := config.LoadConfig(*configPath, "")
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			// Setting up from scratch would overwrite a config that is only broken
+			logger.Fatalf("Failed to load %s: %v", *configPath, err)
+		}
 		if err != nil {
 			logger.Logf("Config file not found. Let's set up the input and output methods.")
-			configMap, err := config.SetupConfigInteractively()
+			configMap, err := config.SetupConfigInteractively(*configPath)
 			if err != nil {
 				logger.Fatalf("Failed to set up configuration: %v", err)
 			}
-			configuration := make(map[string]interface{})
+			configuration = make(map[string]interface{})
 			for key, value := range configMap {
 				switch v := value.(type) {
 				case string:
@@ -111,165 +223,438 @@ func main() {
 					configuration[key] = v // Optionally handle other types here
 				}
 			}
+		} else if edit, err := config.AskToEditConfig(*configPath); err != nil {
+			logger.Fatalf("Failed to select configuration action: %v", err)
+		} else if edit {
+			configuration, err = config.EditConfigInteractively(configuration, *configPath)
+			if err != nil {
+				logger.Fatalf("Failed to edit configuration: %v", err)
+			}
 		}
-		logger.Infof("Configuration loaded successfully: %+v", configuration)
-		if _, ok := configuration["inputconfig"]; !ok {
-			logger.Fatalf("Missing 'inputconfig' in configuration")
+		opts.Interval = intervalSec
+		// The prompts are answered, so from here on standard output can carry only the data
+		if writesToStdout(configuration, opts.Profile) {
+			logger.ToStderr()
 		}
+		runCLI(configuration, opts)
+	}
+}
 
-		if _, ok := configuration["outputconfig"]; !ok {
-			logger.Fatalf("Missing 'outputconfig' in configuration")
-		}
+// runOptions are the command line settings for CLI runs
+type runOptions struct {
+	ConfigPath string // Config file to load, found in config.SearchPaths unless --config says otherwise
+	Interval   int    // Seconds between runs, 0 runs once
+	ReportPath string // Where to write each run's report, if anywhere
+	Timeout    string // Replaces the configured maxduration when set
+	Profile    string // Profile to merge into the configuration, or $FRACTAL_PROFILE when empty
+	Verbose    bool   // Log at debug level, and the effective configuration once it is resolved
+	Strategy   string // Replaces errorhandling.strategy when set, from --fail-fast or --keep-going
+	Tune       bool   // Print each run's buffer figures and suggested settings to standard error
+}
 
-		// logger.Infof("Configuration loaded successfully: %+v", configuration)
+// printTuning writes the figures --tune asks for: how full the batches and
+// the buffer got, who waited on whom, and the settings they suggest
+func printTuning(w io.Writer, summary *pipeline.Summary) {
+	stats := summary.Buffer
+	if stats == nil {
+		fmt.Fprintf(w, "Run %s did not buffer its records, so there is nothing to tune\n", summary.RunID)
+		return
+	}
+	fmt.Fprintf(w, "Tuning figures of run %s:\n", summary.RunID)
+	fmt.Fprintf(w, "  batches:     %d of %.1f records on average", stats.Batches, stats.AvgBatchRecords)
+	if stats.BatchSize > 0 {
+		fmt.Fprintf(w, ", %.0f%% of batchsize %d", stats.BatchFill*100, stats.BatchSize)
+	}
+	fmt.Fprintf(w, "\n  destination: busy %.0f%% of %dms across %d batch slots, full batches waited %dms for a slot\n",
+		stats.DestinationBusy*100, stats.SendMS, stats.MaxInFlight, stats.SlotsWaitMS)
+	fmt.Fprintf(w, "  buffer:      peaked at %d of %d records, %d spilled\n", stats.Peak, stats.Capacity, stats.Spilled)
+	fmt.Fprintf(w, "  waits:       the stages waited %dms for room, the destination %dms for records\n", stats.StagesWaitMS, stats.DestinationWaitMS)
+	if len(summary.TuningHints) == 0 {
+		fmt.Fprintln(w, "No changes suggested")
+		return
+	}
+	fmt.Fprintln(w, "Suggested:")
+	for _, hint := range summary.TuningHints {
+		fmt.Fprintf(w, "  - %s\n", hint)
+	}
+}
 
-		// Get the input and output methods from the configuration
-		inputMethod, inputconfig := configuration["inputMethod"], configuration["inputconfig"].(map[string]interface{})
-		outputMethod, outputconfig := configuration["outputMethod"], configuration["outputconfig"].(map[string]interface{})
-		if _, ok := configuration["errorhandling"]; !ok {
+// runCLI runs the pipeline described by the configuration, then again every
+// opts.Interval seconds. With an interval of zero it runs once.
+func runCLI(configuration map[string]interface{}, opts runOptions) {
+	profile := config.ProfileName(opts.Profile)
+	if err := config.ResolveConnections(configuration); err != nil {
+		logger.Fatalf("Failed to resolve connections: %v", err)
+	}
+	if err := config.ApplyProfile(configuration, profile); err != nil {
+		logger.Fatalf("Failed to apply profile: %v", err)
+	}
+	if profile != "" {
+		logger.Infof("Using profile %s", profile)
+	}
+	logger.Infof("Configuration loaded successfully: %+v", config.Redact(configuration))
+	if err := config.ResolveSecrets(configuration); err != nil {
+		logger.Fatalf("Failed to read secrets: %v", err)
+	}
+	fractal.OverrideStrategy(configuration, opts.Strategy)
+	if opts.Verbose {
+		logEffectiveConfig(configuration)
+	}
+	cfg, err := fractal.ConfigFromMap(configuration)
+	if err != nil {
+		logger.Fatalf("Invalid configuration: %v", err)
+	}
+	if _, ok := configuration["validations"]; !ok {
+		logger.Warnf("Missing 'validations' in configuration")
+	}
 
-			logger.Fatalf("Missing 'errorhandling' in configuration")
+	if _, ok := configuration["transformations"]; !ok {
+		logger.Warnf("Missing 'transformations' in configuration")
+	}
+	if opts.Timeout != "" {
+		cfg.Pipeline.MaxDuration = opts.Timeout
+	}
+	// Define the task to be executed
+	task := func() {
+		// Create a root span for the entire task
+		ctx, span := opentele.CreateSpan(context.Background(), "cron-job")
+		defer span.End()
+
+		logger.Infof("Cron job triggered at: %s", time.Now().Format(time.RFC3339))
+
+		// Fetch, process and send the data
+		summary, err := fractal.Run(ctx, cfg)
+		writeReport(&summary, opts.ReportPath)
+		if opts.Tune {
+			printTuning(os.Stderr, &summary.Summary)
 		}
-		if _, ok := configuration["validations"]; !ok {
-			logger.Warnf("Missing 'validations' in configuration")
+		if errors.Is(err, pipeline.ErrTimeout) {
+			span.RecordError(err)
+			span.End()
+			logger.Infof("Pipeline from %s to %s timed out: %v", cfg.Input, cfg.Output, err)
+			os.Exit(summary.ExitCode)
 		}
-
-		if _, ok := configuration["transformations"]; !ok {
-			logger.Warnf("Missing 'transformations' in configuration")
+		if err != nil {
+			span.RecordError(err)
+			logger.Fatalf("Pipeline from %s to %s failed: %v", cfg.Input, cfg.Output, err)
 		}
-		// Define the task to be executed
-		task := func() {
-			// Create a root span for the entire task
-			ctx, span := opentele.CreateSpan(context.Background(), "cron-job")
-			defer span.End()
 
-			logger.Infof("Cron job triggered at: %s", time.Now().Format(time.RFC3339))
+		logger.Infof("Data sent successfully: %d read, %d written, %d filtered, %d quarantined",
+			summary.RecordsRead, summary.RecordsWritten, summary.RecordsFiltered, summary.RecordsQuarantined)
+	}
 
+	// Run the task immediately
+	task()
+	if opts.Interval <= 0 {
+		return
+	}
 
-		// Fetch data from the input method
-		_, fetchSpan := opentele.CreateSpan(ctx, "fetch-data")
-		inputIntegration, found := registry.GetSource(inputMethod.(string))
-		if !found {
-			fetchSpan.RecordError(fmt.Errorf("input method %s not registered", inputMethod))
-			fetchSpan.End()
-			logger.Fatalf("Input method %s not registered", inputMethod)
+	// Repeat the task every interval
+	ticker := time.NewTicker(time.Duration(opts.Interval) * time.Second) // Adjust the interval as needed
+	defer ticker.Stop()
+
+	// Infinite loop to keep executing the task every interval
+	for range ticker.C {
+		// Execute the task on each tick
+		task()
+	}
+}
 
+// serverReadiness builds the readiness check of the server: it pings the
+// source and destination of the config file, when there is one. Without a
+// config file the server has no default integrations and is always ready.
+func serverReadiness(opts runOptions) *controller.Readiness {
+	path, err := resolveConfigPath(opts.ConfigPath, logger.Infof)
+	if err != nil {
+		return controller.NewReadiness(controller.DefaultReadinessTTL)
+	}
+	opts.ConfigPath = path
+	configuration, err := config.LoadConfig(opts.ConfigPath, "")
+	if errors.Is(err, fs.ErrNotExist) {
+		return controller.NewReadiness(controller.DefaultReadinessTTL)
+	}
+	if err != nil {
+		logger.Fatalf("Failed to load %s: %v", opts.ConfigPath, err)
+	}
+	if err := config.ResolveConnections(configuration); err != nil {
+		logger.Fatalf("Failed to resolve connections: %v", err)
+	}
+	if err := config.ApplyProfile(configuration, config.ProfileName(opts.Profile)); err != nil {
+		logger.Fatalf("Failed to apply profile: %v", err)
+	}
+	if err := config.ResolveSecrets(configuration); err != nil {
+		logger.Fatalf("Failed to read secrets: %v", err)
+	}
+
+	var targets []controller.ReadinessTarget
+	inputconfig, _ := configuration["inputconfig"].(map[string]interface{})
+	if method, _ := configuration["inputMethod"].(string); method != "" {
+		source, found := registry.GetSource(method)
+		if !found {
+			logger.Fatalf("Input method %s not registered", method)
+		}
+		targets = append(targets, controller.ReadinessTarget{Role: "source", Method: method, Integration: source, Request: fractal.RequestFromMap(inputconfig)})
+	}
+	outputconfig, _ := configuration["outputconfig"].(map[string]interface{})
+	if method, _ := configuration["outputMethod"].(string); method != "" {
+		destination, found := registry.GetDestination(method)
+		if !found {
+			logger.Fatalf("Output method %s not registered", method)
 		}
+		targets = append(targets, controller.ReadinessTarget{Role: "destination", Method: method, Integration: destination, Request: fractal.RequestFromMap(outputconfig)})
+	}
+	return controller.NewReadiness(controller.DefaultReadinessTTL, targets...)
+}
 
-		// logger.Infof("Fetching data from %s...", inputMethod)
-		// logger.Infof("Input configuration: %+v", inputconfig)
+// runCommand runs the pipeline from a config file without any prompts
+func runCommand(args []string, opts runOptions) {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	configPath := flags.String("config", opts.ConfigPath, `Config file to run, or "-" to read it from stdin; found in the search path when empty`)
+	configFormat := flags.String("config-format", "", "Config format, yaml or json, defaults to the file extension or yaml for stdin")
+	report := flags.String("report", opts.ReportPath, "Write a JSON summary of each run to this file")
+	intervalSec := flags.Int("interval", 0, "Repeat the run every this many seconds, 0 runs once")
+	timeout := flags.String("timeout", opts.Timeout, "Cancel each run that takes longer than this, such as 30m, overriding maxduration")
+	profile := flags.String("profile", opts.Profile, "Merge this named profile into the integration configs, defaults to $"+config.ProfileEnv)
+	verbose := opts.Verbose
+	flags.BoolVar(&verbose, "verbose", verbose, "Log at debug level and log the effective configuration, secrets redacted")
+	flags.BoolVar(&verbose, "v", verbose, "Shorthand for --verbose")
+	failFast := flags.Bool("fail-fast", false, "Stop the run at the first rejected record, overriding errorhandling.strategy")
+	keepGoing := flags.Bool("keep-going", false, "Log and quarantine rejected records and carry on, overriding errorhandling.strategy")
+	tune := flags.Bool("tune", opts.Tune, "Print the buffer and batch figures of each run and the delivery settings they suggest to standard error")
+	flags.Parse(args)
+	if verbose {
+		logger.SetDebug()
+	}
+	strategy, err := fractal.StrategyFlag(*failFast, *keepGoing, opts.Strategy)
+	if err != nil {
+		logger.Fatalf("%v", err)
+	}
 
-		inputRequest := mapConfigToRequest(inputconfig)
-		data, err := inputIntegration.FetchData(inputRequest)
+	// Loading logs are held until it is known whether standard output carries data
+	held := &heldLog{}
+	path, err := resolveConfigPath(*configPath, held.Infof)
+	if err != nil {
+		logger.Fatalf("Failed to load configuration: %v, pass --config to name one", err)
+	}
+	configuration, err := config.LoadConfigWithOptions(config.Options{Logger: held}, path, *configFormat)
+	if err != nil {
+		logger.Fatalf("Failed to load configuration: %v", err)
+	}
+	if writesToStdout(configuration, *profile) {
+		logger.ToStderr()
+	}
+	held.replay()
+	runCLI(configuration, runOptions{Interval: *intervalSec, ReportPath: *report, Timeout: *timeout, Profile: *profile, Verbose: verbose, Strategy: strategy, Tune: *tune})
+}
 
-		if err != nil {
-			fetchSpan.RecordError(err)
-			fetchSpan.End()
-			logger.Fatalf("Failed to fetch data from %s: %v", inputMethod, err)
-		}
-		fetchSpan.End()
-
-			// Send data to output integration
-			_, sendSpan := opentele.CreateSpan(ctx, "send-data")
-			outputIntegration, found := registry.GetDestination(outputMethod.(string))
-			if !found {
-				sendSpan.RecordError(fmt.Errorf("output method %s not registered", outputMethod))
-				sendSpan.End()
-				logger.Fatalf("Output method %s not registered", outputMethod)
-			}
-			outputRequest := mapConfigToRequest(outputconfig)
-			err = outputIntegration.SendData(data, outputRequest)
-			if err != nil {
-				sendSpan.RecordError(err)
-				sendSpan.End()
-				logger.Fatalf("Failed to send data to %s: %v", outputMethod, err)
-			}
-			sendSpan.End()
+// stageCommands maps the subcommands running a single stage to that stage
+var stageCommands = map[string]string{"validate-data": "validate", "transform": "transform"}
+
+// stageCommand runs one stage of the configured pipeline over the source and
+// writes the records coming out of it to standard output, so rules can be
+// tried without a destination. The source's checkpoint is left alone, and
+// validate-data exits with 1 when any record was rejected.
+func stageCommand(command string, args []string, opts runOptions) {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	configPath := flags.String("config", opts.ConfigPath, `Config file to read the source and rules from, or "-" to read it from stdin; found in the search path when empty`)
+	configFormat := flags.String("config-format", "", "Config format, yaml or json, defaults to the file extension or yaml for stdin")
+	format := flags.String("format", integrations.StdoutJSONLines, "Format of the records written to standard output: csv, json, jsonl or yaml")
+	rejected := flags.String("rejected", "", "Append the rejected records, with the reasons, to this file as JSON lines")
+	report := flags.String("report", opts.ReportPath, "Write a JSON summary of the run to this file")
+	profile := flags.String("profile", opts.Profile, "Merge this named profile into the integration configs, defaults to $"+config.ProfileEnv)
+	verbose := opts.Verbose
+	flags.BoolVar(&verbose, "verbose", verbose, "Log at debug level and log the effective configuration, secrets redacted")
+	flags.BoolVar(&verbose, "v", verbose, "Shorthand for --verbose")
+	failFast := flags.Bool("fail-fast", false, "Stop at the first rejected record instead of writing the rejects to --rejected")
+	keepGoing := flags.Bool("keep-going", false, "Log and quarantine rejected records and carry on, the default")
+	flags.Parse(args)
+	if verbose {
+		logger.SetDebug()
+	}
+	strategy, err := fractal.StrategyFlag(*failFast, *keepGoing, opts.Strategy)
+	if err != nil {
+		logger.Fatalf("%v", err)
+	}
+	// Standard output carries the records
+	logger.ToStderr()
 
-			logger.Infof("Data sent successfully")
-		}
+	path, err := resolveConfigPath(*configPath, logger.Infof)
+	if err != nil {
+		logger.Fatalf("Failed to load configuration: %v, pass --config to name one", err)
+	}
+	configuration, err := config.LoadConfig(path, *configFormat)
+	if err != nil {
+		logger.Fatalf("Failed to load configuration: %v", err)
+	}
+	if err := config.ResolveConnections(configuration); err != nil {
+		logger.Fatalf("Failed to resolve connections: %v", err)
+	}
+	if err := config.ApplyProfile(configuration, config.ProfileName(*profile)); err != nil {
+		logger.Fatalf("Failed to apply profile: %v", err)
+	}
+	if err := config.ResolveSecrets(configuration); err != nil {
+		logger.Fatalf("Failed to read secrets: %v", err)
+	}
+	if verbose {
+		logEffectiveConfig(configuration)
+	}
+	method, _ := configuration["inputMethod"].(string)
+	inputconfig, ok := configuration["inputconfig"].(map[string]interface{})
+	if !ok {
+		logger.Fatalf("Missing 'inputconfig' in configuration")
+	}
+	// Only the source is used, so the destination's fields may be left out
+	if err := config.CheckRequiredFields(map[string]interface{}{"inputMethod": method, "inputconfig": inputconfig}); err != nil {
+		logger.Fatalf("Invalid configuration: %v", err)
+	}
+	source, found := registry.GetSource(method)
+	if !found {
+		logger.Fatalf("Input method %s not registered", method)
+	}
+	pipelineConfig, err := fractal.PipelineFromMap(configuration)
+	if err != nil {
+		logger.Fatalf("Invalid configuration: %v", err)
+	}
+	cfg, err := pipeline.StageOnly(pipelineConfig, stageCommands[command])
+	if err != nil {
+		logger.Fatalf("Cannot run %s: %v", command, err)
+	}
+	if *rejected != "" {
+		cfg.ErrorHandling.QuarantineOutput.Location = *rejected
+	}
+	// The stage runs LOG_AND_CONTINUE whatever the config says, unless a flag forces a strategy
+	if strategy != "" {
+		logger.Infof("Error strategy %s from the command line overrides %s, the default of %s", strategy, cfg.ErrorHandling.Strategy, command)
+		cfg.ErrorHandling.Strategy = strategy
+	}
 
-		// Run the task immediately
-		task()
+	p := &pipeline.Pipeline{
+		Source:             source,
+		SourceName:         method,
+		SourceRequest:      fractal.RequestFromMap(inputconfig),
+		Destination:        integrations.StdoutDestination{},
+		DestinationRequest: interfaces.Request{StdoutFormat: *format},
+		Config:             cfg,
+		SkipCheckpoint:     true,
+	}
+	startedAt := time.Now()
+	summary, err := p.Run(context.Background())
+	writeReport(pipeline.NewReport(method, "Stdout", startedAt, summary, err), *report)
+	if err != nil {
+		logger.Fatalf("%s over %s failed: %v", command, method, err)
+	}
+	logger.Infof("%s over %s: %d read, %d written, %d rejected",
+		command, method, summary.RecordsRead, summary.RecordsWritten, summary.RecordsQuarantined)
+	if command == "validate-data" && summary.RecordsQuarantined > 0 {
+		os.Exit(1)
+	}
+}
 
-		// Repeat the task every interval
-		ticker := time.NewTicker(time.Duration(intervalSec) * time.Second) // Adjust the interval as needed
-		defer ticker.Stop()
+// resolveConfigPath returns the config path given, or else the first file
+// found in config.SearchPaths, logging which it chose
+func resolveConfigPath(path string, logf func(format string, args ...any)) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	found, err := config.FindConfig()
+	if err != nil {
+		return "", err
+	}
+	logf("Using config file %s", found)
+	return found, nil
+}
 
-		// Infinite loop to keep executing the task every interval
-		for range ticker.C {
-			// Execute the task on each tick
-			task()
-		}
+// heldLog keeps log lines to write later
+type heldLog struct {
+	lines []string
+}
+
+func (h *heldLog) Infof(format string, args ...any) {
+	h.lines = append(h.lines, fmt.Sprintf(format, args...))
+}
 
+// replay logs the held lines
+func (h *heldLog) replay() {
+	for _, line := range h.lines {
+		logger.Infof("%s", line)
 	}
+	h.lines = nil
 }
 
-func getStringField(config map[string]interface{}, field string, defaultValue string) string {
-	if value, ok := config[field]; ok && value != nil {
-		switch v := value.(type) {
-		case string:
-			return v
-		case map[string]interface{}:
-			// Extract "strategy" or similar key from nested map if applicable
-			if strategy, exists := v["strategy"]; exists {
-				return strategy.(string)
+// writesToStdout reports whether the run's destination, with its connection
+// and the profile applied, writes its data to standard output
+func writesToStdout(configuration map[string]interface{}, profile string) bool {
+	effective := make(map[string]interface{}, len(configuration))
+	for key, value := range configuration {
+		effective[key] = value
+	}
+	// A bad connection or profile is reported when the run applies it
+	if err := config.ResolveConnections(effective); err != nil {
+		return false
+	}
+	if err := config.ApplyProfile(effective, config.ProfileName(profile)); err != nil {
+		return false
+	}
+	method, _ := effective["outputMethod"].(string)
+	outputconfig, _ := effective["outputconfig"].(map[string]interface{})
+	return integrations.WritesStdout(method, fractal.RequestFromMap(outputconfig))
+}
+
+// logEffectiveConfig logs the configuration a run uses, once profiles and
+// secret files are resolved, with the secrets redacted
+func logEffectiveConfig(configuration map[string]interface{}) {
+	effective, err := json.MarshalIndent(config.Redact(configuration), "", "  ")
+	if err != nil {
+		logger.Infof("Failed to encode the effective configuration: %v", err)
+		return
+	}
+	logger.Debugf("Effective configuration:\n%s", effective)
+}
+
+// rulesCommand lists the validation and transformation rule keywords
+func rulesCommand(args []string) {
+	flags := flag.NewFlagSet("rules", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "Print the rules as JSON")
+	flags.Parse(args)
+
+	rules := pipeline.Rules()
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		// Syntax is full of angle brackets, which are kept readable
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(rules); err != nil {
+			logger.Fatalf("Failed to encode rules: %v", err)
+		}
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	kind := ""
+	for _, rule := range rules {
+		if rule.Kind != kind {
+			if kind != "" {
+				fmt.Fprintln(w)
 			}
-			return fmt.Sprintf("%v", v) // Fallback for other maps
-		case []interface{}:
-			return fmt.Sprintf("%v", v)
-		default:
-			logger.Warnf("Unexpected type for field %s: %T", field, v)
+			kind = rule.Kind
+			fmt.Fprintf(w, "%s rules\nKEYWORD\tSTAGE\tSYNTAX\tDESCRIPTION\n", strings.ToUpper(kind[:1])+kind[1:])
 		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", rule.Keyword, rule.Stage, rule.Syntax, rule.Description)
 	}
-	return defaultValue
+	w.Flush()
 }
 
-func mapConfigToRequest(config map[string]interface{}) interfaces.Request {
-
-	return interfaces.Request{
-		Input:                   getStringField(config, "inputmethod", ""),
-		Output:                  getStringField(config, "outputmethod", ""),
-		ValidationRules:         getStringField(config, "validations", ""),
-		TransformationRules:     getStringField(config, "transformations", ""),
-		ErrorHandling:           getStringField(config, "errorhandling", ""),
-		RabbitMQInputURL:        getStringField(config, "url", ""),
-		RabbitMQInputQueueName:  getStringField(config, "queuename", ""),
-		RabbitMQOutputURL:       getStringField(config, "url", ""),
-		RabbitMQOutputQueueName: getStringField(config, "queuename", ""),
-		ConsumerURL:             getStringField(config, "url", ""),
-		ConsumerTopic:           getStringField(config, "topic", ""), // Default is empty if "topic" is missing
-		ProducerURL:             getStringField(config, "url", ""),
-		ProducerTopic:           getStringField(config, "topic", ""),
-		SQLSourceConnString:     getStringField(config, "connstring", ""),
-		SQLTargetConnString:     getStringField(config, "connstring", ""),
-		SourceMongoDBConnString: getStringField(config, "connstring", ""),
-		SourceMongoDBDatabase:   getStringField(config, "database", ""),
-		SourceMongoDBCollection: getStringField(config, "collection", ""),
-		TargetMongoDBConnString: getStringField(config, "connstring", ""),
-		TargetMongoDBDatabase:   getStringField(config, "database", ""),
-		TargetMongoDBCollection: getStringField(config, "collection", ""),
-		OutputFileName:          getStringField(config, "filename", ""),
-		CSVSourceFileName:       getStringField(config, "csvsourcefilename", ""),
-		CSVDestinationFileName:  getStringField(config, "csvdestinationfilename", ""),
-		JSONSourceData:          getStringField(config, "data", ""),
-		JSONOutputFilename:      getStringField(config, "filename", ""),
-		YAMLSourceFilePath:      getStringField(config, "filepath", ""),
-		YAMLDestinationFilePath: getStringField(config, "filepath", ""),
-		DynamoDBSourceTable:     getStringField(config, "tablename", ""),
-		DynamoDBTargetTable:     getStringField(config, "tablename", ""),
-		DynamoDBSourceRegion:    getStringField(config, "region", ""),
-		DynamoDBTargetRegion:    getStringField(config, "region", ""),
-		FTPURL:                  getStringField(config, "url", ""),
-		FTPUser:                 getStringField(config, "user", ""),
-		FTPPassword:             getStringField(config, "password", ""),
-		SFTPURL:                 getStringField(config, "url", ""),
-		SFTPUser:                getStringField(config, "user", ""),
-		SFTPPassword:            getStringField(config, "password", ""),
-		WebSocketSourceURL:      getStringField(config, "url", ""),
-		WebSocketDestURL:        getStringField(config, "url", ""),
-		CredentialFileAddr:      getStringField(config, "credentialfileaddr", "firebaseConfig.json"),
-		Document:                getStringField(config, "document", "sampledata"),
-		Collection:              getStringField(config, "collection", "1"),
+// writeReport prints the run report as a single JSON line and, when a path is given, saves it there
+func writeReport(report *pipeline.Report, path string) {
+	line, err := report.JSON()
+	if err != nil {
+		logger.Infof("Failed to encode run report: %v", err)
+		return
+	}
+	fmt.Println(string(line))
+	if path == "" {
+		return
+	}
+	if err := report.WriteFile(path); err != nil {
+		logger.Infof("%v", err)
 	}
 }
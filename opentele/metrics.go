@@ -0,0 +1,54 @@
+package opentele
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// DefaultMetricsInterval is how often metrics are exported when
+// METRICS_INTERVAL is not set
+const DefaultMetricsInterval = 10 * time.Second
+
+// InitMetrics initializes OpenTelemetry metrics with an OTLP exporter, so the
+// pipeline's gauges reach a collector
+func InitMetrics() (func(), error) {
+	// OTLP gRPC endpoint of the collector receiving the metrics
+	metricsURL := os.Getenv("METRICS_URL")
+	if metricsURL == "" {
+		metricsURL = "otel-collector:4317"
+	}
+	interval := DefaultMetricsInterval
+	if value := os.Getenv("METRICS_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid METRICS_INTERVAL %q: must be a positive duration such as 10s", value)
+		}
+		interval = parsed
+	}
+
+	metricExporter, err := otlpmetricgrpc.New(
+		context.Background(),
+		otlpmetricgrpc.WithEndpoint(metricsURL),
+		otlpmetricgrpc.WithInsecure(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP metric exporter: %v", err)
+	}
+	return InstallMeterProvider(sdkmetric.NewPeriodicReader(metricExporter, sdkmetric.WithInterval(interval))), nil
+}
+
+// InstallMeterProvider registers a meter provider collected by the reader
+// globally. The returned function shuts it down, exporting what is left.
+func InstallMeterProvider(reader sdkmetric.Reader) func() {
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	otel.SetMeterProvider(meterProvider)
+	return func() {
+		meterProvider.Shutdown(context.Background())
+	}
+}
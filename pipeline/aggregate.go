@@ -0,0 +1,398 @@
+package pipeline
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+)
+
+var aggregationPattern = regexp.MustCompile(`^(count|sum|min|max|avg)(?:\(\s*([^)]*?)\s*\))?(?:\s+as\s+(\S+))?$`)
+
+type aggregation struct {
+	fn    string
+	field string
+	name  string
+}
+
+// aggState is the running value of one aggregation within one group. Its
+// fields are exported so groups can be spilled to disk and merged later.
+type aggState struct {
+	Count int64   `json:"count"`
+	Sum   float64 `json:"sum"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+type groupState struct {
+	Key    string        `json:"key"`
+	Values []interface{} `json:"values"`
+	Aggs   []aggState    `json:"aggs"`
+}
+
+// AggregateStage groups records by key fields and emits one record per group
+// once the source is exhausted. It holds one entry per distinct group in
+// memory; with MaxGroups set it spills sorted partial results to disk and
+// merges them at the end instead.
+type AggregateStage struct {
+	groupBy      []string
+	aggregations []aggregation
+	maxGroups    int
+	spillDir     string
+
+	groups map[string]*groupState
+	spills []string
+}
+
+// NewAggregateStage parses the aggregation settings
+func NewAggregateStage(cfg interfaces.AggregateConfig) (*AggregateStage, error) {
+	a := &AggregateStage{
+		groupBy:   cfg.GroupBy,
+		maxGroups: cfg.MaxGroups,
+		spillDir:  cfg.SpillDir,
+		groups:    make(map[string]*groupState),
+	}
+	aggregations, err := parseAggregations(cfg.Aggregations, cfg.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+	a.aggregations = aggregations
+	return a, nil
+}
+
+// parseAggregations reads the aggregations, count when there are none. Their
+// output fields must not clash with each other or with the reserved fields,
+// such as the group fields.
+func parseAggregations(specs []string, reserved []string) ([]aggregation, error) {
+	if len(specs) == 0 {
+		specs = []string{"count"}
+	}
+	names := make(map[string]bool)
+	for _, field := range reserved {
+		names[field] = true
+	}
+	var aggregations []aggregation
+	for _, spec := range specs {
+		match := aggregationPattern.FindStringSubmatch(strings.TrimSpace(spec))
+		if match == nil {
+			return nil, fmt.Errorf("invalid aggregation %q: expected count, sum(field), min(field), max(field) or avg(field)", spec)
+		}
+		agg := aggregation{fn: match[1], field: match[2], name: match[3]}
+		if agg.field == "" && agg.fn != "count" {
+			return nil, fmt.Errorf("invalid aggregation %q: %s needs a field", spec, agg.fn)
+		}
+		if agg.name == "" {
+			agg.name = agg.fn
+			if agg.field != "" {
+				agg.name = agg.fn + "_" + agg.field
+			}
+		}
+		if names[agg.name] {
+			return nil, fmt.Errorf("duplicate aggregation output field %q", agg.name)
+		}
+		names[agg.name] = true
+		aggregations = append(aggregations, agg)
+	}
+	return aggregations, nil
+}
+
+// Name returns the stage name
+func (a *AggregateStage) Name() string {
+	return "aggregate"
+}
+
+// Process adds the record to its group. Nothing is emitted until Flush.
+func (a *AggregateStage) Process(rec Record) ([]Record, error) {
+	// Read every value first so a bad record leaves the group untouched
+	numbers, present, err := aggregationInputs(a.aggregations, rec)
+	if err != nil {
+		return nil, err
+	}
+
+	key, values, err := groupKey(a.groupBy, rec)
+	if err != nil {
+		return nil, err
+	}
+
+	group, ok := a.groups[key]
+	if !ok {
+		if a.maxGroups > 0 && len(a.groups) >= a.maxGroups {
+			if err := a.spill(); err != nil {
+				return nil, err
+			}
+		}
+		group = &groupState{Key: key, Values: values, Aggs: make([]aggState, len(a.aggregations))}
+		a.groups[key] = group
+	}
+	group.add(numbers, present)
+	return nil, nil
+}
+
+// aggregationInputs reads the values the aggregations take from a record,
+// and which of them it has
+func aggregationInputs(aggregations []aggregation, rec Record) ([]float64, []bool, error) {
+	numbers := make([]float64, len(aggregations))
+	present := make([]bool, len(aggregations))
+	for i, agg := range aggregations {
+		if agg.field == "" {
+			present[i] = true
+			continue
+		}
+		value, ok := rec[agg.field]
+		if !ok || value == nil || value == "" {
+			continue
+		}
+		present[i] = true
+		if agg.fn == "count" {
+			continue
+		}
+		n, ok := toFloat(value)
+		if !ok {
+			return nil, nil, fmt.Errorf("cannot %s field %s: %v is not a number", agg.fn, agg.field, value)
+		}
+		numbers[i] = n
+	}
+	return numbers, present, nil
+}
+
+// groupKey returns the key of the group a record falls in and its values of the group fields
+func groupKey(groupBy []string, rec Record) (string, []interface{}, error) {
+	values := make([]interface{}, len(groupBy))
+	for i, field := range groupBy {
+		values[i] = rec[field]
+	}
+	rawKey, err := json.Marshal(values)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot group record: %w", err)
+	}
+	return string(rawKey), values, nil
+}
+
+// add folds the values aggregationInputs read into the group
+func (g *groupState) add(numbers []float64, present []bool) {
+	for i := range g.Aggs {
+		if present[i] {
+			g.Aggs[i].add(numbers[i])
+		}
+	}
+}
+
+// Flush emits one record per group, merging any spilled partial results
+func (a *AggregateStage) Flush() ([]Record, error) {
+	defer a.Close()
+
+	if len(a.spills) == 0 {
+		var records []Record
+		for _, group := range a.sortedGroups() {
+			records = append(records, a.record(group))
+		}
+		a.groups = make(map[string]*groupState)
+		return records, nil
+	}
+
+	if err := a.spill(); err != nil {
+		return nil, err
+	}
+	return a.merge()
+}
+
+// Close removes any spill files left behind
+func (a *AggregateStage) Close() error {
+	var errs []error
+	for _, path := range a.spills {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	a.spills = nil
+	return errors.Join(errs...)
+}
+
+// Columns lists the group fields followed by the aggregations, as configured
+func (a *AggregateStage) Columns(previous []string) []string {
+	columns := append([]string{}, a.groupBy...)
+	for _, agg := range a.aggregations {
+		columns = append(columns, agg.name)
+	}
+	return columns
+}
+
+func (s *aggState) add(n float64) {
+	if s.Count == 0 || n < s.Min {
+		s.Min = n
+	}
+	if s.Count == 0 || n > s.Max {
+		s.Max = n
+	}
+	s.Count++
+	s.Sum += n
+}
+
+func (s *aggState) merge(other aggState) {
+	if other.Count == 0 {
+		return
+	}
+	if s.Count == 0 || other.Min < s.Min {
+		s.Min = other.Min
+	}
+	if s.Count == 0 || other.Max > s.Max {
+		s.Max = other.Max
+	}
+	s.Count += other.Count
+	s.Sum += other.Sum
+}
+
+func (a *AggregateStage) sortedGroups() []*groupState {
+	groups := make([]*groupState, 0, len(a.groups))
+	for _, group := range a.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Key < groups[j].Key })
+	return groups
+}
+
+func (a *AggregateStage) record(group *groupState) Record {
+	rec := Record{}
+	for i, field := range a.groupBy {
+		rec[field] = group.Values[i]
+	}
+	setAggregates(rec, a.aggregations, group.Aggs)
+	return rec
+}
+
+// setAggregates stores the value of each aggregation in its output field
+func setAggregates(rec Record, aggregations []aggregation, states []aggState) {
+	for i, agg := range aggregations {
+		state := states[i]
+		switch agg.fn {
+		case "count":
+			rec[agg.name] = state.Count
+		case "sum":
+			rec[agg.name] = state.Sum
+		case "min", "max", "avg":
+			if state.Count == 0 {
+				rec[agg.name] = nil
+			} else if agg.fn == "min" {
+				rec[agg.name] = state.Min
+			} else if agg.fn == "max" {
+				rec[agg.name] = state.Max
+			} else {
+				rec[agg.name] = state.Sum / float64(state.Count)
+			}
+		}
+	}
+}
+
+// spill writes the in-memory groups to a temporary file sorted by key
+func (a *AggregateStage) spill() error {
+	if len(a.groups) == 0 {
+		return nil
+	}
+	file, err := os.CreateTemp(a.spillDir, "fractal-aggregate-*.gob")
+	if err != nil {
+		return fmt.Errorf("failed to create aggregation spill file: %w", err)
+	}
+	a.spills = append(a.spills, file.Name())
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	encoder := newSpillEncoder(writer)
+	for _, group := range a.sortedGroups() {
+		if err := encoder.encode(group); err != nil {
+			return fmt.Errorf("failed to write aggregation spill file: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write aggregation spill file: %w", err)
+	}
+	logger.Infof("Aggregation spilled %d groups to %s", len(a.groups), file.Name())
+	a.groups = make(map[string]*groupState)
+	return nil
+}
+
+// merge combines the sorted spill files, folding together partial results for the same key
+func (a *AggregateStage) merge() ([]Record, error) {
+	runs := &spillRuns{}
+	for _, path := range a.spills {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open aggregation spill file: %w", err)
+		}
+		defer file.Close()
+		run := &spillRun{decoder: newSpillDecoder(bufio.NewReader(file))}
+		if err := run.next(); err != nil {
+			return nil, err
+		}
+		if run.current != nil {
+			heap.Push(runs, run)
+		}
+	}
+
+	var records []Record
+	var pending *groupState
+	for runs.Len() > 0 {
+		run := heap.Pop(runs).(*spillRun)
+		group := run.current
+		if pending != nil && pending.Key == group.Key {
+			for i := range pending.Aggs {
+				pending.Aggs[i].merge(group.Aggs[i])
+			}
+		} else {
+			if pending != nil {
+				records = append(records, a.record(pending))
+			}
+			pending = group
+		}
+		if err := run.next(); err != nil {
+			return nil, err
+		}
+		if run.current != nil {
+			heap.Push(runs, run)
+		}
+	}
+	if pending != nil {
+		records = append(records, a.record(pending))
+	}
+	return records, nil
+}
+
+type spillRun struct {
+	decoder *spillDecoder
+	current *groupState
+}
+
+func (r *spillRun) next() error {
+	r.current = nil
+	var group groupState
+	if err := r.decoder.decode(&group); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return fmt.Errorf("corrupt aggregation spill file: %w", err)
+	}
+	r.current = &group
+	return nil
+}
+
+// spillRuns is a min-heap of spill files ordered by their current group key
+type spillRuns []*spillRun
+
+func (h spillRuns) Len() int            { return len(h) }
+func (h spillRuns) Less(i, j int) bool  { return h[i].current.Key < h[j].current.Key }
+func (h spillRuns) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *spillRuns) Push(x interface{}) { *h = append(*h, x.(*spillRun)) }
+func (h *spillRuns) Pop() interface{} {
+	old := *h
+	run := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return run
+}
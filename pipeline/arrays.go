@@ -0,0 +1,133 @@
+package pipeline
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+func init() {
+	registerTransform(TransformRule{
+		Keyword:     "dedup-array",
+		Syntax:      `dedup-array <field>`,
+		Description: "Removes repeated elements from an array field, keeping the first of each",
+		parse:       parseDedupArrayRule,
+	})
+	registerTransform(TransformRule{
+		Keyword:     "sort-array",
+		Syntax:      `sort-array <field> [asc|desc]`,
+		Description: "Sorts the elements of an array field, as numbers when they all are and as text otherwise",
+		parse:       parseSortArrayRule,
+	})
+}
+
+// parseDedupArrayRule reads a dedup-array rule. A missing or null field is
+// left alone; any other value that is not an array rejects the record.
+func parseDedupArrayRule(args []string, _ interfaces.TransformConfig) (transformFunc, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected one field to deduplicate")
+	}
+	field := args[0]
+
+	return func(rec Record) error {
+		value, ok := rec[field]
+		if !ok || value == nil {
+			return nil
+		}
+		elements, err := arrayElements(value)
+		if err != nil {
+			return fmt.Errorf("cannot deduplicate field %s: %w", field, err)
+		}
+		kept := make([]interface{}, 0, len(elements))
+		for _, element := range elements {
+			seen := false
+			for _, previous := range kept {
+				if reflect.DeepEqual(element, previous) {
+					seen = true
+					break
+				}
+			}
+			if !seen {
+				kept = append(kept, element)
+			}
+		}
+		rec[field] = kept
+		return nil
+	}, nil
+}
+
+// parseSortArrayRule reads a sort-array rule. Null elements go last in either
+// direction, and an array holding objects or arrays rejects the record.
+func parseSortArrayRule(args []string, _ interfaces.TransformConfig) (transformFunc, error) {
+	descending := false
+	if len(args) == 2 {
+		switch strings.ToLower(args[1]) {
+		case "asc":
+		case "desc":
+			descending = true
+		default:
+			return nil, fmt.Errorf("unknown direction %s", args[1])
+		}
+		args = args[:1]
+	}
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected one field to sort")
+	}
+	field := args[0]
+
+	return func(rec Record) error {
+		value, ok := rec[field]
+		if !ok || value == nil {
+			return nil
+		}
+		elements, err := arrayElements(value)
+		if err != nil {
+			return fmt.Errorf("cannot sort field %s: %w", field, err)
+		}
+		sorted, err := sortElements(elements, descending)
+		if err != nil {
+			return fmt.Errorf("cannot sort field %s: %w", field, err)
+		}
+		rec[field] = sorted
+		return nil
+	}, nil
+}
+
+// sortElements returns a sorted copy of elements, comparing them as numbers
+// when every one of them is a number or numeric text
+func sortElements(elements []interface{}, descending bool) ([]interface{}, error) {
+	var present, nulls []interface{}
+	numeric := true
+	for _, element := range elements {
+		if element == nil {
+			nulls = append(nulls, element)
+			continue
+		}
+		switch reflect.ValueOf(element).Kind() {
+		case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+			return nil, fmt.Errorf("element of type %T cannot be sorted", element)
+		}
+		if _, ok := toFloat(element); !ok {
+			numeric = false
+		}
+		present = append(present, element)
+	}
+	less := func(a, b interface{}) bool {
+		if numeric {
+			x, _ := toFloat(a)
+			y, _ := toFloat(b)
+			return x < y
+		}
+		return fmt.Sprint(a) < fmt.Sprint(b)
+	}
+	sort.SliceStable(present, func(i, j int) bool {
+		if descending {
+			return less(present[j], present[i])
+		}
+		return less(present[i], present[j])
+	})
+	return append(present, nulls...), nil
+}
@@ -0,0 +1,261 @@
+package pipeline
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+)
+
+// DefaultBufferCapacity is the number of records held in memory when BufferConfig.Capacity is not set
+const DefaultBufferCapacity = 10000
+
+// recordBuffer is a bounded FIFO queue between the stages and the
+// destination. When it is full, Put blocks until the destination catches up,
+// or with spilling enabled appends the record to a temporary file which is
+// read back, in order, once the in-memory records are drained. Spilled
+// records pass through JSON, so numbers come back as float64.
+type recordBuffer struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queue    []Record
+	capacity int
+	spill    bool
+	spillDir string
+	closed   bool
+	err      error
+
+	file      *os.File
+	writer    *bufio.Writer
+	encoder   *spillEncoder
+	readFile  *os.File
+	decoder   *spillDecoder
+	spilled   int // records written to the current spill file
+	unspilled int // records read back from it
+
+	peak         int           // most records held at once
+	totalSpilled int           // records spilled over the run
+	putWait      time.Duration // time Put spent waiting for room
+	getWait      time.Duration // time Get spent waiting for a record
+}
+
+// BufferStats shows where a run was held up. Stages that waited long for room
+// were held back by the destination, and a destination that waited long for
+// records was kept waiting by the source and the stages.
+type BufferStats struct {
+	Capacity          int   `json:"capacity"`
+	Peak              int   `json:"peak"`                // Most records held at once, spilled ones included
+	Spilled           int   `json:"spilled"`             // Records that overflowed to the spill file
+	StagesWaitMS      int64 `json:"stages_wait_ms"`      // Time the stages spent waiting for room
+	DestinationWaitMS int64 `json:"destination_wait_ms"` // Time the destination spent waiting for records
+
+	// Filled in from the delivery once it has sent everything
+	BatchSize       int     `json:"batch_size"`           // Records per batch, 0 when everything goes in one call
+	MaxInFlight     int     `json:"max_in_flight"`        // Batches that could be written at once
+	Batches         int     `json:"batches"`              // Batches handed to the destination that held records
+	AvgBatchRecords float64 `json:"avg_batch_records"`    // Records per batch, on average
+	BatchFill       float64 `json:"batch_fill,omitempty"` // AvgBatchRecords as a share of BatchSize
+	SlotsWaitMS     int64   `json:"slots_wait_ms"`        // Time full batches waited for a batch slot to free up
+	DestinationBusy float64 `json:"destination_busy"`     // Share of the batch slots' time spent writing
+	SendMS          int64   `json:"send_ms"`              // Time spent draining the buffer into the destination
+}
+
+func newRecordBuffer(cfg interfaces.BufferConfig) *recordBuffer {
+	capacity := cfg.Capacity
+	if capacity <= 0 {
+		capacity = DefaultBufferCapacity
+	}
+	b := &recordBuffer{capacity: capacity, spill: cfg.Spill, spillDir: cfg.SpillDir}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// Put adds a record, blocking while the buffer is full unless spilling is enabled
+func (b *recordBuffer) Put(rec Record) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.spill && len(b.queue) >= b.capacity && b.err == nil {
+		started := time.Now()
+		for !b.spill && len(b.queue) >= b.capacity && b.err == nil {
+			b.cond.Wait()
+		}
+		b.putWait += time.Since(started)
+	}
+	if b.err != nil {
+		return b.err
+	}
+	defer b.cond.Broadcast()
+	defer func() { b.peak = max(b.peak, b.held()) }()
+
+	// Once records are on disk, later ones follow them there to keep the order
+	if len(b.queue) < b.capacity && b.spilled == b.unspilled {
+		b.queue = append(b.queue, rec)
+		return nil
+	}
+	if err := b.writeSpill(rec); err != nil {
+		b.err = err
+		return err
+	}
+	return nil
+}
+
+// Get removes the oldest record. It returns false once the buffer is closed and empty.
+func (b *recordBuffer) Get() (Record, bool, error) {
+	rec, ok, _, err := b.GetBefore(time.Time{})
+	return rec, ok, err
+}
+
+// GetBefore is Get giving up at the deadline, when it returns false and
+// timedOut. A zero deadline waits as long as Get.
+func (b *recordBuffer) GetBefore(deadline time.Time) (rec Record, ok bool, timedOut bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	waiting := func() bool {
+		return len(b.queue) == 0 && b.spilled == b.unspilled && !b.closed && b.err == nil
+	}
+	if waiting() {
+		started := time.Now()
+		if !deadline.IsZero() {
+			// Wakes the wait below at the deadline, as a sync.Cond has no timeout
+			timer := time.AfterFunc(time.Until(deadline), func() {
+				b.mu.Lock()
+				defer b.mu.Unlock()
+				b.cond.Broadcast()
+			})
+			defer timer.Stop()
+		}
+		for waiting() && (deadline.IsZero() || time.Now().Before(deadline)) {
+			b.cond.Wait()
+		}
+		b.getWait += time.Since(started)
+		if waiting() {
+			return nil, false, true, nil
+		}
+	}
+	if b.err != nil {
+		return nil, false, false, b.err
+	}
+	if len(b.queue) == 0 && b.spilled > b.unspilled {
+		if err := b.readSpill(); err != nil {
+			b.err = err
+			b.cond.Broadcast()
+			return nil, false, false, err
+		}
+	}
+	if len(b.queue) == 0 {
+		return nil, false, false, nil
+	}
+	rec = b.queue[0]
+	b.queue[0] = nil
+	b.queue = b.queue[1:]
+	b.cond.Broadcast()
+	return rec, true, false, nil
+}
+
+// Close marks the end of the input, or aborts both sides when err is set
+func (b *recordBuffer) Close(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	if err != nil && b.err == nil {
+		b.err = err
+	}
+	b.cond.Broadcast()
+}
+
+// held returns how many records the buffer holds, in memory and spilled
+func (b *recordBuffer) held() int {
+	return len(b.queue) + b.spilled - b.unspilled
+}
+
+// Held returns how many records the buffer holds and its in-memory capacity
+func (b *recordBuffer) Held() (int, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.held(), b.capacity
+}
+
+// Stats returns the buffer's fill and wait figures so far
+func (b *recordBuffer) Stats() *BufferStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return &BufferStats{
+		Capacity:          b.capacity,
+		Peak:              b.peak,
+		Spilled:           b.totalSpilled,
+		StagesWaitMS:      b.putWait.Milliseconds(),
+		DestinationWaitMS: b.getWait.Milliseconds(),
+	}
+}
+
+// Cleanup removes the spill file, if there is one
+func (b *recordBuffer) Cleanup() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.removeSpill(); err != nil {
+		logger.Infof("Failed to remove buffer spill file: %v", err)
+	}
+}
+
+func (b *recordBuffer) writeSpill(rec Record) error {
+	if b.file == nil {
+		file, err := os.CreateTemp(b.spillDir, "fractal-buffer-*.gob")
+		if err != nil {
+			return fmt.Errorf("failed to create buffer spill file: %w", err)
+		}
+		reader, err := os.Open(file.Name())
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+			return fmt.Errorf("failed to open buffer spill file: %w", err)
+		}
+		b.file = file
+		b.writer = bufio.NewWriter(file)
+		b.encoder = newSpillEncoder(b.writer)
+		b.readFile = reader
+		b.decoder = newSpillDecoder(bufio.NewReader(reader))
+		logger.Infof("Buffer full at %d records, spilling to %s", b.capacity, file.Name())
+	}
+	if err := b.encoder.encode(rec); err != nil {
+		return fmt.Errorf("failed to spill record: %w", err)
+	}
+	b.spilled++
+	b.totalSpilled++
+	return nil
+}
+
+// readSpill moves up to capacity records from the spill file back into memory
+func (b *recordBuffer) readSpill() error {
+	if err := b.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write buffer spill file: %w", err)
+	}
+	for len(b.queue) < b.capacity && b.unspilled < b.spilled {
+		var rec Record
+		if err := b.decoder.decode(&rec); err != nil {
+			return fmt.Errorf("failed to read buffer spill file: %w", err)
+		}
+		b.queue = append(b.queue, rec)
+		b.unspilled++
+	}
+	// Start afresh next time rather than letting a drained file grow
+	if b.unspilled == b.spilled {
+		return b.removeSpill()
+	}
+	return nil
+}
+
+func (b *recordBuffer) removeSpill() error {
+	if b.file == nil {
+		return nil
+	}
+	name := b.file.Name()
+	err := errors.Join(b.file.Close(), b.readFile.Close(), os.Remove(name))
+	b.file, b.writer, b.encoder, b.readFile, b.decoder = nil, nil, nil, nil, nil
+	b.spilled, b.unspilled = 0, 0
+	return err
+}
@@ -0,0 +1,82 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CheckpointVersion is bumped whenever the checkpoint file format changes incompatibly
+const CheckpointVersion = 1
+
+// DefaultCheckpointFile is where checkpoints are kept when no file is configured
+const DefaultCheckpointFile = "fractal_checkpoint.json"
+
+// Checkpoint holds the progress markers sources keep between runs, such as the
+// last watermark read from each table, keyed by a name the source chooses
+type Checkpoint struct {
+	Version   int               `json:"version"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Values    map[string]string `json:"values"`
+}
+
+// LoadCheckpoint reads the checkpoint at path. A missing file is an empty checkpoint.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	checkpoint := &Checkpoint{Version: CheckpointVersion, Values: map[string]string{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %s: %w", path, err)
+	}
+	if checkpoint.Version != CheckpointVersion {
+		return nil, fmt.Errorf("checkpoint %s has version %d, expected %d", path, checkpoint.Version, CheckpointVersion)
+	}
+	if checkpoint.Values == nil {
+		checkpoint.Values = map[string]string{}
+	}
+	return checkpoint, nil
+}
+
+// Save replaces the checkpoint at path, so a crash mid-write leaves the previous one intact
+func (c *Checkpoint) Save(path string) error {
+	c.Version = CheckpointVersion
+	c.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+	if err := writeFileAtomic(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// into place with perm, so readers never see a partial file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
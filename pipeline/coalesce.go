@@ -0,0 +1,56 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+func init() {
+	registerTransform(TransformRule{
+		Keyword:     "coalesce",
+		Syntax:      `coalesce <target> = <field>, <field>... [drop]`,
+		Description: "Stores the first of the fields that is not null or empty in target, optionally dropping the others",
+		parse:       parseCoalesceRule,
+	})
+}
+
+// parseCoalesceRule reads a coalesce rule. A last word drop, not followed by
+// a comma, drops the source fields once their value is taken.
+func parseCoalesceRule(args []string, _ interfaces.TransformConfig) (transformFunc, error) {
+	if len(args) < 3 || args[1] != "=" {
+		return nil, fmt.Errorf("missing the fields to coalesce")
+	}
+	target, rest := args[0], args[2:]
+	drop := false
+	if last := len(rest) - 1; last > 0 && strings.EqualFold(rest[last], "drop") && !strings.HasSuffix(rest[last-1], ",") {
+		drop, rest = true, rest[:last]
+	}
+	var fields []string
+	for _, field := range strings.Split(strings.Join(rest, " "), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			return nil, fmt.Errorf("empty field in the list to coalesce")
+		}
+		fields = append(fields, field)
+	}
+
+	return func(rec Record) error {
+		// Null follows the nulls stage, which has already turned the configured null markers into nil
+		var value interface{}
+		for _, field := range fields {
+			if v := rec[field]; v != nil && v != "" {
+				value = v
+				break
+			}
+		}
+		if drop {
+			for _, field := range fields {
+				delete(rec, field)
+			}
+		}
+		rec[target] = value
+		return nil
+	}, nil
+}
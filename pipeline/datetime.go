@@ -0,0 +1,167 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	// Time zone names resolve even on hosts without a zone database, such as slim containers
+	_ "time/tzdata"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+// timeLayout is a Go time layout or one of the named aliases
+type timeLayout struct {
+	name    string
+	layouts []string      // Tried in order when parsing, the first is used for formatting
+	epoch   time.Duration // Unit of a Unix timestamp, 0 for text layouts
+}
+
+// namedTimeLayouts are the aliases a datetime rule accepts instead of a Go layout
+var namedTimeLayouts = map[string]timeLayout{
+	"rfc3339":     {layouts: []string{time.RFC3339}},
+	"rfc3339nano": {layouts: []string{time.RFC3339Nano}},
+	"iso8601":     {layouts: []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"}},
+	"rfc1123":     {layouts: []string{time.RFC1123}},
+	"rfc1123z":    {layouts: []string{time.RFC1123Z}},
+	"date":        {layouts: []string{time.DateOnly}},
+	"datetime":    {layouts: []string{time.DateTime}},
+	"unix":        {epoch: time.Second},
+	"unixms":      {epoch: time.Millisecond},
+}
+
+func init() {
+	registerTransform(TransformRule{
+		Keyword:     "datetime",
+		Syntax:      `datetime <field> from <layout> [in <zone>] to <layout> [<zone>]`,
+		Description: "Parses a timestamp and rewrites it in another layout and time zone",
+		parse:       parseDatetimeRule,
+	})
+}
+
+// parseDatetimeRule reads a datetime rule. Values without an offset are read
+// in the from zone, UTC by default, and written in the to zone, by default
+// the zone they were read in.
+func parseDatetimeRule(args []string, _ interfaces.TransformConfig) (transformFunc, error) {
+	if len(args) < 5 || !strings.EqualFold(args[1], "from") {
+		return nil, fmt.Errorf("missing layouts")
+	}
+	field := args[0]
+	from, err := parseTimeLayout(args[2])
+	if err != nil {
+		return nil, err
+	}
+	rest := args[3:]
+	inZone := time.UTC
+	if strings.EqualFold(rest[0], "in") {
+		if len(rest) < 3 {
+			return nil, fmt.Errorf("missing the layout to write")
+		}
+		if inZone, err = time.LoadLocation(rest[1]); err != nil {
+			return nil, fmt.Errorf("unknown time zone %q", rest[1])
+		}
+		rest = rest[2:]
+	}
+	if !strings.EqualFold(rest[0], "to") || len(rest) < 2 || len(rest) > 3 {
+		return nil, fmt.Errorf("missing the layout to write")
+	}
+	to, err := parseTimeLayout(rest[1])
+	if err != nil {
+		return nil, err
+	}
+	var outZone *time.Location
+	if len(rest) == 3 {
+		if outZone, err = time.LoadLocation(rest[2]); err != nil {
+			return nil, fmt.Errorf("unknown time zone %q", rest[2])
+		}
+	}
+
+	return func(rec Record) error {
+		value, ok := rec[field]
+		// Missing, null and empty values are left alone
+		if !ok || value == nil || value == "" {
+			return nil
+		}
+		t, err := from.parse(value, inZone)
+		if err != nil {
+			return fmt.Errorf("cannot parse field %s value %q as %s", field, fmt.Sprint(value), from.name)
+		}
+		if outZone != nil {
+			t = t.In(outZone)
+		}
+		rec[field] = to.format(t)
+		return nil
+	}, nil
+}
+
+// parseTimeLayout resolves a named alias, or takes the word as a Go layout
+func parseTimeLayout(word string) (timeLayout, error) {
+	if layout, ok := namedTimeLayouts[strings.ToLower(word)]; ok {
+		layout.name = strings.ToLower(word)
+		return layout, nil
+	}
+	if !strings.ContainsAny(word, "0123456789") {
+		return timeLayout{}, fmt.Errorf("unknown time layout %q", word)
+	}
+	return timeLayout{name: word, layouts: []string{word}}, nil
+}
+
+// parse reads a value in the layout. Times from sources that have them are taken as they are.
+func (l timeLayout) parse(value interface{}, zone *time.Location) (time.Time, error) {
+	if t, ok := value.(time.Time); ok {
+		return t, nil
+	}
+	if l.epoch > 0 {
+		n, err := epochValue(value)
+		if err != nil {
+			return time.Time{}, err
+		}
+		whole, frac := math.Modf(n)
+		if l.epoch == time.Second {
+			return time.Unix(int64(whole), int64(frac*1e9)).In(zone), nil
+		}
+		return time.UnixMilli(int64(whole)).Add(time.Duration(frac * 1e6)).In(zone), nil
+	}
+	text := strings.TrimSpace(fmt.Sprint(value))
+	var err error
+	for _, layout := range l.layouts {
+		var t time.Time
+		if t, err = time.ParseInLocation(layout, text, zone); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// format writes the time in the layout; Unix timestamps are integers
+func (l timeLayout) format(t time.Time) interface{} {
+	switch l.epoch {
+	case time.Second:
+		return t.Unix()
+	case time.Millisecond:
+		return t.UnixMilli()
+	}
+	return t.Format(l.layouts[0])
+}
+
+// epochValue reads a Unix timestamp from a number or a numeric string
+func epochValue(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case json.Number:
+		return v.Float64()
+	}
+	return strconv.ParseFloat(strings.TrimSpace(fmt.Sprint(value)), 64)
+}
@@ -0,0 +1,343 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+	"golang.org/x/time/rate"
+)
+
+// DefaultRetryBackoff is the wait before the first retry when DeliveryConfig.RetryBackoff is not set
+const DefaultRetryBackoff = time.Second
+
+// DefaultMaxInFlight is how many batches the destination writes at once when
+// DeliveryConfig.MaxInFlight is not set: one, so batches arrive in order
+const DefaultMaxInFlight = 1
+
+// DestinationStageName is reported for records a destination rejected while writing the rest of their batch
+const DestinationStageName = "destination"
+
+// RejectedRow is a record a destination refused and why
+type RejectedRow struct {
+	Record map[string]interface{}
+	Reason string
+}
+
+// RejectedRowsError is returned by SendData when a destination wrote part of a
+// batch and refused the rest, such as rows that do not fit the table's schema.
+// The pipeline quarantines the refused records instead of retrying the batch.
+type RejectedRowsError struct {
+	Rows []RejectedRow
+}
+
+func (e *RejectedRowsError) Error() string {
+	if len(e.Rows) == 1 {
+		return fmt.Sprintf("destination rejected a row: %s", e.Rows[0].Reason)
+	}
+	return fmt.Sprintf("destination rejected %d rows", len(e.Rows))
+}
+
+// delivery hands records to the destination in batches, pacing the calls
+// with token buckets, bounding the batches in flight and retrying batches
+// the destination rejects.
+type delivery struct {
+	batchSize   int
+	retries     int
+	backoff     time.Duration
+	maxInFlight int
+	flushEvery  time.Duration // Longest a partial batch is held, 0 holds it until it is full
+	records     *rate.Limiter
+	batches     *rate.Limiter
+	rejected    *quarantine
+	budget      *errorBudget
+	parts       *outputParts
+	reconcile   *reconciler // Counts the records written by key, nil when reconciliation is off
+	routes      *routes     // Targets named from record fields, nil when the destination has one
+	manifest    *manifest   // Files written for the marker, nil when no manifest is written
+	profile     *profiler   // Column statistics of the records written, nil when profiling is off
+
+	// mu guards the summary, the quarantine, inFlight and the figures below while batches are in flight
+	mu       sync.Mutex
+	inFlight int
+
+	batchesSent int           // Batches handed to the destination that held records
+	recordsSent int           // Records in those batches
+	slotWait    time.Duration // Time full batches waited for a free slot
+	busy        time.Duration // Time spent in SendData calls, summed over the slots
+	sendTime    time.Duration // Time send spent draining the buffer
+}
+
+func newDelivery(cfg interfaces.DeliveryConfig, errorHandling interfaces.ErrorHandling, budget *errorBudget) (*delivery, error) {
+	d := &delivery{batchSize: cfg.BatchSize, retries: cfg.Retries, backoff: DefaultRetryBackoff, maxInFlight: cfg.MaxInFlight, rejected: newQuarantine(errorHandling), budget: budget}
+	if cfg.BatchSize < 0 || cfg.Retries < 0 || cfg.MaxRecordsPerSecond < 0 || cfg.MaxBatchesPerSecond < 0 || cfg.MaxInFlight < 0 {
+		return nil, fmt.Errorf("delivery settings must not be negative")
+	}
+	if d.maxInFlight == 0 {
+		d.maxInFlight = DefaultMaxInFlight
+	}
+	if cfg.RetryBackoff != "" {
+		backoff, err := time.ParseDuration(cfg.RetryBackoff)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry backoff %q: %w", cfg.RetryBackoff, err)
+		}
+		d.backoff = backoff
+	}
+	if cfg.FlushInterval != "" {
+		interval, err := time.ParseDuration(cfg.FlushInterval)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid flush interval %q: must be a positive duration such as 5s", cfg.FlushInterval)
+		}
+		d.flushEvery = interval
+	}
+	if cfg.MaxRecordsPerSecond > 0 {
+		// Pacing records only works if they go out in pieces, so default to a second's worth per batch
+		if d.batchSize == 0 {
+			d.batchSize = int(math.Ceil(cfg.MaxRecordsPerSecond))
+		}
+		d.records = rate.NewLimiter(rate.Limit(cfg.MaxRecordsPerSecond), d.batchSize)
+	}
+	if cfg.MaxBatchesPerSecond > 0 {
+		d.batches = rate.NewLimiter(rate.Limit(cfg.MaxBatchesPerSecond), 1)
+	}
+	return d, nil
+}
+
+// send drains the buffer into the destination, in batches when batching is
+// on and in a single call otherwise. With a flush interval a batch also goes
+// out once its first record has waited that long, full or not. Up to
+// maxInFlight batches are written at once; after a batch fails no more are
+// started and send returns once those in flight have finished. Batches take
+// the shape of the dataset the records came from.
+func (d *delivery) send(ctx context.Context, dest interfaces.DataDestination, req interfaces.Request, dataset *Dataset, buffer *recordBuffer, summary *Summary) error {
+	started := time.Now()
+	defer func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.sendTime = time.Since(started)
+	}()
+	slots := make(chan struct{}, d.maxInFlight)
+	var wg sync.WaitGroup
+	var failed error
+	failure := func() error {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return failed
+	}
+	dispatched, start := 0, 0
+	dispatchTo := func(batch []Record, req interfaces.Request, parts *outputParts, index int) error {
+		waitStarted := time.Now()
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+		waited := time.Since(waitStarted)
+		if err := failure(); err != nil {
+			<-slots
+			return err
+		}
+		batchReq := req
+		d.mu.Lock()
+		batchReq.OutputPart, batchReq.OutputAppend = parts.next(index)
+		d.inFlight++
+		d.slotWait += waited
+		if len(batch) > 0 {
+			d.batchesSent++
+			d.recordsSent += len(batch)
+		}
+		d.mu.Unlock()
+		wg.Add(1)
+		go func(batch []Record, start int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			sendStarted := time.Now()
+			written, err := d.sendBatch(ctx, dest, batchReq, dataset.withRecords(batch), summary)
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			d.inFlight--
+			d.busy += time.Since(sendStarted)
+			summary.RecordsWritten += written
+			if err == nil {
+				err = parts.written(batchReq, written)
+			}
+			if err != nil && failed == nil {
+				failed = fmt.Errorf("batch starting at record %d: %w", start, err)
+			}
+		}(batch, start)
+		dispatched++
+		start += len(batch)
+		return nil
+	}
+	// Routed records go out as one batch per target they name
+	dispatch := func(batch []Record) error {
+		if d.routes == nil {
+			return dispatchTo(batch, req, d.parts, dispatched)
+		}
+		targets, groups, err := d.route(ctx, dest, req, batch)
+		if err != nil {
+			return err
+		}
+		for _, target := range targets {
+			if err := dispatchTo(groups[target.name], target.req, target.parts, target.dispatched); err != nil {
+				return err
+			}
+			target.dispatched++
+		}
+		return nil
+	}
+	finish := func(err error) error {
+		wg.Wait()
+		if err != nil {
+			return err
+		}
+		return failure()
+	}
+
+	var batch []Record
+	var due time.Time // When the batch is flushed whatever its size, zero without a flush interval
+	for {
+		rec, ok, timedOut, err := buffer.GetBefore(due)
+		if err != nil {
+			return finish(err)
+		}
+		if !ok && !timedOut {
+			break
+		}
+		if ok {
+			if len(batch) == 0 && d.flushEvery > 0 {
+				due = time.Now().Add(d.flushEvery)
+			}
+			batch = append(batch, rec)
+		}
+		full := d.batchSize > 0 && len(batch) == d.batchSize
+		if full || (!due.IsZero() && !time.Now().Before(due)) {
+			if err := dispatch(batch); err != nil {
+				return finish(err)
+			}
+			batch, due = nil, time.Time{}
+		}
+	}
+	// Always make at least one call, so an empty result still reaches the destination
+	if len(batch) > 0 || dispatched == 0 {
+		if err := dispatch(batch); err != nil {
+			return finish(err)
+		}
+	}
+	return finish(nil)
+}
+
+// InFlight returns how many batches are being written and how many may be at once
+func (d *delivery) InFlight() (int, int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.inFlight, d.maxInFlight
+}
+
+// addStats fills in the batch and slot figures of the run's buffer stats
+func (d *delivery) addStats(stats *BufferStats) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats.BatchSize = d.batchSize
+	stats.MaxInFlight = d.maxInFlight
+	stats.Batches = d.batchesSent
+	stats.SlotsWaitMS = d.slotWait.Milliseconds()
+	stats.SendMS = d.sendTime.Milliseconds()
+	if d.batchesSent > 0 {
+		stats.AvgBatchRecords = roundShare(float64(d.recordsSent) / float64(d.batchesSent))
+	}
+	if d.batchSize > 0 {
+		stats.BatchFill = roundShare(stats.AvgBatchRecords / float64(d.batchSize))
+	}
+	if d.sendTime > 0 {
+		stats.DestinationBusy = roundShare(min(1, d.busy.Seconds()/(d.sendTime.Seconds()*float64(d.maxInFlight))))
+	}
+}
+
+// Close releases the quarantine output for rejected rows
+func (d *delivery) Close() error {
+	return d.rejected.Close()
+}
+
+// sendBatch makes one SendData call, retrying with exponential backoff, and
+// returns how many records were written. Every attempt, retries included,
+// takes its tokens from the limiters since each one reaches the destination.
+func (d *delivery) sendBatch(ctx context.Context, dest interfaces.DataDestination, req interfaces.Request, batch *Dataset, summary *Summary) (int, error) {
+	backoff := d.backoff
+	for attempt := 0; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return 0, context.Cause(ctx)
+		}
+		if err := d.wait(ctx, len(batch.Records)); err != nil {
+			return 0, err
+		}
+		err := untilDone(ctx, func() error { return dest.SendData(batch.Data(), req) })
+		if ctx.Err() != nil {
+			return 0, context.Cause(ctx)
+		}
+		if err == nil {
+			d.mu.Lock()
+			summary.BatchesWritten++
+			d.mu.Unlock()
+			d.reconcile.observeWritten(batch.Records, nil)
+			d.profile.observe(batch.Records)
+			return len(batch.Records), nil
+		}
+		var rejected *RejectedRowsError
+		if errors.As(err, &rejected) {
+			d.reconcile.observeWritten(batch.Records, rejected.Rows)
+			d.profile.observe(batch.Records)
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			summary.BatchesWritten++
+			return len(batch.Records) - len(rejected.Rows), d.quarantineRows(rejected, summary)
+		}
+		if attempt >= d.retries {
+			return 0, err
+		}
+		logger.Infof("Destination rejected batch of %d records, retrying in %s (retry %d of %d): %v",
+			len(batch.Records), backoff, attempt+1, d.retries, err)
+		d.mu.Lock()
+		summary.Retries++
+		d.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// quarantineRows records the rows a destination refused, whatever the error
+// handling strategy. The caller holds mu.
+func (d *delivery) quarantineRows(rejected *RejectedRowsError, summary *Summary) error {
+	for _, row := range rejected.Rows {
+		logger.Infof("Destination rejected record: %s", row.Reason)
+		summary.StageErrors[DestinationStageName]++
+		if err := d.rejected.Add(DestinationStageName, row.Record, errors.New(row.Reason)); err != nil {
+			return err
+		}
+		summary.RecordsQuarantined++
+	}
+	return d.budget.Reject(len(rejected.Rows))
+}
+
+func (d *delivery) wait(ctx context.Context, records int) error {
+	if d.batches != nil {
+		if err := d.batches.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if d.records != nil && records > 0 {
+		if err := d.records.WaitN(ctx, records); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+)
+
+// Policies for a source that returns no records
+const (
+	EmptyInputOK    = "ok"
+	EmptyInputWarn  = "warn"
+	EmptyInputError = "error"
+)
+
+// ErrEmptyInput fails a run whose source returned no records under the error policy
+var ErrEmptyInput = errors.New("the source returned no records")
+
+// CodeEmptyInput is the Report.ErrorCode of a run failed by ErrEmptyInput
+const CodeEmptyInput = "empty_input"
+
+// emptyInputPolicy reads the policy, ok when it is not set
+func emptyInputPolicy(value string) (string, error) {
+	policy := strings.ToLower(strings.TrimSpace(value))
+	switch policy {
+	case "":
+		return EmptyInputOK, nil
+	case EmptyInputOK, EmptyInputWarn, EmptyInputError:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid onemptyinput %q: expected %s, %s or %s", value, EmptyInputOK, EmptyInputWarn, EmptyInputError)
+}
+
+// checkEmptyInput marks the run as having read nothing and applies the policy
+func checkEmptyInput(policy string, summary *Summary) error {
+	summary.EmptyInput = true
+	switch policy {
+	case EmptyInputWarn:
+		logger.Infof("The source returned no records, check the job feeding it ran")
+	case EmptyInputError:
+		return interfaces.Wrap(interfaces.ErrValidation, ErrEmptyInput)
+	}
+	return nil
+}
+
+// empty reports whether the source returned nothing: no records and no
+// rows it could not read, or for data that is not records, no bytes
+func (d *Dataset) empty() bool {
+	if d.Structured() {
+		return len(d.Records) == 0 && len(d.rejected) == 0
+	}
+	switch v := d.raw.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(v) == ""
+	case []byte:
+		return len(bytes.TrimSpace(v)) == 0
+	}
+	return false
+}
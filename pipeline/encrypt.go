@@ -0,0 +1,128 @@
+package pipeline
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+// Prefixes of the key references encrypt and decrypt rules take
+const (
+	keyRefEnv  = "env:"
+	keyRefFile = "file:"
+)
+
+func init() {
+	registerTransform(TransformRule{
+		Keyword:     "encrypt",
+		Syntax:      `encrypt <field>, <field>... with env:<VAR>|file:<path>`,
+		Description: "Encrypts the fields with AES-GCM, storing the nonce and ciphertext as base64",
+		parse: func(args []string, _ interfaces.TransformConfig) (transformFunc, error) {
+			return parseCryptRule(args, true)
+		},
+	})
+	registerTransform(TransformRule{
+		Keyword:     "decrypt",
+		Syntax:      `decrypt <field>, <field>... with env:<VAR>|file:<path>`,
+		Description: "Decrypts fields an encrypt rule encrypted with the same key",
+		parse: func(args []string, _ interfaces.TransformConfig) (transformFunc, error) {
+			return parseCryptRule(args, false)
+		},
+	})
+}
+
+// parseCryptRule reads an encrypt or a decrypt rule and loads its key
+func parseCryptRule(args []string, encrypt bool) (transformFunc, error) {
+	if len(args) < 3 || !strings.EqualFold(args[len(args)-2], "with") {
+		return nil, fmt.Errorf("missing the fields and the key")
+	}
+	var fields []string
+	for _, field := range strings.Split(strings.Join(args[:len(args)-2], " "), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			return nil, fmt.Errorf("empty field in the list")
+		}
+		fields = append(fields, field)
+	}
+	aead, err := loadFieldKey(args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	return func(rec Record) error {
+		// Null stays null, there is nothing to hide
+		for _, field := range fields {
+			value, ok := rec[field]
+			if !ok || value == nil {
+				continue
+			}
+			text, ok := value.(string)
+			if !ok {
+				text = fmt.Sprint(value)
+			}
+			if encrypt {
+				nonce := make([]byte, aead.NonceSize())
+				if _, err := rand.Read(nonce); err != nil {
+					return fmt.Errorf("failed to encrypt %s: %w", field, err)
+				}
+				rec[field] = base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(text), nil))
+				continue
+			}
+			sealed, err := base64.StdEncoding.DecodeString(text)
+			if err != nil || len(sealed) < aead.NonceSize() {
+				return fmt.Errorf("failed to decrypt %s: not an encrypted value", field)
+			}
+			plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt %s: the key is wrong or the value was altered", field)
+			}
+			rec[field] = string(plain)
+		}
+		return nil
+	}, nil
+}
+
+// loadFieldKey reads the key a reference points at, an environment variable
+// or a file holding a 16, 24 or 32 byte key as base64 or hex, and returns
+// AES-GCM with it. Errors name the reference, never the key.
+func loadFieldKey(ref string) (cipher.AEAD, error) {
+	var encoded string
+	switch {
+	case strings.HasPrefix(ref, keyRefEnv):
+		name := strings.TrimPrefix(ref, keyRefEnv)
+		value, ok := os.LookupEnv(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("key environment variable %q is not set", name)
+		}
+		encoded = value
+	case strings.HasPrefix(ref, keyRefFile):
+		data, err := os.ReadFile(strings.TrimPrefix(ref, keyRefFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the key file: %w", err)
+		}
+		encoded = string(data)
+	default:
+		return nil, fmt.Errorf("invalid key reference %q, expected env:<VAR> or file:<path>", ref)
+	}
+
+	encoded = strings.TrimSpace(encoded)
+	key, err := hex.DecodeString(encoded)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(encoded)
+	}
+	if err != nil || (len(key) != 16 && len(key) != 24 && len(key) != 32) {
+		return nil, fmt.Errorf("the key in %s must be 16, 24 or 32 bytes, base64 or hex encoded", ref)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,128 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+// DefaultErrorRateWindow is how many of the latest records MaxErrorRate is measured over
+const DefaultErrorRateWindow = 1000
+
+// ErrTooManyErrors is returned when a run is aborted for passing ErrorHandling.MaxErrors or MaxErrorRate
+var ErrTooManyErrors = errors.New("too many record errors")
+
+// errorBudget aborts a run once too many records have been rejected, so
+// continuing past bad rows cannot hide an input that is broken throughout.
+// The source, the stages and the destination report to it from the
+// processing and delivery goroutines.
+type errorBudget struct {
+	maxErrors int
+	maxRate   float64
+
+	mu     sync.Mutex
+	errors int
+	// window holds whether each of the latest records failed, as a ring
+	window       []bool
+	next         int
+	filled       int
+	windowErrors int
+}
+
+// newErrorBudget returns nil when neither threshold is set
+func newErrorBudget(cfg interfaces.ErrorHandling) (*errorBudget, error) {
+	if cfg.MaxErrors < 0 || cfg.ErrorRateWindow < 0 {
+		return nil, errors.New("maxerrors and errorratewindow must not be negative")
+	}
+	if cfg.MaxErrorRate < 0 || cfg.MaxErrorRate > 100 {
+		return nil, fmt.Errorf("maxerrorrate must be a percentage between 0 and 100, got %g", cfg.MaxErrorRate)
+	}
+	if cfg.MaxErrors == 0 && cfg.MaxErrorRate == 0 {
+		return nil, nil
+	}
+	b := &errorBudget{maxErrors: cfg.MaxErrors, maxRate: cfg.MaxErrorRate}
+	if cfg.MaxErrorRate > 0 {
+		size := cfg.ErrorRateWindow
+		if size == 0 {
+			size = DefaultErrorRateWindow
+		}
+		b.window = make([]bool, size)
+	}
+	return b, nil
+}
+
+// Observe records how many of a source record's outcomes were rejected. The
+// rate is checked once the window is full.
+func (b *errorBudget) Observe(failed int) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.errors += failed
+	if b.window != nil {
+		if b.filled == len(b.window) && b.window[b.next] {
+			b.windowErrors--
+		}
+		b.window[b.next] = failed > 0
+		if failed > 0 {
+			b.windowErrors++
+		}
+		b.next = (b.next + 1) % len(b.window)
+		if b.filled < len(b.window) {
+			b.filled++
+		}
+	}
+	if err := b.checkCount(); err != nil {
+		return err
+	}
+	if b.filled == len(b.window) {
+		return b.checkRate()
+	}
+	return nil
+}
+
+// Reject counts errors that are not tied to a source record of their own,
+// such as rows a destination refused
+func (b *errorBudget) Reject(n int) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.errors += n
+	return b.checkCount()
+}
+
+// Finish checks the rate over a window the run never filled
+func (b *errorBudget) Finish() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.filled > 0 && b.filled < len(b.window) {
+		return b.checkRate()
+	}
+	return nil
+}
+
+func (b *errorBudget) checkCount() error {
+	if b.maxErrors > 0 && b.errors > b.maxErrors {
+		return interfaces.Wrap(interfaces.ErrValidation, fmt.Errorf("%w: %d record errors, more than maxerrors %d", ErrTooManyErrors, b.errors, b.maxErrors))
+	}
+	return nil
+}
+
+func (b *errorBudget) checkRate() error {
+	if b.maxRate == 0 {
+		return nil
+	}
+	rate := float64(b.windowErrors) * 100 / float64(b.filled)
+	if rate > b.maxRate {
+		return interfaces.Wrap(interfaces.ErrValidation, fmt.Errorf("%w: %.1f%% of the last %d records failed, more than maxerrorrate %g%%", ErrTooManyErrors, rate, b.filled, b.maxRate))
+	}
+	return nil
+}
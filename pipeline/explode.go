@@ -0,0 +1,79 @@
+package pipeline
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+func init() {
+	registerTransform(TransformRule{
+		Keyword:     "explode",
+		Syntax:      `explode <field> [drop]`,
+		Description: "Emits one record per element of an array field, merging object elements into the record",
+		expand:      parseExplodeRule,
+	})
+}
+
+// parseExplodeRule reads an explode rule. Records whose field is missing,
+// null or an empty array pass through as they are, or with drop are dropped.
+func parseExplodeRule(args []string, _ interfaces.TransformConfig) (expandFunc, error) {
+	drop := false
+	if len(args) == 2 && strings.EqualFold(args[1], "drop") {
+		drop, args = true, args[:1]
+	}
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected one field to explode")
+	}
+	field := args[0]
+
+	return func(rec Record) ([]Record, error) {
+		elements, err := arrayElements(rec[field])
+		if err != nil {
+			return nil, fmt.Errorf("cannot explode field %s: %w", field, err)
+		}
+		if len(elements) == 0 {
+			if drop {
+				return nil, nil
+			}
+			return []Record{rec}, nil
+		}
+		records := make([]Record, 0, len(elements))
+		for _, element := range elements {
+			out := rec.Copy()
+			// An object's fields take the place of the array, overriding fields of the same name
+			if object, ok := element.(map[string]interface{}); ok {
+				delete(out, field)
+				for key, value := range object {
+					out[key] = value
+				}
+			} else {
+				out[field] = element
+			}
+			records = append(records, out)
+		}
+		return records, nil
+	}, nil
+}
+
+// arrayElements returns the elements of an array value, none for null
+func arrayElements(value interface{}) ([]interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		return v, nil
+	}
+	// Sources other than JSON may hand over typed slices, such as []string
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("value of type %T is not an array", value)
+	}
+	elements := make([]interface{}, rv.Len())
+	for i := range elements {
+		elements[i] = rv.Index(i).Interface()
+	}
+	return elements, nil
+}
@@ -0,0 +1,115 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+// What an extract rule does with a value its pattern doesn't match
+const (
+	UnmatchedNull  = "null"
+	UnmatchedError = "error"
+)
+
+func init() {
+	registerTransform(TransformRule{
+		Keyword:     "extract",
+		Syntax:      `extract <field> using "<regex>" into <field>, <field>... [unmatched null|error] [drop]`,
+		Description: "Stores the capture groups of a regular expression's match in the field in new fields",
+		parse:       parseExtractRule,
+	})
+}
+
+// parseExtractRule reads an extract rule. When every target names a group of
+// the pattern, each takes the group of its name; otherwise the targets take
+// the groups in order, and there must be one per group. The options at the
+// end, unmatched and drop, may come in any order.
+func parseExtractRule(args []string, _ interfaces.TransformConfig) (transformFunc, error) {
+	if len(args) < 5 || !strings.EqualFold(args[1], "using") || !strings.EqualFold(args[3], "into") {
+		return nil, fmt.Errorf("missing the pattern or the fields to extract into")
+	}
+	field, rest := args[0], args[4:]
+	pattern, err := regexp.Compile(args[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	unmatched, drop := UnmatchedNull, false
+	for options := 0; options < 2 && len(rest) > 1; options++ {
+		last := len(rest) - 1
+		switch {
+		case len(rest) > 2 && strings.EqualFold(rest[last-1], "unmatched") && !strings.HasSuffix(rest[last-2], ","):
+			switch policy := strings.ToLower(rest[last]); policy {
+			case UnmatchedNull, UnmatchedError:
+				unmatched, rest = policy, rest[:last-1]
+			default:
+				return nil, fmt.Errorf("unknown option unmatched %s", rest[last])
+			}
+		case strings.EqualFold(rest[last], "drop") && !strings.HasSuffix(rest[last-1], ",") && !drop:
+			drop, rest = true, rest[:last]
+		}
+	}
+	var targets []string
+	for _, target := range strings.Split(strings.Join(rest, " "), ",") {
+		target = strings.TrimSpace(target)
+		if target == "" {
+			return nil, fmt.Errorf("empty field in the list to extract into")
+		}
+		if strings.ContainsAny(target, " \t") {
+			return nil, fmt.Errorf("unknown option %s", target)
+		}
+		targets = append(targets, target)
+	}
+	groups, err := extractGroups(pattern, targets)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(rec Record) error {
+		value, ok := rec[field]
+		var text string
+		var match []int
+		if ok && value != nil {
+			text = fmt.Sprint(value)
+			if match = pattern.FindStringSubmatchIndex(text); match == nil && unmatched == UnmatchedError {
+				return fmt.Errorf("value %q of %s does not match %s", text, field, pattern)
+			}
+		}
+		// Null has nothing to match, so its targets are null whatever the policy
+		if drop {
+			delete(rec, field)
+		}
+		for i, target := range targets {
+			rec[target] = nil
+			// A group that took no part in the match is null too
+			if start, end := 2*groups[i], 2*groups[i]+1; match != nil && match[start] >= 0 {
+				rec[target] = text[match[start]:match[end]]
+			}
+		}
+		return nil
+	}, nil
+}
+
+// extractGroups returns the number of the capture group each target takes
+func extractGroups(pattern *regexp.Regexp, targets []string) ([]int, error) {
+	groups := make([]int, len(targets))
+	named := true
+	for i, target := range targets {
+		if groups[i] = pattern.SubexpIndex(target); groups[i] < 0 {
+			named = false
+			break
+		}
+	}
+	if named {
+		return groups, nil
+	}
+	if len(targets) != pattern.NumSubexp() {
+		return nil, fmt.Errorf("%d fields to extract into, but the pattern has %d groups", len(targets), pattern.NumSubexp())
+	}
+	for i := range targets {
+		groups[i] = i + 1
+	}
+	return groups, nil
+}
@@ -0,0 +1,123 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+)
+
+// Policies for the fields records carry beyond those the destination takes
+const (
+	ExtraFieldsPass  = "pass"
+	ExtraFieldsDrop  = "drop"
+	ExtraFieldsWarn  = "warn"
+	ExtraFieldsError = "error"
+)
+
+// ExtraFieldsStageName names the stage applying the extra fields policy, in
+// logs, stage errors and quarantine entries
+const ExtraFieldsStageName = "extrafields"
+
+// ExtraFieldsStage applies the extra fields policy to each record just before
+// it is written. It is not listed in stages: the pipeline runs it after all of
+// them whenever the policy is other than pass.
+type ExtraFieldsStage struct {
+	policy  string
+	fields  map[string]bool
+	dropped map[string]int // Records each extra field was dropped from
+}
+
+// newExtraFieldsStage reads the policy and the destination's fields, asking
+// the destination for them when the config doesn't list them. It returns nil
+// for the pass policy, which writes records as they are.
+func newExtraFieldsStage(cfg interfaces.OutputFieldsConfig, destination interfaces.DataDestination, req interfaces.Request) (*ExtraFieldsStage, error) {
+	policy := strings.ToLower(strings.TrimSpace(cfg.OnExtraFields))
+	switch policy {
+	case "", ExtraFieldsPass:
+		return nil, nil
+	case ExtraFieldsDrop, ExtraFieldsWarn, ExtraFieldsError:
+	default:
+		return nil, fmt.Errorf("invalid onextrafields %q: expected %s, %s, %s or %s", cfg.OnExtraFields, ExtraFieldsPass, ExtraFieldsDrop, ExtraFieldsWarn, ExtraFieldsError)
+	}
+	fields := cfg.Fields
+	if len(fields) == 0 {
+		if lister, ok := destination.(interfaces.FieldLister); ok {
+			listed, err := lister.DestinationFields(req)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read the destination's fields: %w", err)
+			}
+			fields = listed
+		}
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("onextrafields %s needs the destination's fields: list them in outputfields.fields", policy)
+	}
+	s := &ExtraFieldsStage{policy: policy, fields: make(map[string]bool, len(fields)), dropped: map[string]int{}}
+	for _, field := range fields {
+		s.fields[field] = true
+	}
+	return s, nil
+}
+
+// Name returns the stage name
+func (s *ExtraFieldsStage) Name() string {
+	return ExtraFieldsStageName
+}
+
+// Process drops or rejects the fields the destination doesn't take. Warning
+// logs each field name the first time it is dropped, so a field every record
+// carries is reported once.
+func (s *ExtraFieldsStage) Process(rec Record) ([]Record, error) {
+	var extra []string
+	for field := range rec {
+		if field != TableField && !s.fields[field] {
+			extra = append(extra, field)
+		}
+	}
+	if len(extra) == 0 {
+		return []Record{rec}, nil
+	}
+	sort.Strings(extra)
+	if s.policy == ExtraFieldsError {
+		return nil, interfaces.Wrap(interfaces.ErrValidation, fmt.Errorf("fields %s are not among the destination's fields", strings.Join(extra, ", ")))
+	}
+	for _, field := range extra {
+		if s.policy == ExtraFieldsWarn && s.dropped[field] == 0 {
+			logger.Infof("Field %s is not among the destination's fields, dropping it from this and later records", field)
+		}
+		s.dropped[field]++
+		delete(rec, field)
+	}
+	return []Record{rec}, nil
+}
+
+// Flush has nothing to emit; it logs how often each field was dropped
+func (s *ExtraFieldsStage) Flush() ([]Record, error) {
+	if len(s.dropped) == 0 {
+		return nil, nil
+	}
+	counts := make([]string, 0, len(s.dropped))
+	for field, n := range s.dropped {
+		counts = append(counts, fmt.Sprintf("%s from %d", field, n))
+	}
+	sort.Strings(counts)
+	logger.Infof("Dropped fields the destination doesn't take: %s", strings.Join(counts, ", "))
+	return nil, nil
+}
+
+// Columns leaves out the columns the destination doesn't take
+func (s *ExtraFieldsStage) Columns(previous []string) []string {
+	if s.policy == ExtraFieldsError {
+		return previous
+	}
+	var columns []string
+	for _, column := range previous {
+		if s.fields[column] {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
@@ -0,0 +1,71 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/language"
+)
+
+// Filter modes
+const (
+	FilterKeep = "keep"
+	FilterDrop = "drop"
+)
+
+// FilterStage skips records based on predicates written in the validation
+// rule grammar. Unlike a validation failure, a filtered record is not an error.
+type FilterStage struct {
+	keep  bool
+	rules []*language.Node
+}
+
+// NewFilterStage parses the filter rules
+func NewFilterStage(cfg interfaces.FilterConfig) (*FilterStage, error) {
+	mode := strings.ToLower(cfg.Mode)
+	if mode == "" {
+		mode = FilterKeep
+	}
+	if mode != FilterKeep && mode != FilterDrop {
+		return nil, fmt.Errorf("invalid filter mode %q: expected %s or %s", cfg.Mode, FilterKeep, FilterDrop)
+	}
+
+	f := &FilterStage{keep: mode == FilterKeep}
+	for _, rule := range cfg.Rules {
+		node, err := language.ParseRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter rule: %w", err)
+		}
+		f.rules = append(f.rules, node)
+	}
+	return f, nil
+}
+
+// Name returns the stage name
+func (f *FilterStage) Name() string {
+	return "filter"
+}
+
+// Process passes the record on when it matches (keep mode) or doesn't match (drop mode) every rule
+func (f *FilterStage) Process(rec Record) ([]Record, error) {
+	if f.matches(rec) == f.keep {
+		return []Record{rec}, nil
+	}
+	return nil, ErrFiltered
+}
+
+// Flush has nothing to emit, filtering doesn't buffer
+func (f *FilterStage) Flush() ([]Record, error) {
+	return nil, nil
+}
+
+func (f *FilterStage) matches(rec Record) bool {
+	fields := rec.Strings()
+	for _, rule := range f.rules {
+		if language.Evaluate(rule, fields) != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"hash/maphash"
+	"math"
+	"math/bits"
+)
+
+// hyperLogLogPrecision sets the registers a sketch holds, 2^12 of a byte
+// each, for a standard error of about 1.6%
+const hyperLogLogPrecision = 12
+
+// hyperLogLog estimates how many distinct values it was given in a fixed
+// amount of memory, however many there are
+type hyperLogLog struct {
+	seed      maphash.Seed
+	registers []uint8
+}
+
+func newHyperLogLog(seed maphash.Seed) *hyperLogLog {
+	return &hyperLogLog{seed: seed, registers: make([]uint8, 1<<hyperLogLogPrecision)}
+}
+
+// Add counts value. The first bits of its hash pick a register, which keeps
+// the longest run of leading zeros seen in the rest.
+func (h *hyperLogLog) Add(value string) {
+	hash := maphash.String(h.seed, value)
+	index := hash >> (64 - hyperLogLogPrecision)
+	rank := uint8(bits.LeadingZeros64(hash<<hyperLogLogPrecision|1<<(hyperLogLogPrecision-1))) + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+// Count returns the estimate, counting the empty registers instead while
+// few of the registers are set, as the raw estimate is biased there
+func (h *hyperLogLog) Count() int {
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, register := range h.registers {
+		sum += math.Ldexp(1, -int(register))
+		if register == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int(math.Round(estimate))
+}
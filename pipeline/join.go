@@ -0,0 +1,182 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/SkySingh04/fractal/factory"
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+)
+
+// Policies for records without a matching lookup record
+const (
+	UnmatchedPass       = "pass"
+	UnmatchedDrop       = "drop"
+	UnmatchedQuarantine = "quarantine"
+)
+
+// DefaultMaxLookupRecords caps the lookup size when JoinConfig.MaxRecords is not set
+const DefaultMaxLookupRecords = 100000
+
+// JoinStage merges fields from a lookup source into each record sharing its
+// key. The lookup is read once, when the stage is built, and kept in memory.
+type JoinStage struct {
+	key         string
+	fields      []string
+	unmatched   string
+	lookup      map[string]Record
+	unavailable bool // An optional lookup could not be fetched
+}
+
+// lookupUnavailableError is returned when a lookup source fails to return
+// its data, which an optional lookup survives
+type lookupUnavailableError struct {
+	input string
+	err   error
+}
+
+func (e *lookupUnavailableError) Error() string {
+	return fmt.Sprintf("failed to fetch lookup data from %s: %v", e.input, e.err)
+}
+
+func (e *lookupUnavailableError) Unwrap() error {
+	return e.err
+}
+
+// lookupUnavailable reports whether an optional lookup failed to load, and
+// should be done without, logging the failure
+func lookupUnavailable(err error, optional bool, name string) bool {
+	var unavailable *lookupUnavailableError
+	if !optional || !errors.As(err, &unavailable) {
+		return false
+	}
+	logger.Infof("Optional lookup %s is unavailable, continuing without it: %v", name, err)
+	return true
+}
+
+// NewJoinStage fetches the lookup source and indexes it by the lookup key
+func NewJoinStage(cfg interfaces.JoinConfig) (*JoinStage, error) {
+	if cfg.Key == "" {
+		return nil, fmt.Errorf("join with %s needs a key", cfg.Input)
+	}
+	unmatched := strings.ToLower(cfg.Unmatched)
+	if unmatched == "" {
+		unmatched = UnmatchedPass
+	}
+	if unmatched != UnmatchedPass && unmatched != UnmatchedDrop && unmatched != UnmatchedQuarantine {
+		return nil, fmt.Errorf("invalid unmatched policy %q: expected %s, %s or %s", cfg.Unmatched, UnmatchedPass, UnmatchedDrop, UnmatchedQuarantine)
+	}
+	lookupKey := cfg.LookupKey
+	if lookupKey == "" {
+		lookupKey = cfg.Key
+	}
+	maxRecords := cfg.MaxRecords
+	if maxRecords <= 0 {
+		maxRecords = DefaultMaxLookupRecords
+	}
+
+	records, err := fetchLookup(cfg.Input, cfg.Request, maxRecords)
+	if lookupUnavailable(err, cfg.Optional, "from "+cfg.Input) {
+		return &JoinStage{key: cfg.Key, fields: cfg.Fields, unmatched: unmatched, unavailable: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	j := &JoinStage{key: cfg.Key, fields: cfg.Fields, unmatched: unmatched, lookup: make(map[string]Record, len(records))}
+	for _, rec := range records {
+		value, ok := joinValue(rec, lookupKey)
+		if !ok {
+			continue
+		}
+		if _, exists := j.lookup[value]; exists {
+			logger.Infof("Lookup from %s has more than one record for %s=%s, keeping the first", cfg.Input, lookupKey, value)
+			continue
+		}
+		delete(rec, lookupKey)
+		j.lookup[value] = rec
+	}
+	logger.Infof("Loaded %d lookup records from %s", len(j.lookup), cfg.Input)
+	return j, nil
+}
+
+// Name returns the stage name
+func (j *JoinStage) Name() string {
+	return "join"
+}
+
+// Process merges the matching lookup fields into the record, overwriting
+// fields of the same name. Without the lookup, the fields are set to null
+// whatever the unmatched policy, as no record could have matched.
+func (j *JoinStage) Process(rec Record) ([]Record, error) {
+	if j.unavailable {
+		for _, field := range j.fields {
+			rec[field] = nil
+		}
+		return []Record{rec}, nil
+	}
+	value, _ := joinValue(rec, j.key)
+	match, ok := j.lookup[value]
+	if !ok {
+		switch j.unmatched {
+		case UnmatchedDrop:
+			return nil, ErrFiltered
+		case UnmatchedQuarantine:
+			return nil, fmt.Errorf("%w: no lookup record for %s=%q", ErrQuarantine, j.key, value)
+		}
+		return []Record{rec}, nil
+	}
+
+	if len(j.fields) == 0 {
+		for field, v := range match {
+			rec[field] = v
+		}
+	} else {
+		for _, field := range j.fields {
+			rec[field] = match[field]
+		}
+	}
+	return []Record{rec}, nil
+}
+
+// Flush has nothing to emit, joining doesn't buffer
+func (j *JoinStage) Flush() ([]Record, error) {
+	return nil, nil
+}
+
+// fetchLookup reads the records of a lookup source, as joins and in_source
+// validations use them, refusing more than maxRecords
+func fetchLookup(input string, request *interfaces.Request, maxRecords int) ([]Record, error) {
+	source, err := factory.CreateSource(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lookup source: %w", err)
+	}
+	var req interfaces.Request
+	if request != nil {
+		req = *request
+	}
+	data, err := source.FetchData(req)
+	if err != nil {
+		return nil, &lookupUnavailableError{input: input, err: err}
+	}
+	dataset := NewDataset(data)
+	if !dataset.Structured() {
+		return nil, fmt.Errorf("lookup data from %s of type %T is not record-oriented", input, data)
+	}
+	if len(dataset.Records) > maxRecords {
+		return nil, fmt.Errorf("lookup from %s has %d records, more than the limit of %d", input, len(dataset.Records), maxRecords)
+	}
+	return dataset.Records, nil
+}
+
+// joinValue renders a key so that, say, 42 from SQL matches "42" from a CSV file
+func joinValue(rec Record, field string) (string, bool) {
+	value, ok := rec[field]
+	if !ok || value == nil {
+		return "", false
+	}
+	s := fmt.Sprint(value)
+	return s, s != ""
+}
@@ -0,0 +1,173 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+)
+
+// DefaultManifestPath is the marker file written when ManifestConfig.Path is not set
+const DefaultManifestPath = "_SUCCESS"
+
+// Manifest formats
+const (
+	ManifestJSON  = "json"
+	ManifestEmpty = "empty"
+)
+
+// Manifest lists the files a run wrote, as written to its marker file
+type Manifest struct {
+	RunID     string         `json:"run_id"`
+	CreatedAt time.Time      `json:"created_at"`
+	Files     []ManifestFile `json:"files"`
+	Records   int            `json:"records"` // Records in all the files
+	Bytes     int64          `json:"bytes"`   // Size of all the files
+}
+
+// ManifestFile is a file the run wrote. Its path is relative to the marker's
+// directory when the file is inside it.
+type ManifestFile struct {
+	Path    string `json:"path"`
+	Records int    `json:"records"`
+	Bytes   int64  `json:"bytes"`
+	SHA256  string `json:"sha256"`
+}
+
+// manifest collects the files the destination reports writing, and writes
+// the marker once the run has finished writing them
+type manifest struct {
+	path   string
+	format string
+
+	// mu guards the records counted per file, as batches are written at once
+	mu    sync.Mutex
+	files map[string]int
+}
+
+// newManifest parses the manifest settings, and returns nil when the
+// manifest is off. Only destinations writing local files can have one.
+func newManifest(cfg interfaces.ManifestConfig, dest interfaces.DataDestination, req interfaces.Request) (*manifest, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	format := strings.ToLower(strings.TrimSpace(cfg.Format))
+	if format == "" {
+		format = ManifestJSON
+	}
+	if format != ManifestJSON && format != ManifestEmpty {
+		return nil, fmt.Errorf("invalid manifest format %q: expected %s or %s", cfg.Format, ManifestJSON, ManifestEmpty)
+	}
+	writer, ok := dest.(interfaces.FileWriter)
+	if !ok {
+		return nil, fmt.Errorf("a manifest needs a destination that writes local files, such as CSV, not %T", dest)
+	}
+	dir := writer.OutputDir(req)
+	if dir == "" {
+		return nil, fmt.Errorf("a manifest needs a destination that writes files, not standard output")
+	}
+	path := cfg.Path
+	if path == "" {
+		path = DefaultManifestPath
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	return &manifest{path: path, format: format, files: map[string]int{}}, nil
+}
+
+// clear removes the marker an earlier run left, before this run replaces
+// the output it describes
+func (m *manifest) clear() error {
+	if err := os.Remove(m.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove the earlier manifest %s: %w", m.path, err)
+	}
+	return nil
+}
+
+// written records that records were written to the file at path
+func (m *manifest) written(path string, records int, appended bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !appended {
+		m.files[path] = 0
+	}
+	m.files[path] += records
+}
+
+// write lists the files in the marker, written into place at once so a job
+// waiting for it never reads part of it
+func (m *manifest) write(runID string) error {
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return fmt.Errorf("failed to create the manifest directory: %w", err)
+	}
+	var data []byte
+	if m.format == ManifestJSON {
+		listing, err := m.list(runID)
+		if err != nil {
+			return err
+		}
+		data, err = json.MarshalIndent(listing, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode the manifest: %w", err)
+		}
+	}
+	if err := writeFileAtomic(m.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write the manifest %s: %w", m.path, err)
+	}
+	logger.Infof("Wrote manifest %s listing %d file(s)", m.path, len(m.files))
+	return nil
+}
+
+// list sizes and checksums the files written, in path order
+func (m *manifest) list(runID string) (*Manifest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	listing := &Manifest{RunID: runID, CreatedAt: time.Now().UTC(), Files: []ManifestFile{}}
+	paths := make([]string, 0, len(m.files))
+	for path := range m.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	dir := filepath.Dir(m.path)
+	for _, path := range paths {
+		size, sum, err := checksumFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to checksum %s for the manifest: %w", path, err)
+		}
+		name := path
+		if rel, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			name = filepath.ToSlash(rel)
+		}
+		listing.Files = append(listing.Files, ManifestFile{Path: name, Records: m.files[path], Bytes: size, SHA256: sum})
+		listing.Records += m.files[path]
+		listing.Bytes += size
+	}
+	return listing, nil
+}
+
+// checksumFile returns the size and hex SHA-256 of the file at path
+func checksumFile(path string) (int64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
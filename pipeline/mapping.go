@@ -0,0 +1,181 @@
+package pipeline
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+// What a map rule does with a value its table doesn't have
+const (
+	UnmappedPass    = "pass"
+	UnmappedError   = "error"
+	UnmappedDefault = "default"
+)
+
+func init() {
+	registerTransform(TransformRule{
+		Keyword:     "map",
+		Syntax:      `map <field> using <table> [unmapped pass|error|default "<value>"]`,
+		Description: "Replaces the field's value with the one a mapping table gives for it",
+		parse:       parseMapRule,
+	})
+}
+
+// parseMapRule reads a map rule. Values the table doesn't have are left as
+// they are unless the rule says otherwise.
+func parseMapRule(args []string, cfg interfaces.TransformConfig) (transformFunc, error) {
+	if len(args) < 3 || !strings.EqualFold(args[1], "using") {
+		return nil, fmt.Errorf("missing the table to map with")
+	}
+	field, name := args[0], args[2]
+	unmapped := UnmappedPass
+	var fallback interface{}
+	switch options := args[3:]; {
+	case len(options) == 0:
+	case len(options) == 2 && strings.EqualFold(options[0], "unmapped") &&
+		(strings.EqualFold(options[1], UnmappedPass) || strings.EqualFold(options[1], UnmappedError)):
+		unmapped = strings.ToLower(options[1])
+	case len(options) == 3 && strings.EqualFold(options[0], "unmapped") && strings.EqualFold(options[1], UnmappedDefault):
+		unmapped, fallback = UnmappedDefault, options[2]
+	default:
+		return nil, fmt.Errorf("unknown option %s", strings.Join(options, " "))
+	}
+	table, err := mappingTable(name, cfg.Mappings)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(rec Record) error {
+		// Null has nothing to translate, so it stays null
+		value, ok := rec[field]
+		if !ok || value == nil {
+			return nil
+		}
+		// Values are compared as text, so 1 from JSON maps like "1" from CSV
+		if mapped, ok := table[fmt.Sprint(value)]; ok {
+			rec[field] = mapped
+			return nil
+		}
+		switch unmapped {
+		case UnmappedError:
+			return fmt.Errorf("value %v of %s is not in mapping %s", value, field, name)
+		case UnmappedDefault:
+			rec[field] = fallback
+		}
+		return nil
+	}, nil
+}
+
+// mappingTable returns the replacement by value of the named mapping. Config
+// keys are read in lower case, so its name is matched without regard to case.
+func mappingTable(name string, mappings map[string]interfaces.MappingConfig) (map[string]interface{}, error) {
+	cfg, ok := mappings[name]
+	if !ok {
+		for key, mapping := range mappings {
+			if strings.EqualFold(key, name) {
+				cfg, ok = mapping, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown mapping %s", name)
+	}
+	switch {
+	case cfg.File != "" && len(cfg.Values) > 0:
+		return nil, fmt.Errorf("mapping %s sets both values and a file", name)
+	case cfg.File != "":
+		table, err := readMappingFile(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("mapping %s: %w", name, err)
+		}
+		return table, nil
+	case len(cfg.Values) == 0:
+		return nil, fmt.Errorf("mapping %s has no values", name)
+	}
+	return cfg.Values, nil
+}
+
+// readMappingFile reads a mapping table from a CSV file with a header, or a
+// JSON file holding an object or an array of objects
+func readMappingFile(cfg interfaces.MappingConfig) (map[string]interface{}, error) {
+	file, err := os.Open(cfg.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", cfg.File, err)
+	}
+	defer file.Close()
+
+	table := map[string]interface{}{}
+	if strings.EqualFold(filepath.Ext(cfg.File), ".json") {
+		var data interface{}
+		if err := json.NewDecoder(file).Decode(&data); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", cfg.File, err)
+		}
+		switch v := data.(type) {
+		case map[string]interface{}:
+			return v, nil
+		case []interface{}:
+			keyField, valueField := mappingFields(cfg, "key", "value")
+			for i, item := range v {
+				row, ok := item.(map[string]interface{})
+				if !ok || row[keyField] == nil {
+					return nil, fmt.Errorf("entry %d of %s has no %s", i, cfg.File, keyField)
+				}
+				table[fmt.Sprint(row[keyField])] = row[valueField]
+			}
+			return table, nil
+		}
+		return nil, fmt.Errorf("%s holds neither an object nor an array of objects", cfg.File)
+	}
+
+	reader := csv.NewReader(file)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the header of %s: %w", cfg.File, err)
+	}
+	if len(header) < 2 {
+		return nil, fmt.Errorf("%s needs a column of values and one of replacements", cfg.File)
+	}
+	keyField, valueField := mappingFields(cfg, header[0], header[1])
+	keyColumn, valueColumn := -1, -1
+	for i, column := range header {
+		switch column {
+		case keyField:
+			keyColumn = i
+		case valueField:
+			valueColumn = i
+		}
+	}
+	if keyColumn < 0 || valueColumn < 0 {
+		return nil, fmt.Errorf("%s has no %s and %s columns", cfg.File, keyField, valueField)
+	}
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return table, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", cfg.File, err)
+		}
+		table[row[keyColumn]] = row[valueColumn]
+	}
+}
+
+// mappingFields returns the configured key and value fields, or the defaults
+func mappingFields(cfg interfaces.MappingConfig, keyField, valueField string) (string, string) {
+	if cfg.KeyField != "" {
+		keyField = cfg.KeyField
+	}
+	if cfg.ValueField != "" {
+		valueField = cfg.ValueField
+	}
+	return keyField, valueField
+}
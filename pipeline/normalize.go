@@ -0,0 +1,175 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+// Styles field names can be normalized to
+const (
+	FieldStyleSnake = "snake_case"
+	FieldStyleCamel = "camelcase"
+)
+
+// fieldNormalizer renames the fields of the records as read, so headers such
+// as "First Name", first-name and FIRST_NAME all become first_name
+type fieldNormalizer struct {
+	style       string
+	pattern     *regexp.Regexp
+	replacement string
+	names       map[string]string // Normalized name by field name, as each is worked out once
+}
+
+// newFieldNormalizer builds the normalization from its configuration, nil when
+// it is not configured
+func newFieldNormalizer(cfg interfaces.NormalizeFieldsConfig) (*fieldNormalizer, error) {
+	style := strings.ToLower(strings.TrimSpace(cfg.Style))
+	if style != "" && style != FieldStyleSnake && style != FieldStyleCamel {
+		return nil, fmt.Errorf("invalid normalizefields style %q: expected snake_case or camelCase", cfg.Style)
+	}
+	if cfg.Pattern == "" && cfg.Replacement != "" {
+		return nil, errors.New("normalizefields replacement is set without a pattern")
+	}
+	if style == "" && cfg.Pattern == "" {
+		return nil, nil
+	}
+	n := &fieldNormalizer{style: style, replacement: cfg.Replacement, names: map[string]string{}}
+	if cfg.Pattern != "" {
+		pattern, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid normalizefields pattern %q: %w", cfg.Pattern, err)
+		}
+		n.pattern = pattern
+	}
+	return n, nil
+}
+
+// name returns the normalized name of a field: the pattern is replaced
+// first, then the style applied. The table a record came from keeps its name.
+func (n *fieldNormalizer) name(field string) (string, error) {
+	if normalized, ok := n.names[field]; ok {
+		return normalized, nil
+	}
+	normalized := field
+	if field != TableField {
+		if n.pattern != nil {
+			normalized = n.pattern.ReplaceAllString(normalized, n.replacement)
+		}
+		switch n.style {
+		case FieldStyleSnake:
+			normalized = strings.ToLower(strings.Join(fieldWords(normalized), "_"))
+		case FieldStyleCamel:
+			normalized = camelCase(fieldWords(normalized))
+		}
+		if normalized == "" {
+			return "", interfaces.Wrap(interfaces.ErrValidation, fmt.Errorf("field %q normalizes to an empty name", field))
+		}
+	}
+	n.names[field] = normalized
+	return normalized, nil
+}
+
+// normalize renames the fields of every record and the column order. Two
+// fields that normalize to the same name fail the run, as one would
+// overwrite the other.
+func (n *fieldNormalizer) normalize(dataset *Dataset) error {
+	if n == nil {
+		return nil
+	}
+	if dataset.Columns != nil {
+		columns, err := n.rename(dataset.Columns)
+		if err != nil {
+			return err
+		}
+		dataset.Columns = columns
+	}
+	for i, rec := range dataset.Records {
+		fields := make([]string, 0, len(rec))
+		for field := range rec {
+			fields = append(fields, field)
+		}
+		// Sorted, so a collision is reported the same way every run
+		sort.Strings(fields)
+		names, err := n.rename(fields)
+		if err != nil {
+			return err
+		}
+		normalized := make(Record, len(rec))
+		for j, field := range fields {
+			normalized[names[j]] = rec[field]
+		}
+		dataset.Records[i] = normalized
+	}
+	return nil
+}
+
+// rename normalizes the names of fields, which must not share a normalized name
+func (n *fieldNormalizer) rename(fields []string) ([]string, error) {
+	names := make([]string, len(fields))
+	from := make(map[string]string, len(fields))
+	for i, field := range fields {
+		name, err := n.name(field)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := from[name]; ok {
+			return nil, interfaces.Wrap(interfaces.ErrValidation, fmt.Errorf("fields %q and %q both normalize to %q", other, field, name))
+		}
+		from[name] = field
+		names[i] = name
+	}
+	return names, nil
+}
+
+// fieldWords splits a field name into its words, at anything but letters and
+// digits and where the case changes: firstName, first-name and FIRST NAME are
+// all first and name, and HTTPServer is HTTP and Server
+func fieldWords(name string) []string {
+	var words []string
+	runes := []rune(name)
+	start := -1
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if start >= 0 {
+				words = append(words, string(runes[start:i]))
+				start = -1
+			}
+			continue
+		}
+		if start >= 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			if !unicode.IsUpper(prev) || (i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				words = append(words, string(runes[start:i]))
+				start = i
+			}
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
+
+// camelCase joins words with the first in lower case and the rest capitalized
+func camelCase(words []string) string {
+	var b strings.Builder
+	for i, word := range words {
+		word = strings.ToLower(word)
+		if i > 0 {
+			runes := []rune(word)
+			runes[0] = unicode.ToUpper(runes[0])
+			word = string(runes)
+		}
+		b.WriteString(word)
+	}
+	return b.String()
+}
@@ -0,0 +1,75 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+// DefaultNotificationTimeout limits the webhook call when NotificationsConfig.Timeout is not set
+const DefaultNotificationTimeout = 10 * time.Second
+
+// Notify posts the report to the configured webhook. It gives up after the
+// configured timeout; callers are expected to log a failure and carry on, as
+// a broken webhook shouldn't fail the run it reports on.
+func Notify(ctx context.Context, cfg interfaces.NotificationsConfig, report *Report) error {
+	if cfg.WebhookURL == "" || (cfg.OnlyOnFailure && report.Status == StatusSuccess) {
+		return nil
+	}
+
+	timeout := DefaultNotificationTimeout
+	if cfg.Timeout != "" {
+		parsed, err := time.ParseDuration(cfg.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid notification timeout %q: %w", cfg.Timeout, err)
+		}
+		timeout = parsed
+	}
+
+	var payload interface{} = report
+	switch strings.ToLower(cfg.Format) {
+	case "", "json":
+	case "slack":
+		payload = map[string]string{"text": slackMessage(report)}
+	default:
+		return fmt.Errorf("invalid notification format %q: expected json or slack", cfg.Format)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notification webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func slackMessage(report *Report) string {
+	duration := time.Duration(report.DurationMS) * time.Millisecond
+	if report.Status != StatusSuccess {
+		return fmt.Sprintf(":x: Fractal run from %s to %s failed after %s: %s",
+			report.Input, report.Output, duration, report.Error)
+	}
+	return fmt.Sprintf(":white_check_mark: Fractal run from %s to %s succeeded in %s: %d read, %d written, %d filtered, %d quarantined",
+		report.Input, report.Output, duration, report.RecordsRead, report.RecordsWritten, report.RecordsFiltered, report.RecordsQuarantined)
+}
@@ -0,0 +1,49 @@
+package pipeline
+
+import (
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+// NullStage gives missing values one representation, nil, whatever the
+// source: string values listed as nulls become nil, and fields with a default
+// get it when they are null or missing. It runs before every other stage.
+type NullStage struct {
+	values   map[string]bool
+	defaults map[string]interface{}
+}
+
+// NewNullStage builds the null handling from its configuration
+func NewNullStage(cfg interfaces.NullsConfig) *NullStage {
+	n := &NullStage{values: make(map[string]bool, len(cfg.Values)), defaults: cfg.Defaults}
+	for _, value := range cfg.Values {
+		n.values[value] = true
+	}
+	return n
+}
+
+// Name returns the stage name
+func (n *NullStage) Name() string {
+	return "nulls"
+}
+
+// Process replaces null markers with nil and fills in defaults
+func (n *NullStage) Process(rec Record) ([]Record, error) {
+	if len(n.values) > 0 {
+		for field, value := range rec {
+			if s, ok := value.(string); ok && n.values[s] {
+				rec[field] = nil
+			}
+		}
+	}
+	for field, value := range n.defaults {
+		if rec[field] == nil {
+			rec[field] = value
+		}
+	}
+	return []Record{rec}, nil
+}
+
+// Flush has nothing to emit, null handling doesn't buffer
+func (n *NullStage) Flush() ([]Record, error) {
+	return nil, nil
+}
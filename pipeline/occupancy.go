@@ -0,0 +1,94 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// MeterName is the OpenTelemetry meter the pipeline's gauges are created on
+const MeterName = "github.com/SkySingh04/fractal/pipeline"
+
+// bufferLogInterval reads BufferConfig.LogInterval, 0 when occupancy isn't logged
+func bufferLogInterval(cfg interfaces.BufferConfig) (time.Duration, error) {
+	if cfg.LogInterval == "" {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(cfg.LogInterval)
+	if err != nil || interval <= 0 {
+		return 0, fmt.Errorf("invalid buffer log interval %q: must be a positive duration such as 10s", cfg.LogInterval)
+	}
+	return interval, nil
+}
+
+// observeOccupancy reports how full the buffer and the destination are while
+// a run sends: as gauges on the global meter provider, read whenever it
+// collects, and in a log line every interval when one is set. A full buffer
+// with every batch slot taken points at the destination, an empty buffer
+// with free slots at the source or the stages. The returned function stops
+// the reporting.
+func observeOccupancy(ctx context.Context, runID string, buffer *recordBuffer, d *delivery, interval time.Duration) func() {
+	stop := func() {}
+	meter := otel.Meter(MeterName)
+	held, errHeld := meter.Int64ObservableGauge("fractal.buffer.records",
+		metric.WithDescription("Records held between the stages and the destination"))
+	capacity, errCapacity := meter.Int64ObservableGauge("fractal.buffer.capacity",
+		metric.WithDescription("Records the buffer holds in memory before it blocks or spills"))
+	inFlight, errInFlight := meter.Int64ObservableGauge("fractal.delivery.batches_in_flight",
+		metric.WithDescription("Batches being written to the destination"))
+	maxInFlight, errMaxInFlight := meter.Int64ObservableGauge("fractal.delivery.max_in_flight",
+		metric.WithDescription("Batches that may be written to the destination at once"))
+	if err := errors.Join(errHeld, errCapacity, errInFlight, errMaxInFlight); err != nil {
+		logger.Infof("Buffer gauges are not reported: %v", err)
+	} else {
+		attrs := metric.WithAttributes(attribute.String("run_id", runID))
+		registration, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+			records, size := buffer.Held()
+			batches, slots := d.InFlight()
+			o.ObserveInt64(held, int64(records), attrs)
+			o.ObserveInt64(capacity, int64(size), attrs)
+			o.ObserveInt64(inFlight, int64(batches), attrs)
+			o.ObserveInt64(maxInFlight, int64(slots), attrs)
+			return nil
+		}, held, capacity, inFlight, maxInFlight)
+		if err != nil {
+			logger.Infof("Buffer gauges are not reported: %v", err)
+		} else {
+			stop = func() { _ = registration.Unregister() }
+		}
+	}
+	if interval == 0 {
+		return stop
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				records, size := buffer.Held()
+				batches, slots := d.InFlight()
+				logger.Infof("Buffer holds %d of %d records, %d of %d batches in flight", records, size, batches, slots)
+			}
+		}
+	}()
+	unregister := stop
+	return func() {
+		cancel()
+		<-done
+		unregister()
+	}
+}
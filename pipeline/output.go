@@ -0,0 +1,113 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+// Output modes of destinations that write files
+const (
+	OutputSingle   = "single"
+	OutputPerBatch = "per-batch"
+	OutputSized    = "sized"
+)
+
+// DefaultSizedBatchSize is the batch size of sized output when neither
+// delivery.batchsize nor outputmaxrows is set, so files can roll over
+const DefaultSizedBatchSize = 1000
+
+// outputParts decides which file each batch goes to. Single output appends
+// every batch to one file, per-batch output gives each batch a file of its
+// own, and sized output appends until a file reaches the row or byte limit.
+// Its methods are called with the delivery's mu held.
+type outputParts struct {
+	mode     string
+	maxRows  int
+	maxBytes int64
+	writer   interfaces.PartWriter
+
+	part    int
+	rows    int
+	started bool
+}
+
+// splitOutput sets up the output parts when the destination writes files.
+// Appending needs the batches in order, so only per-batch output can have
+// several in flight.
+func (d *delivery) splitOutput(req interfaces.Request, dest interfaces.DataDestination) error {
+	mode := strings.ToLower(strings.TrimSpace(req.OutputMode))
+	writer, ok := dest.(interfaces.PartWriter)
+	if !ok {
+		if mode != "" {
+			return fmt.Errorf("outputmode %s needs a destination that writes files, such as CSV", req.OutputMode)
+		}
+		return nil
+	}
+	if mode == "" {
+		mode = OutputSingle
+	}
+	if mode != OutputSingle && mode != OutputPerBatch && mode != OutputSized {
+		return fmt.Errorf("invalid outputmode %q: expected %s, %s or %s", req.OutputMode, OutputSingle, OutputPerBatch, OutputSized)
+	}
+	if req.OutputMaxRows < 0 || req.OutputMaxBytes < 0 {
+		return fmt.Errorf("outputmaxrows and outputmaxbytes must not be negative")
+	}
+	if mode == OutputSized && req.OutputMaxRows == 0 && req.OutputMaxBytes == 0 {
+		return fmt.Errorf("sized output needs outputmaxrows or outputmaxbytes")
+	}
+	if mode != OutputSized && (req.OutputMaxRows > 0 || req.OutputMaxBytes > 0) {
+		return fmt.Errorf("outputmaxrows and outputmaxbytes only apply to %s output", OutputSized)
+	}
+	if mode != OutputPerBatch && d.maxInFlight > 1 {
+		return fmt.Errorf("%s output appends batches in order, so maxinflight must be 1", mode)
+	}
+
+	d.parts = &outputParts{mode: mode, maxRows: req.OutputMaxRows, maxBytes: int64(req.OutputMaxBytes), writer: writer}
+	if mode == OutputSized && d.batchSize == 0 {
+		d.batchSize = DefaultSizedBatchSize
+		if req.OutputMaxRows > 0 && req.OutputMaxRows < d.batchSize {
+			d.batchSize = req.OutputMaxRows
+		}
+	}
+	return nil
+}
+
+// next returns the file the batch with the given index goes to, and whether
+// it continues the file instead of replacing it
+func (o *outputParts) next(batch int) (int, bool) {
+	if o == nil {
+		return 0, false
+	}
+	if o.mode == OutputPerBatch {
+		return batch, false
+	}
+	continues := o.started
+	o.started = true
+	return o.part, continues
+}
+
+// written rolls sized output over to the next file once the current one has
+// reached a limit. Files are only switched between batches, so a file can
+// pass the limit by up to one batch.
+func (o *outputParts) written(req interfaces.Request, rows int) error {
+	if o == nil || o.mode != OutputSized {
+		return nil
+	}
+	o.rows += rows
+	full := o.maxRows > 0 && o.rows >= o.maxRows
+	if !full && o.maxBytes > 0 {
+		size, err := o.writer.PartSize(req)
+		if err != nil {
+			return fmt.Errorf("failed to check the size of output file %d: %w", req.OutputPart, err)
+		}
+		full = size >= o.maxBytes
+	}
+	if full {
+		o.part++
+		o.rows = 0
+		o.started = false
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+)
+
+// pageReader reads a paged source one page at a time, retrying a page that
+// fails to read with exponential backoff
+type pageReader struct {
+	source  interfaces.PageReader
+	req     interfaces.Request
+	retries int
+	backoff time.Duration
+	token   string
+	done    bool
+}
+
+// newPageReader returns the reader of a source configured with a page size,
+// or nil when the source is read whole
+func newPageReader(source interfaces.DataSource, req interfaces.Request) (*pageReader, error) {
+	if req.PageSize < 0 || req.PageRetries < 0 {
+		return nil, fmt.Errorf("page size and page retries must not be negative")
+	}
+	if req.PageSize == 0 {
+		return nil, nil
+	}
+	paged, ok := source.(interfaces.PageReader)
+	if !ok {
+		return nil, fmt.Errorf("source %T does not read in pages, remove the page size", source)
+	}
+	r := &pageReader{source: paged, req: req, retries: req.PageRetries, backoff: DefaultRetryBackoff}
+	if req.PageRetryBackoff != "" {
+		backoff, err := time.ParseDuration(req.PageRetryBackoff)
+		if err != nil || backoff < 0 {
+			return nil, fmt.Errorf("invalid page retry backoff %q: must be a duration such as 500ms", req.PageRetryBackoff)
+		}
+		r.backoff = backoff
+	}
+	return r, nil
+}
+
+// next reads the next page. done is set once the last page has been read.
+func (r *pageReader) next(ctx context.Context, summary *Summary) (interface{}, error) {
+	backoff := r.backoff
+	for attempt := 0; ; attempt++ {
+		var data interface{}
+		var next string
+		err := untilDone(ctx, func() (err error) {
+			data, next, err = r.source.FetchPage(r.req, r.token)
+			return err
+		})
+		if ctx.Err() != nil {
+			return nil, context.Cause(ctx)
+		}
+		if err == nil {
+			summary.Pages++
+			r.token, r.done = next, next == ""
+			return data, nil
+		}
+		// A page that can never be read, such as one with a bad setting, is not retried
+		if attempt >= r.retries || errors.Is(err, interfaces.ErrConfigInvalid) {
+			return nil, fmt.Errorf("page %d: %w", summary.Pages+1, err)
+		}
+		logger.Infof("Failed to read page %d, retrying in %s (retry %d of %d): %v",
+			summary.Pages+1, backoff, attempt+1, r.retries, err)
+		summary.PageRetries++
+		select {
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,222 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+// phoneRegion is how a country writes its phone numbers: the calling code,
+// the trunk prefix national numbers start with, the prefix dialled before an
+// international number and how long its numbers are without either
+type phoneRegion struct {
+	code   string
+	trunk  string
+	intl   string
+	minLen int
+	maxLen int
+}
+
+// phoneRegions holds the regions numbers without a country code can be read
+// in, by ISO 3166 code
+var phoneRegions = map[string]phoneRegion{
+	"AE": {"971", "0", "00", 8, 9},
+	"AR": {"54", "0", "00", 10, 10},
+	"AT": {"43", "0", "00", 4, 13},
+	"AU": {"61", "0", "0011", 9, 9},
+	"BE": {"32", "0", "00", 8, 9},
+	"BR": {"55", "0", "00", 10, 11},
+	"CA": {"1", "1", "011", 10, 10},
+	"CH": {"41", "0", "00", 9, 9},
+	"CN": {"86", "0", "00", 9, 11},
+	"CZ": {"420", "", "00", 9, 9},
+	"DE": {"49", "0", "00", 6, 13},
+	"DK": {"45", "", "00", 8, 8},
+	"EG": {"20", "0", "00", 9, 10},
+	"ES": {"34", "", "00", 9, 9},
+	"FI": {"358", "0", "00", 5, 12},
+	"FR": {"33", "0", "00", 9, 9},
+	"GB": {"44", "0", "00", 9, 10},
+	"GR": {"30", "", "00", 10, 10},
+	"HK": {"852", "", "001", 8, 8},
+	"ID": {"62", "0", "001", 9, 12},
+	"IE": {"353", "0", "00", 7, 9},
+	"IL": {"972", "0", "00", 8, 9},
+	"IN": {"91", "0", "00", 10, 10},
+	"IT": {"39", "", "00", 6, 11},
+	"JP": {"81", "0", "010", 9, 10},
+	"KE": {"254", "0", "000", 9, 9},
+	"KR": {"82", "0", "001", 8, 10},
+	"MX": {"52", "", "00", 10, 10},
+	"MY": {"60", "0", "00", 9, 10},
+	"NG": {"234", "0", "009", 8, 10},
+	"NL": {"31", "0", "00", 9, 9},
+	"NO": {"47", "", "00", 8, 8},
+	"NZ": {"64", "0", "00", 8, 10},
+	"PH": {"63", "0", "00", 10, 10},
+	"PK": {"92", "0", "00", 10, 10},
+	"PL": {"48", "", "00", 9, 9},
+	"PT": {"351", "", "00", 9, 9},
+	"RU": {"7", "8", "810", 10, 10},
+	"SA": {"966", "0", "00", 9, 9},
+	"SE": {"46", "0", "00", 7, 9},
+	"SG": {"65", "", "000", 8, 8},
+	"TH": {"66", "0", "001", 8, 9},
+	"TR": {"90", "0", "00", 10, 10},
+	"US": {"1", "1", "011", 10, 10},
+	"VN": {"84", "0", "00", 9, 10},
+	"ZA": {"27", "0", "00", 9, 9},
+}
+
+// phoneCodes holds the regions by calling code, merged where regions share one
+var phoneCodes = func() map[string]phoneRegion {
+	codes := map[string]phoneRegion{}
+	for _, region := range phoneRegions {
+		if known, ok := codes[region.code]; ok {
+			region.minLen = min(region.minLen, known.minLen)
+			region.maxLen = max(region.maxLen, known.maxLen)
+		}
+		codes[region.code] = region
+	}
+	return codes
+}()
+
+// phoneSeparators matches the characters written between the digits of a phone number
+var phoneSeparators = regexp.MustCompile(`[\s\-./()]`)
+
+// E.164 numbers are at most 15 digits long, the calling code included, and
+// the shortest in use are 7
+const (
+	phoneMinDigits = 7
+	phoneMaxDigits = 15
+)
+
+func init() {
+	registerTransform(TransformRule{
+		Keyword:     "phone",
+		Syntax:      `phone <field> [<region>]`,
+		Description: "Rewrites a phone number in E.164 form, reading numbers without a country code as numbers of region",
+		parse:       parsePhoneRule,
+	})
+}
+
+// NormalizePhone returns the phone number in E.164 form, such as
+// +14155550123. A number without a country code, one not starting with + or
+// the international prefix, is read as a number of region, and fails when
+// region is empty.
+func NormalizePhone(value, region string) (string, error) {
+	raw := strings.TrimSpace(value)
+	if raw == "" {
+		return "", errors.New("empty phone number")
+	}
+	var home *phoneRegion
+	if region != "" {
+		r, ok := phoneRegions[strings.ToUpper(region)]
+		if !ok {
+			return "", fmt.Errorf("unknown phone region %s", region)
+		}
+		home = &r
+	}
+	international := strings.HasPrefix(raw, "+")
+	if international {
+		// A trunk prefix in brackets, as in +44 (0)20, is not dialled from abroad
+		raw = strings.Replace(raw[1:], "(0)", "", 1)
+	}
+	digits := phoneSeparators.ReplaceAllString(raw, "")
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return "", fmt.Errorf("phone number %q holds %q, expected digits", value, c)
+		}
+	}
+	if !international {
+		switch {
+		case home != nil && strings.HasPrefix(digits, home.intl):
+			digits, international = digits[len(home.intl):], true
+		case home == nil && strings.HasPrefix(digits, "00"):
+			digits, international = digits[2:], true
+		case home == nil:
+			return "", fmt.Errorf("phone number %q has no country code, and no region is set", value)
+		}
+	}
+
+	code, national := "", digits
+	if international {
+		for n := 1; n <= 3 && n < len(digits); n++ {
+			if r, ok := phoneCodes[digits[:n]]; ok {
+				code, national = r.code, digits[n:]
+				home = &r
+				break
+			}
+		}
+		if code == "" {
+			// Calling codes outside the table only get the E.164 length check
+			if len(digits) < phoneMinDigits || len(digits) > phoneMaxDigits {
+				return "", fmt.Errorf("phone number %q is %d digits long, expected %d to %d", value, len(digits), phoneMinDigits, phoneMaxDigits)
+			}
+			return "+" + digits, nil
+		}
+	} else {
+		code = home.code
+	}
+	if home.trunk != "" && strings.HasPrefix(national, home.trunk) && len(national)-len(home.trunk) >= home.minLen {
+		national = national[len(home.trunk):]
+	}
+	if len(national) < home.minLen || len(national) > home.maxLen || len(code)+len(national) > phoneMaxDigits {
+		return "", fmt.Errorf("phone number %q has %d digits after the country code +%s, expected %s", value, len(national), code, phoneLengths(home))
+	}
+	return "+" + code + national, nil
+}
+
+// phoneLengths describes the lengths a region's numbers can have
+func phoneLengths(r *phoneRegion) string {
+	if r.minLen == r.maxLen {
+		return fmt.Sprint(r.minLen)
+	}
+	return fmt.Sprintf("%d to %d", r.minLen, r.maxLen)
+}
+
+// checkPhoneRegion fails a region phone numbers cannot be read in
+func checkPhoneRegion(region string) error {
+	if region == "" {
+		return nil
+	}
+	if _, ok := phoneRegions[strings.ToUpper(region)]; !ok {
+		return fmt.Errorf("unknown phone region %s", region)
+	}
+	return nil
+}
+
+// parsePhoneRule reads a phone rule. Missing, null and empty values are left
+// alone; a value that is not a phone number fails the record.
+func parsePhoneRule(args []string, _ interfaces.TransformConfig) (transformFunc, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return nil, fmt.Errorf("expected a field and an optional region")
+	}
+	field, region := args[0], ""
+	if len(args) == 2 {
+		region = args[1]
+	}
+	if err := checkPhoneRegion(region); err != nil {
+		return nil, err
+	}
+
+	return func(rec Record) error {
+		value, ok := rec[field]
+		if !ok || value == nil {
+			return nil
+		}
+		text := fmt.Sprint(value)
+		if strings.TrimSpace(text) == "" {
+			return nil
+		}
+		normalized, err := NormalizePhone(text, region)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field, err)
+		}
+		rec[field] = normalized
+		return nil
+	}, nil
+}
@@ -0,0 +1,787 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+	"github.com/SkySingh04/fractal/opentele"
+	"github.com/google/uuid"
+)
+
+// Error handling strategies understood by the pipeline
+const (
+	StrategyLogAndContinue = "LOG_AND_CONTINUE"
+	StrategyStopOnError    = "STOP_ON_ERROR"
+)
+
+// SourceStageName is reported for records rejected while reading the source, before any stage
+const SourceStageName = "source"
+
+// ErrFiltered is returned by a stage to drop a record without treating it as a failure
+var ErrFiltered = errors.New("record filtered out")
+
+// ErrTimeout is returned when a run takes longer than PipelineConfig.MaxDuration
+var ErrTimeout = errors.New("run exceeded its maximum duration")
+
+// ErrQuarantine is returned by a stage to quarantine a record whatever the error handling strategy
+var ErrQuarantine = errors.New("record quarantined")
+
+// Stage is a step records pass through between the source and the destination
+type Stage interface {
+	// Name identifies the stage in logs and in the run summary
+	Name() string
+	// Process handles a single record and returns the records to pass on
+	Process(rec Record) ([]Record, error)
+	// Flush is called once the source is exhausted so buffering stages can emit what they hold
+	Flush() ([]Record, error)
+}
+
+// ColumnOrderer is implemented by stages that decide which fields come out and
+// in what order, so destinations with columns, such as CSV, can follow it
+type ColumnOrderer interface {
+	// Columns returns the column order given the order before the stage
+	Columns(previous []string) []string
+}
+
+// StreamFlusher is implemented by stages that emit what they hold a batch at a
+// time once the source is exhausted, rather than all at once from Flush
+type StreamFlusher interface {
+	// FlushTo passes the held records to emit in batches, stopping at the first error emit returns
+	FlushTo(emit func([]Record) error) error
+}
+
+// Summary describes the outcome of a pipeline run
+type Summary struct {
+	RunID              string          `json:"run_id"`
+	RecordsRead        int             `json:"records_read"`
+	RecordsWritten     int             `json:"records_written"`
+	RecordsFiltered    int             `json:"records_filtered"`
+	RecordsQuarantined int             `json:"records_quarantined"`
+	BatchesWritten     int             `json:"batches_written"`
+	Retries            int             `json:"retries"`
+	Pages              int             `json:"pages,omitempty"`        // Pages read from a paged source
+	PageRetries        int             `json:"page_retries,omitempty"` // Further attempts at pages that failed to read
+	StageErrors        map[string]int  `json:"stage_errors"`
+	EmptyInput         bool            `json:"empty_input,omitempty"`    // The source returned no records
+	SchemaDiff         *SchemaDiff     `json:"schema_diff,omitempty"`    // How the source differed from the expected schema
+	Buffer             *BufferStats    `json:"buffer,omitempty"`         // How full the buffer got and who waited on it
+	TuningHints        []string        `json:"tuning_hints,omitempty"`   // Delivery and buffer settings the buffer stats suggest
+	Reconciliation     *Reconciliation `json:"reconciliation,omitempty"` // Keys read and written, when reconciliation is on
+	Manifest           string          `json:"manifest,omitempty"`       // Marker file written once the output was complete
+	Profile            *Profile        `json:"profile,omitempty"`        // Column statistics of the records written, when profiling is on
+}
+
+// Pipeline moves data from a source to a destination through the configured stages
+type Pipeline struct {
+	Source             interfaces.DataSource
+	SourceRequest      interfaces.Request
+	Destination        interfaces.DataDestination
+	DestinationRequest interfaces.Request
+	Config             interfaces.PipelineConfig
+	RunID              string // Identifies this execution in logs and reports, generated when empty
+	SourceName         string // Registered name of the source, for provenance fields
+	SkipCheckpoint     bool   // Leaves the source's checkpoint where it was, for runs whose output is only looked at
+}
+
+// Run fetches data from the source, applies the stages and sends the result
+// to the destination. When the run takes longer than Config.MaxDuration it
+// is cancelled and returns ErrTimeout; batches already sent stay written.
+func (p *Pipeline) Run(ctx context.Context) (*Summary, error) {
+	if p.RunID == "" {
+		p.RunID = uuid.NewString()
+	}
+	summary := &Summary{RunID: p.RunID, StageErrors: map[string]int{}}
+	logger.Infof("Starting run %s", p.RunID)
+
+	if p.Config.MaxDuration == "" {
+		return summary, p.run(ctx, summary)
+	}
+	maxDuration, err := time.ParseDuration(p.Config.MaxDuration)
+	if err != nil || maxDuration <= 0 {
+		return summary, interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid max duration %q: must be a positive duration such as 30m", p.Config.MaxDuration))
+	}
+	ctx, cancel := context.WithTimeoutCause(ctx, maxDuration, ErrTimeout)
+	defer cancel()
+	err = p.run(ctx, summary)
+	if err != nil && errors.Is(context.Cause(ctx), ErrTimeout) {
+		logger.Infof("Run %s cancelled after %s with %d records written", p.RunID, maxDuration, summary.RecordsWritten)
+		return summary, fmt.Errorf("%w of %s", ErrTimeout, maxDuration)
+	}
+	return summary, err
+}
+
+func (p *Pipeline) run(ctx context.Context, summary *Summary) error {
+	stages, err := BuildStages(p.Config)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	budget, err := newErrorBudget(p.Config.ErrorHandling)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	normalizer, err := newFieldNormalizer(p.Config.NormalizeFields)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	schema, err := newExpectedSchema(p.Config.Schema)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	reconciler, err := newReconciler(p.Config.Reconcile)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	profile, err := newProfiler(p.Config.Profiling)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	logInterval, err := bufferLogInterval(p.Config.Buffer)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	onEmptyInput, err := emptyInputPolicy(p.Config.OnEmptyInput)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	deliveryConfig := p.Config.Delivery
+	if p.DestinationRequest.MaxInFlight != 0 {
+		deliveryConfig.MaxInFlight = p.DestinationRequest.MaxInFlight
+	}
+	delivery, err := newDelivery(deliveryConfig, p.Config.ErrorHandling, budget)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	defer delivery.Close()
+	delivery.reconcile = reconciler
+	if err := p.validateConfig(); err != nil {
+		return err
+	}
+	// The extra fields policy sees the records as they are about to be written
+	extraFields, err := newExtraFieldsStage(p.Config.OutputFields, p.Destination, p.DestinationRequest)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	}
+	if extraFields != nil {
+		stages = append(stages, extraFields)
+	}
+	// Records are routed once every stage is done with them
+	route, err := newRouteStage(p.Destination, p.DestinationRequest, p.Config.Delivery.MaxTargets)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid destination config: %w", err))
+	}
+	if route != nil {
+		stages = append(stages, route)
+		delivery.routes = &routes{router: p.Destination.(interfaces.Router), targets: map[string]*routedTarget{}}
+	}
+	if err := delivery.splitOutput(p.DestinationRequest, p.Destination); err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid destination config: %w", err))
+	}
+	delivery.manifest, err = newManifest(p.Config.Manifest, p.Destination, p.DestinationRequest)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid destination config: %w", err))
+	}
+	pages, err := newPageReader(p.Source, p.SourceRequest)
+	if err != nil {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid source config: %w", err))
+	}
+
+	_, fetchSpan := opentele.CreateSpan(ctx, "fetch-data")
+	var data interface{}
+	if pages != nil {
+		data, err = pages.next(ctx, summary)
+	} else {
+		err = untilDone(ctx, func() (err error) {
+			data, err = p.Source.FetchData(p.SourceRequest)
+			return err
+		})
+	}
+	if err != nil {
+		fetchSpan.RecordError(err)
+		fetchSpan.End()
+		return fmt.Errorf("failed to fetch data: %w", err)
+	}
+	fetchSpan.End()
+	fetchedAt := time.Now()
+
+	dataset := NewDataset(data)
+	if pages != nil && !dataset.Structured() {
+		closeStages(stages)
+		return fmt.Errorf("failed to fetch data: paged source returned %T, which is not records", data)
+	}
+	// An empty source is caught before the destination prepares or writes,
+	// unless more pages are still to come
+	emptyChecked := pages == nil || pages.done
+	if emptyChecked && dataset.empty() {
+		if err := checkEmptyInput(onEmptyInput, summary); err != nil {
+			closeStages(stages)
+			return err
+		}
+	}
+	if !dataset.Structured() {
+		if len(stages) > 0 {
+			logger.Infof("Data of type %T is not record-oriented, skipping %d pipeline stage(s)", data, len(stages))
+			closeStages(stages)
+		}
+		if p.Config.Provenance.Enabled {
+			logger.Infof("Data of type %T is not record-oriented, provenance fields are not added", data)
+		}
+		if normalizer != nil {
+			logger.Infof("Data of type %T is not record-oriented, field names are not normalized", data)
+		}
+		if schema != nil {
+			logger.Infof("Data of type %T is not record-oriented, the schema is not checked", data)
+		}
+		if reconciler != nil {
+			logger.Infof("Data of type %T is not record-oriented, records are not reconciled", data)
+		}
+		if profile != nil {
+			logger.Infof("Data of type %T is not record-oriented, columns are not profiled", data)
+		}
+		if extraFields != nil {
+			logger.Infof("Data of type %T is not record-oriented, extra fields are not checked", data)
+		}
+		if route != nil {
+			return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("data of type %T is not record-oriented, so it cannot be routed to targets named from fields", data))
+		}
+		if err := p.send(ctx, delivery, dataset, nil, summary); err != nil {
+			return err
+		}
+		return p.commit(delivery, summary)
+	}
+	summary.RecordsRead = len(dataset.Records) + len(dataset.rejected)
+	if err := normalizer.normalize(dataset); err != nil {
+		closeStages(stages)
+		return err
+	}
+	// Reported whatever the outcome, as a failed run needs the evidence most
+	defer reconciler.report(summary)
+	delivery.profile = profile
+	defer profile.report(summary)
+	reconciler.observeRead(dataset)
+	if err := schema.check(dataset, summary); err != nil {
+		closeStages(stages)
+		return err
+	}
+	var stamp *provenance
+	if p.Config.Provenance.Enabled {
+		stamp = newProvenance(p.Config.Provenance, p.RunID, p.SourceName, p.sourceLocation(), fetchedAt)
+	}
+
+	// The stages feed the buffer while the destination drains it, so a slow
+	// destination holds the stages back instead of piling up records
+	buffer := newRecordBuffer(p.Config.Buffer)
+	defer buffer.Cleanup()
+	stopObserving := observeOccupancy(ctx, p.RunID, buffer, delivery, logInterval)
+	defer func() {
+		stopObserving()
+		stats := buffer.Stats()
+		delivery.addStats(stats)
+		summary.Buffer = stats
+		summary.TuningHints = TuningHints(stats)
+		logger.Infof("Buffer peaked at %d records, the stages waited %dms for room and the destination %dms for records",
+			stats.Peak, stats.StagesWaitMS, stats.DestinationWaitMS)
+		logger.Infof("Batches held %.1f records on average, the destination was busy %.0f%% of the time across %d batch slots",
+			stats.AvgBatchRecords, stats.DestinationBusy*100, stats.MaxInFlight)
+		for _, hint := range summary.TuningHints {
+			logger.Infof("Tuning hint: %s", hint)
+		}
+	}()
+	// Cancelling wakes up both sides of the buffer, so neither waits on the other
+	stop := context.AfterFunc(ctx, func() { buffer.Close(context.Cause(ctx)) })
+	defer stop()
+	// The pages after the first are read while the stages work through the ones before
+	var nextPage func() (*Dataset, error)
+	if pages != nil {
+		nextPage = func() (*Dataset, error) {
+			if pages.done {
+				return nil, nil
+			}
+			data, err := pages.next(ctx, summary)
+			if err != nil {
+				return nil, err
+			}
+			page := NewDataset(data)
+			if !page.Structured() {
+				return nil, fmt.Errorf("failed to fetch data: paged source returned %T, which is not records", data)
+			}
+			summary.RecordsRead += len(page.Records) + len(page.rejected)
+			if err := normalizer.normalize(page); err != nil {
+				return nil, err
+			}
+			reconciler.observeRead(page)
+			if err := schema.check(page, summary); err != nil {
+				return nil, err
+			}
+			return page, nil
+		}
+	}
+	processed := make(chan error, 1)
+	go func() {
+		_, processSpan := opentele.CreateSpan(ctx, "process-data")
+		err := p.process(dataset, nextPage, stamp, stages, budget, summary, buffer.Put)
+		if err != nil {
+			processSpan.RecordError(err)
+		}
+		processSpan.End()
+		buffer.Close(err)
+		processed <- err
+	}()
+
+	output := dataset.withRecords(nil)
+	output.NullString = p.Config.Nulls.NullString
+	for _, stage := range stages {
+		if orderer, ok := stage.(ColumnOrderer); ok {
+			output.Columns = orderer.Columns(output.Columns)
+		}
+	}
+	sendErr := p.send(ctx, delivery, output, buffer, summary)
+	if sendErr != nil {
+		buffer.Close(sendErr)
+	}
+	// A successful send means the stages have finished, so only a failed one
+	// may be left waiting on a stage that is stuck
+	var processErr error
+	if sendErr == nil {
+		processErr = <-processed
+	} else {
+		select {
+		case processErr = <-processed:
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+	if processErr != nil && !errors.Is(processErr, sendErr) {
+		return processErr
+	}
+	if sendErr != nil {
+		return sendErr
+	}
+	if !emptyChecked && summary.RecordsRead == 0 {
+		if err := checkEmptyInput(onEmptyInput, summary); err != nil {
+			return err
+		}
+	}
+	return p.commit(delivery, summary)
+}
+
+// untilDone runs fn and returns its error, or the context's cause if the
+// context ends first. Sources and destinations cannot be interrupted, so fn is
+// left to finish in the background in that case.
+func untilDone(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// sourceLocation asks the source where it read from, if it can say
+func (p *Pipeline) sourceLocation() string {
+	if locator, ok := p.Source.(interfaces.Locator); ok {
+		return locator.Location(p.SourceRequest)
+	}
+	return ""
+}
+
+// validateConfig lets the source and the destination check their settings before anything is read
+func (p *Pipeline) validateConfig() error {
+	if err := checkOptions(p.Source, p.SourceRequest, "source"); err != nil {
+		return err
+	}
+	if err := checkOptions(p.Destination, p.DestinationRequest, "destination"); err != nil {
+		return err
+	}
+	if validator, ok := p.Source.(interfaces.ConfigValidator); ok {
+		if err := validator.ValidateConfig(p.SourceRequest); err != nil {
+			return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid source config: %w", err))
+		}
+	}
+	if validator, ok := p.Destination.(interfaces.ConfigValidator); ok {
+		if err := validator.ValidateConfig(p.DestinationRequest); err != nil {
+			return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid destination config: %w", err))
+		}
+	}
+	return nil
+}
+
+// checkOptions rejects options for an integration that cannot pass them on,
+// which would otherwise leave them silently unused
+func checkOptions(integration interface{}, req interfaces.Request, role string) error {
+	if len(req.Options) == 0 {
+		return nil
+	}
+	passer, ok := integration.(interfaces.OptionsPasser)
+	if !ok {
+		return interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid %s config: %T does not take options", role, integration))
+	}
+	logger.Debugf("Passing %d option(s) to the %s as %s", len(req.Options), role, passer.OptionsTarget())
+	return nil
+}
+
+// prepare lets a destination that sets up before writing do so
+func (p *Pipeline) prepare(ctx context.Context) error {
+	preparer, ok := p.Destination.(interfaces.Preparer)
+	if !ok {
+		return nil
+	}
+	if err := untilDone(ctx, func() error { return preparer.Prepare(p.DestinationRequest) }); err != nil {
+		return fmt.Errorf("failed to prepare the destination: %w", err)
+	}
+	return nil
+}
+
+// commit lets a destination that cleans up after writing do so and writes
+// the manifest, then lets a source that tracks its progress record it, now
+// that the data has been delivered
+func (p *Pipeline) commit(d *delivery, summary *Summary) error {
+	if finisher, ok := p.Destination.(interfaces.Finisher); ok {
+		for _, req := range d.finishRequests(p.DestinationRequest) {
+			if err := finisher.Finish(req); err != nil {
+				return interfaces.Wrap(interfaces.ErrWrite, fmt.Errorf("failed to finish writing: %w", err))
+			}
+		}
+	}
+	if d.manifest != nil {
+		if err := d.manifest.write(p.RunID); err != nil {
+			return interfaces.Wrap(interfaces.ErrWrite, err)
+		}
+		summary.Manifest = d.manifest.path
+	}
+	checkpointer, ok := p.Source.(interfaces.Checkpointer)
+	if !ok || p.SkipCheckpoint {
+		return nil
+	}
+	if err := checkpointer.Commit(p.SourceRequest); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
+
+// send delivers the records drained from the buffer to the destination, or
+// the dataset as it is when there is no buffer
+func (p *Pipeline) send(ctx context.Context, d *delivery, dataset *Dataset, buffer *recordBuffer, summary *Summary) error {
+	sendCtx, sendSpan := opentele.CreateSpan(ctx, "send-data")
+	defer sendSpan.End()
+
+	// The marker of an earlier run goes before the output it describes is replaced
+	req := p.DestinationRequest
+	var err error
+	if d.manifest != nil {
+		req.OutputWritten = d.manifest.written
+		err = d.manifest.clear()
+	}
+	// Routed records prepare the destination for each target they name
+	if err == nil && d.routes == nil {
+		err = p.prepare(sendCtx)
+	}
+	if err == nil && buffer == nil {
+		_, err = d.sendBatch(sendCtx, p.Destination, req, dataset, summary)
+	} else if err == nil {
+		err = d.send(sendCtx, p.Destination, req, dataset, buffer, summary)
+	}
+	if err != nil {
+		sendSpan.RecordError(err)
+		// Cancellation is not the destination's doing
+		if ctx.Err() == nil {
+			err = interfaces.Wrap(interfaces.ErrWrite, err)
+		}
+		return fmt.Errorf("failed to send data: %w", err)
+	}
+	return nil
+}
+
+// DefaultStageOrder is the order the configured stages run in when
+// PipelineConfig.Stages is empty
+var DefaultStageOrder = []string{"nulls", "join", "reshape", "validate", "transform", "filter", "window", "aggregate", "sort", "select"}
+
+// stageBuilder says whether a stage is configured and builds it. set names
+// the validation rule set of a validate:<set> entry, empty for the others.
+type stageBuilder struct {
+	configured func(cfg interfaces.PipelineConfig) bool
+	build      func(cfg interfaces.PipelineConfig, set string) (Stage, error)
+}
+
+// stageBuilders holds the builders by stage name
+var stageBuilders = map[string]stageBuilder{
+	"nulls": {
+		configured: func(cfg interfaces.PipelineConfig) bool {
+			return len(cfg.Nulls.Values) > 0 || len(cfg.Nulls.Defaults) > 0
+		},
+		build: func(cfg interfaces.PipelineConfig, set string) (Stage, error) { return NewNullStage(cfg.Nulls), nil },
+	},
+	"join": {
+		configured: func(cfg interfaces.PipelineConfig) bool { return cfg.Join.Input != "" },
+		build:      func(cfg interfaces.PipelineConfig, set string) (Stage, error) { return NewJoinStage(cfg.Join) },
+	},
+	"reshape": {
+		configured: func(cfg interfaces.PipelineConfig) bool { return len(cfg.Reshape.Rules) > 0 },
+		build:      func(cfg interfaces.PipelineConfig, set string) (Stage, error) { return NewReshapeStage(cfg.Reshape) },
+	},
+	"validate": {
+		configured: func(cfg interfaces.PipelineConfig) bool { return len(cfg.Validate.Rules) > 0 },
+		build:      buildValidateStage,
+	},
+	"transform": {
+		configured: func(cfg interfaces.PipelineConfig) bool { return len(cfg.Transform.Rules) > 0 },
+		build: func(cfg interfaces.PipelineConfig, set string) (Stage, error) {
+			return NewTransformStage(cfg.Transform)
+		},
+	},
+	"filter": {
+		configured: func(cfg interfaces.PipelineConfig) bool { return len(cfg.Filter.Rules) > 0 },
+		build:      func(cfg interfaces.PipelineConfig, set string) (Stage, error) { return NewFilterStage(cfg.Filter) },
+	},
+	"window": {
+		configured: func(cfg interfaces.PipelineConfig) bool { return cfg.Window.Size != "" },
+		build:      func(cfg interfaces.PipelineConfig, set string) (Stage, error) { return NewWindowStage(cfg.Window) },
+	},
+	"aggregate": {
+		configured: func(cfg interfaces.PipelineConfig) bool {
+			return len(cfg.Aggregate.GroupBy) > 0 || len(cfg.Aggregate.Aggregations) > 0
+		},
+		build: func(cfg interfaces.PipelineConfig, set string) (Stage, error) {
+			return NewAggregateStage(cfg.Aggregate)
+		},
+	},
+	"sort": {
+		configured: func(cfg interfaces.PipelineConfig) bool { return len(cfg.Sort.By) > 0 },
+		build:      func(cfg interfaces.PipelineConfig, set string) (Stage, error) { return NewSortStage(cfg.Sort) },
+	},
+	"select": {
+		configured: func(cfg interfaces.PipelineConfig) bool {
+			return len(cfg.Select.Fields) > 0 || len(cfg.Select.Exclude) > 0
+		},
+		build: func(cfg interfaces.PipelineConfig, set string) (Stage, error) { return NewSelectStage(cfg.Select) },
+	},
+}
+
+// BuildStages creates the stages described by the pipeline configuration, in
+// the order they run. Without a stage list the configured stages run in
+// DefaultStageOrder. A stage list runs exactly the stages it names, a stage
+// named twice runs twice, and every configured stage must be in it. A
+// configured tap goes after the stage it samples.
+func BuildStages(cfg interfaces.PipelineConfig) ([]Stage, error) {
+	order := cfg.Stages
+	if len(order) == 0 {
+		for _, name := range DefaultStageOrder {
+			if stageBuilders[name].configured(cfg) {
+				order = append(order, name)
+			}
+		}
+	}
+
+	var stages []Stage
+	listed := map[string]bool{}
+	for _, entry := range order {
+		name, set, _ := strings.Cut(strings.ToLower(strings.TrimSpace(entry)), ":")
+		builder, ok := stageBuilders[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown stage %q in stages, expected one of %s", entry, strings.Join(DefaultStageOrder, ", "))
+		}
+		if set != "" && name != "validate" {
+			return nil, fmt.Errorf("stage %q in stages: only validate takes a rule set", entry)
+		}
+		if set == "" && !builder.configured(cfg) {
+			return nil, fmt.Errorf("stage %s is in stages but not configured", name)
+		}
+		listed[name+":"+set] = true
+		stage, err := builder.build(cfg, set)
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, stage)
+	}
+	for _, name := range DefaultStageOrder {
+		if stageBuilders[name].configured(cfg) && !listed[name+":"] {
+			return nil, fmt.Errorf("stage %s is configured but not in stages", name)
+		}
+	}
+	for set := range cfg.Validate.Sets {
+		if !listed["validate:"+strings.ToLower(set)] {
+			return nil, fmt.Errorf("validation set %s is not in stages, add validate:%s where it should run", set, strings.ToLower(set))
+		}
+	}
+	if cfg.Tap.Every != 0 || cfg.Tap.Sample != 0 {
+		return insertTap(stages, cfg.Tap)
+	}
+	return stages, nil
+}
+
+// process stamps every record with its provenance, when enabled, runs it
+// through the stages, honouring the error handling strategy and the error
+// budget, and hands what comes out the end to emit. For a paged source,
+// nextPage reads the pages after dataset, nil after the last one.
+func (p *Pipeline) process(dataset *Dataset, nextPage func() (*Dataset, error), stamp *provenance, stages []Stage, budget *errorBudget, summary *Summary, emit func(Record) error) error {
+	quarantine := newQuarantine(p.Config.ErrorHandling)
+	defer quarantine.Close()
+	defer closeStages(stages)
+
+	passed := 0
+	emitAll := func(records []Record) error {
+		for _, rec := range records {
+			if err := emit(rec); err != nil {
+				return err
+			}
+			passed++
+		}
+		return nil
+	}
+
+	for offset := 0; dataset != nil; {
+		if err := p.processPage(dataset, offset, stamp, stages, budget, quarantine, summary, emitAll); err != nil {
+			return err
+		}
+		offset += len(dataset.Records)
+		if nextPage == nil {
+			break
+		}
+		var err error
+		if dataset, err = nextPage(); err != nil {
+			return err
+		}
+	}
+
+	// Let buffering stages emit, feeding their output through the stages after them
+	for i, stage := range stages {
+		var passErr error
+		pass := func(flushed []Record) error {
+			records, rejected, err := p.runStages(stages, i+1, flushed, quarantine, summary)
+			if err == nil {
+				err = budget.Reject(rejected)
+			}
+			if err == nil {
+				err = emitAll(records)
+			}
+			passErr = err
+			return err
+		}
+		var err error
+		if streamer, ok := stage.(StreamFlusher); ok {
+			err = streamer.FlushTo(pass)
+		} else {
+			var flushed []Record
+			if flushed, err = stage.Flush(); err == nil {
+				err = pass(flushed)
+			}
+		}
+		if passErr != nil {
+			return passErr
+		}
+		if err != nil {
+			return fmt.Errorf("stage %s failed to flush: %w", stage.Name(), err)
+		}
+	}
+	if err := budget.Finish(); err != nil {
+		return err
+	}
+
+	if len(stages) > 0 {
+		logger.Infof("Pipeline processed %d records: %d passed, %d filtered, %d quarantined",
+			summary.RecordsRead, passed, summary.RecordsFiltered, summary.RecordsQuarantined)
+	}
+	return nil
+}
+
+// processPage runs the records of one page of the source through the stages.
+// offset is how many records the pages before it held.
+func (p *Pipeline) processPage(dataset *Dataset, offset int, stamp *provenance, stages []Stage, budget *errorBudget, quarantine *quarantine, summary *Summary, emitAll func([]Record) error) error {
+	// Rows the source could not read into records are quarantined whatever
+	// the strategy, in their place among the records for the error budget
+	sourceRejects := dataset.rejected
+	rejectSource := func(before int) error {
+		for len(sourceRejects) > 0 && sourceRejects[0].Before <= before {
+			rejected := sourceRejects[0]
+			sourceRejects = sourceRejects[1:]
+			summary.StageErrors[SourceStageName]++
+			logger.Infof("Rejected source record: %v", rejected.Err)
+			if err := quarantine.Add(SourceStageName, rejected.Record, rejected.Err); err != nil {
+				return err
+			}
+			summary.RecordsQuarantined++
+			if err := budget.Observe(1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i, rec := range dataset.Records {
+		if err := rejectSource(i); err != nil {
+			return err
+		}
+		if stamp != nil {
+			if err := stamp.stamp(rec, offset+i); err != nil {
+				return err
+			}
+		}
+		records, rejected, err := p.runStages(stages, 0, []Record{rec}, quarantine, summary)
+		if err != nil {
+			return err
+		}
+		if err := budget.Observe(rejected); err != nil {
+			return err
+		}
+		if err := emitAll(records); err != nil {
+			return err
+		}
+		// The buffer owns the records from here on
+		dataset.Records[i] = nil
+	}
+	return rejectSource(len(dataset.Records))
+}
+
+// runStages pushes records through stages[from:] and returns what comes out
+// the end and how many records the stages rejected
+func (p *Pipeline) runStages(stages []Stage, from int, records []Record, q *quarantine, summary *Summary) ([]Record, int, error) {
+	rejected := 0
+	for _, stage := range stages[from:] {
+		var next []Record
+		for _, rec := range records {
+			out, err := stage.Process(rec)
+			if errors.Is(err, ErrFiltered) {
+				summary.RecordsFiltered++
+				continue
+			}
+			if err != nil {
+				summary.StageErrors[stage.Name()]++
+				if !errors.Is(err, ErrQuarantine) && !p.continueOnError() {
+					return nil, rejected, fmt.Errorf("stage %s failed: %w", stage.Name(), interfaces.Wrap(interfaces.ErrTransform, err))
+				}
+				logger.Infof("Stage %s rejected record: %v", stage.Name(), err)
+				if qErr := q.Add(stage.Name(), rec, err); qErr != nil {
+					return nil, rejected, qErr
+				}
+				summary.RecordsQuarantined++
+				rejected++
+				continue
+			}
+			next = append(next, out...)
+		}
+		records = next
+	}
+	return records, rejected, nil
+}
+
+// closeStages releases whatever stages hold on to, such as spill files, even when the run fails
+func closeStages(stages []Stage) {
+	for _, stage := range stages {
+		if closer, ok := stage.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				logger.Infof("Failed to clean up stage %s: %v", stage.Name(), err)
+			}
+		}
+	}
+}
+
+func (p *Pipeline) continueOnError() bool {
+	return strings.EqualFold(p.Config.ErrorHandling.Strategy, StrategyLogAndContinue)
+}
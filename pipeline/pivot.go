@@ -0,0 +1,183 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+// pivotKeyword is the rule holding records until the source is exhausted
+const pivotKeyword = "pivot"
+
+// DefaultMaxPivotColumns is how many columns a pivot rule creates when
+// TransformConfig.MaxPivotColumns is not set
+const DefaultMaxPivotColumns = 1000
+
+func init() {
+	// NewTransformStage reads pivot rules itself, as they hold records until Flush
+	registerTransform(TransformRule{
+		Keyword:     pivotKeyword,
+		Syntax:      `pivot <key> <value> by <field>, <field>...`,
+		Description: "Turns the records of each group into one, with a column per key holding its value",
+	})
+	registerTransform(TransformRule{
+		Keyword:     "unpivot",
+		Syntax:      `unpivot <field>, <field>... into <key> <value>`,
+		Description: "Turns a record into one per field, holding the field's name and value",
+		expand:      parseUnpivotRule,
+	})
+}
+
+// pivotGroup is one output record of a pivot rule being built
+type pivotGroup struct {
+	values []interface{}          // Values of the grouping fields
+	cells  map[string]interface{} // Value by column
+}
+
+// pivotRule holds one group per distinct value of the grouping fields until
+// the source is exhausted
+type pivotRule struct {
+	key, value string
+	groupBy    []string
+	maxColumns int
+
+	columns []string // Columns in the order their keys were first seen
+	known   map[string]bool
+	groups  map[string]*pivotGroup
+	order   []string // Group keys in the order they were first seen
+}
+
+// parsePivotRule reads a pivot rule
+func parsePivotRule(args []string, cfg interfaces.TransformConfig) (*pivotRule, error) {
+	if len(args) < 4 || !strings.EqualFold(args[2], "by") {
+		return nil, fmt.Errorf("expected a key field, a value field and the fields to group by")
+	}
+	p := &pivotRule{key: args[0], value: args[1], maxColumns: cfg.MaxPivotColumns, known: map[string]bool{}, groups: map[string]*pivotGroup{}}
+	if p.key == p.value {
+		return nil, fmt.Errorf("the key and value fields are both %s", p.key)
+	}
+	if p.maxColumns < 0 {
+		return nil, fmt.Errorf("maxpivotcolumns must not be negative")
+	}
+	if p.maxColumns == 0 {
+		p.maxColumns = DefaultMaxPivotColumns
+	}
+	for _, field := range strings.Split(strings.Join(args[3:], " "), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			return nil, fmt.Errorf("empty field in the list")
+		}
+		if field == p.key || field == p.value {
+			return nil, fmt.Errorf("%s is grouped by and pivoted", field)
+		}
+		p.groupBy = append(p.groupBy, field)
+	}
+	return p, nil
+}
+
+// add puts the record's value in its group's column. A record that cannot
+// be placed leaves every group as it was.
+func (p *pivotRule) add(rec Record) error {
+	key, ok := rec[p.key]
+	if !ok || key == nil || fmt.Sprint(key) == "" {
+		return fmt.Errorf("cannot pivot record: key field %s is missing or empty", p.key)
+	}
+	column := fmt.Sprint(key)
+	for _, field := range p.groupBy {
+		if column == field {
+			return fmt.Errorf("cannot pivot record: key %s of field %s names a field grouped by", column, p.key)
+		}
+	}
+	if !p.known[column] && len(p.columns) >= p.maxColumns {
+		return fmt.Errorf("cannot pivot record: key %s would be a new column beyond maxpivotcolumns of %d", column, p.maxColumns)
+	}
+	id, values, err := groupKey(p.groupBy, rec)
+	if err != nil {
+		return fmt.Errorf("cannot pivot record: %w", err)
+	}
+	group, ok := p.groups[id]
+	if ok {
+		if _, taken := group.cells[column]; taken {
+			return fmt.Errorf("cannot pivot record: its group already has a value for %s", column)
+		}
+	} else {
+		group = &pivotGroup{values: values, cells: map[string]interface{}{}}
+		p.groups[id] = group
+		p.order = append(p.order, id)
+	}
+	if !p.known[column] {
+		p.known[column] = true
+		p.columns = append(p.columns, column)
+	}
+	group.cells[column] = rec[p.value]
+	return nil
+}
+
+// flush emits one record per group, in the order the groups were first seen.
+// Every record has every column, null where its group had no value for it.
+func (p *pivotRule) flush() []Record {
+	records := make([]Record, 0, len(p.order))
+	for _, id := range p.order {
+		group := p.groups[id]
+		rec := make(Record, len(p.groupBy)+len(p.columns))
+		for i, field := range p.groupBy {
+			rec[field] = group.values[i]
+		}
+		for _, column := range p.columns {
+			rec[column] = group.cells[column]
+		}
+		records = append(records, rec)
+	}
+	p.groups, p.order = map[string]*pivotGroup{}, nil
+	return records
+}
+
+// parseUnpivotRule reads an unpivot rule. Missing and null fields are left
+// out, as SQL's UNPIVOT does, so a record with none of them is filtered out.
+func parseUnpivotRule(args []string, _ interfaces.TransformConfig) (expandFunc, error) {
+	into := -1
+	for i, arg := range args {
+		if strings.EqualFold(arg, "into") {
+			into = i
+		}
+	}
+	if into < 1 {
+		return nil, fmt.Errorf("expected the fields to unpivot, then into")
+	}
+	var fields []string
+	for _, field := range strings.Split(strings.Join(args[:into], " "), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			return nil, fmt.Errorf("empty field in the list")
+		}
+		fields = append(fields, field)
+	}
+	names := strings.Fields(strings.ReplaceAll(strings.Join(args[into+1:], " "), ",", " "))
+	if len(names) != 2 {
+		return nil, fmt.Errorf("expected a key field and a value field after into")
+	}
+	key, value := names[0], names[1]
+	if key == value {
+		return nil, fmt.Errorf("the key and value fields are both %s", key)
+	}
+
+	return func(rec Record) ([]Record, error) {
+		base := rec.Copy()
+		for _, field := range fields {
+			delete(base, field)
+		}
+		var records []Record
+		for _, field := range fields {
+			v, ok := rec[field]
+			if !ok || v == nil {
+				continue
+			}
+			out := base.Copy()
+			out[key] = field
+			out[value] = v
+			records = append(records, out)
+		}
+		return records, nil
+	}, nil
+}
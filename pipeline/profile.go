@@ -0,0 +1,349 @@
+package pipeline
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"hash/maphash"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+)
+
+// DefaultProfileTopValues is how many values a column's profile lists when
+// ProfilingConfig.TopValues is not set
+const DefaultProfileTopValues = 5
+
+// profileExactDistinct is how many distinct values of a column are counted
+// exactly, before the count switches to a HyperLogLog sketch
+const profileExactDistinct = 1000
+
+// profileTrackedValues is the fewest values whose counts a column keeps to
+// find its most frequent ones
+const profileTrackedValues = 100
+
+// Profile describes the columns of the records a run wrote
+type Profile struct {
+	RunID   string          `json:"run_id,omitempty"`
+	Records int             `json:"records"`
+	Columns []ColumnProfile `json:"columns"`
+}
+
+// ColumnProfile describes the values a column held. Min and max are
+// compared as numbers when every value is one, and as text otherwise.
+type ColumnProfile struct {
+	Column              string       `json:"column"`
+	Nulls               int          `json:"nulls"`                          // Records where it was null or missing
+	Distinct            int          `json:"distinct"`                       // Distinct values, null left out
+	DistinctApproximate bool         `json:"distinct_approximate,omitempty"` // Distinct was estimated, within about 2%
+	Min                 interface{}  `json:"min,omitempty"`
+	Max                 interface{}  `json:"max,omitempty"`
+	TopValues           []ValueCount `json:"top_values,omitempty"` // Most frequent values, most frequent first
+}
+
+// ValueCount is a value and how many records held it. Once a column has held
+// more distinct values than it keeps counts for, a count can be too high by
+// up to the count of the values it pushed out.
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// profiler collects the column statistics of the records the destination
+// takes, in memory bounded by the number of columns
+type profiler struct {
+	fields   map[string]bool // Columns profiled, nil for all of them
+	top      int
+	tracked  int
+	location string
+	seed     maphash.Seed
+
+	// mu guards the statistics, as batches are written at once
+	mu      sync.Mutex
+	records int
+	columns map[string]*columnStats
+}
+
+// newProfiler parses the profiling settings, and returns nil when profiling is off
+func newProfiler(cfg interfaces.ProfilingConfig) (*profiler, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if cfg.TopValues < 0 {
+		return nil, fmt.Errorf("invalid profiling topvalues %d: must not be negative", cfg.TopValues)
+	}
+	p := &profiler{top: cfg.TopValues, location: cfg.Location, seed: maphash.MakeSeed(), columns: map[string]*columnStats{}}
+	if p.top == 0 {
+		p.top = DefaultProfileTopValues
+	}
+	p.tracked = max(profileTrackedValues, 10*p.top)
+	if len(cfg.Fields) > 0 {
+		p.fields = map[string]bool{}
+		for _, field := range cfg.Fields {
+			p.fields[field] = true
+		}
+	}
+	return p, nil
+}
+
+// observe adds the records of a batch the destination took
+func (p *profiler) observe(records []Record) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.records += len(records)
+	for _, rec := range records {
+		for name, value := range rec {
+			if value == nil || name == TableField || (p.fields != nil && !p.fields[name]) {
+				continue
+			}
+			stats, ok := p.columns[name]
+			if !ok {
+				stats = &columnStats{exact: map[string]bool{}, counts: topCounts{index: map[string]int{}}}
+				p.columns[name] = stats
+			}
+			stats.add(value, p)
+		}
+	}
+}
+
+// result returns the profile, with the configured columns a run never saw
+// listed as all null, or nil when profiling is off
+func (p *profiler) result(runID string) *Profile {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	names := make([]string, 0, len(p.columns))
+	for name := range p.columns {
+		names = append(names, name)
+	}
+	for name := range p.fields {
+		if p.columns[name] == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	profile := &Profile{RunID: runID, Records: p.records, Columns: make([]ColumnProfile, len(names))}
+	for i, name := range names {
+		profile.Columns[i] = p.columns[name].profile(name, p.records, p.top)
+	}
+	return profile
+}
+
+// report stores the profile in the summary and writes it to the configured
+// file. It runs whatever the outcome, so a file that cannot be written is
+// logged instead of failing the run.
+func (p *profiler) report(summary *Summary) {
+	profile := p.result(summary.RunID)
+	if profile == nil {
+		return
+	}
+	summary.Profile = profile
+	logger.Infof("Profiled %d columns of %d records", len(profile.Columns), profile.Records)
+	if p.location == "" {
+		return
+	}
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(p.location), 0755); err == nil {
+			err = writeFileAtomic(p.location, data, 0644)
+		}
+	}
+	if err != nil {
+		logger.Infof("Failed to write the profile to %s: %v", p.location, err)
+		return
+	}
+	logger.Infof("Wrote the profile to %s", p.location)
+}
+
+// columnStats accumulates the statistics of one column. Distinct values are
+// counted exactly until there are too many to hold, then estimated.
+type columnStats struct {
+	values int
+	exact  map[string]bool
+	sketch *hyperLogLog
+	counts topCounts
+
+	numeric      bool // Every value so far was a number
+	minNumber    float64
+	maxNumber    float64
+	minNumberRaw interface{}
+	maxNumberRaw interface{}
+	minText      string
+	maxText      string
+}
+
+func (c *columnStats) add(value interface{}, p *profiler) {
+	text := rowHashText(value)
+	if c.values == 0 {
+		c.numeric = true
+		c.minNumber, c.maxNumber = math.Inf(1), math.Inf(-1)
+		c.minText, c.maxText = text, text
+	}
+	c.values++
+	if text < c.minText {
+		c.minText = text
+	}
+	if text > c.maxText {
+		c.maxText = text
+	}
+	if c.numeric {
+		if number, ok := profileNumber(value); !ok {
+			c.numeric = false
+		} else {
+			if number < c.minNumber {
+				c.minNumber, c.minNumberRaw = number, value
+			}
+			if number > c.maxNumber {
+				c.maxNumber, c.maxNumberRaw = number, value
+			}
+		}
+	}
+
+	if c.sketch != nil {
+		c.sketch.Add(text)
+	} else if !c.exact[text] {
+		c.exact[text] = true
+		if len(c.exact) > profileExactDistinct {
+			c.sketch = newHyperLogLog(p.seed)
+			for seen := range c.exact {
+				c.sketch.Add(seen)
+			}
+			c.exact = nil
+		}
+	}
+	c.counts.add(text, p.tracked)
+}
+
+// profile returns the column's statistics out of records records; a nil
+// column held only nulls
+func (c *columnStats) profile(name string, records, top int) ColumnProfile {
+	result := ColumnProfile{Column: name, Nulls: records}
+	if c == nil {
+		return result
+	}
+	result.Nulls = records - c.values
+	if c.sketch != nil {
+		result.Distinct, result.DistinctApproximate = c.sketch.Count(), true
+	} else {
+		result.Distinct = len(c.exact)
+	}
+	if c.numeric {
+		result.Min, result.Max = c.minNumberRaw, c.maxNumberRaw
+	} else {
+		result.Min, result.Max = c.minText, c.maxText
+	}
+	result.TopValues = c.counts.top(top)
+	return result
+}
+
+// profileNumber returns value as a number, if it is one or is text that reads as one
+func profileNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		number, err := v.Float64()
+		return number, err == nil
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return number, err == nil && !math.IsNaN(number) && !math.IsInf(number, 0)
+	}
+	return 0, false
+}
+
+// topCounts finds the most frequent values with the Space-Saving algorithm:
+// it keeps counts for a fixed number of values, and a value it has no count
+// for takes over the smallest one, plus one
+type topCounts struct {
+	entries []*valueEntry
+	index   map[string]int // Position of each value's entry in the heap
+}
+
+type valueEntry struct {
+	value string
+	count int
+}
+
+func (t *topCounts) add(value string, capacity int) {
+	if i, ok := t.index[value]; ok {
+		t.entries[i].count++
+		heap.Fix(t, i)
+		return
+	}
+	if len(t.entries) < capacity {
+		heap.Push(t, &valueEntry{value: value, count: 1})
+		return
+	}
+	smallest := t.entries[0]
+	delete(t.index, smallest.value)
+	smallest.value = value
+	smallest.count++
+	t.index[value] = 0
+	heap.Fix(t, 0)
+}
+
+// top returns the n values with the highest counts, ties in value order
+func (t *topCounts) top(n int) []ValueCount {
+	entries := append([]*valueEntry(nil), t.entries...)
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].count != entries[j].count {
+			return entries[i].count > entries[j].count
+		}
+		return entries[i].value < entries[j].value
+	})
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	values := make([]ValueCount, len(entries))
+	for i, entry := range entries {
+		values[i] = ValueCount{Value: entry.value, Count: entry.count}
+	}
+	return values
+}
+
+// The heap.Interface methods keep the smallest count at the root
+
+func (t *topCounts) Len() int           { return len(t.entries) }
+func (t *topCounts) Less(i, j int) bool { return t.entries[i].count < t.entries[j].count }
+func (t *topCounts) Swap(i, j int) {
+	t.entries[i], t.entries[j] = t.entries[j], t.entries[i]
+	t.index[t.entries[i].value] = i
+	t.index[t.entries[j].value] = j
+}
+func (t *topCounts) Push(x interface{}) {
+	entry := x.(*valueEntry)
+	t.index[entry.value] = len(t.entries)
+	t.entries = append(t.entries, entry)
+}
+func (t *topCounts) Pop() interface{} {
+	last := t.entries[len(t.entries)-1]
+	t.entries = t.entries[:len(t.entries)-1]
+	delete(t.index, last.value)
+	return last
+}
@@ -0,0 +1,73 @@
+package pipeline
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+// Default provenance field names
+const (
+	DefaultRunIDField      = "_run_id"
+	DefaultSourceField     = "_source"
+	DefaultIngestedAtField = "_ingested_at"
+	DefaultLocationField   = "_source_location"
+	DefaultOffsetField     = "_source_offset"
+)
+
+// provenance stamps records with the run, source and position they came from
+// before any stage sees them, so filters and joins can use the fields too
+type provenance struct {
+	fields     interfaces.ProvenanceConfig
+	runID      string
+	source     string
+	location   string
+	ingestedAt string
+}
+
+func newProvenance(cfg interfaces.ProvenanceConfig, runID, source, location string, ingestedAt time.Time) *provenance {
+	cfg.RunIDField = fieldOrDefault(cfg.RunIDField, DefaultRunIDField)
+	cfg.SourceField = fieldOrDefault(cfg.SourceField, DefaultSourceField)
+	cfg.IngestedAtField = fieldOrDefault(cfg.IngestedAtField, DefaultIngestedAtField)
+	cfg.LocationField = fieldOrDefault(cfg.LocationField, DefaultLocationField)
+	cfg.OffsetField = fieldOrDefault(cfg.OffsetField, DefaultOffsetField)
+	return &provenance{fields: cfg, runID: runID, source: source, location: location, ingestedAt: ingestedAt.UTC().Format(time.RFC3339Nano)}
+}
+
+func fieldOrDefault(name, defaultName string) string {
+	if name == "" {
+		return defaultName
+	}
+	return name
+}
+
+// stamp adds the provenance fields to the record at offset in the source's
+// data. A record that already has one of the fields is an error rather than
+// being overwritten, as the names are chosen to avoid real data.
+func (p *provenance) stamp(rec Record, offset int) error {
+	// Records from a multi-table source know their own table
+	var location interface{}
+	if p.location != "" {
+		location = p.location
+	} else if table, ok := rec[TableField].(string); ok {
+		location = table
+	}
+	values := []struct {
+		field string
+		value interface{}
+	}{
+		{p.fields.RunIDField, p.runID},
+		{p.fields.SourceField, p.source},
+		{p.fields.IngestedAtField, p.ingestedAt},
+		{p.fields.LocationField, location},
+		{p.fields.OffsetField, offset},
+	}
+	for _, v := range values {
+		if _, exists := rec[v.field]; exists {
+			return fmt.Errorf("record already has a field named %q; set another name in the provenance config", v.field)
+		}
+		rec[v.field] = v.value
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+// quarantine collects records rejected by a stage. When a location is
+// configured they are appended to it as JSON lines, one per record.
+type quarantine struct {
+	output  interfaces.QuarantineOutput
+	file    *os.File
+	encoder *json.Encoder
+}
+
+type quarantinedRecord struct {
+	Stage  string `json:"stage"`
+	Error  string `json:"error"`
+	Record Record `json:"record"`
+}
+
+func newQuarantine(cfg interfaces.ErrorHandling) *quarantine {
+	return &quarantine{output: cfg.QuarantineOutput}
+}
+
+// Add writes the rejected record to the quarantine output, if there is one
+func (q *quarantine) Add(stage string, rec Record, cause error) error {
+	if q.output.Location == "" {
+		return nil
+	}
+	if q.file == nil {
+		file, err := os.OpenFile(q.output.Location, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open quarantine output %s: %w", q.output.Location, err)
+		}
+		q.file = file
+		q.encoder = json.NewEncoder(file)
+	}
+	if err := q.encoder.Encode(quarantinedRecord{Stage: stage, Error: cause.Error(), Record: rec}); err != nil {
+		return fmt.Errorf("failed to write to quarantine output: %w", err)
+	}
+	return nil
+}
+
+// Close releases the quarantine output
+func (q *quarantine) Close() error {
+	if q.file == nil {
+		return nil
+	}
+	return q.file.Close()
+}
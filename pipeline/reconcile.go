@@ -0,0 +1,179 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+)
+
+// DefaultReconcileMaxKeys is how many keys of each kind a reconciliation
+// lists when ReconcileConfig.MaxKeys is not set
+const DefaultReconcileMaxKeys = 100
+
+// Reconciliation compares the records read with the records written, by key,
+// as audit evidence that every record read reached the destination
+type Reconciliation struct {
+	Key            string   `json:"key"`
+	KeysRead       int      `json:"keys_read"`                 // Distinct keys read
+	KeysWritten    int      `json:"keys_written"`              // Distinct keys written
+	Missing        int      `json:"missing"`                   // Keys read but never written, such as filtered or quarantined records
+	MissingKeys    []string `json:"missing_keys,omitempty"`    // The first of them, in order
+	Duplicated     int      `json:"duplicated"`                // Keys written more often than they were read
+	DuplicatedKeys []string `json:"duplicated_keys,omitempty"` // The first of them, in order
+	Unexpected     int      `json:"unexpected"`                // Keys written but never read
+	UnexpectedKeys []string `json:"unexpected_keys,omitempty"` // The first of them, in order
+	UnkeyedRead    int      `json:"unkeyed_read,omitempty"`    // Records read without a key
+	UnkeyedWritten int      `json:"unkeyed_written,omitempty"` // Records written without a key
+}
+
+// Balanced reports whether every key read was written exactly as often
+func (r *Reconciliation) Balanced() bool {
+	return r.Missing == 0 && r.Duplicated == 0 && r.Unexpected == 0 && r.UnkeyedRead == r.UnkeyedWritten
+}
+
+// reconciler counts the records read and written by key. It holds every
+// distinct key in memory, which is why reconciliation is opt-in.
+type reconciler struct {
+	key     string
+	maxKeys int
+
+	// mu guards the counts, as batches are written while pages are still read
+	mu             sync.Mutex
+	read           map[string]int
+	written        map[string]int
+	unkeyedRead    int
+	unkeyedWritten int
+}
+
+// newReconciler parses the reconciliation settings, and returns nil when no key is set
+func newReconciler(cfg interfaces.ReconcileConfig) (*reconciler, error) {
+	if cfg.MaxKeys < 0 {
+		return nil, fmt.Errorf("invalid reconcile maxkeys %d: must not be negative", cfg.MaxKeys)
+	}
+	if cfg.Key == "" {
+		if cfg.MaxKeys != 0 {
+			return nil, fmt.Errorf("reconcile maxkeys is set without a key")
+		}
+		return nil, nil
+	}
+	r := &reconciler{key: cfg.Key, maxKeys: cfg.MaxKeys, read: map[string]int{}, written: map[string]int{}}
+	if r.maxKeys == 0 {
+		r.maxKeys = DefaultReconcileMaxKeys
+	}
+	return r, nil
+}
+
+// keyOf returns the key of a record as text, so 1 read from JSON and "1"
+// written to CSV are the same key
+func (r *reconciler) keyOf(rec Record) (string, bool) {
+	value, ok := rec[r.key]
+	if !ok || value == nil {
+		return "", false
+	}
+	return fmt.Sprint(value), true
+}
+
+// observeRead counts the records of a dataset as read, rows the source could
+// not read included
+func (r *reconciler) observeRead(dataset *Dataset) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := func(rec Record) {
+		if key, ok := r.keyOf(rec); ok {
+			r.read[key]++
+		} else {
+			r.unkeyedRead++
+		}
+	}
+	for _, rec := range dataset.Records {
+		count(rec)
+	}
+	for _, rejected := range dataset.rejected {
+		count(rejected.Record)
+	}
+}
+
+// observeWritten counts the records of a batch the destination took, leaving
+// out the rows it refused
+func (r *reconciler) observeWritten(records []Record, refused []RejectedRow) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rec := range records {
+		if key, ok := r.keyOf(rec); ok {
+			r.written[key]++
+		} else {
+			r.unkeyedWritten++
+		}
+	}
+	for _, row := range refused {
+		if key, ok := r.keyOf(row.Record); ok && r.written[key] > 0 {
+			if r.written[key]--; r.written[key] == 0 {
+				delete(r.written, key)
+			}
+		} else if !ok && r.unkeyedWritten > 0 {
+			r.unkeyedWritten--
+		}
+	}
+}
+
+// result compares the counts, nil when reconciliation is off
+func (r *reconciler) result() *Reconciliation {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := &Reconciliation{
+		Key:            r.key,
+		KeysRead:       len(r.read),
+		KeysWritten:    len(r.written),
+		UnkeyedRead:    r.unkeyedRead,
+		UnkeyedWritten: r.unkeyedWritten,
+	}
+	var missing, duplicated, unexpected []string
+	for key, n := range r.read {
+		if written := r.written[key]; written == 0 {
+			missing = append(missing, key)
+		} else if written > n {
+			duplicated = append(duplicated, key)
+		}
+	}
+	for key := range r.written {
+		if r.read[key] == 0 {
+			unexpected = append(unexpected, key)
+		}
+	}
+	result.Missing, result.MissingKeys = len(missing), r.first(missing)
+	result.Duplicated, result.DuplicatedKeys = len(duplicated), r.first(duplicated)
+	result.Unexpected, result.UnexpectedKeys = len(unexpected), r.first(unexpected)
+	return result
+}
+
+// first sorts keys and returns up to maxKeys of them
+func (r *reconciler) first(keys []string) []string {
+	sort.Strings(keys)
+	if len(keys) > r.maxKeys {
+		keys = keys[:r.maxKeys]
+	}
+	return keys
+}
+
+// report stores the reconciliation in the summary and logs it
+func (r *reconciler) report(summary *Summary) {
+	result := r.result()
+	if result == nil {
+		return
+	}
+	summary.Reconciliation = result
+	logger.Infof("Reconciliation on %s: %d keys read, %d written, %d missing, %d duplicated, %d unexpected",
+		result.Key, result.KeysRead, result.KeysWritten, result.Missing, result.Duplicated, result.Unexpected)
+}
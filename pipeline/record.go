@@ -0,0 +1,297 @@
+package pipeline
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// TableField remembers which table a record came from when the source returns
+// rows grouped by table, as the PostgreSQL source does.
+const TableField = "_table"
+
+// Record is a single row of data flowing through the pipeline, keyed by field name.
+type Record map[string]interface{}
+
+// Strings renders the record's values as strings, which is what the rule
+// evaluator in the language package works with.
+func (r Record) Strings() map[string]string {
+	fields := make(map[string]string, len(r))
+	for key, value := range r {
+		if value == nil {
+			fields[key] = ""
+			continue
+		}
+		fields[key] = fmt.Sprint(value)
+	}
+	return fields
+}
+
+// Copy returns a shallow copy of the record
+func (r Record) Copy() Record {
+	c := make(Record, len(r))
+	for key, value := range r {
+		c[key] = value
+	}
+	return c
+}
+
+type shape int
+
+const (
+	shapeRaw      shape = iota // opaque payload such as a Kafka message or an FTP file
+	shapeCSV                   // header line followed by comma separated rows, as the CSV source returns
+	shapeRecords               // slice of maps, as the MongoDB, DynamoDB and Firebase sources return
+	shapeList                  // []interface{} of objects, as JSON and YAML arrays decode
+	shapeDocument              // a single object
+	shapeTables                // rows grouped by table name
+)
+
+// Dataset is the record-oriented view of whatever a DataSource returned. It
+// remembers the original shape so the records can be handed to the
+// destination in the form it expects.
+type Dataset struct {
+	Records    []Record
+	Columns    []string // Field order, when the source has one
+	NullString string   // Written for nil values in CSV output
+	shape      shape
+	raw        interface{}
+	rejected   []rejectedRecord // Rows that could not be read as records
+}
+
+// rejectedRecord is a source row the pipeline quarantines before any stage sees it
+type rejectedRecord struct {
+	Record Record
+	Err    error
+	Before int // Index of the record that followed it, so it is counted in order
+}
+
+// SourceRows is what a source returns when it read rows it could not turn
+// into records, such as spreadsheet rows with a cell whose value cannot be
+// worked out. The records flow on like a []map[string]interface{}, and the
+// rejected rows are quarantined under the source stage, whatever the error
+// strategy.
+type SourceRows struct {
+	Records  []map[string]interface{}
+	Columns  []string // Field order, such as a header row
+	Rejected []SourceReject
+}
+
+// SourceReject is a row a source could not read and why
+type SourceReject struct {
+	Row    map[string]interface{}
+	Reason string
+	Before int // How many records were read before the row, so it is counted in order
+}
+
+// NewDataset converts source data into records. Data the pipeline cannot look
+// inside is kept as-is and reported as not Structured.
+func NewDataset(data interface{}) *Dataset {
+	d := &Dataset{raw: data}
+	switch v := data.(type) {
+	case string:
+		d.fromCSV(v)
+	case map[string][]map[string]interface{}:
+		d.shape = shapeTables
+		for table, rows := range v {
+			for _, row := range rows {
+				rec := Record(row).Copy()
+				rec[TableField] = table
+				d.Records = append(d.Records, rec)
+			}
+		}
+	case *SourceRows:
+		d.shape = shapeRecords
+		d.Columns = v.Columns
+		for _, row := range v.Records {
+			d.Records = append(d.Records, Record(row).Copy())
+		}
+		for _, reject := range v.Rejected {
+			d.rejected = append(d.rejected, rejectedRecord{
+				Record: Record(reject.Row).Copy(),
+				Err:    fmt.Errorf("%w: %s", ErrQuarantine, reject.Reason),
+				Before: reject.Before,
+			})
+		}
+	case map[string]interface{}:
+		d.shape = shapeDocument
+		d.Records = []Record{Record(v).Copy()}
+	case []interface{}:
+		d.shape = shapeList
+		for _, item := range v {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				d.shape, d.Records = shapeRaw, nil
+				return d
+			}
+			d.Records = append(d.Records, Record(obj).Copy())
+		}
+	default:
+		d.fromMapSlice(data)
+	}
+	return d
+}
+
+// Structured reports whether the data could be converted into records
+func (d *Dataset) Structured() bool {
+	return d.shape != shapeRaw
+}
+
+// Data returns the records in the same shape the source produced them
+func (d *Dataset) Data() interface{} {
+	switch d.shape {
+	case shapeCSV:
+		return d.CSV(nil)
+	case shapeTables:
+		tables := make(map[string][]map[string]interface{})
+		for _, rec := range d.Records {
+			row := rec.Copy()
+			table, _ := row[TableField].(string)
+			delete(row, TableField)
+			if table == "" {
+				table = "fractal_output"
+			}
+			tables[table] = append(tables[table], row)
+		}
+		return tables
+	case shapeDocument:
+		if len(d.Records) == 1 {
+			return map[string]interface{}(d.Records[0])
+		}
+		fallthrough
+	case shapeList:
+		list := make([]interface{}, len(d.Records))
+		for i, rec := range d.Records {
+			list[i] = map[string]interface{}(rec)
+		}
+		return list
+	case shapeRecords:
+		rows := make([]map[string]interface{}, len(d.Records))
+		for i, rec := range d.Records {
+			rows[i] = rec
+		}
+		return rows
+	}
+	return d.raw
+}
+
+// withRecords returns a dataset of the same shape holding only the given records
+func (d *Dataset) withRecords(records []Record) *Dataset {
+	c := *d
+	c.Records = records
+	return &c
+}
+
+// fromMapSlice handles slices of map types such as []bson.M without
+// depending on the packages that define them.
+func (d *Dataset) fromMapSlice(data interface{}) {
+	val := reflect.ValueOf(data)
+	if val.Kind() != reflect.Slice || val.Type().Elem().Kind() != reflect.Map || val.Type().Elem().Key().Kind() != reflect.String {
+		d.shape = shapeRaw
+		return
+	}
+	d.shape = shapeRecords
+	for i := 0; i < val.Len(); i++ {
+		rec := Record{}
+		iter := val.Index(i).MapRange()
+		for iter.Next() {
+			rec[iter.Key().String()] = iter.Value().Interface()
+		}
+		d.Records = append(d.Records, rec)
+	}
+}
+
+func (d *Dataset) fromCSV(data string) {
+	lines := strings.Split(strings.TrimSpace(data), "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) == "" {
+		d.shape = shapeRaw
+		return
+	}
+	d.shape = shapeCSV
+	d.Columns = strings.Split(lines[0], ",")
+	for i := range d.Columns {
+		d.Columns[i] = strings.TrimSpace(d.Columns[i])
+	}
+	for n, line := range lines[1:] {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		// Matching fields up by position would shift data into the wrong columns
+		if len(fields) != len(d.Columns) {
+			d.rejected = append(d.rejected, rejectedRecord{
+				Record: Record{"line": n + 2, "raw": line},
+				Err:    fmt.Errorf("%w: row has %d fields, header has %d", ErrQuarantine, len(fields), len(d.Columns)),
+				Before: len(d.Records),
+			})
+			continue
+		}
+		rec := Record{}
+		for i, column := range d.Columns {
+			rec[column] = fields[i]
+		}
+		d.Records = append(d.Records, rec)
+	}
+}
+
+// CSV renders the records as a header line followed by one line per record.
+// With columns given, exactly those columns are written in that order;
+// otherwise the order is the source's column order followed by any other
+// fields, sorted alphabetically within the record they first appear in.
+func (d *Dataset) CSV(columns []string) string {
+	if len(columns) == 0 {
+		columns = d.columns()
+	}
+	lines := []string{strings.Join(columns, ",")}
+	for _, rec := range d.Records {
+		fields := make([]string, len(columns))
+		for i, column := range columns {
+			if value := rec[column]; value != nil {
+				fields[i] = fmt.Sprint(value)
+			} else {
+				fields[i] = d.NullString
+			}
+		}
+		lines = append(lines, strings.Join(fields, ","))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// OutputColumns returns the column order CSV output uses when no columns are given
+func (d *Dataset) OutputColumns() []string {
+	return d.columns()
+}
+
+// columns returns the known column order, minus columns no record carries any
+// more, followed by any fields stages added in the order they first appear.
+func (d *Dataset) columns() []string {
+	present := make(map[string]bool)
+	for _, rec := range d.Records {
+		for key := range rec {
+			present[key] = true
+		}
+	}
+	seen := make(map[string]bool)
+	var columns []string
+	for _, column := range d.Columns {
+		if !seen[column] && (present[column] || len(d.Records) == 0) {
+			seen[column] = true
+			columns = append(columns, column)
+		}
+	}
+	for _, rec := range d.Records {
+		var added []string
+		for key := range rec {
+			if !seen[key] {
+				added = append(added, key)
+			}
+		}
+		sort.Strings(added)
+		for _, key := range added {
+			seen[key] = true
+			columns = append(columns, key)
+		}
+	}
+	return columns
+}
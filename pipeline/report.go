@@ -0,0 +1,99 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/version"
+)
+
+// ReportVersion is bumped whenever a Report field is removed or changes meaning.
+// Adding fields does not change the version.
+const ReportVersion = 1
+
+// Run statuses reported in Report.Status
+const (
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+	StatusTimeout = "timeout"
+)
+
+// ExitCodeTimeout is reported for runs cancelled by their maximum duration,
+// the code the timeout command uses, so schedulers can tell them from failures
+const ExitCodeTimeout = 124
+
+// CodeTimeout is the Report.ErrorCode of a run cancelled by its maximum duration
+const CodeTimeout = "timeout"
+
+// Report is the machine-readable outcome of a run, for orchestrators and dashboards
+type Report struct {
+	Version    int       `json:"version"`
+	Fractal    string    `json:"fractal_version"`
+	Status     string    `json:"status"`
+	ExitCode   int       `json:"exit_code"`
+	Error      string    `json:"error,omitempty"`
+	ErrorCode  string    `json:"error_code,omitempty"`
+	Input      string    `json:"input"`
+	Output     string    `json:"output"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	DurationMS int64     `json:"duration_ms"`
+	Summary
+}
+
+// NewReport describes a run that started at startedAt and has just finished with err
+func NewReport(input, output string, startedAt time.Time, summary *Summary, err error) *Report {
+	finishedAt := time.Now()
+	r := &Report{
+		Version:    ReportVersion,
+		Fractal:    version.Get().Version,
+		Status:     StatusSuccess,
+		Input:      input,
+		Output:     output,
+		StartedAt:  startedAt.UTC(),
+		FinishedAt: finishedAt.UTC(),
+		DurationMS: finishedAt.Sub(startedAt).Milliseconds(),
+	}
+	if summary != nil {
+		r.Summary = *summary
+	}
+	if r.StageErrors == nil {
+		r.StageErrors = map[string]int{}
+	}
+	if err != nil {
+		r.Status = StatusFailure
+		r.ExitCode = 1
+		r.Error = err.Error()
+		r.ErrorCode = interfaces.ErrorCode(err)
+		if errors.Is(err, ErrEmptyInput) {
+			r.ErrorCode = CodeEmptyInput
+		}
+		if errors.Is(err, ErrTimeout) {
+			r.Status = StatusTimeout
+			r.ExitCode = ExitCodeTimeout
+			r.ErrorCode = CodeTimeout
+		}
+	}
+	return r
+}
+
+// JSON renders the report on a single line
+func (r *Report) JSON() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// WriteFile replaces the file at path with the report. The report is written
+// to a temporary file first so readers never see a partial one.
+func (r *Report) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode run report: %w", err)
+	}
+	if err := writeFileAtomic(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write run report: %w", err)
+	}
+	return nil
+}
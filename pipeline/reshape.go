@@ -0,0 +1,211 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+var (
+	splitPattern = regexp.MustCompile(`^split\s+(\S+)\s+by\s+(?:"([^"]*)"|'([^']*)')\s+into\s+(.+)$`)
+	mergePattern = regexp.MustCompile(`^merge\s+(.+?)\s+into\s+(\S+)\s+with\s+(?:"([^"]*)"|'([^']*)')$`)
+)
+
+// reshapeRules describes the split and merge rules for the rules command
+var reshapeRules = []RuleInfo{
+	{Kind: RuleTransformation, Stage: "reshape", Keyword: "merge", Syntax: `merge a,b,... into <field> with "<sep>"`, Description: "Joins fields into one, skipping null and missing ones"},
+	{Kind: RuleTransformation, Stage: "reshape", Keyword: "split", Syntax: `split <field> by "<sep>" into a,b,...`, Description: "Writes the parts of a field into several fields"},
+}
+
+// reshapeRule is one split or merge. A split reads fields[0] and writes into
+// targets; a merge reads fields and writes into targets[0].
+type reshapeRule struct {
+	merge     bool
+	fields    []string
+	targets   []string
+	separator string
+}
+
+// ReshapeStage splits one field into several and merges several fields into
+// one, applying its rules to each record in order. The fields read are kept;
+// select can drop them.
+type ReshapeStage struct {
+	rules        []reshapeRule
+	missingParts string
+	extraParts   string
+}
+
+// NewReshapeStage parses the split and merge rules
+func NewReshapeStage(cfg interfaces.ReshapeConfig) (*ReshapeStage, error) {
+	r := &ReshapeStage{missingParts: cfg.MissingParts, extraParts: cfg.ExtraParts}
+	if r.missingParts == "" {
+		r.missingParts = "null"
+	}
+	if r.extraParts == "" {
+		r.extraParts = "join"
+	}
+	if r.missingParts != "null" && r.missingParts != "empty" && r.missingParts != "error" {
+		return nil, fmt.Errorf("invalid reshape missingparts %q: expected null, empty or error", cfg.MissingParts)
+	}
+	if r.extraParts != "join" && r.extraParts != "drop" && r.extraParts != "error" {
+		return nil, fmt.Errorf("invalid reshape extraparts %q: expected join, drop or error", cfg.ExtraParts)
+	}
+	for _, spec := range cfg.Rules {
+		spec = strings.TrimSpace(spec)
+		if match := splitPattern.FindStringSubmatch(spec); match != nil {
+			rule := reshapeRule{fields: []string{match[1]}, targets: fieldList(match[4]), separator: match[2] + match[3]}
+			if rule.separator == "" {
+				return nil, fmt.Errorf("invalid reshape rule %q: the separator must not be empty", spec)
+			}
+			if len(rule.targets) == 0 {
+				return nil, fmt.Errorf("invalid reshape rule %q: expected fields to split into", spec)
+			}
+			r.rules = append(r.rules, rule)
+			continue
+		}
+		if match := mergePattern.FindStringSubmatch(spec); match != nil {
+			rule := reshapeRule{merge: true, fields: fieldList(match[1]), targets: []string{match[2]}, separator: match[3] + match[4]}
+			if len(rule.fields) == 0 {
+				return nil, fmt.Errorf("invalid reshape rule %q: expected fields to merge", spec)
+			}
+			r.rules = append(r.rules, rule)
+			continue
+		}
+		return nil, fmt.Errorf("invalid reshape rule %q: expected %s or %s", spec, reshapeRules[1].Syntax, reshapeRules[0].Syntax)
+	}
+	return r, nil
+}
+
+// fieldList splits a comma-separated list of field names, dropping empty entries
+func fieldList(list string) []string {
+	var fields []string
+	for _, field := range strings.Split(list, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// Name returns the stage name
+func (r *ReshapeStage) Name() string {
+	return "reshape"
+}
+
+// Process applies every rule to the record
+func (r *ReshapeStage) Process(rec Record) ([]Record, error) {
+	for _, rule := range r.rules {
+		if rule.merge {
+			r.mergeFields(rec, rule)
+			continue
+		}
+		if err := r.splitField(rec, rule); err != nil {
+			return nil, err
+		}
+	}
+	return []Record{rec}, nil
+}
+
+// splitField writes the parts of the field into the targets. A null or
+// missing field sets every target to null.
+func (r *ReshapeStage) splitField(rec Record, rule reshapeRule) error {
+	value, ok := rec[rule.fields[0]]
+	if !ok || value == nil {
+		for _, target := range rule.targets {
+			rec[target] = nil
+		}
+		return nil
+	}
+	text := fmt.Sprint(value)
+	var parts []string
+	if r.extraParts == "join" {
+		// The last target keeps the remainder, separators included
+		parts = strings.SplitN(text, rule.separator, len(rule.targets))
+	} else {
+		parts = strings.Split(text, rule.separator)
+	}
+	if len(parts) > len(rule.targets) {
+		if r.extraParts == "error" {
+			return fmt.Errorf("cannot split field %s: %d parts for %d fields", rule.fields[0], len(parts), len(rule.targets))
+		}
+		parts = parts[:len(rule.targets)]
+	}
+	if len(parts) < len(rule.targets) && r.missingParts == "error" {
+		return fmt.Errorf("cannot split field %s: %d parts for %d fields", rule.fields[0], len(parts), len(rule.targets))
+	}
+	for i, target := range rule.targets {
+		switch {
+		case i < len(parts):
+			rec[target] = parts[i]
+		case r.missingParts == "empty":
+			rec[target] = ""
+		default:
+			rec[target] = nil
+		}
+	}
+	return nil
+}
+
+// mergeFields joins the fields into the target, skipping null and missing
+// ones. The target is null when all of them are.
+func (r *ReshapeStage) mergeFields(rec Record, rule reshapeRule) {
+	var parts []string
+	for _, field := range rule.fields {
+		if value, ok := rec[field]; ok && value != nil {
+			parts = append(parts, fmt.Sprint(value))
+		}
+	}
+	if len(parts) == 0 {
+		rec[rule.targets[0]] = nil
+		return
+	}
+	rec[rule.targets[0]] = strings.Join(parts, rule.separator)
+}
+
+// Flush has nothing to emit, reshaping doesn't buffer
+func (r *ReshapeStage) Flush() ([]Record, error) {
+	return nil, nil
+}
+
+// Columns puts the fields a split writes after the field it reads, and the
+// field a merge writes after the last field it reads
+func (r *ReshapeStage) Columns(previous []string) []string {
+	columns := previous
+	for _, rule := range r.rules {
+		anchor := rule.fields[len(rule.fields)-1]
+		columns = insertColumns(columns, anchor, rule.targets)
+	}
+	return columns
+}
+
+// insertColumns places added right after anchor, or at the end when anchor is
+// not a column. Columns already present keep their place.
+func insertColumns(columns []string, anchor string, added []string) []string {
+	existing := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		existing[column] = true
+	}
+	var fresh []string
+	for _, column := range added {
+		if !existing[column] {
+			existing[column] = true
+			fresh = append(fresh, column)
+		}
+	}
+	if len(fresh) == 0 || len(columns) == 0 {
+		return columns
+	}
+	at := len(columns)
+	for i, column := range columns {
+		if column == anchor {
+			at = i + 1
+			break
+		}
+	}
+	result := make([]string, 0, len(columns)+len(fresh))
+	result = append(result, columns[:at]...)
+	result = append(result, fresh...)
+	return append(result, columns[at:]...)
+}
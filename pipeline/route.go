@@ -0,0 +1,226 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+)
+
+// DefaultMaxTargets caps the targets one run routes records to when
+// DeliveryConfig.MaxTargets is not set
+const DefaultMaxTargets = 64
+
+// RouteStageName names the stage resolving each record's target, in logs,
+// stage errors and quarantine entries
+const RouteStageName = "route"
+
+// targetField carries the target a record is routed to from the route stage
+// to the delivery, which removes it before writing
+const targetField = "_target"
+
+// outputIndexField is the placeholder file destinations replace with the
+// number of the output file, so it does not name a record field
+const outputIndexField = "index"
+
+// targetTemplate is a target name with {field} placeholders
+type targetTemplate struct {
+	text   string
+	parts  []string // Literal text and field names, alternating, starting with text
+	fields []string
+}
+
+// parseTargetTemplate reads a target name, returning nil when it names no fields
+func parseTargetTemplate(text string) (*targetTemplate, error) {
+	if !strings.ContainsAny(text, "{}") {
+		return nil, nil
+	}
+	t := &targetTemplate{text: text}
+	rest, literal := text, ""
+	for {
+		open := strings.IndexByte(rest, '{')
+		if close := strings.IndexByte(rest, '}'); close >= 0 && (open < 0 || close < open) {
+			return nil, fmt.Errorf("invalid target %q: } without {", text)
+		}
+		if open < 0 {
+			if len(t.fields) == 0 {
+				return nil, nil
+			}
+			t.parts = append(t.parts, literal+rest)
+			return t, nil
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid target %q: { without }", text)
+		}
+		field := strings.TrimSpace(rest[open+1 : open+end])
+		if field == "" || strings.Contains(field, "{") {
+			return nil, fmt.Errorf("invalid target %q: expected a field name between { and }", text)
+		}
+		if field == outputIndexField {
+			literal += rest[:open+end+1]
+		} else {
+			t.parts = append(t.parts, literal+rest[:open], field)
+			t.fields = append(t.fields, field)
+			literal = ""
+		}
+		rest = rest[open+end+1:]
+	}
+}
+
+// resolve returns the target named by the record's fields. Values are limited
+// to letters, digits, _ and -, so a record cannot name a table, topic or file
+// outside the template.
+func (t *targetTemplate) resolve(rec Record) (string, error) {
+	var b strings.Builder
+	for i, part := range t.parts {
+		if i%2 == 0 {
+			b.WriteString(part)
+			continue
+		}
+		value, ok := rec[part]
+		if !ok || value == nil || fmt.Sprint(value) == "" {
+			return "", fmt.Errorf("field %s of target %s is missing or empty", part, t.text)
+		}
+		text := fmt.Sprint(value)
+		for _, r := range text {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+				return "", fmt.Errorf("field %s of target %s holds %q, expected letters, digits, _ and - only", part, t.text, text)
+			}
+		}
+		b.WriteString(text)
+	}
+	return b.String(), nil
+}
+
+// RouteStage stores in each record the target its fields name. It is not
+// listed in stages: the pipeline runs it after all of them whenever the
+// destination's target is a template.
+type RouteStage struct {
+	template *targetTemplate
+	max      int
+	targets  map[string]bool
+}
+
+// newRouteStage reads the destination's target, returning nil when the
+// destination has a single target
+func newRouteStage(destination interfaces.DataDestination, req interfaces.Request, max int) (*RouteStage, error) {
+	router, ok := destination.(interfaces.Router)
+	if !ok {
+		return nil, nil
+	}
+	template, err := parseTargetTemplate(router.Target(req))
+	if err != nil || template == nil {
+		return nil, err
+	}
+	if max < 0 {
+		return nil, fmt.Errorf("maxtargets must not be negative")
+	}
+	if max == 0 {
+		max = DefaultMaxTargets
+	}
+	return &RouteStage{template: template, max: max, targets: map[string]bool{}}, nil
+}
+
+// Name returns the stage name
+func (s *RouteStage) Name() string {
+	return RouteStageName
+}
+
+// Process resolves the record's target. A record naming a target beyond the
+// cap is rejected, so a field with more values than expected cannot open a
+// table or file for each of them.
+func (s *RouteStage) Process(rec Record) ([]Record, error) {
+	target, err := s.template.resolve(rec)
+	if err != nil {
+		return nil, interfaces.Wrap(interfaces.ErrValidation, fmt.Errorf("cannot route record: %w", err))
+	}
+	if !s.targets[target] {
+		if len(s.targets) >= s.max {
+			return nil, interfaces.Wrap(interfaces.ErrValidation, fmt.Errorf("cannot route record to %s: the run already writes to maxtargets of %d targets", target, s.max))
+		}
+		s.targets[target] = true
+	}
+	rec[targetField] = target
+	return []Record{rec}, nil
+}
+
+// Flush has nothing to emit
+func (s *RouteStage) Flush() ([]Record, error) {
+	return nil, nil
+}
+
+// routedTarget is one resolved target the delivery writes to, with its own
+// request and output parts
+type routedTarget struct {
+	name       string
+	req        interfaces.Request
+	parts      *outputParts
+	dispatched int
+}
+
+// routes holds the targets a delivery has written to, in the order they were
+// first seen
+type routes struct {
+	router  interfaces.Router
+	targets map[string]*routedTarget
+	order   []*routedTarget
+}
+
+// route splits a batch by target, preparing each target the first time
+// records go to it. The target field is removed from the records.
+func (d *delivery) route(ctx context.Context, dest interfaces.DataDestination, req interfaces.Request, batch []Record) ([]*routedTarget, map[string][]Record, error) {
+	var targets []*routedTarget
+	groups := make(map[string][]Record)
+	for _, rec := range batch {
+		name, _ := rec[targetField].(string)
+		rec = rec.Copy()
+		delete(rec, targetField)
+		if _, ok := groups[name]; !ok {
+			target, err := d.openTarget(ctx, dest, req, name)
+			if err != nil {
+				return nil, nil, err
+			}
+			targets = append(targets, target)
+		}
+		groups[name] = append(groups[name], rec)
+	}
+	return targets, groups, nil
+}
+
+// openTarget returns the named target, preparing the destination for it the
+// first time it is named
+func (d *delivery) openTarget(ctx context.Context, dest interfaces.DataDestination, req interfaces.Request, name string) (*routedTarget, error) {
+	if target, ok := d.routes.targets[name]; ok {
+		return target, nil
+	}
+	target := &routedTarget{name: name, req: d.routes.router.WithTarget(req, name)}
+	if d.parts != nil {
+		parts := *d.parts
+		target.parts = &parts
+	}
+	if preparer, ok := dest.(interfaces.Preparer); ok {
+		if err := untilDone(ctx, func() error { return preparer.Prepare(target.req) }); err != nil {
+			return nil, fmt.Errorf("failed to prepare the destination for %s: %w", name, err)
+		}
+	}
+	logger.Infof("Routing records to %s", name)
+	d.routes.targets[name] = target
+	d.routes.order = append(d.routes.order, target)
+	return target, nil
+}
+
+// finishRequests returns the requests the destination finishes once the run
+// has written everything: one per target when records are routed
+func (d *delivery) finishRequests(req interfaces.Request) []interfaces.Request {
+	if d == nil || d.routes == nil {
+		return []interfaces.Request{req}
+	}
+	requests := make([]interfaces.Request, len(d.routes.order))
+	for i, target := range d.routes.order {
+		requests[i] = target.req
+	}
+	return requests
+}
@@ -0,0 +1,115 @@
+package pipeline
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+// rowHashEscaper escapes the characters that separate the fields and their
+// values in the text a row hash hashes, so no value can pass for two fields
+var rowHashEscaper = strings.NewReplacer(`\`, `\\`, "|", `\|`, "=", `\=`)
+
+func init() {
+	registerTransform(TransformRule{
+		Keyword:     "rowhash",
+		Syntax:      `rowhash <target> [exclude <field>, <field>...] [using <algorithm>]`,
+		Description: "Stores a hash of all the record's fields but the excluded ones in target, to tell changed records from unchanged ones",
+		parse:       parseRowHashRule,
+	})
+}
+
+// RowHash returns the hex hash of the record's fields but the excluded ones,
+// in name order. Null fields are left out like missing ones, so a new column
+// that is still null leaves the hashes as they were.
+func RowHash(rec Record, exclude map[string]bool, algorithm string) (string, error) {
+	newHash, err := hashAlgorithm(algorithm)
+	if err != nil {
+		return "", err
+	}
+	return rowHash(rec, exclude, newHash()), nil
+}
+
+// rowHash hashes the record into h, as RowHash describes
+func rowHash(rec Record, exclude map[string]bool, h hash.Hash) string {
+	names := make([]string, 0, len(rec))
+	for name, value := range rec {
+		if value != nil && !exclude[name] && name != TableField {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = rowHashEscaper.Replace(name) + "=" + rowHashEscaper.Replace(rowHashText(rec[name]))
+	}
+	h.Write([]byte(strings.Join(parts, "|")))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// rowHashText returns the text a value is hashed as. Scalars are hashed as
+// text, so 42 read from a CSV file and 42 read from a database hash alike;
+// nested objects and lists as JSON, whose object keys are sorted.
+func rowHashText(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}, Record, []interface{}, []map[string]interface{}:
+		if encoded, err := json.Marshal(value); err == nil {
+			return string(encoded)
+		}
+	}
+	return fmt.Sprint(value)
+}
+
+// parseRowHashRule reads a rowhash rule. The algorithm is sha256 unless the
+// rule says otherwise, and the target is never part of its own hash.
+func parseRowHashRule(args []string, _ interfaces.TransformConfig) (transformFunc, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing the target field")
+	}
+	target := args[0]
+	exclude := map[string]bool{target: true}
+	algorithm := "sha256"
+	options := args[1:]
+	for len(options) > 0 {
+		switch strings.ToLower(options[0]) {
+		case "exclude":
+			end := 1
+			for end < len(options) && !strings.EqualFold(options[end], "using") {
+				end++
+			}
+			if end == 1 {
+				return nil, fmt.Errorf("missing the fields to exclude")
+			}
+			for _, field := range strings.Split(strings.Join(options[1:end], " "), ",") {
+				field = strings.TrimSpace(field)
+				if field == "" {
+					return nil, fmt.Errorf("empty field in the list to exclude")
+				}
+				exclude[field] = true
+			}
+			options = options[end:]
+		case "using":
+			if len(options) < 2 {
+				return nil, fmt.Errorf("missing the hash algorithm")
+			}
+			algorithm = options[1]
+			options = options[2:]
+		default:
+			return nil, fmt.Errorf("unknown option %s", options[0])
+		}
+	}
+	newHash, err := hashAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(rec Record) error {
+		rec[target] = rowHash(rec, exclude, newHash())
+		return nil
+	}, nil
+}
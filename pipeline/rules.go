@@ -0,0 +1,36 @@
+package pipeline
+
+import (
+	"github.com/SkySingh04/fractal/language"
+)
+
+// Rule kinds
+const (
+	RuleValidation     = "validation"
+	RuleTransformation = "transformation"
+)
+
+// RuleInfo describes a rule keyword: what kind of rule it is, the config
+// section it is written in, how to write it and what it does
+type RuleInfo struct {
+	Kind        string `json:"kind"`
+	Stage       string `json:"stage"`
+	Keyword     string `json:"keyword"`
+	Syntax      string `json:"syntax"`
+	Description string `json:"description"`
+}
+
+// Rules lists every validation and transformation rule keyword, built from
+// the registered conditions and transformations, in stage order
+func Rules() []RuleInfo {
+	var rules []RuleInfo
+	for _, c := range language.Conditions() {
+		rules = append(rules, RuleInfo{Kind: RuleValidation, Stage: "validate", Keyword: c.Keyword, Syntax: c.Syntax, Description: c.Description})
+	}
+	rules = append(rules, inSourceRuleInfo, isPhoneRuleInfo)
+	rules = append(rules, reshapeRules...)
+	for _, t := range TransformRules() {
+		rules = append(rules, RuleInfo{Kind: RuleTransformation, Stage: "transform", Keyword: t.Keyword, Syntax: t.Syntax, Description: t.Description})
+	}
+	return rules
+}
@@ -0,0 +1,270 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+)
+
+// Schema change policies
+const (
+	SchemaChangeFail  = "fail"
+	SchemaChangeWarn  = "warn"
+	SchemaChangeAdapt = "adapt"
+)
+
+// schemaTypes are the field types an expected schema can name
+var schemaTypes = map[string]bool{
+	"string": true, "int": true, "float": true, "bool": true,
+	"timestamp": true, "object": true, "array": true, "any": true,
+}
+
+// SchemaDiff is how the records of a run differ from the expected schema
+type SchemaDiff struct {
+	Added   []string      `json:"added,omitempty"`   // Fields the records carry that the schema doesn't name
+	Removed []string      `json:"removed,omitempty"` // Schema fields no record carries
+	Changed []FieldChange `json:"changed,omitempty"` // Fields holding values of another type
+}
+
+// FieldChange is a field whose values don't fit the expected type
+type FieldChange struct {
+	Field    string `json:"field"`
+	Expected string `json:"expected"`
+	Found    string `json:"found"`
+}
+
+// Empty reports whether the records match the schema
+func (d *SchemaDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+func (d *SchemaDiff) String() string {
+	var parts []string
+	if len(d.Added) > 0 {
+		parts = append(parts, "added "+strings.Join(d.Added, ", "))
+	}
+	if len(d.Removed) > 0 {
+		parts = append(parts, "removed "+strings.Join(d.Removed, ", "))
+	}
+	for _, c := range d.Changed {
+		parts = append(parts, fmt.Sprintf("%s is %s, expected %s", c.Field, c.Found, c.Expected))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// schemaField is one name:type entry of an expected schema
+type schemaField struct {
+	name     string
+	typeName string
+}
+
+// expectedSchema is a parsed SchemaConfig
+type expectedSchema struct {
+	fields   []schemaField
+	onChange string
+}
+
+// newExpectedSchema parses the expected schema, and returns nil when none is set
+func newExpectedSchema(cfg interfaces.SchemaConfig) (*expectedSchema, error) {
+	onChange := strings.ToLower(strings.TrimSpace(cfg.OnChange))
+	if onChange == "" {
+		onChange = SchemaChangeFail
+	}
+	if onChange != SchemaChangeFail && onChange != SchemaChangeWarn && onChange != SchemaChangeAdapt {
+		return nil, fmt.Errorf("invalid schema onchange %q: expected %s, %s or %s", cfg.OnChange, SchemaChangeFail, SchemaChangeWarn, SchemaChangeAdapt)
+	}
+	if len(cfg.Fields) == 0 {
+		return nil, nil
+	}
+	s := &expectedSchema{onChange: onChange}
+	seen := make(map[string]bool, len(cfg.Fields))
+	for _, entry := range cfg.Fields {
+		name, typeName, ok := strings.Cut(entry, ":")
+		name, typeName = strings.TrimSpace(name), strings.ToLower(strings.TrimSpace(typeName))
+		if !ok || name == "" || !schemaTypes[typeName] {
+			return nil, fmt.Errorf("invalid schema field %q, expected name:type with a supported type", entry)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("schema field %s is listed twice", name)
+		}
+		seen[name] = true
+		s.fields = append(s.fields, schemaField{name: name, typeName: typeName})
+	}
+	return s, nil
+}
+
+// compare returns how the dataset differs from the schema. A source that
+// returned nothing, not even a header, is taken to match.
+func (s *expectedSchema) compare(dataset *Dataset) *SchemaDiff {
+	diff := &SchemaDiff{}
+	present := make(map[string]bool)
+	for _, column := range dataset.Columns {
+		present[column] = true
+	}
+	for _, rec := range dataset.Records {
+		for field := range rec {
+			if field != TableField {
+				present[field] = true
+			}
+		}
+	}
+	if len(present) == 0 {
+		return diff
+	}
+
+	expected := make(map[string]bool, len(s.fields))
+	for _, field := range s.fields {
+		expected[field.name] = true
+		if !present[field.name] {
+			diff.Removed = append(diff.Removed, field.name)
+			continue
+		}
+		for _, rec := range dataset.Records {
+			if value := rec[field.name]; !fitsSchemaType(value, field.typeName) {
+				diff.Changed = append(diff.Changed, FieldChange{Field: field.name, Expected: field.typeName, Found: schemaTypeOf(value)})
+				break
+			}
+		}
+	}
+	for field := range present {
+		if !expected[field] {
+			diff.Added = append(diff.Added, field)
+		}
+	}
+	sort.Strings(diff.Added)
+	return diff
+}
+
+// check compares the dataset with the schema and applies the policy. Adapting
+// drops the added fields and fills the removed ones with null; a changed type
+// cannot be adapted without losing values, so it fails the run.
+func (s *expectedSchema) check(dataset *Dataset, summary *Summary) error {
+	if s == nil {
+		return nil
+	}
+	diff := s.compare(dataset)
+	if diff.Empty() {
+		return nil
+	}
+	summary.SchemaDiff = diff
+	switch {
+	case s.onChange == SchemaChangeWarn:
+		logger.Infof("Source schema changed, continuing: %s", diff)
+		return nil
+	case s.onChange == SchemaChangeAdapt && len(diff.Changed) == 0:
+		logger.Infof("Source schema changed, adapting the records: %s", diff)
+		s.adapt(dataset, diff)
+		return nil
+	}
+	return interfaces.Wrap(interfaces.ErrValidation, fmt.Errorf("source schema changed: %s", diff))
+}
+
+// adapt reshapes the records to the schema
+func (s *expectedSchema) adapt(dataset *Dataset, diff *SchemaDiff) {
+	for _, rec := range dataset.Records {
+		for _, field := range diff.Added {
+			delete(rec, field)
+		}
+		for _, field := range diff.Removed {
+			rec[field] = nil
+		}
+	}
+	var columns []string
+	for _, field := range s.fields {
+		columns = append(columns, field.name)
+	}
+	if len(dataset.Columns) > 0 {
+		dataset.Columns = columns
+	}
+}
+
+// fitsSchemaType reports whether a value can be read as the type. Nulls and
+// empty text fit every type, and text fits the types it parses as, since file
+// sources deliver every value as a string.
+func fitsSchemaType(value interface{}, typeName string) bool {
+	if value == nil || typeName == "any" {
+		return true
+	}
+	text, isText := value.(string)
+	text = strings.TrimSpace(text)
+	if isText && text == "" {
+		return true
+	}
+	switch typeName {
+	case "string":
+		return isText
+	case "int":
+		if isText {
+			_, err := strconv.ParseInt(text, 10, 64)
+			return err == nil
+		}
+		switch schemaTypeOf(value) {
+		case "int":
+			return true
+		case "float":
+			// JSON numbers are decoded as floats, so whole ones are integers
+			n, ok := toFloat(value)
+			return ok && n == math.Trunc(n)
+		}
+		return false
+	case "float":
+		if isText {
+			_, err := strconv.ParseFloat(text, 64)
+			return err == nil
+		}
+		t := schemaTypeOf(value)
+		return t == "int" || t == "float"
+	case "bool":
+		if isText {
+			_, err := strconv.ParseBool(text)
+			return err == nil
+		}
+		return schemaTypeOf(value) == "bool"
+	case "timestamp":
+		if isText {
+			for _, layout := range []string{time.RFC3339Nano, time.DateTime, time.DateOnly} {
+				if _, err := time.Parse(layout, text); err == nil {
+					return true
+				}
+			}
+			return false
+		}
+		return schemaTypeOf(value) == "timestamp"
+	}
+	return schemaTypeOf(value) == typeName
+}
+
+// schemaTypeOf names the type of a value
+func schemaTypeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "int"
+	case float32, float64:
+		return "float"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "int"
+		}
+		return "float"
+	case time.Time:
+		return "timestamp"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,85 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+// SelectStage keeps only the listed fields, in the listed order, or discards
+// the excluded ones. Selecting a field a record doesn't have is a record error.
+type SelectStage struct {
+	fields  []string
+	exclude map[string]bool
+}
+
+// NewSelectStage checks the field selection
+func NewSelectStage(cfg interfaces.SelectConfig) (*SelectStage, error) {
+	if len(cfg.Fields) > 0 && len(cfg.Exclude) > 0 {
+		return nil, errors.New("select takes either fields or exclude, not both")
+	}
+	s := &SelectStage{fields: cfg.Fields}
+	seen := make(map[string]bool)
+	for _, field := range cfg.Fields {
+		if seen[field] {
+			return nil, fmt.Errorf("field %s is selected more than once", field)
+		}
+		seen[field] = true
+	}
+	if len(cfg.Exclude) > 0 {
+		s.exclude = make(map[string]bool, len(cfg.Exclude))
+		for _, field := range cfg.Exclude {
+			s.exclude[field] = true
+		}
+	}
+	return s, nil
+}
+
+// Name returns the stage name
+func (s *SelectStage) Name() string {
+	return "select"
+}
+
+// Process returns the record with only the selected fields
+func (s *SelectStage) Process(rec Record) ([]Record, error) {
+	if s.exclude != nil {
+		for field := range s.exclude {
+			delete(rec, field)
+		}
+		return []Record{rec}, nil
+	}
+
+	selected := make(Record, len(s.fields))
+	for _, field := range s.fields {
+		value, ok := rec[field]
+		if !ok {
+			return nil, fmt.Errorf("selected field %s is missing", field)
+		}
+		selected[field] = value
+	}
+	// Keep track of the table rows came from, so the destination can still group them
+	if table, ok := rec[TableField]; ok {
+		selected[TableField] = table
+	}
+	return []Record{selected}, nil
+}
+
+// Flush has nothing to emit, selecting doesn't buffer
+func (s *SelectStage) Flush() ([]Record, error) {
+	return nil, nil
+}
+
+// Columns puts the selected fields first, in the order they were listed
+func (s *SelectStage) Columns(previous []string) []string {
+	if s.exclude == nil {
+		return s.fields
+	}
+	var columns []string
+	for _, column := range previous {
+		if !s.exclude[column] {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
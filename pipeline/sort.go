@@ -0,0 +1,335 @@
+package pipeline
+
+import (
+	"bufio"
+	"cmp"
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+)
+
+// sortEmitBatch is how many records a sort stage reading back its spill files
+// passes on at a time
+const sortEmitBatch = 1000
+
+// sortTimeLayouts are the layouts text is read as a time in, so timestamps
+// with different offsets sort by the instant they stand for
+var sortTimeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999", "2006-01-02"}
+
+// Kinds of sort value, in the order they sort in: numbers before times
+// before other values, and nulls last
+const (
+	sortNumber = iota
+	sortTime
+	sortText
+	sortNull
+)
+
+type sortField struct {
+	name       string
+	descending bool
+}
+
+// sortValue is a field's value as it is compared
+type sortValue struct {
+	kind   int
+	number float64
+	time   time.Time
+	text   string
+}
+
+// sortEntry is a record and the values it sorts by
+type sortEntry struct {
+	rec Record
+	key []sortValue
+}
+
+// SortStage orders the records by the configured fields once the source is
+// exhausted. It holds every record in memory; with MaxRecords set it spills
+// sorted runs to disk and merges them at the end instead. Records that sort
+// the same keep the order they came in.
+type SortStage struct {
+	fields     []sortField
+	maxRecords int
+	spillDir   string
+
+	entries []sortEntry
+	spills  []string
+}
+
+// NewSortStage parses the sort settings
+func NewSortStage(cfg interfaces.SortConfig) (*SortStage, error) {
+	if cfg.MaxRecords < 0 {
+		return nil, fmt.Errorf("invalid sort maxrecords %d: must not be negative", cfg.MaxRecords)
+	}
+	s := &SortStage{maxRecords: cfg.MaxRecords, spillDir: cfg.SpillDir}
+	for _, spec := range cfg.By {
+		words := strings.Fields(spec)
+		if len(words) == 0 || len(words) > 2 {
+			return nil, fmt.Errorf("invalid sort field %q: expected a field and an optional asc or desc", spec)
+		}
+		field := sortField{name: words[0]}
+		if len(words) == 2 {
+			switch strings.ToLower(words[1]) {
+			case "asc":
+			case "desc":
+				field.descending = true
+			default:
+				return nil, fmt.Errorf("invalid sort field %q: unknown direction %s", spec, words[1])
+			}
+		}
+		s.fields = append(s.fields, field)
+	}
+	if len(s.fields) == 0 {
+		return nil, errors.New("sort needs at least one field to sort by")
+	}
+	return s, nil
+}
+
+// Name returns the stage name
+func (s *SortStage) Name() string {
+	return "sort"
+}
+
+// Process holds the record. Nothing is emitted until Flush.
+func (s *SortStage) Process(rec Record) ([]Record, error) {
+	if s.maxRecords > 0 && len(s.entries) >= s.maxRecords {
+		if err := s.spill(); err != nil {
+			return nil, err
+		}
+	}
+	s.entries = append(s.entries, sortEntry{rec: rec, key: s.key(rec)})
+	return nil, nil
+}
+
+// Flush emits the records in order
+func (s *SortStage) Flush() ([]Record, error) {
+	var records []Record
+	err := s.FlushTo(func(batch []Record) error {
+		records = append(records, batch...)
+		return nil
+	})
+	return records, err
+}
+
+// FlushTo passes the records on in order. Once runs were spilled, they are
+// merged and passed on a batch at a time, so memory holds a record per run
+// and a batch.
+func (s *SortStage) FlushTo(emit func([]Record) error) error {
+	defer s.Close()
+
+	if len(s.spills) == 0 {
+		s.sortEntries()
+		records := make([]Record, len(s.entries))
+		for i, entry := range s.entries {
+			records[i] = entry.rec
+		}
+		s.entries = nil
+		return emit(records)
+	}
+	if err := s.spill(); err != nil {
+		return err
+	}
+	return s.merge(emit)
+}
+
+// Close removes any spill files left behind
+func (s *SortStage) Close() error {
+	var errs []error
+	for _, path := range s.spills {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	s.spills = nil
+	return errors.Join(errs...)
+}
+
+// key reads the values a record sorts by
+func (s *SortStage) key(rec Record) []sortValue {
+	key := make([]sortValue, len(s.fields))
+	for i, field := range s.fields {
+		key[i] = newSortValue(rec[field.name])
+	}
+	return key
+}
+
+// newSortValue reads a value as a number when it is one, numeric text
+// included, as a time when it is one or text in an RFC 3339 or ISO 8601
+// layout, and as text otherwise
+func newSortValue(value interface{}) sortValue {
+	switch v := value.(type) {
+	case nil:
+		return sortValue{kind: sortNull}
+	case time.Time:
+		return sortValue{kind: sortTime, time: v}
+	}
+	if number, ok := toFloat(value); ok && !math.IsNaN(number) {
+		return sortValue{kind: sortNumber, number: number}
+	}
+	text := fmt.Sprint(value)
+	if t, ok := value.(string); ok {
+		t = strings.TrimSpace(t)
+		for _, layout := range sortTimeLayouts {
+			if parsed, err := time.Parse(layout, t); err == nil {
+				return sortValue{kind: sortTime, time: parsed}
+			}
+		}
+	}
+	return sortValue{kind: sortText, text: text}
+}
+
+// compare orders two keys field by field. Nulls go last in either direction.
+func (s *SortStage) compare(a, b []sortValue) int {
+	for i, field := range s.fields {
+		x, y := a[i], b[i]
+		if x.kind == sortNull || y.kind == sortNull {
+			if c := cmp.Compare(x.kind, y.kind); c != 0 {
+				return c
+			}
+			continue
+		}
+		c := cmp.Compare(x.kind, y.kind)
+		if c == 0 {
+			switch x.kind {
+			case sortNumber:
+				c = cmp.Compare(x.number, y.number)
+			case sortTime:
+				c = x.time.Compare(y.time)
+			default:
+				c = strings.Compare(x.text, y.text)
+			}
+		}
+		if field.descending {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func (s *SortStage) sortEntries() {
+	sort.SliceStable(s.entries, func(i, j int) bool { return s.compare(s.entries[i].key, s.entries[j].key) < 0 })
+}
+
+// spill writes the records held to a temporary file, sorted
+func (s *SortStage) spill() error {
+	if len(s.entries) == 0 {
+		return nil
+	}
+	file, err := os.CreateTemp(s.spillDir, "fractal-sort-*.gob")
+	if err != nil {
+		return fmt.Errorf("failed to create sort spill file: %w", err)
+	}
+	s.spills = append(s.spills, file.Name())
+	defer file.Close()
+
+	s.sortEntries()
+	writer := bufio.NewWriter(file)
+	encoder := newSpillEncoder(writer)
+	for _, entry := range s.entries {
+		if err := encoder.encode(entry.rec); err != nil {
+			return fmt.Errorf("failed to write sort spill file: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write sort spill file: %w", err)
+	}
+	logger.Infof("Sort spilled %d records to %s", len(s.entries), file.Name())
+	s.entries = nil
+	return nil
+}
+
+// merge reads the sorted spill files back in order, taking the first record
+// of the earliest run on ties so the sort stays stable
+func (s *SortStage) merge(emit func([]Record) error) error {
+	runs := &sortRuns{stage: s}
+	for i, path := range s.spills {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open sort spill file: %w", err)
+		}
+		defer file.Close()
+		run := &sortRun{index: i, decoder: newSpillDecoder(bufio.NewReader(file))}
+		if err := run.next(s); err != nil {
+			return err
+		}
+		if run.current != nil {
+			heap.Push(runs, run)
+		}
+	}
+	logger.Infof("Sort merging %d spilled runs", len(s.spills))
+
+	batch := make([]Record, 0, sortEmitBatch)
+	for runs.Len() > 0 {
+		run := heap.Pop(runs).(*sortRun)
+		batch = append(batch, run.current.rec)
+		if err := run.next(s); err != nil {
+			return err
+		}
+		if run.current != nil {
+			heap.Push(runs, run)
+		}
+		if len(batch) == sortEmitBatch {
+			if err := emit(batch); err != nil {
+				return err
+			}
+			batch = make([]Record, 0, sortEmitBatch)
+		}
+	}
+	if len(batch) > 0 {
+		return emit(batch)
+	}
+	return nil
+}
+
+type sortRun struct {
+	index   int
+	decoder *spillDecoder
+	current *sortEntry
+}
+
+func (r *sortRun) next(s *SortStage) error {
+	r.current = nil
+	var rec Record
+	if err := r.decoder.decode(&rec); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return fmt.Errorf("corrupt sort spill file: %w", err)
+	}
+	r.current = &sortEntry{rec: rec, key: s.key(rec)}
+	return nil
+}
+
+// sortRuns is a min-heap of spill files ordered by their current record
+type sortRuns struct {
+	stage *SortStage
+	runs  []*sortRun
+}
+
+func (h *sortRuns) Len() int { return len(h.runs) }
+func (h *sortRuns) Less(i, j int) bool {
+	if c := h.stage.compare(h.runs[i].current.key, h.runs[j].current.key); c != 0 {
+		return c < 0
+	}
+	return h.runs[i].index < h.runs[j].index
+}
+func (h *sortRuns) Swap(i, j int)      { h.runs[i], h.runs[j] = h.runs[j], h.runs[i] }
+func (h *sortRuns) Push(x interface{}) { h.runs = append(h.runs, x.(*sortRun)) }
+func (h *sortRuns) Pop() interface{} {
+	run := h.runs[len(h.runs)-1]
+	h.runs = h.runs[:len(h.runs)-1]
+	return run
+}
@@ -0,0 +1,98 @@
+package pipeline
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// registeredSpillTypes holds the value types already registered with gob
+var registeredSpillTypes sync.Map
+
+// spillEncoder writes records to a spill file with gob rather than JSON, so
+// they are read back with the Go types they had: an int64 stays an int64
+// and a time.Time a time.Time, as they would in memory
+type spillEncoder struct {
+	encoder *gob.Encoder
+}
+
+func newSpillEncoder(w io.Writer) *spillEncoder {
+	return &spillEncoder{encoder: gob.NewEncoder(w)}
+}
+
+// encode writes one value, registering the types of the values it holds
+// first, as gob needs to know what an interface{} holds
+func (e *spillEncoder) encode(v interface{}) error {
+	if err := registerSpillTypes(v); err != nil {
+		return err
+	}
+	return e.encoder.Encode(v)
+}
+
+// spillDecoder reads back what a spillEncoder wrote
+type spillDecoder struct {
+	decoder *gob.Decoder
+}
+
+func newSpillDecoder(r io.Reader) *spillDecoder {
+	return &spillDecoder{decoder: gob.NewDecoder(r)}
+}
+
+// decode reads the next value into v, returning io.EOF once there are none
+func (d *spillDecoder) decode(v interface{}) error {
+	return d.decoder.Decode(v)
+}
+
+// registerSpillTypes registers the concrete type of every value in v with
+// gob, looking inside records, maps, slices and groups
+func registerSpillTypes(v interface{}) error {
+	switch value := v.(type) {
+	case nil:
+		return nil
+	case Record:
+		return registerSpillTypes(map[string]interface{}(value))
+	case map[string]interface{}:
+		for _, item := range value {
+			if err := registerSpillValue(item); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if err := registerSpillValue(item); err != nil {
+				return err
+			}
+		}
+	case *groupState:
+		return registerSpillTypes(value.Values)
+	}
+	return nil
+}
+
+// registerSpillValue registers the type of a value held in an interface{},
+// and of what it holds in turn
+func registerSpillValue(v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	if _, seen := registeredSpillTypes.LoadOrStore(reflect.TypeOf(v), true); !seen {
+		if err := registerSpillType(v); err != nil {
+			return err
+		}
+	}
+	return registerSpillTypes(v)
+}
+
+// registerSpillType registers one type with gob, which panics when two types
+// share a name; that must fail the spill rather than take the run down
+func registerSpillType(v interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("cannot spill a %T: %v", v, r)
+		}
+	}()
+	gob.Register(v)
+	return nil
+}
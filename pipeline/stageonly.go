@@ -0,0 +1,48 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+// StageOnly returns the configuration of a run applying only the validate or
+// the transform stage, so rule authors can try their rules over the source
+// without the rest of the pipeline. The other stages' settings are cleared,
+// as are the delivery, provenance, tap, reconciliation and notification
+// settings. Rejected records never stop the run, so every one of them is
+// reported. The validate stage keeps its rule sets, in the order stages gives.
+func StageOnly(cfg interfaces.PipelineConfig, name string) (interfaces.PipelineConfig, error) {
+	only := interfaces.PipelineConfig{
+		ErrorHandling: interfaces.ErrorHandling{
+			Strategy:         StrategyLogAndContinue,
+			QuarantineOutput: cfg.ErrorHandling.QuarantineOutput,
+		},
+		NormalizeFields: cfg.NormalizeFields,
+		Lookups:         cfg.Lookups,
+		Buffer:          cfg.Buffer,
+		Schema:          cfg.Schema,
+		MaxDuration:     cfg.MaxDuration,
+	}
+	switch name {
+	case "validate":
+		only.Validate = cfg.Validate
+		if len(only.Validate.Rules) == 0 && len(only.Validate.Sets) == 0 {
+			return only, fmt.Errorf("no validation rules are configured")
+		}
+	case "transform":
+		only.Transform = cfg.Transform
+		if len(only.Transform.Rules) == 0 {
+			return only, fmt.Errorf("no transformation rules are configured")
+		}
+	default:
+		return only, fmt.Errorf("stage %s cannot run on its own, expected validate or transform", name)
+	}
+	for _, entry := range cfg.Stages {
+		if stage, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(entry)), ":"); stage == name {
+			only.Stages = append(only.Stages, entry)
+		}
+	}
+	return only, nil
+}
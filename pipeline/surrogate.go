@@ -0,0 +1,118 @@
+package pipeline
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+// surrogateNull stands for a null or missing field in the text a surrogate
+// key hashes. Values have their backslashes escaped, so none can read \N.
+const surrogateNull = `\N`
+
+// surrogateHashes are the algorithms a surrogate rule can hash with
+var surrogateHashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// hashAlgorithm returns the hash of the given name, one of surrogateHashes
+func hashAlgorithm(name string) (func() hash.Hash, error) {
+	newHash, ok := surrogateHashes[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(surrogateHashes))
+		for name := range surrogateHashes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown hash algorithm %q: expected one of %s", name, strings.Join(names, ", "))
+	}
+	return newHash, nil
+}
+
+func init() {
+	registerTransform(TransformRule{
+		Keyword:     "surrogate",
+		Syntax:      `surrogate <target> = hash(<field>, <field>...) [using <algorithm>] [with "<sep>"]`,
+		Description: "Stores a hash of the fields in target, the same for the same values on every run",
+		parse:       parseSurrogateRule,
+	})
+}
+
+// parseSurrogateRule reads a surrogate rule. The algorithm is sha256 and the
+// separator | unless the rule says otherwise.
+func parseSurrogateRule(args []string, _ interfaces.TransformConfig) (transformFunc, error) {
+	if len(args) < 3 || args[1] != "=" || !strings.HasPrefix(strings.ToLower(args[2]), "hash(") {
+		return nil, fmt.Errorf("missing the fields to hash")
+	}
+	target := args[0]
+	end := 2
+	for end < len(args) && !strings.HasSuffix(args[end], ")") {
+		end++
+	}
+	if end == len(args) {
+		return nil, fmt.Errorf("missing the closing parenthesis")
+	}
+	list := strings.Join(args[2:end+1], " ")
+	var fields []string
+	for _, field := range strings.Split(list[len("hash("):len(list)-1], ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			return nil, fmt.Errorf("empty field in the list to hash")
+		}
+		fields = append(fields, field)
+	}
+
+	algorithm, separator := "sha256", "|"
+	options := args[end+1:]
+	for len(options) > 0 {
+		if len(options) < 2 {
+			return nil, fmt.Errorf("missing the value of %s", options[0])
+		}
+		switch strings.ToLower(options[0]) {
+		case "using":
+			algorithm = strings.ToLower(options[1])
+		case "with":
+			separator = options[1]
+		default:
+			return nil, fmt.Errorf("unknown option %s", options[0])
+		}
+		options = options[2:]
+	}
+	newHash, err := hashAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if separator == "" || strings.Contains(separator, `\`) {
+		return nil, fmt.Errorf("the separator must not be empty or hold a backslash")
+	}
+	escaper := strings.NewReplacer(`\`, `\\`, separator, `\`+separator)
+
+	return func(rec Record) error {
+		// Null follows the nulls stage, which has already turned the configured
+		// null markers into nil. Null and missing fields hash alike, and
+		// differently from an empty one.
+		parts := make([]string, len(fields))
+		for i, field := range fields {
+			if value := rec[field]; value != nil {
+				parts[i] = escaper.Replace(fmt.Sprint(value))
+			} else {
+				parts[i] = surrogateNull
+			}
+		}
+		h := newHash()
+		h.Write([]byte(strings.Join(parts, separator)))
+		rec[target] = hex.EncodeToString(h.Sum(nil))
+		return nil
+	}, nil
+}
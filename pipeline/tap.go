@@ -0,0 +1,147 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+)
+
+// TapStageName names the tap stage in logs
+const TapStageName = "tap"
+
+// tapSource is the After value that samples the records as the source read them
+const tapSource = "source"
+
+// tappedRecord is one sampled record as the tap writes it
+type tappedRecord struct {
+	After  string `json:"after"`
+	Number int    `json:"number"` // Position of the record among those that passed the tap, from 1
+	Record Record `json:"record"`
+}
+
+// TapStage writes a sample of the records passing through it to a debug
+// output as indented JSON, and passes every record on unchanged. A tap that
+// cannot write logs why and stops sampling rather than failing the run.
+type TapStage struct {
+	cfg     interfaces.TapConfig
+	after   string
+	seen    int
+	written int
+	file    *os.File
+	encoder *json.Encoder
+	failed  bool
+}
+
+// NewTapStage checks the tap configuration. after names the stage whose
+// output it samples.
+func NewTapStage(cfg interfaces.TapConfig, after string) (*TapStage, error) {
+	if cfg.Every < 0 || cfg.Limit < 0 {
+		return nil, fmt.Errorf("tap every and limit must not be negative")
+	}
+	if cfg.Sample < 0 || cfg.Sample > 1 {
+		return nil, fmt.Errorf("invalid tap sample %v: expected a fraction between 0 and 1", cfg.Sample)
+	}
+	if (cfg.Every > 0) == (cfg.Sample > 0) {
+		return nil, fmt.Errorf("tap needs either every or sample")
+	}
+	return &TapStage{cfg: cfg, after: after}, nil
+}
+
+// Name returns the stage name
+func (t *TapStage) Name() string {
+	return TapStageName
+}
+
+// Process writes the record when it is sampled and passes it on
+func (t *TapStage) Process(rec Record) ([]Record, error) {
+	t.seen++
+	if t.failed || (t.cfg.Limit > 0 && t.written >= t.cfg.Limit) {
+		return []Record{rec}, nil
+	}
+	sampled := rand.Float64() < t.cfg.Sample
+	if t.cfg.Every > 0 {
+		sampled = t.seen%t.cfg.Every == 0
+	}
+	if sampled {
+		if err := t.write(rec); err != nil {
+			logger.Infof("Tap after %s stopped: %v", t.after, err)
+			t.failed = true
+		}
+	}
+	return []Record{rec}, nil
+}
+
+// write appends the record to the tap output, opening it the first time
+func (t *TapStage) write(rec Record) error {
+	if t.encoder == nil {
+		var out io.Writer = os.Stdout
+		if t.cfg.Location != "" && t.cfg.Location != "-" {
+			file, err := os.OpenFile(t.cfg.Location, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			if err != nil {
+				return fmt.Errorf("failed to open tap output %s: %w", t.cfg.Location, err)
+			}
+			t.file, out = file, file
+		}
+		t.encoder = json.NewEncoder(out)
+		t.encoder.SetIndent("", "  ")
+	}
+	if err := t.encoder.Encode(tappedRecord{After: t.after, Number: t.seen, Record: rec}); err != nil {
+		return fmt.Errorf("failed to write to tap output: %w", err)
+	}
+	t.written++
+	return nil
+}
+
+// Flush has nothing to emit, the tap doesn't buffer
+func (t *TapStage) Flush() ([]Record, error) {
+	return nil, nil
+}
+
+// Close releases the tap output
+func (t *TapStage) Close() error {
+	if t.written > 0 {
+		logger.Infof("Tap after %s wrote %d of %d records", t.after, t.written, t.seen)
+	}
+	if t.file == nil {
+		return nil
+	}
+	return t.file.Close()
+}
+
+// insertTap puts the configured tap after the stage it samples: the first
+// one with that name, the start for source, and the end by default
+func insertTap(stages []Stage, cfg interfaces.TapConfig) ([]Stage, error) {
+	after := strings.ToLower(strings.TrimSpace(cfg.After))
+	at := len(stages)
+	switch after {
+	case "":
+		after = tapSource
+		if len(stages) > 0 {
+			after = stages[len(stages)-1].Name()
+		}
+	case tapSource:
+		at = 0
+	default:
+		at = -1
+		for i, stage := range stages {
+			if stage.Name() == after {
+				at = i + 1
+				break
+			}
+		}
+		if at < 0 {
+			return nil, fmt.Errorf("tap after stage %s, which does not run", cfg.After)
+		}
+	}
+	tap, err := NewTapStage(cfg, after)
+	if err != nil {
+		return nil, err
+	}
+	return append(stages[:at], append([]Stage{tap}, stages[at:]...)...), nil
+}
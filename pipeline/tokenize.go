@@ -0,0 +1,244 @@
+package pipeline
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+)
+
+// Keywords of the rules reading and writing token maps
+const (
+	tokenizeKeyword   = "tokenize"
+	detokenizeKeyword = "detokenize"
+)
+
+// DefaultTokenPrefix starts the tokens of a map that doesn't set a prefix
+const DefaultTokenPrefix = "tok_"
+
+// DefaultTokenMapMaxValues is how many distinct values a token map holds when
+// TokenMapConfig.MaxValues is not set
+const DefaultTokenMapMaxValues = 1000000
+
+// tokenMapWarnPercent is how full a token map gets before a run logs that it
+// is filling up
+const tokenMapWarnPercent = 80
+
+func init() {
+	// parseTransform reads these rules itself, as they share the stage's token maps
+	registerTransform(TransformRule{
+		Keyword:     tokenizeKeyword,
+		Syntax:      `tokenize <field>, <field>... [using <map>]`,
+		Description: "Replaces the values with tokens, the same token for the same value in every field using the map",
+	})
+	registerTransform(TransformRule{
+		Keyword:     detokenizeKeyword,
+		Syntax:      `detokenize <field>, <field>... using <map>`,
+		Description: "Puts back the values a tokenize rule replaced, from a token map saved to a file",
+	})
+}
+
+// tokenMap pairs real values with random tokens, in both directions
+type tokenMap struct {
+	name      string
+	file      string
+	prefix    string
+	maxValues int
+	tokens    map[string]string // Token by value
+	values    map[string]string // Value by token
+	warned    bool
+	changed   bool
+}
+
+// tokenMaps holds the token maps of one transform stage, built as its rules
+// name them, so every rule using a map sees the same tokens
+type tokenMaps struct {
+	cfg  map[string]interfaces.TokenMapConfig
+	maps map[string]*tokenMap
+}
+
+func newTokenMaps(cfg map[string]interfaces.TokenMapConfig) *tokenMaps {
+	return &tokenMaps{cfg: cfg, maps: map[string]*tokenMap{}}
+}
+
+// get returns the named map, loading its file the first time. The unnamed map
+// is kept for the run only.
+func (m *tokenMaps) get(name string) (*tokenMap, error) {
+	if tm, ok := m.maps[name]; ok {
+		return tm, nil
+	}
+	cfg, ok := m.cfg[name]
+	if !ok && name != "" {
+		return nil, fmt.Errorf("unknown token map %s, expected one of transform.tokens", name)
+	}
+	if cfg.MaxValues < 0 {
+		return nil, fmt.Errorf("invalid maxvalues %d for token map %s: must not be negative", cfg.MaxValues, name)
+	}
+	tm := &tokenMap{name: name, file: cfg.File, prefix: cfg.Prefix, maxValues: cfg.MaxValues, tokens: map[string]string{}, values: map[string]string{}}
+	if tm.prefix == "" {
+		tm.prefix = DefaultTokenPrefix
+	}
+	if tm.maxValues == 0 {
+		tm.maxValues = DefaultTokenMapMaxValues
+	}
+	if err := tm.load(); err != nil {
+		return nil, err
+	}
+	m.maps[name] = tm
+	return tm, nil
+}
+
+// save writes every map with a file that has new tokens
+func (m *tokenMaps) save() error {
+	names := make([]string, 0, len(m.maps))
+	for name := range m.maps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := m.maps[name].save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load reads the tokens saved to the map's file. A file that doesn't exist
+// yet is an empty map.
+func (tm *tokenMap) load() error {
+	if tm.file == "" {
+		return nil
+	}
+	data, err := os.ReadFile(tm.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read token map %s: %w", tm.file, err)
+	}
+	var saved map[string]string
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("failed to read token map %s: %w", tm.file, err)
+	}
+	for token, value := range saved {
+		if _, ok := tm.tokens[value]; ok {
+			return fmt.Errorf("token map %s gives the value of token %s another token as well", tm.file, token)
+		}
+		tm.tokens[value] = token
+		tm.values[token] = value
+	}
+	return nil
+}
+
+// save replaces the map's file with its tokens, readable by the owner only as
+// it holds the real values
+func (tm *tokenMap) save() error {
+	if tm.file == "" || !tm.changed {
+		return nil
+	}
+	data, err := json.MarshalIndent(tm.values, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode token map: %w", err)
+	}
+	if err := writeFileAtomic(tm.file, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write token map %s: %w", tm.file, err)
+	}
+	tm.changed = false
+	logger.Infof("Saved %d tokens to token map %s", len(tm.values), tm.file)
+	return nil
+}
+
+// token returns the value's token, making a new one the first time the value is seen
+func (tm *tokenMap) token(value string) (string, error) {
+	if token, ok := tm.tokens[value]; ok {
+		return token, nil
+	}
+	if len(tm.tokens) >= tm.maxValues {
+		return "", fmt.Errorf("token map %s is full at %d values, raise its maxvalues to tokenize more distinct values", tm.label(), tm.maxValues)
+	}
+	// A random token gives nothing away about the value or the order values arrived in
+	var token string
+	for taken := true; taken; _, taken = tm.values[token] {
+		raw := make([]byte, 8)
+		if _, err := rand.Read(raw); err != nil {
+			return "", fmt.Errorf("failed to make a token: %w", err)
+		}
+		token = tm.prefix + hex.EncodeToString(raw)
+	}
+	tm.tokens[value] = token
+	tm.values[token] = value
+	tm.changed = true
+	if !tm.warned && len(tm.tokens)*100 >= tm.maxValues*tokenMapWarnPercent {
+		tm.warned = true
+		logger.Infof("Token map %s holds %d distinct values, %d%% of its maxvalues of %d", tm.label(), len(tm.tokens), tokenMapWarnPercent, tm.maxValues)
+	}
+	return token, nil
+}
+
+// label names the map in messages
+func (tm *tokenMap) label() string {
+	if tm.name == "" {
+		return "of the run"
+	}
+	return tm.name
+}
+
+// parseTokenRule reads a tokenize or a detokenize rule, whose map comes from maps
+func parseTokenRule(args []string, maps *tokenMaps, tokenize bool) (transformFunc, error) {
+	name := ""
+	if len(args) >= 2 && strings.EqualFold(args[len(args)-2], "using") {
+		name, args = args[len(args)-1], args[:len(args)-2]
+	} else if !tokenize {
+		return nil, fmt.Errorf("missing the token map to read")
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing the fields")
+	}
+	var fields []string
+	for _, field := range strings.Split(strings.Join(args, " "), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			return nil, fmt.Errorf("empty field in the list")
+		}
+		fields = append(fields, field)
+	}
+	tm, err := maps.get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(rec Record) error {
+		// Null and empty values stay as they are, there is nothing to hide
+		for _, field := range fields {
+			value, ok := rec[field]
+			if !ok || value == nil || value == "" {
+				continue
+			}
+			text, ok := value.(string)
+			if !ok {
+				text = fmt.Sprint(value)
+			}
+			if tokenize {
+				token, err := tm.token(text)
+				if err != nil {
+					return fmt.Errorf("failed to tokenize %s: %w", field, err)
+				}
+				rec[field] = token
+				continue
+			}
+			original, ok := tm.values[text]
+			if !ok {
+				return fmt.Errorf("failed to detokenize %s: token map %s has no token %q", field, tm.label(), text)
+			}
+			rec[field] = original
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,226 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+// transformFunc applies one parsed transformation rule to a record in place
+type transformFunc func(rec Record) error
+
+// expandFunc applies a parsed transformation rule that may turn a record into
+// several, or into none
+type expandFunc func(rec Record) ([]Record, error)
+
+// TransformRule describes a transformation keyword: how to write it, what
+// it does, and how to parse it
+type TransformRule struct {
+	Keyword     string
+	Syntax      string
+	Description string
+	// parse builds the transformation from the words after the keyword and
+	// the rest of the transform configuration, such as the mapping tables
+	parse func(args []string, cfg interfaces.TransformConfig) (transformFunc, error)
+	// expand is set instead of parse by rules emitting more or fewer records than they read
+	expand func(args []string, cfg interfaces.TransformConfig) (expandFunc, error)
+}
+
+// transformRules holds the transformations by keyword
+var transformRules = map[string]TransformRule{}
+
+// registerTransform makes a transformation keyword available to transform rules
+func registerTransform(rule TransformRule) {
+	transformRules[rule.Keyword] = rule
+}
+
+// TransformRules lists the transformations, sorted by keyword
+func TransformRules() []TransformRule {
+	rules := make([]TransformRule, 0, len(transformRules))
+	for _, rule := range transformRules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Keyword < rules[j].Keyword })
+	return rules
+}
+
+// TransformStage rewrites field values with the configured rules, applied
+// to each record in order
+type TransformStage struct {
+	rules  []expandFunc
+	pivots map[int]*pivotRule // Pivot rules by their place in rules, which is nil there
+	tokens *tokenMaps
+}
+
+// NewTransformStage parses the transformation rules
+func NewTransformStage(cfg interfaces.TransformConfig) (*TransformStage, error) {
+	t := &TransformStage{pivots: map[int]*pivotRule{}, tokens: newTokenMaps(cfg.Tokens)}
+	for _, spec := range cfg.Rules {
+		if words, err := ruleWords(spec); err == nil && len(words) > 0 && strings.EqualFold(words[0], pivotKeyword) {
+			pivot, err := parsePivotRule(words[1:], cfg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid transform rule %q: %w, expected %s", spec, err, transformRules[pivotKeyword].Syntax)
+			}
+			t.pivots[len(t.rules)] = pivot
+			t.rules = append(t.rules, nil)
+			continue
+		}
+		apply, err := parseTransform(spec, cfg, 0, t.tokens)
+		if err != nil {
+			return nil, err
+		}
+		t.rules = append(t.rules, apply)
+	}
+	return t, nil
+}
+
+// parseTransform parses one transformation rule. depth counts the when rules
+// it is nested in, and tokens holds the token maps of the stage.
+func parseTransform(spec string, cfg interfaces.TransformConfig, depth int, tokens *tokenMaps) (expandFunc, error) {
+	words, err := ruleWords(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transform rule %q: %w", spec, err)
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("invalid transform rule %q: the rule is empty", spec)
+	}
+	// A when rule keeps the quotes of its predicate, so it is read from the text
+	if strings.EqualFold(words[0], whenKeyword) {
+		apply, err := parseWhenRule(spec, cfg, depth, tokens)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transform rule %q: %w", spec, err)
+		}
+		return apply, nil
+	}
+	rule, ok := transformRules[strings.ToLower(words[0])]
+	if !ok {
+		return nil, fmt.Errorf("invalid transform rule %q: unknown transformation %s", spec, words[0])
+	}
+	var apply transformFunc
+	switch {
+	case rule.Keyword == pivotKeyword:
+		return nil, fmt.Errorf("invalid transform rule %q: pivot cannot be applied to some records only", spec)
+	case rule.Keyword == tokenizeKeyword || rule.Keyword == detokenizeKeyword:
+		apply, err = parseTokenRule(words[1:], tokens, rule.Keyword == tokenizeKeyword)
+	case rule.expand != nil:
+		expand, err := rule.expand(words[1:], cfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transform rule %q: %w, expected %s", spec, err, rule.Syntax)
+		}
+		return expand, nil
+	default:
+		apply, err = rule.parse(words[1:], cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid transform rule %q: %w, expected %s", spec, err, rule.Syntax)
+	}
+	return func(rec Record) ([]Record, error) {
+		if err := apply(rec); err != nil {
+			return nil, err
+		}
+		return []Record{rec}, nil
+	}, nil
+}
+
+// Name returns the stage name
+func (t *TransformStage) Name() string {
+	return "transform"
+}
+
+// Process applies every rule to the record, and each rule after one that
+// expands it to every record it became. A record expanded into none is
+// filtered out, and one reaching a pivot rule is held until Flush.
+func (t *TransformStage) Process(rec Record) ([]Record, error) {
+	records, held, err := t.apply([]Record{rec}, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 && !held {
+		return nil, ErrFiltered
+	}
+	return records, nil
+}
+
+// apply runs the rules from the one at index from on, stopping at the first
+// pivot rule, which holds the records reaching it
+func (t *TransformStage) apply(records []Record, from int) ([]Record, bool, error) {
+	for i := from; i < len(t.rules) && len(records) > 0; i++ {
+		if pivot := t.pivots[i]; pivot != nil {
+			for _, r := range records {
+				if err := pivot.add(r); err != nil {
+					return nil, false, err
+				}
+			}
+			return nil, true, nil
+		}
+		var next []Record
+		for _, r := range records {
+			out, err := t.rules[i](r)
+			if err != nil {
+				return nil, false, err
+			}
+			next = append(next, out...)
+		}
+		records = next
+	}
+	return records, false, nil
+}
+
+// Flush emits the records of the pivot rules, running each through the rules
+// after it, and saves the token maps that have a file. As the records no
+// longer stand for a source record, one a later rule rejects fails the run.
+func (t *TransformStage) Flush() ([]Record, error) {
+	var flushed []Record
+	for i := range t.rules {
+		pivot := t.pivots[i]
+		if pivot == nil {
+			continue
+		}
+		records, _, err := t.apply(pivot.flush(), i+1)
+		if err != nil {
+			return nil, err
+		}
+		flushed = append(flushed, records...)
+	}
+	return flushed, t.tokens.save()
+}
+
+// Close saves the token maps after a failed run too, as tokens written before
+// the failure must still be reversible
+func (t *TransformStage) Close() error {
+	return t.tokens.save()
+}
+
+// ruleWords splits a rule into words at whitespace. A word in double or
+// single quotes may hold spaces and is taken without its quotes.
+func ruleWords(spec string) ([]string, error) {
+	var words []string
+	runes := []rune(strings.TrimSpace(spec))
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+		if quote := runes[i]; quote == '"' || quote == '\'' {
+			end := i + 1
+			for end < len(runes) && runes[end] != quote {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			words = append(words, string(runes[i+1:end]))
+			i = end + 1
+			continue
+		}
+		start := i
+		for i < len(runes) && !unicode.IsSpace(runes[i]) {
+			i++
+		}
+		words = append(words, string(runes[start:i]))
+	}
+	return words, nil
+}
@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+func init() {
+	registerTransform(TransformRule{
+		Keyword:     "trim",
+		Syntax:      `trim <field>, <field>... [collapse]`,
+		Description: "Strips the whitespace around text fields, optionally collapsing runs of it inside them",
+		parse:       parseTrimRule,
+	})
+}
+
+// CleanSpace strips the whitespace around value and, with collapse, turns
+// every run of whitespace inside it into a single space
+func CleanSpace(value string, collapse bool) string {
+	if collapse {
+		return strings.Join(strings.Fields(value), " ")
+	}
+	return strings.TrimSpace(value)
+}
+
+// parseTrimRule reads a trim rule. A last word collapse, not followed by a
+// comma, also collapses the whitespace inside the values.
+func parseTrimRule(args []string, _ interfaces.TransformConfig) (transformFunc, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing the fields to trim")
+	}
+	collapse := false
+	if last := len(args) - 1; last > 0 && strings.EqualFold(args[last], "collapse") && !strings.HasSuffix(args[last-1], ",") {
+		collapse, args = true, args[:last]
+	}
+	var fields []string
+	for _, field := range strings.Split(strings.Join(args, " "), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			return nil, fmt.Errorf("empty field in the list to trim")
+		}
+		fields = append(fields, field)
+	}
+	all := len(fields) == 1 && fields[0] == "*"
+
+	return func(rec Record) error {
+		// Only text is trimmed: null, numbers and the rest are left alone
+		if all {
+			for field, value := range rec {
+				if text, ok := value.(string); ok {
+					rec[field] = CleanSpace(text, collapse)
+				}
+			}
+			return nil
+		}
+		for _, field := range fields {
+			if text, ok := rec[field].(string); ok {
+				rec[field] = CleanSpace(text, collapse)
+			}
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,103 @@
+package pipeline
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+// truncateEllipsis marks a value the ellipsis option shortened. It is plain
+// ASCII, so it fits columns of any character set.
+const truncateEllipsis = "..."
+
+func init() {
+	registerTransform(TransformRule{
+		Keyword:     "truncate",
+		Syntax:      `truncate <field>, <field>... to <n> [bytes] [ellipsis]`,
+		Description: "Shortens text fields longer than n characters, or n bytes, optionally ending them with ...",
+		parse:       parseTruncateRule,
+	})
+}
+
+// Truncate shortens value to at most n characters, or n bytes of UTF-8 with
+// bytes, never splitting a character. With ellipsis a shortened value ends
+// with ..., within the n.
+func Truncate(value string, n int, bytes, ellipsis bool) string {
+	length := utf8.RuneCountInString
+	if bytes {
+		length = func(s string) int { return len(s) }
+	}
+	if length(value) <= n {
+		return value
+	}
+	marker := ""
+	if ellipsis {
+		marker = truncateEllipsis
+	}
+	room, used := n-len(marker), 0
+	for i, r := range value {
+		size := 1
+		if bytes {
+			size = utf8.RuneLen(r)
+		}
+		if used+size > room {
+			return value[:i] + marker
+		}
+		used += size
+	}
+	return value
+}
+
+// parseTruncateRule reads a truncate rule. The words after the length are
+// its options, bytes and ellipsis, in any order.
+func parseTruncateRule(args []string, _ interfaces.TransformConfig) (transformFunc, error) {
+	to := -1
+	for i, arg := range args {
+		if strings.EqualFold(arg, "to") {
+			to = i
+			break
+		}
+	}
+	if to < 1 || to+1 >= len(args) {
+		return nil, fmt.Errorf("expected the fields to truncate, then to and a length")
+	}
+	var fields []string
+	for _, field := range strings.Split(strings.Join(args[:to], " "), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			return nil, fmt.Errorf("empty field in the list to truncate")
+		}
+		fields = append(fields, field)
+	}
+	n, err := strconv.Atoi(args[to+1])
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("length %q is not a positive whole number", args[to+1])
+	}
+	bytes, ellipsis := false, false
+	for _, option := range args[to+2:] {
+		switch strings.ToLower(option) {
+		case "bytes":
+			bytes = true
+		case "ellipsis":
+			ellipsis = true
+		default:
+			return nil, fmt.Errorf("unknown option %s, expected bytes or ellipsis", option)
+		}
+	}
+	if ellipsis && n <= len(truncateEllipsis) {
+		return nil, fmt.Errorf("length %d leaves no room for the value before %s", n, truncateEllipsis)
+	}
+
+	return func(rec Record) error {
+		// Only text is shortened: null, numbers and the rest are left alone
+		for _, field := range fields {
+			if text, ok := rec[field].(string); ok {
+				rec[field] = Truncate(text, n, bytes, ellipsis)
+			}
+		}
+		return nil
+	}, nil
+}
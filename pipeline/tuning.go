@@ -0,0 +1,66 @@
+package pipeline
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Thresholds of the tuning hints
+const (
+	minTuningSend   = time.Second // Sends shorter than this are mostly start-up, so they get no hints
+	lowBatchFill    = 0.5         // Batches holding less of BatchSize than this rarely filled
+	idleDestination = 0.4         // Batch slots busy less than this are more than the destination needs
+	busyDestination = 0.8         // Share of the time the suggested batch slots would be busy
+	longWait        = 0.5         // Share of the send a side waiting this long is held up by the other
+)
+
+// TuningHints suggests delivery and buffer settings from a run's buffer
+// stats: fewer batch slots when the destination sat idle, smaller batches
+// when they rarely filled, more slots or larger batches when the stages
+// waited on the destination, and where the bottleneck is when it waited on
+// them. A run that sent for less than a second gets none.
+func TuningHints(stats *BufferStats) []string {
+	if stats == nil || stats.SendMS < minTuningSend.Milliseconds() {
+		return nil
+	}
+	send := float64(stats.SendMS)
+	var hints []string
+	if stats.BatchSize > 0 && stats.Batches >= 2 && stats.BatchFill < lowBatchFill {
+		hints = append(hints, fmt.Sprintf("batches rarely filled, holding %.0f of %d records on average: lower delivery.batchsize to %d",
+			stats.AvgBatchRecords, stats.BatchSize, max(1, int(math.Ceil(stats.AvgBatchRecords)))))
+	}
+	if stats.MaxInFlight > 1 && stats.DestinationBusy < idleDestination {
+		slots := max(1, int(math.Ceil(stats.DestinationBusy*float64(stats.MaxInFlight)/busyDestination)))
+		if slots < stats.MaxInFlight {
+			hints = append(hints, fmt.Sprintf("the destination was idle %.0f%% of the time across %d batch slots: reduce delivery.maxinflight to %d",
+				(1-stats.DestinationBusy)*100, stats.MaxInFlight, slots))
+		}
+	}
+	if float64(stats.StagesWaitMS)/send >= longWait {
+		hint := fmt.Sprintf("the stages waited for the destination %.0f%% of the time: raise delivery.maxinflight to %d if the destination takes parallel writes",
+			percent(stats.StagesWaitMS, send), stats.MaxInFlight*2)
+		if stats.BatchSize > 0 {
+			hint += fmt.Sprintf(", or delivery.batchsize to %d for fewer calls", stats.BatchSize*2)
+		}
+		hints = append(hints, hint)
+	}
+	if float64(stats.DestinationWaitMS)/send >= longWait {
+		hints = append(hints, fmt.Sprintf("the destination waited for records %.0f%% of the time: the source or the stages are the bottleneck, so more batch slots or larger batches won't speed the run up",
+			percent(stats.DestinationWaitMS, send)))
+	}
+	if stats.Spilled > 0 {
+		hints = append(hints, fmt.Sprintf("%d records spilled to disk: raise buffer.capacity to %d to keep them in memory", stats.Spilled, stats.Peak))
+	}
+	return hints
+}
+
+// percent returns a wait as a percentage of the send, at most 100
+func percent(waitMS int64, sendMS float64) float64 {
+	return min(100, float64(waitMS)/sendMS*100)
+}
+
+// roundShare rounds a figure to two decimals, to keep the report readable
+func roundShare(x float64) float64 {
+	return math.Round(x*100) / 100
+}
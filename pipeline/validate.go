@@ -0,0 +1,196 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/language"
+)
+
+// inSourceRule matches a membership rule, <field> in_source <lookup>
+var inSourceRule = regexp.MustCompile(`^(\S+)\s+(?i:in_source)\s+(\S+)$`)
+
+// inSourceRuleInfo describes the in_source rule for the rules command
+var inSourceRuleInfo = RuleInfo{
+	Kind:        RuleValidation,
+	Stage:       "validate",
+	Keyword:     "in_source",
+	Syntax:      "<field> in_source <lookup>",
+	Description: "Checks the value is one of the key values of a lookup",
+}
+
+// isPhoneRule matches a phone number rule, <field> is_phone [<region>]
+var isPhoneRule = regexp.MustCompile(`^(\S+)\s+(?i:is_phone)(?:\s+(\S+))?$`)
+
+// isPhoneRuleInfo describes the is_phone rule for the rules command
+var isPhoneRuleInfo = RuleInfo{
+	Kind:        RuleValidation,
+	Stage:       "validate",
+	Keyword:     "is_phone",
+	Syntax:      "<field> is_phone [<region>]",
+	Description: "Checks the value is a phone number the phone transformation can write in E.164 form",
+}
+
+// validateFunc checks one parsed validation rule against a record
+type validateFunc func(rec Record) error
+
+// ValidateStage rejects records that break any of the configured rules.
+// Failing records follow the error strategy like any other stage error.
+type ValidateStage struct {
+	name  string
+	rules []validateFunc
+}
+
+// NewValidateStage parses the validation rules. Each lookup an in_source rule
+// names is read once, when the stage is built, and shared by the rules that
+// use it.
+func NewValidateStage(cfg interfaces.ValidationConfig, lookups map[string]interfaces.LookupConfig) (*ValidateStage, error) {
+	v := &ValidateStage{name: "validate"}
+	sets := map[string]map[string]struct{}{}
+	for _, spec := range cfg.Rules {
+		if m := inSourceRule.FindStringSubmatch(strings.TrimSpace(spec)); m != nil {
+			field, name := m[1], strings.ToLower(m[2])
+			set, ok := sets[name]
+			if !ok {
+				var err error
+				if set, err = loadLookupSet(name, lookups); err != nil {
+					return nil, fmt.Errorf("invalid validation rule %q: %w", spec, err)
+				}
+				sets[name] = set
+			}
+			// An optional lookup that is unavailable leaves no set, and no rule
+			if set != nil {
+				v.rules = append(v.rules, inSourceCheck(field, name, set))
+			}
+			continue
+		}
+		if m := isPhoneRule.FindStringSubmatch(strings.TrimSpace(spec)); m != nil {
+			if err := checkPhoneRegion(m[2]); err != nil {
+				return nil, fmt.Errorf("invalid validation rule %q: %w", spec, err)
+			}
+			v.rules = append(v.rules, isPhoneCheck(m[1], m[2]))
+			continue
+		}
+		node, err := language.ParseRule(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid validation rule: %w", err)
+		}
+		v.rules = append(v.rules, func(rec Record) error {
+			return language.Evaluate(node, rec.Strings())
+		})
+	}
+	return v, nil
+}
+
+// Name returns the stage name, validate:<set> for a named rule set
+func (v *ValidateStage) Name() string {
+	return v.name
+}
+
+// Process passes the record on when it meets every rule
+func (v *ValidateStage) Process(rec Record) ([]Record, error) {
+	for _, check := range v.rules {
+		if err := check(rec); err != nil {
+			return nil, interfaces.Wrap(interfaces.ErrValidation, err)
+		}
+	}
+	return []Record{rec}, nil
+}
+
+// Flush has nothing to emit, validating doesn't buffer
+func (v *ValidateStage) Flush() ([]Record, error) {
+	return nil, nil
+}
+
+// buildValidateStage builds the validate stage of the main rules, or of the
+// named rule set. Set names are matched without case, as configuration keys are.
+func buildValidateStage(cfg interfaces.PipelineConfig, set string) (Stage, error) {
+	if set == "" {
+		return NewValidateStage(cfg.Validate, cfg.Lookups)
+	}
+	for name, rules := range cfg.Validate.Sets {
+		if strings.ToLower(name) != set {
+			continue
+		}
+		if len(rules) == 0 {
+			return nil, fmt.Errorf("validation set %s has no rules", name)
+		}
+		v, err := NewValidateStage(interfaces.ValidationConfig{Rules: rules}, cfg.Lookups)
+		if err != nil {
+			return nil, err
+		}
+		v.name = "validate:" + set
+		return v, nil
+	}
+	return nil, fmt.Errorf("unknown validation set %s in stages", set)
+}
+
+// loadLookupSet reads the key values of a named lookup, or returns a nil set
+// when an optional lookup cannot be fetched. Names are matched without case,
+// as configuration keys are.
+func loadLookupSet(name string, lookups map[string]interfaces.LookupConfig) (map[string]struct{}, error) {
+	var cfg interfaces.LookupConfig
+	found := false
+	for key, lookup := range lookups {
+		if strings.ToLower(key) == name {
+			cfg, found = lookup, true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown lookup %s", name)
+	}
+	if cfg.Input == "" || cfg.Key == "" {
+		return nil, fmt.Errorf("lookup %s needs an input and a key", name)
+	}
+	maxRecords := cfg.MaxRecords
+	if maxRecords <= 0 {
+		maxRecords = DefaultMaxLookupRecords
+	}
+
+	records, err := fetchLookup(cfg.Input, cfg.Request, maxRecords)
+	if lookupUnavailable(err, cfg.Optional, name) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]struct{}, len(records))
+	for _, rec := range records {
+		if value, ok := joinValue(rec, cfg.Key); ok {
+			set[value] = struct{}{}
+		}
+	}
+	return set, nil
+}
+
+// inSourceCheck fails records whose field is missing, null or not in the set
+func inSourceCheck(field, name string, set map[string]struct{}) validateFunc {
+	return func(rec Record) error {
+		value, ok := joinValue(rec, field)
+		if !ok {
+			return fmt.Errorf("field %s is missing, expected a value in lookup %s", field, name)
+		}
+		if _, ok := set[value]; !ok {
+			return fmt.Errorf("value %q of %s is not in lookup %s", value, field, name)
+		}
+		return nil
+	}
+}
+
+// isPhoneCheck fails records whose field is missing, null or not a phone
+// number, reading numbers without a country code as numbers of region
+func isPhoneCheck(field, region string) validateFunc {
+	return func(rec Record) error {
+		value, ok := rec[field]
+		if !ok || value == nil {
+			return fmt.Errorf("field %s is missing, expected a phone number", field)
+		}
+		if _, err := NormalizePhone(fmt.Sprint(value), region); err != nil {
+			return fmt.Errorf("field %s: %w", field, err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,73 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/language"
+)
+
+// whenKeyword starts a conditional transformation
+const whenKeyword = "when"
+
+// maxWhenDepth is how deep when rules nest: one when inside another
+const maxWhenDepth = 1
+
+func init() {
+	// parseTransform reads when rules from their text, as the predicate keeps its quotes
+	registerTransform(TransformRule{
+		Keyword:     whenKeyword,
+		Syntax:      `when <predicate> then <transformation>`,
+		Description: "Applies the transformation only to records matching the predicate, written in the validation rule grammar",
+	})
+}
+
+// parseWhenRule reads a when rule, whose transformation may be another when rule
+func parseWhenRule(spec string, cfg interfaces.TransformConfig, depth int, tokens *tokenMaps) (expandFunc, error) {
+	if depth > maxWhenDepth {
+		return nil, fmt.Errorf("when rules nest only %d level deep", maxWhenDepth)
+	}
+	body := strings.TrimSpace(spec)[len(whenKeyword):]
+	predicate, inner, ok := cutThen(body)
+	if !ok || strings.TrimSpace(predicate) == "" || strings.TrimSpace(inner) == "" {
+		return nil, fmt.Errorf("missing the predicate or the transformation, expected when <predicate> then <transformation>")
+	}
+	node, err := language.ParseRule(strings.TrimSpace(predicate))
+	if err != nil {
+		return nil, fmt.Errorf("invalid predicate: %w", err)
+	}
+	apply, err := parseTransform(strings.TrimSpace(inner), cfg, depth+1, tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(rec Record) ([]Record, error) {
+		// Records that don't match are left untouched
+		if language.Evaluate(node, rec.Strings()) != nil {
+			return []Record{rec}, nil
+		}
+		return apply(rec)
+	}, nil
+}
+
+// cutThen splits text at the first then that stands as a word outside quotes
+func cutThen(text string) (before, after string, found bool) {
+	var quote rune
+	runes := []rune(text)
+	for i, r := range runes {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case (i == 0 || unicode.IsSpace(runes[i-1])) && i+4 <= len(runes) &&
+			strings.EqualFold(string(runes[i:i+4]), "then") && (i+4 == len(runes) || unicode.IsSpace(runes[i+4])):
+			return string(runes[:i]), string(runes[i+4:]), true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,262 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+// Kinds of window and of time a window stage understands
+const (
+	WindowTumbling   = "tumbling"
+	WindowSliding    = "sliding"
+	WindowEventTime  = "event"
+	WindowProcessing = "processing"
+)
+
+// What a window stage does with an event too late for its windows
+const (
+	LateDrop       = "drop"
+	LateQuarantine = "quarantine"
+)
+
+// Fields window records hold the bounds of their window in
+const (
+	WindowStartField = "window_start"
+	WindowEndField   = "window_end"
+)
+
+// WindowStage aggregates records over windows of time. Windows close once
+// the latest event time seen, or the clock for processing time, passes their
+// end plus the allowed lateness, and each is then emitted as one record per
+// group. The windows still open when the source is exhausted are emitted by
+// Flush.
+type WindowStage struct {
+	size         time.Duration
+	slide        time.Duration // Equal to size for tumbling windows
+	timeField    string
+	layout       timeLayout
+	lateness     time.Duration
+	late         string
+	groupBy      []string
+	aggregations []aggregation
+	now          func() time.Time // Clock for processing time, nil for event time
+
+	windows   map[int64]map[string]*groupState // Groups of the open windows, by the start of the window in Unix nanoseconds
+	watermark time.Time
+}
+
+// NewWindowStage parses the window settings
+func NewWindowStage(cfg interfaces.WindowConfig) (*WindowStage, error) {
+	w := &WindowStage{
+		timeField: cfg.TimeField,
+		groupBy:   cfg.GroupBy,
+		late:      LateDrop,
+		windows:   make(map[int64]map[string]*groupState),
+	}
+	var err error
+	if w.size, err = windowDuration("size", cfg.Size); err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(cfg.Type) {
+	case "", WindowTumbling:
+		if cfg.Slide != "" {
+			return nil, fmt.Errorf("window slide is only set for sliding windows")
+		}
+		w.slide = w.size
+	case WindowSliding:
+		if w.slide, err = windowDuration("slide", cfg.Slide); err != nil {
+			return nil, err
+		}
+		if w.slide > w.size {
+			return nil, fmt.Errorf("window slide %s is longer than the window size %s", cfg.Slide, cfg.Size)
+		}
+	default:
+		return nil, fmt.Errorf("invalid window type %q: expected tumbling or sliding", cfg.Type)
+	}
+
+	switch strings.ToLower(cfg.Time) {
+	case "", WindowEventTime:
+		if cfg.TimeField == "" {
+			return nil, fmt.Errorf("event time windows need a timefield")
+		}
+		layout := cfg.TimeLayout
+		if layout == "" {
+			layout = "iso8601"
+		}
+		if w.layout, err = parseTimeLayout(layout); err != nil {
+			return nil, fmt.Errorf("invalid window timelayout: %w", err)
+		}
+		if cfg.AllowedLateness != "" {
+			if w.lateness, err = time.ParseDuration(cfg.AllowedLateness); err != nil || w.lateness < 0 {
+				return nil, fmt.Errorf("invalid window allowedlateness %q: must be a duration such as 30s", cfg.AllowedLateness)
+			}
+		}
+	case WindowProcessing:
+		if cfg.TimeField != "" || cfg.TimeLayout != "" || cfg.AllowedLateness != "" {
+			return nil, fmt.Errorf("window timefield, timelayout and allowedlateness are only read for event time")
+		}
+		w.now = time.Now
+	default:
+		return nil, fmt.Errorf("invalid window time %q: expected event or processing", cfg.Time)
+	}
+
+	switch strings.ToLower(cfg.Late) {
+	case "", LateDrop:
+	case LateQuarantine:
+		w.late = LateQuarantine
+	default:
+		return nil, fmt.Errorf("invalid window late %q: expected drop or quarantine", cfg.Late)
+	}
+
+	reserved := append([]string{WindowStartField, WindowEndField}, cfg.GroupBy...)
+	if w.aggregations, err = parseAggregations(cfg.Aggregations, reserved); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// windowDuration reads a positive duration setting
+func windowDuration(name, value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid window %s %q: must be a positive duration such as 5m", name, value)
+	}
+	return d, nil
+}
+
+// Name returns the stage name
+func (w *WindowStage) Name() string {
+	return "window"
+}
+
+// Process adds the record to the open windows its time falls in and emits
+// the windows that close. A record whose windows have all closed is late.
+func (w *WindowStage) Process(rec Record) ([]Record, error) {
+	var at time.Time
+	if w.now != nil {
+		at = w.now()
+	} else {
+		value, ok := rec[w.timeField]
+		if !ok || value == nil || value == "" {
+			return nil, fmt.Errorf("record has no event time in field %s", w.timeField)
+		}
+		var err error
+		if at, err = w.layout.parse(value, time.UTC); err != nil {
+			return nil, fmt.Errorf("cannot parse field %s value %q as %s", w.timeField, fmt.Sprint(value), w.layout.name)
+		}
+	}
+	numbers, present, err := aggregationInputs(w.aggregations, rec)
+	if err != nil {
+		return nil, err
+	}
+	key, values, err := groupKey(w.groupBy, rec)
+	if err != nil {
+		return nil, err
+	}
+
+	if at.After(w.watermark) {
+		w.watermark = at
+	}
+	added := false
+	for _, start := range w.starts(at) {
+		if w.closed(start) {
+			continue
+		}
+		groups, ok := w.windows[start.UnixNano()]
+		if !ok {
+			groups = make(map[string]*groupState)
+			w.windows[start.UnixNano()] = groups
+		}
+		group, ok := groups[key]
+		if !ok {
+			group = &groupState{Key: key, Values: values, Aggs: make([]aggState, len(w.aggregations))}
+			groups[key] = group
+		}
+		group.add(numbers, present)
+		added = true
+	}
+	// A late event is older than the latest, so no window closes on it
+	if !added {
+		if w.late == LateQuarantine {
+			return nil, fmt.Errorf("%w: event at %s is later than its windows allow", ErrQuarantine, at.Format(time.RFC3339Nano))
+		}
+		return nil, ErrFiltered
+	}
+	return w.emit(false), nil
+}
+
+// Flush emits the windows still open
+func (w *WindowStage) Flush() ([]Record, error) {
+	return w.emit(true), nil
+}
+
+// Columns lists the group fields, the window bounds and the aggregations
+func (w *WindowStage) Columns(previous []string) []string {
+	columns := append([]string{}, w.groupBy...)
+	columns = append(columns, WindowStartField, WindowEndField)
+	for _, agg := range w.aggregations {
+		columns = append(columns, agg.name)
+	}
+	return columns
+}
+
+// starts returns the starts of the windows a time falls in. Windows start at
+// whole multiples of the slide since the Unix epoch, so a 5m window starts
+// on the hour and every five minutes after.
+func (w *WindowStage) starts(at time.Time) []time.Time {
+	offset := time.Duration(at.UnixNano() % int64(w.slide))
+	if offset < 0 {
+		offset += w.slide
+	}
+	var starts []time.Time
+	for start := at.Add(-offset); start.After(at.Add(-w.size)); start = start.Add(-w.slide) {
+		starts = append(starts, start)
+	}
+	return starts
+}
+
+// closed says whether the window starting at start is past waiting for events
+func (w *WindowStage) closed(start time.Time) bool {
+	return !w.watermark.Before(start.Add(w.size + w.lateness))
+}
+
+// emit removes the closed windows, or all of them, and returns their records
+// ordered by the start of the window and then by group
+func (w *WindowStage) emit(all bool) []Record {
+	var starts []int64
+	for start := range w.windows {
+		if all || w.closed(time.Unix(0, start)) {
+			starts = append(starts, start)
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	var records []Record
+	for _, start := range starts {
+		groups := w.windows[start]
+		delete(w.windows, start)
+		keys := make([]string, 0, len(groups))
+		for key := range groups {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		begin := time.Unix(0, start).UTC()
+		for _, key := range keys {
+			group := groups[key]
+			rec := Record{
+				WindowStartField: begin.Format(time.RFC3339Nano),
+				WindowEndField:   begin.Add(w.size).Format(time.RFC3339Nano),
+			}
+			for i, field := range w.groupBy {
+				rec[field] = group.Values[i]
+			}
+			setAggregates(rec, w.aggregations, group.Aggs)
+			records = append(records, rec)
+		}
+	}
+	return records
+}
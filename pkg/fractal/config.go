@@ -0,0 +1,348 @@
+package fractal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/SkySingh04/fractal/config"
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+)
+
+// LoadConfig reads the config file at path, yaml or json by its extension,
+// resolves its connections, profile and secret files, and checks it as
+// ConfigFromMap does. An empty profile means $FRACTAL_PROFILE, if set.
+func LoadConfig(path, profile string) (Config, error) {
+	configuration, err := config.LoadConfig(path, "")
+	if err != nil {
+		return Config{}, interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("failed to load %s: %w", path, err))
+	}
+	if err := config.ResolveConnections(configuration); err != nil {
+		return Config{}, interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("failed to resolve connections: %w", err))
+	}
+	if err := config.ApplyProfile(configuration, config.ProfileName(profile)); err != nil {
+		return Config{}, interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("failed to apply profile: %w", err))
+	}
+	if err := config.ResolveSecrets(configuration); err != nil {
+		return Config{}, interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("failed to read secrets: %w", err))
+	}
+	return ConfigFromMap(configuration)
+}
+
+// ConfigFromMap builds the Config of a configuration shaped like a config
+// file, once its connections, profile and secrets are resolved. It checks the
+// input and output configs are there with their required fields.
+func ConfigFromMap(configuration map[string]interface{}) (Config, error) {
+	inputconfig, ok := configuration["inputconfig"].(map[string]interface{})
+	if !ok {
+		return Config{}, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing 'inputconfig' in configuration"))
+	}
+	outputconfig, ok := configuration["outputconfig"].(map[string]interface{})
+	if !ok {
+		return Config{}, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing 'outputconfig' in configuration"))
+	}
+	if _, ok := configuration["errorhandling"]; !ok {
+		return Config{}, interfaces.Wrap(interfaces.ErrConfigInvalid, errors.New("missing 'errorhandling' in configuration"))
+	}
+	if err := config.CheckRequiredFields(configuration); err != nil {
+		return Config{}, err
+	}
+	pipelineConfig, err := PipelineFromMap(configuration)
+	if err != nil {
+		return Config{}, err
+	}
+	input, _ := configuration["inputMethod"].(string)
+	output, _ := configuration["outputMethod"].(string)
+	return Config{
+		Input:       input,
+		Source:      RequestFromMap(inputconfig),
+		Output:      output,
+		Destination: RequestFromMap(outputconfig),
+		Pipeline:    pipelineConfig,
+	}, nil
+}
+
+func getStringField(config map[string]interface{}, field string, defaultValue string) string {
+	if value, ok := config[field]; ok && value != nil {
+		switch v := value.(type) {
+		case string:
+			return v
+		case map[string]interface{}:
+			// Extract "strategy" or similar key from nested map if applicable
+			if strategy, exists := v["strategy"]; exists {
+				return strategy.(string)
+			}
+			return fmt.Sprintf("%v", v) // Fallback for other maps
+		case []interface{}:
+			return fmt.Sprintf("%v", v)
+		default:
+			logger.Infof("Unexpected type for field %s: %T", field, v)
+		}
+	}
+	return defaultValue
+}
+
+// getStringListField reads a YAML list, or a comma separated string as the interactive setup stores it
+func getStringListField(config map[string]interface{}, field string) []string {
+	var list []string
+	switch v := config[field].(type) {
+	case []interface{}:
+		for _, item := range v {
+			list = append(list, fmt.Sprint(item))
+		}
+	case []string:
+		list = v
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// getStringMapField reads a YAML map, or comma separated key=value pairs as the
+// interactive setup stores them. Values are kept as written, numbers included.
+func getStringMapField(config map[string]interface{}, field string) map[string]string {
+	var values map[string]string
+	switch v := config[field].(type) {
+	case map[string]interface{}:
+		values = make(map[string]string, len(v))
+		for key, value := range v {
+			values[key] = fmt.Sprint(value)
+		}
+	case map[string]string:
+		values = v
+	case string:
+		for _, pair := range strings.Split(v, ",") {
+			key, value, _ := strings.Cut(pair, "=")
+			if key = strings.TrimSpace(key); key != "" {
+				if values == nil {
+					values = map[string]string{}
+				}
+				values[key] = strings.TrimSpace(value)
+			}
+		}
+	}
+	return values
+}
+
+// getBoolField reads a YAML boolean, or a string such as "false" as the interactive
+// setup stores it. It returns nil when the field is unset so callers can apply their default.
+func getBoolField(config map[string]interface{}, field string) *bool {
+	switch v := config[field].(type) {
+	case bool:
+		return &v
+	case string:
+		if parsed, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+			return &parsed
+		}
+	}
+	return nil
+}
+
+// getIntField reads a YAML number, or a numeric string as the interactive setup stores it
+func getIntField(config map[string]interface{}, field string, defaultValue int) int {
+	switch v := config[field].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	case string:
+		if parsed, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// boolValue dereferences a field read by getBoolField, falling back to defaultValue when it is unset
+func boolValue(value *bool, defaultValue bool) bool {
+	if value == nil {
+		return defaultValue
+	}
+	return *value
+}
+
+// RequestFromMap reads the settings of an integration from its inputconfig or
+// outputconfig, keyed in lower case as config files are read
+func RequestFromMap(config map[string]interface{}) interfaces.Request {
+	return interfaces.Request{
+		Input:                     getStringField(config, "inputmethod", ""),
+		Output:                    getStringField(config, "outputmethod", ""),
+		ValidationRules:           getStringField(config, "validations", ""),
+		TransformationRules:       getStringField(config, "transformations", ""),
+		ErrorHandling:             getStringField(config, "errorhandling", ""),
+		RabbitMQInputURL:          getStringField(config, "url", ""),
+		RabbitMQInputQueueName:    getStringField(config, "queuename", ""),
+		RabbitMQOutputURL:         getStringField(config, "url", ""),
+		RabbitMQOutputQueueName:   getStringField(config, "queuename", ""),
+		ConsumerURL:               getStringField(config, "url", ""),
+		ConsumerTopic:             getStringField(config, "topic", ""), // Default is empty if "topic" is missing
+		KafkaStartOffset:          getStringField(config, "startoffset", ""),
+		ProducerURL:               getStringField(config, "url", ""),
+		ProducerTopic:             getStringField(config, "topic", ""),
+		SQLSourceConnString:       getStringField(config, "connstring", ""),
+		SQLTargetConnString:       getStringField(config, "connstring", ""),
+		SQLSourceIncremental:      boolValue(getBoolField(config, "incremental"), false),
+		SQLSourceWatermarkColumn:  getStringField(config, "watermarkcolumn", ""),
+		SQLSourceCheckpointFile:   getStringField(config, "checkpointfile", ""),
+		SQLTargetConflictColumns:  getStringListField(config, "conflictcolumns"),
+		SQLTargetPreSQL:           getStringListField(config, "presql"),
+		SQLTargetPostSQL:          getStringListField(config, "postsql"),
+		SQLTargetPostSQLFatal:     boolValue(getBoolField(config, "postsqlfatal"), false),
+		SQLTargetTable:            getStringField(config, "table", ""),
+		SQLTargetSchemaCheck:      boolValue(getBoolField(config, "schemacheck"), false),
+		SourceMongoDBConnString:   getStringField(config, "connstring", ""),
+		SourceMongoDBDatabase:     getStringField(config, "database", ""),
+		SourceMongoDBCollection:   getStringField(config, "collection", ""),
+		TargetMongoDBConnString:   getStringField(config, "connstring", ""),
+		TargetMongoDBDatabase:     getStringField(config, "database", ""),
+		TargetMongoDBCollection:   getStringField(config, "collection", ""),
+		OutputFileName:            getStringField(config, "filename", ""),
+		CSVSourceFileName:         getStringField(config, "csvsourcefilename", ""),
+		CSVDestinationFileName:    getStringField(config, "csvdestinationfilename", ""),
+		CSVSourceHasHeader:        getBoolField(config, "csvsourcehasheader"),
+		CSVSourceColumns:          getStringListField(config, "csvsourcecolumns"),
+		CSVSourceSkipLines:        getIntField(config, "csvsourceskiplines", 0),
+		CSVSourceCommentPrefix:    getStringField(config, "csvsourcecommentprefix", ""),
+		CSVSourceTrimSpace:        boolValue(getBoolField(config, "csvsourcetrimspace"), false),
+		CSVSourceCollapseSpace:    boolValue(getBoolField(config, "csvsourcecollapsespace"), false),
+		CSVSourceExpectedHeader:   getStringListField(config, "csvsourceexpectedheader"),
+		CSVSourceAllowReorder:     boolValue(getBoolField(config, "csvsourceallowreorder"), false),
+		CSVDestinationColumns:     getStringListField(config, "csvdestinationcolumns"),
+		CSVDestinationWriteHeader: getBoolField(config, "csvdestinationwriteheader"),
+		CSVDestinationQuoteMode:   getStringField(config, "csvdestinationquotemode", ""),
+		BigQueryProjectID:         getStringField(config, "projectid", ""),
+		BigQueryDataset:           getStringField(config, "dataset", ""),
+		BigQueryTable:             getStringField(config, "table", ""),
+		BigQueryCredentialsFile:   getStringField(config, "credentialsfile", ""),
+		BigQuerySchema:            getStringListField(config, "schema"),
+		BigQueryWriteDisposition:  getStringField(config, "writedisposition", ""),
+		BigQueryLoadJobRows:       getIntField(config, "loadjobrows", 0),
+		SnowflakeAccount:          getStringField(config, "account", ""),
+		SnowflakeUser:             getStringField(config, "user", ""),
+		SnowflakePassword:         getStringField(config, "password", ""),
+		SnowflakePrivateKeyFile:   getStringField(config, "privatekeyfile", ""),
+		SnowflakeWarehouse:        getStringField(config, "warehouse", ""),
+		SnowflakeDatabase:         getStringField(config, "database", ""),
+		SnowflakeSchema:           getStringField(config, "schema", ""),
+		SnowflakeRole:             getStringField(config, "role", ""),
+		SnowflakeTable:            getStringField(config, "table", ""),
+		SnowflakeStage:            getStringField(config, "stage", ""),
+		PulsarURL:                 getStringField(config, "url", ""),
+		PulsarTopic:               getStringField(config, "topic", ""),
+		PulsarSubscription:        getStringField(config, "subscription", ""),
+		PulsarSubscriptionType:    getStringField(config, "subscriptiontype", ""),
+		PulsarMaxMessages:         getIntField(config, "maxmessages", 0),
+		PulsarReceiveTimeout:      getStringField(config, "receivetimeout", ""),
+		PulsarKeyField:            getStringField(config, "keyfield", ""),
+		PulsarBatchSize:           getIntField(config, "batchsize", 0),
+		PulsarToken:               getStringField(config, "token", ""),
+		PulsarTLSTrustCertsFile:   getStringField(config, "tlstrustcertsfile", ""),
+		PulsarTLSCertFile:         getStringField(config, "tlscertfile", ""),
+		PulsarTLSKeyFile:          getStringField(config, "tlskeyfile", ""),
+		NATSURL:                   getStringField(config, "url", ""),
+		NATSSubject:               getStringField(config, "subject", ""),
+		NATSStream:                getStringField(config, "stream", ""),
+		NATSDurable:               getStringField(config, "durable", ""),
+		NATSMaxMessages:           getIntField(config, "maxmessages", 0),
+		NATSReceiveTimeout:        getStringField(config, "receivetimeout", ""),
+		NATSAckWait:               getStringField(config, "ackwait", ""),
+		NATSCredsFile:             getStringField(config, "credsfile", ""),
+		NATSToken:                 getStringField(config, "token", ""),
+		SQSQueueURL:               getStringField(config, "queueurl", ""),
+		SQSMaxMessages:            getIntField(config, "maxmessages", 0),
+		SQSWaitTime:               getStringField(config, "waittime", ""),
+		SQSVisibilityTimeout:      getStringField(config, "visibilitytimeout", ""),
+		SQSAttributes:             getStringListField(config, "attributes"),
+		SQSGroupField:             getStringField(config, "groupfield", ""),
+		SNSTopicARN:               getStringField(config, "topicarn", ""),
+		AWSRegion:                 getStringField(config, "region", ""),
+		ExcelSourceFileName:       getStringField(config, "excelsourcefilename", ""),
+		ExcelSourceSheet:          getStringField(config, "excelsourcesheet", ""),
+		ExcelDestinationFileName:  getStringField(config, "exceldestinationfilename", ""),
+		ExcelDestinationSheet:     getStringField(config, "exceldestinationsheet", ""),
+		StdoutFormat:              getStringField(config, "stdoutformat", ""),
+		Format:                    getStringField(config, "format", ""),
+		MemoryName:                getStringField(config, "memoryname", ""),
+		SourceRecursive:           boolValue(getBoolField(config, "recursive"), false),
+		SourceFileField:           getStringField(config, "filefield", ""),
+		SourceArchiveEntries:      getStringField(config, "archiveentries", ""),
+		Compression:               getStringField(config, "compression", ""),
+		Encoding:                  getStringField(config, "encoding", ""),
+		PageSize:                  getIntField(config, "pagesize", 0),
+		PageRetries:               getIntField(config, "pageretries", 0),
+		PageRetryBackoff:          getStringField(config, "pageretrybackoff", ""),
+		MaxInFlight:               getIntField(config, "maxinflight", 0),
+		Options:                   getStringMapField(config, "options"),
+		OutputMode:                getStringField(config, "outputmode", ""),
+		OutputMaxRows:             getIntField(config, "outputmaxrows", 0),
+		OutputMaxBytes:            getIntField(config, "outputmaxbytes", 0),
+		PartitionBy:               getStringListField(config, "partitionby"),
+		PartitionMaxOpenWriters:   getIntField(config, "partitionmaxopenwriters", 0),
+		PartitionEmptyValue:       getStringField(config, "partitionemptyvalue", ""),
+		JSONSourceData:            getStringField(config, "data", ""),
+		JSONOutputFilename:        getStringField(config, "filename", ""),
+		YAMLSourceFilePath:        getStringField(config, "filepath", ""),
+		YAMLDestinationFilePath:   getStringField(config, "filepath", ""),
+		DynamoDBSourceTable:       getStringField(config, "tablename", ""),
+		DynamoDBTargetTable:       getStringField(config, "tablename", ""),
+		DynamoDBSourceRegion:      getStringField(config, "region", ""),
+		DynamoDBTargetRegion:      getStringField(config, "region", ""),
+		AWSRoleARN:                getStringField(config, "rolearn", ""),
+		AWSExternalID:             getStringField(config, "externalid", ""),
+		AWSFailoverRegions:        getStringListField(config, "failoverregions"),
+		FTPFILEPATH:               getStringField(config, "ftpfilepath", ""),
+		FTPURL:                    getStringField(config, "url", ""),
+		FTPUser:                   getStringField(config, "user", ""),
+		FTPPassword:               getStringField(config, "password", ""),
+		SFTPFILEPATH:              getStringField(config, "sftpfilepath", ""),
+		SFTPURL:                   getStringField(config, "url", ""),
+		SFTPUser:                  getStringField(config, "user", ""),
+		SFTPPassword:              getStringField(config, "password", ""),
+		ChunkSize:                 getIntField(config, "chunksize", 0),
+		ChunkRetries:              getIntField(config, "chunkretries", 0),
+		ChunkRetryBackoff:         getStringField(config, "chunkretrybackoff", ""),
+		WebSocketSourceURL:        getStringField(config, "url", ""),
+		WebSocketDestURL:          getStringField(config, "url", ""),
+		CredentialFileAddr:        getStringField(config, "credentialfileaddr", "firebaseConfig.json"),
+		Document:                  getStringField(config, "document", "sampledata"),
+		Collection:                getStringField(config, "collection", "1"),
+	}
+}
+
+// PipelineFromMap reads the pipeline stage settings from the top level of the configuration
+func PipelineFromMap(config map[string]interface{}) (interfaces.PipelineConfig, error) {
+	var pipelineConfig interfaces.PipelineConfig
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return pipelineConfig, interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("failed to read pipeline configuration: %w", err))
+	}
+	if err := json.Unmarshal(raw, &pipelineConfig); err != nil {
+		return pipelineConfig, interfaces.Wrap(interfaces.ErrConfigInvalid, fmt.Errorf("invalid pipeline configuration: %w", err))
+	}
+	// The lookup source is configured like any other input
+	if join, ok := config["join"].(map[string]interface{}); ok {
+		if joinconfig, ok := join["inputconfig"].(map[string]interface{}); ok {
+			req := RequestFromMap(joinconfig)
+			pipelineConfig.Join.Request = &req
+		}
+	}
+	if lookups, ok := config["lookups"].(map[string]interface{}); ok {
+		for name, lookup := range lookups {
+			lookup, _ := lookup.(map[string]interface{})
+			if inputconfig, ok := lookup["inputconfig"].(map[string]interface{}); ok {
+				req := RequestFromMap(inputconfig)
+				cfg := pipelineConfig.Lookups[name]
+				cfg.Request = &req
+				pipelineConfig.Lookups[name] = cfg
+			}
+		}
+	}
+	return pipelineConfig, nil
+}
@@ -0,0 +1,95 @@
+// Package fractal runs pipelines from Go code. The CLI and the HTTP server
+// are layers over Run, so a service embedding it gets the same runs they do.
+package fractal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	_ "github.com/SkySingh04/fractal/integrations" // Registers the integrations Run looks up
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+	"github.com/SkySingh04/fractal/pipeline"
+	"github.com/SkySingh04/fractal/registry"
+	"github.com/google/uuid"
+)
+
+// Config describes one run: the integrations, their settings and the stages
+// between them. ConfigFromMap and LoadConfig build one from a config file's
+// contents.
+type Config struct {
+	Input       string                    // Registered source, such as CSV or Kafka
+	Source      interfaces.Request        // Settings of the source
+	Output      string                    // Registered destination
+	Destination interfaces.Request        // Settings of the destination
+	Pipeline    interfaces.PipelineConfig // Validations, transformations, error handling, delivery and the rest
+	RunID       string                    // Identifies the run in logs and reports, generated when empty
+}
+
+// Summary is the outcome of a run: its status, counts, timings and, for a
+// failed run, the error and its code. It is the report the CLI writes.
+type Summary = pipeline.Report
+
+// Error is the error of a run that failed or could not start. Code tells the
+// kind of failure apart, and errors.Is matches the kinds in interfaces and
+// pipeline.ErrTimeout through it.
+type Error struct {
+	Code string // config_invalid, connection, validation, transform, write, timeout or empty_input; "" when unknown
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Run runs the pipeline cfg describes once and returns its summary, which
+// is filled in whether the run succeeded or not. It never prompts or exits,
+// and gives up once ctx is done. Log lines go through the logger package,
+// to standard output unless logger.SetOutput sends them elsewhere. The
+// configured notifications are sent once the run has finished.
+func Run(ctx context.Context, cfg Config) (Summary, error) {
+	startedAt := time.Now()
+	if cfg.RunID == "" {
+		cfg.RunID = uuid.NewString()
+	}
+	source, found := registry.GetSource(cfg.Input)
+	if !found {
+		return failedToStart(cfg, startedAt, fmt.Errorf("input method %s not registered", cfg.Input))
+	}
+	destination, found := registry.GetDestination(cfg.Output)
+	if !found {
+		return failedToStart(cfg, startedAt, fmt.Errorf("output method %s not registered", cfg.Output))
+	}
+
+	p := &pipeline.Pipeline{
+		Source:             source,
+		SourceName:         cfg.Input,
+		SourceRequest:      cfg.Source,
+		Destination:        destination,
+		DestinationRequest: cfg.Destination,
+		Config:             cfg.Pipeline,
+		RunID:              cfg.RunID,
+	}
+	summary, err := p.Run(ctx)
+	report := pipeline.NewReport(cfg.Input, cfg.Output, startedAt, summary, err)
+	if notifyErr := pipeline.Notify(ctx, cfg.Pipeline.Notifications, report); notifyErr != nil {
+		logger.Infof("Run notification failed: %v", notifyErr)
+	}
+	if err != nil {
+		return *report, &Error{Code: report.ErrorCode, Err: err}
+	}
+	return *report, nil
+}
+
+// failedToStart returns the summary and error of a run whose integrations
+// could not be found
+func failedToStart(cfg Config, startedAt time.Time, err error) (Summary, error) {
+	err = interfaces.Wrap(interfaces.ErrConfigInvalid, err)
+	report := pipeline.NewReport(cfg.Input, cfg.Output, startedAt, &pipeline.Summary{RunID: cfg.RunID}, err)
+	return *report, &Error{Code: report.ErrorCode, Err: err}
+}
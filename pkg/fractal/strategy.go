@@ -0,0 +1,53 @@
+package fractal
+
+import (
+	"errors"
+
+	"github.com/SkySingh04/fractal/logger"
+	"github.com/SkySingh04/fractal/pipeline"
+)
+
+// StrategyFlag returns the error strategy --fail-fast or --keep-going
+// forces. When neither is given it returns outer, the strategy a flag given
+// before the command forces, so a flag given to a command beats one given
+// before it. The two flags cannot be given together.
+func StrategyFlag(failFast, keepGoing bool, outer string) (string, error) {
+	switch {
+	case failFast && keepGoing:
+		return "", errors.New("--fail-fast and --keep-going cannot be used together")
+	case failFast:
+		return pipeline.StrategyStopOnError, nil
+	case keepGoing:
+		return pipeline.StrategyLogAndContinue, nil
+	}
+	return outer, nil
+}
+
+// OverrideStrategy replaces errorhandling.strategy with the one a flag forces,
+// so the effective configuration shows what the run uses. Without a flag the
+// configured strategy is kept, and without either the pipeline's default,
+// STOP_ON_ERROR, applies.
+func OverrideStrategy(configuration map[string]interface{}, strategy string) {
+	if strategy == "" {
+		return
+	}
+	errorhandling, ok := configuration["errorhandling"].(map[string]interface{})
+	if !ok {
+		errorhandling = make(map[string]interface{})
+		configuration["errorhandling"] = errorhandling
+	}
+	configured, _ := errorhandling["strategy"].(string)
+	if configured == "" {
+		configured = pipeline.StrategyStopOnError + " by default"
+	}
+	errorhandling["strategy"] = strategy
+	logger.Infof("Error strategy %s from %s overrides errorhandling.strategy %s", strategy, strategyFlagName(strategy), configured)
+}
+
+// strategyFlagName returns the flag forcing the strategy
+func strategyFlagName(strategy string) string {
+	if strategy == pipeline.StrategyStopOnError {
+		return "--fail-fast"
+	}
+	return "--keep-going"
+}
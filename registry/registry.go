@@ -1,36 +1,116 @@
 package registry
 
-import "github.com/SkySingh04/fractal/interfaces"
+import (
+	"sort"
+	"strings"
+	"sync"
 
+	"github.com/SkySingh04/fractal/interfaces"
+)
+
+// mu guards the maps, as integrations register from init() while a server
+// may already be listing them
 var (
+	mu               sync.RWMutex
 	dataSources      = make(map[string]interfaces.DataSource)
 	dataDestinations = make(map[string]interfaces.DataDestination)
+	codecs           = make(map[string]interfaces.Codec)
 )
 
 func RegisterSource(name string, source interfaces.DataSource) {
+	mu.Lock()
+	defer mu.Unlock()
 	dataSources[name] = source
 }
 
 func RegisterDestination(name string, destination interfaces.DataDestination) {
+	mu.Lock()
+	defer mu.Unlock()
 	dataDestinations[name] = destination
 }
 
+// UnregisterSource removes a source, so a test can take back one it registered
+func UnregisterSource(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(dataSources, name)
+}
+
+// UnregisterDestination removes a destination, so a test can take back one it registered
+func UnregisterDestination(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(dataDestinations, name)
+}
+
 func GetSource(name string) (interfaces.DataSource, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
 	source, exists := dataSources[name]
 	return source, exists
 }
 
 func GetDestination(name string) (interfaces.DataDestination, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
 	destination, exists := dataDestinations[name]
 	return destination, exists
 }
 
-// GetSources returns all registered data sources
+// GetSources returns all registered data sources, as a copy that later
+// registrations leave alone
 func GetSources() map[string]interfaces.DataSource {
-	return dataSources
+	mu.RLock()
+	defer mu.RUnlock()
+	sources := make(map[string]interfaces.DataSource, len(dataSources))
+	for name, source := range dataSources {
+		sources[name] = source
+	}
+	return sources
 }
 
-// GetDestinations returns all registered data destinations
+// GetDestinations returns all registered data destinations, as a copy that
+// later registrations leave alone
 func GetDestinations() map[string]interfaces.DataDestination {
-	return dataDestinations
+	mu.RLock()
+	defer mu.RUnlock()
+	destinations := make(map[string]interfaces.DataDestination, len(dataDestinations))
+	for name, destination := range dataDestinations {
+		destinations[name] = destination
+	}
+	return destinations
+}
+
+// RegisterCodec registers a serialization format under its name, which is
+// matched without regard to case
+func RegisterCodec(name string, codec interfaces.Codec) {
+	mu.Lock()
+	defer mu.Unlock()
+	codecs[strings.ToLower(name)] = codec
+}
+
+// UnregisterCodec removes a format, so a test can take back one it registered
+func UnregisterCodec(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(codecs, strings.ToLower(name))
+}
+
+func GetCodec(name string) (interfaces.Codec, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	codec, exists := codecs[strings.ToLower(strings.TrimSpace(name))]
+	return codec, exists
+}
+
+// CodecNames returns the names of the registered formats, sorted
+func CodecNames() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SkySingh04/fractal/controller"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIAuth(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	// Only /api/migration exists behind the middleware
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/migration", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	serve := func(auth *controller.Auth, path, remote string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = remote
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		auth.Middleware(mux).ServeHTTP(rec, req)
+		return rec
+	}
+	remote := "203.0.113.7:51234"
+
+	t.Run("Tokens", func(t *testing.T) {
+		auth, err := controller.NewAuth([]string{"old-token", " new-token "}, false)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, serve(auth, "/api/migration", remote, map[string]string{"Authorization": "Bearer new-token"}).Code)
+		assert.Equal(t, http.StatusOK, serve(auth, "/api/migration", remote, map[string]string{"X-API-Key": "old-token"}).Code)
+		for _, headers := range []map[string]string{
+			nil,
+			{"Authorization": "Bearer wrong"},
+			{"Authorization": "Basic old-token"},
+			{"X-API-Key": "old"},
+		} {
+			rec := serve(auth, "/api/migration", remote, headers)
+			assert.Equal(t, http.StatusUnauthorized, rec.Code, headers)
+			assert.Equal(t, `Bearer realm="fractal"`, rec.Header().Get("WWW-Authenticate"))
+		}
+		t.Logf("%s Tokens passed", greenTick)
+	})
+
+	t.Run("Unknown paths look the same", func(t *testing.T) {
+		auth, err := controller.NewAuth([]string{"token"}, false)
+		assert.NoError(t, err)
+		known := serve(auth, "/api/migration", remote, nil)
+		unknown := serve(auth, "/api/nothing", remote, nil)
+		assert.Equal(t, http.StatusUnauthorized, unknown.Code)
+		assert.Equal(t, known.Body.String(), unknown.Body.String())
+		assert.Equal(t, http.StatusNotFound, serve(auth, "/api/nothing", remote, map[string]string{"X-API-Key": "token"}).Code)
+		t.Logf("%s Unknown paths passed", greenTick)
+	})
+
+	t.Run("Probes and localhost", func(t *testing.T) {
+		auth, err := controller.NewAuth(nil, true)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, serve(auth, "/healthz", remote, nil).Code)
+		assert.Equal(t, http.StatusOK, serve(auth, "/api/migration", "127.0.0.1:40000", nil).Code)
+		assert.Equal(t, http.StatusOK, serve(auth, "/api/migration", "[::1]:40000", nil).Code)
+		assert.Equal(t, http.StatusUnauthorized, serve(auth, "/api/migration", remote, nil).Code)
+		t.Logf("%s Probes and localhost passed", greenTick)
+	})
+
+	t.Run("Environment", func(t *testing.T) {
+		t.Setenv(controller.APITokensEnv, "")
+		t.Setenv(controller.APIAuthEnv, "")
+		_, err := controller.NewAuthFromEnv()
+		assert.ErrorContains(t, err, "no API tokens are set: set FRACTAL_API_TOKENS")
+
+		t.Setenv(controller.APIAuthEnv, "off")
+		_, err = controller.NewAuthFromEnv()
+		assert.ErrorContains(t, err, `invalid FRACTAL_API_AUTH "off"`)
+
+		t.Setenv(controller.APIAuthEnv, "")
+		t.Setenv(controller.APITokensEnv, "a,b")
+		auth, err := controller.NewAuthFromEnv()
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, serve(auth, "/api/migration", remote, map[string]string{"X-API-Key": "b"}).Code)
+		t.Logf("%s Environment passed", greenTick)
+	})
+}
@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/SkySingh04/fractal/integrations"
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/pipeline"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBigQueryConfig(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	destination := integrations.BigQueryDestination{}
+	records := []map[string]interface{}{{"id": 1}}
+	base := interfaces.Request{BigQueryProjectID: "project", BigQueryDataset: "shop", BigQueryTable: "orders"}
+
+	t.Run("Missing table", func(t *testing.T) {
+		err := destination.SendData(records, interfaces.Request{BigQueryProjectID: "project", BigQueryDataset: "shop"})
+		assert.EqualError(t, err, "missing BigQuery project, dataset or table")
+		t.Logf("%s Missing table rejected", greenTick)
+	})
+
+	t.Run("Unknown write disposition", func(t *testing.T) {
+		req := base
+		req.BigQueryWriteDisposition = "replace"
+		err := destination.SendData(records, req)
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		assert.ErrorContains(t, err, "unknown BigQuery write disposition")
+		t.Logf("%s Unknown write disposition rejected", greenTick)
+	})
+
+	t.Run("Invalid schema field", func(t *testing.T) {
+		req := base
+		req.BigQuerySchema = []string{"id:INTEGER", "total:MONEY"}
+		err := destination.SendData(records, req)
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		assert.ErrorContains(t, err, `invalid BigQuery schema field "total:MONEY"`)
+		t.Logf("%s Invalid schema rejected", greenTick)
+	})
+}
+
+func TestBigQueryRows(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Inferred column types", func(t *testing.T) {
+		placed := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+		schema := integrations.InferBigQuerySchema([]pipeline.Record{
+			{"id": 1, "amount": 10, "paid": true, "placed": placed, "note": nil, "tags": []interface{}{"a"}, "code": 7},
+			{"id": int64(2), "amount": 7.5, "paid": false, "placed": placed, "note": nil, "tags": map[string]interface{}{"b": 1}, "code": "x7", "raw": []byte("hi")},
+		})
+		types := map[string]bigquery.FieldType{}
+		var names []string
+		for _, field := range schema {
+			types[field.Name] = field.Type
+			names = append(names, field.Name)
+		}
+		assert.Equal(t, []string{"amount", "code", "id", "note", "paid", "placed", "raw", "tags"}, names, "Columns are not in alphabetical order")
+		assert.Equal(t, map[string]bigquery.FieldType{
+			"id":     bigquery.IntegerFieldType,
+			"amount": bigquery.FloatFieldType, // Integers mixed with floats
+			"paid":   bigquery.BooleanFieldType,
+			"placed": bigquery.TimestampFieldType,
+			"note":   bigquery.StringFieldType, // Only ever null
+			"tags":   bigquery.JSONFieldType,
+			"code":   bigquery.StringFieldType, // Mixed types
+			"raw":    bigquery.BytesFieldType,
+		}, types)
+		t.Logf("%s Type inference passed", greenTick)
+	})
+
+	t.Run("Row conversion", func(t *testing.T) {
+		schema := bigquery.Schema{
+			{Name: "id", Type: bigquery.IntegerFieldType},
+			{Name: "amount", Type: bigquery.FloatFieldType},
+			{Name: "paid", Type: bigquery.BooleanFieldType},
+			{Name: "placed", Type: bigquery.TimestampFieldType},
+			{Name: "day", Type: bigquery.DateFieldType},
+			{Name: "raw", Type: bigquery.BytesFieldType},
+			{Name: "attrs", Type: bigquery.JSONFieldType},
+			{Name: "name", Type: bigquery.StringFieldType},
+		}
+		row, err := integrations.BigQueryRow(pipeline.Record{
+			"id":     "42",
+			"amount": 3,
+			"paid":   "true",
+			"placed": "2024-03-01T10:00:00Z",
+			"day":    "1970-01-11",
+			"raw":    []byte("hi"),
+			"attrs":  map[string]interface{}{"a": 1},
+			"name":   nil,
+		}, schema)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"id":     int64(42),
+			"amount": float64(3),
+			"paid":   true,
+			"placed": time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC).UnixMicro(),
+			"day":    10,
+			"raw":    "aGk=",
+			"attrs":  `{"a":1}`,
+		}, row, "Null fields should be left out")
+
+		_, err = integrations.BigQueryRow(pipeline.Record{"id": 1.5}, schema)
+		assert.EqualError(t, err, "field id: 1.5 is not an integer")
+		_, err = integrations.BigQueryRow(pipeline.Record{"placed": "yesterday"}, schema)
+		assert.EqualError(t, err, `field placed: "yesterday" is not a timestamp or date`)
+		_, err = integrations.BigQueryRow(pipeline.Record{"id": 1, "extra": "x"}, schema)
+		assert.EqualError(t, err, "field extra is not in the table schema")
+		t.Logf("%s Row conversion passed", greenTick)
+	})
+
+	t.Run("Requests stay under the size limit", func(t *testing.T) {
+		rows := [][]byte{make([]byte, 4), make([]byte, 4), make([]byte, 4), make([]byte, 12), make([]byte, 2)}
+		assert.Equal(t, []int{2, 3, 4, 5}, integrations.ChunkBigQueryRows(rows, 10))
+		assert.Equal(t, []int{5}, integrations.ChunkBigQueryRows(rows, 100))
+		assert.Empty(t, integrations.ChunkBigQueryRows(nil, 10))
+		t.Logf("%s Batching passed", greenTick)
+	})
+
+	t.Run("Refused rows are set aside and the rest sent again", func(t *testing.T) {
+		rows := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+		records := []pipeline.Record{{"id": 1}, {"id": 2}, {"id": 3}}
+		var sent [][]string
+		rejected, err := integrations.AppendBigQueryChunk(rows, records, func(rows [][]byte) (map[int]string, error) {
+			var request []string
+			for _, row := range rows {
+				request = append(request, string(row))
+			}
+			sent = append(sent, request)
+			if len(sent) == 1 {
+				return map[int]string{1: "invalid value"}, errors.New("request has row errors")
+			}
+			return nil, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{{"a", "b", "c"}, {"a", "c"}}, sent)
+		assert.Equal(t, []pipeline.RejectedRow{{Record: pipeline.Record{"id": 2}, Reason: "invalid value"}}, rejected)
+		t.Logf("%s Row errors passed", greenTick)
+	})
+
+	t.Run("Request errors", func(t *testing.T) {
+		rows := [][]byte{[]byte("a")}
+		records := []pipeline.Record{{"id": 1}}
+		unavailable := errors.New("service unavailable")
+		_, err := integrations.AppendBigQueryChunk(rows, records, func([][]byte) (map[int]string, error) { return nil, unavailable })
+		assert.ErrorIs(t, err, unavailable)
+		assert.EqualError(t, err, "failed to append rows to BigQuery: service unavailable")
+
+		_, err = integrations.AppendBigQueryChunk(rows, records, func([][]byte) (map[int]string, error) {
+			return map[int]string{5: "no such row"}, errors.New("invalid request")
+		})
+		assert.EqualError(t, err, "BigQuery rejected the request without naming rows within it: invalid request")
+		t.Logf("%s Request errors passed", greenTick)
+	})
+}
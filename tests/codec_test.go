@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/SkySingh04/fractal/integrations"
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/registry"
+	"github.com/stretchr/testify/assert"
+)
+
+// pipeCodec writes each record as its values joined by |, in column order
+type pipeCodec struct{}
+
+func (pipeCodec) Encode(records []map[string]interface{}, columns []string) ([]byte, error) {
+	var lines []string
+	for _, rec := range records {
+		fields := make([]string, len(columns))
+		for i, column := range columns {
+			fields[i] = fmt.Sprint(rec[column])
+		}
+		lines = append(lines, strings.Join(fields, "|"))
+	}
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+func (pipeCodec) Decode(data []byte) ([]map[string]interface{}, []string, error) {
+	return nil, nil, errors.New("pipe codec only writes")
+}
+
+func TestCodecs(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	records := []map[string]interface{}{
+		{"id": "1", "name": "ann, jr"},
+		{"id": "2", "name": "bob"},
+	}
+
+	t.Run("Built-in formats round trip", func(t *testing.T) {
+		for _, format := range []string{integrations.FormatCSV, integrations.FormatJSON, integrations.FormatJSONLines, integrations.FormatYAML} {
+			codec, ok := registry.GetCodec(format)
+			assert.True(t, ok, format)
+			encoded, err := codec.Encode(records, []string{"id", "name"})
+			assert.NoError(t, err, format)
+			decoded, _, err := codec.Decode(encoded)
+			assert.NoError(t, err, format)
+			assert.Equal(t, records, decoded, format)
+		}
+		csv, ok := registry.GetCodec("CSV")
+		assert.True(t, ok, "Format names match without regard to case")
+		_, columns, err := csv.Decode([]byte("name,id\nann,1\n"))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"name", "id"}, columns, "CSV keeps the header order")
+		t.Logf("%s Built-in formats round trip passed", greenTick)
+	})
+
+	t.Run("Invalid payload", func(t *testing.T) {
+		codec, _ := registry.GetCodec(integrations.FormatJSONLines)
+		_, _, err := codec.Decode([]byte("{\"id\":1}\n[1]\n"))
+		assert.EqualError(t, err, "invalid JSON lines: line 2 is not a JSON object")
+		codec, _ = registry.GetCodec(integrations.FormatJSON)
+		_, _, err = codec.Decode([]byte(`[{"id":1}, 2]`))
+		assert.ErrorContains(t, err, "item 2 is a float64, expected an object")
+		t.Logf("%s Invalid payload passed", greenTick)
+	})
+
+	t.Run("Registered codec on a transport", func(t *testing.T) {
+		registry.RegisterCodec("pipe", pipeCodec{})
+		t.Cleanup(func() { registry.UnregisterCodec("pipe") })
+		assert.Contains(t, registry.CodecNames(), "pipe")
+		assert.True(t, sort.StringsAreSorted(registry.CodecNames()))
+
+		out := captureStdout(t)
+		req := interfaces.Request{StdoutFormat: "PIPE"}
+		assert.NoError(t, integrations.StdoutDestination{}.ValidateConfig(req))
+		assert.NoError(t, integrations.StdoutDestination{}.SendData("id,name\n1,ann\n2,bob", req))
+		assert.Equal(t, "1|ann\n2|bob\n", out.String())
+		t.Logf("%s Registered codec on a transport passed", greenTick)
+	})
+
+	t.Run("Unknown format", func(t *testing.T) {
+		req := interfaces.Request{FTPURL: "ftp://localhost:21", FTPUser: "u", FTPPassword: "p", FTPFILEPATH: "out.avro", Format: "avro"}
+		err := integrations.FTPDestination{}.SendData(records, req)
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		assert.ErrorContains(t, err, `unknown format "avro": expected one of csv, json, jsonl`)
+		t.Logf("%s Unknown format passed", greenTick)
+	})
+}
@@ -1,12 +1,19 @@
 package tests
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/SkySingh04/fractal/integrations"
 	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/pipeline"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -81,4 +88,512 @@ Jane,30,San Francisco`
 	} else {
 		t.Fatalf("%s Output file content validation failed", redCross)
 	}
-}
\ No newline at end of file
+}
+func TestCSVDestinationColumns(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	records := []map[string]interface{}{
+		{"name": "John", "age": 25, "city": "Pune"},
+		{"name": "Jane", "age": 30, "zip": "403001"},
+	}
+	outputFileName := t.TempDir() + "/columns.csv"
+	csvDestination := integrations.CSVDestination{}
+
+	t.Run("Stable order without columns", func(t *testing.T) {
+		req := interfaces.Request{CSVDestinationFileName: outputFileName}
+		assert.NoError(t, csvDestination.SendData(records, req))
+		written, err := os.ReadFile(outputFileName)
+		assert.NoError(t, err)
+		assert.Equal(t, "age,city,name,zip\n25,Pune,John,\n30,,Jane,403001\n", string(written))
+		t.Logf("%s Alphabetical column order passed", greenTick)
+	})
+
+	t.Run("Explicit columns", func(t *testing.T) {
+		req := interfaces.Request{CSVDestinationFileName: outputFileName, CSVDestinationColumns: []string{"name", "zip", "age"}}
+		assert.NoError(t, csvDestination.SendData(records, req))
+		written, err := os.ReadFile(outputFileName)
+		assert.NoError(t, err)
+		assert.Equal(t, "name,zip,age\nJohn,,25\nJane,403001,30\n", string(written))
+		t.Logf("%s Explicit column order passed", greenTick)
+	})
+
+	t.Run("Explicit columns reorder CSV input", func(t *testing.T) {
+		req := interfaces.Request{CSVDestinationFileName: outputFileName, CSVDestinationColumns: []string{"city", "name"}}
+		assert.NoError(t, csvDestination.SendData("name,age,city\nJohn,25,Pune", req))
+		written, err := os.ReadFile(outputFileName)
+		assert.NoError(t, err)
+		assert.Equal(t, "city,name\nPune,John\n", string(written))
+		t.Logf("%s Reordered CSV input passed", greenTick)
+	})
+}
+
+func TestCSVHeaders(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	inputFileName := t.TempDir() + "/headerless.csv"
+	assert.NoError(t, os.WriteFile(inputFileName, []byte("John,25\nJane,30\n"), 0644))
+	csvSource := integrations.CSVSource{}
+	noHeader := false
+
+	t.Run("Explicit columns without a header", func(t *testing.T) {
+		req := interfaces.Request{CSVSourceFileName: inputFileName, CSVSourceHasHeader: &noHeader, CSVSourceColumns: []string{"name", "age"}}
+		data, err := csvSource.FetchData(req)
+		assert.NoError(t, err)
+		assert.Equal(t, "name,age\nJohn,25\nJane,30", data)
+		t.Logf("%s Explicit columns passed", greenTick)
+	})
+
+	t.Run("Numbered columns without a header", func(t *testing.T) {
+		req := interfaces.Request{CSVSourceFileName: inputFileName, CSVSourceHasHeader: &noHeader}
+		data, err := csvSource.FetchData(req)
+		assert.NoError(t, err)
+		assert.Equal(t, "column1,column2\nJohn,25\nJane,30", data)
+		t.Logf("%s Numbered columns passed", greenTick)
+	})
+
+	t.Run("First row is the header by default", func(t *testing.T) {
+		req := interfaces.Request{CSVSourceFileName: inputFileName}
+		data, err := csvSource.FetchData(req)
+		assert.NoError(t, err)
+		assert.Equal(t, "John,25\nJane,30", data)
+		t.Logf("%s Default header passed", greenTick)
+	})
+
+	t.Run("Write without a header", func(t *testing.T) {
+		outputFileName := t.TempDir() + "/noheader.csv"
+		req := interfaces.Request{CSVDestinationFileName: outputFileName, CSVDestinationWriteHeader: &noHeader}
+		assert.NoError(t, integrations.CSVDestination{}.SendData("name,age\nJohn,25", req))
+		written, err := os.ReadFile(outputFileName)
+		assert.NoError(t, err)
+		assert.Equal(t, "John,25\n", string(written))
+		t.Logf("%s Headerless output passed", greenTick)
+	})
+}
+
+func TestCSVQuoteMode(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	outputFileName := t.TempDir() + "/quoted.csv"
+	csvDestination := integrations.CSVDestination{}
+	input := "name,note\nJohn,say \"hi\"\nJane,"
+
+	t.Run("Quote every field", func(t *testing.T) {
+		req := interfaces.Request{CSVDestinationFileName: outputFileName, CSVDestinationQuoteMode: integrations.CSVQuoteAll}
+		assert.NoError(t, csvDestination.SendData(input, req))
+		written, err := os.ReadFile(outputFileName)
+		assert.NoError(t, err)
+		assert.Equal(t, "\"name\",\"note\"\n\"John\",\"say \"\"hi\"\"\"\n\"Jane\",\"\"\n", string(written))
+		t.Logf("%s Quote all passed", greenTick)
+	})
+
+	t.Run("Minimal quoting by default", func(t *testing.T) {
+		req := interfaces.Request{CSVDestinationFileName: outputFileName}
+		assert.NoError(t, csvDestination.SendData(input, req))
+		written, err := os.ReadFile(outputFileName)
+		assert.NoError(t, err)
+		assert.Equal(t, "name,note\nJohn,\"say \"\"hi\"\"\"\nJane,\n", string(written))
+		t.Logf("%s Minimal quoting passed", greenTick)
+	})
+
+	t.Run("Never quote", func(t *testing.T) {
+		req := interfaces.Request{CSVDestinationFileName: outputFileName, CSVDestinationQuoteMode: integrations.CSVQuoteNone}
+		assert.NoError(t, csvDestination.SendData(input, req))
+		written, err := os.ReadFile(outputFileName)
+		assert.NoError(t, err)
+		assert.Equal(t, "name,note\nJohn,say \"hi\"\nJane,\n", string(written))
+
+		// A field holding the delimiter cannot be written unquoted
+		req.PartitionBy = []string{"region"}
+		records := []map[string]interface{}{{"region": "us", "city": "Austin, TX"}}
+		assert.ErrorContains(t, csvDestination.SendData(records, req), "needs quoting")
+		t.Logf("%s No quoting passed", greenTick)
+	})
+
+	t.Run("Unknown mode", func(t *testing.T) {
+		err := csvDestination.ValidateConfig(interfaces.Request{CSVDestinationFileName: outputFileName, CSVDestinationQuoteMode: "some"})
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		t.Logf("%s Unknown mode passed", greenTick)
+	})
+}
+
+func TestCSVPreamble(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	inputFileName := t.TempDir() + "/export.csv"
+	contents := "Vendor export \"daily\nGenerated 2024-01-01\n# region: all\n#rows: 2\nname,age\nJohn,25\n# not skipped\n"
+	assert.NoError(t, os.WriteFile(inputFileName, []byte(contents), 0644))
+	csvSource := integrations.CSVSource{}
+
+	t.Run("Skip lines then comments", func(t *testing.T) {
+		req := interfaces.Request{CSVSourceFileName: inputFileName, CSVSourceSkipLines: 2, CSVSourceCommentPrefix: "#"}
+		data, err := csvSource.FetchData(req)
+		assert.NoError(t, err)
+		assert.Equal(t, "name,age\nJohn,25\n# not skipped", data)
+		t.Logf("%s Preamble skipped", greenTick)
+	})
+
+	t.Run("Skipped lines before a headerless file", func(t *testing.T) {
+		noHeader := false
+		req := interfaces.Request{CSVSourceFileName: inputFileName, CSVSourceSkipLines: 5, CSVSourceHasHeader: &noHeader, CSVSourceColumns: []string{"name", "age"}}
+		data, err := csvSource.FetchData(req)
+		assert.NoError(t, err)
+		assert.Equal(t, "name,age\nJohn,25\n# not skipped", data)
+		t.Logf("%s Headerless preamble skipped", greenTick)
+	})
+
+	t.Run("Negative skip lines", func(t *testing.T) {
+		_, err := csvSource.FetchData(interfaces.Request{CSVSourceFileName: inputFileName, CSVSourceSkipLines: -1})
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		t.Logf("%s Negative skip lines rejected", greenTick)
+	})
+}
+
+func TestCSVWhitespace(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	inputFileName := t.TempDir() + "/padded.csv"
+	contents := " name , city\n  John ,\" New   York \"\nJane,  \n"
+	assert.NoError(t, os.WriteFile(inputFileName, []byte(contents), 0644))
+	csvSource := integrations.CSVSource{}
+
+	t.Run("Untouched by default", func(t *testing.T) {
+		data, err := csvSource.FetchData(interfaces.Request{CSVSourceFileName: inputFileName})
+		assert.NoError(t, err)
+		assert.Equal(t, " name , city\n  John , New   York \nJane,  ", data)
+		t.Logf("%s Whitespace kept", greenTick)
+	})
+
+	t.Run("Trim", func(t *testing.T) {
+		data, err := csvSource.FetchData(interfaces.Request{CSVSourceFileName: inputFileName, CSVSourceTrimSpace: true})
+		assert.NoError(t, err)
+		assert.Equal(t, "name,city\nJohn,New   York\nJane,", data)
+		t.Logf("%s Fields trimmed", greenTick)
+	})
+
+	t.Run("Collapse", func(t *testing.T) {
+		req := interfaces.Request{CSVSourceFileName: inputFileName, CSVSourceCollapseSpace: true}
+		data, err := csvSource.FetchData(req)
+		assert.NoError(t, err)
+		assert.Equal(t, "name,city\nJohn,New York\nJane,", data)
+		t.Logf("%s Fields collapsed", greenTick)
+	})
+}
+
+func TestCSVExpectedHeader(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	inputFileName := t.TempDir() + "/vendor.csv"
+	assert.NoError(t, os.WriteFile(inputFileName, []byte("id, email,name\n1,a@x.com,Ann\n"), 0644))
+	csvSource := integrations.CSVSource{}
+	fetch := func(expected []string, allowReorder bool) (interface{}, error) {
+		return csvSource.FetchData(interfaces.Request{
+			CSVSourceFileName:       inputFileName,
+			CSVSourceTrimSpace:      true,
+			CSVSourceExpectedHeader: expected,
+			CSVSourceAllowReorder:   allowReorder,
+		})
+	}
+
+	t.Run("Matching header", func(t *testing.T) {
+		data, err := fetch([]string{"id", "email", "name"}, false)
+		assert.NoError(t, err)
+		assert.Equal(t, "id,email,name\n1,a@x.com,Ann", data)
+		t.Logf("%s Matching header passed", greenTick)
+	})
+
+	t.Run("Reordered columns", func(t *testing.T) {
+		_, err := fetch([]string{"id", "name", "email"}, false)
+		assert.ErrorIs(t, err, interfaces.ErrValidation)
+		assert.ErrorContains(t, err, "does not have the expected header: columns in the order id, email, name, expected id, name, email")
+
+		_, err = fetch([]string{"id", "name", "email"}, true)
+		assert.NoError(t, err)
+		t.Logf("%s Reordered columns passed", greenTick)
+	})
+
+	t.Run("Missing and extra columns", func(t *testing.T) {
+		_, err := fetch([]string{"id", "name", "phone"}, true)
+		assert.ErrorIs(t, err, interfaces.ErrValidation)
+		assert.ErrorContains(t, err, "missing phone; extra email")
+		t.Logf("%s Missing and extra columns passed", greenTick)
+	})
+
+	t.Run("File without a header", func(t *testing.T) {
+		noHeader := false
+		_, err := csvSource.FetchData(interfaces.Request{CSVSourceFileName: inputFileName, CSVSourceHasHeader: &noHeader, CSVSourceExpectedHeader: []string{"id"}})
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		t.Logf("%s File without a header rejected", greenTick)
+	})
+}
+
+func TestCSVFilePatterns(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "archive"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "data-2024-02.csv"), []byte("id,name\n2,Jane\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "data-2024-01.csv"), []byte("id,name\n1,John\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "archive", "data-2023-12.csv"), []byte("id,name\n0,Old\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not data"), 0644))
+	csvSource := integrations.CSVSource{}
+
+	t.Run("Glob in sorted order", func(t *testing.T) {
+		data, err := csvSource.FetchData(interfaces.Request{CSVSourceFileName: filepath.Join(dir, "data-2024-*.csv")})
+		assert.NoError(t, err)
+		first, second := filepath.Join(dir, "data-2024-01.csv"), filepath.Join(dir, "data-2024-02.csv")
+		assert.Equal(t, "id,name,_source_file\n1,John,"+first+"\n2,Jane,"+second, data)
+		t.Logf("%s Glob passed", greenTick)
+	})
+
+	t.Run("Recursive directory with a named field", func(t *testing.T) {
+		data, err := csvSource.FetchData(interfaces.Request{CSVSourceFileName: dir, SourceRecursive: true, SourceFileField: "file"})
+		assert.NoError(t, err)
+		assert.Equal(t, 4, len(strings.Split(data.(string), "\n")))
+		assert.True(t, strings.HasPrefix(data.(string), "id,name,file\n0,Old,"))
+
+		flat, err := csvSource.FetchData(interfaces.Request{CSVSourceFileName: dir})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, len(strings.Split(flat.(string), "\n")))
+		t.Logf("%s Directory passed", greenTick)
+	})
+
+	t.Run("Empty match and mismatched headers", func(t *testing.T) {
+		_, err := csvSource.FetchData(interfaces.Request{CSVSourceFileName: filepath.Join(dir, "data-2025-*.csv")})
+		assert.ErrorContains(t, err, "no files match")
+
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "data-2024-03.csv"), []byte("id,email\n3,j@x.io\n"), 0644))
+		_, err = csvSource.FetchData(interfaces.Request{CSVSourceFileName: filepath.Join(dir, "data-2024-*.csv")})
+		assert.ErrorContains(t, err, "has columns id,email")
+		t.Logf("%s Empty match and mismatched headers rejected", greenTick)
+	})
+}
+
+func TestCSVArchives(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	dir := t.TempDir()
+	entries := []struct{ name, body string }{
+		{"orders/2024-02.csv", "id,name\n2,Jane\n"},
+		{"orders/2024-01.csv", "id,name\n1,John\n"},
+		{"README.txt", "not data"},
+	}
+
+	zipPath := filepath.Join(dir, "drop.zip")
+	zipFile, err := os.Create(zipPath)
+	assert.NoError(t, err)
+	zw := zip.NewWriter(zipFile)
+	for _, entry := range entries {
+		w, err := zw.Create(entry.name)
+		assert.NoError(t, err)
+		_, err = w.Write([]byte(entry.body))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+	assert.NoError(t, zipFile.Close())
+
+	tarPath := filepath.Join(dir, "drop.tar.gz")
+	tarFile, err := os.Create(tarPath)
+	assert.NoError(t, err)
+	gz := gzip.NewWriter(tarFile)
+	tw := tar.NewWriter(gz)
+	for _, entry := range entries {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.body)), Typeflag: tar.TypeReg}))
+		_, err = tw.Write([]byte(entry.body))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+	assert.NoError(t, tarFile.Close())
+
+	csvSource := integrations.CSVSource{}
+
+	for _, archive := range []string{zipPath, tarPath} {
+		t.Run("Entries of "+filepath.Base(archive), func(t *testing.T) {
+			data, err := csvSource.FetchData(interfaces.Request{CSVSourceFileName: archive})
+			assert.NoError(t, err)
+			first, second := archive+"!orders/2024-01.csv", archive+"!orders/2024-02.csv"
+			assert.Equal(t, "id,name,_source_file\n1,John,"+first+"\n2,Jane,"+second, data)
+			t.Logf("%s Archive entries read", greenTick)
+		})
+	}
+
+	t.Run("Entry pattern", func(t *testing.T) {
+		data, err := csvSource.FetchData(interfaces.Request{CSVSourceFileName: filepath.Join(dir, "*.zip"), SourceArchiveEntries: "orders/*-02.csv", SourceFileField: "file"})
+		assert.NoError(t, err)
+		assert.Equal(t, "id,name,file\n2,Jane,"+zipPath+"!orders/2024-02.csv", data)
+
+		_, err = csvSource.FetchData(interfaces.Request{CSVSourceFileName: zipPath, SourceArchiveEntries: "*.csv"})
+		assert.ErrorContains(t, err, "no entries of "+zipPath+" match *.csv")
+		t.Logf("%s Archive entry pattern passed", greenTick)
+	})
+
+	t.Run("Corrupt archive", func(t *testing.T) {
+		corrupt := filepath.Join(dir, "corrupt.zip")
+		assert.NoError(t, os.WriteFile(corrupt, []byte("not a zip"), 0644))
+		_, err := csvSource.FetchData(interfaces.Request{CSVSourceFileName: corrupt})
+		assert.ErrorContains(t, err, "failed to read zip archive "+corrupt)
+
+		truncated := filepath.Join(dir, "truncated.tar.gz")
+		contents, err := os.ReadFile(tarPath)
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(truncated, contents[:len(contents)/2], 0644))
+		_, err = csvSource.FetchData(interfaces.Request{CSVSourceFileName: truncated})
+		assert.ErrorContains(t, err, "failed to read tar archive "+truncated)
+		t.Logf("%s Corrupt archives rejected", greenTick)
+	})
+}
+
+func TestCompressedFiles(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	dir := t.TempDir()
+	csvSource := integrations.CSVSource{}
+	csvDestination := integrations.CSVDestination{}
+	data := "id,name\n1,John\n2,Jane"
+
+	// Each codec's files start with its magic number
+	for name, magic := range map[string]string{"out.csv.gz": "\x1f\x8b", "out.csv.zst": "\x28\xb5\x2f\xfd"} {
+		t.Run("Round trip "+filepath.Ext(name), func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			assert.NoError(t, csvDestination.SendData(data, interfaces.Request{CSVDestinationFileName: path}))
+			raw, err := os.ReadFile(path)
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(string(raw), magic), "File was not compressed")
+
+			read, err := csvSource.FetchData(interfaces.Request{CSVSourceFileName: path})
+			assert.NoError(t, err)
+			assert.Equal(t, data, read)
+			t.Logf("%s %s round trip passed", greenTick, name)
+		})
+	}
+
+	t.Run("Explicit codec and directories", func(t *testing.T) {
+		path := filepath.Join(dir, "zstd.data")
+		assert.NoError(t, csvDestination.SendData(data, interfaces.Request{CSVDestinationFileName: path, Compression: "zstd"}))
+		read, err := csvSource.FetchData(interfaces.Request{CSVSourceFileName: path, Compression: "ZSTD"})
+		assert.NoError(t, err)
+		assert.Equal(t, data, read)
+
+		// A directory of .csv files also picks up the compressed ones
+		read, err = csvSource.FetchData(interfaces.Request{CSVSourceFileName: dir})
+		assert.NoError(t, err)
+		assert.Equal(t, 5, len(strings.Split(read.(string), "\n")))
+		t.Logf("%s Explicit codec passed", greenTick)
+	})
+
+	t.Run("YAML", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "out.yaml.gz")
+		records := []interface{}{map[string]interface{}{"id": 1, "name": "John"}}
+		assert.NoError(t, integrations.YAMLDestination{}.SendData(records, interfaces.Request{YAMLDestinationFilePath: path}))
+		read, err := integrations.YAMLSource{}.FetchData(interfaces.Request{YAMLSourceFilePath: path})
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{map[string]interface{}{"id": 1, "name": "John"}}, read)
+		t.Logf("%s YAML round trip passed", greenTick)
+	})
+
+	t.Run("Read bzip2", func(t *testing.T) {
+		compressed, err := base64.StdEncoding.DecodeString("QlpoOTFBWSZTWdEm+8QAAAVdAAAQAAQgAAAQJmOgACKabSejIQNA0PoEUMTpMvRdyRThQkNEm+8Q")
+		assert.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "in.csv.bz2")
+		assert.NoError(t, os.WriteFile(path, compressed, 0644))
+		read, err := csvSource.FetchData(interfaces.Request{CSVSourceFileName: path})
+		assert.NoError(t, err)
+		assert.Equal(t, "id,name\n1,John", read)
+		t.Logf("%s bzip2 read passed", greenTick)
+	})
+
+	t.Run("Unsupported codecs", func(t *testing.T) {
+		err := csvSource.ValidateConfig(interfaces.Request{CSVSourceFileName: "in.csv", Compression: "lz4"})
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		assert.ErrorContains(t, err, `unsupported compression "lz4"`)
+
+		assert.NoError(t, csvSource.ValidateConfig(interfaces.Request{CSVSourceFileName: "in.csv.bz2"}))
+		err = csvDestination.ValidateConfig(interfaces.Request{CSVDestinationFileName: "out.csv.bz2"})
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		assert.ErrorContains(t, err, "only supported for reading")
+
+		// The run fails before the source is read
+		out := filepath.Join(t.TempDir(), "out.csv.bz2")
+		p := &pipeline.Pipeline{
+			Source:             stubSource{data: data},
+			Destination:        csvDestination,
+			DestinationRequest: interfaces.Request{CSVDestinationFileName: out},
+		}
+		summary, err := p.Run(context.Background())
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		assert.Equal(t, 0, summary.RecordsRead)
+		assert.NoFileExists(t, out)
+		t.Logf("%s Unsupported codecs rejected", greenTick)
+	})
+}
+
+func TestFileEncodings(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	csvSource := integrations.CSVSource{}
+	csvDestination := integrations.CSVDestination{}
+
+	t.Run("Read legacy encodings", func(t *testing.T) {
+		dir := t.TempDir()
+		for name, tc := range map[string]struct {
+			encoding string
+			raw      string
+		}{
+			"latin1.csv":  {"latin-1", "id,name\n1,Jos\xe9\n2,M\xfcller"},
+			"cp1252.csv":  {"Windows-1252", "id,name\n1,Jos\xe9\n2,M\xfcller \x80"},
+			"utf16.csv":   {"utf-16", "\xff\xfei\x00d\x00,\x00n\x00a\x00m\x00e\x00\n\x001\x00,\x00J\x00o\x00s\x00\xe9\x00"},
+			"utf8bom.csv": {"", "\xef\xbb\xbfid,name\n1,Jos\xc3\xa9"},
+		} {
+			path := filepath.Join(dir, name)
+			assert.NoError(t, os.WriteFile(path, []byte(tc.raw), 0644))
+			read, err := csvSource.FetchData(interfaces.Request{CSVSourceFileName: path, Encoding: tc.encoding})
+			assert.NoError(t, err, name)
+			assert.True(t, strings.HasPrefix(read.(string), "id,name\n1,José"), "%s read as %q", name, read)
+		}
+		read, err := csvSource.FetchData(interfaces.Request{CSVSourceFileName: filepath.Join(dir, "cp1252.csv"), Encoding: "cp1252"})
+		assert.NoError(t, err)
+		assert.Equal(t, "id,name\n1,José\n2,Müller €", read)
+		t.Logf("%s Read legacy encodings passed", greenTick)
+	})
+
+	t.Run("BOM overrides the setting", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "in.csv")
+		assert.NoError(t, os.WriteFile(path, []byte("\xef\xbb\xbfid,name\n1,Jos\xc3\xa9"), 0644))
+		read, err := csvSource.FetchData(interfaces.Request{CSVSourceFileName: path, Encoding: "latin-1"})
+		assert.NoError(t, err)
+		assert.Equal(t, "id,name\n1,José", read)
+		t.Logf("%s BOM overrides the setting passed", greenTick)
+	})
+
+	t.Run("Write encoded", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "out.csv")
+		assert.NoError(t, csvDestination.SendData("id,name\n1,José", interfaces.Request{CSVDestinationFileName: path, Encoding: "latin1"}))
+		raw, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, "id,name\n1,Jos\xe9\n", string(raw))
+
+		path = filepath.Join(dir, "out.yaml")
+		records := []interface{}{map[string]interface{}{"name": "José"}}
+		assert.NoError(t, integrations.YAMLDestination{}.SendData(records, interfaces.Request{YAMLDestinationFilePath: path, Encoding: "utf-16"}))
+		raw, err = os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(raw), "\xff\xfe-\x00"), "UTF-16 starts with a byte order mark")
+		read, err := integrations.YAMLSource{}.FetchData(interfaces.Request{YAMLSourceFilePath: path})
+		assert.NoError(t, err)
+		assert.Equal(t, records, read)
+
+		err = csvDestination.SendData("id,name\n1,€", interfaces.Request{CSVDestinationFileName: filepath.Join(dir, "euro.csv"), Encoding: "latin-1"})
+		assert.ErrorContains(t, err, "failed to encode the output as latin-1")
+		t.Logf("%s Write encoded passed", greenTick)
+	})
+
+	t.Run("Unknown encoding", func(t *testing.T) {
+		err := csvSource.ValidateConfig(interfaces.Request{CSVSourceFileName: "in.csv", Encoding: "ebcdic"})
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		assert.ErrorContains(t, err, `unknown encoding "ebcdic": expected utf-8, utf-16`)
+		err = integrations.JSONDestination{}.ValidateConfig(interfaces.Request{JSONOutputFilename: "out.json", Encoding: "koi8-r"})
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		t.Logf("%s Unknown encoding rejected", greenTick)
+	})
+}
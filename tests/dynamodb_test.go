@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/SkySingh04/fractal/integrations"
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDynamoDBAssumeRole(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+	roleARN := "arn:aws:iam::123456789012:role/fractal-loader"
+
+	t.Run("External ID without a role", func(t *testing.T) {
+		req := interfaces.Request{DynamoDBSourceTable: "input", DynamoDBSourceRegion: "us-east-1", AWSExternalID: "shared"}
+		_, err := integrations.DynamoDBSource{}.FetchData(req)
+		assert.True(t, errors.Is(err, interfaces.ErrConfigInvalid))
+		assert.ErrorContains(t, err, "externalid is set without a rolearn")
+		t.Logf("%s External ID without a role passed", greenTick)
+	})
+
+	t.Run("Malformed role ARN", func(t *testing.T) {
+		req := interfaces.Request{DynamoDBTargetTable: "output", DynamoDBTargetRegion: "us-east-1", AWSRoleARN: "fractal-loader"}
+		err := integrations.DynamoDBDestination{}.SendData(map[string]interface{}{"KeyAttribute": "a"}, req)
+		assert.True(t, errors.Is(err, interfaces.ErrConfigInvalid))
+		assert.ErrorContains(t, err, `invalid rolearn "fractal-loader"`)
+		t.Logf("%s Malformed role ARN passed", greenTick)
+	})
+
+	t.Run("Role that cannot be assumed", func(t *testing.T) {
+		// An invalid region fails the STS call before anything is sent
+		t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+		t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+		t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+		req := interfaces.Request{DynamoDBSourceTable: "input", DynamoDBSourceRegion: "not a region", AWSRoleARN: roleARN, AWSExternalID: "shared", PageSize: 1}
+		_, _, err := integrations.DynamoDBSource{}.FetchPage(req, "")
+		assert.True(t, errors.Is(err, interfaces.ErrConnection))
+		assert.ErrorContains(t, err, "failed to assume role "+roleARN)
+		assert.ErrorContains(t, err, "trust policy")
+		t.Logf("%s Role that cannot be assumed passed", greenTick)
+	})
+
+	t.Run("No role", func(t *testing.T) {
+		req := interfaces.Request{DynamoDBSourceTable: "input", DynamoDBSourceRegion: "us-east-1"}
+		data, err := integrations.DynamoDBSource{}.FetchData(req)
+		assert.NoError(t, err)
+		assert.Len(t, data, 2)
+		t.Logf("%s No role passed", greenTick)
+	})
+}
+
+func TestDynamoDBRegionFailover(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+	roleARN := "arn:aws:iam::123456789012:role/fractal-loader"
+
+	t.Run("Failover region repeating the region", func(t *testing.T) {
+		req := interfaces.Request{DynamoDBSourceTable: "input", DynamoDBSourceRegion: "us-east-1", AWSFailoverRegions: []string{"us-west-2", "us-east-1"}}
+		_, err := integrations.DynamoDBSource{}.FetchData(req)
+		assert.True(t, errors.Is(err, interfaces.ErrConfigInvalid))
+		assert.ErrorContains(t, err, "failoverregions names us-east-1, the region it fails over from")
+		t.Logf("%s Failover region repeating the region passed", greenTick)
+	})
+
+	t.Run("Empty failover region", func(t *testing.T) {
+		req := interfaces.Request{DynamoDBTargetTable: "output", DynamoDBTargetRegion: "us-east-1", AWSFailoverRegions: []string{" "}}
+		err := integrations.DynamoDBDestination{}.SendData(map[string]interface{}{"KeyAttribute": "a"}, req)
+		assert.True(t, errors.Is(err, interfaces.ErrConfigInvalid))
+		assert.ErrorContains(t, err, "failoverregions has an empty region")
+		t.Logf("%s Empty failover region passed", greenTick)
+	})
+
+	t.Run("Outage in every region", func(t *testing.T) {
+		// Regions whose STS endpoint does not resolve are down, so each is tried in turn
+		t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+		t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+		t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+		req := interfaces.Request{DynamoDBSourceTable: "input", DynamoDBSourceRegion: "xx-nowhere-1", AWSRoleARN: roleARN,
+			AWSFailoverRegions: []string{"xx-nowhere-2"}, PageSize: 1}
+		_, _, err := integrations.DynamoDBSource{}.FetchPage(req, "")
+		assert.True(t, errors.Is(err, interfaces.ErrConnection))
+		assert.ErrorContains(t, err, "every region is unavailable, tried xx-nowhere-1, xx-nowhere-2")
+		assert.ErrorContains(t, err, "failed to assume role "+roleARN)
+		t.Logf("%s Outage in every region passed", greenTick)
+	})
+
+	t.Run("Data errors do not fail over", func(t *testing.T) {
+		req := interfaces.Request{DynamoDBSourceTable: "missing", DynamoDBSourceRegion: "us-east-1", AWSFailoverRegions: []string{"us-west-2"}}
+		_, err := integrations.DynamoDBSource{}.FetchData(req)
+		assert.EqualError(t, err, "table not found")
+		t.Logf("%s Data errors do not fail over passed", greenTick)
+	})
+
+	t.Run("Healthy region", func(t *testing.T) {
+		req := interfaces.Request{DynamoDBSourceTable: "input", DynamoDBSourceRegion: "us-east-1", AWSFailoverRegions: []string{"us-west-2"}}
+		data, err := integrations.DynamoDBSource{}.FetchData(req)
+		assert.NoError(t, err)
+		assert.Len(t, data, 2)
+		t.Logf("%s Healthy region passed", greenTick)
+	})
+}
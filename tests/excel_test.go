@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SkySingh04/fractal/integrations"
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/pipeline"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestExcelIntegration(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	// A workbook whose second sheet has a title row, a merged region, dates and formulas
+	book := excelize.NewFile()
+	_, err := book.NewSheet("Orders")
+	assert.NoError(t, err)
+	rows := [][]interface{}{
+		{"id", "region", "placed", "qty", "price", "total", "paid"},
+		{1, "us", time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC), 2, 2.5, nil, true},
+		{2, nil, time.Date(2024, 1, 6, 12, 30, 0, 0, time.UTC), 3, 1.5, nil, false},
+		{3, "eu", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC), 0, 4, nil, nil},
+	}
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+3)
+		assert.NoError(t, book.SetSheetRow("Orders", cell, &row))
+	}
+	assert.NoError(t, book.MergeCell("Orders", "B4", "B5"))
+	assert.NoError(t, book.SetCellFormula("Orders", "F4", "D4*E4"))
+	assert.NoError(t, book.SetCellFormula("Orders", "F5", "D5*E5"))
+	assert.NoError(t, book.SetCellFormula("Orders", "F6", "E6/D6"))
+	file := filepath.Join(t.TempDir(), "orders.xlsx")
+	assert.NoError(t, book.SaveAs(file))
+	assert.NoError(t, book.Close())
+
+	t.Run("Source reads a sheet by name or position", func(t *testing.T) {
+		for _, sheet := range []string{"Orders", "2"} {
+			data, err := integrations.ExcelSource{}.FetchData(interfaces.Request{ExcelSourceFileName: file, ExcelSourceSheet: sheet})
+			assert.NoError(t, err)
+			read, ok := data.(*pipeline.SourceRows)
+			assert.True(t, ok)
+			assert.Equal(t, []string{"id", "region", "placed", "qty", "price", "total", "paid"}, read.Columns)
+			assert.Equal(t, []map[string]interface{}{
+				{"id": int64(1), "region": "us", "placed": time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC), "qty": int64(2), "price": 2.5, "total": int64(5), "paid": true},
+				{"id": int64(2), "region": "us", "placed": time.Date(2024, 1, 6, 12, 30, 0, 0, time.UTC), "qty": int64(3), "price": 1.5, "total": 4.5, "paid": false},
+			}, read.Records)
+			assert.Len(t, read.Rejected, 1)
+			assert.Contains(t, read.Rejected[0].Reason, "row 6")
+			assert.Contains(t, read.Rejected[0].Reason, "#DIV/0!")
+		}
+
+		_, err := integrations.ExcelSource{}.FetchData(interfaces.Request{ExcelSourceFileName: file, ExcelSourceSheet: "Missing"})
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		t.Logf("%s Excel source passed", greenTick)
+	})
+
+	t.Run("Pipeline quarantines failed formulas and writes a sheet", func(t *testing.T) {
+		quarantineFile := filepath.Join(t.TempDir(), "quarantine.jsonl")
+		out := filepath.Join(t.TempDir(), "out.xlsx")
+		p := &pipeline.Pipeline{
+			Source:             integrations.ExcelSource{},
+			SourceRequest:      interfaces.Request{ExcelSourceFileName: file, ExcelSourceSheet: "Orders"},
+			Destination:        integrations.ExcelDestination{},
+			DestinationRequest: interfaces.Request{ExcelDestinationFileName: out, ExcelDestinationSheet: "Report"},
+			Config: interfaces.PipelineConfig{ErrorHandling: interfaces.ErrorHandling{
+				QuarantineOutput: interfaces.QuarantineOutput{Type: "file", Location: quarantineFile},
+			}},
+		}
+		summary, err := p.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 3, summary.RecordsRead)
+		assert.Equal(t, 2, summary.RecordsWritten)
+		assert.Equal(t, 1, summary.RecordsQuarantined)
+		quarantined, err := os.ReadFile(quarantineFile)
+		assert.NoError(t, err)
+		assert.Contains(t, string(quarantined), "#DIV/0!")
+
+		// The written sheet reads back the same, dates included
+		data, err := integrations.ExcelSource{}.FetchData(interfaces.Request{ExcelSourceFileName: out})
+		assert.NoError(t, err)
+		read := data.(*pipeline.SourceRows)
+		assert.Equal(t, []string{"id", "paid", "placed", "price", "qty", "region", "total"}, read.Columns)
+		assert.Len(t, read.Records, 2)
+		assert.Equal(t, time.Date(2024, 1, 6, 12, 30, 0, 0, time.UTC), read.Records[1]["placed"])
+		assert.Equal(t, 4.5, read.Records[1]["total"])
+		assert.Empty(t, read.Rejected)
+		t.Logf("%s Excel pipeline passed", greenTick)
+	})
+}
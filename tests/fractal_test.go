@@ -0,0 +1,182 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SkySingh04/fractal/integrations"
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+	"github.com/SkySingh04/fractal/pipeline"
+	"github.com/SkySingh04/fractal/pkg/fractal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLibraryRun(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Run from a config map", func(t *testing.T) {
+		integrations.Memory("library-in").Load(
+			map[string]interface{}{"id": 1, "status": "open"},
+			map[string]interface{}{"id": 2, "status": "closed"},
+		)
+		out := integrations.Memory("library-out")
+		out.Reset()
+		cfg, err := fractal.ConfigFromMap(map[string]interface{}{
+			"inputMethod":   "Memory",
+			"inputconfig":   map[string]interface{}{"memoryname": "library-in"},
+			"outputMethod":  "Memory",
+			"outputconfig":  map[string]interface{}{"memoryname": "library-out"},
+			"errorhandling": map[string]interface{}{"strategy": "LOG_AND_CONTINUE"},
+			"select":        map[string]interface{}{"fields": []interface{}{"id"}},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "library-in", cfg.Source.MemoryName)
+
+		summary, err := fractal.Run(context.Background(), cfg)
+		assert.NoError(t, err)
+		assert.Equal(t, pipeline.StatusSuccess, summary.Status)
+		assert.Equal(t, 2, summary.RecordsRead)
+		assert.Equal(t, 2, summary.RecordsWritten)
+		assert.NotEmpty(t, summary.RunID)
+		assert.Equal(t, []map[string]interface{}{{"id": 1}, {"id": 2}}, out.Records())
+		t.Logf("%s Library run passed", greenTick)
+	})
+
+	t.Run("Typed error", func(t *testing.T) {
+		summary, err := fractal.Run(context.Background(), fractal.Config{Input: "Carrier pigeon", Output: "Memory", RunID: "run-1"})
+		var runErr *fractal.Error
+		assert.True(t, errors.As(err, &runErr))
+		assert.Equal(t, interfaces.CodeConfigInvalid, runErr.Code)
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		assert.Equal(t, pipeline.StatusFailure, summary.Status)
+		assert.Equal(t, "run-1", summary.RunID)
+		assert.Equal(t, interfaces.CodeConfigInvalid, summary.ErrorCode)
+
+		integrations.Memory("library-empty").Reset()
+		_, err = fractal.Run(context.Background(), fractal.Config{
+			Input:    "Memory",
+			Source:   interfaces.Request{MemoryName: "library-empty"},
+			Output:   "Memory",
+			Pipeline: interfaces.PipelineConfig{MaxDuration: "soon"},
+		})
+		assert.True(t, errors.As(err, &runErr))
+		assert.Equal(t, interfaces.CodeConfigInvalid, runErr.Code)
+		t.Logf("%s Failed runs return a typed error and a summary", greenTick)
+	})
+
+	t.Run("Failing integration returns", func(t *testing.T) {
+		var logs strings.Builder
+		logger.SetOutput(&logs)
+		t.Cleanup(func() { logger.SetOutput(nil) })
+		// The JSON source logs the invalid data as an error, and the run goes on to return it
+		summary, err := fractal.Run(context.Background(), fractal.Config{
+			Input:       "JSON",
+			Source:      interfaces.Request{JSONSourceData: "{not json"},
+			Output:      "Memory",
+			Destination: interfaces.Request{MemoryName: "library-unused"},
+		})
+		assert.Error(t, err)
+		assert.Equal(t, pipeline.StatusFailure, summary.Status)
+		assert.Contains(t, logs.String(), "[ERROR] Validation error")
+		t.Logf("%s Failing integration returned to the caller", greenTick)
+	})
+
+	t.Run("Invalid configuration", func(t *testing.T) {
+		_, err := fractal.ConfigFromMap(map[string]interface{}{"inputMethod": "Memory", "inputconfig": map[string]interface{}{}})
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		assert.ErrorContains(t, err, "outputconfig")
+
+		_, err = fractal.LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"), "")
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		assert.NoError(t, os.WriteFile(path, []byte("inputMethod: Memory\ninputconfig:\n  memoryname: library-in\noutputMethod: Memory\noutputconfig:\n  memoryname: library-out\n"), 0644))
+		cfg, err := fractal.LoadConfig(path, "")
+		assert.NoError(t, err)
+		assert.Equal(t, "library-out", cfg.Destination.MemoryName)
+		t.Logf("%s Invalid configurations rejected", greenTick)
+	})
+}
+
+func TestErrorStrategyFlags(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Flags", func(t *testing.T) {
+		for _, tc := range []struct {
+			failFast, keepGoing bool
+			outer               string
+			expected            string
+		}{
+			{false, false, "", ""},
+			{true, false, "", pipeline.StrategyStopOnError},
+			{false, true, "", pipeline.StrategyLogAndContinue},
+			// Neither flag given to the command keeps the one given before it
+			{false, false, pipeline.StrategyStopOnError, pipeline.StrategyStopOnError},
+			{false, false, pipeline.StrategyLogAndContinue, pipeline.StrategyLogAndContinue},
+			// A flag given to the command beats one given before it
+			{true, false, pipeline.StrategyLogAndContinue, pipeline.StrategyStopOnError},
+			{false, true, pipeline.StrategyStopOnError, pipeline.StrategyLogAndContinue},
+		} {
+			strategy, err := fractal.StrategyFlag(tc.failFast, tc.keepGoing, tc.outer)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, strategy, "fail-fast %v, keep-going %v, outer %q", tc.failFast, tc.keepGoing, tc.outer)
+		}
+
+		for _, outer := range []string{"", pipeline.StrategyStopOnError, pipeline.StrategyLogAndContinue} {
+			_, err := fractal.StrategyFlag(true, true, outer)
+			assert.EqualError(t, err, "--fail-fast and --keep-going cannot be used together")
+		}
+		t.Logf("%s Strategy flags passed", greenTick)
+	})
+
+	t.Run("Precedence over the config", func(t *testing.T) {
+		for _, tc := range []struct {
+			name       string
+			global     [2]bool // --fail-fast and --keep-going given before run
+			run        [2]bool // --fail-fast and --keep-going given to run
+			configured string
+			expected   string
+		}{
+			{"default", [2]bool{}, [2]bool{}, "", pipeline.StrategyStopOnError},
+			{"config over default", [2]bool{}, [2]bool{}, pipeline.StrategyLogAndContinue, pipeline.StrategyLogAndContinue},
+			{"global flag over config", [2]bool{false, true}, [2]bool{}, pipeline.StrategyStopOnError, pipeline.StrategyLogAndContinue},
+			{"global flag over default", [2]bool{false, true}, [2]bool{}, "", pipeline.StrategyLogAndContinue},
+			{"run flag over config", [2]bool{}, [2]bool{true, false}, pipeline.StrategyLogAndContinue, pipeline.StrategyStopOnError},
+			{"run flag over global flag", [2]bool{true, false}, [2]bool{false, true}, pipeline.StrategyStopOnError, pipeline.StrategyLogAndContinue},
+			{"run flag over global flag and config", [2]bool{false, true}, [2]bool{true, false}, pipeline.StrategyLogAndContinue, pipeline.StrategyStopOnError},
+		} {
+			global, err := fractal.StrategyFlag(tc.global[0], tc.global[1], "")
+			assert.NoError(t, err)
+			strategy, err := fractal.StrategyFlag(tc.run[0], tc.run[1], global)
+			assert.NoError(t, err)
+
+			configuration := map[string]interface{}{}
+			if tc.configured != "" {
+				configuration["errorhandling"] = map[string]interface{}{"strategy": tc.configured, "maxerrors": 5}
+			}
+			fractal.OverrideStrategy(configuration, strategy)
+			errorhandling, _ := configuration["errorhandling"].(map[string]interface{})
+			effective, _ := errorhandling["strategy"].(string)
+			if effective == "" {
+				effective = pipeline.StrategyStopOnError
+			}
+			assert.Equal(t, tc.expected, effective, tc.name)
+			if tc.configured != "" {
+				assert.Equal(t, 5, errorhandling["maxerrors"], "%s: other error handling settings were lost", tc.name)
+			}
+		}
+		t.Logf("%s Strategy precedence passed", greenTick)
+	})
+
+	t.Run("No flag leaves the config alone", func(t *testing.T) {
+		configuration := map[string]interface{}{"inputMethod": "CSV"}
+		fractal.OverrideStrategy(configuration, "")
+		assert.Equal(t, map[string]interface{}{"inputMethod": "CSV"}, configuration)
+		t.Logf("%s Unset strategy passed", greenTick)
+	})
+}
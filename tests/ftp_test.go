@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/SkySingh04/fractal/config"
+	"github.com/SkySingh04/fractal/integrations"
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/pkg/fractal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkedDownload(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	file := bytes.Repeat([]byte("0123456789"), 10)
+	req := interfaces.Request{ChunkSize: 32, ChunkRetries: 2, ChunkRetryBackoff: "1ms"}
+
+	t.Run("Failed reads resume where they stopped", func(t *testing.T) {
+		var offsets []int64
+		var retries []bool
+		failures := 0
+		data, err := integrations.ReadChunks("big.csv", int64(len(file)), req, func(offset int64, buf []byte, retry bool) (int, error) {
+			offsets, retries = append(offsets, offset), append(retries, retry)
+			// The second chunk breaks off twice, ten bytes in each time
+			if offset >= 32 && offset < 64 && failures < 2 {
+				failures++
+				return copy(buf[:10], file[offset:]), errors.New("connection reset by peer")
+			}
+			return copy(buf, file[offset:]), nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, file, data)
+		assert.Equal(t, []int64{0, 32, 42, 52, 64, 96}, offsets)
+		assert.Equal(t, []bool{false, false, true, true, false, false}, retries)
+		t.Logf("%s Resumed download passed", greenTick)
+	})
+
+	t.Run("A chunk out of retries fails the download", func(t *testing.T) {
+		calls := 0
+		_, err := integrations.ReadChunks("big.csv", int64(len(file)), req, func(offset int64, buf []byte, retry bool) (int, error) {
+			calls++
+			if offset >= 64 {
+				return 0, errors.New("connection reset by peer")
+			}
+			return copy(buf, file[offset:]), nil
+		})
+		assert.EqualError(t, err, "failed to download bytes 64-95 of big.csv: connection reset by peer")
+		assert.Equal(t, 2+1+req.ChunkRetries, calls)
+		t.Logf("%s Exhausted retries passed", greenTick)
+	})
+
+	t.Run("Invalid settings", func(t *testing.T) {
+		source := interfaces.Request{FTPURL: "ftp://localhost:1", FTPUser: "user", FTPPassword: "secret", FTPFILEPATH: "big.csv", ChunkSize: -1}
+		_, err := integrations.FTPSource{}.FetchData(source)
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+
+		sftpSource := interfaces.Request{SFTPURL: "sftp://localhost:1", SFTPUser: "user", SFTPPassword: "secret", SFTPFILEPATH: "big.csv", ChunkSize: 1024, ChunkRetryBackoff: "soon"}
+		_, err = integrations.SFTPSource{}.FetchData(sftpSource)
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		assert.ErrorContains(t, err, `invalid chunk retry backoff "soon"`)
+		t.Logf("%s Invalid settings passed", greenTick)
+	})
+
+	t.Run("Config keys", func(t *testing.T) {
+		settings := map[string]interface{}{
+			"url":               "ftp://files.example.com",
+			"user":              "fractal",
+			"password":          "secret",
+			"ftpfilepath":       "/exports/orders.csv",
+			"sftpfilepath":      "/exports/orders.jsonl",
+			"chunksize":         8388608,
+			"chunkretries":      5,
+			"chunkretrybackoff": "2s",
+		}
+		req := fractal.RequestFromMap(settings)
+		assert.Equal(t, "/exports/orders.csv", req.FTPFILEPATH)
+		assert.Equal(t, "/exports/orders.jsonl", req.SFTPFILEPATH)
+		assert.Equal(t, 8388608, req.ChunkSize)
+		assert.Equal(t, 5, req.ChunkRetries)
+		assert.Equal(t, "2s", req.ChunkRetryBackoff)
+
+		// The keys are the source fields, so the setup prompts for them and the schema lists them
+		for _, method := range []string{"FTP", "SFTP"} {
+			properties := inputSchema(t, method)
+			for _, key := range []string{"chunksize", "chunkretries", "chunkretrybackoff"} {
+				assert.Contains(t, properties, key, method)
+			}
+		}
+		t.Logf("%s Chunk settings read from the config", greenTick)
+	})
+}
+
+// inputSchema returns the inputconfig properties the config schema gives a source
+func inputSchema(t *testing.T, method string) map[string]interface{} {
+	t.Helper()
+	for _, condition := range config.Schema()["allOf"].([]interface{}) {
+		c := condition.(map[string]interface{})
+		selected := c["if"].(map[string]interface{})["properties"].(map[string]interface{})["inputMethod"]
+		if selected == nil || selected.(map[string]interface{})["const"] != method {
+			continue
+		}
+		inputconfig := c["then"].(map[string]interface{})["properties"].(map[string]interface{})["inputconfig"].(map[string]interface{})
+		return inputconfig["properties"].(map[string]interface{})
+	}
+	t.Fatalf("No inputconfig schema for the %s source", method)
+	return nil
+}
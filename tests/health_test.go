@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SkySingh04/fractal/controller"
+	"github.com/SkySingh04/fractal/integrations"
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+	"github.com/stretchr/testify/assert"
+	"gofr.dev/pkg/gofr"
+)
+
+// pingingSource counts its pings and fails them with err
+type pingingSource struct {
+	pings atomic.Int32
+	err   error
+}
+
+func (s *pingingSource) FetchData(req interfaces.Request) (interface{}, error) {
+	return nil, nil
+}
+
+func (s *pingingSource) Ping(ctx context.Context, req interfaces.Request) error {
+	s.pings.Add(1)
+	return s.err
+}
+
+func TestReadiness(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Health", func(t *testing.T) {
+		status, err := controller.HealthHandler(&gofr.Context{Context: context.Background()})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"status": "ok"}, status)
+		t.Logf("%s Health answers", greenTick)
+	})
+
+	t.Run("Ready targets are cached", func(t *testing.T) {
+		source := &pingingSource{}
+		readiness := controller.NewReadiness(time.Hour,
+			controller.ReadinessTarget{Role: "source", Method: "Fake", Integration: source},
+			controller.ReadinessTarget{Role: "destination", Method: "JSON", Integration: integrations.JSONDestination{}},
+		)
+		first := readiness.Check(context.Background())
+		second := readiness.Check(context.Background())
+		assert.True(t, first.Ready)
+		assert.Equal(t, first, second)
+		assert.Equal(t, int32(1), source.pings.Load(), "A cached result should not ping again")
+		assert.Equal(t, []controller.IntegrationCheck{
+			{Role: "source", Method: "Fake", Ready: true},
+			{Role: "destination", Method: "JSON", Ready: true, Skipped: true},
+		}, first.Checks)
+		t.Logf("%s Readiness cached", greenTick)
+	})
+
+	t.Run("Expired results ping again", func(t *testing.T) {
+		source := &pingingSource{}
+		readiness := controller.NewReadiness(time.Millisecond, controller.ReadinessTarget{Role: "source", Method: "Fake", Integration: source})
+		readiness.Check(context.Background())
+		time.Sleep(5 * time.Millisecond)
+		readiness.Check(context.Background())
+		assert.Equal(t, int32(2), source.pings.Load())
+		t.Logf("%s Expired readiness checked again", greenTick)
+	})
+
+	t.Run("Unreachable target", func(t *testing.T) {
+		var logs bytes.Buffer
+		logger.SetOutput(&logs)
+		defer logger.SetOutput(nil)
+
+		source := &pingingSource{err: errors.New("dial tcp 10.0.0.5:5432: connection refused")}
+		readiness := controller.NewReadiness(0,
+			controller.ReadinessTarget{Role: "source", Method: "Fake", Integration: source},
+			controller.ReadinessTarget{Role: "destination", Method: "JSON", Integration: integrations.JSONDestination{}},
+		)
+		_, err := readiness.Handler(&gofr.Context{Context: context.Background()})
+		var notReady *controller.NotReadyError
+		assert.ErrorAs(t, err, &notReady)
+		assert.Equal(t, http.StatusServiceUnavailable, notReady.StatusCode())
+		assert.EqualError(t, err, "not ready: source Fake")
+		assert.False(t, notReady.Report.Ready)
+
+		// Probes see which target is down, the server log sees why
+		body, err := json.Marshal(notReady.Report)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(body), "10.0.0.5")
+		assert.Contains(t, string(body), `"checks":[{"role":"source","method":"Fake","ready":false},{"role":"destination","method":"JSON","ready":true}]`)
+		assert.Contains(t, logs.String(), "source Fake can't be reached: dial tcp 10.0.0.5:5432: connection refused")
+		t.Logf("%s Unreachable target reported without its error", greenTick)
+	})
+
+	t.Run("No targets", func(t *testing.T) {
+		report, err := controller.NewReadiness(0).Handler(&gofr.Context{Context: context.Background()})
+		assert.NoError(t, err)
+		assert.True(t, report.(controller.ReadinessReport).Ready)
+		t.Logf("%s Server without a config is ready", greenTick)
+	})
+
+	t.Run("Missing connection details", func(t *testing.T) {
+		err := integrations.PostgreSQLSource{}.Ping(context.Background(), interfaces.Request{})
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		t.Logf("%s Ping without a connection string rejected", greenTick)
+	})
+}
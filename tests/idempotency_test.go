@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SkySingh04/fractal/controller"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRunStore(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Duplicate key while running", func(t *testing.T) {
+		store := controller.NewMemoryRunStore()
+		_, claimed, err := store.Claim("nightly-load", "run-1", time.Hour)
+		assert.NoError(t, err)
+		assert.True(t, claimed)
+
+		entry, claimed, err := store.Claim("nightly-load", "run-2", time.Hour)
+		assert.NoError(t, err)
+		assert.False(t, claimed)
+		assert.Equal(t, "run-1", entry.RunID)
+		assert.False(t, entry.Done)
+		t.Logf("%s In-progress duplicate detected", greenTick)
+	})
+
+	t.Run("Duplicate key after success", func(t *testing.T) {
+		store := controller.NewMemoryRunStore()
+		store.Claim("nightly-load", "run-1", time.Hour)
+		assert.NoError(t, store.Complete("nightly-load", "report"))
+
+		entry, claimed, _ := store.Claim("nightly-load", "run-2", time.Hour)
+		assert.False(t, claimed)
+		assert.True(t, entry.Done)
+		assert.Equal(t, "report", entry.Result)
+		t.Logf("%s Completed result returned", greenTick)
+	})
+
+	t.Run("Released and expired keys", func(t *testing.T) {
+		store := controller.NewMemoryRunStore()
+		store.Claim("failed-load", "run-1", time.Hour)
+		assert.NoError(t, store.Release("failed-load"))
+		_, claimed, _ := store.Claim("failed-load", "run-2", time.Hour)
+		assert.True(t, claimed, "Released key could not be claimed again")
+
+		store.Claim("short-lived", "run-3", time.Millisecond)
+		time.Sleep(5 * time.Millisecond)
+		_, claimed, _ = store.Claim("short-lived", "run-4", time.Hour)
+		assert.True(t, claimed, "Expired key could not be claimed again")
+		t.Logf("%s Released and expired keys reusable", greenTick)
+	})
+}
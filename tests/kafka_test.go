@@ -5,6 +5,8 @@ import (
 	"context"
 	"testing"
 
+	"github.com/SkySingh04/fractal/integrations"
+	"github.com/SkySingh04/fractal/interfaces"
 	"github.com/segmentio/kafka-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -167,3 +169,25 @@ func TestKafkaWriter_Close(t *testing.T) {
 	}	
 	mockWriter.AssertExpectations(t)
 }
+
+func TestKafkaStartOffset(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	source := integrations.KafkaSource{}
+
+	t.Run("Accepted settings", func(t *testing.T) {
+		for _, setting := range []string{"", "earliest", "LATEST", "2024-05-01T00:00:00Z", "2024-05-01T02:00:00+02:00"} {
+			assert.NoError(t, source.ValidateConfig(interfaces.Request{KafkaStartOffset: setting}), setting)
+		}
+		t.Logf("%s Start offsets accepted", greenTick)
+	})
+
+	t.Run("Invalid setting", func(t *testing.T) {
+		for _, setting := range []string{"oldest", "2024-05-01"} {
+			err := source.ValidateConfig(interfaces.Request{KafkaStartOffset: setting})
+			assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+			assert.ErrorContains(t, err, "expected earliest, latest or an RFC 3339 timestamp")
+		}
+		t.Logf("%s Invalid start offsets rejected", greenTick)
+	})
+}
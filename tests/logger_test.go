@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SkySingh04/fractal/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogFile(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Lines are written and rotated", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "fractal.log")
+		closeLog, err := logger.OpenFile(logger.FileConfig{Path: path, RotateEvery: 50 * time.Millisecond})
+		assert.NoError(t, err)
+
+		logger.Infof("first run %d", 1)
+		assert.Eventually(t, func() bool {
+			entries, _ := os.ReadDir(dir)
+			return len(entries) >= 2
+		}, time.Second, 10*time.Millisecond, "Log file was not rotated")
+		assert.NoError(t, closeLog())
+
+		entries, err := os.ReadDir(dir)
+		assert.NoError(t, err)
+		var found []string
+		for _, entry := range entries {
+			content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+			assert.NoError(t, err)
+			if strings.Contains(string(content), "[INFO] first run 1\n") {
+				found = append(found, entry.Name())
+			}
+		}
+		assert.Len(t, found, 1, "The line should be in exactly one file")
+		assert.NotContains(t, found, "fractal.log", "The line should have been rotated out")
+		t.Logf("%s Log file rotation passed", greenTick)
+	})
+
+	t.Run("Invalid settings", func(t *testing.T) {
+		_, err := logger.OpenFile(logger.FileConfig{Path: filepath.Join(t.TempDir(), "fractal.log"), MaxBackups: -1})
+		assert.Error(t, err)
+		t.Logf("%s Negative settings rejected", greenTick)
+	})
+}
+
+func TestLogOutput(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	var out strings.Builder
+	logger.SetOutput(&out)
+	t.Cleanup(func() { logger.SetOutput(nil) })
+
+	t.Run("Lines go to the writer", func(t *testing.T) {
+		out.Reset()
+		t.Setenv(logger.LevelEnv, "INFO")
+		logger.Infof("read %d records", 3)
+		logger.Debugf("hidden below DEBUG")
+		logger.Warnf("slow destination")
+		logger.Errorf("insert failed: %s", "duplicate key")
+		// Errorf and Warnf return, so the caller decides whether to give up
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		assert.Len(t, lines, 3)
+		assert.Contains(t, lines[0], "[INFO] read 3 records")
+		assert.Contains(t, lines[1], "[WARN] slow destination")
+		assert.Contains(t, lines[2], "[ERROR] insert failed: duplicate key")
+		t.Logf("%s Log lines written to the writer", greenTick)
+	})
+
+	t.Run("Debug lines at the DEBUG level", func(t *testing.T) {
+		out.Reset()
+		t.Setenv(logger.LevelEnv, "DEBUG")
+		logger.Debugf("batch %d", 1)
+		assert.Contains(t, out.String(), "[DEBUG] batch 1")
+		t.Logf("%s Debug lines written at the DEBUG level", greenTick)
+	})
+}
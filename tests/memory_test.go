@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SkySingh04/fractal/integrations"
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/pipeline"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryIntegration(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Pipeline from memory to memory", func(t *testing.T) {
+		integrations.Memory("orders").Load(
+			map[string]interface{}{"id": 1, "status": "open", "note": "rush"},
+			map[string]interface{}{"id": 2, "status": "closed", "note": ""},
+		)
+		out := integrations.Memory("orders-out")
+		out.Reset()
+		p := &pipeline.Pipeline{
+			Source:             integrations.MemorySource{},
+			SourceRequest:      interfaces.Request{MemoryName: "orders"},
+			Destination:        integrations.MemoryDestination{},
+			DestinationRequest: interfaces.Request{MemoryName: "orders-out"},
+			Config:             interfaces.PipelineConfig{Select: interfaces.SelectConfig{Fields: []string{"id", "status"}}},
+		}
+		summary, err := p.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 2, summary.RecordsWritten)
+		assert.Equal(t, []map[string]interface{}{{"id": 1, "status": "open"}, {"id": 2, "status": "closed"}}, out.Records())
+		assert.Equal(t, 1, out.Batches())
+		t.Logf("%s Memory pipeline passed", greenTick)
+	})
+
+	t.Run("Stores are isolated copies", func(t *testing.T) {
+		store := integrations.Memory("")
+		store.Load(map[string]interface{}{"id": 1})
+		records := store.Records()
+		records[0]["id"] = 99
+		assert.Equal(t, 1, store.Records()[0]["id"])
+		assert.Same(t, store, integrations.Memory(integrations.DefaultMemoryStore))
+
+		// CSV from another source is read into records
+		assert.NoError(t, integrations.MemoryDestination{}.SendData("id,name\n2,Jane", interfaces.Request{}))
+		assert.Equal(t, map[string]interface{}{"id": "2", "name": "Jane"}, store.Records()[1])
+		assert.Error(t, integrations.MemoryDestination{}.SendData([]byte("raw"), interfaces.Request{}))
+
+		store.Reset()
+		assert.Empty(t, store.Records())
+		t.Logf("%s Memory store passed", greenTick)
+	})
+}
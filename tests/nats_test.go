@@ -0,0 +1,167 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/SkySingh04/fractal/integrations"
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/pipeline"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+)
+
+// runJetStream starts an embedded NATS server with JetStream and a stream
+// ORDERS on orders.>, returning its URL and a JetStream client
+func runJetStream(t *testing.T) (string, jetstream.JetStream) {
+	t.Helper()
+	opts := natsserver.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+	srv := natsserver.RunServer(&opts)
+	t.Cleanup(srv.Shutdown)
+
+	conn, err := nats.Connect(srv.ClientURL())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(conn.Close)
+	js, err := jetstream.New(conn)
+	assert.NoError(t, err)
+	_, err = js.CreateStream(context.Background(), jetstream.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>"}})
+	assert.NoError(t, err)
+	return srv.ClientURL(), js
+}
+
+// natsAckPending returns how many messages a durable consumer has handed out but not had acknowledged
+func natsAckPending(t *testing.T, js jetstream.JetStream, durable string) (int, uint64) {
+	t.Helper()
+	consumer, err := js.Consumer(context.Background(), "ORDERS", durable)
+	if !assert.NoError(t, err) {
+		return 0, 0
+	}
+	info, err := consumer.Info(context.Background())
+	assert.NoError(t, err)
+	return info.NumAckPending, info.AckFloor.Stream
+}
+
+func TestNATSConfig(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	source := integrations.NATSSource{}
+	destination := integrations.NATSDestination{}
+	base := interfaces.Request{NATSURL: "nats://localhost:4222", NATSSubject: "events.orders"}
+
+	t.Run("Missing subject", func(t *testing.T) {
+		_, err := source.FetchData(interfaces.Request{NATSURL: base.NATSURL})
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		assert.ErrorIs(t, destination.SendData([]map[string]interface{}{{"id": 1}}, interfaces.Request{NATSURL: base.NATSURL}), interfaces.ErrConfigInvalid)
+		t.Logf("%s Missing subject rejected", greenTick)
+	})
+
+	t.Run("Invalid ack wait", func(t *testing.T) {
+		req := base
+		req.NATSAckWait = "forever"
+		_, err := source.FetchData(req)
+		assert.ErrorContains(t, err, `invalid NATS ack wait "forever"`)
+		t.Logf("%s Invalid ack wait rejected", greenTick)
+	})
+
+	t.Run("Creds file and token together", func(t *testing.T) {
+		req := base
+		req.NATSCredsFile = "user.creds"
+		req.NATSToken = "secret"
+		err := destination.SendData([]map[string]interface{}{{"id": 1}}, req)
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		t.Logf("%s Conflicting credentials rejected", greenTick)
+	})
+
+	t.Run("Nothing to publish", func(t *testing.T) {
+		assert.NoError(t, destination.SendData([]map[string]interface{}{}, base))
+		t.Logf("%s Empty batch skipped", greenTick)
+	})
+}
+
+func TestNATSAcknowledgement(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	url, js := runJetStream(t)
+	ctx := context.Background()
+	for _, msg := range []struct{ subject, data string }{
+		{"orders.created", `{"id":1}`},
+		{"orders.cancelled", `{"id":2}`},
+		{"orders.created", `{"id":3}`},
+	} {
+		_, err := js.Publish(ctx, msg.subject, []byte(msg.data))
+		assert.NoError(t, err)
+	}
+	source := integrations.NATSSource{}
+
+	t.Run("Stream found by subject, acknowledged by Commit only", func(t *testing.T) {
+		req := interfaces.Request{NATSURL: url, NATSSubject: "orders.created", NATSDurable: "created", NATSReceiveTimeout: "200ms"}
+		data, err := source.FetchData(req)
+		assert.NoError(t, err)
+		// Only the subject's messages, from the stream holding it
+		assert.Equal(t, []map[string]interface{}{{"id": float64(1)}, {"id": float64(3)}}, data)
+		pending, _ := natsAckPending(t, js, "created")
+		assert.Equal(t, 2, pending, "Messages were acknowledged before Commit")
+
+		assert.NoError(t, source.Commit(req))
+		pending, floor := natsAckPending(t, js, "created")
+		assert.Equal(t, 0, pending)
+		assert.Equal(t, uint64(3), floor)
+
+		// Everything is acknowledged, so the next read is empty
+		data, err = source.FetchData(req)
+		assert.NoError(t, err)
+		assert.Empty(t, data)
+		t.Logf("%s Acknowledgement on Commit passed", greenTick)
+	})
+
+	t.Run("A failed delivery acknowledges nothing", func(t *testing.T) {
+		req := interfaces.Request{NATSURL: url, NATSSubject: "orders.>", NATSStream: "ORDERS", NATSDurable: "all", NATSReceiveTimeout: "200ms", NATSAckWait: "1m"}
+		failing := &pipeline.Pipeline{Source: source, SourceRequest: req, Destination: &flakyDestination{failures: 1}}
+		_, err := failing.Run(ctx)
+		assert.Error(t, err)
+		pending, floor := natsAckPending(t, js, "all")
+		assert.Equal(t, 3, pending, "Messages were acknowledged although the run failed")
+		assert.Equal(t, uint64(0), floor)
+
+		// The next run is sent the same messages again, well before the ack wait runs out
+		dest := &captureDestination{}
+		started := time.Now()
+		retried := &pipeline.Pipeline{Source: source, SourceRequest: req, Destination: dest}
+		_, err = retried.Run(ctx)
+		assert.NoError(t, err)
+		assert.Less(t, time.Since(started), 30*time.Second)
+		assert.Equal(t, []map[string]interface{}{{"id": float64(1)}, {"id": float64(2)}, {"id": float64(3)}}, dest.sent)
+		pending, floor = natsAckPending(t, js, "all")
+		assert.Equal(t, 0, pending)
+		assert.Equal(t, uint64(3), floor)
+		t.Logf("%s Failed delivery passed", greenTick)
+	})
+
+	t.Run("Subject and stream settings", func(t *testing.T) {
+		_, err := source.FetchData(interfaces.Request{NATSURL: url, NATSSubject: "invoices.created", NATSReceiveTimeout: "200ms"})
+		assert.ErrorContains(t, err, "failed to find the JetStream stream for subject invoices.created")
+
+		_, err = source.FetchData(interfaces.Request{NATSURL: url, NATSSubject: "orders.created", NATSStream: "INVOICES", NATSReceiveTimeout: "200ms"})
+		assert.ErrorContains(t, err, "failed to create durable consumer fractal on stream INVOICES")
+
+		// The destination publishes to the subject, and the source reads it back through the default durable
+		destination := integrations.NATSDestination{}
+		assert.NoError(t, destination.SendData([]map[string]interface{}{{"id": 4}}, interfaces.Request{NATSURL: url, NATSSubject: "orders.shipped"}))
+		req := interfaces.Request{NATSURL: url, NATSSubject: "orders.shipped", NATSReceiveTimeout: "200ms"}
+		data, err := source.FetchData(req)
+		assert.NoError(t, err)
+		assert.Equal(t, []map[string]interface{}{{"id": float64(4)}}, data)
+		assert.NoError(t, source.Commit(req))
+		pending, _ := natsAckPending(t, js, integrations.DefaultNATSDurable)
+		assert.Equal(t, 0, pending)
+		t.Logf("%s Subject and stream settings passed", greenTick)
+	})
+}
@@ -0,0 +1,228 @@
+package tests
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SkySingh04/fractal/integrations"
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/pipeline"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionedOutput(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	records := []map[string]interface{}{
+		{"id": 1, "dt": "2024-01-01", "region": "us"},
+		{"id": 2, "dt": "2024-01-01", "region": "eu"},
+		{"id": 3, "dt": "2024-01-01", "region": "us"},
+		{"id": 4, "dt": "2024-01-02", "region": nil},
+	}
+
+	t.Run("CSV with one open writer", func(t *testing.T) {
+		dir := t.TempDir()
+		req := interfaces.Request{
+			CSVDestinationFileName:  filepath.Join(dir, "orders.csv"),
+			PartitionBy:             []string{"dt", "region"},
+			PartitionMaxOpenWriters: 1,
+		}
+		assert.NoError(t, integrations.CSVDestination{}.SendData(records, req))
+
+		// The us partition is closed by the eu record and reopened for appending
+		us, err := os.ReadFile(filepath.Join(dir, "dt=2024-01-01", "region=us", "orders.csv"))
+		assert.NoError(t, err)
+		assert.Equal(t, "id\n1\n3\n", string(us))
+		eu, err := os.ReadFile(filepath.Join(dir, "dt=2024-01-01", "region=eu", "orders.csv"))
+		assert.NoError(t, err)
+		assert.Equal(t, "id\n2\n", string(eu))
+		_, err = os.Stat(filepath.Join(dir, "dt=2024-01-02", "region="+integrations.DefaultPartitionEmptyValue, "orders.csv"))
+		assert.NoError(t, err)
+		t.Logf("%s Partitioned CSV passed", greenTick)
+	})
+
+	t.Run("JSON with an empty placeholder", func(t *testing.T) {
+		dir := t.TempDir()
+		req := interfaces.Request{
+			JSONOutputFilename:  filepath.Join(dir, "orders.json"),
+			PartitionBy:         []string{"region"},
+			PartitionEmptyValue: "unknown",
+		}
+		assert.NoError(t, integrations.JSONDestination{}.SendData(records, req))
+
+		written, err := os.ReadFile(filepath.Join(dir, "region=unknown", "orders.json"))
+		assert.NoError(t, err)
+		var decoded []map[string]interface{}
+		assert.NoError(t, json.Unmarshal(written, &decoded))
+		assert.Equal(t, []map[string]interface{}{{"id": float64(4), "dt": "2024-01-02"}}, decoded)
+		t.Logf("%s Partitioned JSON passed", greenTick)
+	})
+
+	t.Run("Values cannot escape their directory", func(t *testing.T) {
+		dir := t.TempDir()
+		req := interfaces.Request{
+			CSVDestinationFileName: filepath.Join(dir, "out", "rows.csv"),
+			PartitionBy:            []string{"region"},
+		}
+		assert.NoError(t, integrations.CSVDestination{}.SendData("id,region\n1,../../etc", req))
+		_, err := os.Stat(filepath.Join(dir, "out", "region=..%2F..%2Fetc", "rows.csv"))
+		assert.NoError(t, err)
+		t.Logf("%s Escaped partition value passed", greenTick)
+	})
+}
+
+func TestOutputModes(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	input := "id,name\n1,a\n2,b\n3,c\n4,d\n5,e"
+	run := func(t *testing.T, req interfaces.Request, delivery interfaces.DeliveryConfig) error {
+		t.Helper()
+		p := &pipeline.Pipeline{
+			Source:             stubSource{data: input},
+			Destination:        integrations.CSVDestination{},
+			DestinationRequest: req,
+			Config:             interfaces.PipelineConfig{Delivery: delivery},
+		}
+		_, err := p.Run(context.Background())
+		return err
+	}
+	read := func(t *testing.T, path string) string {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		return string(data)
+	}
+
+	t.Run("Single file", func(t *testing.T) {
+		dir := t.TempDir()
+		req := interfaces.Request{CSVDestinationFileName: filepath.Join(dir, "out.csv")}
+		assert.NoError(t, run(t, req, interfaces.DeliveryConfig{BatchSize: 2}))
+		assert.Equal(t, "id,name\n1,a\n2,b\n3,c\n4,d\n5,e\n", read(t, req.CSVDestinationFileName))
+		t.Logf("%s Single output passed", greenTick)
+	})
+
+	t.Run("One file per batch", func(t *testing.T) {
+		dir := t.TempDir()
+		req := interfaces.Request{CSVDestinationFileName: filepath.Join(dir, "part-{index}.csv"), OutputMode: pipeline.OutputPerBatch}
+		assert.NoError(t, run(t, req, interfaces.DeliveryConfig{BatchSize: 2, MaxInFlight: 3}))
+		assert.Equal(t, "id,name\n1,a\n2,b\n", read(t, filepath.Join(dir, "part-00000.csv")))
+		assert.Equal(t, "id,name\n5,e\n", read(t, filepath.Join(dir, "part-00002.csv")))
+		t.Logf("%s Per-batch output passed", greenTick)
+	})
+
+	t.Run("Roll over by rows", func(t *testing.T) {
+		dir := t.TempDir()
+		req := interfaces.Request{CSVDestinationFileName: filepath.Join(dir, "out.csv"), OutputMode: pipeline.OutputSized, OutputMaxRows: 3}
+		assert.NoError(t, run(t, req, interfaces.DeliveryConfig{}))
+		assert.Equal(t, "id,name\n1,a\n2,b\n3,c\n", read(t, filepath.Join(dir, "out-00000.csv")))
+		assert.Equal(t, "id,name\n4,d\n5,e\n", read(t, filepath.Join(dir, "out-00001.csv")))
+		t.Logf("%s Sized output by rows passed", greenTick)
+	})
+
+	t.Run("Roll over by bytes", func(t *testing.T) {
+		dir := t.TempDir()
+		req := interfaces.Request{CSVDestinationFileName: filepath.Join(dir, "out.csv"), OutputMode: pipeline.OutputSized, OutputMaxBytes: 16}
+		assert.NoError(t, run(t, req, interfaces.DeliveryConfig{BatchSize: 2}))
+		assert.Equal(t, "id,name\n1,a\n2,b\n", read(t, filepath.Join(dir, "out-00000.csv")))
+		assert.Equal(t, "id,name\n3,c\n4,d\n", read(t, filepath.Join(dir, "out-00001.csv")))
+		assert.Equal(t, "id,name\n5,e\n", read(t, filepath.Join(dir, "out-00002.csv")))
+		t.Logf("%s Sized output by bytes passed", greenTick)
+	})
+
+	t.Run("Appending needs ordered batches", func(t *testing.T) {
+		req := interfaces.Request{CSVDestinationFileName: filepath.Join(t.TempDir(), "out.csv")}
+		err := run(t, req, interfaces.DeliveryConfig{BatchSize: 2, MaxInFlight: 2})
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		t.Logf("%s In-flight guard passed", greenTick)
+	})
+}
+
+func TestManifest(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	input := "id,region\n1,us\n2,eu\n3,us"
+	run := func(t *testing.T, dest interfaces.DataDestination, req interfaces.Request, cfg interfaces.ManifestConfig) (*pipeline.Summary, error) {
+		t.Helper()
+		p := &pipeline.Pipeline{
+			Source:             stubSource{data: input},
+			Destination:        dest,
+			DestinationRequest: req,
+			Config:             interfaces.PipelineConfig{Manifest: cfg, Delivery: interfaces.DeliveryConfig{BatchSize: 2}},
+			RunID:              "run-1",
+		}
+		return p.Run(context.Background())
+	}
+
+	t.Run("Listing", func(t *testing.T) {
+		dir := t.TempDir()
+		req := interfaces.Request{CSVDestinationFileName: filepath.Join(dir, "out.csv")}
+		summary, err := run(t, integrations.CSVDestination{}, req, interfaces.ManifestConfig{Enabled: true})
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(dir, "_SUCCESS"), summary.Manifest)
+
+		written, err := os.ReadFile(filepath.Join(dir, "_SUCCESS"))
+		assert.NoError(t, err)
+		var listing pipeline.Manifest
+		assert.NoError(t, json.Unmarshal(written, &listing))
+		assert.Equal(t, "run-1", listing.RunID)
+		assert.Equal(t, 3, listing.Records)
+		assert.Len(t, listing.Files, 1)
+		assert.Equal(t, "out.csv", listing.Files[0].Path)
+		assert.Equal(t, 3, listing.Files[0].Records)
+		output, err := os.ReadFile(req.CSVDestinationFileName)
+		assert.NoError(t, err)
+		sum := sha256.Sum256(output)
+		assert.Equal(t, int64(len(output)), listing.Files[0].Bytes)
+		assert.Equal(t, hex.EncodeToString(sum[:]), listing.Files[0].SHA256)
+		t.Logf("%s Manifest lists the file, its records and checksum", greenTick)
+	})
+
+	t.Run("Partitioned JSON and an empty marker", func(t *testing.T) {
+		dir := t.TempDir()
+		req := interfaces.Request{JSONOutputFilename: filepath.Join(dir, "orders.json"), PartitionBy: []string{"region"}}
+		_, err := run(t, integrations.JSONDestination{}, req, interfaces.ManifestConfig{Enabled: true, Path: "done/READY", Format: "json"})
+		assert.NoError(t, err)
+		written, err := os.ReadFile(filepath.Join(dir, "done", "READY"))
+		assert.NoError(t, err)
+		var listing pipeline.Manifest
+		assert.NoError(t, json.Unmarshal(written, &listing))
+		assert.Len(t, listing.Files, 2)
+		assert.Equal(t, filepath.Join(dir, "region=eu", "orders.json"), listing.Files[0].Path)
+
+		dir = t.TempDir()
+		req = interfaces.Request{CSVDestinationFileName: filepath.Join(dir, "out.csv")}
+		_, err = run(t, integrations.CSVDestination{}, req, interfaces.ManifestConfig{Enabled: true, Format: pipeline.ManifestEmpty})
+		assert.NoError(t, err)
+		info, err := os.Stat(filepath.Join(dir, "_SUCCESS"))
+		assert.NoError(t, err)
+		assert.Zero(t, info.Size())
+		t.Logf("%s Marker path and format passed", greenTick)
+	})
+
+	t.Run("No marker after a failed run", func(t *testing.T) {
+		dir := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "_SUCCESS"), nil, 0644))
+		assert.NoError(t, os.Mkdir(filepath.Join(dir, "out.csv"), 0755))
+		req := interfaces.Request{CSVDestinationFileName: filepath.Join(dir, "out.csv")}
+		_, err := run(t, integrations.CSVDestination{}, req, interfaces.ManifestConfig{Enabled: true})
+		assert.ErrorIs(t, err, interfaces.ErrWrite)
+		_, err = os.Stat(filepath.Join(dir, "_SUCCESS"))
+		assert.True(t, os.IsNotExist(err))
+		t.Logf("%s Failed run leaves no marker", greenTick)
+	})
+
+	t.Run("Destinations without files", func(t *testing.T) {
+		_, err := run(t, integrations.StdoutDestination{}, interfaces.Request{}, interfaces.ManifestConfig{Enabled: true})
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		_, err = run(t, integrations.CSVDestination{}, interfaces.Request{CSVDestinationFileName: integrations.StdoutPath}, interfaces.ManifestConfig{Enabled: true})
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		_, err = run(t, integrations.CSVDestination{}, interfaces.Request{CSVDestinationFileName: "out.csv"}, interfaces.ManifestConfig{Enabled: true, Format: "xml"})
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		t.Logf("%s Manifest options rejected", greenTick)
+	})
+}
@@ -0,0 +1,3399 @@
+package tests
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SkySingh04/fractal/controller"
+	"github.com/SkySingh04/fractal/integrations"
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/opentele"
+	"github.com/SkySingh04/fractal/pipeline"
+	"github.com/SkySingh04/fractal/registry"
+	"github.com/SkySingh04/fractal/version"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// stubSource returns fixed data from FetchData
+type stubSource struct {
+	data interface{}
+}
+
+func (s stubSource) FetchData(req interfaces.Request) (interface{}, error) {
+	return s.data, nil
+}
+
+// failingSource fails every FetchData call, as a source that is down does
+type failingSource struct {
+	err error
+}
+
+func (s failingSource) FetchData(req interfaces.Request) (interface{}, error) {
+	return nil, s.err
+}
+
+// checkpointSource counts the Commit calls the pipeline makes
+type checkpointSource struct {
+	stubSource
+	commits int
+}
+
+func (c *checkpointSource) Commit(req interfaces.Request) error {
+	c.commits++
+	return nil
+}
+
+// captureDestination remembers the data passed to SendData
+type captureDestination struct {
+	sent interface{}
+}
+
+func (c *captureDestination) SendData(data interface{}, req interfaces.Request) error {
+	c.sent = data
+	return nil
+}
+
+// flakyDestination fails a number of SendData calls before accepting data
+type flakyDestination struct {
+	failures int
+	batches  []interface{}
+}
+
+func (f *flakyDestination) SendData(data interface{}, req interfaces.Request) error {
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("destination unavailable")
+	}
+	f.batches = append(f.batches, data)
+	return nil
+}
+
+func runPipeline(t *testing.T, data interface{}, cfg interfaces.PipelineConfig) (interface{}, *pipeline.Summary) {
+	t.Helper()
+	dest := &captureDestination{}
+	p := &pipeline.Pipeline{
+		Source:      stubSource{data: data},
+		Destination: dest,
+		Config:      cfg,
+	}
+	summary, err := p.Run(context.Background())
+	assert.NoError(t, err, "Pipeline run failed")
+	return dest.sent, summary
+}
+
+func TestFilterStage(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	input := "name,status,age\nJohn,active,25\nJane,inactive,30\nJim,active,41"
+
+	t.Run("Keep matching records", func(t *testing.T) {
+		cfg := interfaces.PipelineConfig{Filter: interfaces.FilterConfig{
+			Mode:  "keep",
+			Rules: []string{`FIELD("status") == "active"`},
+		}}
+		sent, summary := runPipeline(t, input, cfg)
+		assert.Equal(t, "name,status,age\nJohn,active,25\nJim,active,41", sent)
+		assert.Equal(t, 3, summary.RecordsRead)
+		assert.Equal(t, 2, summary.RecordsWritten)
+		assert.Equal(t, 1, summary.RecordsFiltered)
+		assert.Equal(t, 0, summary.RecordsQuarantined)
+		t.Logf("%s Keep mode passed", greenTick)
+	})
+
+	t.Run("Drop matching records", func(t *testing.T) {
+		cfg := interfaces.PipelineConfig{Filter: interfaces.FilterConfig{
+			Mode:  "drop",
+			Rules: []string{`FIELD("status") == "active" FIELD("age") > 30`},
+		}}
+		sent, summary := runPipeline(t, input, cfg)
+		assert.Equal(t, "name,status,age\nJohn,active,25\nJane,inactive,30", sent)
+		assert.Equal(t, 1, summary.RecordsFiltered)
+		t.Logf("%s Drop mode passed", greenTick)
+	})
+
+	t.Run("Invalid mode", func(t *testing.T) {
+		_, err := pipeline.NewFilterStage(interfaces.FilterConfig{Mode: "maybe", Rules: []string{`FIELD("age") > 1`}})
+		assert.Error(t, err)
+		t.Logf("%s Invalid mode rejected", greenTick)
+	})
+}
+
+func TestAggregateStage(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	input := []map[string]interface{}{
+		{"region": "us", "amount": 10},
+		{"region": "eu", "amount": 5},
+		{"region": "us", "amount": 30},
+		{"region": "apac", "amount": nil},
+		{"region": "eu", "amount": 7.5},
+	}
+	expected := []map[string]interface{}{
+		{"region": "apac", "count": int64(1), "total": float64(0), "min_amount": nil, "max_amount": nil, "avg_amount": nil},
+		{"region": "eu", "count": int64(2), "total": 12.5, "min_amount": float64(5), "max_amount": 7.5, "avg_amount": 6.25},
+		{"region": "us", "count": int64(2), "total": float64(40), "min_amount": float64(10), "max_amount": float64(30), "avg_amount": float64(20)},
+	}
+	aggregations := []string{"count", "sum(amount) as total", "min(amount)", "max(amount)", "avg(amount)"}
+
+	t.Run("In memory", func(t *testing.T) {
+		cfg := interfaces.PipelineConfig{Aggregate: interfaces.AggregateConfig{
+			GroupBy:      []string{"region"},
+			Aggregations: aggregations,
+		}}
+		sent, summary := runPipeline(t, input, cfg)
+		assert.Equal(t, expected, sent)
+		assert.Equal(t, 5, summary.RecordsRead)
+		assert.Equal(t, 3, summary.RecordsWritten)
+		t.Logf("%s In-memory aggregation passed", greenTick)
+	})
+
+	t.Run("Spill to disk", func(t *testing.T) {
+		spillDir := t.TempDir()
+		cfg := interfaces.PipelineConfig{Aggregate: interfaces.AggregateConfig{
+			GroupBy:      []string{"region"},
+			Aggregations: aggregations,
+			MaxGroups:    1,
+			SpillDir:     spillDir,
+		}}
+		sent, _ := runPipeline(t, input, cfg)
+		assert.Equal(t, expected, sent)
+
+		leftover, err := os.ReadDir(spillDir)
+		assert.NoError(t, err)
+		assert.Empty(t, leftover, "Spill files were not cleaned up")
+		t.Logf("%s Spilled aggregation passed", greenTick)
+	})
+
+	t.Run("Invalid aggregation", func(t *testing.T) {
+		_, err := pipeline.NewAggregateStage(interfaces.AggregateConfig{Aggregations: []string{"median(amount)"}})
+		assert.Error(t, err)
+		t.Logf("%s Invalid aggregation rejected", greenTick)
+	})
+}
+
+func TestWindowStage(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	events := []map[string]interface{}{
+		{"user": "a", "at": "2024-01-01T00:00:10Z"},
+		{"user": "b", "at": "2024-01-01T00:01:00Z"},
+		{"user": "a", "at": "2024-01-01T00:04:59Z"},
+		{"user": "a", "at": "2024-01-01T00:05:30Z"},
+		{"user": "b", "at": "2024-01-01T00:04:00Z"}, // Late: 00:00-00:05 closed at 00:05:30
+		{"user": "a", "at": "2024-01-01T00:11:00Z"},
+	}
+
+	t.Run("Tumbling windows", func(t *testing.T) {
+		cfg := interfaces.PipelineConfig{Window: interfaces.WindowConfig{
+			Size: "5m", TimeField: "at", GroupBy: []string{"user"},
+		}}
+		sent, summary := runPipeline(t, events, cfg)
+		assert.Equal(t, []map[string]interface{}{
+			{"user": "a", "window_start": "2024-01-01T00:00:00Z", "window_end": "2024-01-01T00:05:00Z", "count": int64(2)},
+			{"user": "b", "window_start": "2024-01-01T00:00:00Z", "window_end": "2024-01-01T00:05:00Z", "count": int64(1)},
+			{"user": "a", "window_start": "2024-01-01T00:05:00Z", "window_end": "2024-01-01T00:10:00Z", "count": int64(1)},
+			{"user": "a", "window_start": "2024-01-01T00:10:00Z", "window_end": "2024-01-01T00:15:00Z", "count": int64(1)},
+		}, sent)
+		assert.Equal(t, 1, summary.RecordsFiltered)
+		t.Logf("%s Tumbling windows emitted as they closed, late event dropped", greenTick)
+	})
+
+	t.Run("Allowed lateness", func(t *testing.T) {
+		cfg := interfaces.PipelineConfig{Window: interfaces.WindowConfig{
+			Size: "5m", TimeField: "at", AllowedLateness: "1m",
+		}}
+		sent, summary := runPipeline(t, events, cfg)
+		out := sent.([]map[string]interface{})
+		assert.Equal(t, int64(4), out[0]["count"])
+		assert.Equal(t, 0, summary.RecordsFiltered)
+		t.Logf("%s Event within the allowed lateness counted", greenTick)
+	})
+
+	t.Run("Late events quarantined", func(t *testing.T) {
+		stage, err := pipeline.NewWindowStage(interfaces.WindowConfig{Size: "5m", TimeField: "at", Late: "quarantine"})
+		assert.NoError(t, err)
+		for _, event := range events[:4] {
+			_, err := stage.Process(pipeline.Record(event))
+			assert.NoError(t, err)
+		}
+		_, err = stage.Process(pipeline.Record(events[4]))
+		assert.ErrorIs(t, err, pipeline.ErrQuarantine)
+		t.Logf("%s Late event quarantined", greenTick)
+	})
+
+	t.Run("Sliding windows", func(t *testing.T) {
+		stage, err := pipeline.NewWindowStage(interfaces.WindowConfig{
+			Type: "sliding", Size: "10m", Slide: "5m", TimeField: "at", TimeLayout: "unix",
+			Aggregations: []string{"count", "sum(amount) as total"},
+		})
+		assert.NoError(t, err)
+		// 00:07 falls in the windows starting at 00:00 and 00:05
+		out, err := stage.Process(pipeline.Record{"at": 420, "amount": 3})
+		assert.NoError(t, err)
+		assert.Empty(t, out)
+		out, err = stage.Process(pipeline.Record{"at": 720, "amount": 4})
+		assert.NoError(t, err)
+		assert.Equal(t, []pipeline.Record{
+			{"window_start": "1970-01-01T00:00:00Z", "window_end": "1970-01-01T00:10:00Z", "count": int64(1), "total": float64(3)},
+		}, out)
+		out, err = stage.Flush()
+		assert.NoError(t, err)
+		assert.Equal(t, []pipeline.Record{
+			{"window_start": "1970-01-01T00:05:00Z", "window_end": "1970-01-01T00:15:00Z", "count": int64(2), "total": float64(7)},
+			{"window_start": "1970-01-01T00:10:00Z", "window_end": "1970-01-01T00:20:00Z", "count": int64(1), "total": float64(4)},
+		}, out)
+		t.Logf("%s Sliding windows overlapped", greenTick)
+	})
+
+	t.Run("Processing time", func(t *testing.T) {
+		stage, err := pipeline.NewWindowStage(interfaces.WindowConfig{Size: "1h", Time: "processing"})
+		assert.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			_, err := stage.Process(pipeline.Record{"n": i})
+			assert.NoError(t, err)
+		}
+		out, err := stage.Flush()
+		assert.NoError(t, err)
+		var total int64
+		for _, rec := range out {
+			total += rec["count"].(int64)
+		}
+		assert.Equal(t, int64(3), total)
+		t.Logf("%s Processing time windows counted arrivals", greenTick)
+	})
+
+	t.Run("Invalid settings", func(t *testing.T) {
+		for _, tc := range []struct {
+			cfg      interfaces.WindowConfig
+			expected string
+		}{
+			{interfaces.WindowConfig{Size: "soon", TimeField: "at"}, "invalid window size"},
+			{interfaces.WindowConfig{Size: "5m"}, "event time windows need a timefield"},
+			{interfaces.WindowConfig{Type: "hopping", Size: "5m", TimeField: "at"}, "invalid window type"},
+			{interfaces.WindowConfig{Size: "5m", Slide: "1m", TimeField: "at"}, "only set for sliding windows"},
+			{interfaces.WindowConfig{Type: "sliding", Size: "5m", Slide: "10m", TimeField: "at"}, "longer than the window size"},
+			{interfaces.WindowConfig{Size: "5m", Time: "processing", AllowedLateness: "1m"}, "only read for event time"},
+			{interfaces.WindowConfig{Size: "5m", TimeField: "at", Late: "keep"}, "invalid window late"},
+			{interfaces.WindowConfig{Size: "5m", TimeField: "at", Aggregations: []string{"count as window_end"}}, "duplicate aggregation output field"},
+		} {
+			_, err := pipeline.NewWindowStage(tc.cfg)
+			assert.ErrorContains(t, err, tc.expected)
+		}
+		t.Logf("%s Invalid window settings rejected", greenTick)
+	})
+}
+
+func TestJoinStage(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	registry.RegisterSource("TestCustomers", stubSource{data: []map[string]interface{}{
+		{"id": 1, "tier": "gold", "country": "IN"},
+		{"id": 2, "tier": "silver", "country": "US"},
+	}})
+	t.Cleanup(func() { registry.UnregisterSource("TestCustomers") })
+	input := "txn,customer_id,amount\nt1,1,10\nt2,3,20\nt3,2,30"
+	join := interfaces.JoinConfig{Input: "TestCustomers", Key: "customer_id", LookupKey: "id", Fields: []string{"tier"}}
+
+	t.Run("Pass unmatched records", func(t *testing.T) {
+		sent, summary := runPipeline(t, input, interfaces.PipelineConfig{Join: join})
+		assert.Equal(t, "txn,customer_id,amount,tier\nt1,1,10,gold\nt2,3,20,\nt3,2,30,silver", sent)
+		assert.Equal(t, 3, summary.RecordsWritten)
+		t.Logf("%s Pass policy passed", greenTick)
+	})
+
+	t.Run("Drop unmatched records", func(t *testing.T) {
+		cfg := join
+		cfg.Unmatched = "drop"
+		sent, summary := runPipeline(t, input, interfaces.PipelineConfig{Join: cfg})
+		assert.Equal(t, "txn,customer_id,amount,tier\nt1,1,10,gold\nt3,2,30,silver", sent)
+		assert.Equal(t, 1, summary.RecordsFiltered)
+		t.Logf("%s Drop policy passed", greenTick)
+	})
+
+	t.Run("Quarantine unmatched records", func(t *testing.T) {
+		cfg := join
+		cfg.Unmatched = "quarantine"
+		sent, summary := runPipeline(t, input, interfaces.PipelineConfig{Join: cfg})
+		assert.Equal(t, "txn,customer_id,amount,tier\nt1,1,10,gold\nt3,2,30,silver", sent)
+		assert.Equal(t, 1, summary.RecordsQuarantined)
+		t.Logf("%s Quarantine policy passed", greenTick)
+	})
+
+	t.Run("Lookup too large", func(t *testing.T) {
+		cfg := join
+		cfg.MaxRecords = 1
+		_, err := pipeline.NewJoinStage(cfg)
+		assert.Error(t, err)
+		t.Logf("%s Size guard passed", greenTick)
+	})
+
+	t.Run("Optional lookup unavailable", func(t *testing.T) {
+		registry.RegisterSource("TestCustomersDown", failingSource{err: errors.New("connection refused")})
+		t.Cleanup(func() { registry.UnregisterSource("TestCustomersDown") })
+		cfg := join
+		cfg.Input = "TestCustomersDown"
+		cfg.Unmatched = "quarantine"
+		_, err := pipeline.NewJoinStage(cfg)
+		assert.ErrorContains(t, err, "failed to fetch lookup data from TestCustomersDown: connection refused")
+
+		// Records pass on with null fields, whatever the unmatched policy
+		cfg.Optional = true
+		sent, summary := runPipeline(t, input, interfaces.PipelineConfig{Join: cfg})
+		assert.Equal(t, "txn,customer_id,amount,tier\nt1,1,10,\nt2,3,20,\nt3,2,30,", sent)
+		assert.Equal(t, 3, summary.RecordsWritten)
+		assert.Equal(t, 0, summary.RecordsQuarantined)
+
+		// A lookup that loads but breaks a limit still fails the run
+		cfg.Input, cfg.MaxRecords = "TestCustomers", 1
+		_, err = pipeline.NewJoinStage(cfg)
+		assert.ErrorContains(t, err, "more than the limit of 1")
+		t.Logf("%s Optional lookup passed", greenTick)
+	})
+}
+
+func TestValidateStage(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	integrations.Memory("countries").Load(
+		map[string]interface{}{"code": "IN"},
+		map[string]interface{}{"code": "US"},
+	)
+	lookups := map[string]interfaces.LookupConfig{"Countries": {
+		Input:   "Memory",
+		Request: &interfaces.Request{MemoryName: "countries"},
+		Key:     "code",
+	}}
+	input := "id,country_code,amount\n1,IN,10\n2,FR,20\n3,US,-5"
+
+	t.Run("Reject values outside the lookup", func(t *testing.T) {
+		cfg := interfaces.PipelineConfig{
+			Validate:      interfaces.ValidationConfig{Rules: []string{"country_code in_source countries"}},
+			Lookups:       lookups,
+			ErrorHandling: interfaces.ErrorHandling{Strategy: pipeline.StrategyLogAndContinue},
+		}
+		sent, summary := runPipeline(t, input, cfg)
+		assert.Equal(t, "id,country_code,amount\n1,IN,10\n3,US,-5", sent)
+		assert.Equal(t, 1, summary.RecordsQuarantined)
+		assert.Equal(t, 1, summary.StageErrors["validate"])
+		t.Logf("%s in_source rule passed", greenTick)
+	})
+
+	t.Run("Combine with grammar rules", func(t *testing.T) {
+		cfg := interfaces.PipelineConfig{
+			Validate: interfaces.ValidationConfig{Rules: []string{
+				"country_code in_source countries",
+				`FIELD("amount") RANGE(0, 100)`,
+			}},
+			Lookups:       lookups,
+			ErrorHandling: interfaces.ErrorHandling{Strategy: pipeline.StrategyLogAndContinue},
+		}
+		sent, summary := runPipeline(t, input, cfg)
+		assert.Equal(t, "id,country_code,amount\n1,IN,10", sent)
+		assert.Equal(t, 2, summary.RecordsQuarantined)
+		t.Logf("%s Grammar rules passed", greenTick)
+	})
+
+	t.Run("Stop on a failing record", func(t *testing.T) {
+		p := &pipeline.Pipeline{
+			Source:      stubSource{data: input},
+			Destination: &captureDestination{},
+			Config: interfaces.PipelineConfig{
+				Validate: interfaces.ValidationConfig{Rules: []string{"country_code in_source countries"}},
+				Lookups:  lookups,
+			},
+		}
+		_, err := p.Run(context.Background())
+		assert.ErrorIs(t, err, interfaces.ErrValidation)
+		t.Logf("%s Stop on error passed", greenTick)
+	})
+
+	t.Run("Optional lookup unavailable", func(t *testing.T) {
+		registry.RegisterSource("TestCountriesDown", failingSource{err: errors.New("connection refused")})
+		t.Cleanup(func() { registry.UnregisterSource("TestCountriesDown") })
+		down := map[string]interfaces.LookupConfig{"countries": {Input: "TestCountriesDown", Key: "code"}}
+		rules := interfaces.ValidationConfig{Rules: []string{"country_code in_source countries", `FIELD("amount") RANGE(0, 100)`}}
+		_, err := pipeline.NewValidateStage(rules, down)
+		assert.ErrorContains(t, err, "connection refused")
+
+		// The in_source rule is skipped, the others still apply
+		down["countries"] = interfaces.LookupConfig{Input: "TestCountriesDown", Key: "code", Optional: true}
+		cfg := interfaces.PipelineConfig{
+			Validate:      rules,
+			Lookups:       down,
+			ErrorHandling: interfaces.ErrorHandling{Strategy: pipeline.StrategyLogAndContinue},
+		}
+		sent, summary := runPipeline(t, input, cfg)
+		assert.Equal(t, "id,country_code,amount\n1,IN,10\n2,FR,20", sent)
+		assert.Equal(t, 1, summary.RecordsQuarantined)
+		t.Logf("%s Optional lookup passed", greenTick)
+	})
+
+	t.Run("Unknown lookup", func(t *testing.T) {
+		_, err := pipeline.NewValidateStage(interfaces.ValidationConfig{Rules: []string{"country_code in_source regions"}}, lookups)
+		assert.Error(t, err)
+		t.Logf("%s Unknown lookup passed", greenTick)
+	})
+}
+
+func TestStageOrder(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	input := "id,placed\n1,2024-01-05\n2,yesterday\n3,2023-12-31"
+	base := interfaces.PipelineConfig{
+		Validate: interfaces.ValidationConfig{
+			Rules: []string{`FIELD("placed") TYPE(DATE)`},
+			Sets:  map[string][]string{"recent": {`FIELD("placed") MATCHES("^2024-.*T")`}},
+		},
+		Transform:     interfaces.TransformConfig{Rules: []string{"datetime placed from date to rfc3339"}},
+		ErrorHandling: interfaces.ErrorHandling{Strategy: pipeline.StrategyLogAndContinue},
+	}
+
+	t.Run("Validate, transform, validate again", func(t *testing.T) {
+		cfg := base
+		cfg.Stages = []string{"validate", "transform", "validate:recent"}
+		sent, summary := runPipeline(t, input, cfg)
+		assert.Equal(t, "id,placed\n1,2024-01-05T00:00:00Z", sent)
+		assert.Equal(t, 1, summary.StageErrors["validate"])
+		assert.Equal(t, 1, summary.StageErrors["validate:recent"])
+		t.Logf("%s Stage list passed", greenTick)
+	})
+
+	t.Run("Default order without a list", func(t *testing.T) {
+		cfg := base
+		cfg.Validate.Sets = nil
+		stages, err := pipeline.BuildStages(cfg)
+		assert.NoError(t, err)
+		var names []string
+		for _, stage := range stages {
+			names = append(names, stage.Name())
+		}
+		assert.Equal(t, []string{"validate", "transform"}, names)
+		t.Logf("%s Default order passed", greenTick)
+	})
+
+	t.Run("Invalid lists", func(t *testing.T) {
+		for _, stages := range [][]string{
+			{"validate", "transform", "sort"},                      // unknown stage
+			{"transform", "validate:recent"},                       // validate left out
+			{"validate", "transform"},                              // recent set left out
+			{"validate", "transform", "validate:old"},              // unknown set
+			{"validate", "transform:recent", "validate:recent"},    // set on another stage
+			{"validate", "transform", "filter", "validate:recent"}, // filter not configured
+		} {
+			cfg := base
+			cfg.Stages = stages
+			_, err := pipeline.BuildStages(cfg)
+			assert.Error(t, err, "stages %v", stages)
+		}
+		t.Logf("%s Invalid lists passed", greenTick)
+	})
+}
+
+// hookedDestination records the order of its hook and write calls
+type hookedDestination struct {
+	calls      []string
+	prepareErr error
+}
+
+func (h *hookedDestination) Prepare(req interfaces.Request) error {
+	h.calls = append(h.calls, "prepare")
+	return h.prepareErr
+}
+
+func (h *hookedDestination) SendData(data interface{}, req interfaces.Request) error {
+	h.calls = append(h.calls, "send")
+	return nil
+}
+
+func (h *hookedDestination) Finish(req interfaces.Request) error {
+	h.calls = append(h.calls, "finish")
+	return nil
+}
+
+func TestDestinationHooks(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	input := "id,age\n1,25\n2,x\n3,41"
+
+	t.Run("Prepare before the first batch, finish after the last", func(t *testing.T) {
+		dest := &hookedDestination{}
+		p := &pipeline.Pipeline{
+			Source:      stubSource{data: input},
+			Destination: dest,
+			Config:      interfaces.PipelineConfig{Delivery: interfaces.DeliveryConfig{BatchSize: 1}},
+		}
+		_, err := p.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"prepare", "send", "send", "send", "finish"}, dest.calls)
+		t.Logf("%s Hook order passed", greenTick)
+	})
+
+	t.Run("A failed prepare writes nothing", func(t *testing.T) {
+		dest := &hookedDestination{prepareErr: errors.New("no staging table")}
+		p := &pipeline.Pipeline{Source: stubSource{data: input}, Destination: dest}
+		_, err := p.Run(context.Background())
+		assert.ErrorIs(t, err, interfaces.ErrWrite)
+		assert.ErrorContains(t, err, "failed to prepare the destination")
+		assert.Equal(t, []string{"prepare"}, dest.calls)
+		t.Logf("%s Failed prepare passed", greenTick)
+	})
+
+	t.Run("No finish after a failed run", func(t *testing.T) {
+		dest := &hookedDestination{}
+		p := &pipeline.Pipeline{
+			Source:      stubSource{data: input},
+			Destination: dest,
+			Config:      interfaces.PipelineConfig{Validate: interfaces.ValidationConfig{Rules: []string{`FIELD("age") TYPE(INT)`}}},
+		}
+		_, err := p.Run(context.Background())
+		assert.ErrorIs(t, err, interfaces.ErrValidation)
+		assert.NotContains(t, dest.calls, "finish")
+		t.Logf("%s Failed run passed", greenTick)
+	})
+}
+
+func TestSchemaDrift(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	input := "id,name,email\n1,a,a@x.io\n2,b,"
+	fields := []string{"id:int", "name:string", "country:string"}
+
+	t.Run("Fail on a changed schema", func(t *testing.T) {
+		p := &pipeline.Pipeline{
+			Source:      stubSource{data: input},
+			Destination: &captureDestination{},
+			Config:      interfaces.PipelineConfig{Schema: interfaces.SchemaConfig{Fields: fields}},
+		}
+		summary, err := p.Run(context.Background())
+		assert.ErrorIs(t, err, interfaces.ErrValidation)
+		assert.Equal(t, &pipeline.SchemaDiff{Added: []string{"email"}, Removed: []string{"country"}}, summary.SchemaDiff)
+		t.Logf("%s Fail policy passed", greenTick)
+	})
+
+	t.Run("Warn and continue", func(t *testing.T) {
+		sent, summary := runPipeline(t, input, interfaces.PipelineConfig{Schema: interfaces.SchemaConfig{Fields: fields, OnChange: "warn"}})
+		assert.Equal(t, input, sent)
+		assert.Equal(t, []string{"email"}, summary.SchemaDiff.Added)
+		t.Logf("%s Warn policy passed", greenTick)
+	})
+
+	t.Run("Adapt the records", func(t *testing.T) {
+		sent, summary := runPipeline(t, input, interfaces.PipelineConfig{Schema: interfaces.SchemaConfig{Fields: fields, OnChange: "adapt"}})
+		assert.Equal(t, "id,name,country\n1,a,\n2,b,", sent)
+		assert.NotNil(t, summary.SchemaDiff)
+		t.Logf("%s Adapt policy passed", greenTick)
+	})
+
+	t.Run("Changed types are not adapted", func(t *testing.T) {
+		data := []map[string]interface{}{{"id": float64(1), "name": "a"}, {"id": "x2", "name": "b"}}
+		p := &pipeline.Pipeline{
+			Source:      stubSource{data: data},
+			Destination: &captureDestination{},
+			Config: interfaces.PipelineConfig{Schema: interfaces.SchemaConfig{
+				Fields:   []string{"id:int", "name:string"},
+				OnChange: "adapt",
+			}},
+		}
+		summary, err := p.Run(context.Background())
+		assert.ErrorIs(t, err, interfaces.ErrValidation)
+		assert.Equal(t, []pipeline.FieldChange{{Field: "id", Expected: "int", Found: "string"}}, summary.SchemaDiff.Changed)
+		t.Logf("%s Type change passed", greenTick)
+	})
+
+	t.Run("Matching schema", func(t *testing.T) {
+		_, summary := runPipeline(t, input, interfaces.PipelineConfig{Schema: interfaces.SchemaConfig{Fields: []string{"id:int", "name:string", "email:string"}}})
+		assert.Nil(t, summary.SchemaDiff)
+		t.Logf("%s Matching schema passed", greenTick)
+	})
+}
+
+func TestRules(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	keywords := map[string]string{}
+	for _, rule := range pipeline.Rules() {
+		assert.NotEmpty(t, rule.Syntax, "rule %s has no syntax", rule.Keyword)
+		assert.NotEmpty(t, rule.Description, "rule %s has no description", rule.Keyword)
+		keywords[rule.Keyword] = rule.Kind
+	}
+	for _, keyword := range []string{"TYPE", "RANGE", "IN", "==", "in_source"} {
+		assert.Equal(t, pipeline.RuleValidation, keywords[keyword], keyword)
+	}
+	assert.Equal(t, pipeline.RuleTransformation, keywords["split"])
+	for _, rule := range pipeline.TransformRules() {
+		assert.Equal(t, pipeline.RuleTransformation, keywords[rule.Keyword], rule.Keyword)
+	}
+	t.Logf("%s Rule listing passed", greenTick)
+}
+
+// pagedSource serves its pages in turn, failing the reads of the pages listed in failures once
+type pagedSource struct {
+	pages    [][]map[string]interface{}
+	failures map[string]bool
+	tokens   []string
+}
+
+func (s *pagedSource) FetchData(req interfaces.Request) (interface{}, error) {
+	return nil, errors.New("paged source read whole")
+}
+
+func (s *pagedSource) FetchPage(req interfaces.Request, token string) (interface{}, string, error) {
+	s.tokens = append(s.tokens, token)
+	if s.failures[token] {
+		delete(s.failures, token)
+		return nil, "", errors.New("page read timed out")
+	}
+	page := 0
+	if token != "" {
+		page, _ = strconv.Atoi(token)
+	}
+	next := ""
+	if page+1 < len(s.pages) {
+		next = strconv.Itoa(page + 1)
+	}
+	return s.pages[page], next, nil
+}
+
+func TestPagedSource(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	pages := [][]map[string]interface{}{
+		{{"id": 1}, {"id": 2}},
+		{{"id": 3}, {"id": 4}},
+		{{"id": 5}},
+	}
+
+	t.Run("Pages stream through the stages", func(t *testing.T) {
+		source := &pagedSource{pages: pages, failures: map[string]bool{"1": true}}
+		dest := &flakyDestination{}
+		p := &pipeline.Pipeline{
+			Source:        source,
+			SourceRequest: interfaces.Request{PageSize: 2, PageRetries: 1, PageRetryBackoff: "1ms"},
+			Destination:   dest,
+			Config: interfaces.PipelineConfig{
+				Filter:   interfaces.FilterConfig{Mode: "drop", Rules: []string{`FIELD("id") == 4`}},
+				Delivery: interfaces.DeliveryConfig{BatchSize: 2},
+			},
+		}
+		summary, err := p.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"", "1", "1", "2"}, source.tokens, "The failed page should be read again with its token")
+		assert.Equal(t, 5, summary.RecordsRead)
+		assert.Equal(t, 4, summary.RecordsWritten)
+		assert.Equal(t, 3, summary.Pages)
+		assert.Equal(t, 1, summary.PageRetries)
+		assert.Len(t, dest.batches, 2)
+		t.Logf("%s Paged read passed", greenTick)
+	})
+
+	t.Run("A page that keeps failing fails the run", func(t *testing.T) {
+		source := &pagedSource{pages: pages, failures: map[string]bool{"1": true}}
+		p := &pipeline.Pipeline{
+			Source:        source,
+			SourceRequest: interfaces.Request{PageSize: 2},
+			Destination:   &captureDestination{},
+		}
+		_, err := p.Run(context.Background())
+		assert.ErrorContains(t, err, "page 2: page read timed out")
+		t.Logf("%s Failed page reported", greenTick)
+	})
+
+	t.Run("Sources that can't page", func(t *testing.T) {
+		p := &pipeline.Pipeline{
+			Source:        stubSource{data: "id\n1"},
+			SourceRequest: interfaces.Request{PageSize: 2},
+			Destination:   &captureDestination{},
+		}
+		_, err := p.Run(context.Background())
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		assert.ErrorContains(t, err, "does not read in pages")
+		t.Logf("%s Page size on a source without pages rejected", greenTick)
+	})
+
+	t.Run("DynamoDB pages", func(t *testing.T) {
+		req := interfaces.Request{DynamoDBSourceTable: "input", DynamoDBSourceRegion: "us-east-1", PageSize: 1}
+		first, next, err := integrations.DynamoDBSource{}.FetchPage(req, "")
+		assert.NoError(t, err)
+		assert.Equal(t, []map[string]interface{}{{"KeyAttribute": "SAMPLEKEY1", "Data": "sampleData1"}}, first)
+		second, last, err := integrations.DynamoDBSource{}.FetchPage(req, next)
+		assert.NoError(t, err)
+		assert.Equal(t, []map[string]interface{}{{"KeyAttribute": "SAMPLEKEY2", "Data": "sampleData2"}}, second)
+		assert.Empty(t, last)
+		t.Logf("%s DynamoDB pages passed", greenTick)
+	})
+}
+
+func TestDelivery(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	input := "id,name\n1,a\n2,b\n3,c\n4,d\n5,e"
+
+	t.Run("Batches with retries", func(t *testing.T) {
+		dest := &flakyDestination{failures: 2}
+		p := &pipeline.Pipeline{
+			Source:      stubSource{data: input},
+			Destination: dest,
+			Config: interfaces.PipelineConfig{Delivery: interfaces.DeliveryConfig{
+				BatchSize:    2,
+				Retries:      2,
+				RetryBackoff: "1ms",
+			}},
+		}
+		summary, err := p.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{"id,name\n1,a\n2,b", "id,name\n3,c\n4,d", "id,name\n5,e"}, dest.batches)
+		assert.Equal(t, 3, summary.BatchesWritten)
+		assert.Equal(t, 2, summary.Retries)
+		assert.Equal(t, 5, summary.RecordsWritten)
+		t.Logf("%s Batching and retries passed", greenTick)
+	})
+
+	t.Run("Retries exhausted", func(t *testing.T) {
+		dest := &flakyDestination{failures: 2}
+		p := &pipeline.Pipeline{
+			Source:      stubSource{data: input},
+			Destination: dest,
+			Config:      interfaces.PipelineConfig{Delivery: interfaces.DeliveryConfig{Retries: 1, RetryBackoff: "1ms"}},
+		}
+		_, err := p.Run(context.Background())
+		assert.Error(t, err)
+		t.Logf("%s Exhausted retries fail the run", greenTick)
+	})
+
+	t.Run("Rate limited", func(t *testing.T) {
+		dest := &flakyDestination{}
+		p := &pipeline.Pipeline{
+			Source:      stubSource{data: input},
+			Destination: dest,
+			Config:      interfaces.PipelineConfig{Delivery: interfaces.DeliveryConfig{MaxRecordsPerSecond: 50, BatchSize: 1}},
+		}
+		start := time.Now()
+		_, err := p.Run(context.Background())
+		assert.NoError(t, err)
+		// The first record goes out straight away, the other four wait 20ms each
+		assert.GreaterOrEqual(t, time.Since(start), 70*time.Millisecond)
+		assert.Len(t, dest.batches, 5)
+		t.Logf("%s Rate limiting passed", greenTick)
+	})
+
+	t.Run("Batches in flight", func(t *testing.T) {
+		for _, tc := range []struct {
+			name        string
+			maxInFlight int
+			override    int
+			peak        int
+		}{
+			{"Default", 0, 0, 1},
+			{"Pipeline setting", 3, 0, 3},
+			{"Destination override", 3, 2, 2},
+		} {
+			dest := &concurrentDestination{}
+			p := &pipeline.Pipeline{
+				Source:             stubSource{data: input + "\n6,f\n7,g\n8,h"},
+				Destination:        dest,
+				DestinationRequest: interfaces.Request{MaxInFlight: tc.override},
+				Config:             interfaces.PipelineConfig{Delivery: interfaces.DeliveryConfig{BatchSize: 1, MaxInFlight: tc.maxInFlight}},
+			}
+			summary, err := p.Run(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, 8, summary.RecordsWritten)
+			assert.Equal(t, 8, summary.BatchesWritten)
+			assert.Equal(t, 8, dest.records)
+			assert.Equal(t, tc.peak, dest.peak, tc.name)
+		}
+
+		// A failed batch stops new ones, and the in-flight ones finish
+		dest := &concurrentDestination{fail: true}
+		p := &pipeline.Pipeline{
+			Source:      stubSource{data: input},
+			Destination: dest,
+			Config:      interfaces.PipelineConfig{Delivery: interfaces.DeliveryConfig{BatchSize: 1, MaxInFlight: 2}},
+		}
+		_, err := p.Run(context.Background())
+		assert.ErrorIs(t, err, interfaces.ErrWrite)
+		assert.ErrorContains(t, err, "destination overloaded")
+		assert.Equal(t, 0, dest.inFlight)
+		assert.LessOrEqual(t, dest.peak, 2)
+		t.Logf("%s Batches in flight passed", greenTick)
+	})
+
+	t.Run("Flush interval", func(t *testing.T) {
+		pages := [][]map[string]interface{}{
+			{{"id": 1}, {"id": 2}},
+			{{"id": 3}, {"id": 4}},
+		}
+		// The second page comes long after the first, so the first one's records are flushed before it
+		dest := &flakyDestination{}
+		p := &pipeline.Pipeline{
+			Source:        &quietSource{pagedSource: pagedSource{pages: pages}, pause: 100 * time.Millisecond},
+			Destination:   dest,
+			SourceRequest: interfaces.Request{PageSize: 2},
+			Config:        interfaces.PipelineConfig{Delivery: interfaces.DeliveryConfig{BatchSize: 10, FlushInterval: "20ms"}},
+		}
+		summary, err := p.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 2, summary.BatchesWritten)
+		assert.Equal(t, 4, summary.RecordsWritten)
+		if assert.Len(t, dest.batches, 2) {
+			assert.Len(t, pipeline.NewDataset(dest.batches[0]).Records, 2)
+			assert.Len(t, pipeline.NewDataset(dest.batches[1]).Records, 2)
+		}
+
+		// Without it the partial batch waits for the rest
+		dest = &flakyDestination{}
+		p.Source = &quietSource{pagedSource: pagedSource{pages: pages}, pause: 50 * time.Millisecond}
+		p.Destination = dest
+		p.Config.Delivery.FlushInterval = ""
+		_, err = p.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, dest.batches, 1)
+
+		p.Config.Delivery.FlushInterval = "soon"
+		_, err = p.Run(context.Background())
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		assert.ErrorContains(t, err, `invalid flush interval "soon"`)
+		t.Logf("%s Flush interval passed", greenTick)
+	})
+}
+
+// quietSource pauses before serving each page after the first, as a source does in a quiet period
+type quietSource struct {
+	pagedSource
+	pause time.Duration
+}
+
+func (q *quietSource) FetchPage(req interfaces.Request, token string) (interface{}, string, error) {
+	if token != "" {
+		time.Sleep(q.pause)
+	}
+	return q.pagedSource.FetchPage(req, token)
+}
+
+// concurrentDestination counts the SendData calls in progress at once
+type concurrentDestination struct {
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+	records  int
+	fail     bool
+}
+
+func (c *concurrentDestination) SendData(data interface{}, req interfaces.Request) error {
+	c.mu.Lock()
+	c.inFlight++
+	if c.inFlight > c.peak {
+		c.peak = c.inFlight
+	}
+	c.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight--
+	if c.fail {
+		return errors.New("destination overloaded")
+	}
+	c.records += len(pipeline.NewDataset(data).Records)
+	return nil
+}
+
+// slowDestination takes its time over the first SendData call and records what it is sent
+type slowDestination struct {
+	spillDir   string
+	spillFiles int
+	batches    []interface{}
+}
+
+func (s *slowDestination) SendData(data interface{}, req interfaces.Request) error {
+	if len(s.batches) == 0 {
+		time.Sleep(50 * time.Millisecond)
+		entries, _ := os.ReadDir(s.spillDir)
+		s.spillFiles = len(entries)
+	}
+	s.batches = append(s.batches, data)
+	return nil
+}
+
+// gaugeDestination collects the metrics of the reader while its first batch is written
+type gaugeDestination struct {
+	reader *sdkmetric.ManualReader
+	gauges map[string]metricdata.DataPoint[int64]
+}
+
+func (g *gaugeDestination) SendData(data interface{}, req interfaces.Request) error {
+	if g.gauges != nil {
+		return nil
+	}
+	g.gauges = map[string]metricdata.DataPoint[int64]{}
+	var collected metricdata.ResourceMetrics
+	if err := g.reader.Collect(context.Background(), &collected); err != nil {
+		return err
+	}
+	for _, scope := range collected.ScopeMetrics {
+		if scope.Scope.Name != pipeline.MeterName {
+			continue
+		}
+		for _, m := range scope.Metrics {
+			if gauge, ok := m.Data.(metricdata.Gauge[int64]); ok && len(gauge.DataPoints) == 1 {
+				g.gauges[m.Name] = gauge.DataPoints[0]
+			}
+		}
+	}
+	return nil
+}
+
+// typedRecords returns records holding values JSON would not read back as they were
+func typedRecords(n int) []map[string]interface{} {
+	at := time.Date(2026, 10, 14, 9, 30, 0, 123456789, time.UTC)
+	var records []map[string]interface{}
+	for i := 0; i < n; i++ {
+		records = append(records, map[string]interface{}{
+			"id":     int64(1)<<53 + int64(i*7%n), // Past what a float64 holds exactly
+			"tenant": int64(i % 2),
+			"n":      1234568 + i,
+			"at":     at.Add(time.Duration(i%3) * 24 * time.Hour),
+			"raw":    []byte{0xff, byte(i)},
+			"tags":   []interface{}{"a", int64(i)},
+			"meta":   map[string]interface{}{"seq": uint32(i), "ratio": float32(0.5)},
+			"none":   nil,
+		})
+	}
+	return records
+}
+
+func TestSpillKeepsTypes(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Sort", func(t *testing.T) {
+		memory, _ := runPipeline(t, typedRecords(10), interfaces.PipelineConfig{Sort: interfaces.SortConfig{By: []string{"n desc"}}})
+		spillDir := t.TempDir()
+		spilled, _ := runPipeline(t, typedRecords(10), interfaces.PipelineConfig{Sort: interfaces.SortConfig{By: []string{"n desc"}, MaxRecords: 3, SpillDir: spillDir}})
+		assert.Equal(t, memory, spilled)
+		records := spilled.([]map[string]interface{})
+		assert.Equal(t, 1234577, records[0]["n"])
+		assert.Equal(t, int64(1)<<53+3, records[0]["id"])
+		assert.IsType(t, time.Time{}, records[0]["at"])
+		t.Logf("%s Spilled sort passed", greenTick)
+	})
+
+	t.Run("Buffer", func(t *testing.T) {
+		var outputs [][]interface{}
+		for _, spill := range []bool{false, true} {
+			spillDir := t.TempDir()
+			dest := &slowDestination{spillDir: spillDir}
+			p := &pipeline.Pipeline{
+				Source:      stubSource{data: typedRecords(10)},
+				Destination: dest,
+				Config: interfaces.PipelineConfig{
+					Buffer:   interfaces.BufferConfig{Capacity: 2, Spill: spill, SpillDir: spillDir},
+					Delivery: interfaces.DeliveryConfig{BatchSize: 1},
+				},
+			}
+			summary, err := p.Run(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, spill, summary.Buffer.Spilled > 0)
+			outputs = append(outputs, dest.batches)
+		}
+		assert.Equal(t, outputs[0], outputs[1])
+		t.Logf("%s Spilled buffer passed", greenTick)
+	})
+
+	t.Run("Aggregate", func(t *testing.T) {
+		cfg := interfaces.AggregateConfig{GroupBy: []string{"at", "tenant"}, Aggregations: []string{"count", "max(n) as n"}}
+		memory, _ := runPipeline(t, typedRecords(12), interfaces.PipelineConfig{Aggregate: cfg})
+		cfg.MaxGroups, cfg.SpillDir = 1, t.TempDir()
+		spilled, _ := runPipeline(t, typedRecords(12), interfaces.PipelineConfig{Aggregate: cfg})
+		assert.Equal(t, memory, spilled)
+		records := spilled.([]map[string]interface{})
+		assert.Len(t, records, 6)
+		assert.IsType(t, time.Time{}, records[0]["at"])
+		assert.IsType(t, int64(0), records[0]["tenant"])
+		t.Logf("%s Spilled aggregation passed", greenTick)
+	})
+}
+
+func TestBuffer(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	lines := []string{"id"}
+	var expected []interface{}
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, fmt.Sprint(i))
+		expected = append(expected, fmt.Sprintf("id\n%d", i))
+	}
+	input := strings.Join(lines, "\n")
+
+	for _, spill := range []bool{false, true} {
+		t.Run(fmt.Sprintf("Spill %v", spill), func(t *testing.T) {
+			spillDir := t.TempDir()
+			dest := &slowDestination{spillDir: spillDir}
+			p := &pipeline.Pipeline{
+				Source:      stubSource{data: input},
+				Destination: dest,
+				Config: interfaces.PipelineConfig{
+					Buffer:   interfaces.BufferConfig{Capacity: 2, Spill: spill, SpillDir: spillDir},
+					Delivery: interfaces.DeliveryConfig{BatchSize: 1},
+				},
+			}
+			summary, err := p.Run(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, expected, dest.batches, "Records were reordered or lost")
+			assert.Equal(t, 20, summary.RecordsWritten)
+			if spill {
+				assert.Equal(t, 1, dest.spillFiles, "Buffer did not spill while the destination was slow")
+				assert.Greater(t, summary.Buffer.Spilled, 0)
+				assert.Greater(t, summary.Buffer.Peak, 2)
+			} else {
+				assert.Equal(t, 0, dest.spillFiles)
+				// The stages waited for room while the destination was slow
+				assert.Equal(t, 2, summary.Buffer.Peak)
+				assert.Greater(t, summary.Buffer.StagesWaitMS, int64(0))
+			}
+			assert.Equal(t, 2, summary.Buffer.Capacity)
+
+			leftover, err := os.ReadDir(spillDir)
+			assert.NoError(t, err)
+			assert.Empty(t, leftover, "Spill file was not cleaned up")
+			t.Logf("%s Buffer with spill=%v passed", greenTick, spill)
+		})
+	}
+
+	t.Run("Occupancy logs", func(t *testing.T) {
+		cfg := interfaces.PipelineConfig{Buffer: interfaces.BufferConfig{LogInterval: "10ms"}}
+		sent, summary := runPipeline(t, input, cfg)
+		assert.Equal(t, input, sent)
+		assert.Equal(t, pipeline.DefaultBufferCapacity, summary.Buffer.Capacity)
+
+		p := &pipeline.Pipeline{
+			Source:      stubSource{data: input},
+			Destination: &captureDestination{},
+			Config:      interfaces.PipelineConfig{Buffer: interfaces.BufferConfig{LogInterval: "often"}},
+		}
+		_, err := p.Run(context.Background())
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		t.Logf("%s Occupancy logs passed", greenTick)
+	})
+
+	t.Run("Occupancy gauges", func(t *testing.T) {
+		reader := sdkmetric.NewManualReader()
+		shutdown := opentele.InstallMeterProvider(reader)
+		t.Cleanup(func() {
+			otel.SetMeterProvider(noop.NewMeterProvider())
+			shutdown()
+		})
+
+		dest := &gaugeDestination{reader: reader}
+		p := &pipeline.Pipeline{
+			Source:      stubSource{data: input},
+			Destination: dest,
+			Config: interfaces.PipelineConfig{
+				Buffer:   interfaces.BufferConfig{Capacity: 4},
+				Delivery: interfaces.DeliveryConfig{BatchSize: 5, MaxInFlight: 3},
+			},
+		}
+		summary, err := p.Run(context.Background())
+		assert.NoError(t, err)
+
+		for _, name := range []string{"fractal.buffer.records", "fractal.buffer.capacity", "fractal.delivery.batches_in_flight", "fractal.delivery.max_in_flight"} {
+			point, ok := dest.gauges[name]
+			if assert.True(t, ok, "Gauge %s was not collected", name) {
+				runID, _ := point.Attributes.Value("run_id")
+				assert.Equal(t, summary.RunID, runID.AsString())
+			}
+		}
+		assert.Equal(t, int64(4), dest.gauges["fractal.buffer.capacity"].Value)
+		assert.Equal(t, int64(3), dest.gauges["fractal.delivery.max_in_flight"].Value)
+		// The batch being written when the gauges were read
+		assert.GreaterOrEqual(t, dest.gauges["fractal.delivery.batches_in_flight"].Value, int64(1))
+		t.Logf("%s Occupancy gauges passed", greenTick)
+	})
+}
+
+func TestTuningHints(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Batch figures", func(t *testing.T) {
+		lines := []string{"id"}
+		for i := 1; i <= 20; i++ {
+			lines = append(lines, fmt.Sprint(i))
+		}
+		cfg := interfaces.PipelineConfig{Delivery: interfaces.DeliveryConfig{BatchSize: 8}}
+		_, summary := runPipeline(t, strings.Join(lines, "\n"), cfg)
+		stats := summary.Buffer
+		assert.Equal(t, 8, stats.BatchSize)
+		assert.Equal(t, 1, stats.MaxInFlight)
+		assert.Equal(t, 3, stats.Batches)
+		assert.Equal(t, 6.67, stats.AvgBatchRecords)
+		assert.Equal(t, 0.83, stats.BatchFill)
+		assert.Empty(t, summary.TuningHints, "A run shorter than a second got hints")
+		t.Logf("%s Batch figures passed", greenTick)
+	})
+
+	t.Run("Suggestions", func(t *testing.T) {
+		balanced := pipeline.BufferStats{Capacity: 100, Peak: 50, BatchSize: 100, MaxInFlight: 2, Batches: 10,
+			AvgBatchRecords: 100, BatchFill: 1, DestinationBusy: 0.9, SendMS: 10000}
+		assert.Empty(t, pipeline.TuningHints(&balanced))
+
+		idle := balanced
+		idle.MaxInFlight, idle.DestinationBusy = 8, 0.3
+		hints := pipeline.TuningHints(&idle)
+		assert.Len(t, hints, 1)
+		assert.Contains(t, hints[0], "idle 70%")
+		assert.Contains(t, hints[0], "reduce delivery.maxinflight to 3")
+
+		sparse := balanced
+		sparse.AvgBatchRecords, sparse.BatchFill = 12.4, 0.12
+		hints = pipeline.TuningHints(&sparse)
+		assert.Len(t, hints, 1)
+		assert.Contains(t, hints[0], "lower delivery.batchsize to 13")
+
+		sinkBound := balanced
+		sinkBound.StagesWaitMS, sinkBound.Spilled, sinkBound.Peak = 7000, 40, 140
+		hints = pipeline.TuningHints(&sinkBound)
+		assert.Len(t, hints, 2)
+		assert.Contains(t, hints[0], "raise delivery.maxinflight to 4")
+		assert.Contains(t, hints[0], "delivery.batchsize to 200")
+		assert.Contains(t, hints[1], "raise buffer.capacity to 140")
+
+		sourceBound := balanced
+		sourceBound.DestinationWaitMS = 9000
+		hints = pipeline.TuningHints(&sourceBound)
+		assert.Len(t, hints, 1)
+		assert.Contains(t, hints[0], "the source or the stages are the bottleneck")
+
+		short := idle
+		short.SendMS = 200
+		assert.Empty(t, pipeline.TuningHints(&short), "A run shorter than a second got hints")
+		assert.Empty(t, pipeline.TuningHints(nil))
+		t.Logf("%s Suggestions passed", greenTick)
+	})
+}
+
+func TestReport(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	startedAt := time.Now().Add(-time.Second)
+	summary := &pipeline.Summary{RecordsRead: 3, RecordsWritten: 2, RecordsQuarantined: 1, StageErrors: map[string]int{"join": 1}}
+
+	t.Run("Successful run", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "report.json")
+		report := pipeline.NewReport("CSV", "JSON", startedAt, summary, nil)
+		assert.NoError(t, report.WriteFile(path))
+
+		raw, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		var decoded map[string]interface{}
+		assert.NoError(t, json.Unmarshal(raw, &decoded))
+		assert.Equal(t, float64(pipeline.ReportVersion), decoded["version"])
+		assert.Equal(t, version.Get().Version, decoded["fractal_version"])
+		assert.Equal(t, "success", decoded["status"])
+		assert.Equal(t, float64(0), decoded["exit_code"])
+		assert.Equal(t, float64(3), decoded["records_read"])
+		assert.Equal(t, float64(1), decoded["records_quarantined"])
+		assert.Equal(t, map[string]interface{}{"join": float64(1)}, decoded["stage_errors"])
+		assert.GreaterOrEqual(t, decoded["duration_ms"], float64(1000))
+		t.Logf("%s Success report passed", greenTick)
+	})
+
+	t.Run("Failed run", func(t *testing.T) {
+		report := pipeline.NewReport("CSV", "JSON", startedAt, nil, errors.New("failed to fetch data"))
+		assert.Equal(t, "failure", report.Status)
+		assert.Equal(t, 1, report.ExitCode)
+		assert.Equal(t, "failed to fetch data", report.Error)
+		assert.NotNil(t, report.StageErrors)
+		t.Logf("%s Failure report passed", greenTick)
+	})
+}
+
+func TestSortStage(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Several fields ascending and descending", func(t *testing.T) {
+		input := []map[string]interface{}{
+			{"region": "us", "amount": 10, "id": 1},
+			{"region": "eu", "amount": 5, "id": 2},
+			{"region": "us", "amount": 30, "id": 3},
+			{"region": "eu", "amount": 5, "id": 4},
+			{"region": "eu", "amount": 7.5, "id": 5},
+		}
+		cfg := interfaces.PipelineConfig{Sort: interfaces.SortConfig{By: []string{"region", "amount DESC"}}}
+		sent, summary := runPipeline(t, input, cfg)
+		assert.Equal(t, []map[string]interface{}{
+			{"region": "eu", "amount": 7.5, "id": 5},
+			{"region": "eu", "amount": 5, "id": 2},
+			{"region": "eu", "amount": 5, "id": 4},
+			{"region": "us", "amount": 30, "id": 3},
+			{"region": "us", "amount": 10, "id": 1},
+		}, sent)
+		assert.Equal(t, 5, summary.RecordsWritten)
+		t.Logf("%s Multi-field sort passed", greenTick)
+	})
+
+	t.Run("Values compare by type", func(t *testing.T) {
+		input := []map[string]interface{}{
+			{"v": "10"},
+			{"v": nil},
+			{"v": 9},
+			{"v": "2024-03-01T10:00:00+02:00"},
+			{"v": "b"},
+			{"v": "2024-03-01T09:00:00Z"},
+			{"id": 1},
+			{"v": "A"},
+			{"v": -1.5},
+		}
+		ascending := []map[string]interface{}{
+			{"v": -1.5},
+			{"v": 9},
+			{"v": "10"},
+			{"v": "2024-03-01T10:00:00+02:00"},
+			{"v": "2024-03-01T09:00:00Z"},
+			{"v": "A"},
+			{"v": "b"},
+			{"v": nil},
+			{"id": 1},
+		}
+		sent, _ := runPipeline(t, input, interfaces.PipelineConfig{Sort: interfaces.SortConfig{By: []string{"v"}}})
+		assert.Equal(t, ascending, sent)
+
+		// Descending reverses everything but the empty values, which stay last
+		descending := []map[string]interface{}{
+			{"v": "b"},
+			{"v": "A"},
+			{"v": "2024-03-01T09:00:00Z"},
+			{"v": "2024-03-01T10:00:00+02:00"},
+			{"v": "10"},
+			{"v": 9},
+			{"v": -1.5},
+			{"v": nil},
+			{"id": 1},
+		}
+		sent, _ = runPipeline(t, input, interfaces.PipelineConfig{Sort: interfaces.SortConfig{By: []string{"v desc"}}})
+		assert.Equal(t, descending, sent)
+		t.Logf("%s Type-aware comparison passed", greenTick)
+	})
+
+	t.Run("Spill to disk", func(t *testing.T) {
+		spillDir := t.TempDir()
+		var input, expected []map[string]interface{}
+		for i := 0; i < 2500; i++ {
+			input = append(input, map[string]interface{}{"key": (i * 7) % 10, "seq": i})
+		}
+		for key := 0; key < 10; key++ {
+			for i := 0; i < 2500; i++ {
+				if (i*7)%10 == key {
+					expected = append(expected, map[string]interface{}{"key": key, "seq": i})
+				}
+			}
+		}
+		cfg := interfaces.PipelineConfig{Sort: interfaces.SortConfig{By: []string{"key"}, MaxRecords: 300, SpillDir: spillDir}}
+		sent, summary := runPipeline(t, input, cfg)
+		// Records with the same key keep the order they were read in, across runs
+		assert.Equal(t, expected, sent)
+		assert.Equal(t, 2500, summary.RecordsWritten)
+
+		leftover, err := os.ReadDir(spillDir)
+		assert.NoError(t, err)
+		assert.Empty(t, leftover, "Spill files were not cleaned up")
+		t.Logf("%s Spilled sort passed", greenTick)
+	})
+
+	t.Run("Invalid settings", func(t *testing.T) {
+		_, err := pipeline.NewSortStage(interfaces.SortConfig{By: []string{"amount sideways"}})
+		assert.EqualError(t, err, `invalid sort field "amount sideways": unknown direction sideways`)
+		_, err = pipeline.NewSortStage(interfaces.SortConfig{By: []string{"amount"}, MaxRecords: -1})
+		assert.Error(t, err)
+		t.Logf("%s Invalid settings rejected", greenTick)
+	})
+}
+
+func TestSelectStage(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	input := "id,name,email,age,city\n1,John,j@x.io,25,Pune\n2,Jane,jane@x.io,30,Goa"
+
+	t.Run("Select fields in order", func(t *testing.T) {
+		cfg := interfaces.PipelineConfig{Select: interfaces.SelectConfig{Fields: []string{"name", "id"}}}
+		sent, _ := runPipeline(t, input, cfg)
+		assert.Equal(t, "name,id\nJohn,1\nJane,2", sent)
+		t.Logf("%s Selected fields passed", greenTick)
+	})
+
+	t.Run("Exclude fields", func(t *testing.T) {
+		cfg := interfaces.PipelineConfig{Select: interfaces.SelectConfig{Exclude: []string{"email", "city"}}}
+		sent, _ := runPipeline(t, input, cfg)
+		assert.Equal(t, "id,name,age\n1,John,25\n2,Jane,30", sent)
+		t.Logf("%s Excluded fields passed", greenTick)
+	})
+
+	t.Run("Missing field follows the error strategy", func(t *testing.T) {
+		cfg := interfaces.PipelineConfig{
+			Select:        interfaces.SelectConfig{Fields: []string{"id", "phone"}},
+			ErrorHandling: interfaces.ErrorHandling{Strategy: pipeline.StrategyLogAndContinue},
+		}
+		_, summary := runPipeline(t, input, cfg)
+		assert.Equal(t, 2, summary.RecordsQuarantined)
+		assert.Equal(t, 2, summary.StageErrors["select"])
+
+		p := &pipeline.Pipeline{
+			Source:      stubSource{data: input},
+			Destination: &captureDestination{},
+			Config:      interfaces.PipelineConfig{Select: cfg.Select},
+		}
+		_, err := p.Run(context.Background())
+		assert.Error(t, err)
+		t.Logf("%s Missing field handling passed", greenTick)
+	})
+
+	t.Run("Fields and exclude together", func(t *testing.T) {
+		_, err := pipeline.NewSelectStage(interfaces.SelectConfig{Fields: []string{"id"}, Exclude: []string{"name"}})
+		assert.Error(t, err)
+		t.Logf("%s Conflicting selection rejected", greenTick)
+	})
+}
+
+func TestNullHandling(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	input := "id,country,phone\n1,NULL,\\N\n2,,555\n3,IN,"
+	cfg := interfaces.PipelineConfig{Nulls: interfaces.NullsConfig{
+		Values:     []string{"", "NULL", "\\N"},
+		Defaults:   map[string]interface{}{"country": "US"},
+		NullString: "N/A",
+	}}
+
+	t.Run("Null markers, defaults and null output", func(t *testing.T) {
+		sent, _ := runPipeline(t, input, cfg)
+		assert.Equal(t, "id,country,phone\n1,US,N/A\n2,US,555\n3,IN,N/A", sent)
+		t.Logf("%s CSV null handling passed", greenTick)
+	})
+
+	t.Run("Records become nil", func(t *testing.T) {
+		records := []map[string]interface{}{{"id": 1, "country": "NULL"}, {"id": 2}}
+		cfg := interfaces.PipelineConfig{Nulls: interfaces.NullsConfig{Values: []string{"NULL"}, Defaults: map[string]interface{}{"tier": "free"}}}
+		sent, _ := runPipeline(t, records, cfg)
+		assert.Equal(t, []map[string]interface{}{
+			{"id": 1, "country": nil, "tier": "free"},
+			{"id": 2, "tier": "free"},
+		}, sent)
+		t.Logf("%s Record null handling passed", greenTick)
+	})
+}
+
+func TestNotify(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	var received []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		received = append(received, body)
+	}))
+	defer server.Close()
+
+	success := pipeline.NewReport("CSV", "JSON", time.Now(), &pipeline.Summary{RecordsRead: 2, RecordsWritten: 2}, nil)
+	failure := pipeline.NewReport("CSV", "JSON", time.Now(), nil, errors.New("failed to fetch data"))
+
+	t.Run("JSON report", func(t *testing.T) {
+		received = nil
+		assert.NoError(t, pipeline.Notify(context.Background(), interfaces.NotificationsConfig{WebhookURL: server.URL}, success))
+		assert.Len(t, received, 1)
+		assert.Equal(t, "success", received[0]["status"])
+		assert.Equal(t, float64(2), received[0]["records_written"])
+		t.Logf("%s JSON notification passed", greenTick)
+	})
+
+	t.Run("Slack message only on failure", func(t *testing.T) {
+		received = nil
+		cfg := interfaces.NotificationsConfig{WebhookURL: server.URL, Format: "slack", OnlyOnFailure: true}
+		assert.NoError(t, pipeline.Notify(context.Background(), cfg, success))
+		assert.NoError(t, pipeline.Notify(context.Background(), cfg, failure))
+		assert.Len(t, received, 1)
+		assert.Contains(t, received[0]["text"], "failed to fetch data")
+		t.Logf("%s Slack failure notification passed", greenTick)
+	})
+
+	t.Run("Unreachable webhook times out", func(t *testing.T) {
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		}))
+		defer slow.Close()
+		start := time.Now()
+		err := pipeline.Notify(context.Background(), interfaces.NotificationsConfig{WebhookURL: slow.URL, Timeout: "20ms"}, success)
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), 150*time.Millisecond)
+		t.Logf("%s Webhook timeout passed", greenTick)
+	})
+}
+
+func TestMismatchedCSVRows(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	quarantineFile := filepath.Join(t.TempDir(), "quarantine.jsonl")
+	cfg := interfaces.PipelineConfig{ErrorHandling: interfaces.ErrorHandling{
+		QuarantineOutput: interfaces.QuarantineOutput{Type: "file", Location: quarantineFile},
+	}}
+	sent, summary := runPipeline(t, "name,age,city\nJohn,25,Pune\nJane,30\nJim,41,Goa,IN", cfg)
+
+	assert.Equal(t, "name,age,city\nJohn,25,Pune", sent)
+	assert.Equal(t, 3, summary.RecordsRead)
+	assert.Equal(t, 2, summary.RecordsQuarantined)
+	assert.Equal(t, 2, summary.StageErrors[pipeline.SourceStageName])
+
+	quarantined, err := os.ReadFile(quarantineFile)
+	assert.NoError(t, err)
+	assert.Contains(t, string(quarantined), "row has 2 fields, header has 3")
+	assert.Contains(t, string(quarantined), "row has 4 fields, header has 3")
+	t.Logf("%s Mismatched rows quarantined", greenTick)
+}
+
+func TestCheckpoint(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Save and load", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "checkpoint.json")
+		checkpoint, err := pipeline.LoadCheckpoint(path)
+		assert.NoError(t, err)
+		assert.Empty(t, checkpoint.Values)
+
+		checkpoint.Values["postgresql:orders.updated_at"] = "2024-01-01T10:00:00Z"
+		assert.NoError(t, checkpoint.Save(path))
+		loaded, err := pipeline.LoadCheckpoint(path)
+		assert.NoError(t, err)
+		assert.Equal(t, "2024-01-01T10:00:00Z", loaded.Values["postgresql:orders.updated_at"])
+
+		entries, err := os.ReadDir(filepath.Dir(path))
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1, "Temporary checkpoint file left behind")
+		t.Logf("%s Checkpoint round trip passed", greenTick)
+	})
+
+	t.Run("Unknown version", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "checkpoint.json")
+		assert.NoError(t, os.WriteFile(path, []byte(`{"version": 99, "values": {}}`), 0644))
+		_, err := pipeline.LoadCheckpoint(path)
+		assert.Error(t, err)
+		t.Logf("%s Unknown checkpoint version rejected", greenTick)
+	})
+
+	t.Run("Committed only after delivery", func(t *testing.T) {
+		source := &checkpointSource{stubSource: stubSource{data: "id\n1\n2"}}
+		p := &pipeline.Pipeline{Source: source, Destination: &captureDestination{}}
+		_, err := p.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, source.commits)
+
+		p = &pipeline.Pipeline{Source: source, Destination: &flakyDestination{failures: 1}}
+		_, err = p.Run(context.Background())
+		assert.Error(t, err)
+		assert.Equal(t, 1, source.commits, "Checkpoint committed after a failed delivery")
+		t.Logf("%s Checkpoint commit passed", greenTick)
+	})
+}
+
+// partialDestination refuses records whose id is odd and writes the rest
+type partialDestination struct {
+	written int
+}
+
+func (p *partialDestination) SendData(data interface{}, req interfaces.Request) error {
+	var rejected []pipeline.RejectedRow
+	for _, rec := range pipeline.NewDataset(data).Records {
+		if id, _ := rec["id"].(int); id%2 == 1 {
+			rejected = append(rejected, pipeline.RejectedRow{Record: rec, Reason: "odd id"})
+			continue
+		}
+		p.written++
+	}
+	if len(rejected) > 0 {
+		return &pipeline.RejectedRowsError{Rows: rejected}
+	}
+	return nil
+}
+
+func TestRejectedRows(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	quarantineFile := filepath.Join(t.TempDir(), "quarantine.jsonl")
+	dest := &partialDestination{}
+	p := &pipeline.Pipeline{
+		Source:      stubSource{data: []map[string]interface{}{{"id": 1}, {"id": 2}, {"id": 3}, {"id": 4}}},
+		Destination: dest,
+		Config: interfaces.PipelineConfig{
+			ErrorHandling: interfaces.ErrorHandling{QuarantineOutput: interfaces.QuarantineOutput{Location: quarantineFile}},
+			Delivery:      interfaces.DeliveryConfig{BatchSize: 2, Retries: 3},
+		},
+	}
+	summary, err := p.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, dest.written)
+	assert.Equal(t, 2, summary.RecordsWritten)
+	assert.Equal(t, 2, summary.RecordsQuarantined)
+	assert.Equal(t, 0, summary.Retries, "Rejected rows should not be retried")
+	assert.Equal(t, 2, summary.StageErrors[pipeline.DestinationStageName])
+
+	quarantined, err := os.ReadFile(quarantineFile)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(quarantined), `"error":"odd id"`))
+	t.Logf("%s Rejected rows quarantined", greenTick)
+}
+
+func TestReconciliation(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Missing and unexpected keys", func(t *testing.T) {
+		p := &pipeline.Pipeline{
+			Source: stubSource{data: []map[string]interface{}{
+				{"id": 1}, {"id": 2}, {"id": 3}, {"id": 4}, {"id": 5}, {"id": 6}, {"name": "no id"},
+			}},
+			Destination: &partialDestination{},
+			Config: interfaces.PipelineConfig{
+				ErrorHandling: interfaces.ErrorHandling{QuarantineOutput: interfaces.QuarantineOutput{Location: filepath.Join(t.TempDir(), "quarantine.jsonl")}},
+				Transform: interfaces.TransformConfig{
+					Rules:    []string{"map id using renumber"},
+					Mappings: map[string]interfaces.MappingConfig{"renumber": {Values: map[string]interface{}{"4": 40}}},
+				},
+				Filter:    interfaces.FilterConfig{Mode: "drop", Rules: []string{`FIELD("id") == "2"`}},
+				Reconcile: interfaces.ReconcileConfig{Key: "id", MaxKeys: 3},
+			},
+		}
+		summary, err := p.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, &pipeline.Reconciliation{
+			Key:            "id",
+			KeysRead:       6,
+			KeysWritten:    2,
+			Missing:        5,
+			MissingKeys:    []string{"1", "2", "3"},
+			Unexpected:     1,
+			UnexpectedKeys: []string{"40"},
+			UnkeyedRead:    1,
+			UnkeyedWritten: 1,
+		}, summary.Reconciliation)
+		assert.False(t, summary.Reconciliation.Balanced())
+		t.Logf("%s Filtered, refused and rekeyed records reported", greenTick)
+	})
+
+	t.Run("Duplicates on write", func(t *testing.T) {
+		_, summary := runPipeline(t, []map[string]interface{}{
+			{"id": 1, "at": "2024-01-01T00:07:00Z"},
+			{"id": 2, "at": "2024-01-01T00:08:00Z"},
+		}, interfaces.PipelineConfig{
+			Window:    interfaces.WindowConfig{Type: "sliding", Size: "10m", Slide: "5m", TimeField: "at", GroupBy: []string{"id"}},
+			Reconcile: interfaces.ReconcileConfig{Key: "id"},
+		})
+		assert.Equal(t, 2, summary.Reconciliation.Duplicated)
+		assert.Equal(t, []string{"1", "2"}, summary.Reconciliation.DuplicatedKeys)
+		assert.Equal(t, 0, summary.Reconciliation.Missing)
+		t.Logf("%s Keys written more often than read reported", greenTick)
+	})
+
+	t.Run("Balanced and off", func(t *testing.T) {
+		_, summary := runPipeline(t, []map[string]interface{}{{"id": "a"}, {"id": "b"}}, interfaces.PipelineConfig{Reconcile: interfaces.ReconcileConfig{Key: "id"}})
+		assert.True(t, summary.Reconciliation.Balanced())
+		assert.Equal(t, 2, summary.Reconciliation.KeysWritten)
+		_, summary = runPipeline(t, []map[string]interface{}{{"id": "a"}}, interfaces.PipelineConfig{})
+		assert.Nil(t, summary.Reconciliation)
+		t.Logf("%s Balanced run reported, and nothing without a key", greenTick)
+	})
+
+	t.Run("Invalid settings", func(t *testing.T) {
+		for cfg, expected := range map[interfaces.ReconcileConfig]string{
+			{Key: "id", MaxKeys: -1}: "invalid reconcile maxkeys -1",
+			{MaxKeys: 10}:            "reconcile maxkeys is set without a key",
+		} {
+			p := &pipeline.Pipeline{Source: stubSource{data: "id\n1"}, Destination: &captureDestination{}, Config: interfaces.PipelineConfig{Reconcile: cfg}}
+			_, err := p.Run(context.Background())
+			assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+			assert.ErrorContains(t, err, expected)
+		}
+		t.Logf("%s Invalid reconciliation settings rejected", greenTick)
+	})
+}
+
+func TestProfiling(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Column statistics", func(t *testing.T) {
+		_, summary := runPipeline(t, []map[string]interface{}{
+			{"id": 1, "amount": "10", "status": "open"},
+			{"id": 2, "amount": "9.5", "status": "open"},
+			{"id": 3, "amount": nil, "status": "closed"},
+			{"id": 4, "status": "open", "note": "late"},
+		}, interfaces.PipelineConfig{Profiling: interfaces.ProfilingConfig{Enabled: true, TopValues: 1}})
+		profile := summary.Profile
+		assert.Equal(t, 4, profile.Records)
+		columns := map[string]pipeline.ColumnProfile{}
+		for _, column := range profile.Columns {
+			columns[column.Column] = column
+		}
+		assert.Len(t, columns, 4)
+
+		assert.Equal(t, pipeline.ColumnProfile{Column: "amount", Nulls: 2, Distinct: 2, Min: "9.5", Max: "10", TopValues: []pipeline.ValueCount{{Value: "10", Count: 1}}}, columns["amount"])
+		assert.Equal(t, 1, columns["id"].Min)
+		assert.Equal(t, 4, columns["id"].Max)
+		assert.Equal(t, []pipeline.ValueCount{{Value: "open", Count: 3}}, columns["status"].TopValues)
+		assert.Equal(t, "closed", columns["status"].Min)
+		assert.Equal(t, 3, columns["note"].Nulls)
+		t.Logf("%s Nulls, distinct values, min, max and top values profiled", greenTick)
+	})
+
+	t.Run("Many distinct values", func(t *testing.T) {
+		records := make([]map[string]interface{}, 20000)
+		for i := range records {
+			records[i] = map[string]interface{}{"id": i, "bucket": i % 3}
+		}
+		_, summary := runPipeline(t, records, interfaces.PipelineConfig{Profiling: interfaces.ProfilingConfig{Enabled: true, Fields: []string{"id", "bucket", "missing"}}})
+		columns := summary.Profile.Columns
+		assert.Equal(t, []string{"bucket", "id", "missing"}, []string{columns[0].Column, columns[1].Column, columns[2].Column})
+		assert.Equal(t, 3, columns[0].Distinct)
+		assert.Len(t, columns[0].TopValues, 3)
+		assert.True(t, columns[1].DistinctApproximate)
+		assert.InDelta(t, 20000, columns[1].Distinct, 1600)
+		assert.Equal(t, 20000, columns[2].Nulls)
+		t.Logf("%s Distinct values estimated, %d for 20000", greenTick, columns[1].Distinct)
+	})
+
+	t.Run("Report file", func(t *testing.T) {
+		location := filepath.Join(t.TempDir(), "profiles", "orders.json")
+		_, summary := runPipeline(t, []map[string]interface{}{{"id": 1}}, interfaces.PipelineConfig{Profiling: interfaces.ProfilingConfig{Enabled: true, Location: location}})
+		data, err := os.ReadFile(location)
+		assert.NoError(t, err)
+		var written pipeline.Profile
+		assert.NoError(t, json.Unmarshal(data, &written))
+		assert.Equal(t, summary.RunID, written.RunID)
+		assert.Equal(t, "id", written.Columns[0].Column)
+
+		_, summary = runPipeline(t, []map[string]interface{}{{"id": 1}}, interfaces.PipelineConfig{})
+		assert.Nil(t, summary.Profile)
+		p := &pipeline.Pipeline{Source: stubSource{data: "id\n1"}, Destination: &captureDestination{}, Config: interfaces.PipelineConfig{Profiling: interfaces.ProfilingConfig{Enabled: true, TopValues: -1}}}
+		_, err = p.Run(context.Background())
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		t.Logf("%s Profile written to its file, and nothing when off", greenTick)
+	})
+}
+
+// stuckSource never returns from FetchData until released
+type stuckSource struct {
+	release chan struct{}
+}
+
+func (s stuckSource) FetchData(req interfaces.Request) (interface{}, error) {
+	<-s.release
+	return nil, errors.New("released")
+}
+
+// pacedDestination takes delay to accept each batch
+type pacedDestination struct {
+	delay time.Duration
+}
+
+func (p pacedDestination) SendData(data interface{}, req interfaces.Request) error {
+	time.Sleep(p.delay)
+	return nil
+}
+
+func TestMaxDuration(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Stuck source", func(t *testing.T) {
+		source := stuckSource{release: make(chan struct{})}
+		defer close(source.release)
+		p := &pipeline.Pipeline{
+			Source:      source,
+			Destination: &captureDestination{},
+			Config:      interfaces.PipelineConfig{MaxDuration: "50ms"},
+		}
+		startedAt := time.Now()
+		summary, err := p.Run(context.Background())
+		assert.ErrorIs(t, err, pipeline.ErrTimeout)
+		assert.Less(t, time.Since(startedAt), time.Second)
+
+		report := pipeline.NewReport("Stuck", "Capture", startedAt, summary, err)
+		assert.Equal(t, pipeline.StatusTimeout, report.Status)
+		assert.Equal(t, pipeline.ExitCodeTimeout, report.ExitCode)
+		t.Logf("%s Stuck source cancelled", greenTick)
+	})
+
+	t.Run("Written batches are kept", func(t *testing.T) {
+		var records []map[string]interface{}
+		for i := 0; i < 10; i++ {
+			records = append(records, map[string]interface{}{"id": i})
+		}
+		p := &pipeline.Pipeline{
+			Source:      stubSource{data: records},
+			Destination: pacedDestination{delay: 40 * time.Millisecond},
+			Config: interfaces.PipelineConfig{
+				MaxDuration: "100ms",
+				Delivery:    interfaces.DeliveryConfig{BatchSize: 1},
+			},
+		}
+		summary, err := p.Run(context.Background())
+		assert.ErrorIs(t, err, pipeline.ErrTimeout)
+		assert.Greater(t, summary.RecordsWritten, 0)
+		assert.Less(t, summary.RecordsWritten, 10)
+		t.Logf("%s Partial run reported %d written records", greenTick, summary.RecordsWritten)
+	})
+
+	t.Run("Invalid duration", func(t *testing.T) {
+		p := &pipeline.Pipeline{
+			Source:      stubSource{data: "id\n1"},
+			Destination: &captureDestination{},
+			Config:      interfaces.PipelineConfig{MaxDuration: "soon"},
+		}
+		_, err := p.Run(context.Background())
+		assert.ErrorContains(t, err, `invalid max duration "soon"`)
+		t.Logf("%s Invalid max duration rejected", greenTick)
+	})
+}
+
+// locatedSource reports a fixed location for its records
+type locatedSource struct {
+	stubSource
+}
+
+func (l locatedSource) Location(req interfaces.Request) string {
+	return "orders.csv"
+}
+
+func TestProvenance(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Default fields", func(t *testing.T) {
+		dest := &captureDestination{}
+		p := &pipeline.Pipeline{
+			Source:      locatedSource{stubSource{data: "id,region\n1,IN\n2,US"}},
+			SourceName:  "CSV",
+			Destination: dest,
+			RunID:       "run-1",
+			Config: interfaces.PipelineConfig{
+				Provenance: interfaces.ProvenanceConfig{Enabled: true},
+				Select:     interfaces.SelectConfig{Exclude: []string{pipeline.DefaultIngestedAtField}},
+			},
+		}
+		_, err := p.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "id,region,_run_id,_source,_source_location,_source_offset\n1,IN,run-1,CSV,orders.csv,0\n2,US,run-1,CSV,orders.csv,1", dest.sent)
+		t.Logf("%s Default provenance fields passed", greenTick)
+	})
+
+	t.Run("Renamed fields", func(t *testing.T) {
+		stamped, _ := runPipeline(t, []map[string]interface{}{{"id": 1}}, interfaces.PipelineConfig{
+			Provenance: interfaces.ProvenanceConfig{Enabled: true, RunIDField: "batch", OffsetField: "row"},
+		})
+		rec := stamped.([]map[string]interface{})[0]
+		assert.NotEmpty(t, rec["batch"])
+		assert.Equal(t, 0, rec["row"])
+		assert.Nil(t, rec[pipeline.DefaultLocationField])
+		_, err := time.Parse(time.RFC3339Nano, rec[pipeline.DefaultIngestedAtField].(string))
+		assert.NoError(t, err)
+		t.Logf("%s Renamed provenance fields passed", greenTick)
+	})
+
+	t.Run("Clashing field", func(t *testing.T) {
+		p := &pipeline.Pipeline{
+			Source:      stubSource{data: []map[string]interface{}{{"id": 1, "_source": "legacy"}}},
+			Destination: &captureDestination{},
+			Config:      interfaces.PipelineConfig{Provenance: interfaces.ProvenanceConfig{Enabled: true}},
+		}
+		_, err := p.Run(context.Background())
+		assert.ErrorContains(t, err, `record already has a field named "_source"`)
+		t.Logf("%s Clashing provenance field rejected", greenTick)
+	})
+}
+
+func TestTypedErrors(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Innermost kind wins", func(t *testing.T) {
+		err := interfaces.Wrap(interfaces.ErrWrite, interfaces.Wrap(interfaces.ErrConnection, errors.New("dial tcp: refused")))
+		assert.ErrorIs(t, err, interfaces.ErrConnection)
+		assert.NotErrorIs(t, err, interfaces.ErrWrite)
+		assert.Equal(t, "dial tcp: refused", err.Error())
+		assert.Equal(t, interfaces.CodeConnection, interfaces.ErrorCode(fmt.Errorf("wrapped: %w", err)))
+		assert.Nil(t, interfaces.Wrap(interfaces.ErrWrite, nil))
+		t.Logf("%s Wrap passed", greenTick)
+	})
+
+	t.Run("Failed write", func(t *testing.T) {
+		p := &pipeline.Pipeline{
+			Source:      stubSource{data: "id\n1"},
+			Destination: &flakyDestination{failures: 1},
+		}
+		startedAt := time.Now()
+		summary, err := p.Run(context.Background())
+		assert.ErrorIs(t, err, interfaces.ErrWrite)
+		report := pipeline.NewReport("Stub", "Flaky", startedAt, summary, err)
+		assert.Equal(t, interfaces.CodeWrite, report.ErrorCode)
+
+		migrationErr := &controller.MigrationError{Err: err}
+		assert.Equal(t, http.StatusBadGateway, migrationErr.StatusCode())
+		t.Logf("%s Failed write reported as %s", greenTick, report.ErrorCode)
+	})
+
+	t.Run("Invalid configuration", func(t *testing.T) {
+		p := &pipeline.Pipeline{
+			Source:      stubSource{data: "id\n1"},
+			Destination: &captureDestination{},
+			Config:      interfaces.PipelineConfig{Delivery: interfaces.DeliveryConfig{RetryBackoff: "later"}},
+		}
+		_, err := p.Run(context.Background())
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+
+		err = integrations.CSVDestination{}.SendData("id\n1", interfaces.Request{})
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		assert.Equal(t, http.StatusBadRequest, (&controller.MigrationError{Err: err}).StatusCode())
+		t.Logf("%s Invalid configuration passed", greenTick)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		err := fmt.Errorf("%w of 1s", pipeline.ErrTimeout)
+		assert.Equal(t, http.StatusGatewayTimeout, (&controller.MigrationError{Err: err}).StatusCode())
+		assert.Equal(t, http.StatusInternalServerError, (&controller.MigrationError{Err: errors.New("unknown")}).StatusCode())
+		t.Logf("%s Timeout status passed", greenTick)
+	})
+}
+
+func TestReshapeStage(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Split and merge", func(t *testing.T) {
+		cfg := interfaces.PipelineConfig{Reshape: interfaces.ReshapeConfig{Rules: []string{
+			`split full_name by " " into first,last`,
+			`merge area_code,number into phone with "-"`,
+		}}}
+		sent, summary := runPipeline(t, "full_name,area_code,number\nJohn Ronald Tolkien,020,5550\nCher,,5551", cfg)
+		assert.Equal(t, "full_name,first,last,area_code,number,phone\nJohn Ronald Tolkien,John,Ronald Tolkien,020,5550,020-5550\nCher,Cher,,,5551,-5551", sent)
+		assert.Equal(t, 2, summary.RecordsWritten)
+		t.Logf("%s Split and merge passed", greenTick)
+	})
+
+	t.Run("Padding and extra parts", func(t *testing.T) {
+		stage, err := pipeline.NewReshapeStage(interfaces.ReshapeConfig{
+			Rules:        []string{`split tags by ',' into a,b`},
+			MissingParts: "empty",
+			ExtraParts:   "drop",
+		})
+		assert.NoError(t, err)
+		out, err := stage.Process(pipeline.Record{"tags": "x,y,z"})
+		assert.NoError(t, err)
+		assert.Equal(t, pipeline.Record{"tags": "x,y,z", "a": "x", "b": "y"}, out[0])
+		out, err = stage.Process(pipeline.Record{"tags": "x"})
+		assert.NoError(t, err)
+		assert.Equal(t, "", out[0]["b"])
+		out, err = stage.Process(pipeline.Record{"tags": nil})
+		assert.NoError(t, err)
+		assert.Nil(t, out[0]["a"])
+		t.Logf("%s Padding and extra parts passed", greenTick)
+	})
+
+	t.Run("Part count errors", func(t *testing.T) {
+		stage, err := pipeline.NewReshapeStage(interfaces.ReshapeConfig{
+			Rules:        []string{`split range by "-" into low,high`},
+			MissingParts: "error",
+			ExtraParts:   "error",
+		})
+		assert.NoError(t, err)
+		_, err = stage.Process(pipeline.Record{"range": "1-2-3"})
+		assert.ErrorContains(t, err, "3 parts for 2 fields")
+		_, err = stage.Process(pipeline.Record{"range": "1"})
+		assert.ErrorContains(t, err, "1 parts for 2 fields")
+
+		merged, err := pipeline.NewReshapeStage(interfaces.ReshapeConfig{Rules: []string{`merge a,b into c with ""`}})
+		assert.NoError(t, err)
+		out, _ := merged.Process(pipeline.Record{"a": nil})
+		assert.Nil(t, out[0]["c"])
+		t.Logf("%s Part count errors passed", greenTick)
+	})
+
+	t.Run("Invalid rules", func(t *testing.T) {
+		for _, rule := range []string{`split name into a,b`, `split name by "" into a`, `merge a into b`} {
+			_, err := pipeline.NewReshapeStage(interfaces.ReshapeConfig{Rules: []string{rule}})
+			assert.Error(t, err, rule)
+		}
+		_, err := pipeline.NewReshapeStage(interfaces.ReshapeConfig{ExtraParts: "keep"})
+		assert.Error(t, err)
+		t.Logf("%s Invalid rules rejected", greenTick)
+	})
+}
+
+func TestDatetimeTransform(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Layouts and time zones", func(t *testing.T) {
+		cfg := interfaces.PipelineConfig{Transform: interfaces.TransformConfig{Rules: []string{
+			`datetime ordered from "02/01/2006 15:04" in Europe/Berlin to rfc3339 UTC`,
+			`datetime shipped from unix to date`,
+		}}}
+		sent, summary := runPipeline(t, "id,ordered,shipped\n1,31/12/2024 23:30,1735776000\n2,,", cfg)
+		assert.Equal(t, "id,ordered,shipped\n1,2024-12-31T22:30:00Z,2025-01-02\n2,,", sent)
+		assert.Equal(t, 2, summary.RecordsWritten)
+		t.Logf("%s Layouts and time zones passed", greenTick)
+	})
+
+	t.Run("Times and epochs", func(t *testing.T) {
+		stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{
+			`datetime at from iso8601 to unixms`,
+			`datetime seen from rfc3339 to "Jan 2, 2006 3:04 PM" America/New_York`,
+		}})
+		assert.NoError(t, err)
+		out, err := stage.Process(pipeline.Record{"at": "2024-03-01T10:00:00.5+01:00", "seen": time.Date(2024, 7, 4, 16, 0, 0, 0, time.UTC)})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1709283600500), out[0]["at"])
+		assert.Equal(t, "Jul 4, 2024 12:00 PM", out[0]["seen"])
+		t.Logf("%s Times and epochs passed", greenTick)
+	})
+
+	t.Run("Unparseable values follow the error strategy", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "quarantine.jsonl")
+		cfg := interfaces.PipelineConfig{
+			Transform: interfaces.TransformConfig{Rules: []string{`datetime day from date to rfc3339`}},
+			ErrorHandling: interfaces.ErrorHandling{
+				Strategy:         "LOG_AND_CONTINUE",
+				QuarantineOutput: interfaces.QuarantineOutput{Location: path},
+			},
+		}
+		sent, summary := runPipeline(t, "id,day\n1,2024-02-30\n2,2024-02-29", cfg)
+		assert.Equal(t, "id,day\n2,2024-02-29T00:00:00Z", sent)
+		assert.Equal(t, 1, summary.StageErrors["transform"])
+		quarantined, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Contains(t, string(quarantined), `cannot parse field day value \"2024-02-30\" as date`)
+		t.Logf("%s Unparseable value quarantined", greenTick)
+	})
+
+	t.Run("Invalid rules", func(t *testing.T) {
+		for _, rule := range []string{
+			`datetime day to rfc3339`,
+			`datetime day from someday to rfc3339`,
+			`datetime day from date to rfc3339 Mars/Olympus`,
+			`datetime day from "2006 to rfc3339`,
+			`reformat day`,
+		} {
+			_, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{rule}})
+			assert.Error(t, err, rule)
+		}
+		t.Logf("%s Invalid rules rejected", greenTick)
+	})
+}
+
+func TestCoalesceTransform(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("First value that is not null or empty", func(t *testing.T) {
+		stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`coalesce email = email, email2, contact_email`}})
+		assert.NoError(t, err)
+		for _, tc := range []struct {
+			in       pipeline.Record
+			expected interface{}
+		}{
+			{pipeline.Record{"email": "a@x.io", "email2": "b@x.io"}, "a@x.io"},
+			{pipeline.Record{"email": "", "email2": nil, "contact_email": "c@x.io"}, "c@x.io"},
+			{pipeline.Record{"email2": "b@x.io"}, "b@x.io"},
+			{pipeline.Record{"email": ""}, nil},
+		} {
+			out, err := stage.Process(tc.in)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, out[0]["email"])
+		}
+		t.Logf("%s Coalesce passed", greenTick)
+	})
+
+	t.Run("Null markers and dropped sources", func(t *testing.T) {
+		cfg := interfaces.PipelineConfig{
+			Nulls:     interfaces.NullsConfig{Values: []string{"N/A"}},
+			Transform: interfaces.TransformConfig{Rules: []string{`coalesce email = email2, contact_email drop`}},
+		}
+		sent, _ := runPipeline(t, "id,email2,contact_email\n1,N/A,c@x.io\n2,b@x.io,c@x.io", cfg)
+		assert.Equal(t, "id,email\n1,c@x.io\n2,b@x.io", sent)
+		t.Logf("%s Coalesce with nulls and drop passed", greenTick)
+	})
+
+	t.Run("Invalid rules", func(t *testing.T) {
+		for _, rule := range []string{`coalesce email`, `coalesce email = a,, b`, `coalesce email a, b`} {
+			_, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{rule}})
+			assert.ErrorContains(t, err, "expected coalesce <target>", rule)
+		}
+		t.Logf("%s Invalid coalesce rules rejected", greenTick)
+	})
+}
+
+func TestSurrogateTransform(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	sha := func(text string) string {
+		sum := sha256.Sum256([]byte(text))
+		return hex.EncodeToString(sum[:])
+	}
+
+	t.Run("Same values give the same key", func(t *testing.T) {
+		stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`surrogate customer_key = hash(country, customer_id)`}})
+		assert.NoError(t, err)
+		first, err := stage.Process(pipeline.Record{"country": "DE", "customer_id": int64(42)})
+		assert.NoError(t, err)
+		second, err := stage.Process(pipeline.Record{"country": "DE", "customer_id": "42"})
+		assert.NoError(t, err)
+		assert.Equal(t, sha("DE|42"), first[0]["customer_key"])
+		assert.Equal(t, first[0]["customer_key"], second[0]["customer_key"], "A number and its text should hash alike")
+		t.Logf("%s Deterministic surrogate key passed", greenTick)
+	})
+
+	t.Run("Nulls and separators do not collide", func(t *testing.T) {
+		stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`surrogate key = hash(a, b)`}})
+		assert.NoError(t, err)
+		keys := map[string]pipeline.Record{}
+		for _, rec := range []pipeline.Record{
+			{"a": "x|y", "b": "z"},
+			{"a": "x", "b": "y|z"},
+			{"a": nil, "b": "z"},
+			{"a": "", "b": "z"},
+			{"a": `\N`, "b": "z"},
+			{"a": "z", "b": nil},
+		} {
+			out, err := stage.Process(rec.Copy())
+			assert.NoError(t, err)
+			key := out[0]["key"].(string)
+			assert.NotContains(t, keys, key, "%v collides with %v", rec, keys[key])
+			keys[key] = rec
+		}
+		out, _ := stage.Process(pipeline.Record{"b": "z"})
+		assert.Equal(t, sha(`\N|z`), out[0]["key"], "A missing field should hash like a null one")
+		t.Logf("%s Surrogate keys without collisions passed", greenTick)
+	})
+
+	t.Run("Algorithm and separator", func(t *testing.T) {
+		stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`surrogate key = hash(a, b) using MD5 with "::"`}})
+		assert.NoError(t, err)
+		out, err := stage.Process(pipeline.Record{"a": "1", "b": "2"})
+		assert.NoError(t, err)
+		sum := md5.Sum([]byte("1::2"))
+		assert.Equal(t, hex.EncodeToString(sum[:]), out[0]["key"])
+		t.Logf("%s Surrogate key options passed", greenTick)
+	})
+
+	t.Run("Invalid rules", func(t *testing.T) {
+		for _, rule := range []string{
+			`surrogate key`,
+			`surrogate key = a, b`,
+			`surrogate key = hash(a, b`,
+			`surrogate key = hash(a,, b)`,
+			`surrogate key = hash(a) using crc32`,
+			`surrogate key = hash(a) with ""`,
+			`surrogate key = hash(a) using`,
+		} {
+			_, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{rule}})
+			assert.ErrorContains(t, err, "expected surrogate <target>", rule)
+		}
+		t.Logf("%s Invalid surrogate rules rejected", greenTick)
+	})
+}
+
+func TestRowHashTransform(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	sha := func(text string) string {
+		sum := sha256.Sum256([]byte(text))
+		return hex.EncodeToString(sum[:])
+	}
+	hashOf := func(t *testing.T, rule string, rec pipeline.Record) string {
+		stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{rule}})
+		assert.NoError(t, err)
+		out, err := stage.Process(rec)
+		assert.NoError(t, err)
+		return out[0]["row_hash"].(string)
+	}
+
+	t.Run("Stable over field order and types", func(t *testing.T) {
+		first := hashOf(t, `rowhash row_hash`, pipeline.Record{"id": int64(42), "name": "Ann", "tags": []interface{}{"a", "b"}})
+		second := hashOf(t, `rowhash row_hash`, pipeline.Record{"tags": []interface{}{"a", "b"}, "name": "Ann", "id": "42"})
+		assert.Equal(t, sha(`id=42|name=Ann|tags=["a","b"]`), first)
+		assert.Equal(t, first, second, "A number and its text should hash alike")
+		assert.Equal(t, first, hashOf(t, `rowhash row_hash`, pipeline.Record{"id": 42, "name": "Ann", "tags": []interface{}{"a", "b"}, "row_hash": "stale", "note": nil}),
+			"The target and null fields should be left out")
+		assert.NotEqual(t, first, hashOf(t, `rowhash row_hash`, pipeline.Record{"id": 42, "name": "Anne", "tags": []interface{}{"a", "b"}}))
+		assert.NotEqual(t, hashOf(t, `rowhash row_hash`, pipeline.Record{"a": "x|b=y"}), hashOf(t, `rowhash row_hash`, pipeline.Record{"a": "x", "b": "y"}))
+		t.Logf("%s Stable row hash passed", greenTick)
+	})
+
+	t.Run("Exclusions and algorithm", func(t *testing.T) {
+		rule := `rowhash row_hash exclude updated_at, loaded_at using md5`
+		first := hashOf(t, rule, pipeline.Record{"id": 1, "updated_at": "2024-05-01", "loaded_at": "x"})
+		second := hashOf(t, rule, pipeline.Record{"id": 1, "updated_at": "2024-06-01"})
+		sum := md5.Sum([]byte("id=1"))
+		assert.Equal(t, hex.EncodeToString(sum[:]), first)
+		assert.Equal(t, first, second)
+
+		hash, err := pipeline.RowHash(pipeline.Record{"id": 1, "updated_at": "2024-05-01"}, map[string]bool{"updated_at": true}, "md5")
+		assert.NoError(t, err)
+		assert.Equal(t, first, hash, "RowHash should give consumers the same hash")
+		t.Logf("%s Row hash options passed", greenTick)
+	})
+
+	t.Run("Invalid rules", func(t *testing.T) {
+		for _, rule := range []string{
+			`rowhash`,
+			`rowhash h exclude`,
+			`rowhash h exclude a,, b`,
+			`rowhash h using crc32`,
+			`rowhash h using`,
+			`rowhash h except a`,
+		} {
+			_, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{rule}})
+			assert.ErrorContains(t, err, "expected rowhash <target>", rule)
+		}
+		t.Logf("%s Invalid rowhash rules rejected", greenTick)
+	})
+}
+
+func TestPhoneTransform(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("E.164", func(t *testing.T) {
+		for _, c := range []struct{ value, region, expected string }{
+			{"(415) 555-0123", "US", "+14155550123"},
+			{"1-415-555-0123", "US", "+14155550123"},
+			{"011 44 20 7946 0018", "US", "+442079460018"},
+			{"020 7946 0018", "GB", "+442079460018"},
+			{"+44 (0)20 7946 0018", "", "+442079460018"},
+			{"0044 20 7946 0018", "", "+442079460018"},
+			{"030/1234567", "de", "+49301234567"},
+			{"06 12 34 56 78", "FR", "+33612345678"},
+			{"06 1234 5678", "IT", "+390612345678"},
+			{"+299 123456", "", "+299123456"},
+		} {
+			normalized, err := pipeline.NormalizePhone(c.value, c.region)
+			assert.NoError(t, err, c.value)
+			assert.Equal(t, c.expected, normalized, c.value)
+		}
+		t.Logf("%s Phone numbers normalized", greenTick)
+	})
+
+	t.Run("Unparseable numbers", func(t *testing.T) {
+		for _, c := range []struct{ value, region, expected string }{
+			{"555-0123", "US", "expected 10"},
+			{"415 555 0123", "", "no country code"},
+			{"+1 415 555 0123 x", "", "expected digits"},
+			{"+1 415 555", "", "expected 10"},
+			{"+99 123", "", "expected 7 to 15"},
+		} {
+			_, err := pipeline.NormalizePhone(c.value, c.region)
+			assert.ErrorContains(t, err, c.expected, c.value)
+		}
+		_, err := pipeline.NormalizePhone("020 7946 0018", "XX")
+		assert.ErrorContains(t, err, "unknown phone region XX")
+		t.Logf("%s Unparseable numbers rejected", greenTick)
+	})
+
+	t.Run("Rule and validation", func(t *testing.T) {
+		sent, summary := runPipeline(t, []map[string]interface{}{
+			{"id": 1, "phone": "(415) 555-0123"},
+			{"id": 2, "phone": "not a number"},
+			{"id": 3, "phone": nil},
+		}, interfaces.PipelineConfig{
+			ErrorHandling: interfaces.ErrorHandling{Strategy: pipeline.StrategyLogAndContinue, QuarantineOutput: interfaces.QuarantineOutput{Location: filepath.Join(t.TempDir(), "quarantine.jsonl")}},
+			Transform:     interfaces.TransformConfig{Rules: []string{"phone phone US"}},
+		})
+		assert.Equal(t, []map[string]interface{}{{"id": 1, "phone": "+14155550123"}, {"id": 3, "phone": nil}}, sent)
+		assert.Equal(t, 1, summary.RecordsQuarantined)
+
+		stage, err := pipeline.NewValidateStage(interfaces.ValidationConfig{Rules: []string{"phone is_phone GB"}}, nil)
+		assert.NoError(t, err)
+		_, err = stage.Process(pipeline.Record{"phone": "020 7946 0018"})
+		assert.NoError(t, err)
+		_, err = stage.Process(pipeline.Record{"phone": "12"})
+		assert.ErrorIs(t, err, interfaces.ErrValidation)
+		_, err = stage.Process(pipeline.Record{})
+		assert.ErrorContains(t, err, "expected a phone number")
+
+		_, err = pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{"phone phone Atlantis"}})
+		assert.ErrorContains(t, err, "unknown phone region")
+		_, err = pipeline.NewValidateStage(interfaces.ValidationConfig{Rules: []string{"phone is_phone Atlantis"}}, nil)
+		assert.ErrorContains(t, err, "unknown phone region")
+		t.Logf("%s Phone rule and is_phone validation passed", greenTick)
+	})
+}
+
+func TestTap(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	input := "id,name\n1,ann\n2,bob\n3,cy\n4,dee\n5,eve"
+	transform := interfaces.TransformConfig{Rules: []string{`coalesce name = name, id`}}
+
+	// readTap decodes the indented JSON records a tap wrote
+	readTap := func(t *testing.T, path string) []map[string]interface{} {
+		t.Helper()
+		file, err := os.Open(path)
+		assert.NoError(t, err)
+		defer file.Close()
+		var tapped []map[string]interface{}
+		decoder := json.NewDecoder(file)
+		for decoder.More() {
+			var entry map[string]interface{}
+			assert.NoError(t, decoder.Decode(&entry))
+			tapped = append(tapped, entry)
+		}
+		return tapped
+	}
+
+	t.Run("Every Nth record after a stage", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "tap.json")
+		cfg := interfaces.PipelineConfig{
+			Transform: transform,
+			Filter:    interfaces.FilterConfig{Rules: []string{`FIELD("id") != "1"`}},
+			Tap:       interfaces.TapConfig{After: "transform", Every: 2, Location: path},
+		}
+		sent, summary := runPipeline(t, input, cfg)
+		assert.Equal(t, "id,name\n2,bob\n3,cy\n4,dee\n5,eve", sent, "The tap should not change the output")
+		assert.Equal(t, 4, summary.RecordsWritten)
+		tapped := readTap(t, path)
+		assert.Len(t, tapped, 2)
+		assert.Equal(t, map[string]interface{}{"after": "transform", "number": float64(2), "record": map[string]interface{}{"id": "2", "name": "bob"}}, tapped[0])
+		assert.Equal(t, "4", tapped[1]["record"].(map[string]interface{})["id"])
+		t.Logf("%s Tap after a stage passed", greenTick)
+	})
+
+	t.Run("Source records up to a limit", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "tap.json")
+		cfg := interfaces.PipelineConfig{Tap: interfaces.TapConfig{After: "source", Sample: 1, Limit: 3, Location: path}}
+		sent, _ := runPipeline(t, input, cfg)
+		assert.Equal(t, input, sent)
+		tapped := readTap(t, path)
+		assert.Len(t, tapped, 3)
+		assert.Equal(t, "source", tapped[0]["after"])
+		t.Logf("%s Tap of the source passed", greenTick)
+	})
+
+	t.Run("Unwritable output leaves the run alone", func(t *testing.T) {
+		cfg := interfaces.PipelineConfig{Tap: interfaces.TapConfig{Every: 1, Location: filepath.Join(t.TempDir(), "missing", "tap.json")}}
+		sent, _ := runPipeline(t, input, cfg)
+		assert.Equal(t, input, sent)
+		t.Logf("%s Failing tap ignored", greenTick)
+	})
+
+	t.Run("Invalid taps", func(t *testing.T) {
+		for _, tc := range []struct {
+			tap      interfaces.TapConfig
+			expected string
+		}{
+			{interfaces.TapConfig{Every: 2, Sample: 0.5}, "either every or sample"},
+			{interfaces.TapConfig{Sample: 1.5}, "between 0 and 1"},
+			{interfaces.TapConfig{Every: -1}, "must not be negative"},
+			{interfaces.TapConfig{Every: 1, After: "filter"}, "does not run"},
+		} {
+			_, err := pipeline.BuildStages(interfaces.PipelineConfig{Transform: transform, Tap: tc.tap})
+			assert.ErrorContains(t, err, tc.expected)
+		}
+		t.Logf("%s Invalid taps rejected", greenTick)
+	})
+}
+
+func TestTrimTransform(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Trim and collapse", func(t *testing.T) {
+		stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`trim name`, `trim city, note collapse`}})
+		assert.NoError(t, err)
+		out, err := stage.Process(pipeline.Record{"name": "  Ann  Lee ", "city": "\tNew   York ", "note": nil, "age": 30, "code": " x "})
+		assert.NoError(t, err)
+		assert.Equal(t, pipeline.Record{"name": "Ann  Lee", "city": "New York", "note": nil, "age": 30, "code": " x "}, out[0])
+		t.Logf("%s Trim passed", greenTick)
+	})
+
+	t.Run("Every field before validation", func(t *testing.T) {
+		cfg := interfaces.PipelineConfig{
+			Stages:        []string{"transform", "validate"},
+			Transform:     interfaces.TransformConfig{Rules: []string{`trim *`}},
+			Validate:      interfaces.ValidationConfig{Rules: []string{`FIELD("status") == "active"`}},
+			ErrorHandling: interfaces.ErrorHandling{Strategy: pipeline.StrategyLogAndContinue},
+		}
+		sent, summary := runPipeline(t, "id,status\n1, active \n2,active  \n3,gone", cfg)
+		assert.Equal(t, "id,status\n1,active\n2,active", sent)
+		assert.Equal(t, 1, summary.RecordsQuarantined)
+		t.Logf("%s Trimmed values validated", greenTick)
+	})
+
+	t.Run("Invalid rules", func(t *testing.T) {
+		for _, rule := range []string{`trim`, `trim a,, b`} {
+			_, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{rule}})
+			assert.ErrorContains(t, err, "expected trim <field>", rule)
+		}
+		t.Logf("%s Invalid trim rules rejected", greenTick)
+	})
+}
+
+func TestTruncateTransform(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Characters and bytes", func(t *testing.T) {
+		stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{
+			`truncate name, city to 5`,
+			`truncate note to 8 ellipsis`,
+			`truncate code to 5 bytes`,
+			`truncate label to 7 bytes ellipsis`,
+		}})
+		assert.NoError(t, err)
+		out, err := stage.Process(pipeline.Record{"name": "Zoë Ångström", "city": "Oslo", "note": "a long remark", "code": "ñññ", "label": "日本語テキスト", "age": 123456})
+		assert.NoError(t, err)
+		assert.Equal(t, pipeline.Record{"name": "Zoë Å", "city": "Oslo", "note": "a lon...", "code": "ññ", "label": "日...", "age": 123456}, out[0])
+		t.Logf("%s Truncate passed", greenTick)
+	})
+
+	t.Run("Strict length validation", func(t *testing.T) {
+		cfg := interfaces.PipelineConfig{
+			Validate:      interfaces.ValidationConfig{Rules: []string{`FIELD("name") MAXLEN(4)`, `FIELD("code") MAXLEN(4, BYTES)`}},
+			ErrorHandling: interfaces.ErrorHandling{Strategy: pipeline.StrategyLogAndContinue},
+		}
+		sent, summary := runPipeline(t, "id,name,code\n1,Zoë,ab\n2,Zoëy,ññ\n3,Ann,ñññ\n4,Annie,a", cfg)
+		assert.Equal(t, "id,name,code\n1,Zoë,ab\n2,Zoëy,ññ", sent)
+		assert.Equal(t, 2, summary.RecordsQuarantined)
+		t.Logf("%s MAXLEN passed", greenTick)
+	})
+
+	t.Run("Invalid rules", func(t *testing.T) {
+		for _, rule := range []string{`truncate name`, `truncate to 5`, `truncate name to 0`, `truncate name to five`, `truncate name to 5 chars`, `truncate name to 3 ellipsis`} {
+			_, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{rule}})
+			assert.ErrorContains(t, err, "expected truncate <field>", rule)
+		}
+		t.Logf("%s Invalid truncate rules rejected", greenTick)
+	})
+}
+
+func TestMapTransform(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	dir := t.TempDir()
+	csvFile := filepath.Join(dir, "statuses.csv")
+	assert.NoError(t, os.WriteFile(csvFile, []byte("label,code\nactive,1\ninactive,2\n"), 0644))
+	jsonFile := filepath.Join(dir, "statuses.json")
+	assert.NoError(t, os.WriteFile(jsonFile, []byte(`[{"key": 1, "value": "active"}, {"key": 2, "value": "inactive"}]`), 0644))
+	inline := map[string]interfaces.MappingConfig{"statuses": {Values: map[string]interface{}{"1": "active", "2": "inactive"}}}
+
+	t.Run("Inline and file tables", func(t *testing.T) {
+		for name, mappings := range map[string]map[string]interfaces.MappingConfig{
+			"inline": inline,
+			"CSV":    {"statuses": {File: csvFile, KeyField: "code", ValueField: "label"}},
+			"JSON":   {"statuses": {File: jsonFile}},
+		} {
+			stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`map status using statuses`}, Mappings: mappings})
+			assert.NoError(t, err, name)
+			for _, tc := range []struct{ in, out interface{} }{{"1", "active"}, {float64(2), "inactive"}, {"9", "9"}, {nil, nil}} {
+				out, err := stage.Process(pipeline.Record{"status": tc.in})
+				assert.NoError(t, err, name)
+				assert.Equal(t, tc.out, out[0]["status"], "%s table mapping %v", name, tc.in)
+			}
+		}
+		t.Logf("%s Values mapped from inline, CSV and JSON tables", greenTick)
+	})
+
+	t.Run("Unmapped values", func(t *testing.T) {
+		stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`map status using STATUSES unmapped default "unknown"`}, Mappings: inline})
+		assert.NoError(t, err)
+		out, err := stage.Process(pipeline.Record{"status": "9"})
+		assert.NoError(t, err)
+		assert.Equal(t, "unknown", out[0]["status"])
+
+		stage, err = pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`map status using statuses unmapped error`}, Mappings: inline})
+		assert.NoError(t, err)
+		_, err = stage.Process(pipeline.Record{"status": "9"})
+		assert.ErrorContains(t, err, "value 9 of status is not in mapping statuses")
+		t.Logf("%s Unmapped policies applied", greenTick)
+	})
+
+	t.Run("Invalid rules", func(t *testing.T) {
+		for rule, expected := range map[string]string{
+			`map status`:                                 "expected map <field>",
+			`map status using missing`:                   "unknown mapping missing",
+			`map status using statuses unmapped drop`:    "unknown option unmapped drop",
+			`map status using statuses unmapped default`: "unknown option unmapped default",
+		} {
+			_, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{rule}, Mappings: inline})
+			assert.ErrorContains(t, err, expected, rule)
+		}
+		_, err := pipeline.NewTransformStage(interfaces.TransformConfig{
+			Rules:    []string{`map status using statuses`},
+			Mappings: map[string]interfaces.MappingConfig{"statuses": {File: filepath.Join(dir, "none.csv")}},
+		})
+		assert.ErrorContains(t, err, "mapping statuses: failed to open")
+		t.Logf("%s Invalid map rules rejected", greenTick)
+	})
+}
+
+func TestExtractTransform(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	line := `10.0.0.7 - - [14/Oct/2026:09:30:00 +0000] "GET /orders HTTP/1.1" 404 512`
+
+	t.Run("Positional groups", func(t *testing.T) {
+		stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{
+			`extract line using '^(\S+) .*"(\S+) (\S+) [^"]*" (\d{3}) (\d+|-)$' into ip, method, path, status, bytes drop`,
+		}})
+		assert.NoError(t, err)
+		out, err := stage.Process(pipeline.Record{"id": 1, "line": line})
+		assert.NoError(t, err)
+		assert.Equal(t, pipeline.Record{"id": 1, "ip": "10.0.0.7", "method": "GET", "path": "/orders", "status": "404", "bytes": "512"}, out[0])
+		t.Logf("%s Positional groups passed", greenTick)
+	})
+
+	t.Run("Named groups", func(t *testing.T) {
+		stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{
+			`extract line using '"(?P<method>[A-Z]+) (?P<path>\S+)(?: (?P<proto>HTTP/\S+))?"' into path, proto`,
+		}})
+		assert.NoError(t, err)
+		out, err := stage.Process(pipeline.Record{"line": line})
+		assert.NoError(t, err)
+		assert.Equal(t, pipeline.Record{"line": line, "path": "/orders", "proto": "HTTP/1.1"}, out[0])
+
+		// An optional group that took no part in the match is null
+		out, err = stage.Process(pipeline.Record{"line": `"GET /health"`})
+		assert.NoError(t, err)
+		assert.Equal(t, pipeline.Record{"line": `"GET /health"`, "path": "/health", "proto": nil}, out[0])
+		t.Logf("%s Named groups passed", greenTick)
+	})
+
+	t.Run("Unmatched values", func(t *testing.T) {
+		stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`extract code using '^([A-Z]{2})-(\d+)$' into country, number`}})
+		assert.NoError(t, err)
+		for _, value := range []interface{}{"garbage", nil, 42} {
+			out, err := stage.Process(pipeline.Record{"code": value})
+			assert.NoError(t, err)
+			assert.Equal(t, pipeline.Record{"code": value, "country": nil, "number": nil}, out[0])
+		}
+
+		stage, err = pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`extract code using '^([A-Z]{2})-(\d+)$' into country, number unmatched error`}})
+		assert.NoError(t, err)
+		_, err = stage.Process(pipeline.Record{"code": "garbage"})
+		assert.ErrorContains(t, err, `value "garbage" of code does not match ^([A-Z]{2})-(\d+)$`)
+		out, err := stage.Process(pipeline.Record{"code": nil})
+		assert.NoError(t, err)
+		assert.Equal(t, pipeline.Record{"code": nil, "country": nil, "number": nil}, out[0])
+		t.Logf("%s Unmatched policies applied", greenTick)
+	})
+
+	t.Run("Invalid rules", func(t *testing.T) {
+		for rule, expected := range map[string]string{
+			`extract line into a`:                               "expected extract <field>",
+			`extract line using '(' into a`:                     "invalid pattern",
+			`extract line using '(a)(b)' into a`:                "1 fields to extract into, but the pattern has 2 groups",
+			`extract line using '(a)' into a unmatched drop`:    "unknown option unmatched drop",
+			`extract line using '(a)(b)' into a, drop`:          "",
+			`extract line using '(?P<x>a)(?P<y>b)' into x, , y`: "empty field",
+		} {
+			_, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{rule}})
+			if expected == "" {
+				// A trailing comma makes drop a field to extract into
+				assert.NoError(t, err, rule)
+				continue
+			}
+			assert.ErrorContains(t, err, expected, rule)
+		}
+		t.Logf("%s Invalid extract rules rejected", greenTick)
+	})
+}
+
+func TestEncryptTransform(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	key := "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	t.Setenv("FRACTAL_FIELD_KEY", key)
+	keyFile := filepath.Join(t.TempDir(), "field.key")
+	assert.NoError(t, os.WriteFile(keyFile, []byte("AAECAwQFBgcICQoLDA0ODw==\n"), 0600))
+
+	t.Run("Round trip", func(t *testing.T) {
+		for _, ref := range []string{"env:FRACTAL_FIELD_KEY", "file:" + keyFile} {
+			encrypt, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{"encrypt ssn, card with " + ref}})
+			assert.NoError(t, err, ref)
+			decrypt, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{"decrypt ssn, card with " + ref}})
+			assert.NoError(t, err, ref)
+
+			out, err := encrypt.Process(pipeline.Record{"ssn": "078-05-1120", "card": float64(4111), "name": "Ann", "note": nil})
+			assert.NoError(t, err, ref)
+			sealed := out[0]["ssn"].(string)
+			assert.NotContains(t, sealed, "078-05-1120")
+			assert.Equal(t, "Ann", out[0]["name"])
+			assert.Nil(t, out[0]["note"])
+
+			// A fresh nonce each time, so equal values don't encrypt alike
+			again, err := encrypt.Process(pipeline.Record{"ssn": "078-05-1120"})
+			assert.NoError(t, err, ref)
+			assert.NotEqual(t, sealed, again[0]["ssn"])
+
+			out, err = decrypt.Process(out[0])
+			assert.NoError(t, err, ref)
+			assert.Equal(t, "078-05-1120", out[0]["ssn"], ref)
+			assert.Equal(t, "4111", out[0]["card"], ref)
+		}
+		t.Logf("%s Fields encrypted and decrypted with env and file keys", greenTick)
+	})
+
+	t.Run("Wrong key or altered value", func(t *testing.T) {
+		encrypt, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{"encrypt ssn with env:FRACTAL_FIELD_KEY"}})
+		assert.NoError(t, err)
+		decrypt, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{"decrypt ssn with file:" + keyFile}})
+		assert.NoError(t, err)
+		out, err := encrypt.Process(pipeline.Record{"ssn": "078-05-1120"})
+		assert.NoError(t, err)
+		_, err = decrypt.Process(out[0])
+		assert.ErrorContains(t, err, "failed to decrypt ssn: the key is wrong or the value was altered")
+		_, err = decrypt.Process(pipeline.Record{"ssn": "plain"})
+		assert.ErrorContains(t, err, "failed to decrypt ssn: not an encrypted value")
+		t.Logf("%s Wrong keys and altered values rejected", greenTick)
+	})
+
+	t.Run("Invalid rules", func(t *testing.T) {
+		t.Setenv("FRACTAL_SHORT_KEY", "c2hvcnQ=")
+		for rule, expected := range map[string]string{
+			"encrypt ssn":                             "expected encrypt <field>",
+			"encrypt ssn with FRACTAL_FIELD_KEY":      "invalid key reference",
+			"encrypt ssn with env:FRACTAL_NO_KEY":     `key environment variable "FRACTAL_NO_KEY" is not set`,
+			"decrypt ssn with env:FRACTAL_SHORT_KEY":  "the key in env:FRACTAL_SHORT_KEY must be 16, 24 or 32 bytes",
+			"decrypt ssn with file:/nonexistent/key":  "failed to read the key file",
+			"encrypt ssn, with env:FRACTAL_FIELD_KEY": "empty field in the list",
+		} {
+			_, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{rule}})
+			assert.ErrorContains(t, err, expected, rule)
+			if err != nil {
+				assert.NotContains(t, err.Error(), key, rule)
+			}
+		}
+		t.Logf("%s Invalid encrypt rules rejected without showing the key", greenTick)
+	})
+}
+
+func TestWhenTransform(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	mappings := map[string]interfaces.MappingConfig{"us_codes": {Values: map[string]interface{}{"ny": "NY", "ca": "CA"}}}
+
+	t.Run("Matching records only", func(t *testing.T) {
+		stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{
+			Rules:    []string{`when FIELD("region") == "US" then map code using us_codes`},
+			Mappings: mappings,
+		})
+		assert.NoError(t, err)
+		out, err := stage.Process(pipeline.Record{"region": "US", "code": "ny"})
+		assert.NoError(t, err)
+		assert.Equal(t, "NY", out[0]["code"])
+		out, err = stage.Process(pipeline.Record{"region": "EU", "code": "ny"})
+		assert.NoError(t, err)
+		assert.Equal(t, "ny", out[0]["code"])
+		t.Logf("%s Transformation applied to matching records only", greenTick)
+	})
+
+	t.Run("Nested one level", func(t *testing.T) {
+		stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{
+			Rules: []string{`WHEN FIELD("region") == "US" THEN when FIELD("tier") == "gold then" then trim name collapse`},
+		})
+		assert.NoError(t, err)
+		for _, tc := range []struct {
+			region, tier, name string
+		}{
+			{"US", "gold then", "Ann Lee"},
+			{"US", "silver", "  Ann   Lee "},
+			{"EU", "gold then", "  Ann   Lee "},
+		} {
+			out, err := stage.Process(pipeline.Record{"region": tc.region, "tier": tc.tier, "name": "  Ann   Lee "})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.name, out[0]["name"], "%s %s", tc.region, tc.tier)
+		}
+		t.Logf("%s Nested when rule applied when both predicates match", greenTick)
+	})
+
+	t.Run("Invalid rules", func(t *testing.T) {
+		for rule, expected := range map[string]string{
+			`when FIELD("region") == "US"`:            "missing the predicate or the transformation",
+			`when then trim name`:                     "missing the predicate or the transformation",
+			`when FIELD("region") == then trim name`:  "invalid predicate",
+			`when FIELD("a") == "1" then upcase name`: "unknown transformation upcase",
+			`when FIELD("a") == "1" then trim`:        "expected trim <field>",
+			`when FIELD("a") == "1" then when FIELD("b") == "2" then when FIELD("c") == "3" then trim c`: "when rules nest only 1 level deep",
+		} {
+			_, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{rule}})
+			assert.ErrorContains(t, err, expected, rule)
+		}
+		t.Logf("%s Invalid when rules rejected", greenTick)
+	})
+}
+
+func TestExtraFields(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	input := "id,name,note\n1,ann,first\n2,bob,"
+	fields := []string{"id", "name"}
+
+	t.Run("Pass by default", func(t *testing.T) {
+		sent, _ := runPipeline(t, input, interfaces.PipelineConfig{OutputFields: interfaces.OutputFieldsConfig{Fields: fields}})
+		assert.Equal(t, input, sent)
+		t.Logf("%s Pass by default passed", greenTick)
+	})
+
+	t.Run("Drop and warn", func(t *testing.T) {
+		for _, policy := range []string{pipeline.ExtraFieldsDrop, pipeline.ExtraFieldsWarn} {
+			sent, summary := runPipeline(t, input, interfaces.PipelineConfig{
+				OutputFields: interfaces.OutputFieldsConfig{Fields: fields, OnExtraFields: policy},
+			})
+			assert.Equal(t, "id,name\n1,ann\n2,bob", sent, policy)
+			assert.Equal(t, 2, summary.RecordsWritten, policy)
+		}
+		t.Logf("%s Drop and warn passed", greenTick)
+	})
+
+	t.Run("Error rejects the record", func(t *testing.T) {
+		records := []interface{}{
+			map[string]interface{}{"id": 1, "name": "ann"},
+			map[string]interface{}{"id": 2, "name": "bob", "note": "x", "age": 3},
+		}
+		cfg := interfaces.PipelineConfig{
+			ErrorHandling: interfaces.ErrorHandling{Strategy: pipeline.StrategyLogAndContinue},
+			OutputFields:  interfaces.OutputFieldsConfig{Fields: fields, OnExtraFields: "ERROR"},
+		}
+		sent, summary := runPipeline(t, records, cfg)
+		assert.Equal(t, []interface{}{map[string]interface{}{"id": 1, "name": "ann"}}, sent)
+		assert.Equal(t, 1, summary.RecordsQuarantined)
+		assert.Equal(t, 1, summary.StageErrors[pipeline.ExtraFieldsStageName])
+
+		cfg.ErrorHandling.Strategy = pipeline.StrategyStopOnError
+		p := &pipeline.Pipeline{Source: stubSource{data: records}, Destination: &captureDestination{}, Config: cfg}
+		_, err := p.Run(context.Background())
+		assert.ErrorIs(t, err, interfaces.ErrValidation)
+		assert.ErrorContains(t, err, "fields age, note are not among the destination's fields")
+		t.Logf("%s Error rejects the record passed", greenTick)
+	})
+
+	t.Run("Fields from the destination", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "out.csv")
+		p := &pipeline.Pipeline{
+			Source:             stubSource{data: input},
+			Destination:        integrations.CSVDestination{},
+			DestinationRequest: interfaces.Request{CSVDestinationFileName: path, CSVDestinationColumns: []string{"name", "id"}},
+			Config:             interfaces.PipelineConfig{OutputFields: interfaces.OutputFieldsConfig{OnExtraFields: pipeline.ExtraFieldsDrop}},
+		}
+		_, err := p.Run(context.Background())
+		assert.NoError(t, err)
+		written, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, "name,id\nann,1\nbob,2\n", string(written))
+		t.Logf("%s Fields from the destination passed", greenTick)
+	})
+
+	t.Run("Invalid config", func(t *testing.T) {
+		for policy, message := range map[string]string{
+			"drop": "onextrafields drop needs the destination's fields",
+			"keep": `invalid onextrafields "keep"`,
+		} {
+			p := &pipeline.Pipeline{
+				Source:      stubSource{data: input},
+				Destination: &captureDestination{},
+				Config:      interfaces.PipelineConfig{OutputFields: interfaces.OutputFieldsConfig{OnExtraFields: policy}},
+			}
+			_, err := p.Run(context.Background())
+			assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+			assert.ErrorContains(t, err, message)
+		}
+		t.Logf("%s Invalid config passed", greenTick)
+	})
+}
+
+func TestStageOnly(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	cfg := interfaces.PipelineConfig{
+		ErrorHandling: interfaces.ErrorHandling{Strategy: pipeline.StrategyStopOnError, MaxErrors: 1},
+		Validate:      interfaces.ValidationConfig{Rules: []string{`FIELD("name") REQUIRED`}},
+		Transform:     interfaces.TransformConfig{Rules: []string{`trim name`}},
+		Filter:        interfaces.FilterConfig{Rules: []string{`FIELD("age") > 35`}},
+		Delivery:      interfaces.DeliveryConfig{BatchSize: 1},
+		Stages:        []string{"transform", "validate", "filter"},
+	}
+	input := "id,name,age\n1, ann ,30\n2,,40\n3,bob,50"
+
+	t.Run("Validation only", func(t *testing.T) {
+		only, err := pipeline.StageOnly(cfg, "validate")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"validate"}, only.Stages)
+		source := &checkpointSource{stubSource: stubSource{data: input}}
+		dest := &captureDestination{}
+		p := &pipeline.Pipeline{Source: source, Destination: dest, Config: only, SkipCheckpoint: true}
+		summary, err := p.Run(context.Background())
+		// Every rejected record is reported, whatever the strategy and thresholds
+		assert.NoError(t, err)
+		assert.Equal(t, "id,name,age\n1, ann ,30\n3,bob,50", dest.sent)
+		assert.Equal(t, 1, summary.RecordsQuarantined)
+		assert.Equal(t, 1, summary.BatchesWritten)
+		assert.Equal(t, 0, source.commits)
+		t.Logf("%s Validation only passed", greenTick)
+	})
+
+	t.Run("Transformation only", func(t *testing.T) {
+		only, err := pipeline.StageOnly(cfg, "transform")
+		assert.NoError(t, err)
+		sent, summary := runPipeline(t, input, only)
+		assert.Equal(t, "id,name,age\n1,ann,30\n2,,40\n3,bob,50", sent)
+		assert.Equal(t, 0, summary.RecordsFiltered)
+		t.Logf("%s Transformation only passed", greenTick)
+	})
+
+	t.Run("Nothing to run", func(t *testing.T) {
+		_, err := pipeline.StageOnly(interfaces.PipelineConfig{}, "validate")
+		assert.EqualError(t, err, "no validation rules are configured")
+		_, err = pipeline.StageOnly(interfaces.PipelineConfig{}, "transform")
+		assert.EqualError(t, err, "no transformation rules are configured")
+		_, err = pipeline.StageOnly(cfg, "filter")
+		assert.ErrorContains(t, err, "stage filter cannot run on its own")
+		t.Logf("%s Nothing to run passed", greenTick)
+	})
+}
+
+func TestTokenizeTransform(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Same value same token", func(t *testing.T) {
+		stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{
+			Rules:  []string{`tokenize customer, referrer`, `tokenize email using people`, `when FIELD("email") != "" then tokenize contact using people`},
+			Tokens: map[string]interfaces.TokenMapConfig{"people": {Prefix: "p_"}},
+		})
+		assert.NoError(t, err)
+		first, err := stage.Process(pipeline.Record{"customer": "c1", "referrer": "c2", "email": "a@x.io", "contact": "a@x.io"})
+		assert.NoError(t, err)
+		second, err := stage.Process(pipeline.Record{"customer": "c2", "referrer": nil, "email": "", "contact": "b@x.io"})
+		assert.NoError(t, err)
+
+		a, b := first[0], second[0]
+		assert.Equal(t, a["referrer"], b["customer"], "The same value gets the same token in every field")
+		assert.NotEqual(t, a["customer"], a["referrer"], "Different values get different tokens")
+		assert.Regexp(t, `^tok_[0-9a-f]{16}$`, a["customer"])
+		assert.Regexp(t, `^p_[0-9a-f]{16}$`, a["email"])
+		assert.Equal(t, a["email"], a["contact"], "Rules using the same map share its tokens")
+		assert.Nil(t, b["referrer"])
+		assert.Equal(t, "", b["email"])
+		assert.Equal(t, "b@x.io", b["contact"])
+		t.Logf("%s Same value same token passed", greenTick)
+	})
+
+	t.Run("Saved for later runs", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "tokens.json")
+		tokens := map[string]interfaces.TokenMapConfig{"ids": {File: file}}
+		cfg := interfaces.PipelineConfig{Transform: interfaces.TransformConfig{Rules: []string{`tokenize id using ids`}, Tokens: tokens}}
+		first, _ := runPipeline(t, "id,name\n7,ann\n8,bob\n7,cy", cfg)
+		second, _ := runPipeline(t, "id\n8", cfg)
+
+		records := pipeline.NewDataset(first).Records
+		assert.Equal(t, records[0]["id"], records[2]["id"])
+		assert.Equal(t, records[1]["id"], pipeline.NewDataset(second).Records[0]["id"], "A saved map keeps its tokens across runs")
+		info, err := os.Stat(file)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "The map holds the real values")
+
+		cfg.Transform.Rules = []string{`detokenize id using ids`}
+		restored, _ := runPipeline(t, first, cfg)
+		assert.Equal(t, "id,name\n7,ann\n8,bob\n7,cy", restored)
+		t.Logf("%s Saved for later runs passed", greenTick)
+	})
+
+	t.Run("Bounded map", func(t *testing.T) {
+		cfg := interfaces.PipelineConfig{
+			ErrorHandling: interfaces.ErrorHandling{Strategy: pipeline.StrategyLogAndContinue},
+			Transform: interfaces.TransformConfig{
+				Rules:  []string{`tokenize id using small`},
+				Tokens: map[string]interfaces.TokenMapConfig{"small": {MaxValues: 2}},
+			},
+		}
+		_, summary := runPipeline(t, "id\n1\n2\n1\n3", cfg)
+		assert.Equal(t, 3, summary.RecordsWritten)
+		assert.Equal(t, 1, summary.RecordsQuarantined, "A value beyond maxvalues is rejected")
+
+		stage, err := pipeline.NewTransformStage(cfg.Transform)
+		assert.NoError(t, err)
+		stage.Process(pipeline.Record{"id": "1"})
+		stage.Process(pipeline.Record{"id": "2"})
+		_, err = stage.Process(pipeline.Record{"id": "3"})
+		assert.EqualError(t, err, "failed to tokenize id: token map small is full at 2 values, raise its maxvalues to tokenize more distinct values")
+		t.Logf("%s Bounded map passed", greenTick)
+	})
+
+	t.Run("Invalid rules", func(t *testing.T) {
+		for rule, message := range map[string]string{
+			`detokenize id`:            "missing the token map to read",
+			`tokenize id using nobody`: "unknown token map nobody",
+			`tokenize using people`:    "missing the fields",
+		} {
+			_, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{rule}})
+			assert.ErrorContains(t, err, message, rule)
+		}
+		stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{
+			Rules:  []string{`detokenize id using people`},
+			Tokens: map[string]interfaces.TokenMapConfig{"people": {}},
+		})
+		assert.NoError(t, err)
+		_, err = stage.Process(pipeline.Record{"id": "tok_0"})
+		assert.EqualError(t, err, `failed to detokenize id: token map people has no token "tok_0"`)
+		t.Logf("%s Invalid rules passed", greenTick)
+	})
+}
+
+func TestExplodeTransform(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Object elements", func(t *testing.T) {
+		stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`explode items`, `trim sku`}})
+		assert.NoError(t, err)
+		out, err := stage.Process(pipeline.Record{"order": 1, "items": []interface{}{
+			map[string]interface{}{"sku": " A ", "qty": 2},
+			map[string]interface{}{"sku": "B", "qty": 1, "order": 9},
+		}})
+		assert.NoError(t, err)
+		// Later rules apply to every record, and element fields win over the record's
+		assert.Equal(t, []pipeline.Record{
+			{"order": 1, "sku": "A", "qty": 2},
+			{"order": 9, "sku": "B", "qty": 1},
+		}, out)
+		t.Logf("%s Object elements passed", greenTick)
+	})
+
+	t.Run("Plain elements", func(t *testing.T) {
+		stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`explode tags`}})
+		assert.NoError(t, err)
+		out, err := stage.Process(pipeline.Record{"id": 1, "tags": []string{"new", "sale"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []pipeline.Record{{"id": 1, "tags": "new"}, {"id": 1, "tags": "sale"}}, out)
+		t.Logf("%s Plain elements passed", greenTick)
+	})
+
+	t.Run("No elements", func(t *testing.T) {
+		keep, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`explode items`}})
+		assert.NoError(t, err)
+		drop, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`explode items drop`}})
+		assert.NoError(t, err)
+		for _, rec := range []pipeline.Record{{"id": 1}, {"id": 1, "items": nil}, {"id": 1, "items": []interface{}{}}} {
+			out, err := keep.Process(rec.Copy())
+			assert.NoError(t, err)
+			assert.Equal(t, []pipeline.Record{rec}, out)
+			_, err = drop.Process(rec.Copy())
+			assert.ErrorIs(t, err, pipeline.ErrFiltered)
+		}
+		_, err = keep.Process(pipeline.Record{"items": "a,b"})
+		assert.ErrorContains(t, err, "cannot explode field items: value of type string is not an array")
+		t.Logf("%s No elements passed", greenTick)
+	})
+
+	t.Run("JSON orders", func(t *testing.T) {
+		cfg := interfaces.PipelineConfig{Transform: interfaces.TransformConfig{Rules: []string{
+			`when FIELD("status") == "open" then explode items drop`,
+		}}}
+		data := []map[string]interface{}{
+			{"order": "o1", "status": "open", "items": []interface{}{map[string]interface{}{"sku": "A"}, map[string]interface{}{"sku": "B"}}},
+			{"order": "o2", "status": "open", "items": []interface{}{}},
+			{"order": "o3", "status": "closed", "items": []interface{}{map[string]interface{}{"sku": "C"}}},
+		}
+		sent, summary := runPipeline(t, data, cfg)
+		records := pipeline.NewDataset(sent).Records
+		if assert.Len(t, records, 3) {
+			assert.Equal(t, "A", records[0]["sku"])
+			assert.Equal(t, "B", records[1]["sku"])
+			assert.Equal(t, "o3", records[2]["order"])
+		}
+		assert.Equal(t, 3, summary.RecordsRead)
+		assert.Equal(t, 1, summary.RecordsFiltered)
+		t.Logf("%s JSON orders passed", greenTick)
+	})
+
+	t.Run("Invalid rules", func(t *testing.T) {
+		for _, rule := range []string{`explode`, `explode a b`, `explode a drop b`} {
+			_, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{rule}})
+			assert.ErrorContains(t, err, "expected explode <field>", rule)
+		}
+		t.Logf("%s Invalid explode rules rejected", greenTick)
+	})
+}
+
+func TestNormalizeFields(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Snake case", func(t *testing.T) {
+		input := "First Name,last-name,EMAIL_ADDRESS,homeAddress2,HTTPStatus\nann,lee,a@x.io,1 Main St,200"
+		sent, _ := runPipeline(t, input, interfaces.PipelineConfig{
+			NormalizeFields: interfaces.NormalizeFieldsConfig{Style: "snake_case"},
+			Validate:        interfaces.ValidationConfig{Rules: []string{`FIELD("first_name") == "ann"`}},
+		})
+		assert.Equal(t, "first_name,last_name,email_address,home_address2,http_status\nann,lee,a@x.io,1 Main St,200", sent)
+		t.Logf("%s Headers normalized to snake case before validation", greenTick)
+	})
+
+	t.Run("Camel case", func(t *testing.T) {
+		data := []map[string]interface{}{{"First Name": "ann", "user_ID": 7}}
+		sent, _ := runPipeline(t, data, interfaces.PipelineConfig{NormalizeFields: interfaces.NormalizeFieldsConfig{Style: "camelCase"}})
+		assert.Equal(t, []map[string]interface{}{{"firstName": "ann", "userId": 7}}, sent)
+		t.Logf("%s Fields normalized to camel case", greenTick)
+	})
+
+	t.Run("Pattern replaced before the style", func(t *testing.T) {
+		data := []map[string]interface{}{{"Cust. Name": "ann", "Cust.ID": 7}}
+		sent, _ := runPipeline(t, data, interfaces.PipelineConfig{NormalizeFields: interfaces.NormalizeFieldsConfig{
+			Style:       "snake_case",
+			Pattern:     `^Cust\.\s*`,
+			Replacement: "customer ",
+		}})
+		assert.Equal(t, []map[string]interface{}{{"customer_name": "ann", "customer_id": 7}}, sent)
+		t.Logf("%s Pattern replaced in field names", greenTick)
+	})
+
+	t.Run("Collisions fail the run", func(t *testing.T) {
+		p := &pipeline.Pipeline{
+			Source:      stubSource{data: "First Name,first_name\nann,lee"},
+			Destination: &captureDestination{},
+			Config:      interfaces.PipelineConfig{NormalizeFields: interfaces.NormalizeFieldsConfig{Style: "snake_case"}},
+		}
+		_, err := p.Run(context.Background())
+		assert.ErrorIs(t, err, interfaces.ErrValidation)
+		assert.ErrorContains(t, err, `fields "First Name" and "first_name" both normalize to "first_name"`)
+		t.Logf("%s Collision reported", greenTick)
+	})
+
+	t.Run("Invalid settings", func(t *testing.T) {
+		for _, cfg := range []interfaces.NormalizeFieldsConfig{
+			{Style: "kebab"},
+			{Pattern: "("},
+			{Replacement: "x"},
+		} {
+			p := &pipeline.Pipeline{
+				Source:      stubSource{data: "a\n1"},
+				Destination: &captureDestination{},
+				Config:      interfaces.PipelineConfig{NormalizeFields: cfg},
+			}
+			_, err := p.Run(context.Background())
+			assert.ErrorIs(t, err, interfaces.ErrConfigInvalid, "%+v", cfg)
+		}
+		t.Logf("%s Invalid settings rejected", greenTick)
+	})
+}
+
+func TestErrorThresholds(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	// Every third row is missing a field and is quarantined by the source
+	var rows []string
+	for i := 0; i < 30; i++ {
+		if i%3 == 2 {
+			rows = append(rows, fmt.Sprint(i))
+		} else {
+			rows = append(rows, fmt.Sprintf("%d,ok", i))
+		}
+	}
+	input := "id,status\n" + strings.Join(rows, "\n")
+	run := func(cfg interfaces.ErrorHandling) (*pipeline.Summary, error) {
+		cfg.Strategy = pipeline.StrategyLogAndContinue
+		p := &pipeline.Pipeline{
+			Source:      stubSource{data: input},
+			Destination: &captureDestination{},
+			Config:      interfaces.PipelineConfig{ErrorHandling: cfg},
+		}
+		return p.Run(context.Background())
+	}
+
+	t.Run("Under the thresholds", func(t *testing.T) {
+		summary, err := run(interfaces.ErrorHandling{MaxErrors: 10, MaxErrorRate: 40, ErrorRateWindow: 10})
+		assert.NoError(t, err)
+		assert.Equal(t, 10, summary.RecordsQuarantined)
+		t.Logf("%s Run under the thresholds passed", greenTick)
+	})
+
+	t.Run("Absolute count", func(t *testing.T) {
+		_, err := run(interfaces.ErrorHandling{MaxErrors: 5})
+		assert.ErrorIs(t, err, pipeline.ErrTooManyErrors)
+		assert.ErrorIs(t, err, interfaces.ErrValidation)
+		assert.ErrorContains(t, err, "6 record errors, more than maxerrors 5")
+		t.Logf("%s Absolute count tripped: %v", greenTick, err)
+	})
+
+	t.Run("Rate over a window", func(t *testing.T) {
+		_, err := run(interfaces.ErrorHandling{MaxErrorRate: 25, ErrorRateWindow: 10})
+		assert.ErrorIs(t, err, pipeline.ErrTooManyErrors)
+		assert.ErrorContains(t, err, "of the last 10 records failed, more than maxerrorrate 25%")
+
+		// A window the run never fills is checked at the end
+		_, err = run(interfaces.ErrorHandling{MaxErrorRate: 25})
+		assert.ErrorContains(t, err, "of the last 30 records failed")
+		t.Logf("%s Error rate tripped", greenTick)
+	})
+
+	t.Run("Invalid rate", func(t *testing.T) {
+		_, err := run(interfaces.ErrorHandling{MaxErrorRate: 150})
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		t.Logf("%s Invalid rate rejected", greenTick)
+	})
+}
+
+func TestEmptyInput(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Empty source passes by default", func(t *testing.T) {
+		for _, policy := range []string{"", pipeline.EmptyInputOK, pipeline.EmptyInputWarn} {
+			dest := &hookedDestination{}
+			p := &pipeline.Pipeline{Source: stubSource{data: "id,name\n"}, Destination: dest, Config: interfaces.PipelineConfig{OnEmptyInput: policy}}
+			summary, err := p.Run(context.Background())
+			assert.NoError(t, err, policy)
+			assert.True(t, summary.EmptyInput, policy)
+			report := pipeline.NewReport("CSV", "JSON", time.Now(), summary, err)
+			assert.Equal(t, 0, report.ExitCode, policy)
+		}
+		t.Logf("%s Empty source passes by default passed", greenTick)
+	})
+
+	t.Run("Error policy fails before writing", func(t *testing.T) {
+		for _, data := range []interface{}{"id,name\n", "", []byte(" \n"), nil} {
+			dest := &hookedDestination{}
+			p := &pipeline.Pipeline{Source: stubSource{data: data}, Destination: dest, Config: interfaces.PipelineConfig{OnEmptyInput: "ERROR"}}
+			summary, err := p.Run(context.Background())
+			assert.ErrorIs(t, err, pipeline.ErrEmptyInput)
+			assert.ErrorIs(t, err, interfaces.ErrValidation)
+			assert.Empty(t, dest.calls, "The destination is not prepared")
+			report := pipeline.NewReport("CSV", "JSON", time.Now(), summary, err)
+			assert.Equal(t, pipeline.StatusFailure, report.Status)
+			assert.Equal(t, 1, report.ExitCode)
+			assert.Equal(t, pipeline.CodeEmptyInput, report.ErrorCode)
+			assert.True(t, report.Summary.EmptyInput)
+		}
+		t.Logf("%s Error policy fails before writing passed", greenTick)
+	})
+
+	t.Run("Records are not empty", func(t *testing.T) {
+		// Rows the source could not read still show it returned something
+		cfg := interfaces.PipelineConfig{
+			OnEmptyInput:  pipeline.EmptyInputError,
+			ErrorHandling: interfaces.ErrorHandling{Strategy: pipeline.StrategyLogAndContinue},
+			Validate:      interfaces.ValidationConfig{Rules: []string{`FIELD("name") REQUIRED`}},
+		}
+		_, summary := runPipeline(t, "id,name\n1,", cfg)
+		assert.False(t, summary.EmptyInput)
+		assert.Equal(t, 1, summary.RecordsQuarantined)
+		t.Logf("%s Records are not empty passed", greenTick)
+	})
+
+	t.Run("Paged source checked after the last page", func(t *testing.T) {
+		source := &pagedSource{pages: [][]map[string]interface{}{{}, {}}}
+		p := &pipeline.Pipeline{
+			Source:        source,
+			Destination:   &captureDestination{},
+			Config:        interfaces.PipelineConfig{OnEmptyInput: pipeline.EmptyInputError},
+			SourceRequest: interfaces.Request{PageSize: 10},
+		}
+		summary, err := p.Run(context.Background())
+		assert.ErrorIs(t, err, pipeline.ErrEmptyInput)
+		assert.Equal(t, []string{"", "1"}, source.tokens)
+		assert.True(t, summary.EmptyInput)
+		t.Logf("%s Paged source checked after the last page passed", greenTick)
+	})
+
+	t.Run("Invalid policy", func(t *testing.T) {
+		p := &pipeline.Pipeline{Source: stubSource{data: "id\n1"}, Destination: &captureDestination{}, Config: interfaces.PipelineConfig{OnEmptyInput: "fail"}}
+		_, err := p.Run(context.Background())
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		assert.ErrorContains(t, err, `invalid onemptyinput "fail": expected ok, warn or error`)
+		t.Logf("%s Invalid policy passed", greenTick)
+	})
+}
+
+func TestArrayTransforms(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Deduplicate", func(t *testing.T) {
+		stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`dedup-array tags`}})
+		assert.NoError(t, err)
+		out, err := stage.Process(pipeline.Record{"tags": []interface{}{"sale", "new", "sale", map[string]interface{}{"a": 1}, map[string]interface{}{"a": 1}}})
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{"sale", "new", map[string]interface{}{"a": 1}}, out[0]["tags"])
+		out, err = stage.Process(pipeline.Record{"tags": []string{"b", "a", "b"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{"b", "a"}, out[0]["tags"], "Typed slices are read too")
+		t.Logf("%s Deduplicate passed", greenTick)
+	})
+
+	t.Run("Sort", func(t *testing.T) {
+		asc, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`sort-array tags`}})
+		assert.NoError(t, err)
+		desc, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`sort-array tags DESC`}})
+		assert.NoError(t, err)
+		out, err := asc.Process(pipeline.Record{"tags": []interface{}{"sale", nil, "new", "clearance"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{"clearance", "new", "sale", nil}, out[0]["tags"])
+		out, err = desc.Process(pipeline.Record{"tags": []interface{}{"9", 10.0, "2"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{10.0, "9", "2"}, out[0]["tags"], "Numbers sort by value")
+		_, err = asc.Process(pipeline.Record{"tags": []interface{}{map[string]interface{}{"a": 1}}})
+		assert.ErrorContains(t, err, "cannot sort field tags: element of type map[string]interface {} cannot be sorted")
+		t.Logf("%s Sort passed", greenTick)
+	})
+
+	t.Run("Other values", func(t *testing.T) {
+		stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`dedup-array tags`, `sort-array tags`}})
+		assert.NoError(t, err)
+		for _, rec := range []pipeline.Record{{"id": 1}, {"id": 1, "tags": nil}} {
+			out, err := stage.Process(rec.Copy())
+			assert.NoError(t, err)
+			assert.Equal(t, []pipeline.Record{rec}, out)
+		}
+		_, err = stage.Process(pipeline.Record{"tags": "a,b"})
+		assert.ErrorContains(t, err, "cannot deduplicate field tags: value of type string is not an array")
+
+		// Under LOG_AND_CONTINUE the record is quarantined and the rest go on
+		cfg := interfaces.PipelineConfig{
+			ErrorHandling: interfaces.ErrorHandling{Strategy: pipeline.StrategyLogAndContinue},
+			Transform:     interfaces.TransformConfig{Rules: []string{`dedup-array tags`, `sort-array tags`, `explode tags`}},
+		}
+		data := []map[string]interface{}{
+			{"id": "1", "tags": []interface{}{"sale", "new", "sale"}},
+			{"id": "2", "tags": "sale"},
+		}
+		sent, summary := runPipeline(t, data, cfg)
+		records := pipeline.NewDataset(sent).Records
+		if assert.Len(t, records, 2) {
+			assert.Equal(t, "new", records[0]["tags"])
+			assert.Equal(t, "sale", records[1]["tags"])
+		}
+		assert.Equal(t, 1, summary.RecordsQuarantined)
+		t.Logf("%s Other values passed", greenTick)
+	})
+
+	t.Run("Invalid rules", func(t *testing.T) {
+		for _, rule := range []string{`dedup-array`, `dedup-array a b`, `sort-array`, `sort-array a up`, `sort-array a asc b`} {
+			_, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{rule}})
+			assert.Error(t, err, rule)
+		}
+		_, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`sort-array a up`}})
+		assert.ErrorContains(t, err, "unknown direction up, expected sort-array <field> [asc|desc]")
+		t.Logf("%s Invalid array rules rejected", greenTick)
+	})
+}
+
+// topicDestination routes to the topic in ProducerTopic, recording its hook
+// calls and the records each topic received
+type topicDestination struct {
+	calls  []string
+	topics map[string][]map[string]interface{}
+}
+
+func (d *topicDestination) Target(req interfaces.Request) string {
+	return req.ProducerTopic
+}
+
+func (d *topicDestination) WithTarget(req interfaces.Request, topic string) interfaces.Request {
+	req.ProducerTopic = topic
+	return req
+}
+
+func (d *topicDestination) Prepare(req interfaces.Request) error {
+	d.calls = append(d.calls, "prepare "+req.ProducerTopic)
+	return nil
+}
+
+func (d *topicDestination) SendData(data interface{}, req interfaces.Request) error {
+	d.calls = append(d.calls, "send "+req.ProducerTopic)
+	if d.topics == nil {
+		d.topics = map[string][]map[string]interface{}{}
+	}
+	for _, rec := range pipeline.NewDataset(data).Records {
+		d.topics[req.ProducerTopic] = append(d.topics[req.ProducerTopic], rec)
+	}
+	return nil
+}
+
+func (d *topicDestination) Finish(req interfaces.Request) error {
+	d.calls = append(d.calls, "finish "+req.ProducerTopic)
+	return nil
+}
+
+func TestDestinationRouting(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	input := "id,tenant\n1,acme\n2,globex\n3,acme"
+
+	t.Run("Records go to the target their fields name", func(t *testing.T) {
+		dest := &topicDestination{}
+		p := &pipeline.Pipeline{
+			Source:             stubSource{data: input},
+			Destination:        dest,
+			DestinationRequest: interfaces.Request{ProducerTopic: "events_{tenant}"},
+			Config:             interfaces.PipelineConfig{Delivery: interfaces.DeliveryConfig{BatchSize: 2}},
+		}
+		summary, err := p.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			"prepare events_acme", "prepare events_globex", "send events_acme", "send events_globex",
+			"send events_acme", "finish events_acme", "finish events_globex",
+		}, dest.calls, "Each target is prepared once and finished after the run")
+		assert.Equal(t, map[string][]map[string]interface{}{
+			"events_acme":   {{"id": "1", "tenant": "acme"}, {"id": "3", "tenant": "acme"}},
+			"events_globex": {{"id": "2", "tenant": "globex"}},
+		}, dest.topics)
+		assert.Equal(t, 3, summary.RecordsWritten)
+		assert.Equal(t, 3, summary.BatchesWritten)
+		t.Logf("%s Records go to the target their fields name passed", greenTick)
+	})
+
+	t.Run("File per target", func(t *testing.T) {
+		dir := t.TempDir()
+		p := &pipeline.Pipeline{
+			Source:             stubSource{data: input},
+			Destination:        integrations.CSVDestination{},
+			DestinationRequest: interfaces.Request{CSVDestinationFileName: filepath.Join(dir, "events_{tenant}.csv")},
+		}
+		_, err := p.Run(context.Background())
+		assert.NoError(t, err)
+		acme, err := os.ReadFile(filepath.Join(dir, "events_acme.csv"))
+		assert.NoError(t, err)
+		assert.Equal(t, "id,tenant\n1,acme\n3,acme\n", string(acme))
+		globex, err := os.ReadFile(filepath.Join(dir, "events_globex.csv"))
+		assert.NoError(t, err)
+		assert.Equal(t, "id,tenant\n2,globex\n", string(globex))
+		t.Logf("%s File per target passed", greenTick)
+	})
+
+	t.Run("Unresolved targets follow the error strategy", func(t *testing.T) {
+		data := "id,tenant\n1,acme\n2,\n3,../etc\n4,globex\n5,initech"
+		dest := &topicDestination{}
+		p := &pipeline.Pipeline{
+			Source:             stubSource{data: data},
+			Destination:        dest,
+			DestinationRequest: interfaces.Request{ProducerTopic: "events_{tenant}"},
+			Config: interfaces.PipelineConfig{
+				ErrorHandling: interfaces.ErrorHandling{Strategy: pipeline.StrategyLogAndContinue},
+				Delivery:      interfaces.DeliveryConfig{MaxTargets: 2},
+			},
+		}
+		summary, err := p.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, dest.topics, 2)
+		assert.Equal(t, 3, summary.RecordsQuarantined)
+		assert.Equal(t, 3, summary.StageErrors[pipeline.RouteStageName])
+
+		dest = &topicDestination{}
+		p.Destination = dest
+		p.Config = interfaces.PipelineConfig{}
+		_, err = p.Run(context.Background())
+		assert.ErrorIs(t, err, interfaces.ErrValidation)
+		assert.ErrorContains(t, err, "cannot route record: field tenant of target events_{tenant} is missing or empty")
+		assert.Empty(t, dest.topics)
+		t.Logf("%s Unresolved targets follow the error strategy passed", greenTick)
+	})
+
+	t.Run("Invalid template", func(t *testing.T) {
+		for target, message := range map[string]string{
+			"events_{tenant": "{ without }",
+			"events_tenant}": "} without {",
+			"events_{}":      "expected a field name between { and }",
+			"events_{{a}}":   "expected a field name between { and }",
+		} {
+			p := &pipeline.Pipeline{Source: stubSource{data: input}, Destination: &topicDestination{}, DestinationRequest: interfaces.Request{ProducerTopic: target}}
+			_, err := p.Run(context.Background())
+			assert.ErrorIs(t, err, interfaces.ErrConfigInvalid, target)
+			assert.ErrorContains(t, err, message, target)
+		}
+		p := &pipeline.Pipeline{Source: stubSource{data: []byte("raw")}, Destination: &topicDestination{}, DestinationRequest: interfaces.Request{ProducerTopic: "events_{tenant}"}}
+		_, err := p.Run(context.Background())
+		assert.ErrorContains(t, err, "cannot be routed to targets named from fields")
+		t.Logf("%s Invalid template rejected", greenTick)
+	})
+}
+
+func TestPivotTransforms(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+	answers := []map[string]interface{}{
+		{"respondent": "1", "question": "q1", "answer": "yes", "channel": "web"},
+		{"respondent": "1", "question": "q2", "answer": "no", "channel": "web"},
+		{"respondent": "2", "question": "q2", "answer": "maybe", "channel": "app"},
+		{"respondent": "2", "question": "q3", "answer": "yes", "channel": "app"},
+	}
+
+	t.Run("Pivot", func(t *testing.T) {
+		cfg := interfaces.PipelineConfig{Transform: interfaces.TransformConfig{Rules: []string{
+			`pivot question answer by respondent`,
+			`coalesce q1 = q1, q3`,
+		}}}
+		sent, summary := runPipeline(t, answers, cfg)
+		assert.Equal(t, []pipeline.Record{
+			{"respondent": "1", "q1": "yes", "q2": "no", "q3": nil},
+			{"respondent": "2", "q1": "yes", "q2": "maybe", "q3": "yes"},
+		}, pipeline.NewDataset(sent).Records, "Rules after the pivot run on its records")
+		assert.Equal(t, 4, summary.RecordsRead)
+		assert.Equal(t, 2, summary.RecordsWritten)
+		t.Logf("%s Pivot passed", greenTick)
+	})
+
+	t.Run("Records a pivot rejects", func(t *testing.T) {
+		stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`pivot question answer by respondent`}, MaxPivotColumns: 2})
+		assert.NoError(t, err)
+		for _, rec := range answers[:3] {
+			out, err := stage.Process(pipeline.Record(rec).Copy())
+			assert.NoError(t, err)
+			assert.Empty(t, out, "Records are held until Flush")
+		}
+		_, err = stage.Process(pipeline.Record{"respondent": "2", "question": "q3", "answer": "yes"})
+		assert.ErrorContains(t, err, "key q3 would be a new column beyond maxpivotcolumns of 2")
+		_, err = stage.Process(pipeline.Record{"respondent": "1", "question": "q1", "answer": "no"})
+		assert.ErrorContains(t, err, "its group already has a value for q1")
+		_, err = stage.Process(pipeline.Record{"respondent": "3", "answer": "no"})
+		assert.ErrorContains(t, err, "key field question is missing or empty")
+		_, err = stage.Process(pipeline.Record{"respondent": "3", "question": "respondent", "answer": "no"})
+		assert.ErrorContains(t, err, "key respondent of field question names a field grouped by")
+
+		out, err := stage.Flush()
+		assert.NoError(t, err)
+		assert.Equal(t, []pipeline.Record{
+			{"respondent": "1", "q1": "yes", "q2": "no"},
+			{"respondent": "2", "q1": nil, "q2": "maybe"},
+		}, out, "Rejected records leave the groups as they were")
+		t.Logf("%s Records a pivot rejects passed", greenTick)
+	})
+
+	t.Run("Unpivot", func(t *testing.T) {
+		stage, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`unpivot q1, q2, q3 into question, answer`}})
+		assert.NoError(t, err)
+		out, err := stage.Process(pipeline.Record{"respondent": "1", "q1": "yes", "q2": nil, "q3": "no"})
+		assert.NoError(t, err)
+		assert.Equal(t, []pipeline.Record{
+			{"respondent": "1", "question": "q1", "answer": "yes"},
+			{"respondent": "1", "question": "q3", "answer": "no"},
+		}, out, "Null fields are left out")
+		_, err = stage.Process(pipeline.Record{"respondent": "2"})
+		assert.ErrorIs(t, err, pipeline.ErrFiltered)
+
+		// Unpivoting the pivoted records gives the answers back
+		cfg := interfaces.PipelineConfig{Transform: interfaces.TransformConfig{Rules: []string{
+			`pivot question answer by respondent`,
+			`unpivot q1, q2, q3 into question answer`,
+		}}}
+		sent, _ := runPipeline(t, answers, cfg)
+		records := pipeline.NewDataset(sent).Records
+		assert.Len(t, records, 4)
+		assert.Equal(t, pipeline.Record{"respondent": "2", "question": "q3", "answer": "yes"}, records[3])
+		t.Logf("%s Unpivot passed", greenTick)
+	})
+
+	t.Run("Invalid rules", func(t *testing.T) {
+		for _, rule := range []string{`pivot`, `pivot question answer`, `pivot question answer group respondent`, `pivot question question by respondent`,
+			`pivot question answer by answer`, `unpivot q1 q2`, `unpivot into question answer`, `unpivot q1 into question`, `unpivot q1 into v v`} {
+			_, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{rule}})
+			assert.Error(t, err, rule)
+		}
+		_, err := pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`when FIELD("a") == "1" then pivot question answer by respondent`}})
+		assert.ErrorContains(t, err, "pivot cannot be applied to some records only")
+		_, err = pipeline.NewTransformStage(interfaces.TransformConfig{Rules: []string{`pivot question answer by respondent`}, MaxPivotColumns: -1})
+		assert.ErrorContains(t, err, "maxpivotcolumns must not be negative")
+		t.Logf("%s Invalid rules passed", greenTick)
+	})
+}
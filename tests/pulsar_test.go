@@ -0,0 +1,180 @@
+package tests
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/SkySingh04/fractal/integrations"
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/pipeline"
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePulsarMessage is a message carrying a payload and nothing else
+type fakePulsarMessage struct {
+	pulsar.Message
+	payload string
+}
+
+func (m fakePulsarMessage) Payload() []byte { return []byte(m.payload) }
+func (m fakePulsarMessage) Key() string     { return "" }
+
+// fakePulsarTopic stands in for a broker: each consumer is handed the
+// messages not acknowledged yet and not held by a consumer still open, as a
+// subscription redelivers them
+type fakePulsarTopic struct {
+	mu       sync.Mutex
+	payloads []string
+	acked    map[string]bool
+	held     map[string]*fakePulsarConsumer
+	options  []pulsar.ConsumerOptions
+	closed   int
+}
+
+func (f *fakePulsarTopic) subscribe(req interfaces.Request, options pulsar.ConsumerOptions) (integrations.PulsarConsumer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.options = append(f.options, options)
+	consumer := &fakePulsarConsumer{topic: f}
+	for _, payload := range f.payloads {
+		if !f.acked[payload] && f.held[payload] == nil {
+			consumer.pending = append(consumer.pending, payload)
+			f.held[payload] = consumer
+		}
+	}
+	return consumer, nil
+}
+
+func (f *fakePulsarTopic) ackedPayloads() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var acked []string
+	for _, payload := range f.payloads {
+		if f.acked[payload] {
+			acked = append(acked, payload)
+		}
+	}
+	return acked
+}
+
+type fakePulsarConsumer struct {
+	topic   *fakePulsarTopic
+	pending []string
+}
+
+func (c *fakePulsarConsumer) Receive(ctx context.Context) (pulsar.Message, error) {
+	if len(c.pending) == 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	payload := c.pending[0]
+	c.pending = c.pending[1:]
+	return fakePulsarMessage{payload: payload}, nil
+}
+
+func (c *fakePulsarConsumer) Ack(msg pulsar.Message) error {
+	c.topic.mu.Lock()
+	defer c.topic.mu.Unlock()
+	c.topic.acked[string(msg.Payload())] = true
+	delete(c.topic.held, string(msg.Payload()))
+	return nil
+}
+
+func (c *fakePulsarConsumer) Close() {
+	c.topic.mu.Lock()
+	defer c.topic.mu.Unlock()
+	c.topic.closed++
+	for payload, holder := range c.topic.held {
+		if holder == c {
+			delete(c.topic.held, payload)
+		}
+	}
+}
+
+func TestPulsarConfig(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	source := integrations.PulsarSource{}
+	destination := integrations.PulsarDestination{}
+	base := interfaces.Request{PulsarURL: "pulsar://localhost:6650", PulsarTopic: "orders"}
+
+	t.Run("Missing topic", func(t *testing.T) {
+		_, err := source.FetchData(interfaces.Request{PulsarURL: base.PulsarURL})
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		assert.ErrorIs(t, destination.SendData([]map[string]interface{}{{"id": 1}}, interfaces.Request{PulsarURL: base.PulsarURL}), interfaces.ErrConfigInvalid)
+		t.Logf("%s Missing topic rejected", greenTick)
+	})
+
+	t.Run("Invalid subscription type", func(t *testing.T) {
+		req := base
+		req.PulsarSubscriptionType = "broadcast"
+		_, err := source.FetchData(req)
+		assert.ErrorContains(t, err, `invalid Pulsar subscription type "broadcast"`)
+		t.Logf("%s Invalid subscription type rejected", greenTick)
+	})
+
+	t.Run("Token and certificate together", func(t *testing.T) {
+		req := base
+		req.PulsarToken = "secret"
+		req.PulsarTLSCertFile = "client.pem"
+		req.PulsarTLSKeyFile = "client.key"
+		err := destination.SendData([]map[string]interface{}{{"id": 1}}, req)
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		assert.ErrorContains(t, err, "not both")
+		t.Logf("%s Conflicting authentication rejected", greenTick)
+	})
+
+	t.Run("Nothing to publish", func(t *testing.T) {
+		assert.NoError(t, destination.SendData([]map[string]interface{}{}, base))
+		t.Logf("%s Empty batch skipped", greenTick)
+	})
+}
+
+func TestPulsarAcknowledgement(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	req := interfaces.Request{PulsarURL: "pulsar://localhost:6650", PulsarTopic: "orders-acks", PulsarSubscription: "loader", PulsarReceiveTimeout: "10ms"}
+
+	t.Run("Messages are acknowledged by Commit only", func(t *testing.T) {
+		topic := &fakePulsarTopic{payloads: []string{`{"id":1}`, `{"id":2}`}, acked: map[string]bool{}, held: map[string]*fakePulsarConsumer{}}
+		source := integrations.NewPulsarSource(topic.subscribe)
+		data, err := source.FetchData(req)
+		assert.NoError(t, err)
+		assert.Len(t, data, 2)
+		assert.Empty(t, topic.ackedPayloads(), "Messages were acknowledged before Commit")
+		if assert.Len(t, topic.options, 1) {
+			assert.Equal(t, "orders-acks", topic.options[0].Topic)
+			assert.Equal(t, "loader", topic.options[0].SubscriptionName)
+			assert.Equal(t, pulsar.Shared, topic.options[0].Type)
+		}
+
+		assert.NoError(t, source.Commit(req))
+		assert.Equal(t, []string{`{"id":1}`, `{"id":2}`}, topic.ackedPayloads())
+		assert.Equal(t, 1, topic.closed, "The consumer was not released after Commit")
+		// A second Commit has nothing left to acknowledge
+		assert.NoError(t, source.Commit(req))
+		t.Logf("%s Acknowledgement on Commit passed", greenTick)
+	})
+
+	t.Run("A failed delivery acknowledges nothing", func(t *testing.T) {
+		topic := &fakePulsarTopic{payloads: []string{`{"id":1}`, `{"id":2}`}, acked: map[string]bool{}, held: map[string]*fakePulsarConsumer{}}
+		source := integrations.NewPulsarSource(topic.subscribe)
+
+		failing := &pipeline.Pipeline{Source: source, SourceRequest: req, Destination: &flakyDestination{failures: 1}}
+		_, err := failing.Run(context.Background())
+		assert.Error(t, err)
+		assert.Empty(t, topic.ackedPayloads(), "Messages were acknowledged although the run failed")
+
+		// The next run is handed the same messages and acknowledges them once delivered
+		dest := &captureDestination{}
+		retried := &pipeline.Pipeline{Source: source, SourceRequest: req, Destination: dest}
+		_, err = retried.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []map[string]interface{}{{"id": float64(1)}, {"id": float64(2)}}, dest.sent)
+		assert.Equal(t, []string{`{"id":1}`, `{"id":2}`}, topic.ackedPayloads())
+		assert.Equal(t, 2, topic.closed, "The failed run's consumer was not released")
+		t.Logf("%s Failed delivery passed", greenTick)
+	})
+}
@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/SkySingh04/fractal/registry"
+	"github.com/stretchr/testify/assert"
+)
+
+// Run with go test -race to catch unguarded access to the registry
+func TestRegistryConcurrency(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Register and read in parallel", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(2)
+			name := fmt.Sprintf("TestConcurrent%d", i)
+			t.Cleanup(func() {
+				registry.UnregisterSource(name)
+				registry.UnregisterDestination(name)
+			})
+			go func() {
+				defer wg.Done()
+				registry.RegisterSource(name, stubSource{})
+				registry.RegisterDestination(name, &captureDestination{})
+			}()
+			go func() {
+				defer wg.Done()
+				for range registry.GetSources() {
+				}
+				for range registry.GetDestinations() {
+				}
+				registry.GetSource(name)
+				registry.GetDestination(name)
+			}()
+		}
+		wg.Wait()
+		for i := 0; i < 20; i++ {
+			_, ok := registry.GetSource(fmt.Sprintf("TestConcurrent%d", i))
+			assert.True(t, ok)
+		}
+		t.Logf("%s Registry read while integrations registered", greenTick)
+	})
+
+	t.Run("Listings are copies", func(t *testing.T) {
+		sources := registry.GetSources()
+		registry.RegisterSource("TestLateSource", stubSource{})
+		t.Cleanup(func() { registry.UnregisterSource("TestLateSource") })
+		_, listed := sources["TestLateSource"]
+		assert.False(t, listed)
+		delete(sources, "CSV")
+		_, ok := registry.GetSource("CSV")
+		assert.True(t, ok)
+		t.Logf("%s Listings unaffected by later changes", greenTick)
+	})
+
+	t.Run("Registrations taken back", func(t *testing.T) {
+		before := len(registry.GetSources())
+		registry.RegisterSource("TestTakenBack", stubSource{})
+		registry.RegisterDestination("TestTakenBack", &captureDestination{})
+		registry.RegisterCodec("TestTakenBack", pipeCodec{})
+		registry.UnregisterSource("TestTakenBack")
+		registry.UnregisterDestination("TestTakenBack")
+		registry.UnregisterCodec("TestTakenBack")
+		_, ok := registry.GetSource("TestTakenBack")
+		assert.False(t, ok)
+		_, ok = registry.GetDestination("TestTakenBack")
+		assert.False(t, ok)
+		_, ok = registry.GetCodec("testtakenback")
+		assert.False(t, ok)
+		assert.Len(t, registry.GetSources(), before)
+		t.Logf("%s Unregistered integrations gone", greenTick)
+	})
+}
@@ -0,0 +1,48 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/SkySingh04/fractal/config"
+	_ "github.com/SkySingh04/fractal/integrations"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigSchema(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	raw, err := config.SchemaJSON()
+	assert.NoError(t, err)
+	var schema map[string]interface{}
+	assert.NoError(t, json.Unmarshal(raw, &schema))
+	assert.Equal(t, config.SchemaURL, schema["$schema"])
+
+	properties := schema["properties"].(map[string]interface{})
+	errorHandling := properties["errorhandling"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "string"}, errorHandling["strategy"])
+	quarantine := errorHandling["quarantineoutput"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Contains(t, quarantine, "location")
+
+	aggregate := properties["aggregate"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "integer"}, aggregate["maxgroups"])
+	assert.NotContains(t, properties["join"].(map[string]interface{})["properties"], "request")
+	t.Logf("%s Config struct fields present", greenTick)
+
+	methods := properties["inputMethod"].(map[string]interface{})["anyOf"].([]interface{})
+	assert.Contains(t, methods[0].(map[string]interface{})["enum"], "CSV")
+	assert.Equal(t, "^ref:.+", methods[1].(map[string]interface{})["pattern"], "Connections can be referenced")
+	found := false
+	for _, condition := range schema["allOf"].([]interface{}) {
+		c := condition.(map[string]interface{})
+		method := c["if"].(map[string]interface{})["properties"].(map[string]interface{})["inputMethod"]
+		if method == nil || method.(map[string]interface{})["const"] != "CSV" {
+			continue
+		}
+		inputconfig := c["then"].(map[string]interface{})["properties"].(map[string]interface{})["inputconfig"].(map[string]interface{})
+		assert.Contains(t, inputconfig["properties"], "csvsourcefilename")
+		found = true
+	}
+	assert.True(t, found, "No inputconfig schema for the CSV source")
+	t.Logf("%s Integration fields present", greenTick)
+}
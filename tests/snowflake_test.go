@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SkySingh04/fractal/integrations"
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/pipeline"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnowflakeConfig(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	destination := integrations.SnowflakeDestination{}
+	records := []map[string]interface{}{{"id": 1}}
+	base := interfaces.Request{SnowflakeAccount: "myorg-myaccount", SnowflakeUser: "loader", SnowflakePassword: "secret", SnowflakeTable: "orders"}
+
+	t.Run("Missing credentials", func(t *testing.T) {
+		req := base
+		req.SnowflakePassword = ""
+		assert.EqualError(t, destination.SendData(records, req), "missing Snowflake password or private key file")
+		t.Logf("%s Missing credentials rejected", greenTick)
+	})
+
+	t.Run("Invalid table name", func(t *testing.T) {
+		req := base
+		req.SnowflakeTable = "orders; DROP TABLE users"
+		assert.ErrorContains(t, destination.SendData(records, req), "invalid Snowflake table name")
+		t.Logf("%s Invalid table name rejected", greenTick)
+	})
+
+	t.Run("Private key that is not PEM", func(t *testing.T) {
+		keyFile := filepath.Join(t.TempDir(), "rsa_key.p8")
+		assert.NoError(t, os.WriteFile(keyFile, []byte("not a key"), 0600))
+		req := base
+		req.SnowflakePassword = ""
+		req.SnowflakePrivateKeyFile = keyFile
+		assert.ErrorContains(t, destination.SendData(records, req), "is not PEM encoded")
+		t.Logf("%s Invalid private key rejected", greenTick)
+	})
+}
+
+func TestSnowflakeLoadQueries(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Stage paths", func(t *testing.T) {
+		assert.Equal(t, "@%orders/fractal", integrations.SnowflakeStagePath("orders", ""))
+		assert.Equal(t, "@%shop.public.orders/fractal", integrations.SnowflakeStagePath("shop.public.orders", ""))
+		assert.Equal(t, "@loads/fractal", integrations.SnowflakeStagePath("orders", "loads"))
+		t.Logf("%s Stage paths passed", greenTick)
+	})
+
+	t.Run("PUT and COPY INTO", func(t *testing.T) {
+		file := filepath.Join("/tmp", "fractal-1234.json")
+		assert.Equal(t, "PUT 'file:///tmp/fractal-1234.json' @loads/fractal AUTO_COMPRESS=TRUE OVERWRITE=TRUE",
+			integrations.SnowflakePutQuery(file, "@loads/fractal"))
+
+		query, staged := integrations.SnowflakeCopyQuery("shop.public.orders", "@loads/fractal", file)
+		assert.Equal(t, "COPY INTO shop.public.orders FROM @loads/fractal FILES = ('fractal-1234.json.gz') "+
+			"FILE_FORMAT = (TYPE = JSON) MATCH_BY_COLUMN_NAME = CASE_INSENSITIVE ON_ERROR = SKIP_FILE PURGE = TRUE", query)
+		assert.Equal(t, "@loads/fractal/fractal-1234.json.gz", staged)
+		t.Logf("%s Load statements passed", greenTick)
+	})
+
+	t.Run("Table columns", func(t *testing.T) {
+		query, err := integrations.SnowflakeCreateTableQuery("orders", []pipeline.Record{
+			{"id": 1, "amount": 10, "paid": true, "note": nil, "attrs": map[string]interface{}{"a": 1}, "code": 7},
+			{"id": 2, "amount": 7.5, "paid": false, "note": nil, "attrs": []interface{}{1}, "code": "x7", "_seen$": "yes"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "CREATE TABLE IF NOT EXISTS orders (_seen$ VARCHAR, amount FLOAT, attrs VARIANT, code VARCHAR, id NUMBER(38,0), note VARCHAR, paid BOOLEAN)", query)
+		t.Logf("%s Column types passed", greenTick)
+	})
+
+	t.Run("Column names are never quoted", func(t *testing.T) {
+		// A quoted name would be case sensitive, so names that need quoting are refused
+		for _, name := range []string{"order id", `total"amount`, "shop.total", "1st", "total;DROP"} {
+			_, err := integrations.SnowflakeCreateTableQuery("orders", []pipeline.Record{{name: 1}})
+			assert.EqualError(t, err, fmt.Sprintf("field %q cannot be used as a Snowflake column name", name))
+		}
+		t.Logf("%s Column names passed", greenTick)
+	})
+}
@@ -8,9 +8,14 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SkySingh04/fractal/integrations"
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/logger"
+	"github.com/SkySingh04/fractal/pipeline"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -154,3 +159,225 @@ func TestAdd(t *testing.T) {
 		})
 	}
 }
+
+func TestPostgreSQLConflictColumns(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	dest := integrations.PostgreSQLDestination{}
+
+	t.Run("Composite key accepted", func(t *testing.T) {
+		err := dest.ValidateConfig(interfaces.Request{SQLTargetConflictColumns: []string{"tenant_id", "order_id"}})
+		assert.NoError(t, err)
+		t.Logf("%s Composite key passed", greenTick)
+	})
+
+	t.Run("Column listed twice", func(t *testing.T) {
+		err := dest.ValidateConfig(interfaces.Request{SQLTargetConflictColumns: []string{"tenant_id", "tenant_id"}})
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		t.Logf("%s Duplicate column passed", greenTick)
+	})
+
+	t.Run("Column missing from the records", func(t *testing.T) {
+		// Nothing is written, so the unreachable server is never contacted
+		req := interfaces.Request{
+			SQLTargetConnString:      "postgres://localhost:1/fractal?sslmode=disable",
+			SQLTargetConflictColumns: []string{"tenant_id", "order_id"},
+		}
+		data := map[string][]map[string]interface{}{"orders": {
+			{"tenant_id": 1, "order_id": 7, "total": 10},
+			{"tenant_id": 1, "total": 20},
+		}}
+		err := dest.SendData(data, req)
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		assert.Contains(t, err.Error(), "conflict column order_id is not in row 1 of table orders")
+		t.Logf("%s Missing column passed", greenTick)
+	})
+}
+
+func TestPostgreSQLSchemaCheck(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	columns := map[string]integrations.SQLColumn{
+		"id":         {Name: "id", Type: "integer"},
+		"name":       {Name: "name", Type: "character varying", Nullable: true, MaxLength: 5},
+		"active":     {Name: "active", Type: "boolean", Nullable: true},
+		"created_at": {Name: "created_at", Type: "timestamp with time zone", HasDefault: true},
+		"ref":        {Name: "ref", Type: "uuid", Nullable: true},
+		"tags":       {Name: "tags", Type: "ARRAY", Nullable: true},
+	}
+
+	t.Run("Fitting row accepted", func(t *testing.T) {
+		row := map[string]interface{}{"ID": "42", "name": "Ada", "active": "yes", "created_at": "2026-10-14T09:30:00Z", "ref": "5f0c7d4e-8b1a-4c2e-9d3f-1a2b3c4d5e6f", "tags": "{a,b}"}
+		assert.NoError(t, integrations.CheckSQLRow(row, columns))
+		t.Logf("%s Fitting row passed", greenTick)
+	})
+
+	t.Run("Mismatches rejected", func(t *testing.T) {
+		cases := []struct {
+			row    map[string]interface{}
+			reason string
+		}{
+			{map[string]interface{}{"id": 1, "email": "ada@example.com"}, "column email is not in the table"},
+			{map[string]interface{}{"id": "forty-two"}, `column id of type integer: "forty-two" is not a whole number`},
+			{map[string]interface{}{"id": int64(1) << 40}, "is out of range"},
+			{map[string]interface{}{"id": 1.5}, "1.5 is not a whole number"},
+			{map[string]interface{}{"id": 1, "name": "Grace Hopper"}, "value is 12 characters long, more than 5"},
+			{map[string]interface{}{"id": 1, "active": "maybe"}, `"maybe" is not a boolean`},
+			{map[string]interface{}{"id": 1, "created_at": "yesterday"}, `"yesterday" is not a date or time`},
+			{map[string]interface{}{"id": 1, "ref": "not-a-uuid"}, "is not a UUID"},
+			{map[string]interface{}{"id": 1, "name": map[string]interface{}{"first": "Ada"}}, "cannot be written"},
+			{map[string]interface{}{"id": nil}, "column id is NOT NULL, but the value is null"},
+			{map[string]interface{}{"name": "Ada"}, "column id is NOT NULL without a default"},
+		}
+		for _, c := range cases {
+			assert.ErrorContains(t, integrations.CheckSQLRow(c.row, columns), c.reason)
+		}
+		t.Logf("%s Mismatches passed", greenTick)
+	})
+
+	t.Run("Nullable and defaulted columns may be left out", func(t *testing.T) {
+		assert.NoError(t, integrations.CheckSQLRow(map[string]interface{}{"id": 7, "name": nil}, columns))
+		t.Logf("%s Optional columns passed", greenTick)
+	})
+}
+
+func TestPostgreSQLHooks(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	dest := integrations.PostgreSQLDestination{}
+	// Nothing listens here, so every statement list fails
+	req := interfaces.Request{
+		SQLTargetConnString: "postgres://localhost:1/fractal?sslmode=disable",
+		SQLTargetPreSQL:     []string{"CREATE TABLE IF NOT EXISTS orders_staging (LIKE orders)"},
+		SQLTargetPostSQL:    []string{"INSERT INTO orders SELECT * FROM orders_staging", "DROP TABLE orders_staging"},
+	}
+
+	t.Run("Presql failure aborts", func(t *testing.T) {
+		assert.ErrorContains(t, dest.Prepare(req), "presql failed")
+		t.Logf("%s Presql failure passed", greenTick)
+	})
+
+	t.Run("Postsql failure is fatal only when asked", func(t *testing.T) {
+		assert.NoError(t, dest.Finish(req))
+		fatal := req
+		fatal.SQLTargetPostSQLFatal = true
+		assert.ErrorContains(t, dest.Finish(fatal), "postsql failed")
+		t.Logf("%s Postsql failure passed", greenTick)
+	})
+
+	t.Run("Empty statement rejected", func(t *testing.T) {
+		err := dest.ValidateConfig(interfaces.Request{SQLTargetPostSQL: []string{" "}})
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		t.Logf("%s Empty statement passed", greenTick)
+	})
+}
+
+func TestPostgreSQLOptions(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	dest := integrations.PostgreSQLDestination{}
+	// The driver rejects this encoding before dialing, so it shows the option reached it
+	options := map[string]string{"client_encoding": "LATIN1"}
+
+	t.Run("Added to a URL", func(t *testing.T) {
+		req := interfaces.Request{SQLTargetConnString: "postgres://localhost:1/fractal?sslmode=disable", Options: options}
+		assert.ErrorContains(t, dest.Ping(context.Background(), req), "client_encoding must be absent or 'UTF8'")
+		t.Logf("%s Options added to the URL query", greenTick)
+	})
+
+	t.Run("Added to key=value parameters", func(t *testing.T) {
+		req := interfaces.Request{SQLTargetConnString: "host=localhost port=1 sslmode=disable", Options: options}
+		assert.ErrorContains(t, dest.Ping(context.Background(), req), "client_encoding must be absent or 'UTF8'")
+
+		// A quoted value still parses, so the ping gets as far as dialing
+		req.Options = map[string]string{"application_name": `o'brien \ sons`}
+		err := dest.Ping(context.Background(), req)
+		assert.ErrorIs(t, err, interfaces.ErrConnection)
+		assert.NotContains(t, err.Error(), "unterminated")
+		t.Logf("%s Options added as parameters", greenTick)
+	})
+
+	t.Run("Rejected by integrations without options", func(t *testing.T) {
+		p := &pipeline.Pipeline{
+			Source:        stubSource{data: "id\n1"},
+			SourceRequest: interfaces.Request{Options: options},
+			Destination:   &captureDestination{},
+		}
+		_, err := p.Run(context.Background())
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		assert.ErrorContains(t, err, "does not take options")
+		t.Logf("%s Unused options rejected", greenTick)
+	})
+}
+
+func TestPostgreSQLWriteFailure(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	// Each attempt opens its own database, as SendData closes the one it wrote to
+	var mocks []sqlmock.Sqlmock
+	open := func(string) (*sql.DB, error) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			return nil, err
+		}
+		mock.ExpectQuery(`SELECT to_regclass\('public.orders'\)`).
+			WillReturnRows(sqlmock.NewRows([]string{"to_regclass"}).AddRow("orders"))
+		mock.ExpectExec("INSERT INTO orders").WillReturnError(errors.New("duplicate key value violates unique constraint"))
+		mock.ExpectClose()
+		mocks = append(mocks, mock)
+		return db, nil
+	}
+
+	t.Run("Failed insert reaches the run", func(t *testing.T) {
+		p := &pipeline.Pipeline{
+			Source:             stubSource{data: []map[string]interface{}{{"id": 1, "name": "Ada"}}},
+			Destination:        integrations.NewPostgreSQLDestination(open),
+			DestinationRequest: interfaces.Request{SQLTargetConnString: "postgres://localhost/fractal", SQLTargetTable: "orders"},
+			Config:             interfaces.PipelineConfig{Delivery: interfaces.DeliveryConfig{Retries: 1, RetryBackoff: "1ms"}},
+		}
+		summary, err := p.Run(context.Background())
+		// Still running here: the failure is logged and returned, not fatal
+		assert.ErrorIs(t, err, interfaces.ErrWrite)
+		assert.ErrorContains(t, err, "failed to insert into table orders: duplicate key value")
+		assert.Equal(t, 1, summary.Retries, "The destination's error should be retried")
+		assert.Len(t, mocks, 2)
+		for _, mock := range mocks {
+			assert.NoError(t, mock.ExpectationsWereMet())
+		}
+		t.Logf("%s Failed insert returned to the run", greenTick)
+	})
+}
+
+func TestPostgreSQLIncrementalSkipsTables(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	t.Run("Tables without the watermark column", func(t *testing.T) {
+		var logs bytes.Buffer
+		logger.SetOutput(&logs)
+		defer logger.SetOutput(nil)
+
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		mock.ExpectQuery("SELECT t.table_name, EXISTS").WithArgs("updated_at").
+			WillReturnRows(sqlmock.NewRows([]string{"table_name", "exists"}).AddRow("orders", true).AddRow("audit_log", false))
+		mock.ExpectQuery(`SELECT \* FROM orders ORDER BY "updated_at"`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "updated_at"}).AddRow(1, "2024-11-02T10:00:00Z"))
+		mock.ExpectClose()
+
+		source := integrations.NewPostgreSQLSource(func(string) (*sql.DB, error) { return db, nil })
+		data, err := source.FetchData(interfaces.Request{
+			SQLSourceConnString:      "postgres://localhost/fractal",
+			SQLSourceIncremental:     true,
+			SQLSourceWatermarkColumn: "updated_at",
+			SQLSourceCheckpointFile:  filepath.Join(t.TempDir(), "checkpoint.json"),
+		})
+		assert.NoError(t, err)
+		tables := data.(map[string][]map[string]interface{})
+		assert.Len(t, tables, 1)
+		assert.Len(t, tables["orders"], 1)
+		assert.NotContains(t, tables, "audit_log")
+		assert.Contains(t, logs.String(), "Skipping table audit_log: it has no watermark column updated_at")
+		assert.NoError(t, mock.ExpectationsWereMet())
+		t.Logf("%s Table without the watermark column skipped", greenTick)
+	})
+}
@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/SkySingh04/fractal/integrations"
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/pipeline"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQSConfig(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	source := integrations.SQSSource{}
+	queue := integrations.SQSDestination{}
+	topic := integrations.SNSDestination{}
+	base := interfaces.Request{SQSQueueURL: "https://sqs.eu-west-1.amazonaws.com/123456789012/orders"}
+	fifo := interfaces.Request{SQSQueueURL: "https://sqs.eu-west-1.amazonaws.com/123456789012/orders.fifo", SQSGroupField: "customer"}
+
+	t.Run("Missing queue and topic", func(t *testing.T) {
+		_, err := source.FetchData(interfaces.Request{})
+		assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+		assert.ErrorIs(t, queue.SendData([]map[string]interface{}{{"id": 1}}, interfaces.Request{}), interfaces.ErrConfigInvalid)
+		assert.ErrorIs(t, topic.SendData([]map[string]interface{}{{"id": 1}}, interfaces.Request{}), interfaces.ErrConfigInvalid)
+		t.Logf("%s Missing queue and topic rejected", greenTick)
+	})
+
+	t.Run("Region", func(t *testing.T) {
+		assert.NoError(t, source.ValidateConfig(base))
+		assert.NoError(t, source.ValidateConfig(interfaces.Request{SQSQueueURL: "https://eu-west-1.queue.amazonaws.com/123456789012/orders"}))
+		local := interfaces.Request{SQSQueueURL: "http://localhost:4566/000000000000/orders"}
+		assert.ErrorContains(t, source.ValidateConfig(local), "set region")
+		local.AWSRegion = "us-east-1"
+		assert.NoError(t, source.ValidateConfig(local))
+		assert.ErrorContains(t, topic.ValidateConfig(interfaces.Request{SNSTopicARN: "orders"}), "invalid SNS topic ARN")
+		assert.NoError(t, topic.ValidateConfig(interfaces.Request{SNSTopicARN: "arn:aws:sns:eu-west-1:123456789012:orders"}))
+		t.Logf("%s Region read from the queue URL and topic ARN", greenTick)
+	})
+
+	t.Run("Invalid receive settings", func(t *testing.T) {
+		req := base
+		req.SQSWaitTime = "30s"
+		assert.ErrorContains(t, source.ValidateConfig(req), `invalid SQS wait time "30s"`)
+		req = base
+		req.SQSVisibilityTimeout = "soon"
+		assert.ErrorContains(t, source.ValidateConfig(req), `invalid SQS visibility timeout "soon"`)
+		req = base
+		req.SQSAttributes = []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"}
+		assert.ErrorIs(t, source.ValidateConfig(req), interfaces.ErrConfigInvalid)
+		t.Logf("%s Invalid receive settings rejected", greenTick)
+	})
+
+	t.Run("FIFO group field", func(t *testing.T) {
+		req := fifo
+		req.SQSGroupField = ""
+		assert.ErrorContains(t, queue.ValidateConfig(req), "needs groupfield")
+		req = base
+		req.SQSGroupField = "customer"
+		assert.ErrorContains(t, queue.ValidateConfig(req), "only for FIFO")
+		assert.NoError(t, topic.ValidateConfig(interfaces.Request{SNSTopicARN: "arn:aws:sns:eu-west-1:123456789012:orders.fifo", SQSGroupField: "customer"}))
+		t.Logf("%s Group field checked against the queue type", greenTick)
+	})
+
+	t.Run("Rejected messages", func(t *testing.T) {
+		records := []map[string]interface{}{
+			{"id": 1},
+			{"id": 2, "customer": "", "note": "empty group"},
+			{"id": 3, "customer": "c1", "note": strings.Repeat("x", 300*1024)},
+		}
+		err := queue.SendData(records, fifo)
+		var rejected *pipeline.RejectedRowsError
+		assert.True(t, errors.As(err, &rejected))
+		assert.Len(t, rejected.Rows, 3)
+		assert.Contains(t, rejected.Rows[0].Reason, "group field customer")
+		assert.Contains(t, rejected.Rows[2].Reason, "over the limit")
+		t.Logf("%s Messages without a group or over the size limit rejected", greenTick)
+	})
+
+	t.Run("Nothing to send", func(t *testing.T) {
+		assert.NoError(t, queue.SendData([]map[string]interface{}{}, base))
+		assert.NoError(t, topic.SendData([]map[string]interface{}{}, interfaces.Request{SNSTopicARN: "arn:aws:sns:eu-west-1:123456789012:orders"}))
+		t.Logf("%s Empty batch skipped", greenTick)
+	})
+}
@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/SkySingh04/fractal/integrations"
+	"github.com/SkySingh04/fractal/interfaces"
+	"github.com/SkySingh04/fractal/pipeline"
+	"github.com/stretchr/testify/assert"
+)
+
+// captureStdout points the data written to standard output at a buffer for the rest of the test
+func captureStdout(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	out := &bytes.Buffer{}
+	previous := integrations.Stdout
+	integrations.Stdout = out
+	t.Cleanup(func() { integrations.Stdout = previous })
+	return out
+}
+
+func TestStdoutDestination(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	input := "id,name\n1,ann\n2,bob\n3,cy"
+
+	t.Run("CSV in batches", func(t *testing.T) {
+		out := captureStdout(t)
+		p := &pipeline.Pipeline{
+			Source:      stubSource{data: input},
+			Destination: integrations.StdoutDestination{},
+			Config:      interfaces.PipelineConfig{Delivery: interfaces.DeliveryConfig{BatchSize: 2}},
+		}
+		summary, err := p.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 2, summary.BatchesWritten)
+		assert.Equal(t, input+"\n", out.String(), "The header should only be written once")
+		t.Logf("%s CSV written to stdout", greenTick)
+	})
+
+	t.Run("JSON lines", func(t *testing.T) {
+		out := captureStdout(t)
+		err := integrations.StdoutDestination{}.SendData(input, interfaces.Request{StdoutFormat: "jsonl"})
+		assert.NoError(t, err)
+		assert.Equal(t, "{\"id\":\"1\",\"name\":\"ann\"}\n{\"id\":\"2\",\"name\":\"bob\"}\n{\"id\":\"3\",\"name\":\"cy\"}\n", out.String())
+		t.Logf("%s JSON lines written to stdout", greenTick)
+	})
+
+	t.Run("File destination given -", func(t *testing.T) {
+		out := captureStdout(t)
+		records := []interface{}{map[string]interface{}{"id": 1}}
+		err := integrations.JSONDestination{}.SendData(records, interfaces.Request{JSONOutputFilename: integrations.StdoutPath})
+		assert.NoError(t, err)
+		assert.JSONEq(t, `[{"id": 1}]`, out.String())
+		assert.True(t, integrations.WritesStdout("JSON", interfaces.Request{JSONOutputFilename: "-"}))
+		assert.False(t, integrations.WritesStdout("JSON", interfaces.Request{JSONOutputFilename: "out.json"}))
+		assert.True(t, integrations.WritesStdout("Stdout", interfaces.Request{}))
+		t.Logf("%s JSON written to stdout", greenTick)
+	})
+
+	t.Run("Invalid settings", func(t *testing.T) {
+		for _, tc := range []struct {
+			dest     interfaces.DataDestination
+			req      interfaces.Request
+			expected string
+		}{
+			{integrations.StdoutDestination{}, interfaces.Request{StdoutFormat: "xml"}, "invalid stdout format"},
+			{integrations.StdoutDestination{}, interfaces.Request{OutputMode: pipeline.OutputPerBatch}, "cannot write to standard output"},
+			{integrations.CSVDestination{}, interfaces.Request{CSVDestinationFileName: "-", PartitionBy: []string{"id"}}, "partitionby cannot write to standard output"},
+			{integrations.YAMLDestination{}, interfaces.Request{YAMLDestinationFilePath: "-", OutputMode: pipeline.OutputSized}, "cannot write to standard output"},
+		} {
+			err := tc.dest.(interfaces.ConfigValidator).ValidateConfig(tc.req)
+			assert.ErrorIs(t, err, interfaces.ErrConfigInvalid)
+			assert.ErrorContains(t, err, tc.expected)
+		}
+		t.Logf("%s Invalid stdout settings rejected", greenTick)
+	})
+}
@@ -2,6 +2,7 @@ package tests
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/SkySingh04/fractal/integrations"
@@ -110,3 +111,19 @@ skills:
 		logTestStatus("Validate 'transformed' key in output", assert.AnError)
 	}
 }
+
+func TestYAMLFilePatterns(t *testing.T) {
+	greenTick := "\033[32m✔\033[0m"
+
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "b.yml"), []byte("- id: 2\n- id: 3\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.yaml"), []byte("id: 1\n"), 0644))
+
+	data, err := integrations.YAMLSource{}.FetchData(interfaces.Request{YAMLSourceFilePath: dir})
+	assert.NoError(t, err)
+	records := data.([]interface{})
+	assert.Len(t, records, 3)
+	assert.Equal(t, filepath.Join(dir, "a.yaml"), records[0].(map[string]interface{})[integrations.DefaultSourceFileField])
+	assert.Equal(t, 3, records[2].(map[string]interface{})["id"])
+	t.Logf("%s YAML directory passed", greenTick)
+}
@@ -0,0 +1,61 @@
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build metadata, injected at build time with
+//
+//	go build -ldflags "-X github.com/SkySingh04/fractal/version.Version=v1.2.0 \
+//	  -X github.com/SkySingh04/fractal/version.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/SkySingh04/fractal/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// A build without them falls back to what the Go toolchain recorded.
+var (
+	Version   = ""
+	Commit    = ""
+	BuildDate = ""
+)
+
+// Unknown is reported for build metadata that was neither injected nor recorded
+const Unknown = "unknown"
+
+// Info describes the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build metadata, preferring the values injected with ldflags
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildDate: BuildDate, GoVersion: runtime.Version()}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+			info.Version = build.Main.Version
+		}
+		for _, setting := range build.Settings {
+			if setting.Key == "vcs.revision" && info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	if info.Commit == "" {
+		info.Commit = Unknown
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = Unknown
+	}
+	return info
+}
+
+// String renders the metadata as the version command prints it
+func (i Info) String() string {
+	return fmt.Sprintf("fractal %s\ncommit: %s\nbuilt: %s\ngo: %s", i.Version, i.Commit, i.BuildDate, i.GoVersion)
+}